@@ -0,0 +1,579 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"supercronic/cron"
+	"supercronic/history"
+)
+
+// Server exposes the jobs in a cron.Registry over HTTP:
+//
+//	GET  /jobs                list jobs
+//	GET  /jobs/{id}           show a job (by ID or name)
+//	POST /jobs/{id}/trigger   run a job now (add ?follow=1 to stream its output)
+//	POST /jobs/{id}/pause     stop scheduling a job
+//	POST /jobs/{id}/resume    resume scheduling a job
+//	POST /jobs/{id}/reset     reset a job's circuit breaker
+//	GET  /jobs/{id}/history   list past runs of a job
+//	GET  /jobs/{id}/output    show the output of a job's latest run (add
+//	                          ?follow=1 to stream it, and that of later runs)
+//	GET  /events              stream events as jobs start and finish
+//	POST /reload              reload the crontab
+//	GET  /healthz             liveness probe
+//	GET  /ready               readiness probe, per Health
+//	GET  /                    web dashboard
+//	GET  /debug/pprof/        profiles, and /debug/vars (see EnableDebug)
+//
+// It also serves the gRPC control API (see adminpb.ControlServer), over
+// HTTP/2 without TLS.
+//
+// When store is nil, the history endpoint is disabled, and jobs only report
+// their last run since supercronic started. The event stream and reloading
+// are disabled until SetEvents and SetReloader are called. When a token is
+// set (see SetToken), requests that control jobs (i.e. POST requests) must
+// present it. Otherwise, they must be JSON (see authorize).
+type Server struct {
+	registry *cron.Registry
+	store    *history.Store
+	logger   *logrus.Entry
+	health   *Health
+	mux      *http.ServeMux
+	token    string
+	events   *Events
+	reload   func()
+	grpc     *grpc.Server
+}
+
+// Default number of records returned by the history endpoint.
+const defaultHistoryLimit = 20
+
+// jobResponse augments a job's status with data from the history store.
+type jobResponse struct {
+	cron.JobStatus
+	LastSuccess    *time.Time `json:"last_success,omitempty"`
+	LastSuccessAge *float64   `json:"last_success_age_seconds,omitempty"`
+}
+
+func NewServer(registry *cron.Registry, store *history.Store, logger *logrus.Entry) *Server {
+	s := &Server{
+		registry: registry,
+		store:    store,
+		logger:   logger,
+		health:   NewHealth(),
+		mux:      http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("/jobs", s.handleJobs)
+	s.mux.HandleFunc("/jobs/", s.handleJob)
+	s.mux.HandleFunc("/healthz", s.handleHealthz)
+	s.mux.HandleFunc("/ready", s.handleReady)
+	s.mux.HandleFunc("/events", s.handleEvents)
+	s.mux.HandleFunc("/reload", s.handleReload)
+	s.mux.HandleFunc("/", s.handleDashboard)
+
+	s.grpc = newGRPCServer(s)
+
+	return s
+}
+
+// SetToken requires requests that control jobs to present token, as a
+// bearer token. It also enables the controls of the web dashboard, which
+// are hidden otherwise.
+func (s *Server) SetToken(token string) {
+	s.token = token
+}
+
+// SetEvents streams the events of events, which must be one of the hooks
+// jobs run with.
+func (s *Server) SetEvents(events *Events) {
+	s.events = events
+}
+
+// SetReloader has the server call reload to reload the crontab. It should
+// not block.
+func (s *Server) SetReloader(reload func()) {
+	s.reload = reload
+}
+
+// trustedKey marks the context of requests that arrived on the control
+// socket.
+type trustedKey struct{}
+
+// authorize reports whether r may control jobs, and responds to it if not.
+// Without a token, anyone may, as long as POST requests are JSON: browsers
+// don't send those across origins without asking first, so other web pages
+// can't control jobs. Requests that arrived on the control socket always may:
+// only users that may write to it can connect.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if r.Context().Value(trustedKey{}) != nil {
+		return true
+	}
+
+	if s.token == "" {
+		if r.Method != http.MethodPost {
+			return true
+		}
+
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+			return true
+		}
+
+		writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("POST requests must have Content-Type: application/json"))
+		return false
+	}
+
+	header := r.Header.Get("Authorization")
+	if strings.HasPrefix(header, "Bearer ") && subtle.ConstantTimeCompare([]byte(header[len("Bearer "):]), []byte(s.token)) == 1 {
+		return true
+	}
+
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid token"))
+	return false
+}
+
+// Health is what the server reports from /ready. It starts out not ready.
+func (s *Server) Health() *Health {
+	return s.health
+}
+
+// ListenAndServe listens on addr, and serves requests in the background.
+// Errors binding to addr are returned synchronously.
+func (s *Server) ListenAndServe(addr string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Infof("admin API listening on %s", listener.Addr())
+
+	go func() {
+		err := http.Serve(listener, h2c.NewHandler(s, &http2.Server{}))
+		s.logger.Debugf("admin API stopped: %v", err)
+	}()
+
+	return listener, nil
+}
+
+// ListenAndServeUnix listens on a control socket at path, only accessible to
+// the current user, and serves requests in the background. Errors creating
+// the socket are returned synchronously. A stale socket (e.g. left over by
+// a supercronic that crashed) is replaced.
+func (s *Server) ListenAndServeUnix(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s is in use", path)
+	}
+	os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	s.logger.Infof("control socket listening on %s", path)
+
+	trusted := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), trustedKey{}, true)))
+	})
+
+	go func() {
+		err := http.Serve(listener, h2c.NewHandler(trusted, &http2.Server{}))
+		s.logger.Debugf("control socket stopped: %v", err)
+	}()
+
+	return listener, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		s.grpc.ServeHTTP(w, r)
+		return
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	jobs := s.registry.Jobs()
+	responses := make([]*jobResponse, 0, len(jobs))
+
+	for _, job := range jobs {
+		response, err := s.jobResponse(job)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		responses = append(responses, response)
+	}
+
+	writeJSON(w, http.StatusOK, responses)
+}
+
+func (s *Server) jobResponse(job *cron.JobState) (*jobResponse, error) {
+	response := &jobResponse{JobStatus: job.Status()}
+
+	if s.store == nil {
+		return response, nil
+	}
+
+	record, err := s.store.LastSuccess(job.Job)
+	if err != nil {
+		return nil, err
+	}
+
+	if record != nil {
+		age := time.Since(record.FinishedAt).Seconds()
+		response.LastSuccess = &record.FinishedAt
+		response.LastSuccessAge = &age
+	}
+
+	return response, nil
+}
+
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	if len(parts) > 2 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("not found: %s", r.URL.Path))
+		return
+	}
+
+	// Jobs can be referred to by ID, or by name if they have one: names
+	// don't change when the crontab is reloaded.
+	var job *cron.JobState
+	if id, err := strconv.Atoi(parts[0]); err == nil {
+		job = s.registry.Job(id)
+	} else {
+		job = s.registry.JobByName(parts[0])
+	}
+
+	if job == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no such job: %s", parts[0]))
+		return
+	}
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+
+		response, err := s.jobResponse(job)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+
+	if parts[1] == "history" {
+		s.handleHistory(w, r, job)
+		return
+	}
+
+	if parts[1] == "output" {
+		s.handleOutput(w, r, job)
+		return
+	}
+
+	if parts[1] == "trigger" && r.URL.Query().Get("follow") != "" {
+		s.handleFollow(w, r, job)
+		return
+	}
+
+	var action func()
+
+	switch parts[1] {
+	case "trigger":
+		action = job.Trigger
+	case "pause":
+		action = job.Pause
+	case "resume":
+		action = job.Resume
+	case "reset":
+		action = job.ResetCircuitBreaker
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("not found: %s", r.URL.Path))
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	if !s.authorize(w, r) {
+		return
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"job.schedule": job.Job.Schedule,
+		"job.command":  job.Job.Command,
+		"job.position": job.Job.Position,
+	}).Infof("admin API: %s", parts[1])
+
+	action()
+
+	writeJSON(w, http.StatusAccepted, job.Status())
+}
+
+// RunEvent is what following a run streams, one per line: a line of output,
+// and lastly (with Done set) how the run went.
+type RunEvent struct {
+	Channel string `json:"channel,omitempty"`
+	Text    string `json:"text,omitempty"`
+
+	Done     bool   `json:"done,omitempty"`
+	ExitCode int    `json:"exit_code,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// handleFollow triggers job, and streams the output of the run that follows
+// until it finishes.
+func (s *Server) handleFollow(w http.ResponseWriter, r *http.Request, job *cron.JobState) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	if !s.authorize(w, r) {
+		return
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"job.schedule": job.Job.Schedule,
+		"job.command":  job.Job.Command,
+		"job.position": job.Job.Position,
+	}).Info("admin API: trigger (following output)")
+
+	since := time.Now()
+	job.Trigger()
+
+	// The run may have to wait for a previous one to finish first.
+	e, err := job.WaitForStart(r.Context(), since)
+	if err != nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	streamRun(w, r, json.NewEncoder(w), e)
+}
+
+// handleTail streams the output of job's latest run (or of its next one, if
+// it never ran), and that of the runs that follow, until the client goes
+// away.
+func (s *Server) handleTail(w http.ResponseWriter, r *http.Request, job *cron.JobState) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	encoder := json.NewEncoder(w)
+
+	var since time.Time
+	for {
+		e, _ := job.LatestExecution()
+		if e == nil || e.StartedAt.Before(since) {
+			var err error
+			if e, err = job.WaitForStart(r.Context(), since); err != nil {
+				return
+			}
+		}
+
+		if !streamRun(w, r, encoder, e) {
+			return
+		}
+
+		since = e.StartedAt.Add(time.Nanosecond)
+	}
+}
+
+// streamRun streams the output of e until it finishes, and then how it
+// went. It reports whether it got that far, i.e. whether the client is
+// still there.
+func streamRun(w http.ResponseWriter, r *http.Request, encoder *json.Encoder, e *cron.Execution) bool {
+	flusher, _ := w.(http.Flusher)
+
+	next := 0
+	for {
+		lines, n, changed, closed := e.Output.Since(next)
+		next = n
+
+		for _, line := range lines {
+			if err := encoder.Encode(&RunEvent{Channel: line.Channel, Text: line.Text}); err != nil {
+				return false
+			}
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		if closed {
+			break
+		}
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return false
+		}
+	}
+
+	done := &RunEvent{Done: true, ExitCode: e.ExitCode}
+	if e.Err != nil {
+		done.Error = e.Err.Error()
+	}
+
+	if err := encoder.Encode(done); err != nil {
+		return false
+	}
+
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	return true
+}
+
+// OutputResponse is the output of a job's latest run, as far as it was kept
+// (see cron.MAX_CAPTURED_OUTPUT). StartedAt is nil if the job hasn't run yet.
+type OutputResponse struct {
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	Running   bool       `json:"running"`
+	Lines     []RunEvent `json:"lines"`
+}
+
+func (s *Server) handleOutput(w http.ResponseWriter, r *http.Request, job *cron.JobState) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	limit := -1
+	if value := r.URL.Query().Get("lines"); value != "" {
+		l, err := strconv.Atoi(value)
+		if err != nil || l < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid lines: %q", value))
+			return
+		}
+		limit = l
+	}
+
+	if r.URL.Query().Get("follow") != "" {
+		s.handleTail(w, r, job)
+		return
+	}
+
+	response := &OutputResponse{Lines: []RunEvent{}}
+
+	e, running := job.LatestExecution()
+	if e != nil {
+		startedAt := e.StartedAt
+		response.StartedAt = &startedAt
+		response.Running = running
+
+		lines := e.Output.Lines()
+		if limit >= 0 && len(lines) > limit {
+			lines = lines[len(lines)-limit:]
+		}
+
+		for _, line := range lines {
+			response.Lines = append(response.Lines, RunEvent{Channel: line.Channel, Text: line.Text})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request, job *cron.JobState) {
+	if s.store == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("history is not enabled"))
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	limit := defaultHistoryLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		l, err := strconv.Atoi(value)
+		if err != nil || l < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %q", value))
+			return
+		}
+		limit = l
+	}
+
+	records, err := s.store.History(job.Job, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, records)
+}
+
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if s.reload == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("reloading is not enabled"))
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	if !s.authorize(w, r) {
+		return
+	}
+
+	s.logger.Info("admin API: reload")
+	s.reload()
+
+	writeJSON(w, http.StatusAccepted, map[string]string{})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
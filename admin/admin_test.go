@@ -0,0 +1,368 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"supercronic/cron"
+	"supercronic/crontab"
+	"supercronic/history"
+)
+
+type hourlyExpression struct{}
+
+func (e hourlyExpression) Next(t time.Time) time.Time {
+	return t.Add(time.Hour)
+}
+
+func newTestServer(t *testing.T, store *history.Store) (*httptest.Server, *cron.Registry, func()) {
+	logger := logrus.NewEntry(logrus.New())
+	logger.Logger.Out = ioutil.Discard
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: hourlyExpression{},
+			Schedule:   "@hourly",
+			Command:    "true",
+		},
+		Position: 0,
+	}
+
+	cronCtx := &crontab.Context{Shell: "/bin/sh", Environ: map[string]string{}}
+
+	registry := cron.NewRegistry()
+	registry.Add(cron.StartJob(&wg, cronCtx, job, ctx, logger, cron.Options{}))
+
+	server := httptest.NewServer(NewServer(registry, store, logger))
+
+	return server, registry, func() {
+		server.Close()
+		cancel()
+		wg.Wait()
+	}
+}
+
+func decode(t *testing.T, resp *http.Response, v interface{}) {
+	defer resp.Body.Close()
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(v))
+}
+
+func TestListJobs(t *testing.T) {
+	server, _, stop := newTestServer(t, nil)
+	defer stop()
+
+	resp, err := http.Get(server.URL + "/jobs")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var jobs []cron.JobStatus
+	decode(t, resp, &jobs)
+
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, 0, jobs[0].ID)
+		assert.Equal(t, "@hourly", jobs[0].Schedule)
+		assert.Equal(t, "true", jobs[0].Command)
+		assert.False(t, jobs[0].Paused)
+		assert.Nil(t, jobs[0].LastRun)
+	}
+}
+
+func TestTriggerJob(t *testing.T) {
+	server, registry, stop := newTestServer(t, nil)
+	defer stop()
+
+	resp, err := http.Post(server.URL+"/jobs/0/trigger", "application/json", nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	deadline := time.Now().Add(time.Second)
+	for registry.Job(0).Status().LastRun == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for triggered run")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	resp, err = http.Get(server.URL + "/jobs/0")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	var job cron.JobStatus
+	decode(t, resp, &job)
+
+	if assert.NotNil(t, job.LastRun) {
+		assert.True(t, job.LastRun.Succeeded)
+	}
+}
+
+func TestPauseResumeJob(t *testing.T) {
+	server, registry, stop := newTestServer(t, nil)
+	defer stop()
+
+	resp, err := http.Post(server.URL+"/jobs/0/pause", "application/json", nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	var job cron.JobStatus
+	decode(t, resp, &job)
+	assert.True(t, job.Paused)
+	assert.True(t, registry.Job(0).IsPaused())
+
+	resp, err = http.Post(server.URL+"/jobs/0/resume", "application/json", nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	decode(t, resp, &job)
+	assert.False(t, job.Paused)
+}
+
+func TestResetCircuitBreaker(t *testing.T) {
+	server, _, stop := newTestServer(t, nil)
+	defer stop()
+
+	resp, err := http.Post(server.URL+"/jobs/0/reset", "application/json", nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	var job cron.JobStatus
+	decode(t, resp, &job)
+	assert.False(t, job.Tripped)
+	assert.Equal(t, 0, job.ConsecutiveFailures)
+}
+
+func TestPauseJobByName(t *testing.T) {
+	server, registry, stop := newTestServer(t, nil)
+	defer stop()
+
+	registry.Job(0).Job.Name = "noop"
+
+	resp, err := http.Post(server.URL+"/jobs/noop/pause", "application/json", nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	var job cron.JobStatus
+	decode(t, resp, &job)
+	assert.Equal(t, "noop", job.Name)
+	assert.True(t, job.Paused)
+	assert.True(t, registry.Job(0).IsPaused())
+}
+
+func TestRejectsCrossSiteRequests(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	logger.Logger.Out = ioutil.Discard
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	defer wg.Wait()
+	defer cancel()
+
+	registry := cron.NewRegistry()
+	registry.Add(cron.StartJob(&wg, &crontab.Context{Shell: "/bin/sh", Environ: map[string]string{}}, &crontab.Job{
+		CrontabLine: crontab.CrontabLine{Expression: hourlyExpression{}, Schedule: "@hourly", Command: "true"},
+	}, ctx, logger, cron.Options{}))
+
+	server := NewServer(registry, nil, logger)
+
+	// Without a token, POST requests must be JSON: HTML forms can't send
+	// those to other origins.
+	for _, tt := range []struct {
+		contentType string
+		status      int
+	}{
+		{"", http.StatusUnsupportedMediaType},
+		{"application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"text/plain", http.StatusUnsupportedMediaType},
+		{"multipart/form-data; boundary=x", http.StatusUnsupportedMediaType},
+		{"application/json; charset=utf-8", http.StatusAccepted},
+	} {
+		req := httptest.NewRequest("POST", "/jobs/0/pause", strings.NewReader(""))
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		assert.Equal(t, tt.status, w.Code, tt.contentType)
+	}
+
+	assert.True(t, registry.Job(0).IsPaused())
+}
+
+func TestJobHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-admin")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := history.Open(filepath.Join(dir, "history.db"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer store.Close()
+
+	server, registry, stop := newTestServer(t, store)
+	defer stop()
+
+	finishedAt := time.Now().Add(-time.Hour)
+	job := registry.Job(0).Job
+
+	assert.Nil(t, store.Add(job, &history.Record{FinishedAt: finishedAt, Succeeded: true}))
+	assert.Nil(t, store.Add(job, &history.Record{FinishedAt: finishedAt.Add(time.Minute), Error: "boom"}))
+
+	resp, err := http.Get(server.URL + "/jobs")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	var jobs []jobResponse
+	decode(t, resp, &jobs)
+
+	if assert.Len(t, jobs, 1) && assert.NotNil(t, jobs[0].LastSuccess) {
+		assert.True(t, jobs[0].LastSuccess.Equal(finishedAt))
+		assert.InDelta(t, 3600, *jobs[0].LastSuccessAge, 60)
+	}
+
+	resp, err = http.Get(server.URL + "/jobs/0/history?limit=1")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	var records []history.Record
+	decode(t, resp, &records)
+
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "boom", records[0].Error)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	server, _, stop := newTestServer(t, nil)
+	defer stop()
+
+	testCases := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"GET", "/jobs/1", http.StatusNotFound},
+		{"GET", "/jobs/foo", http.StatusNotFound},
+		{"POST", "/jobs/0/explode", http.StatusNotFound},
+		{"GET", "/jobs/0/trigger", http.StatusMethodNotAllowed},
+		{"POST", "/jobs", http.StatusMethodNotAllowed},
+		{"GET", "/jobs/0/history", http.StatusNotFound},
+		{"GET", "/nope", http.StatusNotFound},
+		{"POST", "/", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range testCases {
+		req, err := http.NewRequest(tt.method, server.URL+tt.path, nil)
+		if !assert.Nil(t, err) {
+			continue
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if !assert.Nil(t, err) {
+			continue
+		}
+
+		assert.Equal(t, tt.status, resp.StatusCode, "%s %s", tt.method, tt.path)
+
+		var body map[string]string
+		decode(t, resp, &body)
+		assert.NotEmpty(t, body["error"])
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	logger.Logger.Out = ioutil.Discard
+
+	server := NewServer(cron.NewRegistry(), nil, logger)
+
+	get := func() string {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+		return w.Body.String()
+	}
+
+	body := get()
+	assert.Regexp(t, `var controls = *false *;`, body)
+	assert.Regexp(t, `var historyEnabled = *false *;`, body)
+
+	server.SetToken("secret")
+	assert.Regexp(t, `var controls = *true *;`, get())
+}
+
+func TestToken(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	logger.Logger.Out = ioutil.Discard
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	defer wg.Wait()
+	defer cancel()
+
+	registry := cron.NewRegistry()
+	registry.Add(cron.StartJob(&wg, &crontab.Context{Shell: "/bin/sh", Environ: map[string]string{}}, &crontab.Job{
+		CrontabLine: crontab.CrontabLine{Expression: hourlyExpression{}, Schedule: "@hourly", Command: "true"},
+	}, ctx, logger, cron.Options{}))
+
+	server := NewServer(registry, nil, logger)
+	server.SetToken("secret")
+
+	for _, tt := range []struct {
+		method        string
+		path          string
+		authorization string
+		status        int
+	}{
+		{"GET", "/jobs", "", http.StatusOK},
+		{"POST", "/jobs/0/pause", "", http.StatusUnauthorized},
+		{"POST", "/jobs/0/pause", "Bearer nope", http.StatusUnauthorized},
+		{"POST", "/jobs/0/pause", "secret", http.StatusUnauthorized},
+		{"POST", "/jobs/0/trigger?follow=1", "", http.StatusUnauthorized},
+		{"POST", "/jobs/0/pause", "Bearer secret", http.StatusAccepted},
+	} {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(""))
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		assert.Equal(t, tt.status, w.Code, "%s %s (%s)", tt.method, tt.path, tt.authorization)
+	}
+
+	assert.True(t, registry.Job(0).IsPaused())
+}
@@ -0,0 +1,994 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: admin/adminpb/admin.proto
+
+package adminpb
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	duration "github.com/golang/protobuf/ptypes/duration"
+	timestamp "github.com/golang/protobuf/ptypes/timestamp"
+	grpc "google.golang.org/grpc"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type RunEvent_Type int32
+
+const (
+	RunEvent_UNKNOWN  RunEvent_Type = 0
+	RunEvent_STARTED  RunEvent_Type = 1
+	RunEvent_FINISHED RunEvent_Type = 2
+)
+
+var RunEvent_Type_name = map[int32]string{
+	0: "UNKNOWN",
+	1: "STARTED",
+	2: "FINISHED",
+}
+
+var RunEvent_Type_value = map[string]int32{
+	"UNKNOWN":  0,
+	"STARTED":  1,
+	"FINISHED": 2,
+}
+
+func (x RunEvent_Type) String() string {
+	return proto.EnumName(RunEvent_Type_name, int32(x))
+}
+
+func (RunEvent_Type) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_2f6b6a6c24563593, []int{6, 0}
+}
+
+type ListJobsRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListJobsRequest) Reset()         { *m = ListJobsRequest{} }
+func (m *ListJobsRequest) String() string { return proto.CompactTextString(m) }
+func (*ListJobsRequest) ProtoMessage()    {}
+func (*ListJobsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2f6b6a6c24563593, []int{0}
+}
+
+func (m *ListJobsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListJobsRequest.Unmarshal(m, b)
+}
+func (m *ListJobsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListJobsRequest.Marshal(b, m, deterministic)
+}
+func (m *ListJobsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListJobsRequest.Merge(m, src)
+}
+func (m *ListJobsRequest) XXX_Size() int {
+	return xxx_messageInfo_ListJobsRequest.Size(m)
+}
+func (m *ListJobsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListJobsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListJobsRequest proto.InternalMessageInfo
+
+type ListJobsResponse struct {
+	Jobs                 []*Job   `protobuf:"bytes,1,rep,name=jobs,proto3" json:"jobs,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListJobsResponse) Reset()         { *m = ListJobsResponse{} }
+func (m *ListJobsResponse) String() string { return proto.CompactTextString(m) }
+func (*ListJobsResponse) ProtoMessage()    {}
+func (*ListJobsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2f6b6a6c24563593, []int{1}
+}
+
+func (m *ListJobsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListJobsResponse.Unmarshal(m, b)
+}
+func (m *ListJobsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListJobsResponse.Marshal(b, m, deterministic)
+}
+func (m *ListJobsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListJobsResponse.Merge(m, src)
+}
+func (m *ListJobsResponse) XXX_Size() int {
+	return xxx_messageInfo_ListJobsResponse.Size(m)
+}
+func (m *ListJobsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListJobsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListJobsResponse proto.InternalMessageInfo
+
+func (m *ListJobsResponse) GetJobs() []*Job {
+	if m != nil {
+		return m.Jobs
+	}
+	return nil
+}
+
+type JobRequest struct {
+	// The ID or name of the job.
+	Job                  string   `protobuf:"bytes,1,opt,name=job,proto3" json:"job,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *JobRequest) Reset()         { *m = JobRequest{} }
+func (m *JobRequest) String() string { return proto.CompactTextString(m) }
+func (*JobRequest) ProtoMessage()    {}
+func (*JobRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2f6b6a6c24563593, []int{2}
+}
+
+func (m *JobRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_JobRequest.Unmarshal(m, b)
+}
+func (m *JobRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_JobRequest.Marshal(b, m, deterministic)
+}
+func (m *JobRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_JobRequest.Merge(m, src)
+}
+func (m *JobRequest) XXX_Size() int {
+	return xxx_messageInfo_JobRequest.Size(m)
+}
+func (m *JobRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_JobRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_JobRequest proto.InternalMessageInfo
+
+func (m *JobRequest) GetJob() string {
+	if m != nil {
+		return m.Job
+	}
+	return ""
+}
+
+// Job is a snapshot of a job's state.
+type Job struct {
+	Id                   int32                `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name                 string               `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Schedule             string               `protobuf:"bytes,3,opt,name=schedule,proto3" json:"schedule,omitempty"`
+	Command              string               `protobuf:"bytes,4,opt,name=command,proto3" json:"command,omitempty"`
+	Position             int32                `protobuf:"varint,5,opt,name=position,proto3" json:"position,omitempty"`
+	Source               string               `protobuf:"bytes,6,opt,name=source,proto3" json:"source,omitempty"`
+	NextRun              *timestamp.Timestamp `protobuf:"bytes,7,opt,name=next_run,json=nextRun,proto3" json:"next_run,omitempty"`
+	Running              int32                `protobuf:"varint,8,opt,name=running,proto3" json:"running,omitempty"`
+	Waiting              int32                `protobuf:"varint,9,opt,name=waiting,proto3" json:"waiting,omitempty"`
+	RunningSince         *timestamp.Timestamp `protobuf:"bytes,10,opt,name=running_since,json=runningSince,proto3" json:"running_since,omitempty"`
+	Paused               bool                 `protobuf:"varint,11,opt,name=paused,proto3" json:"paused,omitempty"`
+	LastRun              *Run                 `protobuf:"bytes,12,opt,name=last_run,json=lastRun,proto3" json:"last_run,omitempty"`
+	ConsecutiveFailures  int32                `protobuf:"varint,13,opt,name=consecutive_failures,json=consecutiveFailures,proto3" json:"consecutive_failures,omitempty"`
+	Tripped              bool                 `protobuf:"varint,14,opt,name=tripped,proto3" json:"tripped,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *Job) Reset()         { *m = Job{} }
+func (m *Job) String() string { return proto.CompactTextString(m) }
+func (*Job) ProtoMessage()    {}
+func (*Job) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2f6b6a6c24563593, []int{3}
+}
+
+func (m *Job) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Job.Unmarshal(m, b)
+}
+func (m *Job) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Job.Marshal(b, m, deterministic)
+}
+func (m *Job) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Job.Merge(m, src)
+}
+func (m *Job) XXX_Size() int {
+	return xxx_messageInfo_Job.Size(m)
+}
+func (m *Job) XXX_DiscardUnknown() {
+	xxx_messageInfo_Job.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Job proto.InternalMessageInfo
+
+func (m *Job) GetId() int32 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+func (m *Job) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Job) GetSchedule() string {
+	if m != nil {
+		return m.Schedule
+	}
+	return ""
+}
+
+func (m *Job) GetCommand() string {
+	if m != nil {
+		return m.Command
+	}
+	return ""
+}
+
+func (m *Job) GetPosition() int32 {
+	if m != nil {
+		return m.Position
+	}
+	return 0
+}
+
+func (m *Job) GetSource() string {
+	if m != nil {
+		return m.Source
+	}
+	return ""
+}
+
+func (m *Job) GetNextRun() *timestamp.Timestamp {
+	if m != nil {
+		return m.NextRun
+	}
+	return nil
+}
+
+func (m *Job) GetRunning() int32 {
+	if m != nil {
+		return m.Running
+	}
+	return 0
+}
+
+func (m *Job) GetWaiting() int32 {
+	if m != nil {
+		return m.Waiting
+	}
+	return 0
+}
+
+func (m *Job) GetRunningSince() *timestamp.Timestamp {
+	if m != nil {
+		return m.RunningSince
+	}
+	return nil
+}
+
+func (m *Job) GetPaused() bool {
+	if m != nil {
+		return m.Paused
+	}
+	return false
+}
+
+func (m *Job) GetLastRun() *Run {
+	if m != nil {
+		return m.LastRun
+	}
+	return nil
+}
+
+func (m *Job) GetConsecutiveFailures() int32 {
+	if m != nil {
+		return m.ConsecutiveFailures
+	}
+	return 0
+}
+
+func (m *Job) GetTripped() bool {
+	if m != nil {
+		return m.Tripped
+	}
+	return false
+}
+
+// Run is how a finished run went.
+type Run struct {
+	ScheduledAt          *timestamp.Timestamp `protobuf:"bytes,1,opt,name=scheduled_at,json=scheduledAt,proto3" json:"scheduled_at,omitempty"`
+	StartedAt            *timestamp.Timestamp `protobuf:"bytes,2,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`
+	FinishedAt           *timestamp.Timestamp `protobuf:"bytes,3,opt,name=finished_at,json=finishedAt,proto3" json:"finished_at,omitempty"`
+	Succeeded            bool                 `protobuf:"varint,4,opt,name=succeeded,proto3" json:"succeeded,omitempty"`
+	ExitCode             int32                `protobuf:"varint,5,opt,name=exit_code,json=exitCode,proto3" json:"exit_code,omitempty"`
+	Error                string               `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *Run) Reset()         { *m = Run{} }
+func (m *Run) String() string { return proto.CompactTextString(m) }
+func (*Run) ProtoMessage()    {}
+func (*Run) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2f6b6a6c24563593, []int{4}
+}
+
+func (m *Run) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Run.Unmarshal(m, b)
+}
+func (m *Run) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Run.Marshal(b, m, deterministic)
+}
+func (m *Run) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Run.Merge(m, src)
+}
+func (m *Run) XXX_Size() int {
+	return xxx_messageInfo_Run.Size(m)
+}
+func (m *Run) XXX_DiscardUnknown() {
+	xxx_messageInfo_Run.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Run proto.InternalMessageInfo
+
+func (m *Run) GetScheduledAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.ScheduledAt
+	}
+	return nil
+}
+
+func (m *Run) GetStartedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.StartedAt
+	}
+	return nil
+}
+
+func (m *Run) GetFinishedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.FinishedAt
+	}
+	return nil
+}
+
+func (m *Run) GetSucceeded() bool {
+	if m != nil {
+		return m.Succeeded
+	}
+	return false
+}
+
+func (m *Run) GetExitCode() int32 {
+	if m != nil {
+		return m.ExitCode
+	}
+	return 0
+}
+
+func (m *Run) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+type StreamRunsRequest struct {
+	// Only stream the runs of the job with this name, if set.
+	JobName              string   `protobuf:"bytes,1,opt,name=job_name,json=jobName,proto3" json:"job_name,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *StreamRunsRequest) Reset()         { *m = StreamRunsRequest{} }
+func (m *StreamRunsRequest) String() string { return proto.CompactTextString(m) }
+func (*StreamRunsRequest) ProtoMessage()    {}
+func (*StreamRunsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2f6b6a6c24563593, []int{5}
+}
+
+func (m *StreamRunsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StreamRunsRequest.Unmarshal(m, b)
+}
+func (m *StreamRunsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StreamRunsRequest.Marshal(b, m, deterministic)
+}
+func (m *StreamRunsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StreamRunsRequest.Merge(m, src)
+}
+func (m *StreamRunsRequest) XXX_Size() int {
+	return xxx_messageInfo_StreamRunsRequest.Size(m)
+}
+func (m *StreamRunsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_StreamRunsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StreamRunsRequest proto.InternalMessageInfo
+
+func (m *StreamRunsRequest) GetJobName() string {
+	if m != nil {
+		return m.JobName
+	}
+	return ""
+}
+
+// RunEvent reports that a run started, and then that it finished (along with
+// how it went).
+type RunEvent struct {
+	Type        RunEvent_Type        `protobuf:"varint,1,opt,name=type,proto3,enum=supercronic.admin.RunEvent_Type" json:"type,omitempty"`
+	JobName     string               `protobuf:"bytes,2,opt,name=job_name,json=jobName,proto3" json:"job_name,omitempty"`
+	JobSchedule string               `protobuf:"bytes,3,opt,name=job_schedule,json=jobSchedule,proto3" json:"job_schedule,omitempty"`
+	JobCommand  string               `protobuf:"bytes,4,opt,name=job_command,json=jobCommand,proto3" json:"job_command,omitempty"`
+	JobPosition int32                `protobuf:"varint,5,opt,name=job_position,json=jobPosition,proto3" json:"job_position,omitempty"`
+	JobSource   string               `protobuf:"bytes,6,opt,name=job_source,json=jobSource,proto3" json:"job_source,omitempty"`
+	Iteration   uint64               `protobuf:"varint,7,opt,name=iteration,proto3" json:"iteration,omitempty"`
+	ScheduledAt *timestamp.Timestamp `protobuf:"bytes,8,opt,name=scheduled_at,json=scheduledAt,proto3" json:"scheduled_at,omitempty"`
+	StartedAt   *timestamp.Timestamp `protobuf:"bytes,9,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`
+	// Only set once the run finished.
+	FinishedAt           *timestamp.Timestamp `protobuf:"bytes,10,opt,name=finished_at,json=finishedAt,proto3" json:"finished_at,omitempty"`
+	Duration             *duration.Duration   `protobuf:"bytes,11,opt,name=duration,proto3" json:"duration,omitempty"`
+	Succeeded            bool                 `protobuf:"varint,12,opt,name=succeeded,proto3" json:"succeeded,omitempty"`
+	Skipped              bool                 `protobuf:"varint,13,opt,name=skipped,proto3" json:"skipped,omitempty"`
+	ExitCode             int32                `protobuf:"varint,14,opt,name=exit_code,json=exitCode,proto3" json:"exit_code,omitempty"`
+	Error                string               `protobuf:"bytes,15,opt,name=error,proto3" json:"error,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *RunEvent) Reset()         { *m = RunEvent{} }
+func (m *RunEvent) String() string { return proto.CompactTextString(m) }
+func (*RunEvent) ProtoMessage()    {}
+func (*RunEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2f6b6a6c24563593, []int{6}
+}
+
+func (m *RunEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RunEvent.Unmarshal(m, b)
+}
+func (m *RunEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RunEvent.Marshal(b, m, deterministic)
+}
+func (m *RunEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RunEvent.Merge(m, src)
+}
+func (m *RunEvent) XXX_Size() int {
+	return xxx_messageInfo_RunEvent.Size(m)
+}
+func (m *RunEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_RunEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RunEvent proto.InternalMessageInfo
+
+func (m *RunEvent) GetType() RunEvent_Type {
+	if m != nil {
+		return m.Type
+	}
+	return RunEvent_UNKNOWN
+}
+
+func (m *RunEvent) GetJobName() string {
+	if m != nil {
+		return m.JobName
+	}
+	return ""
+}
+
+func (m *RunEvent) GetJobSchedule() string {
+	if m != nil {
+		return m.JobSchedule
+	}
+	return ""
+}
+
+func (m *RunEvent) GetJobCommand() string {
+	if m != nil {
+		return m.JobCommand
+	}
+	return ""
+}
+
+func (m *RunEvent) GetJobPosition() int32 {
+	if m != nil {
+		return m.JobPosition
+	}
+	return 0
+}
+
+func (m *RunEvent) GetJobSource() string {
+	if m != nil {
+		return m.JobSource
+	}
+	return ""
+}
+
+func (m *RunEvent) GetIteration() uint64 {
+	if m != nil {
+		return m.Iteration
+	}
+	return 0
+}
+
+func (m *RunEvent) GetScheduledAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.ScheduledAt
+	}
+	return nil
+}
+
+func (m *RunEvent) GetStartedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.StartedAt
+	}
+	return nil
+}
+
+func (m *RunEvent) GetFinishedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.FinishedAt
+	}
+	return nil
+}
+
+func (m *RunEvent) GetDuration() *duration.Duration {
+	if m != nil {
+		return m.Duration
+	}
+	return nil
+}
+
+func (m *RunEvent) GetSucceeded() bool {
+	if m != nil {
+		return m.Succeeded
+	}
+	return false
+}
+
+func (m *RunEvent) GetSkipped() bool {
+	if m != nil {
+		return m.Skipped
+	}
+	return false
+}
+
+func (m *RunEvent) GetExitCode() int32 {
+	if m != nil {
+		return m.ExitCode
+	}
+	return 0
+}
+
+func (m *RunEvent) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+type ReloadRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ReloadRequest) Reset()         { *m = ReloadRequest{} }
+func (m *ReloadRequest) String() string { return proto.CompactTextString(m) }
+func (*ReloadRequest) ProtoMessage()    {}
+func (*ReloadRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2f6b6a6c24563593, []int{7}
+}
+
+func (m *ReloadRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ReloadRequest.Unmarshal(m, b)
+}
+func (m *ReloadRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ReloadRequest.Marshal(b, m, deterministic)
+}
+func (m *ReloadRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReloadRequest.Merge(m, src)
+}
+func (m *ReloadRequest) XXX_Size() int {
+	return xxx_messageInfo_ReloadRequest.Size(m)
+}
+func (m *ReloadRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReloadRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ReloadRequest proto.InternalMessageInfo
+
+type ReloadResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ReloadResponse) Reset()         { *m = ReloadResponse{} }
+func (m *ReloadResponse) String() string { return proto.CompactTextString(m) }
+func (*ReloadResponse) ProtoMessage()    {}
+func (*ReloadResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2f6b6a6c24563593, []int{8}
+}
+
+func (m *ReloadResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ReloadResponse.Unmarshal(m, b)
+}
+func (m *ReloadResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ReloadResponse.Marshal(b, m, deterministic)
+}
+func (m *ReloadResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReloadResponse.Merge(m, src)
+}
+func (m *ReloadResponse) XXX_Size() int {
+	return xxx_messageInfo_ReloadResponse.Size(m)
+}
+func (m *ReloadResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReloadResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ReloadResponse proto.InternalMessageInfo
+
+func init() {
+	proto.RegisterEnum("supercronic.admin.RunEvent_Type", RunEvent_Type_name, RunEvent_Type_value)
+	proto.RegisterType((*ListJobsRequest)(nil), "supercronic.admin.ListJobsRequest")
+	proto.RegisterType((*ListJobsResponse)(nil), "supercronic.admin.ListJobsResponse")
+	proto.RegisterType((*JobRequest)(nil), "supercronic.admin.JobRequest")
+	proto.RegisterType((*Job)(nil), "supercronic.admin.Job")
+	proto.RegisterType((*Run)(nil), "supercronic.admin.Run")
+	proto.RegisterType((*StreamRunsRequest)(nil), "supercronic.admin.StreamRunsRequest")
+	proto.RegisterType((*RunEvent)(nil), "supercronic.admin.RunEvent")
+	proto.RegisterType((*ReloadRequest)(nil), "supercronic.admin.ReloadRequest")
+	proto.RegisterType((*ReloadResponse)(nil), "supercronic.admin.ReloadResponse")
+}
+
+func init() { proto.RegisterFile("admin/adminpb/admin.proto", fileDescriptor_2f6b6a6c24563593) }
+
+var fileDescriptor_2f6b6a6c24563593 = []byte{
+	// 869 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x56, 0x4b, 0x73, 0x1b, 0x45,
+	0x10, 0x66, 0x25, 0xd9, 0x5a, 0xb5, 0x64, 0x59, 0x1e, 0x52, 0xa9, 0xb5, 0x4c, 0x12, 0x65, 0xe1,
+	0xe0, 0xe2, 0xb0, 0x26, 0x82, 0x1c, 0x28, 0x0a, 0x28, 0xc5, 0x76, 0x8a, 0x18, 0x10, 0x61, 0x24,
+	0x8a, 0x2a, 0x2e, 0xaa, 0x7d, 0x8c, 0x95, 0x11, 0xda, 0x99, 0x65, 0x1e, 0x21, 0xf9, 0x07, 0x5c,
+	0xf8, 0x67, 0xdc, 0xf9, 0x3b, 0xd4, 0xcc, 0xec, 0xda, 0x96, 0xfc, 0x2a, 0x4a, 0x17, 0x7b, 0xbf,
+	0xee, 0xaf, 0x7b, 0x5e, 0x5f, 0x77, 0x0b, 0xf6, 0xe3, 0x2c, 0xa7, 0xec, 0xc8, 0xfe, 0x2d, 0x12,
+	0xf7, 0x3f, 0x2a, 0x04, 0x57, 0x1c, 0xed, 0x49, 0x5d, 0x10, 0x91, 0x0a, 0xce, 0x68, 0x1a, 0x59,
+	0x47, 0xff, 0xf1, 0x9c, 0xf3, 0xf9, 0x92, 0x1c, 0x59, 0x42, 0xa2, 0xcf, 0x8f, 0x32, 0x2d, 0x62,
+	0x45, 0x79, 0x19, 0xd2, 0x7f, 0xb2, 0xee, 0x57, 0x34, 0x27, 0x52, 0xc5, 0x79, 0xe1, 0x08, 0xe1,
+	0x1e, 0xec, 0xfe, 0x40, 0xa5, 0x3a, 0xe3, 0x89, 0xc4, 0xe4, 0x0f, 0x4d, 0xa4, 0x0a, 0xbf, 0x81,
+	0xde, 0xa5, 0x49, 0x16, 0x9c, 0x49, 0x82, 0x3e, 0x85, 0xc6, 0x82, 0x27, 0x32, 0xf0, 0x06, 0xf5,
+	0xc3, 0xf6, 0xf0, 0x61, 0x74, 0x6d, 0x27, 0xd1, 0x19, 0x4f, 0xb0, 0xe5, 0x84, 0x8f, 0x01, 0x0c,
+	0x70, 0xd9, 0x50, 0x0f, 0xea, 0x0b, 0x9e, 0x04, 0xde, 0xc0, 0x3b, 0x6c, 0x61, 0xf3, 0x19, 0xfe,
+	0x5b, 0x87, 0xfa, 0x19, 0x4f, 0x50, 0x17, 0x6a, 0x34, 0xb3, 0x8e, 0x2d, 0x5c, 0xa3, 0x19, 0x42,
+	0xd0, 0x60, 0x71, 0x4e, 0x82, 0x9a, 0xa5, 0xda, 0x6f, 0xd4, 0x07, 0x5f, 0xa6, 0x6f, 0x48, 0xa6,
+	0x97, 0x24, 0xa8, 0x5b, 0xfb, 0x05, 0x46, 0x01, 0x34, 0x53, 0x9e, 0xe7, 0x31, 0xcb, 0x82, 0x86,
+	0x75, 0x55, 0xd0, 0x44, 0x15, 0x5c, 0x52, 0x73, 0x0f, 0xc1, 0x96, 0xcd, 0x7f, 0x81, 0xd1, 0x43,
+	0xd8, 0x96, 0x5c, 0x8b, 0x94, 0x04, 0xdb, 0x36, 0xa8, 0x44, 0xe8, 0x39, 0xf8, 0x8c, 0xbc, 0x53,
+	0x33, 0xa1, 0x59, 0xd0, 0x1c, 0x78, 0x87, 0xed, 0x61, 0x3f, 0x72, 0x97, 0x17, 0x55, 0x97, 0x17,
+	0x4d, 0xab, 0xcb, 0xc3, 0x4d, 0xc3, 0xc5, 0x9a, 0x99, 0x4d, 0x08, 0xcd, 0x18, 0x65, 0xf3, 0xc0,
+	0xb7, 0x2b, 0x55, 0xd0, 0x78, 0xfe, 0x8c, 0xa9, 0x32, 0x9e, 0x96, 0xf3, 0x94, 0x10, 0x7d, 0x0b,
+	0x3b, 0x25, 0x69, 0x26, 0x29, 0x4b, 0x49, 0x00, 0xf7, 0xae, 0xd7, 0x29, 0x03, 0x26, 0x86, 0x6f,
+	0xce, 0x50, 0xc4, 0x5a, 0x92, 0x2c, 0x68, 0x0f, 0xbc, 0x43, 0x1f, 0x97, 0x08, 0x3d, 0x03, 0x7f,
+	0x19, 0x4b, 0x77, 0x86, 0xce, 0xc0, 0xbb, 0xe5, 0xa5, 0xb0, 0x66, 0xb8, 0x69, 0x78, 0x66, 0xff,
+	0xcf, 0xe0, 0x41, 0x6a, 0x5e, 0x38, 0xd5, 0x8a, 0xbe, 0x25, 0xb3, 0xf3, 0x98, 0x2e, 0xb5, 0x20,
+	0x32, 0xd8, 0xb1, 0x5b, 0xfe, 0xf0, 0x8a, 0xef, 0x65, 0xe9, 0x32, 0x07, 0x53, 0x82, 0x16, 0x05,
+	0xc9, 0x82, 0xae, 0x5d, 0xbe, 0x82, 0xe1, 0xdf, 0x35, 0xa8, 0x9b, 0xa4, 0x5f, 0x43, 0xa7, 0x7a,
+	0xa5, 0x6c, 0x16, 0xab, 0xc0, 0xbb, 0xf7, 0x7c, 0xed, 0x0b, 0xfe, 0x48, 0xa1, 0x2f, 0x01, 0xa4,
+	0x8a, 0x85, 0x72, 0xc1, 0xb5, 0x7b, 0x83, 0x5b, 0x25, 0x7b, 0xa4, 0xd0, 0x57, 0xd0, 0x3e, 0xa7,
+	0x8c, 0xca, 0x37, 0x2e, 0xb6, 0x7e, 0x6f, 0x2c, 0x54, 0xf4, 0x91, 0x42, 0x1f, 0x41, 0x4b, 0xea,
+	0x34, 0x25, 0x24, 0x23, 0x4e, 0x52, 0x3e, 0xbe, 0x34, 0xa0, 0x03, 0x68, 0x91, 0x77, 0x54, 0xcd,
+	0x52, 0x9e, 0x91, 0x4a, 0x55, 0xc6, 0x70, 0xcc, 0x33, 0x82, 0x1e, 0xc0, 0x16, 0x11, 0x82, 0x8b,
+	0x52, 0x54, 0x0e, 0x84, 0x11, 0xec, 0x4d, 0x94, 0x20, 0x71, 0x8e, 0x35, 0xab, 0xca, 0x0b, 0xed,
+	0x83, 0xbf, 0xe0, 0xc9, 0xcc, 0x4a, 0xdd, 0x55, 0x45, 0x73, 0xc1, 0x93, 0x71, 0x9c, 0x93, 0xf0,
+	0xaf, 0x2d, 0xf0, 0xb1, 0x66, 0xa7, 0x6f, 0x09, 0x53, 0xe8, 0x0b, 0x68, 0xa8, 0xf7, 0x85, 0xe3,
+	0x74, 0x87, 0x83, 0x9b, 0x1f, 0xd2, 0x52, 0xa3, 0xe9, 0xfb, 0x82, 0x60, 0xcb, 0x5e, 0xc9, 0x5e,
+	0x5b, 0xc9, 0x8e, 0x9e, 0x42, 0xc7, 0xb8, 0xd6, 0xea, 0xa9, 0xbd, 0xe0, 0xc9, 0xa4, 0x34, 0xa1,
+	0x27, 0x60, 0xe0, 0x6c, 0xb5, 0xac, 0x60, 0xc1, 0x93, 0x63, 0x67, 0xa9, 0x72, 0xac, 0x55, 0x97,
+	0x09, 0x7a, 0x5d, 0x9a, 0xd0, 0x23, 0x00, 0xbb, 0xcc, 0xd5, 0x22, 0x6b, 0x99, 0x45, 0xac, 0xc1,
+	0x5c, 0x32, 0x55, 0xc4, 0x35, 0x29, 0x5b, 0x68, 0x0d, 0x7c, 0x69, 0xb8, 0xa6, 0x1c, 0x7f, 0x13,
+	0xe5, 0xb4, 0x36, 0x50, 0x0e, 0xfc, 0x2f, 0xe5, 0x3c, 0x07, 0xbf, 0x6a, 0xbc, 0xb6, 0x24, 0xdb,
+	0xc3, 0xfd, 0x6b, 0x91, 0x27, 0x25, 0x01, 0x5f, 0x50, 0x57, 0x05, 0xd7, 0x59, 0x17, 0x5c, 0x00,
+	0x4d, 0xf9, 0xbb, 0xab, 0xb3, 0x1d, 0x57, 0x67, 0x25, 0x5c, 0x95, 0x62, 0xf7, 0x36, 0x29, 0xee,
+	0xae, 0x4a, 0xb1, 0x61, 0x54, 0x82, 0xda, 0xd0, 0xfc, 0x65, 0xfc, 0xfd, 0xf8, 0xa7, 0x5f, 0xc7,
+	0xbd, 0x0f, 0x0c, 0x98, 0x4c, 0x47, 0x78, 0x7a, 0x7a, 0xd2, 0xf3, 0x50, 0x07, 0xfc, 0x97, 0xaf,
+	0xc6, 0xaf, 0x26, 0xdf, 0x9d, 0x9e, 0xf4, 0x6a, 0xe1, 0x2e, 0xec, 0x60, 0xb2, 0xe4, 0x71, 0x56,
+	0x4d, 0x85, 0x1e, 0x74, 0x2b, 0x83, 0x9b, 0x09, 0xc3, 0x7f, 0xea, 0xd0, 0x3c, 0xe6, 0x4c, 0x09,
+	0xbe, 0x44, 0x13, 0xf0, 0xab, 0x99, 0x81, 0xc2, 0x1b, 0xa4, 0xba, 0x36, 0x63, 0xfa, 0x1f, 0xdf,
+	0xc9, 0x29, 0x87, 0xce, 0x31, 0xc0, 0x54, 0xd0, 0xf9, 0x9c, 0x08, 0x33, 0x2e, 0x1e, 0xdd, 0x32,
+	0x74, 0xca, 0x8c, 0xb7, 0xcc, 0x24, 0x34, 0x02, 0xff, 0xb5, 0xe9, 0x8e, 0x1b, 0xa4, 0x78, 0x01,
+	0x2d, 0x4c, 0xa4, 0xce, 0x37, 0xc9, 0xf1, 0x33, 0xc0, 0x65, 0x2b, 0x40, 0x9f, 0xdc, 0xc0, 0xba,
+	0xd6, 0x29, 0xfa, 0x07, 0x77, 0xd4, 0xfc, 0x67, 0x1e, 0xfa, 0x11, 0xb6, 0xdd, 0x8b, 0xa0, 0x1b,
+	0x9b, 0xc3, 0xd5, 0xd7, 0xeb, 0x3f, 0xbd, 0x83, 0xe1, 0x6e, 0xfb, 0xc5, 0xc1, 0x6f, 0xfb, 0x57,
+	0x38, 0x47, 0x2b, 0x3f, 0x43, 0x92, 0x6d, 0x2b, 0xe3, 0xcf, 0xff, 0x1b, 0x00, 0xfc, 0xb9, 0x30,
+	0x04, 0x9e, 0x08, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// ControlClient is the client API for Control service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type ControlClient interface {
+	// ListJobs lists the jobs of the current crontab.
+	ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error)
+	// TriggerJob runs a job now.
+	TriggerJob(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*Job, error)
+	// PauseJob stops scheduling a job, until ResumeJob is called.
+	PauseJob(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*Job, error)
+	ResumeJob(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*Job, error)
+	// StreamRuns streams events as jobs start and finish, until the client
+	// goes away. Events are dropped for clients that fall behind.
+	StreamRuns(ctx context.Context, in *StreamRunsRequest, opts ...grpc.CallOption) (Control_StreamRunsClient, error)
+	// Reload reloads the crontab.
+	Reload(ctx context.Context, in *ReloadRequest, opts ...grpc.CallOption) (*ReloadResponse, error)
+}
+
+type controlClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewControlClient(cc *grpc.ClientConn) ControlClient {
+	return &controlClient{cc}
+}
+
+func (c *controlClient) ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error) {
+	out := new(ListJobsResponse)
+	err := c.cc.Invoke(ctx, "/supercronic.admin.Control/ListJobs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) TriggerJob(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*Job, error) {
+	out := new(Job)
+	err := c.cc.Invoke(ctx, "/supercronic.admin.Control/TriggerJob", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) PauseJob(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*Job, error) {
+	out := new(Job)
+	err := c.cc.Invoke(ctx, "/supercronic.admin.Control/PauseJob", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) ResumeJob(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*Job, error) {
+	out := new(Job)
+	err := c.cc.Invoke(ctx, "/supercronic.admin.Control/ResumeJob", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) StreamRuns(ctx context.Context, in *StreamRunsRequest, opts ...grpc.CallOption) (Control_StreamRunsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Control_serviceDesc.Streams[0], "/supercronic.admin.Control/StreamRuns", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &controlStreamRunsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Control_StreamRunsClient interface {
+	Recv() (*RunEvent, error)
+	grpc.ClientStream
+}
+
+type controlStreamRunsClient struct {
+	grpc.ClientStream
+}
+
+func (x *controlStreamRunsClient) Recv() (*RunEvent, error) {
+	m := new(RunEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *controlClient) Reload(ctx context.Context, in *ReloadRequest, opts ...grpc.CallOption) (*ReloadResponse, error) {
+	out := new(ReloadResponse)
+	err := c.cc.Invoke(ctx, "/supercronic.admin.Control/Reload", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ControlServer is the server API for Control service.
+type ControlServer interface {
+	// ListJobs lists the jobs of the current crontab.
+	ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error)
+	// TriggerJob runs a job now.
+	TriggerJob(context.Context, *JobRequest) (*Job, error)
+	// PauseJob stops scheduling a job, until ResumeJob is called.
+	PauseJob(context.Context, *JobRequest) (*Job, error)
+	ResumeJob(context.Context, *JobRequest) (*Job, error)
+	// StreamRuns streams events as jobs start and finish, until the client
+	// goes away. Events are dropped for clients that fall behind.
+	StreamRuns(*StreamRunsRequest, Control_StreamRunsServer) error
+	// Reload reloads the crontab.
+	Reload(context.Context, *ReloadRequest) (*ReloadResponse, error)
+}
+
+func RegisterControlServer(s *grpc.Server, srv ControlServer) {
+	s.RegisterService(&_Control_serviceDesc, srv)
+}
+
+func _Control_ListJobs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListJobsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).ListJobs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/supercronic.admin.Control/ListJobs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).ListJobs(ctx, req.(*ListJobsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_TriggerJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).TriggerJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/supercronic.admin.Control/TriggerJob",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).TriggerJob(ctx, req.(*JobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_PauseJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).PauseJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/supercronic.admin.Control/PauseJob",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).PauseJob(ctx, req.(*JobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_ResumeJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).ResumeJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/supercronic.admin.Control/ResumeJob",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).ResumeJob(ctx, req.(*JobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_StreamRuns_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamRunsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ControlServer).StreamRuns(m, &controlStreamRunsServer{stream})
+}
+
+type Control_StreamRunsServer interface {
+	Send(*RunEvent) error
+	grpc.ServerStream
+}
+
+type controlStreamRunsServer struct {
+	grpc.ServerStream
+}
+
+func (x *controlStreamRunsServer) Send(m *RunEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Control_Reload_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReloadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).Reload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/supercronic.admin.Control/Reload",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).Reload(ctx, req.(*ReloadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Control_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "supercronic.admin.Control",
+	HandlerType: (*ControlServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListJobs",
+			Handler:    _Control_ListJobs_Handler,
+		},
+		{
+			MethodName: "TriggerJob",
+			Handler:    _Control_TriggerJob_Handler,
+		},
+		{
+			MethodName: "PauseJob",
+			Handler:    _Control_PauseJob_Handler,
+		},
+		{
+			MethodName: "ResumeJob",
+			Handler:    _Control_ResumeJob_Handler,
+		},
+		{
+			MethodName: "Reload",
+			Handler:    _Control_Reload_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamRuns",
+			Handler:       _Control_StreamRuns_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "admin/adminpb/admin.proto",
+}
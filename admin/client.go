@@ -0,0 +1,193 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"supercronic/cron"
+)
+
+// The functions below talk to the admin API of a running supercronic at
+// addr: a TCP address (e.g. 127.0.0.1:9746), a URL, or unix:PATH for its
+// control socket. token is the server's token, if it requires one (see
+// Server.SetToken).
+
+// Trigger runs a job, and copies the job's output to stdout and stderr while
+// it runs. job is the name or ID of the job. It returns the event that
+// describes how the run went.
+func Trigger(addr string, token string, job string, stdout io.Writer, stderr io.Writer) (*RunEvent, error) {
+	resp, decoder, err := request(addr, token, http.MethodPost, "/jobs/"+url.PathEscape(job)+"/trigger?follow=1")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	event, err := copyRun(decoder, stdout, stderr)
+	if err == io.EOF {
+		return nil, fmt.Errorf("connection closed before the run finished")
+	}
+	return event, err
+}
+
+// Tail copies the output of the latest run of job (or of the next one, if
+// it never ran) to stdout and stderr, until it finishes. If follow is set,
+// it keeps copying the output of the runs that follow, until they can't be
+// followed anymore.
+func Tail(addr string, job string, follow bool, stdout io.Writer, stderr io.Writer) error {
+	resp, decoder, err := request(addr, "", http.MethodGet, "/jobs/"+url.PathEscape(job)+"/output?follow=1")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	for {
+		if _, err := copyRun(decoder, stdout, stderr); err != nil {
+			if err == io.EOF {
+				if follow {
+					// supercronic went away, e.g. it is shutting down.
+					return nil
+				}
+				return fmt.Errorf("connection closed before the run finished")
+			}
+			return err
+		}
+
+		if !follow {
+			return nil
+		}
+	}
+}
+
+// copyRun copies the output events of a run to stdout and stderr, and
+// returns the event that describes how the run went.
+func copyRun(decoder *json.Decoder, stdout io.Writer, stderr io.Writer) (*RunEvent, error) {
+	for {
+		var event RunEvent
+		if err := decoder.Decode(&event); err != nil {
+			return nil, err
+		}
+
+		if event.Done {
+			return &event, nil
+		}
+
+		w := stdout
+		if event.Channel == "stderr" {
+			w = stderr
+		}
+
+		if _, err := fmt.Fprintln(w, event.Text); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Jobs lists the jobs.
+func Jobs(addr string) ([]cron.JobStatus, error) {
+	var jobs []cron.JobStatus
+	if err := call(addr, "", http.MethodGet, "/jobs", &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// JobOutput returns the last lines (at most) of output of the latest run of
+// job.
+func JobOutput(addr string, job string, lines int) (*OutputResponse, error) {
+	var output OutputResponse
+	if err := call(addr, "", http.MethodGet, "/jobs/"+url.PathEscape(job)+"/output?lines="+strconv.Itoa(lines), &output); err != nil {
+		return nil, err
+	}
+	return &output, nil
+}
+
+// Control applies action (e.g. pause) to job, and returns the job's status
+// once it did.
+func Control(addr string, token string, job string, action string) (*cron.JobStatus, error) {
+	var status cron.JobStatus
+	if err := call(addr, token, http.MethodPost, "/jobs/"+url.PathEscape(job)+"/"+url.PathEscape(action), &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Reload has supercronic reload its crontab.
+func Reload(addr string, token string) error {
+	var body map[string]string
+	return call(addr, token, http.MethodPost, "/reload", &body)
+}
+
+// call makes a request, and decodes its response into v.
+func call(addr string, token string, method string, path string, v interface{}) error {
+	resp, decoder, err := request(addr, token, method, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decoder.Decode(v)
+}
+
+// request makes a request to the admin API at addr. Responses that aren't
+// successful are returned as errors.
+func request(addr string, token string, method string, path string) (*http.Response, *json.Decoder, error) {
+	client := http.DefaultClient
+	base := addr
+
+	if strings.HasPrefix(addr, "unix:") {
+		socket := strings.TrimPrefix(addr, "unix:")
+		client = &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		}
+		base = "http://unix"
+	} else if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+
+	target := strings.TrimSuffix(base, "/") + path
+
+	req, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+
+		var body struct {
+			Error string `json:"error"`
+		}
+
+		if err := decoder.Decode(&body); err != nil || body.Error == "" {
+			return nil, nil, fmt.Errorf("%s returned %s", target, resp.Status)
+		}
+
+		return nil, nil, fmt.Errorf("%s", body.Error)
+	}
+
+	return resp, decoder, nil
+}
@@ -0,0 +1,162 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+func TestTrigger(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	logger.Logger.Out = ioutil.Discard
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	defer wg.Wait()
+	defer cancel()
+
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: hourlyExpression{},
+			Schedule:   "@hourly",
+			Command:    "echo hello; echo oops >&2; exit 3",
+		},
+		Name: "backup",
+	}
+
+	cronCtx := &crontab.Context{Shell: "/bin/sh", Environ: map[string]string{}}
+
+	registry := cron.NewRegistry()
+	registry.Add(cron.StartJob(&wg, cronCtx, job, ctx, logger, cron.Options{}))
+
+	server := httptest.NewServer(NewServer(registry, nil, logger))
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+
+	result, err := Trigger(server.URL, "", "backup", &stdout, &stderr)
+	if assert.Nil(t, err) {
+		assert.Equal(t, 3, result.ExitCode)
+		assert.Contains(t, result.Error, "exit status 3")
+	}
+	assert.Equal(t, "hello\n", stdout.String())
+	assert.Equal(t, "oops\n", stderr.String())
+
+	_, err = Trigger(server.URL, "", "nope", &stdout, &stderr)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "no such job: nope", err.Error())
+	}
+}
+
+func TestJobsAndJobOutput(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	logger.Logger.Out = ioutil.Discard
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	defer wg.Wait()
+	defer cancel()
+
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: hourlyExpression{},
+			Schedule:   "@hourly",
+			Command:    "echo one; echo two; echo three",
+		},
+		Name: "backup",
+	}
+
+	cronCtx := &crontab.Context{Shell: "/bin/sh", Environ: map[string]string{}}
+
+	registry := cron.NewRegistry()
+	registry.Add(cron.StartJob(&wg, cronCtx, job, ctx, logger, cron.Options{}))
+
+	server := httptest.NewServer(NewServer(registry, nil, logger))
+	defer server.Close()
+
+	output, err := JobOutput(server.URL, "backup", 10)
+	if assert.Nil(t, err) {
+		assert.Nil(t, output.StartedAt)
+		assert.Equal(t, []RunEvent{}, output.Lines)
+	}
+
+	var stdout, stderr bytes.Buffer
+	_, err = Trigger(server.URL, "", "backup", &stdout, &stderr)
+	assert.Nil(t, err)
+
+	jobs, err := Jobs(server.URL)
+	if assert.Nil(t, err) && assert.Len(t, jobs, 1) {
+		assert.Equal(t, "backup", jobs[0].Name)
+		if assert.NotNil(t, jobs[0].LastRun) {
+			assert.True(t, jobs[0].LastRun.Succeeded)
+		}
+	}
+
+	output, err = JobOutput(server.URL, "0", 2)
+	if assert.Nil(t, err) {
+		assert.NotNil(t, output.StartedAt)
+		assert.False(t, output.Running)
+		assert.Equal(t, []RunEvent{{Channel: "stdout", Text: "two"}, {Channel: "stdout", Text: "three"}}, output.Lines)
+	}
+
+	_, err = JobOutput(server.URL, "nope", 2)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "no such job: nope", err.Error())
+	}
+}
+
+func TestTailFollowsRuns(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	logger.Logger.Out = ioutil.Discard
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	defer wg.Wait()
+	defer cancel()
+
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: hourlyExpression{},
+			Schedule:   "@hourly",
+			Command:    "echo $SUPERCRONIC_ITERATION",
+		},
+	}
+
+	cronCtx := &crontab.Context{Shell: "/bin/sh", Environ: map[string]string{}}
+
+	registry := cron.NewRegistry()
+	registry.Add(cron.StartJob(&wg, cronCtx, job, ctx, logger, cron.Options{}))
+
+	server := httptest.NewServer(NewServer(registry, nil, logger))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/jobs/0/output?follow=1")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+
+	for i := 0; i < 2; i++ {
+		registry.Job(0).Trigger()
+
+		var stdout, stderr bytes.Buffer
+		event, err := copyRun(decoder, &stdout, &stderr)
+		if assert.Nil(t, err) {
+			assert.True(t, event.Done)
+		}
+		assert.Equal(t, fmt.Sprintf("%d\n", i), stdout.String())
+	}
+}
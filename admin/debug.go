@@ -0,0 +1,67 @@
+package admin
+
+import (
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	// Leaks (e.g. of output readers) show up as a steadily growing count.
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+}
+
+// DebugHandler serves the profiles of net/http/pprof under /debug/pprof/, and
+// the variables of expvar (memory statistics, the number of goroutines) at
+// /debug/vars.
+func DebugHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	return mux
+}
+
+// EnableDebug serves the endpoints of DebugHandler along with the API. Unlike
+// other GET requests, they require the token (if set): profiles show
+// supercronic's command line and memory, which may hold secrets.
+func (s *Server) EnableDebug() {
+	debug := DebugHandler()
+
+	s.mux.HandleFunc("/debug/", func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorize(w, r) {
+			return
+		}
+		debug.ServeHTTP(w, r)
+	})
+}
+
+// ListenAndServeDebug listens on addr, and serves the endpoints of
+// DebugHandler in the background. Errors binding to addr are returned
+// synchronously.
+func ListenAndServeDebug(addr string, logger *logrus.Entry) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Infof("debug endpoints listening on %s", listener.Addr())
+
+	go func() {
+		err := http.Serve(listener, DebugHandler())
+		logger.Debugf("debug endpoints stopped: %v", err)
+	}()
+
+	return listener, nil
+}
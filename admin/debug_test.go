@@ -0,0 +1,71 @@
+package admin
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"supercronic/cron"
+)
+
+func TestDebugHandler(t *testing.T) {
+	server := httptest.NewServer(DebugHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/debug/vars")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var vars map[string]interface{}
+	defer resp.Body.Close()
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&vars))
+	assert.Contains(t, vars, "memstats")
+	assert.Contains(t, vars, "goroutines")
+
+	resp, err = http.Get(server.URL + "/debug/pprof/goroutine?debug=1")
+	if assert.Nil(t, err) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, string(body), "goroutine profile")
+	}
+}
+
+func TestEnableDebug(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	logger.Logger.Out = ioutil.Discard
+
+	server := NewServer(cron.NewRegistry(), nil, logger)
+
+	get := func(authorization string) int {
+		req := httptest.NewRequest("GET", "/debug/vars", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code == http.StatusOK {
+			assert.True(t, json.Valid(w.Body.Bytes()))
+		}
+		return w.Code
+	}
+
+	// The endpoints are disabled by default.
+	assert.NotEqual(t, http.StatusOK, get(""))
+
+	server.EnableDebug()
+	assert.Equal(t, http.StatusOK, get(""))
+
+	server.SetToken("secret")
+	assert.Equal(t, http.StatusUnauthorized, get(""))
+	assert.Equal(t, http.StatusOK, get("Bearer secret"))
+}
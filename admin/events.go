@@ -0,0 +1,154 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"supercronic/cron"
+)
+
+// EVENTS_BUFFER_SIZE is how many events a subscriber may fall behind by.
+// Events that don't fit are dropped for that subscriber, so that a slow
+// client can't hold up jobs.
+var EVENTS_BUFFER_SIZE = 256
+
+// JobEvent is what the event stream reports about each run of a job: that it
+// started, and then that it finished (along with how it went).
+type JobEvent struct {
+	Event       string    `json:"event"`
+	Name        string    `json:"job_name,omitempty"`
+	Schedule    string    `json:"job_schedule"`
+	Command     string    `json:"job_command"`
+	Position    int       `json:"job_position"`
+	Source      string    `json:"job_source,omitempty"`
+	Iteration   uint64    `json:"iteration"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+	StartedAt   time.Time `json:"started_at"`
+
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Duration   *float64   `json:"duration_seconds,omitempty"`
+	Succeeded  *bool      `json:"succeeded,omitempty"`
+	Skipped    bool       `json:"skipped,omitempty"`
+	ExitCode   *int       `json:"exit_code,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Events is a hook that broadcasts runs as JobEvents to its subscribers,
+// i.e. clients of the server's event stream (see Server.SetEvents).
+type Events struct {
+	mu          sync.Mutex
+	subscribers map[chan *JobEvent]struct{}
+}
+
+func NewEvents() *Events {
+	return &Events{subscribers: make(map[chan *JobEvent]struct{})}
+}
+
+// Subscribe returns a channel that receives the events from now on, and a
+// function that unsubscribes from them.
+func (ev *Events) Subscribe() (<-chan *JobEvent, func()) {
+	ch := make(chan *JobEvent, EVENTS_BUFFER_SIZE)
+
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	ev.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		ev.mu.Lock()
+		defer ev.mu.Unlock()
+		delete(ev.subscribers, ch)
+	}
+}
+
+func (ev *Events) JobStarted(e *cron.Execution) {
+	ev.publish(newJobEvent("started", e))
+}
+
+func (ev *Events) JobFinished(e *cron.Execution) {
+	event := newJobEvent("finished", e)
+
+	finishedAt := e.FinishedAt
+	duration := e.Duration().Seconds()
+	succeeded := e.Err == nil
+	exitCode := e.ExitCode
+
+	event.FinishedAt = &finishedAt
+	event.Duration = &duration
+	event.Succeeded = &succeeded
+	event.Skipped = e.Skipped
+	event.ExitCode = &exitCode
+	if e.Err != nil {
+		event.Error = e.Err.Error()
+	}
+
+	ev.publish(event)
+}
+
+func newJobEvent(name string, e *cron.Execution) *JobEvent {
+	return &JobEvent{
+		Event:       name,
+		Name:        e.Job.Name,
+		Schedule:    e.Job.Schedule,
+		Command:     e.Job.Command,
+		Position:    e.Job.Position,
+		Source:      e.Job.Source,
+		Iteration:   e.Iteration,
+		ScheduledAt: e.ScheduledAt,
+		StartedAt:   e.StartedAt,
+	}
+}
+
+func (ev *Events) publish(event *JobEvent) {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+
+	for ch := range ev.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// handleEvents streams events, one per line, until the client goes away.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if s.events == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("events are not enabled"))
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	events, unsubscribe := s.events.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	encoder := json.NewEncoder(w)
+
+	for {
+		select {
+		case event := <-events:
+			if err := encoder.Encode(event); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package admin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+func TestEvents(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	logger.Logger.Out = ioutil.Discard
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	defer wg.Wait()
+	defer cancel()
+
+	events := NewEvents()
+
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: hourlyExpression{},
+			Schedule:   "@hourly",
+			Command:    "exit 3",
+		},
+		Name: "backup",
+	}
+
+	cronCtx := &crontab.Context{Shell: "/bin/sh", Environ: map[string]string{}}
+
+	registry := cron.NewRegistry()
+	registry.Add(cron.StartJob(&wg, cronCtx, job, ctx, logger, cron.Options{Hooks: []cron.Hook{events}}))
+
+	server := NewServer(registry, nil, logger)
+	server.SetEvents(events)
+
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	resp, err := http.Get(httpServer.URL + "/events")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+	registry.Job(0).Trigger()
+
+	scanner := bufio.NewScanner(resp.Body)
+	var started, finished JobEvent
+
+	if assert.True(t, scanner.Scan()) {
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &started))
+	}
+	if assert.True(t, scanner.Scan()) {
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &finished))
+	}
+
+	assert.Equal(t, "started", started.Event)
+	assert.Equal(t, "backup", started.Name)
+	assert.Nil(t, started.Succeeded)
+
+	assert.Equal(t, "finished", finished.Event)
+	assert.Equal(t, "backup", finished.Name)
+	if assert.NotNil(t, finished.Succeeded) {
+		assert.False(t, *finished.Succeeded)
+	}
+	if assert.NotNil(t, finished.ExitCode) {
+		assert.Equal(t, 3, *finished.ExitCode)
+	}
+	assert.Contains(t, finished.Error, "exit status 3")
+}
+
+func TestEventsDropWhenSubscriberFallsBehind(t *testing.T) {
+	old := EVENTS_BUFFER_SIZE
+	EVENTS_BUFFER_SIZE = 1
+	defer func() { EVENTS_BUFFER_SIZE = old }()
+
+	events := NewEvents()
+	ch, unsubscribe := events.Subscribe()
+
+	e := &cron.Execution{Job: &crontab.Job{}}
+	events.JobStarted(e)
+	events.JobStarted(e)
+
+	assert.Len(t, ch, 1)
+
+	unsubscribe()
+	<-ch
+	events.JobStarted(e)
+	assert.Len(t, ch, 0)
+}
+
+func TestReload(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	logger.Logger.Out = ioutil.Discard
+
+	server := NewServer(cron.NewRegistry(), nil, logger)
+
+	post := func(path string) int {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusNotFound, post("/reload"))
+	assert.Equal(t, http.StatusNotFound, post("/events"))
+
+	reloads := 0
+	server.SetReloader(func() { reloads++ })
+
+	assert.Equal(t, http.StatusAccepted, post("/reload"))
+	assert.Equal(t, 1, reloads)
+}
@@ -0,0 +1,229 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"supercronic/admin/adminpb"
+	"supercronic/cron"
+)
+
+// controlService implements the gRPC control API (see adminpb.ControlServer)
+// on top of the same registry and hooks as the HTTP API.
+type controlService struct {
+	s *Server
+}
+
+func newGRPCServer(s *Server) *grpc.Server {
+	server := grpc.NewServer()
+	adminpb.RegisterControlServer(server, &controlService{s: s})
+	return server
+}
+
+// authorize reports an error unless the call may control jobs. Unlike with
+// the HTTP API, calls don't need to be checked for cross-site requests
+// without a token: browsers can't make gRPC calls to other origins.
+func (c *controlService) authorize(ctx context.Context) error {
+	if ctx.Value(trustedKey{}) != nil || c.s.token == "" {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, header := range md.Get("authorization") {
+		if strings.HasPrefix(header, "Bearer ") && subtle.ConstantTimeCompare([]byte(header[len("Bearer "):]), []byte(c.s.token)) == 1 {
+			return nil
+		}
+	}
+
+	return status.Error(codes.Unauthenticated, "missing or invalid token")
+}
+
+func (c *controlService) job(ref string) (*cron.JobState, error) {
+	var job *cron.JobState
+	if id, err := strconv.Atoi(ref); err == nil {
+		job = c.s.registry.Job(id)
+	} else {
+		job = c.s.registry.JobByName(ref)
+	}
+
+	if job == nil {
+		return nil, status.Errorf(codes.NotFound, "no such job: %s", ref)
+	}
+
+	return job, nil
+}
+
+func (c *controlService) ListJobs(ctx context.Context, req *adminpb.ListJobsRequest) (*adminpb.ListJobsResponse, error) {
+	jobs := c.s.registry.Jobs()
+	response := &adminpb.ListJobsResponse{Jobs: make([]*adminpb.Job, 0, len(jobs))}
+
+	for _, job := range jobs {
+		response.Jobs = append(response.Jobs, jobMessage(job.Status()))
+	}
+
+	return response, nil
+}
+
+func (c *controlService) TriggerJob(ctx context.Context, req *adminpb.JobRequest) (*adminpb.Job, error) {
+	return c.control(ctx, req, "trigger", (*cron.JobState).Trigger)
+}
+
+func (c *controlService) PauseJob(ctx context.Context, req *adminpb.JobRequest) (*adminpb.Job, error) {
+	return c.control(ctx, req, "pause", (*cron.JobState).Pause)
+}
+
+func (c *controlService) ResumeJob(ctx context.Context, req *adminpb.JobRequest) (*adminpb.Job, error) {
+	return c.control(ctx, req, "resume", (*cron.JobState).Resume)
+}
+
+func (c *controlService) control(ctx context.Context, req *adminpb.JobRequest, name string, action func(*cron.JobState)) (*adminpb.Job, error) {
+	if err := c.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	job, err := c.job(req.Job)
+	if err != nil {
+		return nil, err
+	}
+
+	c.s.logger.WithFields(logrus.Fields{
+		"job.schedule": job.Job.Schedule,
+		"job.command":  job.Job.Command,
+		"job.position": job.Job.Position,
+	}).Infof("control API: %s", name)
+
+	action(job)
+
+	return jobMessage(job.Status()), nil
+}
+
+func (c *controlService) StreamRuns(req *adminpb.StreamRunsRequest, stream adminpb.Control_StreamRunsServer) error {
+	if c.s.events == nil {
+		return status.Error(codes.Unimplemented, "events are not enabled")
+	}
+
+	events, unsubscribe := c.s.events.Subscribe()
+	defer unsubscribe()
+
+	// Let the client know it's subscribed, so that it doesn't miss runs
+	// that start right after the call.
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case event := <-events:
+			if req.JobName != "" && event.Name != req.JobName {
+				continue
+			}
+			if err := stream.Send(runEventMessage(event)); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+func (c *controlService) Reload(ctx context.Context, req *adminpb.ReloadRequest) (*adminpb.ReloadResponse, error) {
+	if c.s.reload == nil {
+		return nil, status.Error(codes.Unimplemented, "reloading is not enabled")
+	}
+
+	if err := c.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	c.s.logger.Info("control API: reload")
+	c.s.reload()
+
+	return &adminpb.ReloadResponse{}, nil
+}
+
+func jobMessage(state cron.JobStatus) *adminpb.Job {
+	message := &adminpb.Job{
+		Id:                  int32(state.ID),
+		Name:                state.Name,
+		Schedule:            state.Schedule,
+		Command:             state.Command,
+		Position:            int32(state.Position),
+		Source:              state.Source,
+		NextRun:             timestampMessage(state.NextRun),
+		Running:             int32(state.Running),
+		Waiting:             int32(state.Waiting),
+		RunningSince:        timestampMessage(state.RunningSince),
+		Paused:              state.Paused,
+		ConsecutiveFailures: int32(state.ConsecutiveFailures),
+		Tripped:             state.Tripped,
+	}
+
+	if run := state.LastRun; run != nil {
+		message.LastRun = &adminpb.Run{
+			ScheduledAt: timestampMessage(&run.ScheduledAt),
+			StartedAt:   timestampMessage(&run.StartedAt),
+			FinishedAt:  timestampMessage(&run.FinishedAt),
+			Succeeded:   run.Succeeded,
+			ExitCode:    int32(run.ExitCode),
+			Error:       run.Error,
+		}
+	}
+
+	return message
+}
+
+func runEventMessage(event *JobEvent) *adminpb.RunEvent {
+	message := &adminpb.RunEvent{
+		Type:        adminpb.RunEvent_STARTED,
+		JobName:     event.Name,
+		JobSchedule: event.Schedule,
+		JobCommand:  event.Command,
+		JobPosition: int32(event.Position),
+		JobSource:   event.Source,
+		Iteration:   event.Iteration,
+		ScheduledAt: timestampMessage(&event.ScheduledAt),
+		StartedAt:   timestampMessage(&event.StartedAt),
+		Skipped:     event.Skipped,
+		Error:       event.Error,
+	}
+
+	if event.FinishedAt != nil {
+		message.Type = adminpb.RunEvent_FINISHED
+		message.FinishedAt = timestampMessage(event.FinishedAt)
+	}
+	if event.Duration != nil {
+		message.Duration = ptypes.DurationProto(time.Duration(*event.Duration * float64(time.Second)))
+	}
+	if event.Succeeded != nil {
+		message.Succeeded = *event.Succeeded
+	}
+	if event.ExitCode != nil {
+		message.ExitCode = int32(*event.ExitCode)
+	}
+
+	return message
+}
+
+// timestampMessage converts t, which is unset if nil or zero.
+func timestampMessage(t *time.Time) *timestamp.Timestamp {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+
+	ts, err := ptypes.TimestampProto(*t)
+	if err != nil {
+		return nil
+	}
+
+	return ts
+}
@@ -0,0 +1,255 @@
+package admin
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"supercronic/admin/adminpb"
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+// newTestControlClient serves server, and connects to its control API.
+func newTestControlClient(t *testing.T, server *Server) (adminpb.ControlClient, string, func()) {
+	listener, err := server.ListenAndServe("127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	if !assert.Nil(t, err) {
+		listener.Close()
+		t.FailNow()
+	}
+
+	return adminpb.NewControlClient(conn), listener.Addr().String(), func() {
+		conn.Close()
+		listener.Close()
+	}
+}
+
+func newTestRegistry(command string, hooks ...cron.Hook) (*cron.Registry, func()) {
+	logger := logrus.NewEntry(logrus.New())
+	logger.Logger.Out = ioutil.Discard
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: hourlyExpression{},
+			Schedule:   "@hourly",
+			Command:    command,
+		},
+		Name: "backup",
+	}
+
+	cronCtx := &crontab.Context{Shell: "/bin/sh", Environ: map[string]string{}}
+
+	registry := cron.NewRegistry()
+	registry.Add(cron.StartJob(&wg, cronCtx, job, ctx, logger, cron.Options{Hooks: hooks}))
+
+	return registry, func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func TestGRPCControl(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	logger.Logger.Out = ioutil.Discard
+
+	registry, stop := newTestRegistry("true")
+	defer stop()
+
+	client, addr, closeClient := newTestControlClient(t, NewServer(registry, nil, logger))
+	defer closeClient()
+
+	ctx := context.Background()
+
+	jobs, err := client.ListJobs(ctx, &adminpb.ListJobsRequest{})
+	if assert.Nil(t, err) && assert.Len(t, jobs.Jobs, 1) {
+		assert.Equal(t, "backup", jobs.Jobs[0].Name)
+		assert.Equal(t, "true", jobs.Jobs[0].Command)
+		assert.NotNil(t, jobs.Jobs[0].NextRun)
+	}
+
+	job, err := client.PauseJob(ctx, &adminpb.JobRequest{Job: "backup"})
+	if assert.Nil(t, err) {
+		assert.True(t, job.Paused)
+	}
+
+	job, err = client.ResumeJob(ctx, &adminpb.JobRequest{Job: "0"})
+	if assert.Nil(t, err) {
+		assert.False(t, job.Paused)
+	}
+
+	_, err = client.TriggerJob(ctx, &adminpb.JobRequest{Job: "backup"})
+	assert.Nil(t, err)
+
+	_, err = client.TriggerJob(ctx, &adminpb.JobRequest{Job: "nope"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// The HTTP API is still served on the same address.
+	resp, err := http.Get("http://" + addr + "/jobs")
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestGRPCToken(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	logger.Logger.Out = ioutil.Discard
+
+	registry, stop := newTestRegistry("true")
+	defer stop()
+
+	server := NewServer(registry, nil, logger)
+	server.SetToken("secret")
+
+	client, _, closeClient := newTestControlClient(t, server)
+	defer closeClient()
+
+	ctx := context.Background()
+
+	_, err := client.ListJobs(ctx, &adminpb.ListJobsRequest{})
+	assert.Nil(t, err)
+
+	_, err = client.PauseJob(ctx, &adminpb.JobRequest{Job: "backup"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.PauseJob(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer wrong"), &adminpb.JobRequest{Job: "backup"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	job, err := client.PauseJob(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret"), &adminpb.JobRequest{Job: "backup"})
+	if assert.Nil(t, err) {
+		assert.True(t, job.Paused)
+	}
+}
+
+func TestGRPCControlSocketNeedsNoToken(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	logger.Logger.Out = ioutil.Discard
+
+	dir, err := ioutil.TempDir("", "supercronic-admin")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	registry, stop := newTestRegistry("true")
+	defer stop()
+
+	server := NewServer(registry, nil, logger)
+	server.SetToken("secret")
+
+	path := filepath.Join(dir, "supercronic.sock")
+	listener, err := server.ListenAndServeUnix(path)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer listener.Close()
+
+	conn, err := grpc.Dial(path, grpc.WithInsecure(), grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+		return net.DialTimeout("unix", addr, timeout)
+	}))
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	job, err := adminpb.NewControlClient(conn).PauseJob(context.Background(), &adminpb.JobRequest{Job: "backup"})
+	if assert.Nil(t, err) {
+		assert.True(t, job.Paused)
+	}
+}
+
+func TestGRPCStreamRuns(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	logger.Logger.Out = ioutil.Discard
+
+	events := NewEvents()
+
+	registry, stop := newTestRegistry("exit 3", events)
+	defer stop()
+
+	server := NewServer(registry, nil, logger)
+	server.SetEvents(events)
+
+	client, _, closeClient := newTestControlClient(t, server)
+	defer closeClient()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.StreamRuns(ctx, &adminpb.StreamRunsRequest{JobName: "backup"})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// Runs are only streamed once subscribed.
+	_, err = stream.Header()
+	assert.Nil(t, err)
+
+	registry.Job(0).Trigger()
+
+	started, err := stream.Recv()
+	if assert.Nil(t, err) {
+		assert.Equal(t, adminpb.RunEvent_STARTED, started.Type)
+		assert.Equal(t, "backup", started.JobName)
+		assert.Equal(t, "exit 3", started.JobCommand)
+		assert.NotNil(t, started.StartedAt)
+		assert.Nil(t, started.FinishedAt)
+	}
+
+	finished, err := stream.Recv()
+	if assert.Nil(t, err) {
+		assert.Equal(t, adminpb.RunEvent_FINISHED, finished.Type)
+		assert.False(t, finished.Succeeded)
+		assert.Equal(t, int32(3), finished.ExitCode)
+		assert.NotNil(t, finished.FinishedAt)
+		assert.NotNil(t, finished.Duration)
+	}
+}
+
+func TestGRPCDisabled(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	logger.Logger.Out = ioutil.Discard
+
+	server := NewServer(cron.NewRegistry(), nil, logger)
+
+	client, _, closeClient := newTestControlClient(t, server)
+	defer closeClient()
+
+	ctx := context.Background()
+
+	_, err := client.Reload(ctx, &adminpb.ReloadRequest{})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	stream, err := client.StreamRuns(ctx, &adminpb.StreamRunsRequest{})
+	if assert.Nil(t, err) {
+		_, err = stream.Recv()
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+	}
+
+	reloads := 0
+	server.SetReloader(func() { reloads++ })
+
+	_, err = client.Reload(ctx, &adminpb.ReloadRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, reloads)
+}
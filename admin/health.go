@@ -0,0 +1,92 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HEALTH_TIMEOUT is how long the scheduler has to respond before /healthz
+// reports it as wedged.
+var HEALTH_TIMEOUT = 500 * time.Millisecond
+
+// Health tracks whether supercronic is ready, i.e. whether its crontab was
+// parsed and its jobs scheduled. A nil Health ignores updates.
+type Health struct {
+	mu     sync.Mutex
+	ready  bool
+	reason string
+}
+
+func NewHealth() *Health {
+	return &Health{reason: "crontab not loaded yet"}
+}
+
+func (h *Health) SetReady() {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ready = true
+	h.reason = ""
+}
+
+func (h *Health) SetNotReady(reason string) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ready = false
+	h.reason = reason
+}
+
+// Ready returns whether supercronic is ready, and if not, why.
+func (h *Health) Ready() (bool, string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.ready, h.reason
+}
+
+// handleHealthz reports whether the scheduler is alive, i.e. whether it
+// responds to a status request for every job in time.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for _, job := range s.registry.Jobs() {
+			job.Status()
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	case <-time.After(HEALTH_TIMEOUT):
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("scheduler did not respond within %v", HEALTH_TIMEOUT))
+	}
+}
+
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	ready, reason := s.health.Ready()
+	if !ready {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("not ready: %s", reason))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
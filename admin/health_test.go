@@ -0,0 +1,68 @@
+package admin
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"supercronic/cron"
+)
+
+func TestHealthz(t *testing.T) {
+	server, _, stop := newTestServer(t, nil)
+	defer stop()
+
+	resp, err := http.Get(server.URL + "/healthz")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body map[string]string
+	decode(t, resp, &body)
+	assert.Equal(t, "ok", body["status"])
+}
+
+func TestReady(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	logger.Logger.Out = ioutil.Discard
+
+	s := NewServer(cron.NewRegistry(), nil, logger)
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	get := func() (int, map[string]string) {
+		resp, err := http.Get(server.URL + "/ready")
+		if !assert.Nil(t, err) {
+			t.FailNow()
+		}
+
+		var body map[string]string
+		decode(t, resp, &body)
+		return resp.StatusCode, body
+	}
+
+	status, body := get()
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "not ready: crontab not loaded yet", body["error"])
+
+	s.Health().SetReady()
+	status, body = get()
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ready", body["status"])
+
+	s.Health().SetNotReady("shutting down")
+	status, body = get()
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "not ready: shutting down", body["error"])
+}
+
+func TestNilHealthIgnoresUpdates(t *testing.T) {
+	var h *Health
+	h.SetReady()
+	h.SetNotReady("shutting down")
+}
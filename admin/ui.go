@@ -0,0 +1,242 @@
+package admin
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+)
+
+// handleDashboard serves a page that shows the jobs, the history of the
+// selected one, and the output of its latest run, all from the API. It
+// shows controls to trigger and pause jobs only when a token is set, and
+// asks for it when they're used.
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("not found: %s", r.URL.Path))
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	dashboardTemplate.Execute(w, struct {
+		Controls bool
+		History  bool
+	}{
+		Controls: s.token != "",
+		History:  s.store != nil,
+	})
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>supercronic</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 1.5em; }
+th, td { text-align: left; padding: 0.3em 0.6em; border-bottom: 1px solid #ddd; white-space: nowrap; }
+td.command { white-space: normal; font-family: monospace; }
+tr.job { cursor: pointer; }
+tr.job:hover, tr.selected { background: #eef3fb; }
+.ok { color: #1a7f37; }
+.failed { color: #cf222e; }
+.muted { color: #888; }
+pre { background: #f6f8fa; padding: 0.8em; overflow: auto; max-height: 30em; }
+pre .stderr { color: #cf222e; }
+button { margin-right: 0.3em; }
+</style>
+</head>
+<body>
+<h1>supercronic</h1>
+<p id="status" class="muted"></p>
+<table>
+<thead><tr><th>ID</th><th>Name</th><th>Schedule</th><th>Command</th><th>Next run</th><th>Last run</th><th>State</th>{{if .Controls}}<th></th>{{end}}</tr></thead>
+<tbody id="jobs"></tbody>
+</table>
+<div id="details" hidden>
+<h2 id="details-title"></h2>
+{{if .History}}<h3>Recent runs</h3>
+<table>
+<thead><tr><th>Scheduled at</th><th>Started at</th><th>Duration</th><th>Result</th></tr></thead>
+<tbody id="history"></tbody>
+</table>{{end}}
+<h3 id="output-title">Output of the latest run</h3>
+<pre id="output"></pre>
+</div>
+<script>
+var controls = {{.Controls}};
+var historyEnabled = {{.History}};
+var selected = null;
+
+function el(tag, text, className) {
+	var e = document.createElement(tag);
+	if (text !== undefined && text !== null) {
+		e.textContent = text;
+	}
+	if (className) {
+		e.className = className;
+	}
+	return e;
+}
+
+function time(value) {
+	return value ? new Date(value).toLocaleString() : "-";
+}
+
+function request(method, path) {
+	var headers = {};
+	if (method === "POST") {
+		headers["Content-Type"] = "application/json";
+		var token = sessionStorage.getItem("supercronic-token") || prompt("Admin token");
+		if (!token) {
+			return Promise.reject(new Error("no token"));
+		}
+		sessionStorage.setItem("supercronic-token", token);
+		headers["Authorization"] = "Bearer " + token;
+	}
+
+	return fetch(path, {method: method, headers: headers}).then(function(resp) {
+		if (resp.status === 401) {
+			sessionStorage.removeItem("supercronic-token");
+		}
+		return resp.json().then(function(body) {
+			if (!resp.ok) {
+				throw new Error(body.error || resp.statusText);
+			}
+			return body;
+		});
+	});
+}
+
+function action(job, name) {
+	request("POST", "/jobs/" + job.id + "/" + name).then(refresh, function(err) {
+		alert(name + " failed: " + err.message);
+	});
+}
+
+function lastRun(job) {
+	if (!job.last_run) {
+		return el("td", "-", "muted");
+	}
+	var run = job.last_run;
+	var result = run.succeeded ? "ok" : (run.error || "failed");
+	return el("td", result + " (" + time(run.finished_at) + ")", run.succeeded ? "ok" : "failed");
+}
+
+function state(job) {
+	if (job.running > 0) {
+		return "running since " + time(job.running_since);
+	}
+	if (job.tripped) {
+		return "circuit breaker tripped";
+	}
+	if (job.paused) {
+		return "paused";
+	}
+	return job.waiting > 0 ? "waiting" : "idle";
+}
+
+function renderJobs(jobs) {
+	var tbody = document.getElementById("jobs");
+	tbody.textContent = "";
+
+	jobs.forEach(function(job) {
+		var tr = el("tr", null, "job" + (selected === job.id ? " selected" : ""));
+		tr.appendChild(el("td", job.id));
+		tr.appendChild(el("td", job.name || "-"));
+		tr.appendChild(el("td", job.schedule));
+		tr.appendChild(el("td", job.command, "command"));
+		tr.appendChild(el("td", time(job.next_run)));
+		tr.appendChild(lastRun(job));
+		tr.appendChild(el("td", state(job)));
+
+		if (controls) {
+			var td = el("td");
+			var trigger = el("button", "Trigger");
+			trigger.onclick = function(e) { e.stopPropagation(); action(job, "trigger"); };
+			td.appendChild(trigger);
+			var pause = el("button", job.paused ? "Resume" : "Pause");
+			pause.onclick = function(e) { e.stopPropagation(); action(job, job.paused ? "resume" : "pause"); };
+			td.appendChild(pause);
+			if (job.tripped) {
+				var reset = el("button", "Reset");
+				reset.onclick = function(e) { e.stopPropagation(); action(job, "reset"); };
+				td.appendChild(reset);
+			}
+			tr.appendChild(td);
+		}
+
+		tr.onclick = function() {
+			selected = job.id;
+			refresh();
+		};
+
+		tbody.appendChild(tr);
+	});
+}
+
+function renderHistory(records) {
+	var tbody = document.getElementById("history");
+	tbody.textContent = "";
+
+	records.forEach(function(record) {
+		var tr = el("tr");
+		tr.appendChild(el("td", time(record.scheduled_at)));
+		tr.appendChild(el("td", time(record.started_at)));
+		tr.appendChild(el("td", record.duration_seconds.toFixed(1) + "s"));
+		tr.appendChild(el("td", record.succeeded ? "ok" : (record.error || "failed"), record.succeeded ? "ok" : "failed"));
+		tbody.appendChild(tr);
+	});
+}
+
+function renderOutput(output) {
+	var title = "Output of the latest run";
+	if (output.started_at) {
+		title += (output.running ? " (running since " : " (started ") + time(output.started_at) + ")";
+	}
+	document.getElementById("output-title").textContent = title;
+
+	var pre = document.getElementById("output");
+	pre.textContent = "";
+
+	if (output.lines.length === 0) {
+		pre.appendChild(el("span", output.started_at ? "(no output)" : "(the job hasn't run yet)", "muted"));
+	}
+
+	output.lines.forEach(function(line) {
+		pre.appendChild(el("span", line.text + "\n", line.channel));
+	});
+}
+
+function refresh() {
+	request("GET", "/jobs").then(function(jobs) {
+		document.getElementById("status").textContent = jobs.length + " job(s), as of " + new Date().toLocaleTimeString();
+		renderJobs(jobs);
+
+		var job = jobs.filter(function(j) { return j.id === selected; })[0];
+		document.getElementById("details").hidden = !job;
+		if (!job) {
+			return;
+		}
+
+		document.getElementById("details-title").textContent = job.name || job.command;
+		if (historyEnabled) {
+			request("GET", "/jobs/" + job.id + "/history").then(renderHistory);
+		}
+		request("GET", "/jobs/" + job.id + "/output?lines=500").then(renderOutput);
+	}, function(err) {
+		document.getElementById("status").textContent = "refresh failed: " + err.message;
+	});
+}
+
+refresh();
+setInterval(refresh, 2000);
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,110 @@
+// Package archive uploads the output of every run to object storage (S3, or
+// any service with an S3-compatible API, e.g. MinIO or Google Cloud Storage),
+// to retain it for longer than logs are.
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"supercronic/cron"
+)
+
+type Config struct {
+	Bucket string `yaml:"bucket"`
+	// Prefix is prepended to the keys of objects, e.g. supercronic/.
+	Prefix string `yaml:"prefix"`
+	// Region defaults to us-east-1.
+	Region string `yaml:"region"`
+	// Endpoint defaults to AWS's endpoint for the region, e.g.
+	// https://s3.eu-west-1.amazonaws.com. Set it to use another service,
+	// e.g. https://storage.googleapis.com.
+	Endpoint string `yaml:"endpoint"`
+	// PathStyle puts the bucket in the path of URLs rather than in their
+	// host name, as MinIO requires.
+	PathStyle bool `yaml:"path_style"`
+
+	// Credentials default to the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+	// and AWS_SESSION_TOKEN variables.
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	SessionToken    string `yaml:"session_token"`
+}
+
+// Archiver uploads the captured output of runs (see cron.Output), compressed
+// with gzip, one object per run.
+type Archiver struct {
+	client *s3Client
+	prefix string
+}
+
+func New(config Config) (*Archiver, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("archive is missing bucket")
+	}
+
+	config = withDefaults(config)
+
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, fmt.Errorf("archive is missing credentials (access_key_id and secret_access_key)")
+	}
+
+	client, err := newS3Client(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Archiver{client: client, prefix: config.Prefix}, nil
+}
+
+func withDefaults(config Config) Config {
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+
+	if config.Endpoint == "" {
+		config.Endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+
+	if config.AccessKeyID == "" && config.SecretAccessKey == "" {
+		config.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		config.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		config.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+
+	return config
+}
+
+func (a *Archiver) Archive(e *cron.Execution) (string, error) {
+	var buf bytes.Buffer
+
+	w := gzip.NewWriter(&buf)
+	if e.Output.Truncated() {
+		fmt.Fprintf(w, "[output exceeded %d bytes, only the last lines were kept]\n", cron.MAX_CAPTURED_OUTPUT)
+	}
+	for _, line := range e.Output.Lines() {
+		fmt.Fprintf(w, "%s: %s\n", line.Channel, line.Text)
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	return a.client.put(Key(a.prefix, e), buf.Bytes(), "application/gzip")
+}
+
+// Key returns the key of the object holding the output of e, e.g.
+// supercronic/db-backup/2024-01-02T03:00:00Z-7.log.gz, which sorts by the time
+// the run was due. Jobs without a name are identified by their position.
+func Key(prefix string, e *cron.Execution) string {
+	job := e.Job.Name
+	if job == "" {
+		job = strconv.Itoa(e.Job.Position)
+	}
+
+	when := e.ScheduledAt.UTC().Format("2006-01-02T15:04:05Z")
+	return prefix + strings.Trim(job, "/") + "/" + when + "-" + strconv.FormatUint(e.Iteration, 10) + ".log.gz"
+}
@@ -0,0 +1,99 @@
+package archive
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+func newTestExecution(name string) *cron.Execution {
+	output := &cron.Output{}
+	output.Append("stdout", "starting backup")
+	output.Append("stderr", "disk almost full")
+
+	return &cron.Execution{
+		Job:         &crontab.Job{Name: name, Position: 3},
+		Iteration:   7,
+		ScheduledAt: time.Date(2024, 1, 2, 4, 0, 0, 0, time.FixedZone("CET", 3600)),
+		Output:      output,
+	}
+}
+
+func TestKey(t *testing.T) {
+	assert.Equal(t, "supercronic/db-backup/2024-01-02T03:00:00Z-7.log.gz", Key("supercronic/", newTestExecution("db-backup")))
+	assert.Equal(t, "3/2024-01-02T03:00:00Z-7.log.gz", Key("", newTestExecution("")))
+}
+
+func TestArchive(t *testing.T) {
+	var path, auth, contentType, body string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+		auth = r.Header.Get("Authorization")
+		contentType = r.Header.Get("Content-Type")
+
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := ioutil.ReadAll(gz)
+		body = string(data)
+	}))
+	defer server.Close()
+
+	a, err := New(Config{
+		Bucket:          "logs",
+		Prefix:          "batch/",
+		Endpoint:        server.URL,
+		PathStyle:       true,
+		AccessKeyID:     "minio",
+		SecretAccessKey: "minio123",
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	url, err := a.Archive(newTestExecution("db-backup"))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Equal(t, server.URL+"/logs/batch/db-backup/2024-01-02T03%3A00%3A00Z-7.log.gz", url)
+	assert.Equal(t, "/logs/batch/db-backup/2024-01-02T03%3A00%3A00Z-7.log.gz", path)
+	assert.True(t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=minio/"), auth)
+	assert.Equal(t, "application/gzip", contentType)
+	assert.Equal(t, "stdout: starting backup\nstderr: disk almost full\n", body)
+}
+
+func TestArchiveFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("<Error><Code>AccessDenied</Code></Error>"))
+	}))
+	defer server.Close()
+
+	a, _ := New(Config{Bucket: "logs", Endpoint: server.URL, PathStyle: true, AccessKeyID: "a", SecretAccessKey: "b"})
+
+	_, err := a.Archive(newTestExecution("db-backup"))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "AccessDenied")
+	}
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	_, err := New(Config{AccessKeyID: "a", SecretAccessKey: "b"})
+	assert.NotNil(t, err)
+
+	_, err = New(Config{Bucket: "logs", Endpoint: "not a url", AccessKeyID: "a", SecretAccessKey: "b"})
+	assert.NotNil(t, err)
+}
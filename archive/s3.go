@@ -0,0 +1,203 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Timeout for each upload.
+var UPLOAD_TIMEOUT = 30 * time.Second
+
+// s3Client uploads objects to a bucket, signing requests with AWS Signature
+// Version 4.
+type s3Client struct {
+	config   Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+func newS3Client(config Config) (*s3Client, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(config.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("archive has bad endpoint: %s", config.Endpoint)
+	}
+
+	return &s3Client{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: UPLOAD_TIMEOUT},
+		now:      time.Now,
+	}, nil
+}
+
+// objectURL returns the URL of the object with key.
+func (c *s3Client) objectURL(key string) string {
+	u := *c.endpoint
+	path := "/" + escapePath(key)
+
+	if c.config.PathStyle {
+		path = "/" + escapePath(c.config.Bucket) + path
+	} else {
+		u.Host = c.config.Bucket + "." + u.Host
+	}
+
+	u.Path = ""
+	return u.String() + path
+}
+
+func (c *s3Client) put(key string, body []byte, contentType string) (string, error) {
+	objectURL := c.objectURL(key)
+
+	req, err := http.NewRequest("PUT", objectURL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	if c.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.config.SessionToken)
+	}
+
+	sum := sha256.Sum256(body)
+	c.sign(req, hex.EncodeToString(sum[:]), c.now())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("upload of %s returned %s: %s", key, resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	return objectURL, nil
+}
+
+// NewGetRequest returns a request that fetches the object with key from the
+// bucket of config, which defaults like for New. Requests are signed with
+// config's credentials, if there are any (public objects don't need them),
+// along with the headers in header.
+func NewGetRequest(config Config, key string, header http.Header) (*http.Request, error) {
+	config = withDefaults(config)
+
+	c, err := newS3Client(config)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", c.objectURL(key), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return req, nil
+	}
+
+	if config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", config.SessionToken)
+	}
+	c.sign(req, sha256Hex(nil), c.now())
+
+	return req, nil
+}
+
+// sign signs req, and all the headers set on it, per
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html.
+func (c *s3Client) sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102")
+	scope := date + "/" + c.config.Region + "/s3/aws4_request"
+
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders bytes.Buffer
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format("20060102T150405Z"),
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.config.SecretAccessKey), date)
+	key = hmacSHA256(key, c.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.config.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// escapePath escapes path per AWS's rules: everything but unreserved
+// characters and slashes.
+func escapePath(path string) string {
+	var buf bytes.Buffer
+
+	for _, b := range []byte(path) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~', b == '/':
+			buf.WriteByte(b)
+		default:
+			fmt.Fprintf(&buf, "%%%02X", b)
+		}
+	}
+
+	return buf.String()
+}
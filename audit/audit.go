@@ -0,0 +1,99 @@
+// Package audit writes a record of every job execution to an append-only
+// file, one JSON object per line, for tools that need a stable account of
+// what ran (unlike logs, which are meant for humans and may change).
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"supercronic/cron"
+)
+
+// VERSION is the version of the record format. It only changes when fields
+// are removed or change meaning, not when fields are added.
+const VERSION = 1
+
+// Record describes a job execution.
+type Record struct {
+	Version int `json:"version"`
+
+	Job       string `json:"job,omitempty"`
+	Schedule  string `json:"schedule"`
+	Command   string `json:"command"`
+	Source    string `json:"source,omitempty"`
+	Position  int    `json:"position"`
+	Iteration uint64 `json:"iteration"`
+
+	ScheduledAt time.Time `json:"scheduled_at"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	Duration    float64   `json:"duration_seconds"`
+	ExitCode    int       `json:"exit_code"`
+	Succeeded   bool      `json:"succeeded"`
+	Skipped     bool      `json:"skipped,omitempty"`
+	Error       string    `json:"error,omitempty"`
+
+	StdoutBytes int64  `json:"stdout_bytes"`
+	StderrBytes int64  `json:"stderr_bytes"`
+	OutputURL   string `json:"output_url,omitempty"`
+}
+
+// NewRecord describes e.
+func NewRecord(e *cron.Execution) *Record {
+	record := &Record{
+		Version:     VERSION,
+		Job:         e.Job.Name,
+		Schedule:    e.Job.Schedule,
+		Command:     e.Job.Command,
+		Source:      e.Job.Source,
+		Position:    e.Job.Position,
+		Iteration:   e.Iteration,
+		ScheduledAt: e.ScheduledAt,
+		StartedAt:   e.StartedAt,
+		FinishedAt:  e.FinishedAt,
+		Duration:    e.Duration().Seconds(),
+		ExitCode:    e.ExitCode,
+		Succeeded:   e.Err == nil,
+		Skipped:     e.Skipped,
+		StdoutBytes: e.Output.Bytes("stdout"),
+		StderrBytes: e.Output.Bytes("stderr"),
+		OutputURL:   e.OutputURL,
+	}
+
+	if e.Err != nil {
+		record.Error = e.Err.Error()
+	}
+
+	return record
+}
+
+// Hook writes a record to w once every execution finishes. Each record is
+// written with a single call to w.Write.
+type Hook struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewHook(w io.Writer) *Hook {
+	return &Hook{w: w}
+}
+
+func (h *Hook) JobStarted(e *cron.Execution) {}
+
+func (h *Hook) JobFinished(e *cron.Execution) {
+	data, err := json.Marshal(NewRecord(e))
+	if err != nil {
+		e.Logger.Errorf("failed to encode audit record: %v", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, err := h.w.Write(append(data, '\n')); err != nil {
+		e.Logger.Errorf("failed to write audit record: %v", err)
+	}
+}
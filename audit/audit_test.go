@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+func newTestExecution(err error) *cron.Execution {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	scheduledAt := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	return &cron.Execution{
+		Job: &crontab.Job{
+			CrontabLine: crontab.CrontabLine{Schedule: "@daily", Command: "backup.sh"},
+			Position:    3,
+		},
+		Logger:      logrus.NewEntry(logger),
+		Iteration:   7,
+		ScheduledAt: scheduledAt,
+		StartedAt:   scheduledAt.Add(time.Second),
+		FinishedAt:  scheduledAt.Add(2500 * time.Millisecond),
+		Err:         err,
+	}
+}
+
+func TestHookWritesRecords(t *testing.T) {
+	var buf bytes.Buffer
+	hook := NewHook(&buf)
+
+	hook.JobFinished(newTestExecution(nil))
+
+	failed := newTestExecution(errors.New("exit status 2"))
+	failed.Job.Name = "backup"
+	failed.ExitCode = 2
+	hook.JobFinished(failed)
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if !assert.Equal(t, 2, len(lines)) {
+		return
+	}
+
+	assert.Equal(t, `{"version":1,"schedule":"@daily","command":"backup.sh","position":3,"iteration":7,`+
+		`"scheduled_at":"2019-01-01T00:00:00Z","started_at":"2019-01-01T00:00:01Z","finished_at":"2019-01-01T00:00:02.5Z",`+
+		`"duration_seconds":1.5,"exit_code":0,"succeeded":true,"stdout_bytes":0,"stderr_bytes":0}`, lines[0])
+
+	var record Record
+	if assert.Nil(t, json.Unmarshal([]byte(lines[1]), &record)) {
+		assert.Equal(t, "backup", record.Job)
+		assert.Equal(t, 2, record.ExitCode)
+		assert.False(t, record.Succeeded)
+		assert.Equal(t, "exit status 2", record.Error)
+	}
+}
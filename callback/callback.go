@@ -0,0 +1,143 @@
+// Package callback runs commands when jobs finish, with environment variables
+// describing the run. This lets users wire up alerting or bookkeeping of their
+// own without supercronic integrating with every service.
+package callback
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+
+	"supercronic/cron"
+	"supercronic/platform"
+)
+
+// CALLBACK_TIMEOUT bounds how long callbacks may run. They run inline with
+// the job, so this bounds how much they can delay it.
+var CALLBACK_TIMEOUT = time.Minute
+
+// Config holds the commands that run after every job, as set in the
+// configuration file.
+type Config struct {
+	OnJobSuccess string `yaml:"on_job_success"`
+	OnJobFailure string `yaml:"on_job_failure"`
+}
+
+// Hook runs the command set via a job's `on_failure` directive when it fails,
+// and the commands in its Config after every job.
+type Hook struct {
+	config Config
+	// cleanEnv gives callbacks the same environment as jobs run with
+	// cron.Options.CleanEnv.
+	cleanEnv bool
+}
+
+func NewHook(config Config, cleanEnv bool) *Hook {
+	return &Hook{config: config, cleanEnv: cleanEnv}
+}
+
+func (h *Hook) JobStarted(e *cron.Execution) {}
+
+func (h *Hook) JobFinished(e *cron.Execution) {
+	if e.Err == nil {
+		if h.config.OnJobSuccess != "" {
+			Run(e, "on_job_success", h.config.OnJobSuccess, h.cleanEnv)
+		}
+		return
+	}
+
+	if e.Job.OnFailure != "" {
+		Run(e, "on_failure", e.Job.OnFailure, h.cleanEnv)
+	}
+
+	if h.config.OnJobFailure != "" {
+		Run(e, "on_job_failure", h.config.OnJobFailure, h.cleanEnv)
+	}
+}
+
+// Environ returns the variables that describe e to callbacks: the ones jobs
+// get (see cron.RunEnviron), plus the outcome of the run.
+func Environ(e *cron.Execution) []string {
+	status := "succeeded"
+	errorMessage := ""
+	if e.Err != nil {
+		status = "failed"
+		errorMessage = e.Err.Error()
+	}
+
+	return append(cron.RunEnviron(e),
+		"SUPERCRONIC_JOB_SCHEDULE="+e.Job.Schedule,
+		"SUPERCRONIC_JOB_COMMAND="+e.Job.Command,
+		"SUPERCRONIC_JOB_SOURCE="+e.Job.Source,
+		"SUPERCRONIC_JOB_STATUS="+status,
+		"SUPERCRONIC_EXIT_CODE="+strconv.Itoa(e.ExitCode),
+		"SUPERCRONIC_ERROR="+errorMessage,
+		"SUPERCRONIC_STARTED_AT="+e.StartedAt.Format(time.RFC3339),
+		"SUPERCRONIC_FINISHED_AT="+e.FinishedAt.Format(time.RFC3339),
+		"SUPERCRONIC_DURATION_SECONDS="+strconv.FormatFloat(e.Duration().Seconds(), 'f', 3, 64),
+	)
+}
+
+// Run runs command in e's shell and environment, plus the variables returned
+// by Environ. Its output is logged, along with its name. cleanEnv cleans its
+// environment, as cron.Options.CleanEnv does.
+func Run(e *cron.Execution, name string, command string, cleanEnv bool) {
+	logger := e.Logger.WithField("callback", name)
+
+	shell := "/bin/sh"
+	env := cron.ProcessEnviron(cleanEnv)
+
+	if e.Context != nil {
+		if e.Context.Shell != "" {
+			shell = e.Context.Shell
+		}
+		for k, v := range e.Context.Environ {
+			env = append(env, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+
+	for k, v := range e.Job.Env {
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	var output bytes.Buffer
+
+	cmd := exec.Command(shell, "-c", command)
+	cmd.Env = append(env, Environ(e)...)
+	cmd.Dir = e.Job.Dir
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	// Kill the whole process group on timeout: the shell's children would
+	// otherwise keep running, and keep us waiting for their output.
+	platform.SetProcessGroup(cmd)
+
+	logger.Infof("running %s command: %s", name, command)
+
+	if err := cmd.Start(); err != nil {
+		logger.Errorf("%s command failed: %v", name, err)
+		return
+	}
+
+	timer := time.AfterFunc(CALLBACK_TIMEOUT, func() {
+		platform.SignalProcessGroup(cmd.Process.Pid, syscall.SIGKILL)
+	})
+
+	err := cmd.Wait()
+	timedOut := !timer.Stop()
+
+	scanner := bufio.NewScanner(&output)
+	for scanner.Scan() {
+		logger.Info(scanner.Text())
+	}
+
+	if timedOut {
+		logger.Errorf("%s command timed out after %v", name, CALLBACK_TIMEOUT)
+	} else if err != nil {
+		logger.Errorf("%s command failed: %v", name, err)
+	}
+}
@@ -0,0 +1,120 @@
+package callback
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+func newTestExecution(onFailure string, err error) *cron.Execution {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	startedAt := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	return &cron.Execution{
+		Job: &crontab.Job{
+			CrontabLine: crontab.CrontabLine{Schedule: "@daily", Command: "backup.sh"},
+			Name:        "backup",
+			Position:    3,
+			OnFailure:   onFailure,
+		},
+		Context: &crontab.Context{
+			Shell:   "/bin/sh",
+			Environ: map[string]string{"FOO": "bar"},
+		},
+		Logger:     logrus.NewEntry(logger),
+		StartedAt:  startedAt,
+		FinishedAt: startedAt.Add(1500 * time.Millisecond),
+		Err:        err,
+		ExitCode:   2,
+	}
+}
+
+func readOutput(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	assert.Nil(t, err)
+	return string(data)
+}
+
+func TestHookRunsOnFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-callback")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "out")
+	command := `echo "$SUPERCRONIC_JOB_NAME $SUPERCRONIC_EXIT_CODE $SUPERCRONIC_DURATION_SECONDS $SUPERCRONIC_JOB_STATUS $FOO" > ` + out
+
+	NewHook(Config{}, false).JobFinished(newTestExecution(command, errors.New("error running command: exit status 2")))
+	assert.Equal(t, "backup 2 1.500 failed bar\n", readOutput(t, out))
+}
+
+func TestHookIgnoresSuccesses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-callback")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "out")
+
+	NewHook(Config{}, false).JobFinished(newTestExecution("touch "+out, nil))
+	assert.Equal(t, "", readOutput(t, out))
+}
+
+func TestHookRunsConfiguredCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-callback")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "out")
+	hook := NewHook(Config{
+		OnJobSuccess: `echo "success $SUPERCRONIC_JOB_STATUS" >> ` + out,
+		OnJobFailure: `echo "failure $SUPERCRONIC_JOB_STATUS" >> ` + out,
+	}, false)
+
+	hook.JobFinished(newTestExecution(`echo "on_failure" >> `+out, errors.New("exit status 2")))
+	hook.JobFinished(newTestExecution("", nil))
+
+	assert.Equal(t, "on_failure\nfailure failed\nsuccess succeeded\n", readOutput(t, out))
+}
+
+func TestEnviron(t *testing.T) {
+	env := Environ(newTestExecution("", errors.New("boom")))
+
+	assert.Contains(t, env, "SUPERCRONIC_JOB_SCHEDULE=@daily")
+	assert.Contains(t, env, "SUPERCRONIC_JOB_COMMAND=backup.sh")
+	assert.Contains(t, env, "SUPERCRONIC_JOB_POSITION=3")
+	assert.Contains(t, env, "SUPERCRONIC_ERROR=boom")
+	assert.Contains(t, env, "SUPERCRONIC_STARTED_AT=2019-01-01T00:00:00Z")
+
+	for _, v := range env {
+		assert.True(t, strings.HasPrefix(v, "SUPERCRONIC_"), v)
+	}
+}
+
+func TestRunTimesOut(t *testing.T) {
+	timeout := CALLBACK_TIMEOUT
+	CALLBACK_TIMEOUT = 100 * time.Millisecond
+	defer func() { CALLBACK_TIMEOUT = timeout }()
+
+	start := time.Now()
+	Run(newTestExecution("", nil), "test", "sleep 5", false)
+	assert.True(t, time.Since(start) < 2*time.Second)
+}
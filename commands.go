@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	prefixed "github.com/x-cray/logrus-prefixed-formatter"
+
+	"supercronic/config"
+	"supercronic/cron"
+	"supercronic/crontab"
+	"supercronic/remote"
+	"supercronic/runner"
+)
+
+// The subcommands below take the options that control how crontabs are
+// parsed, like the bare invocation (which `supercronic run` is the same as),
+// but none of the ones that control how jobs are run.
+
+// parseOptionsFlags registers the flags that control how crontabs are
+// parsed, and returns a function that turns them into ParseOptions once they
+// are parsed.
+func parseOptionsFlags(flags *flag.FlagSet) func() (crontab.ParseOptions, error) {
+	seconds := flags.Bool("seconds", false, "parse 6-field expressions as seconds + POSIX (instead of POSIX + years)")
+	format := flags.String("format", "", "read crontabs in this format: crontab or yaml (default: yaml for files ending with .yaml or .yml, crontab otherwise)")
+	expandEnv := flags.Bool("expand-env", false, "expand $VAR and ${VAR} in crontab commands and variables, using crontab variables and the environment")
+	timezone := flags.String("timezone", "", "schedule jobs in this timezone (e.g. Europe/Berlin) instead of the local one, unless they follow a CRON_TZ or TZ variable")
+	flags.StringVar(timezone, "tz", "", "alias for -timezone")
+	dstSkipped := flags.String("dst-skipped", "run", "what to do about runs scheduled at times clocks skip when daylight saving time starts: run or skip")
+	dstRepeated := flags.String("dst-repeated", "once", "what to do about runs scheduled at times clocks show twice when daylight saving time ends: once or twice")
+	onlyTags := flags.String("only-tags", "", onlyTagsUsage)
+	skipTags := flags.String("skip-tags", "", skipTagsUsage)
+	template := flags.Bool("template", false, templateUsage)
+	values := flags.String("values", "", valuesUsage)
+
+	return func() (crontab.ParseOptions, error) {
+		options := crontab.ParseOptions{Seconds: *seconds, ExpandEnv: *expandEnv, Template: *template || *values != "", Values: *values}
+		var err error
+
+		if options.Format, err = crontab.ParseFormat(*format); err != nil {
+			return options, fmt.Errorf("bad -format: %v", err)
+		}
+
+		if options.DSTSkipped, err = crontab.ParseDSTSkippedPolicy(*dstSkipped); err != nil {
+			return options, fmt.Errorf("bad -dst-skipped: %v", err)
+		}
+
+		if options.DSTRepeated, err = crontab.ParseDSTRepeatedPolicy(*dstRepeated); err != nil {
+			return options, fmt.Errorf("bad -dst-repeated: %v", err)
+		}
+
+		if *timezone != "" {
+			if options.Location, err = time.LoadLocation(*timezone); err != nil {
+				return options, fmt.Errorf("bad -timezone: %v", err)
+			}
+		}
+
+		if options.Tags, err = parseTagFilter(*onlyTags, *skipTags); err != nil {
+			return options, err
+		}
+
+		return options, nil
+	}
+}
+
+const (
+	onlyTagsUsage = "only schedule jobs that have one of these tags (comma-separated, e.g. nightly,eu-only), per their tags directive"
+	skipTagsUsage = "do not schedule jobs that have one of these tags (comma-separated), per their tags directive"
+	templateUsage = "render crontabs as Go templates (with the environment as .Env, and -values as .Values) before parsing them"
+	valuesUsage   = "with -template, render crontabs with the values in this YAML file as .Values (implies -template)"
+)
+
+// printRendered prints the crontabs at paths as options.Template renders
+// them, each after a comment that names it.
+func printRendered(paths []string, options crontab.ParseOptions) error {
+	for _, path := range paths {
+		files, err := crontab.ExpandPath(path)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			rendered, err := crontab.RenderFile(file, options)
+			if err != nil {
+				return fmt.Errorf("%s: %v", file, err)
+			}
+
+			fmt.Printf("# rendered from %s\n%s", file, rendered)
+			if len(rendered) > 0 && rendered[len(rendered)-1] != '\n' {
+				fmt.Println()
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseTagFilter parses -only-tags and -skip-tags.
+func parseTagFilter(only string, skip string) (crontab.TagFilter, error) {
+	var filter crontab.TagFilter
+	var err error
+
+	if filter.Only, err = crontab.ParseTags(only); err != nil {
+		return filter, fmt.Errorf("bad -only-tags: %v", err)
+	}
+
+	if filter.Skip, err = crontab.ParseTags(skip); err != nil {
+		return filter, fmt.Errorf("bad -skip-tags: %v", err)
+	}
+
+	return filter, nil
+}
+
+func subcommandLogger() *logrus.Entry {
+	logrus.SetFormatter(&prefixed.TextFormatter{FullTimestamp: true})
+	return logrus.WithField("prefix", "supercronic")
+}
+
+// subcommandFlags returns the flags of the subcommand name, whose usage
+// starts with the lines of usage.
+func subcommandFlags(name string, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s %s\n\nAvailable options:\n", os.Args[0], name, usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseArgs parses the flags of a subcommand, which, unlike with
+// flag.Parse, may follow its arguments (e.g. `next SCHEDULE -n 10`), and
+// returns the arguments. Everything after -- is an argument.
+func parseArgs(flags *flag.FlagSet, args []string) []string {
+	var positional []string
+
+	for {
+		flags.Parse(args)
+		rest := flags.Args()
+
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			return append(positional, rest...)
+		}
+
+		if len(rest) == 0 {
+			return positional
+		}
+
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// crontabArgs returns the crontabs passed to a subcommand, or the one
+// SUPERCRONIC_CRONTAB points at if there are none.
+func crontabArgs(args []string) []string {
+	paths := args
+	if len(paths) == 0 && os.Getenv(config.EnvPrefix+"CRONTAB") != "" {
+		paths = []string{os.Getenv(config.EnvPrefix + "CRONTAB")}
+	}
+	return paths
+}
+
+// readCrontabs reads the crontabs passed to a subcommand as args.
+func readCrontabs(flags *flag.FlagSet, args []string, parseOptions crontab.ParseOptions) (*logrus.Entry, []*crontab.Crontab, bool) {
+	logger := subcommandLogger()
+
+	paths := crontabArgs(args)
+	if len(paths) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	tabs, err := readAllCrontabs(logger, paths, parseOptions)
+	if err != nil {
+		logger.Error(err)
+		return logger, nil, false
+	}
+
+	return logger, tabs, true
+}
+
+// readAllCrontabs is runner.ReadAllCrontabs, for paths that may be URLs too.
+func readAllCrontabs(logger *logrus.Entry, paths []string, parseOptions crontab.ParseOptions) ([]*crontab.Crontab, error) {
+	if remote.HasURL(paths) {
+		fetcher, err := remote.New(logger, paths, 0)
+		if err != nil {
+			return nil, err
+		}
+		defer fetcher.Close()
+
+		paths = fetcher.Paths()
+	}
+
+	return runner.ReadAllCrontabs(logger, paths, parseOptions)
+}
+
+// testCrontabs checks crontabs, like -test (or -strict), and returns the
+// status to exit with.
+func testCrontabs(args []string) int {
+	flags := subcommandFlags("test", "[OPTIONS] CRONTAB...\n\nCheck that each CRONTAB (a file, a directory, or a glob) is valid, without running jobs.")
+	strict := flags.Bool("strict", false, "also fail on suspicious constructs, e.g. undefined variables or schedules that never fire")
+	noShell := flags.Bool("no-shell", false, "check commands as if they ran without a shell (per supercronic's -no-shell)")
+	options := parseOptionsFlags(flags)
+	args = parseArgs(flags, args)
+
+	parseOptions, err := options()
+	if err != nil {
+		logrus.Error(err)
+		return 1
+	}
+
+	logger, tabs, ok := readCrontabs(flags, args, parseOptions)
+	if !ok {
+		return 1
+	}
+
+	if parseOptions.Template {
+		if err := printRendered(crontabArgs(args), parseOptions); err != nil {
+			logger.Error(err)
+			return 1
+		}
+	}
+
+	if *strict {
+		diagnostics := crontab.Lint(tabs, lintOptions(*noShell, parseOptions))
+		if errors := logDiagnostics(logger, diagnostics); errors > 0 {
+			logger.Errorf("crontab has %d problem(s)", errors)
+			return 1
+		}
+	}
+
+	logger.Info("crontab is valid")
+	return 0
+}
+
+// logDiagnostics logs diagnostics at the level of their severity, and
+// returns how many are errors.
+func logDiagnostics(logger *logrus.Entry, diagnostics []crontab.Diagnostic) int {
+	errors := 0
+
+	for _, d := range diagnostics {
+		switch d.Severity {
+		case crontab.SeverityError:
+			logger.Error(d.String())
+			errors++
+		case crontab.SeverityWarning:
+			logger.Warn(d.String())
+		default:
+			logger.Info(d.String())
+		}
+	}
+
+	return errors
+}
+
+func lintOptions(noShell bool, parseOptions crontab.ParseOptions) crontab.LintOptions {
+	execMode := crontab.ExecShell
+	if noShell {
+		execMode = crontab.ExecDirect
+	}
+	return crontab.LintOptions{Exec: execMode, Now: time.Now(), ExpandEnv: parseOptions.ExpandEnv}
+}
+
+// lintCrontabs prints the problems crontab.Lint finds in crontabs, one per
+// line, and returns 1 if any is at least as severe as -fail-on (0
+// otherwise).
+func lintCrontabs(args []string) int {
+	flags := subcommandFlags("lint", "[OPTIONS] CRONTAB...\n\nReport likely mistakes in each CRONTAB (a file, a directory, or a glob), e.g. in CI.")
+	failOn := flags.String("fail-on", "warning", "exit with status 1 if there are problems of this severity, or worse: error, warning, or info")
+	maxJobsPerMinute := flags.Int("max-jobs-per-minute", crontab.MAX_JOBS_PER_MINUTE, "report more jobs than this that start in the same minute (jobs that run more often than hourly don't count)")
+	noShell := flags.Bool("no-shell", false, "check commands as if they ran without a shell (per supercronic's -no-shell)")
+	options := parseOptionsFlags(flags)
+	args = parseArgs(flags, args)
+
+	threshold, err := crontab.ParseSeverity(*failOn)
+	if err != nil {
+		logrus.Errorf("bad -fail-on: %v", err)
+		return 2
+	}
+
+	parseOptions, err := options()
+	if err != nil {
+		logrus.Error(err)
+		return 1
+	}
+
+	_, tabs, ok := readCrontabs(flags, args, parseOptions)
+	if !ok {
+		return 1
+	}
+
+	lint := lintOptions(*noShell, parseOptions)
+	lint.MaxJobsPerMinute = *maxJobsPerMinute
+
+	status := 0
+	for _, d := range crontab.Lint(tabs, lint) {
+		fmt.Printf("%s: %s\n", d.Severity, d)
+		if d.Severity >= threshold {
+			status = 1
+		}
+	}
+
+	return status
+}
+
+// nextRuns prints when schedules, or the jobs of crontabs, run next, and
+// returns the status to exit with.
+func nextRuns(args []string) int {
+	flags := subcommandFlags("next", "[OPTIONS] SCHEDULE|CRONTAB...\n\nShow when each SCHEDULE (e.g. '*/15 2-4 * * *'), or the jobs of each CRONTAB (a file, a directory, or a glob), run next.")
+	count := flags.Int("n", 5, "show this many runs of each schedule or job")
+	options := parseOptionsFlags(flags)
+	args = parseArgs(flags, args)
+
+	if *count <= 0 {
+		flags.Usage()
+		return 2
+	}
+
+	parseOptions, err := options()
+	if err != nil {
+		logrus.Error(err)
+		return 1
+	}
+
+	logger := subcommandLogger()
+	now := time.Now()
+
+	printRuns := func(name string, expression crontab.Expression) {
+		fmt.Println(name)
+
+		if crontab.IsDaemon(expression) {
+			fmt.Println("  always running")
+			return
+		}
+
+		runs := cron.NextRuns(expression, now, *count)
+		if len(runs) == 0 {
+			fmt.Println("  never")
+		}
+		for _, t := range runs {
+			fmt.Printf("  %s\n", t.Format("2006-01-02 15:04:05 -0700 MST"))
+		}
+	}
+
+	paths := crontabArgs(args)
+	if len(paths) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	for _, arg := range paths {
+		// Arguments are schedules, unless they name a file.
+		_, statErr := os.Stat(arg)
+		var scheduleErr error
+		if os.IsNotExist(statErr) {
+			expression, err := crontab.ParseSchedule(arg, parseOptions)
+			if err == nil {
+				printRuns(arg, expression)
+				continue
+			}
+			scheduleErr = err
+		}
+
+		tabs, err := readAllCrontabs(logger, []string{arg}, parseOptions)
+		if err != nil {
+			if scheduleErr != nil {
+				logger.Errorf("%v, and %v", scheduleErr, err)
+			} else {
+				logger.Error(err)
+			}
+			return 1
+		}
+
+		for _, tab := range tabs {
+			for _, job := range tab.Jobs {
+				name := job.Name
+				if name == "" {
+					name = job.Command
+				}
+				printRuns(fmt.Sprintf("%s (%s)", name, job.Schedule), job.Expression)
+			}
+		}
+	}
+
+	return 0
+}
+
+// formatCrontabs formats crontabs (see crontab.Format), and returns the
+// status to exit with.
+func formatCrontabs(args []string) int {
+	flags := subcommandFlags("fmt", "[OPTIONS] [FILE...]\n\nFormat each crontab FILE (or stdin, if there are none) canonically, and print it.")
+	write := flags.Bool("w", false, "write the result to each file, instead of printing it")
+	list := flags.Bool("l", false, "list the files whose formatting differs, instead of printing them")
+	options := parseOptionsFlags(flags)
+	args = parseArgs(flags, args)
+
+	parseOptions, err := options()
+	if err != nil {
+		logrus.Error(err)
+		return 1
+	}
+
+	if len(args) == 0 {
+		if *write || *list {
+			flags.Usage()
+			return 2
+		}
+
+		formatted, err := crontab.Format(os.Stdin, parseOptions)
+		if err != nil {
+			logrus.Errorf("<stdin>: %v", err)
+			return 1
+		}
+
+		os.Stdout.Write(formatted)
+		return 0
+	}
+
+	status := 0
+
+	for _, path := range args {
+		formatted, err := crontab.FormatFile(path, parseOptions)
+		if err != nil {
+			logrus.Error(err)
+			status = 1
+			continue
+		}
+
+		if !*write && !*list {
+			os.Stdout.Write(formatted)
+			continue
+		}
+
+		original, err := ioutil.ReadFile(path)
+		if err != nil {
+			logrus.Error(err)
+			status = 1
+			continue
+		}
+
+		if bytes.Equal(original, formatted) {
+			continue
+		}
+
+		if *list {
+			fmt.Println(path)
+		}
+
+		if *write {
+			info, err := os.Stat(path)
+			if err == nil {
+				err = ioutil.WriteFile(path, formatted, info.Mode())
+			}
+			if err != nil {
+				logrus.Errorf("could not write %s: %v", path, err)
+				status = 1
+			}
+		}
+	}
+
+	return status
+}
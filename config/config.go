@@ -0,0 +1,60 @@
+// Package config loads supercronic's optional YAML configuration file, which
+// holds settings that are too involved to pass as command line flags (e.g.
+// credentials for external services).
+package config
+
+import (
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+
+	"supercronic/archive"
+	"supercronic/callback"
+	"supercronic/leader"
+	"supercronic/log/hook"
+	"supercronic/mailer"
+	"supercronic/notify"
+	"supercronic/pushgateway"
+	"supercronic/results"
+	"supercronic/secrets"
+	"supercronic/tracing"
+)
+
+type Config struct {
+	// Flags sets flags that weren't passed on the command line (or via the
+	// environment, see Resolve), e.g. json: true.
+	Flags map[string]string `yaml:"flags"`
+
+	SMTP           *mailer.Config       `yaml:"smtp"`
+	EmailAlerts    *mailer.AlertConfig  `yaml:"email_alerts"`
+	Notify         *notify.Config       `yaml:"notify"`
+	LeaderElection *leader.Config       `yaml:"leader_election"`
+	Tracing        *tracing.Config      `yaml:"tracing"`
+	Pushgateway    *pushgateway.Config  `yaml:"pushgateway"`
+	Vault          *secrets.VaultConfig `yaml:"vault"`
+	Archive        *archive.Config      `yaml:"archive"`
+	ResultWebhook  *results.Config      `yaml:"result_webhook"`
+	Loki           *hook.LokiConfig     `yaml:"loki"`
+
+	// Callbacks are top-level settings: on_job_success and on_job_failure.
+	Callbacks callback.Config `yaml:",inline"`
+}
+
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+func Parse(data []byte) (*Config, error) {
+	cfg := &Config{}
+
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEmpty(t *testing.T) {
+	cfg, err := Parse([]byte(""))
+	if assert.Nil(t, err) {
+		assert.Nil(t, cfg.SMTP)
+		assert.Nil(t, cfg.Notify)
+		assert.Nil(t, cfg.LeaderElection)
+		assert.Nil(t, cfg.Tracing)
+	}
+}
+
+func TestParseSMTP(t *testing.T) {
+	cfg, err := Parse([]byte(`
+smtp:
+  host: smtp.example.com
+  port: 587
+  username: user
+  password: pass
+  from: cron@example.com
+`))
+
+	if assert.Nil(t, err) && assert.NotNil(t, cfg.SMTP) {
+		assert.Equal(t, "smtp.example.com", cfg.SMTP.Host)
+		assert.Equal(t, 587, cfg.SMTP.Port)
+		assert.Equal(t, "user", cfg.SMTP.Username)
+		assert.Equal(t, "pass", cfg.SMTP.Password)
+		assert.Equal(t, "cron@example.com", cfg.SMTP.From)
+	}
+}
+
+func TestParseEmailAlerts(t *testing.T) {
+	cfg, err := Parse([]byte(`
+email_alerts:
+  to: [ops@example.com, dev@example.com]
+  failures: 3
+`))
+
+	if assert.Nil(t, err) && assert.NotNil(t, cfg.EmailAlerts) {
+		assert.Equal(t, []string{"ops@example.com", "dev@example.com"}, cfg.EmailAlerts.To)
+		assert.Equal(t, 3, cfg.EmailAlerts.Failures)
+	}
+}
+
+func TestParseNotify(t *testing.T) {
+	cfg, err := Parse([]byte(`
+notify:
+  stderr_lines: 5
+  slack:
+    - url: https://hooks.slack.com/services/xxx
+      channel: "#ops"
+  webhooks:
+    - url: https://example.com/hook
+      headers:
+        Authorization: Bearer token
+`))
+
+	if assert.Nil(t, err) && assert.NotNil(t, cfg.Notify) {
+		assert.Equal(t, 5, cfg.Notify.StderrLines)
+		if assert.Len(t, cfg.Notify.Slack, 1) {
+			assert.Equal(t, "https://hooks.slack.com/services/xxx", cfg.Notify.Slack[0].URL)
+			assert.Equal(t, "#ops", cfg.Notify.Slack[0].Channel)
+		}
+		if assert.Len(t, cfg.Notify.Webhooks, 1) {
+			assert.Equal(t, "https://example.com/hook", cfg.Notify.Webhooks[0].URL)
+			assert.Equal(t, map[string]string{"Authorization": "Bearer token"}, cfg.Notify.Webhooks[0].Headers)
+		}
+	}
+}
+
+func TestParseLeaderElection(t *testing.T) {
+	cfg, err := Parse([]byte(`
+leader_election:
+  lease: supercronic
+  namespace: jobs
+  lease_duration: 30s
+`))
+
+	if assert.Nil(t, err) && assert.NotNil(t, cfg.LeaderElection) {
+		assert.Equal(t, "supercronic", cfg.LeaderElection.Lease)
+		assert.Equal(t, "jobs", cfg.LeaderElection.Namespace)
+		assert.Equal(t, "", cfg.LeaderElection.Identity)
+		assert.Equal(t, 30*time.Second, cfg.LeaderElection.LeaseDuration)
+	}
+}
+
+func TestParseTracing(t *testing.T) {
+	cfg, err := Parse([]byte(`
+tracing:
+  endpoint: http://otel-collector:4318
+  service_name: billing-cron
+  headers:
+    Authorization: Bearer token
+  resource_attributes:
+    deployment.environment: production
+`))
+
+	if assert.Nil(t, err) && assert.NotNil(t, cfg.Tracing) {
+		assert.Equal(t, "http://otel-collector:4318", cfg.Tracing.Endpoint)
+		assert.Equal(t, "billing-cron", cfg.Tracing.ServiceName)
+		assert.Equal(t, map[string]string{"Authorization": "Bearer token"}, cfg.Tracing.Headers)
+		assert.Equal(t, map[string]string{"deployment.environment": "production"}, cfg.Tracing.ResourceAttributes)
+	}
+}
+
+func TestParseRejectsUnknownKeys(t *testing.T) {
+	_, err := Parse([]byte("smtp:\n  hots: smtp.example.com\n"))
+	assert.NotNil(t, err)
+}
+
+func TestParseCallbacks(t *testing.T) {
+	cfg, err := Parse([]byte(`
+on_job_success: /scripts/record.sh success
+on_job_failure: /scripts/record.sh failure
+`))
+
+	if assert.Nil(t, err) {
+		assert.Equal(t, "/scripts/record.sh success", cfg.Callbacks.OnJobSuccess)
+		assert.Equal(t, "/scripts/record.sh failure", cfg.Callbacks.OnJobFailure)
+	}
+}
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// EnvPrefix prefixes the variables that configure supercronic.
+const EnvPrefix = "SUPERCRONIC_"
+
+// configFlag is the flag that points at the configuration file.
+const configFlag = "config"
+
+// Resolve loads the configuration of supercronic from fs, which must already
+// be parsed, the environment (using getenv) and the configuration file, in
+// that order of precedence:
+//
+//   - Flags that weren't passed are set from the SUPERCRONIC_* variable named
+//     after them (e.g. SUPERCRONIC_SENTRY_DSN for -sentry-dsn), or from the
+//     flags section of the configuration file.
+//   - Settings of the configuration file are overridden by SUPERCRONIC_*
+//     variables named after them (e.g. SUPERCRONIC_SMTP_HOST for smtp.host).
+//
+// The configuration file is the one -config (or SUPERCRONIC_CONFIG) points
+// at, if any.
+func Resolve(fs *flag.FlagSet, getenv func(string) string) (*Config, error) {
+	passed := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { passed[f.Name] = true })
+
+	if err := setFlagFromEnv(fs, configFlag, passed, getenv); err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	if f := fs.Lookup(configFlag); f != nil && f.Value.String() != "" {
+		c, err := Load(f.Value.String())
+		if err != nil {
+			return nil, fmt.Errorf("could not load config: %v", err)
+		}
+		cfg = c
+	}
+
+	if _, ok := cfg.Flags[configFlag]; ok {
+		return nil, fmt.Errorf("bad flags in config: %s cannot be set in the config file", configFlag)
+	}
+
+	for _, name := range sortedFlagNames(cfg.Flags) {
+		if fs.Lookup(name) == nil {
+			return nil, fmt.Errorf("bad flags in config: unknown flag: %s", name)
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Name == configFlag {
+			return
+		}
+
+		if err = setFlagFromEnv(fs, f.Name, passed, getenv); err != nil || passed[f.Name] {
+			return
+		}
+
+		if value, ok := cfg.Flags[f.Name]; ok {
+			if e := fs.Set(f.Name, value); e != nil {
+				err = fmt.Errorf("bad flags in config: %s: %v", f.Name, e)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyEnv(reflect.ValueOf(cfg).Elem(), EnvPrefix, getenv); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// FlagEnv returns the name of the variable that sets the flag name, e.g.
+// SUPERCRONIC_LOG_FILE for log-file, or SUPERCRONIC_SENTRY_ENV for
+// sentryEnv.
+func FlagEnv(name string) string {
+	var buf []rune
+
+	for i, r := range name {
+		switch {
+		case r == '-':
+			buf = append(buf, '_')
+		case unicode.IsUpper(r) && i > 0:
+			buf = append(buf, '_', r)
+		default:
+			buf = append(buf, unicode.ToUpper(r))
+		}
+	}
+
+	return EnvPrefix + string(buf)
+}
+
+// setFlagFromEnv sets the flag name from its variable, unless it was passed
+// (in which case the flag takes precedence). It marks the flag as passed if
+// it sets it.
+func setFlagFromEnv(fs *flag.FlagSet, name string, passed map[string]bool, getenv func(string) string) error {
+	if passed[name] {
+		return nil
+	}
+
+	env := FlagEnv(name)
+
+	value := getenv(env)
+	if value == "" {
+		return nil
+	}
+
+	if err := fs.Set(name, value); err != nil {
+		return fmt.Errorf("bad %s: %v", env, err)
+	}
+
+	passed[name] = true
+	return nil
+}
+
+func sortedFlagNames(m map[string]string) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnv overrides the fields of the struct v whose variables are set.
+// Variables are named after the YAML keys of fields, e.g. SUPERCRONIC_SMTP_HOST,
+// (inline fields don't add to the name). Sections that are nil are created if
+// any of their variables are set. Lists of strings are comma-separated.
+// Other lists and maps can only be set in the configuration file.
+func applyEnv(v reflect.Value, prefix string, getenv func(string) string) error {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := strings.Split(field.Tag.Get("yaml"), ",")
+		if tag[0] == "-" {
+			continue
+		}
+
+		fieldPrefix := prefix + strings.ToUpper(tag[0]) + "_"
+		if len(tag) > 1 && tag[1] == "inline" {
+			fieldPrefix = prefix
+		}
+
+		value := v.Field(i)
+
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			if err := applyEnv(value, fieldPrefix, getenv); err != nil {
+				return err
+			}
+		case field.Type.Kind() == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct:
+			section := reflect.New(field.Type.Elem())
+			if !value.IsNil() {
+				section = value
+			}
+
+			before := reflect.Indirect(section).Interface()
+			if err := applyEnv(section.Elem(), fieldPrefix, getenv); err != nil {
+				return err
+			}
+
+			if !value.IsNil() || !reflect.DeepEqual(before, section.Elem().Interface()) {
+				value.Set(section)
+			}
+		default:
+			env := strings.TrimSuffix(fieldPrefix, "_")
+
+			s := getenv(env)
+			if s == "" {
+				continue
+			}
+
+			if err := setField(value, s); err != nil {
+				return fmt.Errorf("bad %s: %v", env, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func setField(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("can only be set in the config file")
+		}
+
+		parts := strings.Split(s, ",")
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		v.Set(reflect.ValueOf(parts))
+	default:
+		return fmt.Errorf("can only be set in the config file")
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testFlags struct {
+	fs        *flag.FlagSet
+	json      *bool
+	logFile   *string
+	sentryEnv *string
+	jitter    *time.Duration
+	config    *string
+}
+
+func newTestFlags(args ...string) *testFlags {
+	fs := flag.NewFlagSet("supercronic", flag.ContinueOnError)
+	f := &testFlags{
+		fs:        fs,
+		json:      fs.Bool("json", false, ""),
+		logFile:   fs.String("log-file", "", ""),
+		sentryEnv: fs.String("sentryEnv", "", ""),
+		jitter:    fs.Duration("jitter", 0, ""),
+		config:    fs.String("config", "", ""),
+	}
+	fs.Parse(args)
+	return f
+}
+
+func testEnv(env map[string]string) func(string) string {
+	return func(name string) string { return env[name] }
+}
+
+func writeTestConfig(t *testing.T, contents string) (string, func()) {
+	dir, err := ioutil.TempDir("", "supercronic-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestFlagEnv(t *testing.T) {
+	assert.Equal(t, "SUPERCRONIC_JSON", FlagEnv("json"))
+	assert.Equal(t, "SUPERCRONIC_LOG_FILE_MAX_SIZE", FlagEnv("log-file-max-size"))
+	assert.Equal(t, "SUPERCRONIC_SENTRY_ENV", FlagEnv("sentryEnv"))
+}
+
+func TestResolvePrecedence(t *testing.T) {
+	path, cleanup := writeTestConfig(t, `
+flags:
+  json: true
+  log-file: /var/log/from-config.log
+  jitter: 1m
+smtp:
+  host: smtp.example.com
+  port: 25
+`)
+	defer cleanup()
+
+	f := newTestFlags("-log-file", "/var/log/from-flag.log")
+
+	cfg, err := Resolve(f.fs, testEnv(map[string]string{
+		"SUPERCRONIC_CONFIG":     path,
+		"SUPERCRONIC_LOG_FILE":   "/var/log/from-env.log",
+		"SUPERCRONIC_JITTER":     "30s",
+		"SUPERCRONIC_SENTRY_ENV": "staging",
+		"SUPERCRONIC_SMTP_PORT":  "587",
+	}))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Equal(t, path, *f.config)
+	assert.Equal(t, "/var/log/from-flag.log", *f.logFile)
+	assert.Equal(t, 30*time.Second, *f.jitter)
+	assert.True(t, *f.json)
+	assert.Equal(t, "staging", *f.sentryEnv)
+
+	if assert.NotNil(t, cfg.SMTP) {
+		assert.Equal(t, "smtp.example.com", cfg.SMTP.Host)
+		assert.Equal(t, 587, cfg.SMTP.Port)
+	}
+}
+
+func TestResolveCreatesSectionsFromEnv(t *testing.T) {
+	cfg, err := Resolve(newTestFlags().fs, testEnv(map[string]string{
+		"SUPERCRONIC_LEADER_ELECTION_LEASE":          "supercronic",
+		"SUPERCRONIC_LEADER_ELECTION_LEASE_DURATION": "30s",
+		"SUPERCRONIC_EMAIL_ALERTS_TO":                "ops@example.com, dev@example.com",
+		"SUPERCRONIC_ON_JOB_FAILURE":                 "/scripts/record-run.sh",
+	}))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	if assert.NotNil(t, cfg.LeaderElection) {
+		assert.Equal(t, "supercronic", cfg.LeaderElection.Lease)
+		assert.Equal(t, 30*time.Second, cfg.LeaderElection.LeaseDuration)
+	}
+
+	if assert.NotNil(t, cfg.EmailAlerts) {
+		assert.Equal(t, []string{"ops@example.com", "dev@example.com"}, cfg.EmailAlerts.To)
+	}
+
+	assert.Equal(t, "/scripts/record-run.sh", cfg.Callbacks.OnJobFailure)
+	assert.Nil(t, cfg.SMTP)
+	assert.Nil(t, cfg.Notify)
+}
+
+func TestResolveErrors(t *testing.T) {
+	path, cleanup := writeTestConfig(t, "flags: {color: blue}\n")
+	defer cleanup()
+
+	for _, env := range []map[string]string{
+		{"SUPERCRONIC_JSON": "maybe"},
+		{"SUPERCRONIC_SMTP_PORT": "twenty-five"},
+		{"SUPERCRONIC_PUSHGATEWAY_LABELS": "team=billing"},
+		{"SUPERCRONIC_CONFIG": "/nonexistent/config.yaml"},
+		{"SUPERCRONIC_CONFIG": path},
+	} {
+		_, err := Resolve(newTestFlags().fs, testEnv(env))
+		assert.NotNil(t, err, "%v", env)
+	}
+}
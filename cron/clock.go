@@ -0,0 +1,18 @@
+package cron
+
+import "time"
+
+var (
+	// CLOCK_CHECK_INTERVAL is how long the scheduler waits at most before
+	// checking the wall clock again, and CLOCK_JUMP_THRESHOLD how far it
+	// must have drifted from the monotonic clock in the meantime to count as
+	// a jump.
+	CLOCK_CHECK_INTERVAL = 10 * time.Second
+	CLOCK_JUMP_THRESHOLD = 5 * time.Second
+)
+
+// wallClockNow returns the wall clock time, without a monotonic clock reading,
+// so that comparisons to it use the wall clock.
+func wallClockNow() time.Time {
+	return time.Now().Round(0)
+}
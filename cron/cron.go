@@ -1,112 +1,345 @@
 package cron
 
 import (
-	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"io"
 	"os"
 	"os/exec"
+	"regexp"
 	"strings"
 	"supercronic/crontab"
+	"supercronic/docker"
+	"supercronic/exechelper"
+	"supercronic/kubejob"
+	"supercronic/logfile"
+	"supercronic/platform"
 	"sync"
 	"syscall"
 	"time"
 )
 
 var (
+	// READ_BUFFER_SIZE is how much of a line of output is read at once.
+	// Longer lines are handled per Options.LongLines.
 	READ_BUFFER_SIZE = 64 * 1024
+
+	// KILL_GRACE_PERIOD is how long a job has to exit after being sent
+	// SIGTERM before it gets SIGKILL'ed.
+	KILL_GRACE_PERIOD = 10 * time.Second
+
+	// MAX_CATCH_UP_RUNS is how many missed runs the run-all catch-up policy
+	// runs at most. The most recent ones are kept.
+	MAX_CATCH_UP_RUNS = 100
 )
 
-func startReaderDrain(wg *sync.WaitGroup, readerLogger *logrus.Entry, reader io.ReadCloser) {
-	wg.Add(1)
+// outputFiles are the files a job's output is copied to. Any of them may be
+// nil.
+type outputFiles struct {
+	// log gets both streams.
+	log io.Writer
+	// stdout and stderr get one stream each, as is.
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// startKillWatcher signals the process group pgid (i.e. the job and the
+// processes it started) once ctx is done, until all of them have exited:
+// SIGTERM first, then SIGKILL for those that didn't exit within
+// KILL_GRACE_PERIOD. exited is closed once the job itself has been waited for.
+func startKillWatcher(ctx context.Context, exited <-chan struct{}, pgid int, jobLogger *logrus.Entry) <-chan struct{} {
+	done := make(chan struct{})
 
 	go func() {
-		defer func() {
-			if err := reader.Close(); err != nil {
-				readerLogger.Errorf("failed to close pipe: %v", err)
-			}
-			wg.Done()
-		}()
+		defer close(done)
 
-		bufReader := bufio.NewReaderSize(reader, READ_BUFFER_SIZE)
+		select {
+		case <-exited:
+			return
+		case <-ctx.Done():
+		}
 
-		for {
-			line, isPrefix, err := bufReader.ReadLine()
+		if ctx.Err() == context.DeadlineExceeded {
+			jobLogger.Warn("job timed out, sending SIGTERM")
+		} else {
+			jobLogger.Warn("job aborted, sending SIGTERM")
+		}
 
-			if err != nil {
-				if strings.Contains(err.Error(), os.ErrClosed.Error()) {
-					// The underlying reader might get
-					// closed by e.g. Wait(), or even the
-					// process we're starting, so we don't
-					// log this.
-				} else if err == io.EOF {
-					// EOF, we don't need to log this
-				} else {
-					// Unexpected error: log it
-					readerLogger.Errorf("failed to read pipe: %v", err)
-				}
+		if err := platform.SignalProcessGroup(pgid, syscall.SIGTERM); err != nil {
+			jobLogger.Debugf("failed to send SIGTERM: %v", err)
+		}
 
-				break
-			}
+		if waitForProcessGroup(exited, pgid, KILL_GRACE_PERIOD) {
+			return
+		}
 
-			readerLogger.Info(string(line))
+		jobLogger.Warnf("job did not exit within %v, sending SIGKILL", KILL_GRACE_PERIOD)
 
-			if isPrefix {
-				readerLogger.Warn("last line exceeded buffer size, continuing...")
-			}
+		if err := platform.SignalProcessGroup(pgid, syscall.SIGKILL); err != nil {
+			jobLogger.Debugf("failed to send SIGKILL: %v", err)
+		}
+
+		if !waitForProcessGroup(exited, pgid, KILL_GRACE_PERIOD) {
+			jobLogger.Errorf("processes started by the job are still running %v after SIGKILL (process group %d)", KILL_GRACE_PERIOD, pgid)
 		}
 	}()
+
+	return done
 }
 
-func runJob(cronCtx *crontab.Context, command string, jobLogger *logrus.Entry) error {
-	jobLogger.Info("starting")
+// waitForProcessGroup waits for the job to exit, and then for the rest of its
+// process group (e.g. processes started in the background by a shell). It
+// reports whether they all exited within timeout.
+func waitForProcessGroup(exited <-chan struct{}, pgid int, timeout time.Duration) bool {
+	deadline := time.After(timeout)
 
-	cmd := exec.Command(cronCtx.Shell, "-c", command)
+	select {
+	case <-exited:
+	case <-deadline:
+		return false
+	}
 
-	// Run in a separate process group so that in interactive usage, CTRL+C
-	// stops supercronic, not the children threads.
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	// Until the job has been waited for, it keeps its process group alive,
+	// so the group can only be checked from then on.
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
 
-	env := os.Environ()
+	for platform.ProcessGroupRunning(pgid) {
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return false
+		}
+	}
+
+	return true
+}
+
+// jobRun holds what runJob needs to run a job once.
+type jobRun struct {
+	cronCtx *crontab.Context
+	job     *crontab.Job
+	logger  *logrus.Entry
+
+	// env holds variables that describe the run, on top of the job's
+	// environment.
+	env []string
+
+	// execution is the run the job runs as part of, if known. Its output
+	// is recorded.
+	execution *Execution
+
+	// files, if set, are where the job's output is copied to.
+	files *outputFiles
+}
+
+// runJob runs run.job once.
+func runJob(ctx context.Context, run *jobRun, options Options) (int, error) {
+	cronCtx, job, jobLogger, execution, files := run.cronCtx, run.job, run.logger, run.execution, run.files
+
+	var output *Output
+	if execution != nil {
+		output = execution.Output
+	}
+
+	if options.QuietSuccess {
+		jobLogger.Debug("starting")
+	} else {
+		jobLogger.Info("starting")
+	}
+
+	if job.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, job.Timeout)
+		defer cancel()
+	}
+
+	argv := []string{cronCtx.Shell, "-c", job.Command}
+
+	mode := options.Exec
+	if job.Exec != "" {
+		mode = job.Exec
+	}
+
+	if mode == crontab.ExecDirect {
+		words, err := crontab.SplitCommand(job.Command)
+		if err != nil {
+			return -1, err
+		}
+		argv = words
+	}
+
+	var env []string
 	for k, v := range cronCtx.Environ {
 		env = append(env, fmt.Sprintf("%s=%s", k, v))
 	}
-	cmd.Env = env
+	for k, v := range job.Env {
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	// Env files are read on every run, so that e.g. rotated secrets are
+	// picked up.
+	for _, path := range job.EnvFiles {
+		fileEnv, err := crontab.ReadEnvFile(path)
+		if err != nil {
+			return -1, fmt.Errorf("failed to read env file: %v", err)
+		}
+
+		for k, v := range fileEnv {
+			env = append(env, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+
+	// Secrets are resolved on every run too, and never logged.
+	for _, secret := range job.Secrets {
+		if options.Secrets == nil {
+			return -1, fmt.Errorf("failed to resolve secret %s: no secrets provider", secret.Name)
+		}
+
+		value, err := options.Secrets.Resolve(secret)
+		if err != nil {
+			return -1, fmt.Errorf("failed to resolve secret %s: %v", secret.Name, err)
+		}
+
+		env = append(env, secret.Name+"="+value)
+	}
+	env = append(env, run.env...)
+
+	var cmd *exec.Cmd
+
+	if job.Container != nil {
+		// The container only gets the job's variables, so the docker CLI
+		// gets all of supercronic's (e.g. DOCKER_HOST).
+		argv = docker.Command(job.Container, argv, env, job.Dir, job.Limits, job.Stdin != nil)
+		cmd = exec.Command(argv[0], argv[1:]...)
+		cmd.Env = append(ProcessEnviron(false), env...)
+	} else if job.KubernetesJob != nil {
+		c, err := kubejob.Command(job.KubernetesJob, job.Name, argv, env, job.Dir, job.Timeout)
+		if err != nil {
+			return -1, err
+		}
+
+		// Likewise, the pod only gets the job's variables.
+		cmd = c
+		cmd.Env = append(ProcessEnviron(false), env...)
+	} else {
+		if job.Limits != nil || job.Priority != nil || job.Umask != nil {
+			c, cleanup, err := exechelper.Command(argv, job.Limits, job.Priority, job.Umask, options.CgroupParent)
+			if err != nil {
+				return -1, err
+			}
+
+			defer func() {
+				if err := cleanup(); err != nil {
+					jobLogger.Warnf("failed to clean up after job: %v", err)
+				}
+			}()
+
+			cmd = c
+		} else {
+			cmd = exec.Command(argv[0], argv[1:]...)
+		}
+
+		cmd.Env = append(ProcessEnviron(options.CleanEnv), env...)
+		cmd.Dir = job.Dir
+	}
+
+	// Run in a separate process group so that in interactive usage, CTRL+C
+	// stops supercronic, not the children threads.
+	platform.SetProcessGroup(cmd)
+
+	if job.Stdin != nil {
+		if job.Stdin.Path != "" {
+			// The file is opened on every run, so that it can change
+			// between runs.
+			file, err := os.Open(job.Stdin.Path)
+			if err != nil {
+				return -1, fmt.Errorf("failed to open stdin: %v", err)
+			}
+			defer file.Close()
+			cmd.Stdin = file
+		} else {
+			cmd.Stdin = strings.NewReader(job.Stdin.Data)
+		}
+	}
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return err
+		return -1, err
 	}
 
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
-		return err
+		return -1, err
 	}
 
 	if err := cmd.Start(); err != nil {
-		return err
+		return -1, err
+	}
+
+	// The job runs in its own process group, whose ID is its PID.
+	execution.setProcessGroup(cmd.Process.Pid)
+
+	exited := make(chan struct{})
+	watcherDone := startKillWatcher(ctx, exited, cmd.Process.Pid, jobLogger)
+
+	throttle := newOutputThrottle(job.Throttle, jobLogger)
+
+	levels := newOutputLevels(job, options)
+
+	format := outputFormat(job, options)
+
+	logLine := func(readerLogger *logrus.Entry, channel string, line string) {
+		if !options.QuietSuccess && throttle.Allow(line) {
+			logOutputLine(readerLogger, format, levels.level(channel, line), line)
+		}
 	}
 
-	var wg sync.WaitGroup
+	var stdoutPassthrough, stderrPassthrough io.Writer
+	if format == crontab.OutputRaw {
+		stdoutPassthrough = passthroughWriter("stdout")
+		stderrPassthrough = passthroughWriter("stderr")
+	}
+
+	if files == nil {
+		files = &outputFiles{}
+	}
+
+	writer := startOutputWriter(output, files.log, logLine)
 
 	stdoutLogger := jobLogger.WithFields(logrus.Fields{"channel": "stdout"})
-	startReaderDrain(&wg, stdoutLogger, stdout)
+	writer.drain(stdoutLogger, stdout, "stdout", files.stdout, stdoutPassthrough, newLineAssembler(options.LongLines, options.MaxLineSize))
 
 	stderrLogger := jobLogger.WithFields(logrus.Fields{"channel": "stderr"})
-	startReaderDrain(&wg, stderrLogger, stderr)
+	writer.drain(stderrLogger, stderr, "stderr", files.stderr, stderrPassthrough, newLineAssembler(options.LongLines, options.MaxLineSize))
+
+	writer.Wait()
+	throttle.Close()
+
+	err = cmd.Wait()
+	execution.setProcessGroup(0)
+
+	close(exited)
+	<-watcherDone
 
-	wg.Wait()
+	exitCode := platform.ExitCode(cmd.ProcessState)
 
-	if err := cmd.Wait(); err != nil {
-		return fmt.Errorf("error running command: %v", err)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return exitCode, fmt.Errorf("job timed out after %v: %v", job.Timeout, err)
+		}
+		if ctx.Err() == context.Canceled {
+			return exitCode, fmt.Errorf("job aborted: %v", err)
+		}
+		return exitCode, fmt.Errorf("error running command: %v", err)
 	}
 
-	return nil
+	return exitCode, nil
 }
 
-func monitorJob(ctx context.Context, expression crontab.Expression, t0 time.Time, jobLogger *logrus.Entry, overlapping bool) {
+func monitorJob(ctx context.Context, expression crontab.Expression, t0 time.Time, jobLogger *logrus.Entry, policy crontab.OverlapPolicy, replaceRun func()) {
 	t := t0
 
 	for {
@@ -115,88 +348,964 @@ func monitorJob(ctx context.Context, expression crontab.Expression, t0 time.Time
 		select {
 		case <-time.After(time.Until(t)):
 			m := "not starting"
-			if overlapping {
+			switch policy {
+			case crontab.OverlapAllow:
 				m = "overlapping jobs"
+			case crontab.OverlapQueue:
+				m = "queueing next run"
+			case crontab.OverlapReplace:
+				m = "replacing job"
 			}
 
 			jobLogger.Warnf("%s: job is still running since %s (%s elapsed)", m, t0, t.Sub(t0))
+
+			if policy == crontab.OverlapReplace {
+				replaceRun()
+			}
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-func startFunc(wg *sync.WaitGroup, exitCtx context.Context, logger *logrus.Entry, overlapping bool, expression crontab.Expression, fn func(time.Time, *logrus.Entry)) {
+// watchExpectedDuration warns when e runs for longer than its job's expected
+// duration, until ctx is done.
+func watchExpectedDuration(ctx context.Context, e *Execution, hooks []Hook) {
+	expected := e.Job.ExpectedDuration
+	if expected <= 0 {
+		return
+	}
+
+	select {
+	case <-time.After(expected):
+	case <-ctx.Done():
+		return
+	}
+
+	e.Logger.Warnf("job has been running for longer than expected (%v)", expected)
+
+	for _, hook := range hooks {
+		if h, ok := hook.(OverrunHook); ok {
+			h.JobOverran(e)
+		}
+	}
+}
+
+// outputLevels determines the level lines of a job's output are logged at.
+type outputLevels struct {
+	stderr  crontab.OutputLevel
+	error   *regexp.Regexp
+	warning *regexp.Regexp
+}
+
+func newOutputLevels(job *crontab.Job, options Options) *outputLevels {
+	levels := &outputLevels{
+		stderr:  options.StderrLevel,
+		error:   options.ErrorPattern,
+		warning: options.WarningPattern,
+	}
+
+	if job.StderrLevel != "" {
+		levels.stderr = job.StderrLevel
+	}
+
+	if job.ErrorPattern != nil {
+		levels.error = job.ErrorPattern
+	}
+
+	if job.WarningPattern != nil {
+		levels.warning = job.WarningPattern
+	}
+
+	return levels
+}
+
+// level returns the level of line, which was written to channel. Lines that
+// match a pattern get its level, whichever channel they were written to.
+func (l *outputLevels) level(channel string, line string) crontab.OutputLevel {
+	switch {
+	case l.error != nil && l.error.MatchString(line):
+		return crontab.OutputLevelError
+	case l.warning != nil && l.warning.MatchString(line):
+		return crontab.OutputLevelWarning
+	case channel == "stderr" && l.stderr != "":
+		return l.stderr
+	}
+
+	return crontab.OutputLevelInfo
+}
+
+// logAtLevel logs message at level.
+func logAtLevel(entry *logrus.Entry, level crontab.OutputLevel, message string) {
+	switch level {
+	case crontab.OutputLevelError:
+		entry.Error(message)
+	case crontab.OutputLevelWarning:
+		entry.Warn(message)
+	default:
+		entry.Info(message)
+	}
+}
+
+// logOutputLine logs a line of output at level. Per format, lines that are
+// JSON objects have their fields merged into the log entry, except for msg or
+// message, which becomes the entry's message. Fields that supercronic sets
+// (e.g. job.command) are left alone.
+func logOutputLine(readerLogger *logrus.Entry, format crontab.OutputFormat, level crontab.OutputLevel, line string) {
+	if format == crontab.OutputJSON {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &fields); err == nil && fields != nil {
+			message := ""
+			for _, key := range []string{"msg", "message"} {
+				if m, ok := fields[key].(string); ok {
+					message = m
+					delete(fields, key)
+					break
+				}
+			}
+
+			for key := range readerLogger.Data {
+				delete(fields, key)
+			}
+
+			logAtLevel(readerLogger.WithFields(logrus.Fields(fields)), level, message)
+			return
+		}
+	}
+
+	logAtLevel(readerLogger, level, line)
+}
+
+// outputFormat returns the format of job's output, which is its own if it
+// sets one.
+func outputFormat(job *crontab.Job, options Options) crontab.OutputFormat {
+	if job.Output != "" {
+		return job.Output
+	}
+	return options.Output
+}
+
+// replayOutput logs output that wasn't logged as the job wrote it.
+func replayOutput(jobLogger *logrus.Entry, format crontab.OutputFormat, levels *outputLevels, output *Output) {
+	if output.Truncated() {
+		jobLogger.Warnf("job output exceeded %d bytes, only the last lines were kept", MAX_CAPTURED_OUTPUT)
+	}
+
+	for _, line := range output.Lines() {
+		logOutputLine(jobLogger.WithFields(logrus.Fields{"channel": line.Channel}), format, levels.level(line.Channel, line.Text), line.Text)
+	}
+}
+
+// classifyExit applies job's exit code classes to the outcome of a run that
+// exited with exitCode. Runs that exited with a code the job treats as
+// success or skipped didn't fail. Runs that were aborted (e.g. timed out)
+// are failures, whatever their exit code.
+func classifyExit(runCtx context.Context, job *crontab.Job, exitCode int, err error) (crontab.ExitCodeClass, error) {
+	if err == nil || exitCode <= 0 || runCtx.Err() != nil {
+		return "", err
+	}
+
+	class := job.ExitCodes[exitCode]
+	if class == crontab.ExitCodeSuccess || class == crontab.ExitCodeSkipped {
+		return class, nil
+	}
+
+	return class, err
+}
+
+// isRetryable reports whether a failed run, of the given class, may be
+// retried. If the job classifies some exit codes as retryable, only those
+// are.
+func isRetryable(job *crontab.Job, class crontab.ExitCodeClass) bool {
+	for _, c := range job.ExitCodes {
+		if c == crontab.ExitCodeRetryable {
+			return class == crontab.ExitCodeRetryable
+		}
+	}
+
+	return true
+}
+
+// missedRuns returns the times expression should have run at after since and
+// up to now. At most limit runs are returned, keeping the most recent ones.
+func missedRuns(expression crontab.Expression, since time.Time, now time.Time, limit int) []time.Time {
+	missed := make([]time.Time, 0)
+
+	for t := expression.Next(since); !t.IsZero() && !t.After(now); t = expression.Next(t) {
+		missed = append(missed, t)
+		if len(missed) > limit {
+			missed = missed[1:]
+		}
+	}
+
+	return missed
+}
+
+// NextRuns returns the next n times expression will run at after t. Fewer
+// are returned if expression doesn't have that many runs left.
+func NextRuns(expression crontab.Expression, t time.Time, n int) []time.Time {
+	runs := make([]time.Time, 0, n)
+
+	for len(runs) < n {
+		t = expression.Next(t)
+		if t.IsZero() {
+			break
+		}
+		runs = append(runs, t)
+	}
+
+	return runs
+}
+
+// waitForPrevious applies the overlap policy to a run of the job that was
+// started before the crontab was reloaded, and returns whether this run should
+// go ahead.
+func waitForPrevious(exitCtx context.Context, previous *JobState, policy crontab.OverlapPolicy, jobLogger *logrus.Entry) bool {
+	if previous == nil || policy == crontab.OverlapAllow || !previous.isRunning() {
+		return true
+	}
+
+	switch policy {
+	case crontab.OverlapQueue:
+		jobLogger.Info("waiting for the run started before the reload to finish")
+	case crontab.OverlapReplace:
+		jobLogger.Warn("terminating the run started before the reload")
+		previous.Abort()
+	default:
+		jobLogger.Warn("the run started before the reload is still running, skipping run")
+		return false
+	}
+
+	if err := previous.waitIdle(exitCtx); err != nil {
+		jobLogger.Info("shutting down, not starting run that was waiting for the previous one")
+		return false
+	}
+
+	return true
+}
+
+// startFunc schedules fn per expression until exitCtx is done, starting with
+// the runs in catchUp (and a run at startup, if runAtStartup and there are
+// none). Unless policy is OverlapAllow, runs of fn never overlap.
+func startFunc(wg *sync.WaitGroup, exitCtx context.Context, logger *logrus.Entry, state *JobState, policy crontab.OverlapPolicy, jitter time.Duration, expression crontab.Expression, catchUp []time.Time, runAtStartup bool, fn func(time.Time, uint64, *logrus.Entry)) {
+	scheduleFunc(sharedScheduler(), wg, exitCtx, logger, state, policy, jitter, expression, catchUp, runAtStartup, fn)
+}
+
+// scheduleFunc is startFunc, on scheduler s.
+func scheduleFunc(s *scheduler, wg *sync.WaitGroup, exitCtx context.Context, logger *logrus.Entry, state *JobState, policy crontab.OverlapPolicy, jitter time.Duration, expression crontab.Expression, catchUp []time.Time, runAtStartup bool, fn func(time.Time, uint64, *logrus.Entry)) {
+	wg.Add(1)
+
+	j := &scheduledJob{
+		scheduler:  s,
+		wg:         wg,
+		exitCtx:    exitCtx,
+		logger:     logger,
+		state:      state,
+		policy:     policy,
+		jitter:     jitter,
+		expression: expression,
+		fn:         fn,
+		fromEnd:    crontab.IsFromEnd(expression),
+		nextRun:    s.now(),
+		advance:    true,
+		delayed:    make(map[*timerEntry]*logrus.Entry),
+		busy:       true,
+	}
+
+	// A trigger that came in before the job was scheduled (e.g. during
+	// its startup delay) runs it once it is.
+	select {
+	case <-state.trigger:
+		j.triggered = true
+	default:
+	}
+	state.setTriggerHandler(j.trigger)
+
+	j.runs.Add(1)
+	j.scheduler.dispatch(func() {
+		defer j.runs.Done()
+
+		if j.catchUp(catchUp, runAtStartup) {
+			j.finished(0)
+		}
+	})
+
+	j.scheduler.onDone(exitCtx, j.stop)
+}
+
+// scheduledJob is a job scheduled by startFunc. It holds no goroutine while
+// it waits for its next run: its scheduler calls due when the run is due.
+type scheduledJob struct {
+	scheduler  *scheduler
+	wg         *sync.WaitGroup
+	exitCtx    context.Context
+	logger     *logrus.Entry
+	state      *JobState
+	policy     crontab.OverlapPolicy
+	jitter     time.Duration
+	expression crontab.Expression
+	fn         func(time.Time, uint64, *logrus.Entry)
+
+	// Intervals measured from the end of the previous run start counting
+	// once it is done, so runs never overlap.
+	fromEnd bool
+
+	// runs tracks the runs that were started, including those waiting out
+	// their jitter.
+	runs sync.WaitGroup
+
+	mu        sync.Mutex
+	iteration uint64
+	nextRun   time.Time
+	advance   bool
+
+	// The jitter that delayed the last run we waited for. Time spent
+	// waiting doesn't count towards the job taking too long.
+	lastJitter time.Duration
+
+	// next is the entry for nextRun while the job waits for it, and delayed
+	// the entries of runs waiting out their jitter (with their loggers).
+	next    *timerEntry
+	delayed map[*timerEntry]*logrus.Entry
+
+	// busy is set while a run (or catching up) is going, and the next run is
+	// only planned once it is done. Triggers that come in meanwhile set
+	// triggered.
+	busy      bool
+	triggered bool
+	stopped   bool
+}
+
+// catchUp runs fn for the runs in catchUp, or at startup. It returns false if
+// shutting down.
+func (j *scheduledJob) catchUp(catchUp []time.Time, runAtStartup bool) bool {
+	for _, t0 := range catchUp {
+		if j.exitCtx.Err() != nil {
+			return false
+		}
+
+		if j.state.doneAlready(j.expression, t0) {
+			j.logger.Infof("not catching up on run missed at %v: job already succeeded at %v", t0, j.state.lastSuccess)
+			continue
+		}
+
+		j.logger.Infof("catching up on run missed at %v", t0)
+
+		j.fn(t0, j.iteration, j.logger.WithFields(logrus.Fields{
+			"iteration": j.iteration,
+		}))
+
+		j.iteration++
+	}
+
+	// Runs we just caught up on are as fresh as a run at startup.
+	if runAtStartup && len(catchUp) == 0 && j.state.doneAlready(j.expression, j.scheduler.now()) {
+		j.logger.Infof("not running job at startup: job already succeeded at %v", j.state.lastSuccess)
+	} else if runAtStartup && len(catchUp) == 0 {
+		if j.exitCtx.Err() != nil {
+			return false
+		}
+
+		j.logger.Info("running job at startup")
+
+		j.fn(j.scheduler.now(), j.iteration, j.logger.WithFields(logrus.Fields{
+			"iteration": j.iteration,
+		}))
+
+		if j.fromEnd {
+			j.nextRun = j.scheduler.now()
+		}
+
+		j.iteration++
+	}
+
+	return true
+}
+
+// plan works out when the job runs next, and waits for then. j.mu must be
+// held.
+//
+// NOTE: unless the policy is OverlapAllow, this does not run multiple
+// instances of the job concurrently
+func (j *scheduledJob) plan() {
+	if j.stopped {
+		return
+	}
+
+	for {
+		if j.advance {
+			j.nextRun = j.expression.Next(j.nextRun)
+			j.logger.Debugf("job will run next at %v", j.nextRun)
+		}
+		j.advance = true
+
+		delay := j.nextRun.Sub(j.scheduler.now())
+		if delay >= 0 {
+			break
+		}
+
+		if late := -delay - j.lastJitter; late > 0 {
+			j.logger.Warningf("job took too long to run: it should have started %v ago", late)
+		}
+
+		if j.policy != crontab.OverlapQueue && j.policy != crontab.OverlapReplace {
+			j.nextRun = j.scheduler.now()
+			continue
+		}
+
+		if j.exitCtx.Err() != nil {
+			return
+		}
+
+		// Start the most recent run that was due right away: only one
+		// run is ever queued.
+		now := j.scheduler.now()
+		for t := j.expression.Next(j.nextRun); !t.IsZero() && !t.After(now); t = j.expression.Next(t) {
+			j.nextRun = t
+		}
+		break
+	}
+
+	j.lastJitter = 0
+	j.state.setNextRun(j.nextRun)
+
+	if j.triggered {
+		j.triggered = false
+		j.runManually()
+		return
+	}
+
+	var next *timerEntry
+	next = j.scheduler.add(j.nextRun, j.logger, func(jump time.Duration) {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+
+		if !j.stopped && j.next == next {
+			j.next = nil
+			j.due(jump)
+		}
+	})
+	j.next = next
+}
+
+// due is called once nextRun is due, or the wall clock jumped past it. j.mu
+// must be held.
+func (j *scheduledJob) due(jump time.Duration) {
+	if jump > 0 {
+		// Runs that were due in the meantime were missed rather than
+		// late: don't run them in a burst.
+		j.logger.Warnf("clock jumped forward by %v (e.g. the system was suspended), skipping runs missed in the meantime", jump)
+		j.nextRun = j.scheduler.now()
+		j.plan()
+		return
+	}
+
+	if j.state.IsPaused() {
+		j.logger.Info("job is paused, skipping scheduled run")
+		j.plan()
+		return
+	}
+
+	if j.state.IsTripped() {
+		j.logger.Info("job's circuit breaker is tripped, skipping scheduled run")
+		j.plan()
+		return
+	}
+
+	if j.state.doneAlready(j.expression, j.nextRun) {
+		j.logger.Infof("skipping scheduled run: job already succeeded at %v", j.state.lastSuccess)
+		j.plan()
+		return
+	}
+
+	j.start(j.nextRun, randomJitter(j.jitter))
+}
+
+// trigger is the JobState's trigger handler.
+func (j *scheduledJob) trigger() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.stopped {
+		return
+	}
+
+	if j.busy || j.next == nil {
+		j.triggered = true
+		return
+	}
+
+	j.scheduler.remove(j.next)
+	j.next = nil
+	j.runManually()
+}
+
+// runManually starts a triggered run. A manual run does not replace the
+// scheduled one: we'll wait for nextRun again once it's done. j.mu must be
+// held.
+func (j *scheduledJob) runManually() {
+	j.logger.Info("job triggered manually")
+	j.advance = false
+	j.start(j.scheduler.now(), 0)
+}
+
+// start starts a run due at t0 once jitter is over, and plans the next one
+// right away if runs may overlap. j.mu must be held.
+func (j *scheduledJob) start(t0 time.Time, jitter time.Duration) {
+	iteration := j.iteration
+	j.iteration++
+
+	concurrent := j.policy == crontab.OverlapAllow && !j.fromEnd
+	if !concurrent {
+		j.busy = true
+	}
+
+	jobLogger := j.logger.WithFields(logrus.Fields{
+		"iteration": iteration,
+	})
+
+	run := func() {
+		defer j.runs.Done()
+
+		j.fn(t0, iteration, jobLogger)
+
+		if !concurrent {
+			j.finished(jitter)
+		}
+	}
+
+	j.runs.Add(1)
+
+	if jitter > 0 {
+		jobLogger.Infof("delaying run by %v (jitter)", jitter)
+
+		var delayed *timerEntry
+		delayed = j.scheduler.add(j.scheduler.now().Add(jitter), nil, func(time.Duration) {
+			j.mu.Lock()
+			_, ok := j.delayed[delayed]
+			delete(j.delayed, delayed)
+			j.mu.Unlock()
+
+			if ok {
+				j.scheduler.dispatch(run)
+			}
+		})
+		j.delayed[delayed] = jobLogger
+	} else {
+		j.scheduler.dispatch(run)
+	}
+
+	if concurrent {
+		j.plan()
+	}
+}
+
+// finished plans the next run once a run that doesn't overlap with others is
+// done, after waiting for jitter.
+func (j *scheduledJob) finished(jitter time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.busy = false
+	j.lastJitter = jitter
+
+	if j.fromEnd {
+		j.nextRun = j.scheduler.now()
+		j.advance = true
+	}
+
+	j.plan()
+}
+
+// stop stops scheduling the job, and releases the WaitGroup passed to
+// startFunc once its runs are done.
+func (j *scheduledJob) stop() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.stopped {
+		return
+	}
+	j.stopped = true
+
+	if j.next != nil {
+		j.scheduler.remove(j.next)
+		j.next = nil
+	}
+
+	for entry, jobLogger := range j.delayed {
+		j.scheduler.remove(entry)
+		delete(j.delayed, entry)
+		jobLogger.Debug("shutting down")
+		j.runs.Done()
+	}
+
+	j.logger.Debug("shutting down")
+
+	go func() {
+		j.runs.Wait()
+		j.wg.Done()
+	}()
+}
+
+// startOnce runs fn a single time, once state is triggered. This lets
+// callers start all of their jobs before any of them looks for the jobs it
+// runs after.
+func startOnce(wg *sync.WaitGroup, exitCtx context.Context, logger *logrus.Entry, state *JobState, fn func(time.Time, uint64, *logrus.Entry)) {
 	wg.Add(1)
 
 	go func() {
 		defer wg.Done()
 
-		var jobWg sync.WaitGroup
-		defer jobWg.Wait()
+		select {
+		case <-exitCtx.Done():
+			logger.Debug("shutting down")
+			return
+		case <-state.trigger:
+		}
+
+		fn(time.Now(), 0, logger.WithFields(logrus.Fields{
+			"iteration": 0,
+		}))
+	}()
+}
+
+type jobFailureKey struct{}
+
+// IsJobFailure reports whether entry is the error StartJob logs when a job
+// fails. This lets log hooks skip failures that a cron.Hook already reports.
+func IsJobFailure(entry *logrus.Entry) bool {
+	return entry.Context != nil && entry.Context.Value(jobFailureKey{}) != nil
+}
+
+// newLogFileWriter returns a writer for f, or nil if f is nil.
+func newLogFileWriter(f *crontab.LogFile) *logfile.Writer {
+	if f == nil {
+		return nil
+	}
+
+	return logfile.New(f.Path, logfile.Options{
+		MaxSize: f.MaxSize,
+		MaxAge:  f.MaxAge,
+		Keep:    f.Keep,
+	})
+}
+
+func closeLogFile(w *logfile.Writer, jobLogger *logrus.Entry) {
+	if err := w.Close(); err != nil {
+		jobLogger.Warnf("failed to close log file: %v", err)
+	}
+}
+
+// StartJob schedules job until exitCtx is cancelled. The returned JobState
+// reflects the job's runtime state, and can be used to control it.
+func StartJob(wg *sync.WaitGroup, cronCtx *crontab.Context, job *crontab.Job, exitCtx context.Context, cronLogger *logrus.Entry, options Options) *JobState {
+	state := newJobState(cronCtx, job)
+	state.lastSuccess = options.LastSuccess
+
+	jobLogFile := newLogFileWriter(job.LogFile)
+	stdoutFile := newLogFileWriter(job.StdoutFile)
+	stderrFile := newLogFileWriter(job.StderrFile)
 
-		var cronIteration uint64
-		nextRun := time.Now()
+	runThisJob := func(t0 time.Time, iteration uint64, jobLogger *logrus.Entry) {
+		since := state.startWindow(t0)
 
-		// NOTE: if overlapping is disabled (default), this does not run multiple
-		// instances of the job concurrently
-		for {
-			nextRun = expression.Next(nextRun)
-			logger.Debugf("job will run next at %v", nextRun)
+		skipped := func(reason string) {
+			if options.RunOnce {
+				state.runSkipped(t0, reason)
+			}
+		}
 
-			delay := nextRun.Sub(time.Now())
-			if delay < 0 {
-				logger.Warningf("job took too long to run: it should have started %v ago", -delay)
-				nextRun = time.Now()
-				continue
+		if !waitForPrevious(exitCtx, options.Previous, options.Overlap, jobLogger) {
+			skipped("previous run is still going")
+			return
+		}
+
+		if len(job.After) > 0 {
+			// Runs that happen once have no next run to give up at.
+			deadline := job.Expression.Next(t0)
+			if options.RunOnce {
+				deadline = time.Time{}
 			}
 
-			select {
-			case <-exitCtx.Done():
-				logger.Debug("shutting down")
+			if err := waitForDependencies(exitCtx, options.Registry, job, since, deadline, jobLogger); err != nil {
+				jobLogger.Warnf("skipping run: %v", err)
+				skipped(err.Error())
 				return
-			case <-time.After(delay):
-				// Proceed normally
 			}
+		}
 
-			jobWg.Add(1)
+		if options.Locker != nil {
+			lock, err := options.Locker.Acquire(job, t0)
+			if err != nil {
+				jobLogger.Errorf("could not acquire job lock, skipping run: %v", err)
+				skipped("could not acquire job lock")
+				return
+			}
 
-			runThisJob := func(cronIteration uint64) {
-				defer jobWg.Done()
+			if lock == nil {
+				jobLogger.Info("job is locked by another replica, skipping run")
+				skipped("job is locked by another replica")
+				return
+			}
 
-				jobLogger := logger.WithFields(logrus.Fields{
-					"iteration": cronIteration,
-				})
+			defer lock.Release()
+		}
 
-				fn(nextRun, jobLogger)
-			}
+		if options.Limiter != nil {
+			state.addWaiting(1)
+			acquired := options.Limiter.Acquire(exitCtx, jobLogger)
+			state.addWaiting(-1)
 
-			if overlapping {
-				go runThisJob(cronIteration)
-			} else {
-				runThisJob(cronIteration)
+			if !acquired {
+				jobLogger.Info("shutting down, not starting run that was waiting for a slot")
+				skipped("shutting down")
+				return
 			}
 
-			cronIteration++
+			defer options.Limiter.Release()
+		}
+
+		execution := &Execution{
+			Job:         job,
+			Context:     cronCtx,
+			Logger:      jobLogger,
+			Iteration:   iteration,
+			ScheduledAt: t0,
+			StartedAt:   time.Now(),
+			Output:      &Output{},
 		}
-	}()
-}
 
-func StartJob(wg *sync.WaitGroup, cronCtx *crontab.Context, job *crontab.Job, exitCtx context.Context, cronLogger *logrus.Entry, overlapping bool) {
-	runThisJob := func(t0 time.Time, jobLogger *logrus.Entry) {
+		runCtx, cancelRun := context.WithCancel(context.Background())
+		defer cancelRun()
+
 		monitorCtx, cancelMonitor := context.WithCancel(context.Background())
 		defer cancelMonitor()
 
-		go monitorJob(monitorCtx, job.Expression, t0, jobLogger, overlapping)
+		replaceRun := func() {
+			// Don't kill jobs on their way out if we're shutting down:
+			// they wouldn't be replaced.
+			if exitCtx.Err() == nil {
+				cancelRun()
+			}
+		}
+
+		daemon := crontab.IsDaemon(job.Expression)
+
+		if !crontab.IsFromEnd(job.Expression) && !options.RunOnce && !daemon {
+			go monitorJob(monitorCtx, job.Expression, t0, jobLogger, options.Overlap, replaceRun)
+		}
+
+		// Jobs that are kept running would never finish on their own: they
+		// are stopped along with the scheduler.
+		if daemon {
+			go func() {
+				select {
+				case <-exitCtx.Done():
+					cancelRun()
+				case <-monitorCtx.Done():
+				}
+			}()
+		}
+
+		state.runStarted(execution, cancelRun)
+
+		for _, hook := range options.Hooks {
+			hook.JobStarted(execution)
+		}
+
+		overrunDone := make(chan struct{})
+		go func() {
+			defer close(overrunDone)
+			watchExpectedDuration(monitorCtx, execution, options.Hooks)
+		}()
+
+		// Don't hold on to the log files between runs, so they can be moved
+		// while the job isn't running.
+		files := &outputFiles{}
+		if jobLogFile != nil {
+			files.log = jobLogFile
+			defer closeLogFile(jobLogFile, jobLogger)
+		}
+		if stdoutFile != nil {
+			files.stdout = stdoutFile
+			defer closeLogFile(stdoutFile, jobLogger)
+		}
+		if stderrFile != nil {
+			files.stderr = stderrFile
+			defer closeLogFile(stderrFile, jobLogger)
+		}
+
+		run := &jobRun{
+			cronCtx:   cronCtx,
+			job:       job,
+			logger:    jobLogger,
+			env:       RunEnviron(execution),
+			execution: execution,
+			files:     files,
+		}
 
-		err := runJob(cronCtx, job.Command, jobLogger)
+		exitCode, err := runJob(runCtx, run, options)
+		class, err := classifyExit(runCtx, job, exitCode, err)
 
-		if err == nil {
-			jobLogger.Info("job succeeded")
+		for attempt := 1; err != nil && attempt <= job.Retries && isRetryable(job, class); attempt++ {
+			// Don't retry runs that were aborted, or when shutting down.
+			if runCtx.Err() != nil || exitCtx.Err() != nil {
+				break
+			}
+
+			jobLogger.Warnf("%v: retrying (%d of %d) in %v", err, attempt, job.Retries, job.RetryDelay)
+
+			select {
+			case <-time.After(job.RetryDelay):
+			case <-runCtx.Done():
+			case <-exitCtx.Done():
+			}
+
+			if runCtx.Err() != nil || exitCtx.Err() != nil {
+				break
+			}
+
+			retry := *run
+			retry.logger = jobLogger.WithField("attempt", attempt+1)
+
+			exitCode, err = runJob(runCtx, &retry, options)
+			class, err = classifyExit(runCtx, job, exitCode, err)
+		}
+
+		// Stopping jobs that are kept running isn't a failure.
+		stopped := daemon && exitCtx.Err() != nil && runCtx.Err() == context.Canceled
+		if stopped {
+			err = nil
+		}
+
+		// Hooks may still be looking at the execution.
+		cancelMonitor()
+		<-overrunDone
+
+		execution.FinishedAt = time.Now()
+		execution.ExitCode = exitCode
+		execution.Err = err
+		execution.Skipped = class == crontab.ExitCodeSkipped
+		execution.Output.Close()
+
+		// The completion line tells where the output was archived.
+		completionLogger := jobLogger
+		if options.Archiver != nil {
+			url, err := options.Archiver.Archive(execution)
+			if err != nil {
+				jobLogger.Warnf("failed to archive output: %v", err)
+			} else {
+				execution.OutputURL = url
+				completionLogger = jobLogger.WithField("output_url", url)
+			}
+		}
+
+		// Output that was passed through was never held back.
+		quiet := options.QuietSuccess && outputFormat(job, options) != crontab.OutputRaw
+
+		if stopped {
+			completionLogger.Info("job stopped")
+		} else if execution.Skipped {
+			completionLogger.Infof("job skipped (exit status %d)", exitCode)
+		} else if err == nil {
+			if quiet {
+				completionLogger.Infof("job succeeded in %v (%d line(s) of output suppressed)", execution.Duration(), execution.Output.Len())
+			} else {
+				completionLogger.Info("job succeeded")
+			}
 		} else {
-			jobLogger.Error(err)
+			if quiet {
+				replayOutput(jobLogger, outputFormat(job, options), newOutputLevels(job, options), execution.Output)
+			}
+			completionLogger.WithContext(context.WithValue(context.Background(), jobFailureKey{}, true)).Error(err)
+		}
+
+		if state.runFinished(execution) {
+			completionLogger.WithField("consecutive_failures", job.MaxConsecutiveFailures).Errorf(
+				"job failed %d times in a row, no longer scheduling it until its circuit breaker is reset (or the crontab is reloaded)",
+				job.MaxConsecutiveFailures,
+			)
+		}
+		execution.Tripped = state.IsTripped()
+
+		for _, hook := range options.Hooks {
+			hook.JobFinished(execution)
+		}
+	}
+
+	schedule := func() {
+		if crontab.IsDaemon(job.Expression) {
+			startDaemon(wg, exitCtx, cronLogger, state, job.Restart, runThisJob)
+			return
+		}
+
+		if options.RunOnce {
+			startOnce(wg, exitCtx, cronLogger, state, runThisJob)
+			return
+		}
+
+		jitter := options.Jitter
+		if job.Jitter > 0 {
+			jitter = job.Jitter
 		}
+
+		var catchUp []time.Time
+
+		if !options.LastRun.IsZero() && options.CatchUp != crontab.CatchUpSkip && options.CatchUp != "" {
+			missed := missedRuns(job.Expression, options.LastRun, time.Now(), MAX_CATCH_UP_RUNS)
+
+			if len(missed) > 0 {
+				cronLogger.Infof("missed %d run(s) since %v (catch-up policy: %s)", len(missed), options.LastRun, options.CatchUp)
+			}
+
+			if options.CatchUp == crontab.CatchUpRunOnce && len(missed) > 0 {
+				missed = missed[len(missed)-1:]
+			}
+
+			catchUp = missed
+		}
+
+		startFunc(wg, exitCtx, cronLogger, state, options.Overlap, jitter, job.Expression, catchUp, options.RunAtStartup, runThisJob)
+	}
+
+	delay := startupDelay(job, options)
+	if delay <= 0 {
+		schedule()
+		return state
+	}
+
+	// Scheduling starts once the delay is over, so runs due in the meantime
+	// are missed (and only caught up on per the catch-up policy).
+	cronLogger.Infof("waiting %v before scheduling job (startup delay)", delay)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		select {
+		case <-time.After(delay):
+			schedule()
+		case <-exitCtx.Done():
+			cronLogger.Debug("shutting down")
+		}
+	}()
+
+	return state
+}
+
+// startupDelay returns how much longer job must wait before it is scheduled,
+// per its startup delay (or the global one), counted from when supercronic
+// started.
+func startupDelay(job *crontab.Job, options Options) time.Duration {
+	delay := options.StartupDelay
+	if job.StartupDelay > 0 {
+		delay = job.StartupDelay
+	}
+
+	if delay <= 0 || options.StartedAt.IsZero() {
+		return delay
 	}
 
-	startFunc(wg, exitCtx, cronLogger, overlapping, job.Expression, runThisJob)
+	return options.StartedAt.Add(delay).Sub(time.Now())
 }
@@ -1,12 +1,16 @@
 package cron
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -14,6 +18,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"supercronic/crontab"
+	"supercronic/docker"
 )
 
 var (
@@ -147,7 +152,9 @@ func TestRunJob(t *testing.T) {
 		label := fmt.Sprintf("RunJob(%q)", tt.command)
 		logger, channel := newTestLogger()
 
-		err := runJob(tt.context, tt.command, logger)
+		job := &crontab.Job{CrontabLine: crontab.CrontabLine{Command: tt.command}}
+
+		_, err := runJob(context.Background(), &jobRun{cronCtx: tt.context, job: job, logger: logger}, Options{})
 		if tt.success {
 			assert.Nil(t, err, label)
 		} else {
@@ -176,6 +183,82 @@ func TestRunJob(t *testing.T) {
 	}
 }
 
+func TestRunJobTimeout(t *testing.T) {
+	logger, channel := newTestLogger()
+
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{Command: "sleep 10"},
+		Timeout:     100 * time.Millisecond,
+	}
+
+	t0 := time.Now()
+	_, err := runJob(context.Background(), &jobRun{cronCtx: &basicContext, job: job, logger: logger}, Options{})
+
+	if assert.NotNil(t, err) {
+		assert.Regexp(t, regexp.MustCompile("timed out after 100ms"), err.Error())
+	}
+	assert.True(t, time.Since(t0) < 5*time.Second)
+
+	<-channel // starting
+	entry := <-channel
+	assert.Equal(t, "job timed out, sending SIGTERM", entry.Message)
+	assert.Equal(t, logrus.WarnLevel, entry.Level)
+}
+
+func TestRunJobTimeoutKillsStubbornJobs(t *testing.T) {
+	defer func(grace time.Duration) { KILL_GRACE_PERIOD = grace }(KILL_GRACE_PERIOD)
+	KILL_GRACE_PERIOD = 100 * time.Millisecond
+
+	logger, channel := newTestLogger()
+
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{Command: "trap '' TERM; sleep 10"},
+		Timeout:     100 * time.Millisecond,
+	}
+
+	t0 := time.Now()
+	_, err := runJob(context.Background(), &jobRun{cronCtx: &basicContext, job: job, logger: logger}, Options{})
+
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(t0) < 5*time.Second)
+
+	<-channel // starting
+	<-channel // SIGTERM
+	entry := <-channel
+	assert.Equal(t, "job did not exit within 100ms, sending SIGKILL", entry.Message)
+}
+
+func TestRunJobTimeoutKillsProcessGroup(t *testing.T) {
+	defer func(grace time.Duration) { KILL_GRACE_PERIOD = grace }(KILL_GRACE_PERIOD)
+	KILL_GRACE_PERIOD = 100 * time.Millisecond
+
+	logger, channel := newTestLogger()
+
+	// The shell exits on SIGTERM, but leaves behind a process that ignores
+	// it, and doesn't hold on to the job's output.
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{Command: "(trap '' TERM; sleep 10) > /dev/null 2>&1 & wait"},
+		Timeout:     100 * time.Millisecond,
+	}
+
+	t0 := time.Now()
+	_, err := runJob(context.Background(), &jobRun{cronCtx: &basicContext, job: job, logger: logger}, Options{})
+
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(t0) < 5*time.Second)
+
+	<-channel // starting
+	<-channel // SIGTERM
+	entry := <-channel
+	assert.Equal(t, "job did not exit within 100ms, sending SIGKILL", entry.Message)
+
+	select {
+	case entry := <-channel:
+		t.Errorf("unexpected message: %s", entry.Message)
+	default:
+	}
+}
+
 func TestStartJobExitsOnRequest(t *testing.T) {
 	job := crontab.Job{
 		CrontabLine: crontab.CrontabLine{
@@ -195,7 +278,7 @@ func TestStartJobExitsOnRequest(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
 
-	StartJob(&wg, &basicContext, &job, ctx, logger, false)
+	StartJob(&wg, &basicContext, &job, ctx, logger, Options{})
 
 	wg.Wait()
 }
@@ -215,7 +298,7 @@ func TestStartJobRunsJob(t *testing.T) {
 
 	logger, channel := newTestLogger()
 
-	StartJob(&wg, &basicContext, &job, ctx, logger, false)
+	StartJob(&wg, &basicContext, &job, ctx, logger, Options{})
 
 	select {
 	case entry := <-channel:
@@ -263,125 +346,2725 @@ func TestStartJobRunsJob(t *testing.T) {
 	wg.Wait()
 }
 
-func TestStartFuncWaitsForCompletion(t *testing.T) {
-	// We use startFunc to start a function, wait for it to start, then
-	// tell the whole thing to exit, and verify that it waits for the
-	// function to finish.
-	expr := &testExpression{10 * time.Millisecond}
+type recordingHook struct {
+	started  chan *Execution
+	finished chan *Execution
+}
+
+func (h *recordingHook) JobStarted(e *Execution) {
+	h.started <- e
+}
+
+func (h *recordingHook) JobFinished(e *Execution) {
+	h.finished <- e
+}
+
+func TestStartJobCallsHooks(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{10 * time.Millisecond},
+			Schedule:   "always!",
+			Command:    "echo hello; echo oops >&2; false",
+		},
+		Position: 1,
+	}
+
+	hook := &recordingHook{
+		started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+	}
 
 	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+
 	logger, _ := newTestLogger()
 
-	ctxStartFunc, cancelStartFunc := context.WithCancel(context.Background())
-	ctxAllDone, allDone := context.WithCancel(context.Background())
+	StartJob(&wg, &basicContext, &job, ctx, logger, Options{Hooks: []Hook{hook}})
 
-	ctxStep1, step1Done := context.WithCancel(context.Background())
-	ctxStep2, step2Done := context.WithCancel(context.Background())
+	select {
+	case e := <-hook.started:
+		assert.Equal(t, &job, e.Job)
+		assert.Equal(t, uint64(0), e.Iteration)
+		assert.False(t, e.StartedAt.IsZero())
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for start")
+	}
 
-	testFn := func(t0 time.Time, jobLogger *logrus.Entry) {
-		step1Done()
-		<-ctxStep2.Done()
+	select {
+	case e := <-hook.finished:
+		assert.NotNil(t, e.Err)
+		assert.Equal(t, 1, e.ExitCode)
+		assert.False(t, e.FinishedAt.Before(e.StartedAt))
+		assert.Equal(t, []string{"hello"}, e.Output.Tail("stdout", 10))
+		assert.Equal(t, []string{"oops"}, e.Output.Tail("stderr", 10))
+		assert.Equal(t, 2, e.Output.Len())
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for finish")
 	}
 
-	startFunc(&wg, ctxStartFunc, logger, false, expr, testFn)
-	go func() {
+	cancel()
+	wg.Wait()
+}
+
+func TestNextBackoff(t *testing.T) {
+	assert.Equal(t, RESTART_MIN_BACKOFF, nextBackoff(0, 0))
+	assert.Equal(t, 2*RESTART_MIN_BACKOFF, nextBackoff(RESTART_MIN_BACKOFF, 0))
+	assert.Equal(t, RESTART_MAX_BACKOFF, nextBackoff(RESTART_MAX_BACKOFF, 0))
+	assert.Equal(t, RESTART_MIN_BACKOFF, nextBackoff(RESTART_MAX_BACKOFF, RESTART_MAX_BACKOFF+time.Second))
+}
+
+func startDaemonJob(t *testing.T, command string, policy crontab.RestartPolicy) (*recordingHook, *JobState, func()) {
+	minBackoff, maxBackoff := RESTART_MIN_BACKOFF, RESTART_MAX_BACKOFF
+	RESTART_MIN_BACKOFF, RESTART_MAX_BACKOFF = 10*time.Millisecond, 40*time.Millisecond
+
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &crontab.DaemonExpression{},
+			Schedule:   "@always",
+			Command:    command,
+		},
+		Restart: policy,
+	}
+
+	hook := &recordingHook{
+		started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+	}
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+
+	logger, _ := newTestLogger()
+	state := StartJob(&wg, &basicContext, &job, ctx, logger, Options{Hooks: []Hook{hook}})
+
+	return hook, state, func() {
+		cancel()
 		wg.Wait()
-		allDone()
-	}()
+		RESTART_MIN_BACKOFF, RESTART_MAX_BACKOFF = minBackoff, maxBackoff
+	}
+}
+
+func TestStartJobRestartsDaemons(t *testing.T) {
+	hook, _, stop := startDaemonJob(t, "exit 1", "")
+	defer stop()
+
+	var previous time.Time
+	for i := 0; i < 4; i++ {
+		select {
+		case e := <-hook.finished:
+			assert.NotNil(t, e.Err)
+			if !previous.IsZero() {
+				gap := e.StartedAt.Sub(previous)
+				assert.True(t, gap >= 10*time.Millisecond, "gap was %v", gap)
+			}
+			previous = e.FinishedAt
+		case <-time.After(time.Second):
+			t.Fatalf("job was not restarted")
+		}
+	}
+}
+
+func TestStartJobRestartsDaemonsOnFailure(t *testing.T) {
+	hook, state, stop := startDaemonJob(t, "true", crontab.RestartOnFailure)
+	defer stop()
+
+	<-hook.started
 
 	select {
-	case <-ctxStep1.Done():
+	case e := <-hook.finished:
+		assert.Nil(t, e.Err)
 	case <-time.After(time.Second):
-		t.Fatalf("timed out waiting for testFn to start")
+		t.Fatalf("job did not run")
 	}
 
-	cancelStartFunc()
+	select {
+	case <-hook.started:
+		t.Fatalf("job was restarted")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// It can still be started manually.
+	state.Trigger()
 
 	select {
-	case <-ctxAllDone.Done():
-		t.Fatalf("wg completed before jobs finished")
+	case <-hook.started:
 	case <-time.After(time.Second):
+		t.Fatalf("job was not triggered")
 	}
+}
 
-	step2Done()
+func TestStartJobStopsDaemons(t *testing.T) {
+	hook, _, stop := startDaemonJob(t, "sleep 10", "")
 
 	select {
-	case <-ctxAllDone.Done():
+	case <-hook.started:
 	case <-time.After(time.Second):
-		t.Fatalf("wg did not complete after jobs finished")
+		t.Fatalf("job did not start")
+	}
+
+	t0 := time.Now()
+	stop()
+	assert.True(t, time.Since(t0) < 5*time.Second)
+
+	select {
+	case e := <-hook.finished:
+		assert.Nil(t, e.Err)
+	default:
+		t.Fatalf("job did not finish")
 	}
 }
 
-func TestStartFuncDoesNotRunOverlappingJobs(t *testing.T) {
-	// We kick off a function that does not terminate. We expect to see it
-	// run only once.
+type testArchiver struct {
+	err error
+}
 
-	expr := &testExpression{10 * time.Millisecond}
+func (a *testArchiver) Archive(e *Execution) (string, error) {
+	if a.err != nil {
+		return "", a.err
+	}
+	return fmt.Sprintf("s3://logs/%d/%d.log.gz", e.Job.Position, e.Iteration), nil
+}
 
-	testChan := make(chan interface{}, TEST_CHANNEL_BUFFER_SIZE)
+func TestStartJobArchivesOutput(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Hour},
+			Schedule:   "hourly-ish",
+			Command:    "echo hello",
+		},
+		Position: 1,
+	}
 
-	var wg sync.WaitGroup
-	logger, _ := newTestLogger()
+	for _, archiver := range []*testArchiver{{}, {err: fmt.Errorf("bucket is gone")}} {
+		hook := &recordingHook{
+			started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+			finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		}
 
-	ctxStartFunc, cancelStartFunc := context.WithCancel(context.Background())
-	ctxAllDone, allDone := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		ctx, cancel := context.WithCancel(context.Background())
 
-	testFn := func(t0 time.Time, jobLogger *logrus.Entry) {
-		testChan <- nil
-		<-ctxAllDone.Done()
+		logger, channel := newTestLogger()
+
+		state := StartJob(&wg, &basicContext, &job, ctx, logger, Options{Hooks: []Hook{hook}, Archiver: archiver, RunOnce: true})
+		state.Trigger()
+
+		select {
+		case e := <-hook.finished:
+			if archiver.err == nil {
+				assert.Equal(t, "s3://logs/1/0.log.gz", e.OutputURL)
+			} else {
+				assert.Equal(t, "", e.OutputURL)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for finish")
+		}
+
+		cancel()
+		wg.Wait()
+		close(channel)
+
+		var completion *logrus.Entry
+		var warnings []string
+		for entry := range channel {
+			if entry.Message == "job succeeded" {
+				completion = entry
+			}
+			if entry.Level == logrus.WarnLevel {
+				warnings = append(warnings, entry.Message)
+			}
+		}
+
+		if assert.NotNil(t, completion) {
+			if archiver.err == nil {
+				assert.Equal(t, "s3://logs/1/0.log.gz", completion.Data["output_url"])
+				assert.Empty(t, warnings)
+			} else {
+				assert.Nil(t, completion.Data["output_url"])
+				assert.Equal(t, []string{"failed to archive output: bucket is gone"}, warnings)
+			}
+		}
 	}
+}
 
-	startFunc(&wg, ctxStartFunc, logger, false, expr, testFn)
+func TestStartJobTrigger(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Hour},
+			Schedule:   "hourly-ish",
+			Command:    "false",
+		},
+		Position: 1,
+	}
 
-	select {
-	case <-testChan:
-	case <-time.After(time.Second):
-		t.Fatalf("fn did not run")
+	hook := &recordingHook{
+		started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
 	}
 
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+
+	logger, _ := newTestLogger()
+
+	state := StartJob(&wg, &basicContext, &job, ctx, logger, Options{Hooks: []Hook{hook}})
+	state.Trigger()
+
 	select {
-	case <-testChan:
-		t.Fatalf("fn instances overlapped")
+	case <-hook.finished:
 	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for triggered run")
 	}
 
-	cancelStartFunc()
-	allDone()
+	status := state.Status()
+	assert.Equal(t, 0, status.Running)
+	if assert.NotNil(t, status.LastRun) {
+		assert.False(t, status.LastRun.Succeeded)
+		assert.Equal(t, "error running command: exit status 1", status.LastRun.Error)
+	}
 
+	// The scheduled run is still an hour away
+	if assert.NotNil(t, status.NextRun) {
+		assert.True(t, status.NextRun.After(time.Now().Add(50*time.Minute)))
+	}
+
+	cancel()
 	wg.Wait()
 }
 
-func TestStartFuncRunsOverlappingJobs(t *testing.T) {
-	// We kick off a bunch of functions that never terminate, and expect to
-	// still see multiple iterations
+func TestJobStateSignalsRunningJobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-signal")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
 
-	expr := &testExpression{10 * time.Millisecond}
+	ready := filepath.Join(dir, "ready")
 
-	testChan := make(chan interface{}, TEST_CHANNEL_BUFFER_SIZE)
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Hour},
+			Schedule:   "hourly-ish",
+			Command:    fmt.Sprintf("trap 'exit 3' HUP; touch %s; sleep 10 > /dev/null & wait", ready),
+		},
+		Position: 1,
+	}
+
+	hook := &recordingHook{
+		started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+	}
 
 	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
 	logger, _ := newTestLogger()
 
-	ctxStartFunc, cancelStartFunc := context.WithCancel(context.Background())
-	ctxAllDone, allDone := context.WithCancel(context.Background())
+	state := StartJob(&wg, &basicContext, &job, ctx, logger, Options{Hooks: []Hook{hook}})
+	assert.Equal(t, 0, state.Signal(syscall.SIGHUP))
 
-	testFn := func(t0 time.Time, jobLogger *logrus.Entry) {
-		testChan <- nil
-		<-ctxAllDone.Done()
+	state.Trigger()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(ready); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
 
-	startFunc(&wg, ctxStartFunc, logger, true, expr, testFn)
+	assert.Equal(t, 1, state.Signal(syscall.SIGHUP))
 
-	for i := 0; i < 5; i++ {
-		select {
-		case <-testChan:
-		case <-time.After(time.Second):
-			t.Fatalf("fn instances did not overlap")
-		}
+	select {
+	case e := <-hook.finished:
+		assert.Equal(t, 3, e.ExitCode)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("job did not exit on SIGHUP")
 	}
+}
 
-	cancelStartFunc()
-	allDone()
+func TestStartJobPause(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{50 * time.Millisecond},
+			Schedule:   "always!",
+			Command:    "true",
+		},
+		Position: 1,
+	}
+
+	hook := &recordingHook{
+		started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+	}
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+
+	logger, _ := newTestLogger()
+
+	state := StartJob(&wg, &basicContext, &job, ctx, logger, Options{Hooks: []Hook{hook}})
+	state.Pause()
+	assert.True(t, state.Status().Paused)
+
+	select {
+	case <-hook.started:
+		t.Fatalf("paused job ran")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	state.Resume()
+
+	select {
+	case <-hook.started:
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for resumed run")
+	}
 
+	cancel()
 	wg.Wait()
 }
+
+func TestMissedRuns(t *testing.T) {
+	expr := &testExpression{time.Hour}
+	now := time.Date(2019, 1, 1, 12, 30, 0, 0, time.UTC)
+
+	missed := missedRuns(expr, now.Add(-150*time.Minute), now, 10)
+	assert.Equal(t, []time.Time{
+		now.Add(-90 * time.Minute),
+		now.Add(-30 * time.Minute),
+	}, missed)
+
+	missed = missedRuns(expr, now.Add(-150*time.Minute), now, 1)
+	assert.Equal(t, []time.Time{now.Add(-30 * time.Minute)}, missed)
+
+	assert.Empty(t, missedRuns(expr, now.Add(-30*time.Minute), now, 10))
+}
+
+var catchUpTestCases = []struct {
+	policy crontab.CatchUpPolicy
+	runs   int
+}{
+	{crontab.CatchUpSkip, 0},
+	{crontab.CatchUpRunOnce, 1},
+	{crontab.CatchUpRunAll, 3},
+}
+
+func TestNextRuns(t *testing.T) {
+	expr := &testExpression{time.Hour}
+	now := time.Date(2019, 1, 1, 12, 30, 0, 0, time.UTC)
+
+	assert.Equal(t, []time.Time{
+		now.Add(time.Hour),
+		now.Add(2 * time.Hour),
+		now.Add(3 * time.Hour),
+	}, NextRuns(expr, now, 3))
+
+	assert.Empty(t, NextRuns(expr, now, 0))
+}
+
+func TestStartJobCatchUp(t *testing.T) {
+	for _, tt := range catchUpTestCases {
+		job := crontab.Job{
+			CrontabLine: crontab.CrontabLine{
+				Expression: &testExpression{time.Hour},
+				Schedule:   "hourly-ish",
+				Command:    "true",
+			},
+		}
+
+		hook := &recordingHook{
+			started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+			finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		}
+
+		var wg sync.WaitGroup
+		ctx, cancel := context.WithCancel(context.Background())
+
+		logger, _ := newTestLogger()
+
+		lastRun := time.Now().Add(-210 * time.Minute)
+
+		StartJob(&wg, &basicContext, &job, ctx, logger, Options{
+			Hooks:   []Hook{hook},
+			CatchUp: tt.policy,
+			LastRun: lastRun,
+		})
+
+		scheduled := make([]time.Time, 0)
+		for i := 0; i < tt.runs; i++ {
+			select {
+			case e := <-hook.finished:
+				scheduled = append(scheduled, e.ScheduledAt)
+			case <-time.After(time.Second):
+				t.Fatalf("timed out waiting for catch-up run (%s)", tt.policy)
+			}
+		}
+
+		cancel()
+		wg.Wait()
+
+		assert.Len(t, scheduled, tt.runs, string(tt.policy))
+		if tt.runs > 0 {
+			// The most recent missed run is always caught up
+			assert.Equal(t, lastRun.Add(3*time.Hour), scheduled[len(scheduled)-1], string(tt.policy))
+		}
+
+		assert.Len(t, hook.finished, 0, string(tt.policy))
+	}
+}
+
+func TestStartJobRunsAtStartup(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Hour},
+			Schedule:   "hourly-ish",
+			Command:    "true",
+		},
+	}
+
+	for _, lastRun := range []time.Time{{}, time.Now().Add(-90 * time.Minute)} {
+		hook := &recordingHook{
+			started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+			finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		}
+
+		var wg sync.WaitGroup
+		ctx, cancel := context.WithCancel(context.Background())
+
+		logger, _ := newTestLogger()
+
+		StartJob(&wg, &basicContext, &job, ctx, logger, Options{
+			Hooks:        []Hook{hook},
+			RunAtStartup: true,
+			CatchUp:      crontab.CatchUpRunAll,
+			LastRun:      lastRun,
+		})
+
+		select {
+		case <-hook.finished:
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for run at startup")
+		}
+
+		// Runs that were caught up on stand in for the run at startup.
+		time.Sleep(100 * time.Millisecond)
+		assert.Len(t, hook.finished, 0)
+
+		cancel()
+		wg.Wait()
+	}
+}
+
+func TestStartJobWaitsForStartupDelay(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Hour},
+			Schedule:   "hourly-ish",
+			Command:    "true",
+		},
+	}
+
+	hook := &recordingHook{
+		started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+	}
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	logger, _ := newTestLogger()
+
+	startedAt := time.Now()
+	StartJob(&wg, &basicContext, &job, ctx, logger, Options{
+		Hooks:        []Hook{hook},
+		RunAtStartup: true,
+		StartupDelay: 300 * time.Millisecond,
+		StartedAt:    startedAt,
+	})
+
+	select {
+	case e := <-hook.started:
+		assert.True(t, e.StartedAt.Sub(startedAt) >= 300*time.Millisecond)
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for run at startup")
+	}
+}
+
+func TestStartupDelay(t *testing.T) {
+	job := &crontab.Job{}
+	startedAt := time.Now().Add(-time.Minute)
+
+	assert.Equal(t, time.Duration(0), startupDelay(job, Options{}))
+	assert.Equal(t, time.Minute, startupDelay(job, Options{StartupDelay: time.Minute}))
+
+	// The delay counts from when supercronic started.
+	assert.True(t, startupDelay(job, Options{StartupDelay: time.Minute, StartedAt: startedAt}) <= 0)
+
+	job.StartupDelay = 2 * time.Minute
+	delay := startupDelay(job, Options{StartupDelay: time.Minute, StartedAt: startedAt})
+	assert.True(t, delay > 59*time.Second && delay <= time.Minute, delay.String())
+}
+
+func TestStartJobSkipsRunsDoneAlready(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Hour},
+			Schedule:   "hourly-ish",
+			Command:    "true",
+		},
+	}
+
+	for _, tt := range []struct {
+		lastSuccess time.Time
+		runs        int
+	}{
+		{time.Time{}, 1},
+		{time.Now().Add(-30 * time.Minute), 0},
+		{time.Now().Add(-90 * time.Minute), 1},
+	} {
+		hook := &recordingHook{
+			started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+			finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		}
+
+		var wg sync.WaitGroup
+		ctx, cancel := context.WithCancel(context.Background())
+
+		logger, _ := newTestLogger()
+
+		StartJob(&wg, &basicContext, &job, ctx, logger, Options{
+			Hooks:        []Hook{hook},
+			RunAtStartup: true,
+			LastSuccess:  tt.lastSuccess,
+		})
+
+		time.Sleep(200 * time.Millisecond)
+		assert.Len(t, hook.finished, tt.runs, tt.lastSuccess.String())
+
+		cancel()
+		wg.Wait()
+	}
+}
+
+type testLocker struct {
+	mu       sync.Mutex
+	granted  map[time.Time]bool
+	released int
+}
+
+type testLock struct {
+	locker *testLocker
+}
+
+func (l *testLock) Release() {
+	l.locker.mu.Lock()
+	defer l.locker.mu.Unlock()
+	l.locker.released++
+}
+
+// Grants every other lock
+func (l *testLocker) Acquire(job *crontab.Job, scheduledAt time.Time) (Lock, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	grant := len(l.granted)%2 == 0
+	l.granted[scheduledAt] = grant
+
+	if !grant {
+		return nil, nil
+	}
+
+	return &testLock{locker: l}, nil
+}
+
+func TestStartJobSkipsLockedRuns(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{20 * time.Millisecond},
+			Schedule:   "always!",
+			Command:    "true",
+		},
+	}
+
+	hook := &recordingHook{
+		started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+	}
+
+	locker := &testLocker{granted: make(map[time.Time]bool)}
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+
+	logger, _ := newTestLogger()
+
+	StartJob(&wg, &basicContext, &job, ctx, logger, Options{Hooks: []Hook{hook}, Locker: locker})
+
+	time.Sleep(300 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	close(hook.finished)
+	runs := 0
+	for e := range hook.finished {
+		assert.True(t, locker.granted[e.ScheduledAt])
+		runs++
+	}
+
+	assert.True(t, runs > 0)
+	assert.Equal(t, runs, locker.released)
+	assert.True(t, len(locker.granted) > runs)
+}
+
+func TestRegistryAbort(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Hour},
+			Schedule:   "hourly-ish",
+			Command:    "sleep 10",
+		},
+	}
+
+	hook := &recordingHook{
+		started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+	}
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+
+	logger, _ := newTestLogger()
+
+	registry := NewRegistry()
+	state := StartJob(&wg, &basicContext, &job, ctx, logger, Options{Hooks: []Hook{hook}})
+	registry.Add(state)
+	state.Trigger()
+
+	select {
+	case <-hook.started:
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for start")
+	}
+
+	t0 := time.Now()
+	registry.Abort()
+
+	select {
+	case e := <-hook.finished:
+		if assert.NotNil(t, e.Err) {
+			assert.Regexp(t, regexp.MustCompile("^job aborted"), e.Err.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for abort")
+	}
+
+	assert.True(t, time.Since(t0) < 5*time.Second)
+
+	cancel()
+	wg.Wait()
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+
+	a := newJobState(&basicContext, &crontab.Job{})
+	b := newJobState(&basicContext, &crontab.Job{})
+
+	registry.Add(a)
+	registry.Add(b)
+
+	assert.Equal(t, 0, a.ID())
+	assert.Equal(t, 1, b.ID())
+	assert.Equal(t, []*JobState{a, b}, registry.Jobs())
+	assert.Equal(t, b, registry.Job(1))
+	assert.Nil(t, registry.Job(2))
+
+	registry.Reset()
+	assert.Empty(t, registry.Jobs())
+}
+
+func TestOutputIsBounded(t *testing.T) {
+	defer func(size int) { MAX_CAPTURED_OUTPUT = size }(MAX_CAPTURED_OUTPUT)
+	MAX_CAPTURED_OUTPUT = 10
+
+	output := &Output{}
+	output.Append("stdout", "aaaa")
+	output.Append("stderr", "bbbb")
+	assert.False(t, output.Truncated())
+
+	output.Append("stdout", "cccc")
+	assert.True(t, output.Truncated())
+	assert.Equal(t, "bbbb\ncccc\n", output.String())
+	assert.Equal(t, []string{"cccc"}, output.Tail("stdout", 10))
+	assert.Equal(t, []string{"bbbb", "cccc"}, output.Tail("", 10))
+}
+
+func TestOutputSince(t *testing.T) {
+	defer func(size int) { MAX_CAPTURED_OUTPUT = size }(MAX_CAPTURED_OUTPUT)
+	MAX_CAPTURED_OUTPUT = 10
+
+	output := &Output{}
+	output.Append("stdout", "aaaa")
+
+	lines, next, changed, closed := output.Since(0)
+	assert.Equal(t, []OutputLine{{"stdout", "aaaa"}}, lines)
+	assert.Equal(t, 1, next)
+	assert.False(t, closed)
+
+	output.Append("stderr", "bbbb")
+	output.Append("stdout", "cccc")
+
+	select {
+	case <-changed:
+	default:
+		t.Fatalf("expected output to have changed")
+	}
+
+	// The line that was discarded is skipped.
+	lines, next, _, _ = output.Since(0)
+	assert.Equal(t, []OutputLine{{"stderr", "bbbb"}, {"stdout", "cccc"}}, lines)
+	assert.Equal(t, 3, next)
+
+	_, _, changed, _ = output.Since(next)
+	output.Close()
+
+	select {
+	case <-changed:
+	default:
+		t.Fatalf("expected output to have changed")
+	}
+
+	lines, _, changed, closed = output.Since(next)
+	assert.Len(t, lines, 0)
+	assert.Nil(t, changed)
+	assert.True(t, closed)
+}
+
+func TestStartFuncWaitsForCompletion(t *testing.T) {
+	// We use startFunc to start a function, wait for it to start, then
+	// tell the whole thing to exit, and verify that it waits for the
+	// function to finish.
+	expr := &testExpression{10 * time.Millisecond}
+
+	var wg sync.WaitGroup
+	logger, _ := newTestLogger()
+
+	ctxStartFunc, cancelStartFunc := context.WithCancel(context.Background())
+	ctxAllDone, allDone := context.WithCancel(context.Background())
+
+	ctxStep1, step1Done := context.WithCancel(context.Background())
+	ctxStep2, step2Done := context.WithCancel(context.Background())
+
+	testFn := func(t0 time.Time, iteration uint64, jobLogger *logrus.Entry) {
+		step1Done()
+		<-ctxStep2.Done()
+	}
+
+	startFunc(&wg, ctxStartFunc, logger, newJobState(&basicContext, &crontab.Job{}), crontab.OverlapSkip, 0, expr, nil, false, testFn)
+	go func() {
+		wg.Wait()
+		allDone()
+	}()
+
+	select {
+	case <-ctxStep1.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for testFn to start")
+	}
+
+	cancelStartFunc()
+
+	select {
+	case <-ctxAllDone.Done():
+		t.Fatalf("wg completed before jobs finished")
+	case <-time.After(time.Second):
+	}
+
+	step2Done()
+
+	select {
+	case <-ctxAllDone.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("wg did not complete after jobs finished")
+	}
+}
+
+func TestStartFuncDoesNotRunOverlappingJobs(t *testing.T) {
+	// We kick off a function that does not terminate. We expect to see it
+	// run only once.
+
+	expr := &testExpression{10 * time.Millisecond}
+
+	testChan := make(chan interface{}, TEST_CHANNEL_BUFFER_SIZE)
+
+	var wg sync.WaitGroup
+	logger, _ := newTestLogger()
+
+	ctxStartFunc, cancelStartFunc := context.WithCancel(context.Background())
+	ctxAllDone, allDone := context.WithCancel(context.Background())
+
+	testFn := func(t0 time.Time, iteration uint64, jobLogger *logrus.Entry) {
+		testChan <- nil
+		<-ctxAllDone.Done()
+	}
+
+	startFunc(&wg, ctxStartFunc, logger, newJobState(&basicContext, &crontab.Job{}), crontab.OverlapSkip, 0, expr, nil, false, testFn)
+
+	select {
+	case <-testChan:
+	case <-time.After(time.Second):
+		t.Fatalf("fn did not run")
+	}
+
+	select {
+	case <-testChan:
+		t.Fatalf("fn instances overlapped")
+	case <-time.After(time.Second):
+	}
+
+	cancelStartFunc()
+	allDone()
+
+	wg.Wait()
+}
+
+func TestStartFuncRunsOverlappingJobs(t *testing.T) {
+	// We kick off a bunch of functions that never terminate, and expect to
+	// still see multiple iterations
+
+	expr := &testExpression{10 * time.Millisecond}
+
+	testChan := make(chan interface{}, TEST_CHANNEL_BUFFER_SIZE)
+
+	var wg sync.WaitGroup
+	logger, _ := newTestLogger()
+
+	ctxStartFunc, cancelStartFunc := context.WithCancel(context.Background())
+	ctxAllDone, allDone := context.WithCancel(context.Background())
+
+	testFn := func(t0 time.Time, iteration uint64, jobLogger *logrus.Entry) {
+		testChan <- nil
+		<-ctxAllDone.Done()
+	}
+
+	startFunc(&wg, ctxStartFunc, logger, newJobState(&basicContext, &crontab.Job{}), crontab.OverlapAllow, 0, expr, nil, false, testFn)
+
+	for i := 0; i < 5; i++ {
+		select {
+		case <-testChan:
+		case <-time.After(time.Second):
+			t.Fatalf("fn instances did not overlap")
+		}
+	}
+
+	cancelStartFunc()
+	allDone()
+
+	wg.Wait()
+}
+
+func TestStartFuncQueuesOverlappingRuns(t *testing.T) {
+	// We kick off a function that takes longer than its interval to run. We
+	// expect the next run to start as soon as it's done, with the latest run
+	// it missed as its scheduled time.
+
+	expr := &testExpression{10 * time.Millisecond}
+
+	testChan := make(chan time.Time, TEST_CHANNEL_BUFFER_SIZE)
+	finished := make(chan time.Time, TEST_CHANNEL_BUFFER_SIZE)
+
+	var wg sync.WaitGroup
+	logger, _ := newTestLogger()
+
+	ctxStartFunc, cancelStartFunc := context.WithCancel(context.Background())
+
+	testFn := func(t0 time.Time, iteration uint64, jobLogger *logrus.Entry) {
+		testChan <- t0
+		time.Sleep(50 * time.Millisecond)
+		finished <- time.Now()
+	}
+
+	startFunc(&wg, ctxStartFunc, logger, newJobState(&basicContext, &crontab.Job{}), crontab.OverlapQueue, 0, expr, nil, false, testFn)
+
+	var scheduledAt [2]time.Time
+
+	for i := range scheduledAt {
+		select {
+		case scheduledAt[i] = <-testChan:
+		case <-time.After(time.Second):
+			t.Fatalf("fn did not run")
+		}
+	}
+
+	cancelStartFunc()
+	wg.Wait()
+
+	firstFinished := <-finished
+	assert.True(t, scheduledAt[1].After(scheduledAt[0].Add(10*time.Millisecond)))
+	assert.True(t, scheduledAt[1].Before(firstFinished))
+	assert.Equal(t, time.Duration(0), scheduledAt[1].Sub(scheduledAt[0])%(10*time.Millisecond))
+}
+
+func TestStartJobReplacesRunningJob(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{100 * time.Millisecond},
+			Schedule:   "always!",
+			Command:    "sleep 10",
+		},
+		Position: 1,
+	}
+
+	hook := &recordingHook{
+		started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+	}
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+
+	logger, _ := newTestLogger()
+
+	state := StartJob(&wg, &basicContext, &job, ctx, logger, Options{
+		Overlap: crontab.OverlapReplace,
+		Hooks:   []Hook{hook},
+	})
+
+	select {
+	case e := <-hook.finished:
+		if assert.NotNil(t, e.Err) {
+			assert.Contains(t, e.Err.Error(), "job aborted")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("job was not replaced")
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-hook.started:
+		case <-time.After(time.Second):
+			t.Fatalf("replacement did not start")
+		}
+	}
+
+	cancel()
+	state.Abort()
+	wg.Wait()
+}
+
+func TestLimiter(t *testing.T) {
+	limiter := NewLimiter(1)
+	logger, _ := newTestLogger()
+
+	assert.True(t, limiter.Acquire(context.Background(), logger))
+	assert.Equal(t, LimiterStats{Limit: 1, Running: 1}, limiter.Stats())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	assert.False(t, limiter.Acquire(ctx, logger))
+	assert.Equal(t, LimiterStats{Limit: 1, Running: 1, Queued: 1}, limiter.Stats())
+
+	acquired := make(chan bool)
+	go func() {
+		acquired <- limiter.Acquire(context.Background(), logger)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatalf("acquired a slot while none was available")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.Equal(t, LimiterStats{Limit: 1, Running: 1, Waiting: 1, Queued: 2}, limiter.Stats())
+
+	limiter.Release()
+
+	select {
+	case ok := <-acquired:
+		assert.True(t, ok)
+	case <-time.After(time.Second):
+		t.Fatalf("did not acquire the slot that was released")
+	}
+
+	limiter.Release()
+	assert.Equal(t, LimiterStats{Limit: 1, Queued: 2}, limiter.Stats())
+}
+
+func TestStartJobWaitsForLimiter(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Hour},
+			Schedule:   "hourly-ish",
+			Command:    "true",
+		},
+		Position: 1,
+	}
+
+	hook := &recordingHook{
+		started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+	}
+
+	limiter := NewLimiter(1)
+	logger, _ := newTestLogger()
+	assert.True(t, limiter.Acquire(context.Background(), logger))
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+
+	state := StartJob(&wg, &basicContext, &job, ctx, logger, Options{
+		Hooks:   []Hook{hook},
+		Limiter: limiter,
+	})
+	state.Trigger()
+
+	select {
+	case <-hook.started:
+		t.Fatalf("job started without a slot")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	assert.Equal(t, 1, state.Status().Waiting)
+
+	limiter.Release()
+
+	select {
+	case <-hook.finished:
+	case <-time.After(time.Second):
+		t.Fatalf("job did not run once a slot was released")
+	}
+
+	assert.Equal(t, 0, state.Status().Waiting)
+
+	cancel()
+	wg.Wait()
+}
+
+func TestStartFuncAppliesJitter(t *testing.T) {
+	expr := &testExpression{10 * time.Millisecond}
+
+	testChan := make(chan time.Duration, TEST_CHANNEL_BUFFER_SIZE)
+
+	var wg sync.WaitGroup
+	logger, channel := newTestLogger()
+
+	ctxStartFunc, cancelStartFunc := context.WithCancel(context.Background())
+
+	testFn := func(t0 time.Time, iteration uint64, jobLogger *logrus.Entry) {
+		testChan <- time.Since(t0)
+	}
+
+	startFunc(&wg, ctxStartFunc, logger, newJobState(&basicContext, &crontab.Job{}), crontab.OverlapSkip, 50*time.Millisecond, expr, nil, false, testFn)
+
+	for i := 0; i < 5; i++ {
+		select {
+		case delay := <-testChan:
+			assert.True(t, delay < 100*time.Millisecond, "delay was %v", delay)
+		case <-time.After(time.Second):
+			t.Fatalf("fn did not run")
+		}
+	}
+
+	cancelStartFunc()
+	wg.Wait()
+
+	close(channel)
+
+	delayed := 0
+	for entry := range channel {
+		assert.NotContains(t, entry.Message, "took too long")
+		if strings.HasPrefix(entry.Message, "delaying run by") {
+			delayed++
+		}
+	}
+
+	assert.True(t, delayed > 0)
+}
+
+// newOffsetScheduler returns a scheduler whose wall clock is offset from the
+// real one by what the returned function sets.
+func newOffsetScheduler(checkInterval time.Duration) (*scheduler, func(time.Duration)) {
+	var mu sync.Mutex
+	var offset time.Duration
+
+	now := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return time.Now().Round(0).Add(offset)
+	}
+
+	return newScheduler(now, checkInterval, MAX_WORKERS), func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		offset = d
+	}
+}
+
+func TestStartFuncSkipsRunsMissedWhenClockJumps(t *testing.T) {
+	s, jump := newOffsetScheduler(20 * time.Millisecond)
+
+	logger, channel := newTestLogger()
+	state := newJobState(&basicContext, &crontab.Job{})
+
+	ran := make(chan struct{}, 10)
+	testFn := func(t0 time.Time, iteration uint64, jobLogger *logrus.Entry) {
+		ran <- struct{}{}
+	}
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	scheduleFunc(s, &wg, ctx, logger, state, crontab.OverlapSkip, 0, &testExpression{time.Hour}, nil, false, testFn)
+
+	time.Sleep(50 * time.Millisecond)
+	jump(3 * time.Hour)
+
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case entry := <-channel:
+			if !strings.HasPrefix(entry.Message, "clock jumped forward") {
+				continue
+			}
+		case <-ran:
+			t.Fatalf("job ran after clock jumped")
+		case <-deadline:
+			t.Fatalf("timed out waiting for clock jump")
+		}
+		break
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0, len(ran))
+
+	next := state.Status().NextRun.Sub(s.now())
+	assert.True(t, next > 59*time.Minute && next <= time.Hour, next)
+}
+
+func TestScheduleFuncPlansOverlappingRunsOnSchedulerClock(t *testing.T) {
+	// The scheduler's clock is hours off the process clock: missed runs
+	// must still be worked out against the former.
+	for _, policy := range []crontab.OverlapPolicy{crontab.OverlapQueue, crontab.OverlapReplace, crontab.OverlapSkip} {
+		s, offset := newOffsetScheduler(CLOCK_CHECK_INTERVAL)
+		offset(2 * time.Hour)
+
+		logger, _ := newTestLogger()
+
+		scheduled := make(chan time.Time, TEST_CHANNEL_BUFFER_SIZE)
+		finished := make(chan time.Time, TEST_CHANNEL_BUFFER_SIZE)
+
+		testFn := func(t0 time.Time, iteration uint64, jobLogger *logrus.Entry) {
+			scheduled <- t0
+			time.Sleep(50 * time.Millisecond)
+			finished <- s.now()
+		}
+
+		var wg sync.WaitGroup
+		ctx, cancel := context.WithCancel(context.Background())
+
+		scheduleFunc(s, &wg, ctx, logger, newJobState(&basicContext, &crontab.Job{}), policy, 0, &testExpression{10 * time.Millisecond}, nil, false, testFn)
+
+		var scheduledAt [2]time.Time
+		for i := range scheduledAt {
+			select {
+			case scheduledAt[i] = <-scheduled:
+			case <-time.After(time.Second):
+				t.Fatalf("%s: fn did not run", policy)
+			}
+
+			late := s.now().Sub(scheduledAt[i])
+			assert.True(t, late >= 0 && late < time.Second, "%s: run %d scheduled %v ago", policy, i, late)
+		}
+
+		cancel()
+		wg.Wait()
+
+		firstFinished := <-finished
+		interval := scheduledAt[1].Sub(scheduledAt[0])
+
+		if policy == crontab.OverlapSkip {
+			assert.True(t, scheduledAt[1].After(firstFinished), "%s: %v", policy, interval)
+		} else {
+			// The latest run that was missed, not the first one.
+			assert.True(t, interval > 10*time.Millisecond && scheduledAt[1].Before(firstFinished), "%s: %v", policy, interval)
+			assert.Equal(t, time.Duration(0), interval%(10*time.Millisecond), string(policy))
+		}
+	}
+}
+
+func TestSchedulerFollowsWallClock(t *testing.T) {
+	s, jump := newOffsetScheduler(20 * time.Millisecond)
+
+	logger, _ := newTestLogger()
+
+	fired := make(chan time.Duration, 1)
+
+	// Once the clock is set back (by less than a jump), the entry waits
+	// until the wall clock reaches its time again.
+	s.add(s.now().Add(100*time.Millisecond), logger, func(jump time.Duration) {
+		fired <- jump
+	})
+	jump(-time.Second)
+
+	select {
+	case <-fired:
+		t.Fatalf("entry fired before the wall clock reached its time")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	select {
+	case jumped := <-fired:
+		assert.Equal(t, time.Duration(0), jumped)
+	case <-time.After(2 * time.Second):
+		t.Fatalf("entry did not fire")
+	}
+}
+
+func TestSchedulerFiresEntriesThatWereDueWhenClockJumps(t *testing.T) {
+	s, jump := newOffsetScheduler(time.Minute)
+
+	logger, _ := newTestLogger()
+
+	due := make(chan time.Duration, 1)
+	missed := make(chan time.Duration, 1)
+
+	// The clock jumps forward while the scheduler waits for the first
+	// entry, and lands past both of them: only the second was missed.
+	now := s.now()
+	s.add(now.Add(200*time.Millisecond), logger, func(jump time.Duration) {
+		due <- jump
+	})
+	s.add(now.Add(30*time.Minute), logger, func(jump time.Duration) {
+		missed <- jump
+	})
+
+	time.Sleep(50 * time.Millisecond)
+	jump(time.Hour)
+
+	for _, c := range []struct {
+		name     string
+		fired    chan time.Duration
+		expected bool
+	}{
+		{"due", due, false},
+		{"missed", missed, true},
+	} {
+		select {
+		case jumped := <-c.fired:
+			assert.Equal(t, c.expected, jumped > 0, c.name)
+		case <-time.After(time.Second):
+			t.Fatalf("%s entry did not fire", c.name)
+		}
+	}
+}
+
+func TestSchedulerFiresInOrder(t *testing.T) {
+	logger, _ := newTestLogger()
+	s := newScheduler(wallClockNow, CLOCK_CHECK_INTERVAL, MAX_WORKERS)
+
+	fired := make(chan int, 3)
+	now := wallClockNow()
+
+	for _, i := range []int{3, 1, 2} {
+		i := i
+		s.add(now.Add(time.Duration(i)*20*time.Millisecond), logger, func(time.Duration) {
+			fired <- i
+		})
+	}
+
+	removed := s.add(now.Add(30*time.Millisecond), logger, func(time.Duration) {
+		fired <- 0
+	})
+	s.remove(removed)
+
+	for _, expected := range []int{1, 2, 3} {
+		select {
+		case i := <-fired:
+			assert.Equal(t, expected, i)
+		case <-time.After(time.Second):
+			t.Fatalf("entry %d did not fire", expected)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	assert.Equal(t, 0, len(s.timers))
+}
+
+func TestSchedulerLimitsWorkers(t *testing.T) {
+	s := newScheduler(wallClockNow, CLOCK_CHECK_INTERVAL, 3)
+
+	var mu sync.Mutex
+	running, most := 0, 0
+
+	var wg sync.WaitGroup
+	wg.Add(20)
+
+	// Runs that are due while all workers are busy wait for one.
+	for i := 0; i < 20; i++ {
+		s.dispatch(func() {
+			defer wg.Done()
+
+			mu.Lock()
+			running++
+			if running > most {
+				most = running
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+		})
+	}
+
+	wg.Wait()
+	assert.Equal(t, 3, most)
+
+	// Workers exit once there is nothing left to run.
+	for i := 0; i < 100; i++ {
+		s.mu.Lock()
+		workers := s.workers
+		s.mu.Unlock()
+
+		if workers == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	assert.Equal(t, 0, s.workers)
+}
+
+func TestSchedulerWatchesSharedContexts(t *testing.T) {
+	s := newScheduler(wallClockNow, CLOCK_CHECK_INTERVAL, MAX_WORKERS)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	for i := 0; i < 3; i++ {
+		s.onDone(ctx, wg.Done)
+	}
+
+	s.mu.Lock()
+	assert.Equal(t, 1, len(s.watchers))
+	s.mu.Unlock()
+
+	cancel()
+	wg.Wait()
+
+	s.mu.Lock()
+	assert.Equal(t, 0, len(s.watchers))
+	s.mu.Unlock()
+}
+
+func TestStartFuncTriggers(t *testing.T) {
+	logger, _ := newTestLogger()
+	state := newJobState(&basicContext, &crontab.Job{})
+
+	ran := make(chan time.Time, 10)
+	testFn := func(t0 time.Time, iteration uint64, jobLogger *logrus.Entry) {
+		ran <- t0
+	}
+
+	// Triggers before the job is scheduled aren't lost.
+	state.Trigger()
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+
+	startFunc(&wg, ctx, logger, state, crontab.OverlapSkip, 0, &testExpression{time.Hour}, nil, false, testFn)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-ran:
+		case <-time.After(time.Second):
+			t.Fatalf("job did not run when triggered")
+		}
+
+		state.Trigger()
+	}
+
+	// The scheduled run is still due in an hour.
+	next := state.Status().NextRun.Sub(time.Now())
+	assert.True(t, next > 59*time.Minute && next <= time.Hour, next)
+
+	cancel()
+	wg.Wait()
+}
+
+func TestFailureTracker(t *testing.T) {
+	tracker := NewFailureTracker()
+
+	tracker.JobFinished(&Execution{ExitCode: 0})
+	assert.Equal(t, 0, tracker.ExitCode())
+
+	select {
+	case <-tracker.Failed:
+		t.Fatalf("successful job reported as a failure")
+	default:
+	}
+
+	tracker.JobFinished(&Execution{Err: fmt.Errorf("exit status 3"), ExitCode: 3})
+	assert.Equal(t, 3, tracker.ExitCode())
+
+	tracker.JobFinished(&Execution{Err: fmt.Errorf("signal: killed"), ExitCode: -1})
+	assert.Equal(t, 3, tracker.ExitCode())
+
+	killed := NewFailureTracker()
+	killed.JobFinished(&Execution{Err: fmt.Errorf("signal: killed"), ExitCode: -1})
+	assert.Equal(t, 1, killed.ExitCode())
+
+	select {
+	case <-tracker.Failed:
+	default:
+		t.Fatalf("failure was not reported")
+	}
+}
+
+func TestStartJobWritesLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "job.log")
+
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Hour},
+			Schedule:   "hourly-ish",
+			Command:    "echo out; echo err 1>&2",
+		},
+		Position: 1,
+		LogFile:  &crontab.LogFile{Path: path},
+	}
+
+	hook := &recordingHook{
+		started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+	}
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+
+	logger, _ := newTestLogger()
+
+	state := StartJob(&wg, &basicContext, &job, ctx, logger, Options{Hooks: []Hook{hook}})
+
+	for i := 0; i < 2; i++ {
+		state.Trigger()
+
+		select {
+		case <-hook.finished:
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for triggered run")
+		}
+	}
+
+	cancel()
+	wg.Wait()
+
+	data, err := ioutil.ReadFile(path)
+	if assert.Nil(t, err) {
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		assert.Equal(t, 4, len(lines))
+		assert.Contains(t, lines, "out")
+		assert.Contains(t, lines, "err")
+	}
+}
+
+func TestStartJobWritesStreamFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stdoutPath := filepath.Join(dir, "job.out")
+	stderrPath := filepath.Join(dir, "job.err")
+
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Hour},
+			Schedule:   "hourly-ish",
+			Command:    `echo '{"raw": true}'; printf 'err\nno newline' 1>&2`,
+		},
+		Position:   1,
+		Output:     crontab.OutputJSON,
+		StdoutFile: &crontab.LogFile{Path: stdoutPath},
+		StderrFile: &crontab.LogFile{Path: stderrPath},
+	}
+
+	hook := &recordingHook{
+		started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+	}
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+
+	logger, channel := newTestLogger()
+
+	state := StartJob(&wg, &basicContext, &job, ctx, logger, Options{Hooks: []Hook{hook}})
+	state.Trigger()
+
+	select {
+	case <-hook.finished:
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for triggered run")
+	}
+
+	cancel()
+	wg.Wait()
+
+	stdout, err := ioutil.ReadFile(stdoutPath)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "{\"raw\": true}\n", string(stdout))
+	}
+
+	stderr, err := ioutil.ReadFile(stderrPath)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "err\nno newline\n", string(stderr))
+	}
+
+	// The output is still logged too.
+	close(channel)
+
+	logged := false
+	for entry := range channel {
+		if entry.Data["channel"] == "stdout" && entry.Data["raw"] == true {
+			logged = true
+		}
+	}
+	assert.True(t, logged)
+}
+
+func TestStartJobQuietSuccess(t *testing.T) {
+	runQuietly := func(command string) []*logrus.Entry {
+		job := crontab.Job{
+			CrontabLine: crontab.CrontabLine{
+				Expression: &testExpression{time.Hour},
+				Schedule:   "hourly-ish",
+				Command:    command,
+			},
+			Position: 1,
+		}
+
+		hook := &recordingHook{
+			started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+			finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		}
+
+		var wg sync.WaitGroup
+		ctx, cancel := context.WithCancel(context.Background())
+
+		logger, channel := newTestLogger()
+
+		state := StartJob(&wg, &basicContext, &job, ctx, logger, Options{Hooks: []Hook{hook}, QuietSuccess: true})
+		state.Trigger()
+
+		select {
+		case <-hook.finished:
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for triggered run")
+		}
+
+		cancel()
+		wg.Wait()
+		close(channel)
+
+		entries := make([]*logrus.Entry, 0)
+		for entry := range channel {
+			if entry.Level <= logrus.InfoLevel {
+				entries = append(entries, entry)
+			}
+		}
+		return entries
+	}
+
+	entries := runQuietly("echo hello")
+	if assert.Equal(t, 2, len(entries)) {
+		assert.Equal(t, "job triggered manually", entries[0].Message)
+		assert.Regexp(t, regexp.MustCompile(`^job succeeded in .* \(1 line\(s\) of output suppressed\)$`), entries[1].Message)
+	}
+
+	entries = runQuietly("echo hello; exit 1")
+	if assert.Equal(t, 3, len(entries)) {
+		assert.Equal(t, "hello", entries[1].Message)
+		assert.Equal(t, "stdout", entries[1].Data["channel"])
+		assert.Equal(t, "error running command: exit status 1", entries[2].Message)
+		assert.True(t, IsJobFailure(entries[2]))
+		assert.False(t, IsJobFailure(entries[1]))
+	}
+}
+
+func TestRunJobThrottlesOutput(t *testing.T) {
+	for _, tt := range []struct {
+		throttle *crontab.Throttle
+		summary  string
+	}{
+		{&crontab.Throttle{LinesPerSecond: 2}, "8 line(s) of output suppressed (job wrote more than 2 lines per second)"},
+		{&crontab.Throttle{MaxBytes: 2}, "8 line(s) of output suppressed (job wrote more than 2 bytes)"},
+	} {
+		job := &crontab.Job{
+			CrontabLine: crontab.CrontabLine{
+				Command: "for i in 0 1 2 3 4 5 6 7 8 9; do echo $i; done",
+			},
+			Throttle: tt.throttle,
+		}
+
+		logger, channel := newTestLogger()
+		output := &Output{}
+
+		_, err := runJob(context.Background(), &jobRun{cronCtx: &basicContext, job: job, logger: logger, execution: &Execution{Output: output}}, Options{})
+		assert.Nil(t, err)
+
+		close(channel)
+
+		logged := make([]string, 0)
+		summaries := make([]string, 0)
+		for entry := range channel {
+			if entry.Data["channel"] == "stdout" {
+				logged = append(logged, entry.Message)
+			} else if strings.HasSuffix(entry.Message, ")") {
+				summaries = append(summaries, entry.Message)
+			}
+		}
+
+		assert.Equal(t, []string{"0", "1"}, logged)
+		assert.Equal(t, []string{tt.summary}, summaries)
+
+		// Throttled lines are still captured for hooks
+		assert.Equal(t, 10, output.Len())
+	}
+}
+
+func TestRunJobLongLines(t *testing.T) {
+	command := fmt.Sprintf("head -c %d /dev/zero | tr '\\0' a; echo; echo short", READ_BUFFER_SIZE*3)
+	long := strings.Repeat("a", READ_BUFFER_SIZE*3)
+
+	for _, tt := range []struct {
+		options  Options
+		expected []string
+		warnings int
+	}{
+		// The line fills the buffer thrice, so that an empty fragment ends it.
+		{Options{}, []string{long[:READ_BUFFER_SIZE], long[:READ_BUFFER_SIZE], long[:READ_BUFFER_SIZE], "", "short"}, 3},
+		{Options{LongLines: LongLinesTruncate}, []string{long[:READ_BUFFER_SIZE] + fmt.Sprintf(" [truncated %d bytes]", READ_BUFFER_SIZE*2), "short"}, 1},
+		{Options{LongLines: LongLinesAccumulate}, []string{long, "short"}, 0},
+		{Options{LongLines: LongLinesAccumulate, MaxLineSize: 100}, []string{long[:100] + fmt.Sprintf(" [truncated %d bytes]", READ_BUFFER_SIZE*3-100), "short"}, 1},
+	} {
+		label := fmt.Sprintf("LongLines: %q, MaxLineSize: %d", tt.options.LongLines, tt.options.MaxLineSize)
+		job := &crontab.Job{CrontabLine: crontab.CrontabLine{Command: command}}
+
+		logger, channel := newTestLogger()
+		output := &Output{}
+
+		_, err := runJob(context.Background(), &jobRun{cronCtx: &basicContext, job: job, logger: logger, execution: &Execution{Output: output}}, tt.options)
+		assert.Nil(t, err, label)
+
+		close(channel)
+
+		logged := make([]string, 0)
+		warnings := 0
+		for entry := range channel {
+			if entry.Level == logrus.WarnLevel {
+				warnings++
+			} else if entry.Data["channel"] == "stdout" {
+				logged = append(logged, entry.Message)
+			}
+		}
+
+		assert.Equal(t, tt.expected, logged, label)
+		assert.Equal(t, tt.warnings, warnings, label)
+		assert.Equal(t, len(tt.expected), output.Len(), label)
+	}
+}
+
+func TestRunJobLogsBlankLines(t *testing.T) {
+	job := &crontab.Job{CrontabLine: crontab.CrontabLine{Command: "echo; echo; echo b"}}
+
+	for _, policy := range []LongLinePolicy{"", LongLinesSplit, LongLinesTruncate, LongLinesAccumulate} {
+		logger, channel := newTestLogger()
+		output := &Output{}
+
+		_, err := runJob(context.Background(), &jobRun{cronCtx: &basicContext, job: job, logger: logger, execution: &Execution{Output: output}}, Options{LongLines: policy})
+		assert.Nil(t, err, string(policy))
+
+		close(channel)
+
+		logged := make([]string, 0)
+		for entry := range channel {
+			if entry.Data["channel"] == "stdout" {
+				logged = append(logged, entry.Message)
+			}
+		}
+
+		assert.Equal(t, []string{"", "", "b"}, logged, string(policy))
+		assert.Equal(t, 3, output.Len(), string(policy))
+	}
+}
+
+func TestOutputWriter(t *testing.T) {
+	logger, channel := newTestLogger()
+
+	var logFile, stdoutFile, stderrFile bytes.Buffer
+	output := &Output{}
+	logged := make([]string, 0)
+
+	w := startOutputWriter(output, &logFile, func(readerLogger *logrus.Entry, channel string, line string) {
+		logged = append(logged, line)
+	})
+	w.drain(logger, ioutil.NopCloser(strings.NewReader("a\nb\nc")), "stdout", &stdoutFile, nil, newLineAssembler(LongLinesSplit, 0))
+	w.drain(logger, ioutil.NopCloser(strings.NewReader("")), "stderr", &stderrFile, nil, newLineAssembler(LongLinesSplit, 0))
+	w.Wait()
+
+	assert.Equal(t, []string{"a", "b", "c"}, logged)
+	assert.Equal(t, 3, output.Len())
+	assert.Equal(t, "a\nb\nc\n", logFile.String())
+	assert.Equal(t, "a\nb\nc\n", stdoutFile.String())
+	assert.Equal(t, "", stderrFile.String())
+	assert.Equal(t, 0, len(channel))
+
+	assert.Equal(t, int64(6), output.Bytes("stdout"))
+	assert.Equal(t, int64(0), output.Bytes("stderr"))
+}
+
+func benchmarkOutputWriter(b *testing.B, line string, policy LongLinePolicy) {
+	data := []byte(strings.Repeat(line+"\n", 1000))
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	entry := logrus.NewEntry(logger)
+
+	logLine := func(readerLogger *logrus.Entry, channel string, line string) {
+		readerLogger.Info(line)
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(2 * len(data)))
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			w := startOutputWriter(&Output{}, ioutil.Discard, logLine)
+			w.drain(entry.WithField("channel", "stdout"), ioutil.NopCloser(bytes.NewReader(data)), "stdout", ioutil.Discard, nil, newLineAssembler(policy, 0))
+			w.drain(entry.WithField("channel", "stderr"), ioutil.NopCloser(bytes.NewReader(data)), "stderr", nil, nil, newLineAssembler(policy, 0))
+			w.Wait()
+		}
+	})
+}
+
+func BenchmarkOutputWriter(b *testing.B) {
+	benchmarkOutputWriter(b, "2019-01-12T19:35:00Z INFO processed batch 1234 in 56ms", LongLinesSplit)
+}
+
+func BenchmarkOutputWriterLongLines(b *testing.B) {
+	benchmarkOutputWriter(b, strings.Repeat("a", READ_BUFFER_SIZE+READ_BUFFER_SIZE/2), LongLinesAccumulate)
+}
+
+func TestParseLongLinePolicy(t *testing.T) {
+	policy, err := ParseLongLinePolicy("truncate")
+	assert.Nil(t, err)
+	assert.Equal(t, LongLinesTruncate, policy)
+
+	_, err = ParseLongLinePolicy("wrap")
+	assert.NotNil(t, err)
+}
+
+func TestRunJobMergesJSONOutput(t *testing.T) {
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Command: `echo '{"msg": "hello", "user": "alice", "count": 2, "channel": "nope"}'; echo 'not json'`,
+		},
+		Output: crontab.OutputJSON,
+	}
+
+	logger, channel := newTestLogger()
+
+	_, err := runJob(context.Background(), &jobRun{cronCtx: &basicContext, job: job, logger: logger}, Options{})
+	assert.Nil(t, err)
+
+	close(channel)
+
+	entries := make([]*logrus.Entry, 0)
+	for entry := range channel {
+		if entry.Data["channel"] == "stdout" {
+			entries = append(entries, entry)
+		}
+	}
+
+	if assert.Equal(t, 2, len(entries)) {
+		assert.Equal(t, "hello", entries[0].Message)
+		assert.Equal(t, "alice", entries[0].Data["user"])
+		assert.Equal(t, float64(2), entries[0].Data["count"])
+		assert.Nil(t, entries[0].Data["msg"])
+
+		assert.Equal(t, "not json", entries[1].Message)
+	}
+}
+
+func TestRunJobMapsOutputLevels(t *testing.T) {
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Command: `echo "ok"; echo "ERROR: out"; echo "chatter" >&2; echo "WARN: err" >&2`,
+		},
+	}
+
+	for _, tt := range []struct {
+		options  Options
+		override *crontab.Job
+		expected map[string]logrus.Level
+	}{
+		{
+			Options{},
+			nil,
+			map[string]logrus.Level{"ok": logrus.InfoLevel, "ERROR: out": logrus.InfoLevel, "chatter": logrus.InfoLevel, "WARN: err": logrus.InfoLevel},
+		},
+		{
+			Options{StderrLevel: crontab.OutputLevelWarning, ErrorPattern: regexp.MustCompile("^ERROR")},
+			nil,
+			map[string]logrus.Level{"ok": logrus.InfoLevel, "ERROR: out": logrus.ErrorLevel, "chatter": logrus.WarnLevel, "WARN: err": logrus.WarnLevel},
+		},
+		{
+			Options{StderrLevel: crontab.OutputLevelWarning, ErrorPattern: regexp.MustCompile("^ERROR")},
+			&crontab.Job{StderrLevel: crontab.OutputLevelError, ErrorPattern: regexp.MustCompile("^ok"), WarningPattern: regexp.MustCompile("^WARN")},
+			map[string]logrus.Level{"ok": logrus.ErrorLevel, "ERROR: out": logrus.InfoLevel, "chatter": logrus.ErrorLevel, "WARN: err": logrus.WarnLevel},
+		},
+	} {
+		j := *job
+		if tt.override != nil {
+			j.StderrLevel = tt.override.StderrLevel
+			j.ErrorPattern = tt.override.ErrorPattern
+			j.WarningPattern = tt.override.WarningPattern
+		}
+
+		logger, channel := newTestLogger()
+
+		_, err := runJob(context.Background(), &jobRun{cronCtx: &basicContext, job: &j, logger: logger}, tt.options)
+		assert.Nil(t, err)
+
+		close(channel)
+
+		levels := make(map[string]logrus.Level)
+		for entry := range channel {
+			if entry.Data["channel"] != nil {
+				levels[entry.Message] = entry.Level
+			}
+		}
+
+		assert.Equal(t, tt.expected, levels)
+	}
+}
+
+func TestRunJobDescribesRun(t *testing.T) {
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Command: `echo "$SUPERCRONIC_JOB_NAME $SUPERCRONIC_JOB_POSITION $SUPERCRONIC_ITERATION $SUPERCRONIC_SCHEDULED_AT $SUPERCRONIC_SCHEDULED_AT_UNIX"`,
+		},
+		Name:     "backup",
+		Position: 2,
+	}
+
+	scheduledAt := time.Date(2020, 1, 2, 3, 4, 0, 0, time.UTC)
+	runEnv := RunEnviron(&Execution{Job: job, Iteration: 7, ScheduledAt: scheduledAt})
+
+	logger, channel := newTestLogger()
+
+	_, err := runJob(context.Background(), &jobRun{cronCtx: &basicContext, job: job, logger: logger, env: runEnv}, Options{})
+	assert.Nil(t, err)
+
+	close(channel)
+
+	messages := make([]string, 0)
+	for entry := range channel {
+		if entry.Data["channel"] == "stdout" {
+			messages = append(messages, entry.Message)
+		}
+	}
+
+	assert.Equal(t, []string{"backup 2 7 2020-01-02T03:04:00Z 1577934240"}, messages)
+}
+
+func TestRunJobWithCleanEnv(t *testing.T) {
+	os.Setenv("SUPERCRONIC_TEST_SECRET", "hunter2")
+	defer os.Unsetenv("SUPERCRONIC_TEST_SECRET")
+	os.Setenv("LC_SUPERCRONIC_TEST", "kept")
+	defer os.Unsetenv("LC_SUPERCRONIC_TEST")
+
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{Command: `echo "[$SUPERCRONIC_TEST_SECRET] [$LC_SUPERCRONIC_TEST] [$FOO] [${PATH:+path}]"`},
+		Env:         map[string]string{"FOO": "bar"},
+	}
+
+	for _, tt := range []struct {
+		clean    bool
+		expected string
+	}{
+		{false, "[hunter2] [kept] [bar] [path]"},
+		{true, "[] [kept] [bar] [path]"},
+	} {
+		logger, channel := newTestLogger()
+
+		_, err := runJob(context.Background(), &jobRun{cronCtx: &basicContext, job: job, logger: logger}, Options{CleanEnv: tt.clean})
+		assert.Nil(t, err)
+
+		close(channel)
+
+		messages := make([]string, 0)
+		for entry := range channel {
+			if entry.Data["channel"] == "stdout" {
+				messages = append(messages, entry.Message)
+			}
+		}
+
+		assert.Equal(t, []string{tt.expected}, messages)
+	}
+}
+
+func TestRunJobWithStdin(t *testing.T) {
+	file, err := ioutil.TempFile("", "supercronic-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	file.WriteString("from a file\n")
+	file.Close()
+
+	for _, tt := range []struct {
+		stdin    *crontab.Stdin
+		expected []string
+	}{
+		{nil, []string{}},
+		{&crontab.Stdin{Path: file.Name()}, []string{"from a file"}},
+		{&crontab.Stdin{Data: "from\nthe crontab\n"}, []string{"from", "the crontab"}},
+	} {
+		logger, channel := newTestLogger()
+
+		job := &crontab.Job{
+			CrontabLine: crontab.CrontabLine{Command: "cat"},
+			Stdin:       tt.stdin,
+		}
+
+		_, err := runJob(context.Background(), &jobRun{cronCtx: &basicContext, job: job, logger: logger}, Options{})
+		assert.Nil(t, err)
+
+		close(channel)
+
+		messages := make([]string, 0)
+		for entry := range channel {
+			if entry.Data["channel"] == "stdout" {
+				messages = append(messages, entry.Message)
+			}
+		}
+
+		assert.Equal(t, tt.expected, messages)
+	}
+
+	logger, _ := newTestLogger()
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{Command: "cat"},
+		Stdin:       &crontab.Stdin{Path: file.Name() + ".missing"},
+	}
+
+	_, err = runJob(context.Background(), &jobRun{cronCtx: &basicContext, job: job, logger: logger}, Options{})
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "failed to open stdin")
+	}
+}
+
+func TestRunJobReadsEnvFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "job.env")
+
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{Command: "echo $SECRET"},
+		EnvFiles:    []string{path},
+	}
+
+	cronCtx := &crontab.Context{
+		Shell:   "/bin/sh",
+		Environ: map[string]string{"SECRET": "from crontab"},
+	}
+
+	run := func() string {
+		logger, channel := newTestLogger()
+
+		_, err := runJob(context.Background(), &jobRun{cronCtx: cronCtx, job: job, logger: logger}, Options{})
+		assert.Nil(t, err)
+
+		close(channel)
+
+		for entry := range channel {
+			if entry.Data["channel"] == "stdout" {
+				return entry.Message
+			}
+		}
+		return ""
+	}
+
+	// The file is read on every run, so changes are picked up.
+	for _, secret := range []string{"one", "two"} {
+		if err := ioutil.WriteFile(path, []byte("SECRET="+secret+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, secret, run())
+	}
+
+	os.Remove(path)
+
+	logger, _ := newTestLogger()
+	_, err = runJob(context.Background(), &jobRun{cronCtx: cronCtx, job: job, logger: logger}, Options{})
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "failed to read env file")
+	}
+}
+
+func TestStartFuncIntervalFromEnd(t *testing.T) {
+	expr := &crontab.IntervalExpression{Interval: 20 * time.Millisecond, FromEnd: true}
+
+	testChan := make(chan time.Time, TEST_CHANNEL_BUFFER_SIZE)
+
+	var wg sync.WaitGroup
+	logger, _ := newTestLogger()
+
+	ctxStartFunc, cancelStartFunc := context.WithCancel(context.Background())
+
+	testFn := func(t0 time.Time, iteration uint64, jobLogger *logrus.Entry) {
+		testChan <- time.Now()
+		time.Sleep(30 * time.Millisecond)
+	}
+
+	// Even with the allow policy, runs wait for the previous one to finish.
+	startFunc(&wg, ctxStartFunc, logger, newJobState(&basicContext, &crontab.Job{}), crontab.OverlapAllow, 0, expr, nil, false, testFn)
+
+	var previous time.Time
+	for i := 0; i < 4; i++ {
+		select {
+		case started := <-testChan:
+			if !previous.IsZero() {
+				gap := started.Sub(previous)
+				assert.True(t, gap >= 50*time.Millisecond, "gap was %v", gap)
+			}
+			previous = started
+		case <-time.After(time.Second):
+			t.Fatalf("fn did not run")
+		}
+	}
+
+	cancelStartFunc()
+	wg.Wait()
+}
+
+func TestStartJobRunsAfterDependencies(t *testing.T) {
+	run := func(dependencyCommand string) (*Execution, []*logrus.Entry) {
+		registry := NewRegistry()
+
+		dependency := crontab.Job{
+			CrontabLine: crontab.CrontabLine{
+				Expression: &testExpression{time.Hour},
+				Schedule:   "hourly-ish",
+				Command:    dependencyCommand,
+			},
+			Name: "a",
+		}
+
+		dependent := crontab.Job{
+			CrontabLine: crontab.CrontabLine{
+				Expression: &testExpression{time.Hour},
+				Schedule:   "hourly-ish",
+				Command:    "true",
+			},
+			Name:     "b",
+			Position: 1,
+			After:    []string{"a"},
+		}
+
+		hook := &recordingHook{
+			started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+			finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		}
+
+		var wg sync.WaitGroup
+		ctx, cancel := context.WithCancel(context.Background())
+
+		logger, channel := newTestLogger()
+		options := Options{Hooks: []Hook{hook}, Registry: registry}
+
+		dependencyState := StartJob(&wg, &basicContext, &dependency, ctx, logger, options)
+		registry.Add(dependencyState)
+		dependentState := StartJob(&wg, &basicContext, &dependent, ctx, logger, options)
+		registry.Add(dependentState)
+
+		// The dependent job waits for its dependency to complete.
+		dependentState.Trigger()
+		time.Sleep(50 * time.Millisecond)
+		dependencyState.Trigger()
+
+		var last *Execution
+	wait:
+		for {
+			select {
+			case e := <-hook.finished:
+				last = e
+				if e.Job == &dependent {
+					break wait
+				}
+			case <-time.After(time.Second):
+				break wait
+			}
+		}
+
+		cancel()
+		wg.Wait()
+		close(channel)
+
+		entries := make([]*logrus.Entry, 0)
+		for entry := range channel {
+			entries = append(entries, entry)
+		}
+
+		return last, entries
+	}
+
+	last, _ := run("true")
+	if assert.NotNil(t, last) {
+		assert.Equal(t, "b", last.Job.Name)
+	}
+
+	last, entries := run("false")
+	if assert.NotNil(t, last) {
+		assert.Equal(t, "a", last.Job.Name)
+	}
+
+	skipped := false
+	for _, entry := range entries {
+		if entry.Message == "skipping run: a failed" {
+			skipped = true
+		}
+	}
+	assert.True(t, skipped)
+}
+
+func TestWaitForDependencies(t *testing.T) {
+	registry := NewRegistry()
+	state := newJobState(&basicContext, &crontab.Job{Name: "a"})
+	registry.Add(state)
+
+	logger, _ := newTestLogger()
+	job := &crontab.Job{After: []string{"a"}}
+	since := time.Now()
+
+	err := waitForDependencies(context.Background(), registry, job, since, time.Now().Add(10*time.Millisecond), logger)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "a did not complete before the next run was due", err.Error())
+	}
+
+	state.runFinished(&Execution{StartedAt: since, FinishedAt: time.Now()})
+	assert.Nil(t, waitForDependencies(context.Background(), registry, job, since, time.Time{}, logger))
+
+	// Runs from before the window don't count.
+	err = waitForDependencies(context.Background(), registry, job, time.Now(), time.Now().Add(10*time.Millisecond), logger)
+	assert.NotNil(t, err)
+
+	job.After = []string{"nope"}
+	err = waitForDependencies(context.Background(), registry, job, since, time.Time{}, logger)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "no job is named nope", err.Error())
+	}
+}
+
+type testSecretResolver map[string]string
+
+func (r testSecretResolver) Resolve(secret crontab.Secret) (string, error) {
+	value, ok := r[secret.Source]
+	if !ok {
+		return "", fmt.Errorf("no such secret: %s", secret.Source)
+	}
+	return value, nil
+}
+
+func TestRunJobResolvesSecrets(t *testing.T) {
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{Command: "echo $DB_PASS"},
+		Secrets:     []crontab.Secret{{Name: "DB_PASS", Source: "file:/run/secrets/db"}},
+	}
+
+	cronCtx := &crontab.Context{
+		Shell:   "/bin/sh",
+		Environ: map[string]string{"DB_PASS": "from crontab"},
+	}
+
+	logger, channel := newTestLogger()
+
+	options := Options{Secrets: testSecretResolver{"file:/run/secrets/db": "hunter2"}}
+	_, err := runJob(context.Background(), &jobRun{cronCtx: cronCtx, job: job, logger: logger}, options)
+	assert.Nil(t, err)
+
+	close(channel)
+
+	var messages []string
+	for entry := range channel {
+		if entry.Data["channel"] == "stdout" {
+			messages = append(messages, entry.Message)
+		}
+	}
+	assert.Equal(t, []string{"hunter2"}, messages)
+
+	for _, options := range []Options{{}, {Secrets: testSecretResolver{}}} {
+		logger, _ := newTestLogger()
+
+		_, err := runJob(context.Background(), &jobRun{cronCtx: cronCtx, job: job, logger: logger}, options)
+		if assert.NotNil(t, err) {
+			assert.Contains(t, err.Error(), "failed to resolve secret DB_PASS")
+		}
+	}
+}
+
+func TestRunJobInContainer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The fake docker CLI prints its arguments, and the variable the job
+	// gets.
+	fake := filepath.Join(dir, "docker")
+	if err := ioutil.WriteFile(fake, []byte("#!/bin/sh\necho \"$*\"\necho \"$DB_PASS\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(command string) { docker.DOCKER_COMMAND = command }(docker.DOCKER_COMMAND)
+	docker.DOCKER_COMMAND = fake
+
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{Command: "backup.sh"},
+		Container:   &crontab.Container{Image: "alpine:3.19"},
+		Dir:         "/srv",
+		Env:         map[string]string{"DB_PASS": "hunter2"},
+	}
+
+	cronCtx := &crontab.Context{Shell: "/bin/sh", Environ: map[string]string{}}
+
+	logger, channel := newTestLogger()
+
+	_, err = runJob(context.Background(), &jobRun{cronCtx: cronCtx, job: job, logger: logger}, Options{})
+	assert.Nil(t, err)
+
+	close(channel)
+
+	var messages []string
+	for entry := range channel {
+		if entry.Data["channel"] == "stdout" {
+			messages = append(messages, entry.Message)
+		}
+	}
+
+	assert.Equal(t, []string{
+		"run --rm --workdir /srv --env DB_PASS alpine:3.19 /bin/sh -c backup.sh",
+		"hunter2",
+	}, messages)
+}
+
+func TestRunJobSetsEnvAndDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{Command: "echo $FOO; pwd"},
+		Env:         map[string]string{"FOO": "bar"},
+		Dir:         dir,
+	}
+
+	logger, channel := newTestLogger()
+
+	_, err = runJob(context.Background(), &jobRun{cronCtx: &basicContext, job: job, logger: logger}, Options{})
+	assert.Nil(t, err)
+
+	close(channel)
+
+	lines := make([]string, 0)
+	for entry := range channel {
+		if entry.Data["channel"] == "stdout" {
+			lines = append(lines, entry.Message)
+		}
+	}
+
+	assert.Equal(t, []string{"bar", dir}, lines)
+}
+
+func TestStartJobRetriesFailedRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Fails twice, then succeeds.
+	counter := filepath.Join(dir, "count")
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Hour},
+			Schedule:   "hourly-ish",
+			Command:    fmt.Sprintf("echo x >> %s; test $(wc -l < %s) -ge 3", counter, counter),
+		},
+		Retries:    3,
+		RetryDelay: 10 * time.Millisecond,
+	}
+
+	hook := &recordingHook{
+		started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+	}
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+
+	logger, channel := newTestLogger()
+
+	state := StartJob(&wg, &basicContext, &job, ctx, logger, Options{Hooks: []Hook{hook}})
+	state.Trigger()
+
+	select {
+	case e := <-hook.finished:
+		assert.Nil(t, e.Err)
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for triggered run")
+	}
+
+	cancel()
+	wg.Wait()
+	close(channel)
+
+	retries := 0
+	for entry := range channel {
+		if strings.Contains(entry.Message, ": retrying (") {
+			retries++
+		}
+	}
+
+	assert.Equal(t, 2, retries)
+	assert.Equal(t, 1, len(hook.started))
+}
+
+func TestStartJobClassifiesExitCodes(t *testing.T) {
+	exitCodes := map[int]crontab.ExitCodeClass{
+		1:  crontab.ExitCodeSuccess,
+		3:  crontab.ExitCodeSkipped,
+		75: crontab.ExitCodeRetryable,
+	}
+
+	for _, tt := range []struct {
+		command string
+		failed  bool
+		skipped bool
+		retries int
+	}{
+		{"exit 1", false, false, 0},
+		{"exit 3", false, true, 0},
+		{"exit 75", true, false, 2},
+		{"exit 2", true, false, 0},
+	} {
+		job := crontab.Job{
+			CrontabLine: crontab.CrontabLine{
+				Expression: &testExpression{time.Hour},
+				Schedule:   "hourly-ish",
+				Command:    tt.command,
+			},
+			Retries:    2,
+			RetryDelay: 10 * time.Millisecond,
+			ExitCodes:  exitCodes,
+		}
+
+		hook := &recordingHook{
+			started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+			finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		}
+
+		var wg sync.WaitGroup
+		ctx, cancel := context.WithCancel(context.Background())
+
+		logger, channel := newTestLogger()
+
+		state := StartJob(&wg, &basicContext, &job, ctx, logger, Options{Hooks: []Hook{hook}})
+		state.Trigger()
+
+		select {
+		case e := <-hook.finished:
+			assert.Equal(t, tt.failed, e.Err != nil, tt.command)
+			assert.Equal(t, tt.skipped, e.Skipped, tt.command)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for triggered run")
+		}
+
+		cancel()
+		wg.Wait()
+		close(channel)
+
+		retries := 0
+		errors := 0
+		for entry := range channel {
+			if strings.Contains(entry.Message, ": retrying (") {
+				retries++
+			}
+			if entry.Level == logrus.ErrorLevel {
+				errors++
+			}
+		}
+
+		assert.Equal(t, tt.retries, retries, tt.command)
+		if !tt.failed {
+			assert.Equal(t, 0, errors, tt.command)
+		}
+	}
+}
+
+func TestStartJobTripsCircuitBreaker(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{100 * time.Millisecond},
+			Schedule:   "always!",
+			Command:    "false",
+		},
+		MaxConsecutiveFailures: 2,
+	}
+
+	hook := &recordingHook{
+		started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+	}
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	logger, channel := newTestLogger()
+
+	state := StartJob(&wg, &basicContext, &job, ctx, logger, Options{Hooks: []Hook{hook}})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-hook.finished:
+			assert.Equal(t, i == 1, e.Tripped)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for run %d", i)
+		}
+	}
+
+	assert.True(t, state.IsTripped())
+	assert.Equal(t, 2, state.Status().ConsecutiveFailures)
+
+	// Scheduled runs no longer start.
+	select {
+	case <-hook.finished:
+		t.Fatalf("job ran after its circuit breaker tripped")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	tripped := 0
+	for len(channel) > 0 {
+		entry := <-channel
+		if strings.Contains(entry.Message, "times in a row") {
+			assert.Equal(t, logrus.ErrorLevel, entry.Level)
+			tripped++
+		}
+	}
+	assert.Equal(t, 1, tripped)
+
+	state.ResetCircuitBreaker()
+	assert.False(t, state.IsTripped())
+	assert.Equal(t, 0, state.Status().ConsecutiveFailures)
+
+	select {
+	case e := <-hook.finished:
+		assert.False(t, e.Tripped)
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for run after reset")
+	}
+}
+
+func TestRunJobWithoutShell(t *testing.T) {
+	run := func(job *crontab.Job, options Options) ([]string, error) {
+		logger, channel := newTestLogger()
+
+		_, err := runJob(context.Background(), &jobRun{cronCtx: &basicContext, job: job, logger: logger}, options)
+
+		close(channel)
+
+		lines := make([]string, 0)
+		for entry := range channel {
+			if entry.Data["channel"] == "stdout" {
+				lines = append(lines, entry.Message)
+			}
+		}
+
+		return lines, err
+	}
+
+	job := &crontab.Job{CrontabLine: crontab.CrontabLine{Command: `echo 'a  b' "$0"`}}
+
+	lines, err := run(job, Options{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a  b /bin/sh"}, lines)
+
+	// Without a shell, $0 isn't expanded, which makes the command invalid.
+	_, err = run(job, Options{Exec: crontab.ExecDirect})
+	assert.NotNil(t, err)
+
+	job.Command = `echo 'a  b' '$0'`
+	lines, err = run(job, Options{Exec: crontab.ExecDirect})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a  b $0"}, lines)
+
+	// The job's own mode takes precedence.
+	job.Command = `echo "$0"`
+	job.Exec = crontab.ExecShell
+	lines, err = run(job, Options{Exec: crontab.ExecDirect})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/bin/sh"}, lines)
+}
+
+type overrunHook struct {
+	recordingHook
+	overran chan *Execution
+}
+
+func (h *overrunHook) JobOverran(e *Execution) {
+	h.overran <- e
+}
+
+func TestStartJobReportsOverruns(t *testing.T) {
+	job := crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: &testExpression{time.Hour},
+			Schedule:   "hourly-ish",
+			Command:    "sleep 0.3",
+		},
+		ExpectedDuration: 50 * time.Millisecond,
+	}
+
+	hook := &overrunHook{
+		recordingHook: recordingHook{
+			started:  make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+			finished: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+		},
+		overran: make(chan *Execution, TEST_CHANNEL_BUFFER_SIZE),
+	}
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+
+	logger, channel := newTestLogger()
+
+	state := StartJob(&wg, &basicContext, &job, ctx, logger, Options{Hooks: []Hook{hook}})
+	state.Trigger()
+
+	select {
+	case e := <-hook.overran:
+		assert.Equal(t, "sleep 0.3", e.Job.Command)
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for overrun")
+	}
+
+	select {
+	case e := <-hook.finished:
+		assert.Nil(t, e.Err)
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for run")
+	}
+
+	cancel()
+	wg.Wait()
+	close(channel)
+
+	warned := false
+	for entry := range channel {
+		if entry.Message == "job has been running for longer than expected (50ms)" {
+			warned = true
+		}
+	}
+	assert.True(t, warned)
+}
+
+func TestRunJobPassesRawOutputThrough(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	oldStdout, oldStderr := passthroughStdout, passthroughStderr
+	passthroughStdout, passthroughStderr = &stdout, &stderr
+	defer func() { passthroughStdout, passthroughStderr = oldStdout, oldStderr }()
+
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Command: `echo '{"a": 1}'; printf 'tab\tseparated\n' >&2`,
+		},
+	}
+
+	for _, tt := range []struct {
+		options Options
+		format  crontab.OutputFormat
+	}{
+		{Options{Output: crontab.OutputRaw}, ""},
+		{Options{Output: crontab.OutputJSON}, crontab.OutputRaw},
+	} {
+		stdout.Reset()
+		stderr.Reset()
+
+		j := *job
+		j.Output = tt.format
+
+		logger, channel := newTestLogger()
+
+		_, err := runJob(context.Background(), &jobRun{cronCtx: &basicContext, job: &j, logger: logger}, tt.options)
+		assert.Nil(t, err)
+
+		close(channel)
+
+		messages := make([]string, 0)
+		for entry := range channel {
+			if entry.Data["channel"] != nil {
+				messages = append(messages, entry.Message)
+			}
+		}
+
+		assert.Equal(t, []string{}, messages)
+		assert.Equal(t, "{\"a\": 1}\n", stdout.String())
+		assert.Equal(t, "tab\tseparated\n", stderr.String())
+	}
+}
@@ -0,0 +1,117 @@
+package cron
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"supercronic/crontab"
+)
+
+var (
+	// RESTART_MIN_BACKOFF is how long @always jobs wait to be restarted
+	// after they exit. The wait doubles every time they exit again, up to
+	// RESTART_MAX_BACKOFF. Runs that last longer than that reset it.
+	RESTART_MIN_BACKOFF = time.Second
+	RESTART_MAX_BACKOFF = time.Minute
+)
+
+// nextBackoff returns how long to wait before restarting a job whose last run
+// lasted duration, and which waited backoff before that run (0 if it didn't).
+func nextBackoff(backoff time.Duration, duration time.Duration) time.Duration {
+	if backoff == 0 || duration > RESTART_MAX_BACKOFF {
+		return RESTART_MIN_BACKOFF
+	}
+
+	backoff *= 2
+	if backoff > RESTART_MAX_BACKOFF {
+		backoff = RESTART_MAX_BACKOFF
+	}
+	return backoff
+}
+
+// startDaemon runs fn right away, and again whenever it returns, per policy
+// and with an exponential backoff, until exitCtx is done. Triggering state
+// restarts the job right away.
+func startDaemon(wg *sync.WaitGroup, exitCtx context.Context, logger *logrus.Entry, state *JobState, policy crontab.RestartPolicy, fn func(time.Time, uint64, *logrus.Entry)) {
+	if policy == "" {
+		policy = crontab.RestartAlways
+	}
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		var iteration uint64
+		var backoff time.Duration
+		triggered := false
+
+		for {
+			// Like scheduled runs, restarts are skipped while the job is
+			// paused or tripped, but manual runs aren't.
+			if !triggered && state.IsPaused() {
+				logger.Info("job is paused, not restarting it")
+				backoff = nextBackoff(backoff, 0)
+			} else if !triggered && state.IsTripped() {
+				logger.Info("job's circuit breaker is tripped, not restarting it")
+				backoff = nextBackoff(backoff, 0)
+			} else {
+				startedAt := time.Now()
+
+				fn(startedAt, iteration, logger.WithFields(logrus.Fields{
+					"iteration": iteration,
+				}))
+				iteration++
+
+				if exitCtx.Err() != nil {
+					logger.Debug("shutting down")
+					return
+				}
+
+				// Runs that didn't start (e.g. because a dependency
+				// failed) count as failures.
+				execution, _ := state.LatestExecution()
+				succeeded := execution != nil && !execution.StartedAt.Before(startedAt) && execution.Err == nil
+
+				backoff = nextBackoff(backoff, time.Since(startedAt))
+
+				if policy == crontab.RestartNever || (policy == crontab.RestartOnFailure && succeeded) {
+					logger.Infof("job exited, not restarting it (restart policy: %s)", policy)
+					state.setNextRun(time.Time{})
+
+					select {
+					case <-exitCtx.Done():
+						logger.Debug("shutting down")
+						return
+					case <-state.trigger:
+						logger.Info("job triggered manually")
+						triggered = true
+						backoff = 0
+						continue
+					}
+				}
+
+				logger.Infof("job exited, restarting it in %v", backoff)
+			}
+
+			triggered = false
+			state.setNextRun(time.Now().Add(backoff))
+
+			timer := time.NewTimer(backoff)
+
+			select {
+			case <-exitCtx.Done():
+				timer.Stop()
+				logger.Debug("shutting down")
+				return
+			case <-state.trigger:
+				timer.Stop()
+				logger.Info("job triggered manually")
+				triggered = true
+			case <-timer.C:
+			}
+		}
+	}()
+}
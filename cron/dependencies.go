@@ -0,0 +1,50 @@
+package cron
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"supercronic/crontab"
+)
+
+// waitForDependencies waits for the jobs that job runs after to complete a
+// run in the window that started at since. It gives up at deadline (when the
+// next run of job is due), unless deadline is zero. It returns an error
+// explaining why the run should be skipped, if it should be.
+func waitForDependencies(exitCtx context.Context, registry *Registry, job *crontab.Job, since time.Time, deadline time.Time, jobLogger *logrus.Entry) error {
+	ctx := exitCtx
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(exitCtx, deadline)
+		defer cancel()
+	}
+
+	for _, name := range job.After {
+		var dependency *JobState
+		if registry != nil {
+			dependency = registry.JobByName(name)
+		}
+
+		if dependency == nil {
+			return fmt.Errorf("no job is named %s", name)
+		}
+
+		jobLogger.Debugf("waiting for %s to complete", name)
+
+		status, err := dependency.waitForRun(ctx, since)
+		if err != nil {
+			if exitCtx.Err() != nil {
+				return fmt.Errorf("shutting down")
+			}
+			return fmt.Errorf("%s did not complete before the next run was due", name)
+		}
+
+		if !status.Succeeded {
+			return fmt.Errorf("%s failed", name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,245 @@
+package cron
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// OUTPUT_QUEUE_SIZE is how many chunks of output a job's streams may be
+	// read ahead of its output writer. Once that many are queued, they stop
+	// being read, so that the job blocks writing output instead of
+	// supercronic buffering it.
+	OUTPUT_QUEUE_SIZE = 64
+)
+
+// Output that jobs pass through goes to supercronic's own stdout and stderr,
+// one chunk at a time, so that chunks from jobs running concurrently don't
+// get mixed up.
+var (
+	passthroughMu     sync.Mutex
+	passthroughStdout io.Writer = os.Stdout
+	passthroughStderr io.Writer = os.Stderr
+)
+
+// passthroughWriter writes to passthroughStdout or passthroughStderr, per
+// channel.
+type passthroughWriter string
+
+func (channel passthroughWriter) Write(p []byte) (int, error) {
+	passthroughMu.Lock()
+	defer passthroughMu.Unlock()
+
+	if channel == "stderr" {
+		return passthroughStderr.Write(p)
+	}
+	return passthroughStdout.Write(p)
+}
+
+// Output is read into buffers that are recycled across jobs and runs, since
+// jobs that write a lot of output would otherwise allocate (and collect)
+// buffers at the same rate.
+var (
+	readerPool sync.Pool
+	chunkPool  = sync.Pool{New: func() interface{} { return new(outputChunk) }}
+)
+
+func getReader(reader io.Reader) *bufio.Reader {
+	// READ_BUFFER_SIZE may have changed since pooled readers were created.
+	if bufReader, ok := readerPool.Get().(*bufio.Reader); ok && bufReader.Size() == READ_BUFFER_SIZE {
+		bufReader.Reset(reader)
+		return bufReader
+	}
+	return bufio.NewReaderSize(reader, READ_BUFFER_SIZE)
+}
+
+func putReader(bufReader *bufio.Reader) {
+	bufReader.Reset(nil)
+	readerPool.Put(bufReader)
+}
+
+// outputStream is one of a job's output streams, i.e. stdout or stderr.
+type outputStream struct {
+	channel string
+	logger  *logrus.Entry
+	// raw gets the stream as is, if set.
+	raw io.Writer
+	// passthrough also gets the stream as is, if set, in which case lines
+	// aren't logged.
+	passthrough io.Writer
+	lines       *lineAssembler
+}
+
+// outputChunk is a fragment of a line read from a stream (see
+// bufio.Reader.ReadLine), or the end of the stream if eof is set.
+type outputChunk struct {
+	stream   *outputStream
+	data     []byte
+	isPrefix bool
+	eof      bool
+}
+
+// outputWriter copies a job's output to where it goes: the logs, the
+// job's Output, and its files. Its streams are each read by a goroutine of
+// their own, but written by a single one, so that writes don't need to be
+// synchronized, and lines from different streams don't get interleaved.
+type outputWriter struct {
+	chunks  chan *outputChunk
+	readers sync.WaitGroup
+	done    chan struct{}
+
+	output  *Output
+	logFile io.Writer
+	logLine func(readerLogger *logrus.Entry, channel string, line string)
+}
+
+func startOutputWriter(output *Output, logFile io.Writer, logLine func(*logrus.Entry, string, string)) *outputWriter {
+	w := &outputWriter{
+		chunks:  make(chan *outputChunk, OUTPUT_QUEUE_SIZE),
+		done:    make(chan struct{}),
+		output:  output,
+		logFile: logFile,
+		logLine: logLine,
+	}
+
+	go w.run()
+
+	return w
+}
+
+// drain reads the stream written to channel from reader, until it is closed.
+func (w *outputWriter) drain(readerLogger *logrus.Entry, reader io.ReadCloser, channel string, rawFile io.Writer, passthrough io.Writer, lines *lineAssembler) {
+	stream := &outputStream{channel: channel, logger: readerLogger, raw: rawFile, passthrough: passthrough, lines: lines}
+
+	w.readers.Add(1)
+
+	go func() {
+		defer func() {
+			if err := reader.Close(); err != nil {
+				readerLogger.Errorf("failed to close pipe: %v", err)
+			}
+			w.chunks <- &outputChunk{stream: stream, eof: true}
+			w.readers.Done()
+		}()
+
+		bufReader := getReader(reader)
+		defer putReader(bufReader)
+
+		for {
+			fragment, isPrefix, err := bufReader.ReadLine()
+
+			if err != nil {
+				if strings.Contains(err.Error(), os.ErrClosed.Error()) {
+					// The underlying reader might get
+					// closed by e.g. Wait(), or even the
+					// process we're starting, so we don't
+					// log this.
+				} else if err == io.EOF {
+					// EOF, we don't need to log this
+				} else {
+					// Unexpected error: log it
+					readerLogger.Errorf("failed to read pipe: %v", err)
+				}
+
+				break
+			}
+
+			// The fragment is only valid until the next read.
+			chunk := chunkPool.Get().(*outputChunk)
+			chunk.stream = stream
+			chunk.data = append(chunk.data[:0], fragment...)
+			chunk.isPrefix = isPrefix
+			chunk.eof = false
+
+			w.chunks <- chunk
+		}
+	}()
+}
+
+// Wait waits for all streams to be drained, and their output written.
+func (w *outputWriter) Wait() {
+	w.readers.Wait()
+	close(w.chunks)
+	<-w.done
+}
+
+func (w *outputWriter) run() {
+	defer close(w.done)
+
+	for chunk := range w.chunks {
+		w.write(chunk)
+
+		// Don't hold on to buffers that grew unusually large.
+		if !chunk.eof && cap(chunk.data) <= 2*READ_BUFFER_SIZE {
+			chunk.stream = nil
+			chunkPool.Put(chunk)
+		}
+	}
+}
+
+func (w *outputWriter) write(chunk *outputChunk) {
+	stream := chunk.stream
+
+	if chunk.eof {
+		if line, truncated, ok := stream.lines.flush(); ok {
+			w.writeLine(stream, line, truncated)
+		}
+		return
+	}
+
+	raw := chunk.data
+	if !chunk.isPrefix {
+		raw = append(raw, '\n')
+	}
+
+	w.output.countBytes(stream.channel, len(raw))
+
+	// Raw files get the output as is, regardless of how long lines are
+	// logged.
+	if stream.raw != nil {
+		if _, err := stream.raw.Write(raw); err != nil {
+			stream.logger.Errorf("failed to write to %s file, no longer copying output to it: %v", stream.channel, err)
+			stream.raw = nil
+		}
+	}
+
+	if stream.passthrough != nil {
+		if _, err := stream.passthrough.Write(raw); err != nil {
+			stream.logger.Errorf("failed to pass %s through, logging it instead: %v", stream.channel, err)
+			stream.passthrough = nil
+		}
+	}
+
+	if line, truncated, ok := stream.lines.add(chunk.data, chunk.isPrefix); ok {
+		w.writeLine(stream, line, truncated)
+		if chunk.isPrefix && stream.passthrough == nil {
+			stream.logger.Warn("last line exceeded buffer size, continuing...")
+		}
+	}
+}
+
+func (w *outputWriter) writeLine(stream *outputStream, line []byte, truncated bool) {
+	text := string(line)
+
+	if stream.passthrough == nil {
+		w.logLine(stream.logger, stream.channel, text)
+	}
+	w.output.Append(stream.channel, text)
+
+	if w.logFile != nil {
+		if _, err := w.logFile.Write(append(line, '\n')); err != nil {
+			// Don't log this for every line
+			stream.logger.Errorf("failed to write to log file, no longer copying output to it: %v", err)
+			w.logFile = nil
+		}
+	}
+
+	if truncated && stream.passthrough == nil {
+		stream.logger.Warnf("last line exceeded %d bytes, truncated", stream.lines.max)
+	}
+}
@@ -0,0 +1,54 @@
+package cron
+
+import (
+	"os"
+	"strings"
+)
+
+// CLEAN_ENV_VARIABLES are the variables from supercronic's environment jobs
+// still get when it is cleaned (see Options.CleanEnv). Entries ending with *
+// match variables by prefix.
+var CLEAN_ENV_VARIABLES = []string{
+	"PATH",
+	"HOME",
+	"USER",
+	"LOGNAME",
+	"HOSTNAME",
+	"LANG",
+	"LANGUAGE",
+	"LC_*",
+	"TZ",
+	"TMPDIR",
+	"TERM",
+}
+
+// ProcessEnviron returns the variables jobs get from supercronic's own
+// environment: all of them, or only CLEAN_ENV_VARIABLES if clean is set.
+func ProcessEnviron(clean bool) []string {
+	env := os.Environ()
+	if !clean {
+		return env
+	}
+
+	kept := make([]string, 0, len(CLEAN_ENV_VARIABLES))
+	for _, kv := range env {
+		if isCleanEnvVariable(strings.SplitN(kv, "=", 2)[0]) {
+			kept = append(kept, kv)
+		}
+	}
+
+	return kept
+}
+
+func isCleanEnvVariable(key string) bool {
+	for _, pattern := range CLEAN_ENV_VARIABLES {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(key, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if key == pattern {
+			return true
+		}
+	}
+	return false
+}
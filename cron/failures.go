@@ -0,0 +1,51 @@
+package cron
+
+import (
+	"sync"
+)
+
+// FailureTracker is a Hook that keeps track of job failures, so that
+// supercronic can report them through its own exit status.
+type FailureTracker struct {
+	// Failed is closed when a job fails for the first time.
+	Failed chan struct{}
+
+	once     sync.Once
+	mu       sync.Mutex
+	exitCode int
+}
+
+func NewFailureTracker() *FailureTracker {
+	return &FailureTracker{Failed: make(chan struct{})}
+}
+
+func (t *FailureTracker) JobStarted(e *Execution) {}
+
+func (t *FailureTracker) JobFinished(e *Execution) {
+	if e.Err == nil {
+		return
+	}
+
+	// Jobs that didn't exit normally still need to be reported as a failure.
+	exitCode := e.ExitCode
+	if exitCode <= 0 {
+		exitCode = 1
+	}
+
+	t.once.Do(func() {
+		t.mu.Lock()
+		t.exitCode = exitCode
+		t.mu.Unlock()
+
+		close(t.Failed)
+	})
+}
+
+// ExitCode returns the exit code of the first job that failed, or 1 if it
+// did not exit normally. It returns 0 if no job failed. Jobs that fail later
+// (e.g. because they were terminated on shutdown) don't change it.
+func (t *FailureTracker) ExitCode() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.exitCode
+}
@@ -0,0 +1,231 @@
+package cron
+
+import (
+	"regexp"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"supercronic/crontab"
+	"supercronic/platform"
+)
+
+// Execution describes a single run of a job.
+type Execution struct {
+	Job         *crontab.Job
+	Context     *crontab.Context
+	Logger      *logrus.Entry
+	Iteration   uint64
+	ScheduledAt time.Time
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	Err         error
+	Output      *Output
+
+	// ExitCode is the job's exit code, or -1 if it did not exit normally
+	// (e.g. it couldn't be started, or was killed by a signal).
+	ExitCode int
+
+	// Tripped is set when the job's circuit breaker is tripped as of the
+	// end of this run (see crontab.Job.MaxConsecutiveFailures).
+	Tripped bool
+
+	// Skipped is set when the job exited with a code it classifies as
+	// skipped (see crontab.ExitCodeSkipped). Err is nil then.
+	Skipped bool
+
+	// OutputURL is where the output was archived, if it was (see Archiver).
+	OutputURL string
+
+	mu sync.Mutex
+	// pgid is the process group of the attempt in progress, if any.
+	pgid int
+}
+
+func (e *Execution) setProcessGroup(pgid int) {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pgid = pgid
+}
+
+// signal sends sig to the process group of the attempt in progress. It
+// reports whether there was one.
+func (e *Execution) signal(sig syscall.Signal) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.pgid == 0 {
+		return false, nil
+	}
+	return true, platform.SignalProcessGroup(e.pgid, sig)
+}
+
+// Duration returns how long the execution took (or has taken so far).
+func (e *Execution) Duration() time.Duration {
+	if e.FinishedAt.IsZero() {
+		return time.Since(e.StartedAt)
+	}
+	return e.FinishedAt.Sub(e.StartedAt)
+}
+
+// RunEnviron returns the variables that describe e to the job it runs, so that
+// scripts can tell which run they are part of (e.g. to compute the window
+// they process) without relying on the current time.
+func RunEnviron(e *Execution) []string {
+	return []string{
+		"SUPERCRONIC_JOB_NAME=" + e.Job.Name,
+		"SUPERCRONIC_JOB_POSITION=" + strconv.Itoa(e.Job.Position),
+		"SUPERCRONIC_ITERATION=" + strconv.FormatUint(e.Iteration, 10),
+		"SUPERCRONIC_SCHEDULED_AT=" + e.ScheduledAt.Format(time.RFC3339),
+		"SUPERCRONIC_SCHEDULED_AT_UNIX=" + strconv.FormatInt(e.ScheduledAt.Unix(), 10),
+	}
+}
+
+// Hook is notified when job executions start and finish. Hooks are called
+// synchronously from the goroutine running the job, so they should not block
+// for long.
+type Hook interface {
+	JobStarted(e *Execution)
+	JobFinished(e *Execution)
+}
+
+// OverrunHook is implemented by hooks that also want to know when a run takes
+// longer than its job's expected duration. JobOverran is called while the job
+// is still running.
+type OverrunHook interface {
+	JobOverran(e *Execution)
+}
+
+// Lock is held for the duration of a job run.
+type Lock interface {
+	Release()
+}
+
+// Locker coordinates runs of a job across multiple supercronic replicas, so
+// that each scheduled run happens on only one of them.
+type Locker interface {
+	// Acquire returns a nil Lock if another replica holds the lock for this
+	// run of job.
+	Acquire(job *crontab.Job, scheduledAt time.Time) (Lock, error)
+}
+
+// SecretResolver resolves the secrets of jobs when they run.
+type SecretResolver interface {
+	// Resolve returns the value of secret. Errors must not include it.
+	Resolve(secret crontab.Secret) (string, error)
+}
+
+// Archiver stores the output of runs once they finish, before hooks are
+// notified.
+type Archiver interface {
+	// Archive returns the URL of the archived output of e.
+	Archive(e *Execution) (string, error)
+}
+
+// Options controls how jobs are scheduled and run.
+type Options struct {
+	// Overlap determines what to do when a run is due while the job is
+	// still running. It defaults to crontab.OverlapSkip.
+	Overlap crontab.OverlapPolicy
+
+	// Jitter is the maximum random delay to add to scheduled runs, unless
+	// the job sets its own.
+	Jitter time.Duration
+
+	// Exec determines how commands are run, unless the job sets its own
+	// mode. It defaults to crontab.ExecShell.
+	Exec crontab.ExecMode
+
+	// QuietSuccess suppresses the output of jobs that succeed. It is
+	// logged after the fact if they fail instead.
+	QuietSuccess bool
+
+	// Output is the format of the output of jobs that don't set their own.
+	// It defaults to crontab.OutputText.
+	Output crontab.OutputFormat
+
+	// LongLines determines how lines of output longer than
+	// READ_BUFFER_SIZE are logged. It defaults to LongLinesSplit.
+	// MaxLineSize caps the length of lines with LongLinesAccumulate (see
+	// DEFAULT_MAX_LINE_SIZE).
+	LongLines   LongLinePolicy
+	MaxLineSize int
+
+	// StderrLevel is the level lines written to stderr are logged at,
+	// unless the job sets its own. It defaults to crontab.OutputLevelInfo.
+	// Lines of output that match ErrorPattern or WarningPattern (unless the
+	// job sets its own) are logged as errors or warnings instead.
+	StderrLevel    crontab.OutputLevel
+	ErrorPattern   *regexp.Regexp
+	WarningPattern *regexp.Regexp
+
+	// CleanEnv runs jobs with the variables set in the crontab, but only
+	// CLEAN_ENV_VARIABLES from supercronic's own environment.
+	CleanEnv bool
+
+	// Hooks are notified of every execution.
+	Hooks []Hook
+
+	// Archiver, if set, archives the output of every execution.
+	Archiver Archiver
+
+	// CatchUp determines what to do about runs that were missed between
+	// LastRun (e.g. as recorded before a restart) and now. Nothing is caught
+	// up if LastRun is zero.
+	CatchUp crontab.CatchUpPolicy
+	LastRun time.Time
+
+	// LastSuccess, if set, is when the last run of the job that succeeded
+	// was due (e.g. as recorded before a restart). Runs due in the same
+	// window of the schedule are skipped.
+	LastSuccess time.Time
+
+	// RunAtStartup runs the job right away, before its first scheduled run,
+	// unless it caught up on runs it missed.
+	RunAtStartup bool
+
+	// StartupDelay defers scheduling the job (including runs at startup)
+	// until this long after StartedAt, unless the job sets its own delay.
+	// If StartedAt is zero, the delay counts from when the job is started.
+	// Jobs started once the delay is over (e.g. after a reload) are
+	// scheduled right away.
+	StartupDelay time.Duration
+	StartedAt    time.Time
+
+	// Locker, if set, must grant a lock before each run of the job.
+	Locker Locker
+
+	// Secrets resolves the job's secrets. Jobs with secrets fail to run if
+	// it isn't set.
+	Secrets SecretResolver
+
+	// Limiter, if set, must grant a slot before each run of the job. It is
+	// meant to be shared by all jobs.
+	Limiter *Limiter
+
+	// CgroupParent, if set, is a cgroup v2 under which jobs with limits run
+	// in a cgroup of their own.
+	CgroupParent string
+
+	// Registry is where the jobs a job runs after (per its after directive)
+	// are looked up.
+	Registry *Registry
+
+	// Previous, if set, is the state of the same job before the crontab was
+	// reloaded. Its runs that are still in progress count as previous
+	// instances of the job for the overlap policy.
+	Previous *JobState
+
+	// RunOnce runs the job a single time, once it is triggered (see
+	// JobState.Trigger), instead of scheduling it. Runs that are skipped
+	// (e.g. because a job they run after failed) are recorded as failed, so
+	// that the jobs that run after them don't wait forever.
+	RunOnce bool
+}
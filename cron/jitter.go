@@ -0,0 +1,26 @@
+package cron
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Replicas sharing a crontab should not pick the same delays, so this is
+// seeded rather than using the (deterministic) default source.
+var jitterRand = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// randomJitter returns a random duration in [0, max).
+func randomJitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	jitterRand.Lock()
+	defer jitterRand.Unlock()
+
+	return time.Duration(jitterRand.Int63n(int64(max)))
+}
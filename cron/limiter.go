@@ -0,0 +1,78 @@
+package cron
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Limiter caps how many jobs may run at once, across all jobs that share it.
+// Runs over the limit wait for a slot, in the order they arrived.
+type Limiter struct {
+	slots chan struct{}
+
+	mu      sync.Mutex
+	waiting int
+	queued  uint64
+}
+
+// LimiterStats is a point-in-time snapshot of a Limiter.
+type LimiterStats struct {
+	Limit   int `json:"limit"`
+	Running int `json:"running"`
+	// Waiting is how many runs are currently waiting for a slot.
+	Waiting int `json:"waiting"`
+	// Queued is how many runs have had to wait for a slot so far.
+	Queued uint64 `json:"queued_total"`
+}
+
+func NewLimiter(limit int) *Limiter {
+	return &Limiter{slots: make(chan struct{}, limit)}
+}
+
+// Acquire waits for a slot to be available. It returns false if ctx is done
+// first, in which case there is nothing to release.
+func (l *Limiter) Acquire(ctx context.Context, jobLogger *logrus.Entry) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	l.mu.Lock()
+	l.waiting++
+	l.queued++
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		l.waiting--
+		l.mu.Unlock()
+	}()
+
+	jobLogger.Infof("too many jobs running (limit: %d), waiting for a slot", cap(l.slots))
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (l *Limiter) Release() {
+	<-l.slots
+}
+
+func (l *Limiter) Stats() LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return LimiterStats{
+		Limit:   cap(l.slots),
+		Running: len(l.slots),
+		Waiting: l.waiting,
+		Queued:  l.queued,
+	}
+}
@@ -0,0 +1,100 @@
+package cron
+
+import (
+	"fmt"
+)
+
+// LongLinePolicy determines what happens to lines of output that don't fit
+// in READ_BUFFER_SIZE.
+type LongLinePolicy string
+
+const (
+	// LongLinesSplit logs long lines in READ_BUFFER_SIZE fragments.
+	LongLinesSplit LongLinePolicy = "split"
+	// LongLinesTruncate logs their first READ_BUFFER_SIZE bytes, followed by
+	// a marker.
+	LongLinesTruncate LongLinePolicy = "truncate"
+	// LongLinesAccumulate logs long lines whole, up to Options.MaxLineSize
+	// bytes. Lines that are even longer are truncated.
+	LongLinesAccumulate LongLinePolicy = "accumulate"
+)
+
+func ParseLongLinePolicy(value string) (LongLinePolicy, error) {
+	switch policy := LongLinePolicy(value); policy {
+	case LongLinesSplit, LongLinesTruncate, LongLinesAccumulate:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown long line policy: %q (expected split, truncate, or accumulate)", value)
+}
+
+// DEFAULT_MAX_LINE_SIZE is how long lines get with LongLinesAccumulate,
+// unless Options.MaxLineSize is set.
+var DEFAULT_MAX_LINE_SIZE = 1024 * 1024
+
+// lineAssembler puts lines of output back together from the fragments
+// bufio.Reader.ReadLine returns, per a LongLinePolicy. The lines it returns
+// are only valid until it is next called, since their buffer is reused.
+type lineAssembler struct {
+	policy  LongLinePolicy
+	max     int
+	line    []byte
+	pending bool
+	dropped int
+}
+
+func newLineAssembler(policy LongLinePolicy, maxLineSize int) *lineAssembler {
+	max := maxLineSize
+	if policy == LongLinesTruncate {
+		max = READ_BUFFER_SIZE
+	} else if max <= 0 {
+		max = DEFAULT_MAX_LINE_SIZE
+	}
+
+	return &lineAssembler{policy: policy, max: max}
+}
+
+// add adds a fragment of a line, which isPrefix is true for unless it ends
+// the line. Once there is a line to log, it returns it and whether it was
+// truncated, and ok is set. Lines may be empty (and nil).
+func (a *lineAssembler) add(fragment []byte, isPrefix bool) (line []byte, truncated bool, ok bool) {
+	// Most lines fit in a single fragment.
+	if a.policy == "" || a.policy == LongLinesSplit || !a.pending && !isPrefix {
+		return fragment, false, true
+	}
+
+	if !a.pending {
+		a.line = a.line[:0]
+		a.pending = true
+	}
+
+	if room := a.max - len(a.line); room >= len(fragment) {
+		a.line = append(a.line, fragment...)
+	} else {
+		if room > 0 {
+			a.line = append(a.line, fragment[:room]...)
+		}
+		a.dropped += len(fragment) - room
+	}
+
+	if isPrefix {
+		return nil, false, false
+	}
+
+	return a.flush()
+}
+
+// flush returns the line assembled so far, if any (see add).
+func (a *lineAssembler) flush() (line []byte, truncated bool, ok bool) {
+	if !a.pending {
+		return nil, false, false
+	}
+
+	dropped := a.dropped
+	a.pending, a.dropped = false, 0
+
+	if dropped > 0 {
+		a.line = append(a.line, fmt.Sprintf(" [truncated %d bytes]", dropped)...)
+	}
+
+	return a.line, dropped > 0, true
+}
@@ -0,0 +1,205 @@
+package cron
+
+import (
+	"bytes"
+	"sync"
+)
+
+var (
+	// MAX_CAPTURED_OUTPUT bounds how much of a job's output is kept in
+	// memory for hooks. Once exceeded, the oldest lines are discarded.
+	MAX_CAPTURED_OUTPUT = 256 * 1024
+)
+
+type OutputLine struct {
+	Channel string
+	Text    string
+}
+
+// Output captures the most recent lines a job wrote to stdout and stderr.
+// All methods are safe to call on a nil *Output.
+type Output struct {
+	mu        sync.Mutex
+	lines     []OutputLine
+	size      int
+	truncated bool
+
+	// appended counts the lines appended so far, including discarded ones.
+	appended int
+	// written counts the bytes the job wrote to each channel, counting a
+	// newline at the end of every line.
+	written map[string]int64
+	closed  bool
+	// changed is closed (and replaced) whenever a line is appended, or the
+	// output is closed.
+	changed chan struct{}
+}
+
+// Append records a line written to channel.
+func (o *Output) Append(channel string, text string) {
+	if o == nil {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.lines = append(o.lines, OutputLine{Channel: channel, Text: text})
+	o.size += len(text)
+	o.appended++
+
+	for o.size > MAX_CAPTURED_OUTPUT && len(o.lines) > 1 {
+		o.size -= len(o.lines[0].Text)
+		o.lines = o.lines[1:]
+		o.truncated = true
+	}
+
+	o.notify()
+}
+
+// countBytes records that the job wrote n bytes to channel.
+func (o *Output) countBytes(channel string, n int) {
+	if o == nil {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.written == nil {
+		o.written = make(map[string]int64)
+	}
+	o.written[channel] += int64(n)
+}
+
+// Bytes returns how many bytes the job wrote to channel ("stdout" or
+// "stderr"), including lines that were discarded or not logged.
+func (o *Output) Bytes(channel string) int64 {
+	if o == nil {
+		return 0
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.written[channel]
+}
+
+// Close records that the job is done writing output.
+func (o *Output) Close() {
+	if o == nil {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.closed = true
+	o.notify()
+}
+
+func (o *Output) notify() {
+	if o.changed != nil {
+		close(o.changed)
+		o.changed = nil
+	}
+}
+
+// Since returns the lines appended after the first n, and the number of
+// lines to pass to the next call. Lines that were already discarded are
+// skipped. Unless the output is closed, the returned channel is closed when
+// more lines are available (or the output is closed). This lets callers
+// follow the output of a job while it runs.
+func (o *Output) Since(n int) ([]OutputLine, int, <-chan struct{}, bool) {
+	if o == nil {
+		return nil, n, nil, true
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	first := o.appended - len(o.lines)
+	if n < first {
+		n = first
+	}
+
+	lines := make([]OutputLine, o.appended-n)
+	copy(lines, o.lines[n-first:])
+
+	if o.closed {
+		return lines, o.appended, nil, true
+	}
+
+	if o.changed == nil {
+		o.changed = make(chan struct{})
+	}
+
+	return lines, o.appended, o.changed, false
+}
+
+// Lines returns a copy of the captured lines, in the order they were read.
+func (o *Output) Lines() []OutputLine {
+	if o == nil {
+		return nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	lines := make([]OutputLine, len(o.lines))
+	copy(lines, o.lines)
+	return lines
+}
+
+// Len returns the number of captured lines.
+func (o *Output) Len() int {
+	if o == nil {
+		return 0
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return len(o.lines)
+}
+
+// Truncated reports whether older lines were discarded.
+func (o *Output) Truncated() bool {
+	if o == nil {
+		return false
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.truncated
+}
+
+// Tail returns the last n lines written to channel ("stdout" or "stderr"),
+// or to either channel if channel is empty.
+func (o *Output) Tail(channel string, n int) []string {
+	tail := make([]string, 0, n)
+
+	lines := o.Lines()
+	for i := len(lines) - 1; i >= 0 && len(tail) < n; i-- {
+		if channel == "" || lines[i].Channel == channel {
+			tail = append(tail, lines[i].Text)
+		}
+	}
+
+	for i, j := 0, len(tail)-1; i < j; i, j = i+1, j-1 {
+		tail[i], tail[j] = tail[j], tail[i]
+	}
+
+	return tail
+}
+
+// String returns the captured lines joined with newlines.
+func (o *Output) String() string {
+	var buf bytes.Buffer
+	for _, line := range o.Lines() {
+		buf.WriteString(line.Text)
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
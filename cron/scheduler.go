@@ -0,0 +1,276 @@
+package cron
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MAX_WORKERS is how many runs the scheduler of startFunc runs at once. Runs
+// that are due while all workers are busy wait in a queue.
+var MAX_WORKERS = 256
+
+// timerEntry is a call to fire, once the wall clock reaches at.
+type timerEntry struct {
+	at   time.Time
+	fire func(jump time.Duration)
+
+	// logger, if set, is told when the wall clock jumps before at.
+	logger *logrus.Entry
+
+	index int
+}
+
+// timerHeap orders entries by when they are due (see container/heap).
+type timerHeap []*timerEntry
+
+func (h timerHeap) Len() int           { return len(h) }
+func (h timerHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+
+func (h timerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *timerHeap) Push(x interface{}) {
+	e := x.(*timerEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *timerHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	e.index = -1
+	*h = old[:len(old)-1]
+	return e
+}
+
+// scheduler waits for the next runs of all jobs from a single goroutine, with
+// one timer for the earliest of them, and runs jobs on a pool of at most
+// maxWorkers workers.
+//
+// Go timers use the monotonic clock, which the wall clock may jump away from:
+// when it's stepped (e.g. by NTP), or when the system resumes from suspend
+// (the monotonic clock doesn't count time spent suspended). So the scheduler
+// checks the wall clock (per now) at least every checkInterval. Entries the
+// wall clock jumps past are fired with how far it jumped, since runs in
+// between were missed rather than due.
+type scheduler struct {
+	now           func() time.Time
+	checkInterval time.Duration
+	maxWorkers    int
+
+	start sync.Once
+	wake  chan struct{}
+
+	mu       sync.Mutex
+	timers   timerHeap
+	watchers map[<-chan struct{}][]func()
+
+	// queue holds the runs waiting for a worker, and workers counts the
+	// workers that are running.
+	queue   []func()
+	workers int
+}
+
+func newScheduler(now func() time.Time, checkInterval time.Duration, maxWorkers int) *scheduler {
+	return &scheduler{
+		now:           now,
+		checkInterval: checkInterval,
+		maxWorkers:    maxWorkers,
+		wake:          make(chan struct{}, 1),
+		watchers:      make(map[<-chan struct{}][]func()),
+	}
+}
+
+var (
+	defaultScheduler     *scheduler
+	defaultSchedulerOnce sync.Once
+)
+
+// sharedScheduler returns the scheduler of startFunc. It is created on first
+// use, so that MAX_WORKERS can be set before.
+func sharedScheduler() *scheduler {
+	defaultSchedulerOnce.Do(func() {
+		defaultScheduler = newScheduler(wallClockNow, CLOCK_CHECK_INTERVAL, MAX_WORKERS)
+	})
+	return defaultScheduler
+}
+
+// add calls fire once the wall clock reaches at. The returned entry can be
+// passed to remove until then.
+func (s *scheduler) add(at time.Time, logger *logrus.Entry, fire func(time.Duration)) *timerEntry {
+	s.start.Do(func() { go s.run() })
+
+	e := &timerEntry{at: at, fire: fire, logger: logger}
+
+	s.mu.Lock()
+	heap.Push(&s.timers, e)
+	earliest := s.timers[0] == e
+	s.mu.Unlock()
+
+	if earliest {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	return e
+}
+
+// remove cancels e, unless it already fired.
+func (s *scheduler) remove(e *timerEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e.index >= 0 {
+		heap.Remove(&s.timers, e.index)
+	}
+}
+
+// onDone calls fn once ctx is done. Jobs usually share their context, which
+// is then watched by a single goroutine.
+func (s *scheduler) onDone(ctx context.Context, fn func()) {
+	done := ctx.Done()
+	if done == nil {
+		return
+	}
+
+	s.mu.Lock()
+	fns, watched := s.watchers[done]
+	s.watchers[done] = append(fns, fn)
+	s.mu.Unlock()
+
+	if watched {
+		return
+	}
+
+	go func() {
+		<-done
+
+		s.mu.Lock()
+		fns := s.watchers[done]
+		delete(s.watchers, done)
+		s.mu.Unlock()
+
+		for _, fn := range fns {
+			fn()
+		}
+	}()
+}
+
+// dispatch queues fn to run on a worker, and starts one unless there are
+// maxWorkers already. Workers exit once the queue is empty, so that idle jobs
+// don't hold goroutines.
+func (s *scheduler) dispatch(fn func()) {
+	s.mu.Lock()
+	s.queue = append(s.queue, fn)
+	start := s.workers < s.maxWorkers
+	if start {
+		s.workers++
+	}
+	s.mu.Unlock()
+
+	if start {
+		go s.worker()
+	}
+}
+
+func (s *scheduler) worker() {
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.workers--
+			s.mu.Unlock()
+			return
+		}
+
+		fn := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		fn()
+	}
+}
+
+func (s *scheduler) run() {
+	for {
+		before, beforeWall := time.Now(), s.now()
+
+		s.mu.Lock()
+		pending := len(s.timers) > 0
+		var wait time.Duration
+		if pending {
+			wait = s.timers[0].at.Sub(beforeWall)
+		}
+		s.mu.Unlock()
+
+		if wait > s.checkInterval {
+			wait = s.checkInterval
+		}
+
+		if !pending {
+			<-s.wake
+		} else if wait > 0 {
+			timer := time.NewTimer(wait)
+
+			select {
+			case <-timer.C:
+			case <-s.wake:
+				timer.Stop()
+			}
+		}
+
+		// Without a jump, the wall clock would be at expected.
+		expected := beforeWall.Add(time.Since(before))
+
+		jump := s.now().Sub(expected)
+		if jump > -CLOCK_JUMP_THRESHOLD && jump < CLOCK_JUMP_THRESHOLD {
+			jump = 0
+		}
+
+		s.fireDue(expected, jump)
+	}
+}
+
+// fireDue fires the entries that are due. If the wall clock jumped by jump
+// from expected meanwhile, the entries it jumped past are fired with it (if
+// it jumped forward), and the others' loggers are told about it.
+func (s *scheduler) fireDue(expected time.Time, jump time.Duration) {
+	now := s.now()
+
+	s.mu.Lock()
+
+	due := make([]*timerEntry, 0)
+	for len(s.timers) > 0 && !s.timers[0].at.After(now) {
+		due = append(due, heap.Pop(&s.timers).(*timerEntry))
+	}
+
+	if jump != 0 {
+		for _, e := range s.timers {
+			if e.logger != nil {
+				e.logger.Warnf("clock jumped by %v, job will still run next at %v", jump, e.at)
+			}
+		}
+	}
+
+	s.mu.Unlock()
+
+	for _, e := range due {
+		// Entries that were due anyway (e.g. the one we waited for)
+		// aren't missed.
+		if jump > 0 && e.at.After(expected) {
+			e.fire(jump)
+		} else {
+			e.fire(0)
+		}
+	}
+}
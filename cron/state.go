@@ -0,0 +1,484 @@
+package cron
+
+import (
+	"context"
+	"sync"
+	"syscall"
+	"time"
+
+	"supercronic/crontab"
+)
+
+// RunStatus describes a completed execution of a job.
+type RunStatus struct {
+	ScheduledAt time.Time `json:"scheduled_at"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	Succeeded   bool      `json:"succeeded"`
+	ExitCode    int       `json:"exit_code"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// JobStatus is a point-in-time snapshot of a JobState.
+type JobStatus struct {
+	ID           int        `json:"id"`
+	Name         string     `json:"name,omitempty"`
+	Schedule     string     `json:"schedule"`
+	Command      string     `json:"command"`
+	Position     int        `json:"position"`
+	Source       string     `json:"source,omitempty"`
+	NextRun      *time.Time `json:"next_run,omitempty"`
+	Running      int        `json:"running"`
+	Waiting      int        `json:"waiting"`
+	RunningSince *time.Time `json:"running_since,omitempty"`
+	Paused       bool       `json:"paused"`
+	LastRun      *RunStatus `json:"last_run,omitempty"`
+
+	ConsecutiveFailures int  `json:"consecutive_failures"`
+	Tripped             bool `json:"tripped"`
+}
+
+// JobState tracks the runtime state of a scheduled job, and lets callers
+// control it while it is scheduled.
+type JobState struct {
+	Job     *crontab.Job
+	Context *crontab.Context
+
+	id      int
+	trigger chan struct{}
+
+	// onTrigger, if set, is called by Trigger instead of using trigger.
+	onTrigger func()
+
+	mu      sync.Mutex
+	nextRun time.Time
+	running map[*Execution]context.CancelFunc
+	waiting int
+	paused  bool
+	lastRun *RunStatus
+
+	// consecutiveFailures counts the runs that failed since the last one
+	// that succeeded. Once there were Job.MaxConsecutiveFailures of them,
+	// tripped is set until ResetCircuitBreaker is called.
+	consecutiveFailures int
+	tripped             bool
+
+	// started and finished are closed (and replaced) whenever a run starts,
+	// or finishes.
+	started  chan struct{}
+	finished chan struct{}
+	// lastExecution is the run that finished last.
+	lastExecution *Execution
+	// lastScheduled is when the previous run was due, which is when the
+	// window for this run's dependencies starts.
+	lastScheduled time.Time
+
+	// lastSuccess is Options.LastSuccess.
+	lastSuccess time.Time
+}
+
+// doneAlready reports whether a run due at t is due in the same window of
+// expression as the last run that succeeded before the job was started.
+func (s *JobState) doneAlready(expression crontab.Expression, t time.Time) bool {
+	return !s.lastSuccess.IsZero() && expression.Next(s.lastSuccess).After(t)
+}
+
+func newJobState(cronCtx *crontab.Context, job *crontab.Job) *JobState {
+	return &JobState{
+		Job:      job,
+		Context:  cronCtx,
+		trigger:  make(chan struct{}, 1),
+		running:  make(map[*Execution]context.CancelFunc),
+		started:  make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+}
+
+func (s *JobState) ID() int {
+	return s.id
+}
+
+// Trigger requests an immediate run of the job, outside of its schedule.
+// If a run was already requested and hasn't started yet, this is a no-op.
+func (s *JobState) Trigger() {
+	s.mu.Lock()
+	onTrigger := s.onTrigger
+	s.mu.Unlock()
+
+	if onTrigger != nil {
+		onTrigger()
+		return
+	}
+
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// setTriggerHandler makes Trigger call fn, for jobs that don't have a
+// goroutine waiting on trigger.
+func (s *JobState) setTriggerHandler(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onTrigger = fn
+}
+
+// Pause prevents scheduled runs of the job from starting until Resume is
+// called. Runs that are in progress are not affected, and the job can still
+// be triggered manually.
+func (s *JobState) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = true
+}
+
+func (s *JobState) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = false
+}
+
+func (s *JobState) IsPaused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+// IsTripped reports whether the job's circuit breaker tripped, which
+// prevents scheduled runs of the job from starting like Pause does.
+func (s *JobState) IsTripped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tripped
+}
+
+// ResetCircuitBreaker resumes scheduling the job after its circuit breaker
+// tripped, and forgets its previous failures.
+func (s *JobState) ResetCircuitBreaker() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tripped = false
+	s.consecutiveFailures = 0
+}
+
+func (s *JobState) setNextRun(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextRun = t
+}
+
+// Abort terminates all running instances of the job.
+func (s *JobState) Abort() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, cancel := range s.running {
+		cancel()
+	}
+}
+
+// Signal sends sig to all running instances of the job (i.e. to their
+// process groups), and returns how many there were.
+func (s *JobState) Signal(sig syscall.Signal) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	signaled := 0
+	for e := range s.running {
+		ok, err := e.signal(sig)
+		if err != nil {
+			e.Logger.Warnf("failed to send %s: %v", sig, err)
+		}
+		if ok && err == nil {
+			signaled++
+		}
+	}
+
+	return signaled
+}
+
+func (s *JobState) addWaiting(delta int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.waiting += delta
+}
+
+func (s *JobState) runStarted(e *Execution, cancel context.CancelFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running[e] = cancel
+
+	close(s.started)
+	s.started = make(chan struct{})
+}
+
+// runFinished records that e finished. It reports whether the job's circuit
+// breaker tripped because of it.
+func (s *JobState) runFinished(e *Execution) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.running, e)
+	s.lastExecution = e
+
+	// Skipped runs neither failed nor succeeded.
+	tripped := false
+	if e.Err != nil {
+		s.consecutiveFailures++
+
+		max := s.Job.MaxConsecutiveFailures
+		if max > 0 && s.consecutiveFailures >= max && !s.tripped {
+			s.tripped = true
+			tripped = true
+		}
+	} else if !e.Skipped {
+		s.consecutiveFailures = 0
+	}
+
+	s.lastRun = &RunStatus{
+		ScheduledAt: e.ScheduledAt,
+		StartedAt:   e.StartedAt,
+		FinishedAt:  e.FinishedAt,
+		Succeeded:   e.Err == nil,
+		ExitCode:    e.ExitCode,
+	}
+
+	if e.Err != nil {
+		s.lastRun.Error = e.Err.Error()
+	}
+
+	close(s.finished)
+	s.finished = make(chan struct{})
+
+	return tripped
+}
+
+// runSkipped records that the run due at t was skipped.
+func (s *JobState) runSkipped(t time.Time, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.lastRun = &RunStatus{
+		ScheduledAt: t,
+		StartedAt:   now,
+		FinishedAt:  now,
+		ExitCode:    -1,
+		Error:       "skipped: " + reason,
+	}
+
+	close(s.finished)
+	s.finished = make(chan struct{})
+}
+
+func (s *JobState) isRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.running) > 0
+}
+
+// waitIdle waits until the job isn't running.
+func (s *JobState) waitIdle(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		if len(s.running) == 0 {
+			s.mu.Unlock()
+			return nil
+		}
+		finished := s.finished
+		s.mu.Unlock()
+
+		select {
+		case <-finished:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// WaitForStart waits for a run of the job that started at or after since
+// (e.g. the run a call to Trigger requested), and returns it. The run may
+// have finished already.
+func (s *JobState) WaitForStart(ctx context.Context, since time.Time) (*Execution, error) {
+	for {
+		s.mu.Lock()
+		for e := range s.running {
+			if !e.StartedAt.Before(since) {
+				s.mu.Unlock()
+				return e, nil
+			}
+		}
+
+		if e := s.lastExecution; e != nil && !e.StartedAt.Before(since) {
+			s.mu.Unlock()
+			return e, nil
+		}
+
+		started := s.started
+		s.mu.Unlock()
+
+		select {
+		case <-started:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// LatestExecution returns the run of the job that started last, and whether
+// it is still running. It returns nil if the job hasn't run since it was
+// scheduled.
+func (s *JobState) LatestExecution() (*Execution, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	latest, running := s.lastExecution, false
+	for e := range s.running {
+		if latest == nil || e.StartedAt.After(latest.StartedAt) {
+			latest, running = e, true
+		}
+	}
+
+	return latest, running
+}
+
+// waitForRun waits until the job isn't running and its last run finished
+// at or after since, and returns that run.
+func (s *JobState) waitForRun(ctx context.Context, since time.Time) (*RunStatus, error) {
+	for {
+		s.mu.Lock()
+		if len(s.running) == 0 && s.lastRun != nil && !s.lastRun.FinishedAt.Before(since) {
+			lastRun := *s.lastRun
+			s.mu.Unlock()
+			return &lastRun, nil
+		}
+		finished := s.finished
+		s.mu.Unlock()
+
+		select {
+		case <-finished:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// startWindow records that a run due at t is starting, and returns when the
+// previous one was due.
+func (s *JobState) startWindow(t time.Time) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	since := s.lastScheduled
+	s.lastScheduled = t
+	return since
+}
+
+func (s *JobState) Status() JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := JobStatus{
+		ID:       s.id,
+		Name:     s.Job.Name,
+		Schedule: s.Job.Schedule,
+		Command:  s.Job.Command,
+		Position: s.Job.Position,
+		Source:   s.Job.Source,
+		Running:  len(s.running),
+		Waiting:  s.waiting,
+		Paused:   s.paused,
+
+		ConsecutiveFailures: s.consecutiveFailures,
+		Tripped:             s.tripped,
+	}
+
+	if !s.nextRun.IsZero() {
+		nextRun := s.nextRun
+		status.NextRun = &nextRun
+	}
+
+	for e := range s.running {
+		if status.RunningSince == nil || e.StartedAt.Before(*status.RunningSince) {
+			startedAt := e.StartedAt
+			status.RunningSince = &startedAt
+		}
+	}
+
+	if s.lastRun != nil {
+		lastRun := *s.lastRun
+		status.LastRun = &lastRun
+	}
+
+	return status
+}
+
+// Registry holds the state of the jobs that are currently scheduled.
+type Registry struct {
+	mu     sync.Mutex
+	states []*JobState
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Add registers state, and assigns it an ID.
+func (r *Registry) Add(state *JobState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state.id = len(r.states)
+	r.states = append(r.states, state)
+}
+
+// Reset forgets all registered jobs, e.g. when reloading the crontab.
+func (r *Registry) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.states = nil
+}
+
+func (r *Registry) Jobs() []*JobState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	states := make([]*JobState, len(r.states))
+	copy(states, r.states)
+	return states
+}
+
+// Abort terminates all running jobs.
+func (r *Registry) Abort() {
+	for _, state := range r.Jobs() {
+		state.Abort()
+	}
+}
+
+// JobByName returns the job with the given name, or nil if there is none.
+func (r *Registry) JobByName(name string) *JobState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, state := range r.states {
+		if state.Job.Name == name {
+			return state
+		}
+	}
+
+	return nil
+}
+
+// Job returns the job with the given ID, or nil if there is none.
+func (r *Registry) Job(id int) *JobState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if id < 0 || id >= len(r.states) {
+		return nil
+	}
+
+	return r.states[id]
+}
@@ -0,0 +1,102 @@
+package cron
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"supercronic/crontab"
+)
+
+// outputThrottle decides which lines of a job's output get logged, per the
+// job's throttle directive. It is shared by a run's stdout and stderr. All
+// methods are safe to call on a nil *outputThrottle, which lets everything
+// through.
+type outputThrottle struct {
+	limits    *crontab.Throttle
+	jobLogger *logrus.Entry
+
+	mu sync.Mutex
+
+	windowStart time.Time
+	windowLines int
+	// rateSuppressed is how many lines were suppressed in the current window
+	// for going over LinesPerSecond.
+	rateSuppressed int
+
+	bytes uint64
+	// bytesSuppressed is how many lines were suppressed for going over
+	// MaxBytes.
+	bytesSuppressed int
+}
+
+func newOutputThrottle(limits *crontab.Throttle, jobLogger *logrus.Entry) *outputThrottle {
+	if limits == nil {
+		return nil
+	}
+
+	return &outputThrottle{
+		limits:      limits,
+		jobLogger:   jobLogger,
+		windowStart: time.Now(),
+	}
+}
+
+// Allow reports whether line should be logged.
+func (t *outputThrottle) Allow(line string) bool {
+	if t == nil {
+		return true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now := time.Now(); now.Sub(t.windowStart) >= time.Second {
+		t.flushRate()
+		t.windowStart = now
+		t.windowLines = 0
+	}
+
+	t.bytes += uint64(len(line))
+	if t.limits.MaxBytes > 0 && t.bytes > t.limits.MaxBytes {
+		if t.bytesSuppressed == 0 {
+			t.jobLogger.Warnf("job output exceeded %d bytes, suppressing the rest", t.limits.MaxBytes)
+		}
+		t.bytesSuppressed++
+		return false
+	}
+
+	t.windowLines++
+	if t.limits.LinesPerSecond > 0 && t.windowLines > t.limits.LinesPerSecond {
+		t.rateSuppressed++
+		return false
+	}
+
+	return true
+}
+
+// Close reports any lines that were suppressed and not reported yet. It must
+// be called once the job is done writing output.
+func (t *outputThrottle) Close() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.flushRate()
+
+	if t.bytesSuppressed > 0 {
+		t.jobLogger.Warnf("%d line(s) of output suppressed (job wrote more than %d bytes)", t.bytesSuppressed, t.limits.MaxBytes)
+		t.bytesSuppressed = 0
+	}
+}
+
+func (t *outputThrottle) flushRate() {
+	if t.rateSuppressed > 0 {
+		t.jobLogger.Warnf("%d line(s) of output suppressed (job wrote more than %d lines per second)", t.rateSuppressed, t.limits.LinesPerSecond)
+		t.rateSuppressed = 0
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorhill/cronexpr"
 	"github.com/sirupsen/logrus"
@@ -14,6 +17,9 @@ import (
 var (
 	jobLineSeparator = regexp.MustCompile(`\S+`)
 	envLineMatcher   = regexp.MustCompile(`^([^\s=]+)\s*=\s*(.*)$`)
+	includeMatcher   = regexp.MustCompile(`^#include\s+(\S.*?)\s*$`)
+	groupMatcher     = regexp.MustCompile(`^#group\s+(\S.*?)\s*$`)
+	endGroupMatcher  = regexp.MustCompile(`^#endgroup\s*$`)
 
 	parameterCounts = []int{
 		7, // POSIX + seconds + years
@@ -23,9 +29,64 @@ var (
 	}
 )
 
-func parseJobLine(line string) (*CrontabLine, error) {
+// ParseOptions controls how crontabs are parsed.
+type ParseOptions struct {
+	// Seconds makes 6-field expressions start with a seconds field, instead
+	// of ending with a years field.
+	Seconds bool
+
+	// ExpandEnv expands $VAR and ${VAR} in commands and variable values,
+	// using the variables defined so far in the crontab and the process
+	// environment.
+	ExpandEnv bool
+
+	// Format is FormatCrontab or FormatYAML. If empty, files ending with
+	// .yaml or .yml are read as YAML, and others as crontabs.
+	Format string
+
+	// Location is the timezone jobs are scheduled in, unless the crontab
+	// sets CRON_TZ or TZ. It defaults to local time.
+	Location *time.Location
+
+	// DSTSkipped and DSTRepeated determine what happens to runs scheduled
+	// at times skipped, or repeated, when daylight saving time starts or
+	// ends. They default to DSTSkippedRun and DSTRepeatedOnce.
+	DSTSkipped  DSTSkippedPolicy
+	DSTRepeated DSTRepeatedPolicy
+
+	// Template makes ReadCrontab render crontabs with RenderFile before
+	// parsing them, using the values in the YAML file at Values, if set.
+	// Included files are not rendered.
+	Template bool
+	Values   string
+
+	// Tags selects the jobs ReadCrontab returns. It selects all of them by
+	// default.
+	Tags TagFilter
+}
+
+// MIN_INTERVAL is the shortest interval @every schedules accept.
+var MIN_INTERVAL = time.Second
+
+// parseJobLine parses a job line. H fields are expanded using hashKey if set,
+// and the command otherwise.
+func parseJobLine(line string, hashKey string, options ParseOptions) (*CrontabLine, error) {
 	indices := jobLineSeparator.FindAllStringIndex(line, -1)
 
+	if len(indices) > 2 && line[indices[0][0]:indices[0][1]] == "@every" {
+		return parseIntervalLine(line, indices)
+	}
+
+	if len(indices) > 1 && isDaemonShorthand(line[indices[0][0]:indices[0][1]]) {
+		return &CrontabLine{
+			Expression: &DaemonExpression{},
+			Schedule:   line[indices[0][0]:indices[0][1]],
+			Command:    line[indices[1][0]:],
+		}, nil
+	}
+
+	var hashErr error
+
 	for _, count := range parameterCounts {
 		if len(indices) <= count {
 			continue
@@ -37,7 +98,32 @@ func parseJobLine(line string) (*CrontabLine, error) {
 		// TODO: Should receive a logger?
 		logrus.Debugf("try parse(%d): %s[0:%d] = %s", count, line, scheduleEnds, line[0:scheduleEnds])
 
-		expr, err := cronexpr.ParseStrict(line[:scheduleEnds])
+		schedule := line[:scheduleEnds]
+		// Shorthands (e.g. @hourly) have no fields to hash.
+		if count > 1 && hasHashFields(schedule) {
+			key := hashKey
+			if key == "" {
+				key = line[commandStarts:]
+			}
+
+			expanded, err := expandHashFields(schedule, key, hashFieldRanges(count, options))
+			if err != nil {
+				hashErr = err
+				continue
+			}
+
+			logrus.Debugf("expanded H fields: %s = %s", schedule, expanded)
+			schedule = expanded
+		}
+
+		parsed := schedule
+		if count == 6 && options.Seconds {
+			// cronexpr reads 6 fields as POSIX + years, so we spell out
+			// the years to make the first field seconds.
+			parsed = schedule + " *"
+		}
+
+		expr, err := cronexpr.ParseStrict(parsed)
 
 		if err != nil {
 			continue
@@ -45,47 +131,278 @@ func parseJobLine(line string) (*CrontabLine, error) {
 
 		return &CrontabLine{
 			Expression: expr,
-			Schedule:   line[:scheduleEnds],
+			Schedule:   schedule,
 			Command:    line[commandStarts:],
 		}, nil
 	}
+
+	if hashErr != nil {
+		return nil, fmt.Errorf("bad crontab line: %s: %v", line, hashErr)
+	}
 	return nil, fmt.Errorf("bad crontab line: %s", line)
 }
 
+// ParseSchedule parses schedule (e.g. "*/15 2-4 * * *", @hourly, or @every
+// 1h) like the schedule of a job line, and returns an expression that
+// evaluates it in options.Location, per options' DST policies.
+func ParseSchedule(schedule string, options ParseOptions) (Expression, error) {
+	// Job lines are parsed along with their command, so we add one.
+	jobLine, err := parseJobLine(strings.TrimSpace(schedule)+" -", "", options)
+	if err != nil || jobLine.Command != "-" {
+		return nil, fmt.Errorf("bad schedule: %s", schedule)
+	}
+
+	if _, ok := jobLine.Expression.(*IntervalExpression); ok {
+		return jobLine.Expression, nil
+	}
+
+	if IsDaemon(jobLine.Expression) {
+		return jobLine.Expression, nil
+	}
+
+	return newLocationExpression(jobLine.Expression, options.Location, options), nil
+}
+
+// isDaemonShorthand reports whether schedule is that of a job supercronic keeps
+// running (see DaemonExpression).
+func isDaemonShorthand(schedule string) bool {
+	return schedule == "@always" || schedule == "@daemon"
+}
+
+func parseIntervalLine(line string, indices [][]int) (*CrontabLine, error) {
+	interval, err := time.ParseDuration(line[indices[1][0]:indices[1][1]])
+	if err != nil {
+		return nil, fmt.Errorf("bad crontab line: %s: %v", line, err)
+	}
+
+	if interval < MIN_INTERVAL {
+		return nil, fmt.Errorf("bad crontab line: %s: interval must be at least %v", line, MIN_INTERVAL)
+	}
+
+	return &CrontabLine{
+		Expression: &IntervalExpression{Interval: interval},
+		Schedule:   line[:indices[1][1]],
+		Command:    line[indices[2][0]:],
+	}, nil
+}
+
 func ParseCrontab(reader io.Reader) (*Crontab, error) {
-	scanner := bufio.NewScanner(reader)
+	return ParseCrontabWithOptions(reader, ParseOptions{})
+}
+
+func ParseCrontabWithOptions(reader io.Reader, options ParseOptions) (*Crontab, error) {
+	return parseCrontab(reader, "", options)
+}
+
+// crontabGroup is a block of jobs between `#group NAME` and `#endgroup`
+// lines. Like #include, they have no space after the #, so that they don't
+// clash with ordinary comments. The directives that directly follow
+// `#group NAME` apply to every job in the block, before the job's own.
+type crontabGroup struct {
+	name       string
+	line       int
+	directives []*directive
+	file       *includedFile
+
+	// collecting is true until the first line after `#group NAME` that
+	// isn't a directive.
+	collecting bool
+}
+
+// parseCrontab parses the crontab read from reader, which is at path (if
+// known). Paths in #include lines are relative to the including file.
+func parseCrontab(reader io.Reader, path string, options ParseOptions) (*Crontab, error) {
+	files := []*includedFile{{path: path, scanner: bufio.NewScanner(reader)}}
+	if path != "" {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		files[0].abs = abs
+	}
+
+	defer func() {
+		for _, f := range files {
+			f.close()
+		}
+	}()
 
 	position := 0
 
 	jobs := make([]*Job, 0)
+	directives := make([]*directive, 0)
 
-	// TODO: CRON_TZ?
 	environ := make(map[string]string)
 	shell := "/bin/sh"
 
-	for scanner.Scan() {
-		line := strings.TrimLeft(scanner.Text(), " \t")
+	names := make(map[string]bool)
+
+	var group *crontabGroup
+
+	// CRON_TZ and TZ set the timezone used to schedule the jobs that follow
+	// them. CRON_TZ takes precedence, so that TZ can still be used to only
+	// set the jobs' environment.
+	var cronTZ, tz *time.Location
+
+	// RANDOM_DELAY (as in cronie) sets a jitter for the jobs that follow it,
+	// unless they set their own.
+	var randomDelay time.Duration
+
+	for len(files) > 0 {
+		current := files[len(files)-1]
+
+		// Errors in included files are prefixed with their path (the
+		// crontab's own is added by ReadCrontab).
+		fail := func(err error) error {
+			if current.parent != nil {
+				return fmt.Errorf("%s: %v", current.path, err)
+			}
+			return err
+		}
+
+		if current.scanner == nil {
+			if err := current.open(); err != nil {
+				return nil, err
+			}
+		}
+
+		if !current.scanner.Scan() {
+			if err := current.scanner.Err(); err != nil {
+				return nil, fail(err)
+			}
+
+			if group != nil && group.file == current {
+				return nil, fail(fmt.Errorf("line %d: group %s is never closed (expected #endgroup)", group.line, group.name))
+			}
+
+			current.close()
+			files = files[:len(files)-1]
+
+			// Directives only apply to jobs in the same file.
+			directives = directives[:0]
+			continue
+		}
+
+		current.line++
+		lineNumber := current.line
+		line := strings.TrimLeft(current.scanner.Text(), " \t")
 
 		if line == "" {
+			if group != nil {
+				group.collecting = false
+			}
 			continue
 		}
 
 		if line[0] == '#' {
+			if r := groupMatcher.FindStringSubmatch(line); r != nil {
+				if group != nil {
+					return nil, fail(fmt.Errorf("line %d: groups can't be nested (group %s starts on line %d)", lineNumber, group.name, group.line))
+				}
+				if len(directives) > 0 {
+					return nil, fail(fmt.Errorf("line %d: directives must be followed by a job, not a group", lineNumber))
+				}
+				if !jobNameMatcher.MatchString(r[1]) {
+					return nil, fail(fmt.Errorf("line %d: not a valid group name (letters, digits, _, . or -): %s", lineNumber, r[1]))
+				}
+
+				group = &crontabGroup{name: r[1], line: lineNumber, file: current, collecting: true}
+				continue
+			}
+
+			if endGroupMatcher.MatchString(line) {
+				if group == nil {
+					return nil, fail(fmt.Errorf("line %d: #endgroup without a group", lineNumber))
+				}
+				if len(directives) > 0 {
+					return nil, fail(fmt.Errorf("line %d: directives must be followed by a job, not the end of a group", lineNumber))
+				}
+
+				group = nil
+				continue
+			}
+
+			if r := includeMatcher.FindStringSubmatch(line); r != nil {
+				if len(directives) > 0 {
+					return nil, fail(fmt.Errorf("line %d: directives must be followed by a job, not an include", lineNumber))
+				}
+				if group != nil {
+					return nil, fail(fmt.Errorf("line %d: groups can't include files", lineNumber))
+				}
+
+				included, err := resolveIncludes(r[1], current)
+				if err != nil {
+					return nil, fail(fmt.Errorf("line %d: bad include: %v", lineNumber, err))
+				}
+
+				// The last file on the stack is read first.
+				for i := len(included) - 1; i >= 0; i-- {
+					files = append(files, included[i])
+				}
+				continue
+			}
+
+			if d, ok := parseDirectiveLine(line); ok {
+				d.line = lineNumber
+
+				if delimiter, ok := d.blockDelimiter(); ok {
+					lines, ok := readBlock(current.scanner, delimiter)
+					if err := current.scanner.Err(); err != nil {
+						return nil, fail(err)
+					}
+					if !ok {
+						return nil, fail(fmt.Errorf("line %d: unterminated stdin block (expected %s)", lineNumber, delimiter))
+					}
+					current.line += len(lines) + 1
+
+					data := ""
+					for _, l := range lines {
+						data += l + "\n"
+					}
+					d.data = &data
+				}
+
+				if group != nil && group.collecting {
+					// Names are unique, so a group can't set one.
+					if d.key == "name" {
+						return nil, fail(fmt.Errorf("line %d: groups can't have a name directive", lineNumber))
+					}
+					group.directives = append(group.directives, d)
+				} else {
+					directives = append(directives, d)
+				}
+				continue
+			}
+
+			if group != nil {
+				group.collecting = false
+			}
 			continue
 		}
 
+		if group != nil {
+			group.collecting = false
+		}
+
 		r := envLineMatcher.FindAllStringSubmatch(line, -1)
 		if len(r) == 1 && len(r[0]) == 3 {
 			envKey := r[0][1]
 			envVal := r[0][2]
 
 			// Remove quotes (this emulates what Vixie cron does)
-			if envVal[0] == '"' || envVal[0] == '\'' {
+			singleQuoted := false
+			if envVal != "" && (envVal[0] == '"' || envVal[0] == '\'') {
 				if len(envVal) > 1 && envVal[0] == envVal[len(envVal)-1] {
+					singleQuoted = envVal[0] == '\''
 					envVal = envVal[1 : len(envVal)-1]
 				}
 			}
 
+			// Like in a shell, single-quoted values are taken literally.
+			if options.ExpandEnv && !singleQuoted {
+				envVal = expandVariables(envVal, environ)
+			}
+
 			if envKey == "SHELL" {
 				logrus.Infof("processes will be spawned using shell: %s", envVal)
 				shell = envVal
@@ -95,22 +412,112 @@ func ParseCrontab(reader io.Reader) (*Crontab, error) {
 				logrus.Warnf("processes will NOT be spawned as USER=%s", envVal)
 			}
 
+			if envKey == "CRON_TZ" {
+				loc, err := loadLocation(envVal)
+				if err != nil {
+					return nil, fail(fmt.Errorf("line %d: bad %s: %v", lineNumber, envKey, err))
+				}
+				cronTZ = loc
+			}
+
+			// TZ is also meant for the jobs, and may be a value only libc
+			// understands (e.g. a POSIX rule like UTC0): jobs still get it.
+			if envKey == "TZ" {
+				loc, err := loadLocation(envVal)
+				if err != nil {
+					logrus.Warnf("line %d: jobs will be scheduled in the default timezone, not TZ=%s: %v", lineNumber, envVal, err)
+				}
+				tz = loc
+			}
+
+			if envKey == "RANDOM_DELAY" {
+				d, err := parseRandomDelay(envVal)
+				if err != nil {
+					return nil, fail(fmt.Errorf("line %d: %v", lineNumber, err))
+				}
+				randomDelay = d
+			}
+
 			environ[envKey] = envVal
 
 			continue
 		}
 
-		jobLine, err := parseJobLine(line)
+		// H fields hash the job's name, so that they don't change when its
+		// command does.
+		var name string
+		for _, d := range directives {
+			if d.key == "name" {
+				name = d.value
+			}
+		}
+
+		jobLine, err := parseJobLine(line, name, options)
 		if err != nil {
-			return nil, err
+			return nil, fail(fmt.Errorf("line %d: %v", lineNumber, err))
 		}
 
-		jobs = append(jobs, &Job{CrontabLine: *jobLine, Position: position})
-		position++
-	}
+		if options.ExpandEnv {
+			jobLine.Command = expandVariables(jobLine.Command, environ)
+		}
+
+		_, isInterval := jobLine.Expression.(*IntervalExpression)
+
+		loc := cronTZ
+		if loc == nil {
+			loc = tz
+		}
+		if loc == nil {
+			loc = options.Location
+		}
+
+		// Intervals don't depend on the timezone, and neither do jobs that
+		// are kept running.
+		if !isInterval && !IsDaemon(jobLine.Expression) {
+			if loc != nil {
+				logrus.Debugf("job will be scheduled in timezone %s: %s", loc, line)
+			}
+			jobLine.Expression = newLocationExpression(jobLine.Expression, loc, options)
+		}
+
+		job := &Job{CrontabLine: *jobLine, Position: position, Source: current.path, Line: lineNumber}
+
+		jobDirectives := directives
+		if group != nil {
+			job.Group = group.name
+			jobDirectives = append(append([]*directive{}, group.directives...), directives...)
+		}
+
+		if err := applyDirectives(job, jobDirectives); err != nil {
+			return nil, fail(err)
+		}
+		directives = directives[:0]
+
+		if options.ExpandEnv {
+			for key, value := range job.Env {
+				job.Env[key] = expandVariables(value, environ)
+			}
+		}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+		if job.Jitter == 0 {
+			job.Jitter = randomDelay
+		}
+
+		if job.Name != "" {
+			if names[job.Name] {
+				return nil, fail(fmt.Errorf("line %d: duplicate job name: %s", lineNumber, job.Name))
+			}
+			names[job.Name] = true
+		}
+
+		for _, name := range job.After {
+			if name == job.Name {
+				return nil, fail(fmt.Errorf("line %d: job %s cannot run after itself", lineNumber, name))
+			}
+		}
+
+		jobs = append(jobs, job)
+		position++
 	}
 
 	return &Crontab{
@@ -121,3 +528,31 @@ func ParseCrontab(reader io.Reader) (*Crontab, error) {
 		},
 	}, nil
 }
+
+// parseRandomDelay parses a RANDOM_DELAY, which is a number of minutes.
+func parseRandomDelay(value string) (time.Duration, error) {
+	minutes, err := strconv.Atoi(value)
+	if err != nil || minutes < 0 {
+		return 0, fmt.Errorf("bad RANDOM_DELAY (must be a number of minutes): %s", value)
+	}
+
+	return time.Duration(minutes) * time.Minute, nil
+}
+
+// loadLocation returns the named timezone, or nil (i.e. local time) if name is
+// empty.
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return nil, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// Location returns the timezone the line is scheduled in, as set by CRON_TZ
+// or TZ, or nil if it is scheduled in the local timezone.
+func (l *CrontabLine) Location() *time.Location {
+	if e, ok := l.Expression.(*locationExpression); ok {
+		return e.location
+	}
+	return nil
+}
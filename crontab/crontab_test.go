@@ -3,11 +3,20 @@ package crontab
 import (
 	"bytes"
 	"fmt"
+	"os"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
+var (
+	runAtStartup   = true
+	noRunAtStartup = false
+)
+
 var parseCrontabTestCases = []struct {
 	crontab  string
 	expected *Crontab
@@ -90,6 +99,17 @@ var parseCrontabTestCases = []struct {
 		},
 	},
 
+	{
+		"FOO=",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{"FOO": ""},
+			},
+			Jobs: []*Job{},
+		},
+	},
+
 	{
 		"FOO=''",
 		&Crontab{
@@ -248,37 +268,1303 @@ var parseCrontabTestCases = []struct {
 		},
 	},
 
-	// Failure cases
-	{"* foo \n", nil},
-	{"* some * * *  more\n", nil},
-	{"* some * * *  \n", nil},
-	{"FOO\n", nil},
-}
+	{
+		"# timeout: 10m\n# some comment\n* * * * * foo\n* * * * * bar\n#timeout:1s\n@daily baz",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "* * * * *",
+						Command:  "foo",
+					},
+					Timeout: 10 * time.Minute,
+				},
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "* * * * *",
+						Command:  "bar",
+					},
+				},
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@daily",
+						Command:  "baz",
+					},
+					Timeout: time.Second,
+				},
+			},
+		},
+	},
 
-func TestParseCrontab(t *testing.T) {
-	for _, tt := range parseCrontabTestCases {
-		label := fmt.Sprintf("ParseCrontab(%q)", tt.crontab)
+	{
+		"# healthcheck: https://hc-ping.com/1234\n# timeout: 1m\n* * * * * foo\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "* * * * *",
+						Command:  "foo",
+					},
+					Timeout:     time.Minute,
+					Healthcheck: "https://hc-ping.com/1234",
+				},
+			},
+		},
+	},
 
-		reader := bytes.NewBufferString(tt.crontab)
+	{
+		"# catchup: run-all\n@hourly foo\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					CatchUp: CatchUpRunAll,
+				},
+			},
+		},
+	},
 
-		crontab, err := ParseCrontab(reader)
+	{
+		"# jitter: 30s\n@hourly foo\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					Jitter: 30 * time.Second,
+				},
+			},
+		},
+	},
 
-		if tt.expected == nil {
-			assert.Nil(t, crontab, label)
-			assert.NotNil(t, err, label)
-		} else {
-			if assert.NotNil(t, crontab, label) {
-				assert.Equal(t, tt.expected.Context, crontab.Context, label)
+	{
+		"@hourly foo\nRANDOM_DELAY=5\n@hourly bar\n# jitter: 30s\n@hourly baz\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{"RANDOM_DELAY": "5"},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+				},
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "bar",
+					},
+					Position: 1,
+					Jitter:   5 * time.Minute,
+				},
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "baz",
+					},
+					Position: 2,
+					Jitter:   30 * time.Second,
+				},
+			},
+		},
+	},
 
-				if assert.Equal(t, len(tt.expected.Jobs), len(crontab.Jobs), label) {
-					for i, crontabJob := range crontab.Jobs {
-						expectedJob := tt.expected.Jobs[i]
-						assert.Equal(t, expectedJob.Command, crontabJob.Command, label)
-						assert.Equal(t, expectedJob.Schedule, crontabJob.Schedule, label)
-						assert.NotNil(t, crontabJob.Expression, label)
-					}
-				}
-			}
-		}
+	{
+		"# logfile: /var/log/foo.log\n@hourly foo\n# logfile: bar.log size=10M age=24h keep=0\n@hourly bar\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					LogFile: &LogFile{Path: "/var/log/foo.log", Keep: 5},
+				},
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "bar",
+					},
+					LogFile: &LogFile{
+						Path:    "bar.log",
+						MaxSize: 10 << 20,
+						MaxAge:  24 * time.Hour,
+						Keep:    0,
+					},
+				},
+			},
+		},
+	},
+
+	{
+		"# stdout_file: /var/log/foo.out size=1M\n# stderr_file: /var/log/foo.err\n@hourly foo\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					StdoutFile: &LogFile{Path: "/var/log/foo.out", MaxSize: 1 << 20, Keep: 5},
+					StderrFile: &LogFile{Path: "/var/log/foo.err", Keep: 5},
+				},
+			},
+		},
+	},
+
+	{
+		"# run_at_startup: true\n@hourly foo\n# run_at_startup: false\n# skip_if_done: true\n@hourly bar\n@hourly baz\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					RunAtStartup: &runAtStartup,
+				},
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "bar",
+					},
+					RunAtStartup: &noRunAtStartup,
+					SkipIfDone:   true,
+				},
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "baz",
+					},
+				},
+			},
+		},
+	},
+
+	{
+		"# pushgateway_labels: team=billing tier=1\n@hourly foo\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					PushgatewayLabels: map[string]string{"team": "billing", "tier": "1"},
+				},
+			},
+		},
+	},
+
+	{
+		"# throttle: lines=100 bytes=1M\n@hourly foo\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					Throttle: &Throttle{LinesPerSecond: 100, MaxBytes: 1 << 20},
+				},
+			},
+		},
+	},
+
+	{
+		"# output: json\n@hourly foo\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					Output: OutputJSON,
+				},
+			},
+		},
+	},
+
+	{
+		"# output: raw\n@hourly foo\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					Output: OutputRaw,
+				},
+			},
+		},
+	},
+
+	{
+		"# stderr_level: warning\n# error_pattern: ERROR|FATAL\n# warning_pattern: ^WARN\n@hourly foo\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					StderrLevel:    OutputLevelWarning,
+					ErrorPattern:   regexp.MustCompile("ERROR|FATAL"),
+					WarningPattern: regexp.MustCompile("^WARN"),
+				},
+			},
+		},
+	},
+
+	{
+		"# env: PGHOST=db\n# env: PGPORT = 5433\n@hourly foo\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					Env: map[string]string{"PGHOST": "db", "PGPORT": "5433"},
+				},
+			},
+		},
+	},
+
+	{
+		"# env_file: /run/secrets/foo.env\n# env_file: foo.env\n@hourly foo\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					EnvFiles: []string{"/run/secrets/foo.env", "foo.env"},
+				},
+			},
+		},
+	},
+
+	{
+		"# container: image=alpine:3.19 network=backend mount=/data:/data:ro mount=cache:/cache\n@hourly foo\n# container: exec=app user=www-data\n@hourly bar\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					Container: &Container{
+						Image:   "alpine:3.19",
+						Network: "backend",
+						Mounts:  []string{"/data:/data:ro", "cache:/cache"},
+					},
+				},
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "bar",
+					},
+					Position:  1,
+					Container: &Container{Exec: "app", User: "www-data"},
+				},
+			},
+		},
+	},
+
+	{
+		"# kubernetes_job: template=/etc/supercronic/report.yaml namespace=batch container=report\n@hourly foo\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					KubernetesJob: &KubernetesJob{
+						Template:  "/etc/supercronic/report.yaml",
+						Namespace: "batch",
+						Container: "report",
+					},
+				},
+			},
+		},
+	},
+
+	{
+		"# secret: DB_PASS=file:/run/secrets/db\n# secret: API_KEY=vault:kv/data/app#api_key\n@hourly foo\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					Secrets: []Secret{
+						{Name: "DB_PASS", Source: "file:/run/secrets/db"},
+						{Name: "API_KEY", Source: "vault:kv/data/app#api_key"},
+					},
+				},
+			},
+		},
+	},
+
+	{
+		"# name: db-backup\n@hourly foo\n# after: db-backup, other.job\n@hourly bar\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					Name: "db-backup",
+				},
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "bar",
+					},
+					Position: 1,
+					After:    []string{"db-backup", "other.job"},
+				},
+			},
+		},
+	},
+
+	{
+		"# retries: 3 delay=30s\n@hourly foo\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					Retries:    3,
+					RetryDelay: 30 * time.Second,
+				},
+			},
+		},
+	},
+
+	{
+		"# exit_codes: skipped=3,4 retryable=75 success=1\n# max_consecutive_failures: 5\n# startup_delay: 30s\n@hourly foo\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					MaxConsecutiveFailures: 5,
+					StartupDelay:           30 * time.Second,
+					ExitCodes: map[int]ExitCodeClass{
+						1:  ExitCodeSuccess,
+						3:  ExitCodeSkipped,
+						4:  ExitCodeSkipped,
+						75: ExitCodeRetryable,
+					},
+				},
+			},
+		},
+	},
+
+	{
+		"# exec: direct\n@hourly foo 'bar baz'\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo 'bar baz'",
+					},
+					Exec: ExecDirect,
+				},
+			},
+		},
+	},
+
+	{
+		"# on_failure: /scripts/alert.sh\n@hourly foo\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					OnFailure: "/scripts/alert.sh",
+				},
+			},
+		},
+	},
+
+	{
+		"# expected_duration: 5m\n@hourly foo\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					ExpectedDuration: 5 * time.Minute,
+				},
+			},
+		},
+	},
+
+	{
+		"# workdir: /srv/app\n@hourly foo\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					Dir: "/srv/app",
+				},
+			},
+		},
+	},
+
+	{
+		"@always  /usr/local/bin/worker --queue default\n# restart: on-failure\n@daemon sidecar\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@always",
+						Command:  "/usr/local/bin/worker --queue default",
+					},
+				},
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@daemon",
+						Command:  "sidecar",
+					},
+					Restart: RestartOnFailure,
+				},
+			},
+		},
+	},
+
+	{
+		"# stdin: /srv/app/query.sql\n@hourly psql\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "psql",
+					},
+					Stdin: &Stdin{Path: "/srv/app/query.sql"},
+				},
+			},
+		},
+	},
+
+	{
+		"# stdin: <<SQL\n  VACUUM;\n\n# not a comment\nSQL\n@hourly psql\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "psql",
+					},
+					Stdin: &Stdin{Data: "  VACUUM;\n\n# not a comment\n"},
+				},
+			},
+		},
+	},
+
+	{
+		"# stdin: <<EOF\nEOF\n@hourly psql\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "psql",
+					},
+					Stdin: &Stdin{},
+				},
+			},
+		},
+	},
+
+	{
+		"# sentry_monitor: nightly-backup\n@hourly foo\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					SentryMonitor: "nightly-backup",
+				},
+			},
+		},
+	},
+
+	{
+		"# sentry_dsn: https://key@sentry.example.com/2\n# sentry_env: staging\n@hourly foo\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					SentryDSN:         "https://key@sentry.example.com/2",
+					SentryEnvironment: "staging",
+				},
+			},
+		},
+	},
+
+	{
+		"# overlap: replace\n@hourly foo\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "@hourly",
+						Command:  "foo",
+					},
+					Overlap: OverlapReplace,
+				},
+			},
+		},
+	},
+
+	{
+		"# limits: mem=512M cpu=0.5 nofile=1024\n* * * * * foo\n# limits: mem=1073741824\n* * * * * bar\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "* * * * *",
+						Command:  "foo",
+					},
+					Limits: &Limits{Memory: 512 << 20, CPU: 0.5, NoFile: 1024},
+				},
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "* * * * *",
+						Command:  "bar",
+					},
+					Limits: &Limits{Memory: 1 << 30},
+				},
+			},
+		},
+	},
+
+	{
+		"# priority: nice=10 ioclass=idle\n* * * * * foo\n# priority: iolevel=7\n* * * * * bar\n",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "* * * * *",
+						Command:  "foo",
+					},
+					Priority: &Priority{Nice: 10, IOClass: IOIdle},
+				},
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "* * * * *",
+						Command:  "bar",
+					},
+					Priority: &Priority{IOClass: IOBestEffort, IOLevel: 7},
+				},
+			},
+		},
+	},
+
+	{
+		"# note: unknown keys are comments\n* * * * * foo",
+		&Crontab{
+			Context: &Context{
+				Shell:   "/bin/sh",
+				Environ: map[string]string{},
+			},
+			Jobs: []*Job{
+				{
+					CrontabLine: CrontabLine{
+						Schedule: "* * * * *",
+						Command:  "foo",
+					},
+				},
+			},
+		},
+	},
+
+	// Failure cases
+	{"* foo \n", nil},
+	{"* some * * *  more\n", nil},
+	{"* some * * *  \n", nil},
+	{"FOO\n", nil},
+	{"# timeout: nope\n* * * * * foo\n", nil},
+	{"# timeout: -1s\n* * * * * foo\n", nil},
+	{"# expected_duration: 0s\n* * * * * foo\n", nil},
+	{"# jitter: soon\n* * * * * foo\n", nil},
+	{"# healthcheck: hc-ping.com/1234\n* * * * * foo\n", nil},
+	{"# healthcheck: ftp://hc-ping.com/1234\n* * * * * foo\n", nil},
+	{"# catchup: sometimes\n* * * * * foo\n", nil},
+	{"# overlap: never\n* * * * * foo\n", nil},
+	{"# limits: mem=lots\n* * * * * foo\n", nil},
+	{"# limits: cpu=0\n* * * * * foo\n", nil},
+	{"# limits: disk=1G\n* * * * * foo\n", nil},
+	{"# limits: nofile\n* * * * * foo\n", nil},
+	{"# limits:\n* * * * * foo\n", nil},
+	{"# priority: nice=20\n* * * * * foo\n", nil},
+	{"# priority: ioclass=low\n* * * * * foo\n", nil},
+	{"# priority: iolevel=8\n* * * * * foo\n", nil},
+	{"# priority: ioclass=idle iolevel=3\n* * * * * foo\n", nil},
+	{"# priority: cpu=1\n* * * * * foo\n", nil},
+	{"# priority:\n* * * * * foo\n", nil},
+	{"# container:\n* * * * * foo\n", nil},
+	{"# container: network=backend\n* * * * * foo\n", nil},
+	{"# container: image=alpine exec=app\n* * * * * foo\n", nil},
+	{"# container: exec=app mount=/data:/data\n* * * * * foo\n", nil},
+	{"# container: image=alpine ports=80:80\n* * * * * foo\n", nil},
+	{"# container: image=\n* * * * * foo\n", nil},
+	{"# container: image=alpine\n# priority: nice=10\n* * * * * foo\n", nil},
+	{"# container: exec=app\n# limits: mem=512M\n* * * * * foo\n", nil},
+	{"# kubernetes_job:\n* * * * * foo\n", nil},
+	{"# kubernetes_job: namespace=batch\n* * * * * foo\n", nil},
+	{"# kubernetes_job: template=pod.yaml image=alpine\n* * * * * foo\n", nil},
+	{"# kubernetes_job: template=pod.yaml\n# container: image=alpine\n* * * * * foo\n", nil},
+	{"# kubernetes_job: template=pod.yaml\n# limits: cpu=1\n* * * * * foo\n", nil},
+	{"# logfile:\n* * * * * foo\n", nil},
+	{"# throttle:\n* * * * * foo\n", nil},
+	{"# output: xml\n* * * * * foo\n", nil},
+	{"# stderr_level: debug\n* * * * * foo\n", nil},
+	{"# error_pattern: (\n* * * * * foo\n", nil},
+	{"# warning_pattern:\n* * * * * foo\n", nil},
+	{"# env_file:\n* * * * * foo\n", nil},
+	{"#group backups\n* * * * * foo\n", nil},
+	{"#group backups\n#group nightly\n* * * * * foo\n#endgroup\n#endgroup\n", nil},
+	{"#group db backups\n* * * * * foo\n#endgroup\n", nil},
+	{"#group backups\n# name: foo\n* * * * * foo\n#endgroup\n", nil},
+	{"#group backups\n# timeout: soon\n* * * * * foo\n#endgroup\n", nil},
+	{"#group backups\n#include other.cron\n#endgroup\n", nil},
+	{"# timeout: 1h\n#group backups\n* * * * * foo\n#endgroup\n", nil},
+	{"#group backups\n* * * * * foo\n# timeout: 1h\n#endgroup\n", nil},
+	{"* * * * * foo\n#endgroup\n", nil},
+	{"# secret:\n* * * * * foo\n", nil},
+	{"# secret: DB_PASS\n* * * * * foo\n", nil},
+	{"# secret: DB-PASS=file:/run/secrets/db\n* * * * * foo\n", nil},
+	{"# secret: DB_PASS=env:DB_PASS\n* * * * * foo\n", nil},
+	{"# secret: DB_PASS=file:\n* * * * * foo\n", nil},
+	{"# secret: DB_PASS=vault:kv/data/app\n* * * * * foo\n", nil},
+	{"# workdir:\n* * * * * foo\n", nil},
+	{"# stdin:\n* * * * * foo\n", nil},
+	{"# umask:\n* * * * * foo\n", nil},
+	{"@always\n", nil},
+	{"# restart: always\n* * * * * foo\n", nil},
+	{"# restart: sometimes\n@always foo\n", nil},
+	{"# umask: 1777\n* * * * * foo\n", nil},
+	{"# umask: u=rwx\n* * * * * foo\n", nil},
+	{"# umask: 022\n# container: exec=app\n* * * * * foo\n", nil},
+	{"# stdin: <<EOF\nfoo\n* * * * * foo\n", nil},
+	{"RANDOM_DELAY=5m\n* * * * * foo\n", nil},
+	{"# on_failure:\n* * * * * foo\n", nil},
+	{"# exec: sometimes\n* * * * * foo\n", nil},
+	{"# exec: direct\n* * * * * foo | bar\n", nil},
+	{"# retries:\n* * * * * foo\n", nil},
+	{"# retries: -1\n* * * * * foo\n", nil},
+	{"# retries: 3 wait=1s\n* * * * * foo\n", nil},
+	{"# exit_codes:\n* * * * * foo\n", nil},
+	{"# max_consecutive_failures: 0\n* * * * * foo\n", nil},
+	{"# startup_delay: 0s\n* * * * * foo\n", nil},
+	{"# startup_delay: soon\n* * * * * foo\n", nil},
+	{"# max_consecutive_failures: many\n* * * * * foo\n", nil},
+	{"# exit_codes: ignored=3\n* * * * * foo\n", nil},
+	{"# exit_codes: skipped=0\n* * * * * foo\n", nil},
+	{"# exit_codes: skipped=256\n* * * * * foo\n", nil},
+	{"# exit_codes: skipped=three\n* * * * * foo\n", nil},
+	{"# exit_codes: skipped=3 retryable=3\n* * * * * foo\n", nil},
+	{"# exit_codes: 3\n* * * * * foo\n", nil},
+	{"# name: db backup\n* * * * * foo\n", nil},
+	{"# name: foo\n* * * * * foo\n# name: foo\n* * * * * bar\n", nil},
+	{"# after:\n* * * * * foo\n", nil},
+	{"# after: -foo\n* * * * * foo\n", nil},
+	{"# name: foo\n# after: foo\n* * * * * foo\n", nil},
+	{"# sentry_monitor: Nightly Backup\n* * * * * foo\n", nil},
+	{"# sentry_dsn: sentry.example.com/2\n* * * * * foo\n", nil},
+	{"# sentry_env:\n* * * * * foo\n", nil},
+	{"# throttle: lines=0\n* * * * * foo\n", nil},
+	{"# throttle: lines=fast\n* * * * * foo\n", nil},
+	{"# logfile: foo.log size=0\n* * * * * foo\n", nil},
+	{"# logfile: foo.log keep=-1\n* * * * * foo\n", nil},
+	{"# logfile: foo.log color=blue\n* * * * * foo\n", nil},
+	{"# stdout_file:\n* * * * * foo\n", nil},
+	{"# stderr_file: foo.log keep=-1\n* * * * * foo\n", nil},
+	{"# run_at_startup: sometimes\n* * * * * foo\n", nil},
+	{"# skip_if_done: maybe\n* * * * * foo\n", nil},
+	{"# pushgateway_labels:\n* * * * * foo\n", nil},
+	{"# pushgateway_labels: job=backup\n* * * * * foo\n", nil},
+	{"# pushgateway_labels: billing\n* * * * * foo\n", nil},
+	{"CRON_TZ=Nowhere/Special\n* * * * * foo\n", nil},
+}
+
+func TestParseCrontab(t *testing.T) {
+	for _, tt := range parseCrontabTestCases {
+		label := fmt.Sprintf("ParseCrontab(%q)", tt.crontab)
+
+		reader := bytes.NewBufferString(tt.crontab)
+
+		crontab, err := ParseCrontab(reader)
+
+		if tt.expected == nil {
+			assert.Nil(t, crontab, label)
+			assert.NotNil(t, err, label)
+		} else {
+			if assert.NotNil(t, crontab, label) {
+				assert.Equal(t, tt.expected.Context, crontab.Context, label)
+
+				if assert.Equal(t, len(tt.expected.Jobs), len(crontab.Jobs), label) {
+					for i, crontabJob := range crontab.Jobs {
+						expectedJob := tt.expected.Jobs[i]
+						assert.Equal(t, expectedJob.Command, crontabJob.Command, label)
+						assert.Equal(t, expectedJob.Schedule, crontabJob.Schedule, label)
+						assert.Equal(t, expectedJob.Timeout, crontabJob.Timeout, label)
+						assert.Equal(t, expectedJob.ExpectedDuration, crontabJob.ExpectedDuration, label)
+						assert.Equal(t, expectedJob.Healthcheck, crontabJob.Healthcheck, label)
+						assert.Equal(t, expectedJob.Jitter, crontabJob.Jitter, label)
+						assert.Equal(t, expectedJob.CatchUp, crontabJob.CatchUp, label)
+						assert.Equal(t, expectedJob.Overlap, crontabJob.Overlap, label)
+						assert.Equal(t, expectedJob.Restart, crontabJob.Restart, label)
+						assert.Equal(t, expectedJob.Limits, crontabJob.Limits, label)
+						assert.Equal(t, expectedJob.Priority, crontabJob.Priority, label)
+						assert.Equal(t, expectedJob.Umask, crontabJob.Umask, label)
+						assert.Equal(t, expectedJob.LogFile, crontabJob.LogFile, label)
+						assert.Equal(t, expectedJob.StdoutFile, crontabJob.StdoutFile, label)
+						assert.Equal(t, expectedJob.StderrFile, crontabJob.StderrFile, label)
+						assert.Equal(t, expectedJob.PushgatewayLabels, crontabJob.PushgatewayLabels, label)
+						assert.Equal(t, expectedJob.RunAtStartup, crontabJob.RunAtStartup, label)
+						assert.Equal(t, expectedJob.SkipIfDone, crontabJob.SkipIfDone, label)
+						assert.Equal(t, expectedJob.Throttle, crontabJob.Throttle, label)
+						assert.Equal(t, expectedJob.Output, crontabJob.Output, label)
+						assert.Equal(t, expectedJob.StderrLevel, crontabJob.StderrLevel, label)
+						assert.Equal(t, expectedJob.ErrorPattern, crontabJob.ErrorPattern, label)
+						assert.Equal(t, expectedJob.WarningPattern, crontabJob.WarningPattern, label)
+						assert.Equal(t, expectedJob.Name, crontabJob.Name, label)
+						assert.Equal(t, expectedJob.After, crontabJob.After, label)
+						assert.Equal(t, expectedJob.Retries, crontabJob.Retries, label)
+						assert.Equal(t, expectedJob.RetryDelay, crontabJob.RetryDelay, label)
+						assert.Equal(t, expectedJob.ExitCodes, crontabJob.ExitCodes, label)
+						assert.Equal(t, expectedJob.MaxConsecutiveFailures, crontabJob.MaxConsecutiveFailures, label)
+						assert.Equal(t, expectedJob.StartupDelay, crontabJob.StartupDelay, label)
+						assert.Equal(t, expectedJob.Exec, crontabJob.Exec, label)
+						assert.Equal(t, expectedJob.Dir, crontabJob.Dir, label)
+						assert.Equal(t, expectedJob.Stdin, crontabJob.Stdin, label)
+						assert.Equal(t, expectedJob.OnFailure, crontabJob.OnFailure, label)
+						assert.Equal(t, expectedJob.Env, crontabJob.Env, label)
+						assert.Equal(t, expectedJob.EnvFiles, crontabJob.EnvFiles, label)
+						assert.Equal(t, expectedJob.Secrets, crontabJob.Secrets, label)
+						assert.Equal(t, expectedJob.Container, crontabJob.Container, label)
+						assert.Equal(t, expectedJob.KubernetesJob, crontabJob.KubernetesJob, label)
+						assert.Equal(t, expectedJob.SentryMonitor, crontabJob.SentryMonitor, label)
+						assert.Equal(t, expectedJob.SentryDSN, crontabJob.SentryDSN, label)
+						assert.Equal(t, expectedJob.SentryEnvironment, crontabJob.SentryEnvironment, label)
+						assert.NotNil(t, crontabJob.Expression, label)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestParseCrontabUmask(t *testing.T) {
+	crontab, err := ParseCrontab(bytes.NewBufferString("# umask: 027\n@hourly foo\n@hourly bar\n"))
+	if assert.Nil(t, err) && assert.Equal(t, 2, len(crontab.Jobs)) {
+		if assert.NotNil(t, crontab.Jobs[0].Umask) {
+			assert.Equal(t, os.FileMode(027), *crontab.Jobs[0].Umask)
+		}
+		assert.Nil(t, crontab.Jobs[1].Umask)
+	}
+}
+
+func TestParseCrontabStdinBlockLines(t *testing.T) {
+	crontab, err := ParseCrontab(bytes.NewBufferString("# stdin: <<EOF\nfoo\nbar\nEOF\n@hourly cat\n"))
+	if assert.Nil(t, err) && assert.Equal(t, 1, len(crontab.Jobs)) {
+		assert.Equal(t, 5, crontab.Jobs[0].Line)
+	}
+
+	_, err = ParseCrontab(bytes.NewBufferString("# stdin: <<EOF\nfoo\nEOF\nnot a job\n"))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "line 4")
+	}
+
+	_, err = ParseCrontab(bytes.NewBufferString("# stdin: <<EOF\nfoo\n"))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "line 1: unterminated stdin block (expected EOF)", err.Error())
+	}
+}
+
+func TestParseCrontabGroups(t *testing.T) {
+	tab := strings.Join([]string{
+		"#group backups",
+		"# timeout: 1h",
+		"# tags: backup",
+		"# env: PGHOST=db",
+		"",
+		"# name: db-backup",
+		"@daily backup db",
+		"",
+		"# Files are larger.",
+		"# timeout: 3h",
+		"# tags: nightly",
+		"@daily backup files",
+		"#endgroup",
+		"",
+		"@hourly cleanup",
+	}, "\n")
+
+	crontab, err := ParseCrontab(bytes.NewBufferString(tab))
+	if !assert.Nil(t, err) || !assert.Equal(t, 3, len(crontab.Jobs)) {
+		return
+	}
+
+	db, files, cleanup := crontab.Jobs[0], crontab.Jobs[1], crontab.Jobs[2]
+
+	assert.Equal(t, "backups", db.Group)
+	assert.Equal(t, "db-backup", db.Name)
+	assert.Equal(t, time.Hour, db.Timeout)
+	assert.Equal(t, []string{"backup"}, db.Tags)
+	assert.Equal(t, map[string]string{"PGHOST": "db"}, db.Env)
+
+	// Jobs' own directives apply after the group's.
+	assert.Equal(t, "backups", files.Group)
+	assert.Equal(t, 3*time.Hour, files.Timeout)
+	assert.Equal(t, []string{"backup", "nightly"}, files.Tags)
+	assert.Equal(t, map[string]string{"PGHOST": "db"}, files.Env)
+
+	assert.Equal(t, "", cleanup.Group)
+	assert.Equal(t, time.Duration(0), cleanup.Timeout)
+	assert.Nil(t, cleanup.Tags)
+	assert.Nil(t, cleanup.Env)
+
+	_, err = ParseCrontab(bytes.NewBufferString("#group backups\n# timeout: 1h\n@daily backup\n"))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "line 1: group backups is never closed (expected #endgroup)", err.Error())
+	}
+}
+
+func TestParseCrontabKeepsComments(t *testing.T) {
+	// These were ordinary comments before groups and env directives came
+	// along, and still are.
+	tab := strings.Join([]string{
+		"# group maintenance",
+		"# env: staging",
+		"# env: PG-HOST=db",
+		"@daily vacuum",
+		"# endgroup",
+	}, "\n")
+
+	crontab, err := ParseCrontab(bytes.NewBufferString(tab))
+	if assert.Nil(t, err) && assert.Equal(t, 1, len(crontab.Jobs)) {
+		assert.Equal(t, "", crontab.Jobs[0].Group)
+		assert.Nil(t, crontab.Jobs[0].Env)
+	}
+}
+
+func TestParseCrontabExpandEnvDirectives(t *testing.T) {
+	os.Setenv("SUPERCRONIC_TEST_HOST", "db.example.com")
+	defer os.Unsetenv("SUPERCRONIC_TEST_HOST")
+
+	tab := "PGPORT=5433\n# env: PGHOST=$SUPERCRONIC_TEST_HOST:$PGPORT\n@hourly psql\n"
+
+	crontab, err := ParseCrontabWithOptions(bytes.NewBufferString(tab), ParseOptions{ExpandEnv: true})
+	if assert.Nil(t, err) && assert.Equal(t, 1, len(crontab.Jobs)) {
+		assert.Equal(t, "db.example.com:5433", crontab.Jobs[0].Env["PGHOST"])
+	}
+}
+
+var secondsTestCases = []struct {
+	line     string
+	seconds  bool
+	schedule string
+	command  string
+	next     time.Time
+}{
+	{"*/10 * * * * * foo", false, "*/10 * * * * *", "foo", time.Date(2018, 1, 1, 0, 10, 0, 0, time.UTC)},
+	{"*/10 * * * * * foo", true, "*/10 * * * * *", "foo", time.Date(2018, 1, 1, 0, 0, 10, 0, time.UTC)},
+	{"*/10 * * * * foo", true, "*/10 * * * *", "foo", time.Date(2018, 1, 1, 0, 10, 0, 0, time.UTC)},
+	{"*/10 * * * * * * foo", true, "*/10 * * * * * *", "foo", time.Date(2018, 1, 1, 0, 0, 10, 0, time.UTC)},
+	{"@hourly foo", true, "@hourly", "foo", time.Date(2018, 1, 1, 1, 0, 0, 0, time.UTC)},
+}
+
+func TestParseCrontabWithSeconds(t *testing.T) {
+	t0 := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tt := range secondsTestCases {
+		label := fmt.Sprintf("ParseCrontabWithOptions(%q, seconds=%v)", tt.line, tt.seconds)
+
+		crontab, err := ParseCrontabWithOptions(bytes.NewBufferString(tt.line), ParseOptions{Seconds: tt.seconds})
+		if !assert.Nil(t, err, label) || !assert.Equal(t, 1, len(crontab.Jobs), label) {
+			continue
+		}
+
+		job := crontab.Jobs[0]
+		assert.Equal(t, tt.schedule, job.Schedule, label)
+		assert.Equal(t, tt.command, job.Command, label)
+		assert.Equal(t, tt.next, job.Expression.Next(t0), label)
+	}
+}
+
+func TestParseCrontabIntervals(t *testing.T) {
+	tab := strings.Join([]string{
+		"CRON_TZ=America/New_York",
+		"@every 90s foo",
+		"# every_from: end",
+		"@every  4h30m   bar baz",
+	}, "\n")
+
+	crontab, err := ParseCrontab(bytes.NewBufferString(tab))
+	if !assert.Nil(t, err) || !assert.Equal(t, 2, len(crontab.Jobs)) {
+		return
+	}
+
+	assert.Equal(t, "@every 90s", crontab.Jobs[0].Schedule)
+	assert.Equal(t, "foo", crontab.Jobs[0].Command)
+	assert.Equal(t, &IntervalExpression{Interval: 90 * time.Second}, crontab.Jobs[0].Expression)
+	assert.False(t, IsFromEnd(crontab.Jobs[0].Expression))
+
+	assert.Equal(t, "@every  4h30m", crontab.Jobs[1].Schedule)
+	assert.Equal(t, "bar baz", crontab.Jobs[1].Command)
+	assert.True(t, IsFromEnd(crontab.Jobs[1].Expression))
+
+	t0 := time.Date(2018, 1, 1, 0, 30, 0, 0, time.UTC)
+	assert.Equal(t, t0.Add(90*time.Second), crontab.Jobs[0].Expression.Next(t0))
+
+	for _, bad := range []string{
+		"@every 90 foo",
+		"@every 0s foo",
+		"@every 10ms foo",
+		"@every -1m foo",
+		"@every 1m",
+		"# every_from: end\n* * * * * foo",
+		"# every_from: middle\n@every 1m foo",
+	} {
+		_, err := ParseCrontab(bytes.NewBufferString(bad))
+		assert.NotNil(t, err, bad)
+	}
+}
+
+func TestParseCrontabExpandEnv(t *testing.T) {
+	os.Setenv("SUPERCRONIC_TEST_HOST", "db.example.com")
+	defer os.Unsetenv("SUPERCRONIC_TEST_HOST")
+
+	tab := strings.Join([]string{
+		"BACKUP_DIR=/backups/${SUPERCRONIC_TEST_HOST}",
+		"LITERAL='$SUPERCRONIC_TEST_HOST'",
+		"* * * * * backup $SUPERCRONIC_TEST_HOST $BACKUP_DIR $UNDEFINED_VAR $$HOME",
+	}, "\n")
+
+	crontab, err := ParseCrontabWithOptions(bytes.NewBufferString(tab), ParseOptions{ExpandEnv: true})
+	if assert.Nil(t, err) && assert.Equal(t, 1, len(crontab.Jobs)) {
+		assert.Equal(t, "/backups/db.example.com", crontab.Context.Environ["BACKUP_DIR"])
+		assert.Equal(t, "$SUPERCRONIC_TEST_HOST", crontab.Context.Environ["LITERAL"])
+		assert.Equal(t, "backup db.example.com /backups/db.example.com $UNDEFINED_VAR $HOME", crontab.Jobs[0].Command)
+	}
+
+	// Expansion is off by default.
+	crontab, err = ParseCrontabWithOptions(bytes.NewBufferString(tab), ParseOptions{})
+	if assert.Nil(t, err) && assert.Equal(t, 1, len(crontab.Jobs)) {
+		assert.Equal(t, "/backups/${SUPERCRONIC_TEST_HOST}", crontab.Context.Environ["BACKUP_DIR"])
+		assert.Equal(t, "backup $SUPERCRONIC_TEST_HOST $BACKUP_DIR $UNDEFINED_VAR $$HOME", crontab.Jobs[0].Command)
+	}
+}
+
+func TestParseCrontabKeepsUnknownTZ(t *testing.T) {
+	for _, value := range []string{"CET-1CEST,M3.5.0,M10.5.0/3", "UTC0", ":/etc/localtime", "Nowhere/Special"} {
+		tab := "TZ=Europe/Paris\nTZ=" + value + "\n0 9 * * * foo\n"
+
+		crontab, err := ParseCrontab(bytes.NewBufferString(tab))
+		if !assert.Nil(t, err, value) || !assert.Equal(t, 1, len(crontab.Jobs), value) {
+			continue
+		}
+
+		assert.Equal(t, value, crontab.Context.Environ["TZ"], value)
+		assert.Nil(t, crontab.Jobs[0].Location(), value)
+	}
+}
+
+func TestParseCrontabTimezones(t *testing.T) {
+	tab := strings.Join([]string{
+		"0 9 * * * utc",
+		"TZ=Europe/Paris",
+		"0 9 * * * paris",
+		"CRON_TZ=America/New_York",
+		"0 9 * * * new-york",
+		"TZ=Asia/Tokyo",
+		"0 9 * * * still-new-york",
+		"CRON_TZ=",
+		"0 9 * * * tokyo",
+	}, "\n")
+
+	crontab, err := ParseCrontab(bytes.NewBufferString(tab))
+	if !assert.Nil(t, err) || !assert.Equal(t, 5, len(crontab.Jobs)) {
+		return
+	}
+
+	assert.Equal(t, "Asia/Tokyo", crontab.Context.Environ["TZ"])
+
+	expected := []struct {
+		winter time.Time
+		summer time.Time
+	}{
+		{time.Date(2018, 1, 1, 9, 0, 0, 0, time.UTC), time.Date(2018, 7, 1, 9, 0, 0, 0, time.UTC)},
+		{time.Date(2018, 1, 1, 8, 0, 0, 0, time.UTC), time.Date(2018, 7, 1, 7, 0, 0, 0, time.UTC)},
+		{time.Date(2018, 1, 1, 14, 0, 0, 0, time.UTC), time.Date(2018, 7, 1, 13, 0, 0, 0, time.UTC)},
+		{time.Date(2018, 1, 1, 14, 0, 0, 0, time.UTC), time.Date(2018, 7, 1, 13, 0, 0, 0, time.UTC)},
+		{time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC), time.Date(2018, 7, 2, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for i, job := range crontab.Jobs {
+		winter := job.Expression.Next(time.Date(2018, 1, 1, 0, 30, 0, 0, time.UTC))
+		summer := job.Expression.Next(time.Date(2018, 7, 1, 0, 30, 0, 0, time.UTC))
+		assert.True(t, expected[i].winter.Equal(winter), "%s: %v", job.Command, winter)
+		assert.True(t, expected[i].summer.Equal(summer), "%s: %v", job.Command, summer)
+	}
+
+	assert.Nil(t, crontab.Jobs[0].Location())
+	assert.Equal(t, "Europe/Paris", crontab.Jobs[1].Location().String())
+	assert.Equal(t, "America/New_York", crontab.Jobs[3].Location().String())
+}
+
+var extendedSyntaxTestCases = []struct {
+	schedule string
+	from     time.Time
+	expected time.Time
+}{
+	{"0 0 L * *", time.Date(2019, 2, 7, 12, 0, 0, 0, time.UTC), time.Date(2019, 2, 28, 0, 0, 0, 0, time.UTC)},
+	// March 31 2019 is a Sunday.
+	{"0 0 LW * *", time.Date(2019, 3, 7, 12, 0, 0, 0, time.UTC), time.Date(2019, 3, 29, 0, 0, 0, 0, time.UTC)},
+	// February 16 2019 is a Saturday.
+	{"0 0 16W * *", time.Date(2019, 2, 7, 12, 0, 0, 0, time.UTC), time.Date(2019, 2, 15, 0, 0, 0, 0, time.UTC)},
+	{"0 0 * * 5L", time.Date(2019, 2, 7, 12, 0, 0, 0, time.UTC), time.Date(2019, 2, 22, 0, 0, 0, 0, time.UTC)},
+	{"0 0 * * 1#2", time.Date(2019, 2, 7, 12, 0, 0, 0, time.UTC), time.Date(2019, 2, 11, 0, 0, 0, 0, time.UTC)},
+}
+
+func TestParseCrontabExtendedSyntax(t *testing.T) {
+	for _, tt := range extendedSyntaxTestCases {
+		crontab, err := ParseCrontab(bytes.NewBufferString(tt.schedule + " foo\n"))
+		if !assert.Nil(t, err, tt.schedule) || !assert.Equal(t, 1, len(crontab.Jobs), tt.schedule) {
+			continue
+		}
+
+		assert.Equal(t, tt.schedule, crontab.Jobs[0].Schedule)
+		assert.Equal(t, "foo", crontab.Jobs[0].Command)
+
+		next := crontab.Jobs[0].Expression.Next(tt.from)
+		assert.True(t, tt.expected.Equal(next), "%s: expected %v, got %v", tt.schedule, tt.expected, next)
+	}
+}
+
+func TestParseCrontabWithLocation(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	tab := strings.Join([]string{
+		"0 9 * * * tokyo",
+		"CRON_TZ=Europe/Paris",
+		"0 9 * * * paris",
+		"CRON_TZ=",
+		"0 9 * * * tokyo-again",
+	}, "\n")
+
+	crontab, err := ParseCrontabWithOptions(bytes.NewBufferString(tab), ParseOptions{Location: tokyo})
+	if !assert.Nil(t, err) || !assert.Equal(t, 3, len(crontab.Jobs)) {
+		return
+	}
+
+	assert.Equal(t, "Asia/Tokyo", crontab.Jobs[0].Location().String())
+	assert.Equal(t, "Europe/Paris", crontab.Jobs[1].Location().String())
+	assert.Equal(t, "Asia/Tokyo", crontab.Jobs[2].Location().String())
+
+	next := crontab.Jobs[0].Expression.Next(time.Date(2018, 1, 1, 0, 30, 0, 0, time.UTC))
+	assert.True(t, time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC).Equal(next), "%v", next)
+}
+
+func TestParseSchedule(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	from := time.Date(2018, 1, 1, 0, 30, 0, 0, time.UTC)
+
+	expr, err := ParseSchedule("0 9 * * *", ParseOptions{Location: tokyo})
+	if assert.Nil(t, err) {
+		next := expr.Next(from)
+		assert.True(t, time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC).Equal(next), "%v", next)
+	}
+
+	expr, err = ParseSchedule(" */15 2-4 * * * ", ParseOptions{})
+	if assert.Nil(t, err) {
+		assert.Equal(t, time.Date(2018, 1, 1, 2, 0, 0, 0, time.UTC), expr.Next(from))
+	}
+
+	expr, err = ParseSchedule("@every 1h", ParseOptions{})
+	if assert.Nil(t, err) {
+		assert.Equal(t, from.Add(time.Hour), expr.Next(from))
+	}
+
+	for _, schedule := range []string{"", "* * *", "* * * * * foo", "@every 1ms", "61 * * * *"} {
+		_, err := ParseSchedule(schedule, ParseOptions{})
+		assert.NotNil(t, err, schedule)
 	}
 }
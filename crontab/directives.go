@@ -0,0 +1,1005 @@
+package crontab
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Directives are comments of the form `# key: value` placed above a job. They
+// configure the job that follows them. Comments that look like directives but
+// use an unknown key are treated as regular comments.
+
+var directiveMatcher = regexp.MustCompile(`^#\s*([A-Za-z][A-Za-z_]*)\s*:\s*(.*?)\s*$`)
+
+type directive struct {
+	key   string
+	value string
+	// data is the block that follows a stdin directive, if its value
+	// starts one (see blockDelimiter).
+	data *string
+	// line is the line the directive is on, for error messages.
+	line int
+}
+
+type directiveParser func(job *Job, value string) error
+
+var directiveParsers = map[string]directiveParser{
+	"name":        parseNameDirective,
+	"after":       parseAfterDirective,
+	"tags":        parseTagsDirective,
+	"timeout":     parseTimeoutDirective,
+	"healthcheck": parseHealthcheckDirective,
+	"catchup":     parseCatchUpDirective,
+	"overlap":     parseOverlapDirective,
+	"jitter":      parseJitterDirective,
+	"limits":      parseLimitsDirective,
+	"priority":    parsePriorityDirective,
+	"umask":       parseUmaskDirective,
+	"container":   parseContainerDirective,
+	"logfile":     parseLogFileDirective,
+	"throttle":    parseThrottleDirective,
+	"output":      parseOutputDirective,
+	"exec":        parseExecDirective,
+	"workdir":     parseWorkdirDirective,
+	"stdin":       parseStdinDirective,
+	"env":         parseEnvDirective,
+	"env_file":    parseEnvFileDirective,
+	"retries":     parseRetriesDirective,
+	"exit_codes":  parseExitCodesDirective,
+	"every_from":  parseEveryFromDirective,
+	"restart":     parseRestartDirective,
+	"on_failure":  parseOnFailureDirective,
+	"stdout_file": parseStdoutFileDirective,
+	"stderr_file": parseStderrFileDirective,
+	"secret":      parseSecretDirective,
+
+	"expected_duration":        parseExpectedDurationDirective,
+	"sentry_monitor":           parseSentryMonitorDirective,
+	"sentry_dsn":               parseSentryDSNDirective,
+	"sentry_env":               parseSentryEnvDirective,
+	"pushgateway_labels":       parsePushgatewayLabelsDirective,
+	"run_at_startup":           parseRunAtStartupDirective,
+	"skip_if_done":             parseSkipIfDoneDirective,
+	"startup_delay":            parseStartupDelayDirective,
+	"max_consecutive_failures": parseMaxConsecutiveFailuresDirective,
+	"stderr_level":             parseStderrLevelDirective,
+	"error_pattern":            parseErrorPatternDirective,
+	"warning_pattern":          parseWarningPatternDirective,
+	"kubernetes_job":           parseKubernetesJobDirective,
+}
+
+func parseDirectiveLine(line string) (*directive, bool) {
+	r := directiveMatcher.FindStringSubmatch(line)
+	if r == nil {
+		return nil, false
+	}
+
+	if _, ok := directiveParsers[r[1]]; !ok {
+		return nil, false
+	}
+
+	// Comments like `# env: staging` predate the env directive.
+	if r[1] == "env" && !envDirectiveMatcher.MatchString(r[2]) {
+		return nil, false
+	}
+
+	return &directive{key: r[1], value: r[2]}, true
+}
+
+func applyDirectives(job *Job, directives []*directive) error {
+	for _, d := range directives {
+		if d.data != nil {
+			job.Stdin = &Stdin{Data: *d.data}
+			continue
+		}
+
+		if err := directiveParsers[d.key](job, d.value); err != nil {
+			return fmt.Errorf("line %d: bad %s directive: %v", d.line, d.key, err)
+		}
+	}
+
+	if err := checkContainer(job); err != nil {
+		return fmt.Errorf("line %d: %v", job.Line, err)
+	}
+	return nil
+}
+
+func parsePositiveDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive: %s", value)
+	}
+
+	return d, nil
+}
+
+var jobNameMatcher = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+func parseNameDirective(job *Job, value string) error {
+	if !jobNameMatcher.MatchString(value) {
+		return fmt.Errorf("not a valid name (letters, digits, _, . or -): %s", value)
+	}
+
+	job.Name = value
+	return nil
+}
+
+func parseAfterDirective(job *Job, value string) error {
+	names := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+
+	if len(names) == 0 {
+		return fmt.Errorf("no job name given")
+	}
+
+	for _, name := range names {
+		if !jobNameMatcher.MatchString(name) {
+			return fmt.Errorf("not a valid name (letters, digits, _, . or -): %s", name)
+		}
+	}
+
+	job.After = append(job.After, names...)
+	return nil
+}
+
+func parseTagsDirective(job *Job, value string) error {
+	tags, err := ParseTags(value)
+	if err != nil {
+		return err
+	}
+
+	if len(tags) == 0 {
+		return fmt.Errorf("no tag given")
+	}
+
+	job.Tags = append(job.Tags, tags...)
+	return nil
+}
+
+func parseTimeoutDirective(job *Job, value string) error {
+	d, err := parsePositiveDuration(value)
+	if err != nil {
+		return err
+	}
+
+	job.Timeout = d
+	return nil
+}
+
+func parseJitterDirective(job *Job, value string) error {
+	d, err := parsePositiveDuration(value)
+	if err != nil {
+		return err
+	}
+
+	job.Jitter = d
+	return nil
+}
+
+func parseExpectedDurationDirective(job *Job, value string) error {
+	d, err := parsePositiveDuration(value)
+	if err != nil {
+		return err
+	}
+
+	job.ExpectedDuration = d
+	return nil
+}
+
+func parseHealthcheckDirective(job *Job, value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("not an http(s) URL: %s", value)
+	}
+
+	job.Healthcheck = value
+	return nil
+}
+
+func parseCatchUpDirective(job *Job, value string) error {
+	policy, err := ParseCatchUpPolicy(value)
+	if err != nil {
+		return err
+	}
+
+	job.CatchUp = policy
+	return nil
+}
+
+func parseOverlapDirective(job *Job, value string) error {
+	policy, err := ParseOverlapPolicy(value)
+	if err != nil {
+		return err
+	}
+
+	job.Overlap = policy
+	return nil
+}
+
+func parseOutputDirective(job *Job, value string) error {
+	format, err := ParseOutputFormat(value)
+	if err != nil {
+		return err
+	}
+
+	job.Output = format
+	return nil
+}
+
+func parseStderrLevelDirective(job *Job, value string) error {
+	level, err := ParseOutputLevel(value)
+	if err != nil {
+		return err
+	}
+
+	job.StderrLevel = level
+	return nil
+}
+
+func parseErrorPatternDirective(job *Job, value string) error {
+	pattern, err := ParseOutputPattern(value)
+	if err != nil {
+		return err
+	}
+
+	job.ErrorPattern = pattern
+	return nil
+}
+
+func parseWarningPatternDirective(job *Job, value string) error {
+	pattern, err := ParseOutputPattern(value)
+	if err != nil {
+		return err
+	}
+
+	job.WarningPattern = pattern
+	return nil
+}
+
+func parseRestartDirective(job *Job, value string) error {
+	if !IsDaemon(job.Expression) {
+		return fmt.Errorf("only applies to @always jobs")
+	}
+
+	policy, err := ParseRestartPolicy(value)
+	if err != nil {
+		return err
+	}
+
+	job.Restart = policy
+	return nil
+}
+
+func parseEveryFromDirective(job *Job, value string) error {
+	e, ok := job.Expression.(*IntervalExpression)
+	if !ok {
+		return fmt.Errorf("only applies to @every schedules")
+	}
+
+	switch value {
+	case "start":
+		e.FromEnd = false
+	case "end":
+		e.FromEnd = true
+	default:
+		return fmt.Errorf("expected start or end: %s", value)
+	}
+
+	return nil
+}
+
+func parseRetriesDirective(job *Job, value string) error {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return fmt.Errorf("no count given")
+	}
+
+	retries, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return err
+	}
+
+	if retries < 0 {
+		return fmt.Errorf("count must not be negative")
+	}
+
+	job.Retries = retries
+
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 || kv[0] != "delay" {
+			return fmt.Errorf("expected delay=DURATION: %s", field)
+		}
+
+		if job.RetryDelay, err = parsePositiveDuration(kv[1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseStartupDelayDirective(job *Job, value string) error {
+	delay, err := parsePositiveDuration(value)
+	if err != nil {
+		return err
+	}
+
+	job.StartupDelay = delay
+	return nil
+}
+
+func parseMaxConsecutiveFailuresDirective(job *Job, value string) error {
+	failures, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+
+	if failures <= 0 {
+		return fmt.Errorf("count must be positive")
+	}
+
+	job.MaxConsecutiveFailures = failures
+	return nil
+}
+
+func parseExitCodesDirective(job *Job, value string) error {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return fmt.Errorf("no exit codes given")
+	}
+
+	codes := make(map[int]ExitCodeClass)
+
+	for _, field := range fields {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("expected class=CODE[,CODE...]: %s", field)
+		}
+
+		class, err := ParseExitCodeClass(kv[0])
+		if err != nil {
+			return err
+		}
+
+		for _, c := range strings.Split(kv[1], ",") {
+			code, err := strconv.Atoi(c)
+			if err != nil {
+				return err
+			}
+
+			if code < 1 || code > 255 {
+				return fmt.Errorf("exit code must be between 1 and 255: %d", code)
+			}
+
+			if other, ok := codes[code]; ok && other != class {
+				return fmt.Errorf("exit code %d is both %s and %s", code, other, class)
+			}
+
+			codes[code] = class
+		}
+	}
+
+	job.ExitCodes = codes
+	return nil
+}
+
+func parseWorkdirDirective(job *Job, value string) error {
+	if value == "" {
+		return fmt.Errorf("no directory given")
+	}
+
+	job.Dir = value
+	return nil
+}
+
+var stdinBlockMatcher = regexp.MustCompile(`^<<([A-Za-z_][A-Za-z0-9_]*)$`)
+
+// blockDelimiter returns the delimiter of the block d starts, if it is a
+// stdin directive whose value is of the form <<EOF.
+func (d *directive) blockDelimiter() (string, bool) {
+	if d.key != "stdin" {
+		return "", false
+	}
+
+	r := stdinBlockMatcher.FindStringSubmatch(d.value)
+	if r == nil {
+		return "", false
+	}
+	return r[1], true
+}
+
+// readBlock reads the lines of a block from scanner, up to the line that only
+// holds delimiter (which it consumes). Lines are left as is. It returns false
+// if there is no such line.
+func readBlock(scanner *bufio.Scanner, delimiter string) ([]string, bool) {
+	lines := make([]string, 0)
+
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == delimiter {
+			return lines, true
+		}
+		lines = append(lines, scanner.Text())
+	}
+
+	return lines, false
+}
+
+// parseStdinDirective parses the path of a file. Blocks (`stdin: <<EOF`) are
+// read by parseCrontab, which passes them on as the directive's data.
+func parseStdinDirective(job *Job, value string) error {
+	if value == "" {
+		return fmt.Errorf("no path given")
+	}
+
+	job.Stdin = &Stdin{Path: value}
+	return nil
+}
+
+func parseOnFailureDirective(job *Job, value string) error {
+	if value == "" {
+		return fmt.Errorf("no command given")
+	}
+
+	job.OnFailure = value
+	return nil
+}
+
+var envDirectiveMatcher = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*\s*=`)
+
+// parseEnvDirective parses a variable set for the job only, e.g.
+// `PGHOST=db`. It may be repeated.
+func parseEnvDirective(job *Job, value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("expected NAME=value: %s", value)
+	}
+
+	name := strings.TrimSpace(kv[0])
+	if !secretNameMatcher.MatchString(name) {
+		return fmt.Errorf("not a valid variable name: %s", name)
+	}
+
+	if job.Env == nil {
+		job.Env = make(map[string]string)
+	}
+
+	job.Env[name] = strings.TrimSpace(kv[1])
+	return nil
+}
+
+func parseEnvFileDirective(job *Job, value string) error {
+	if value == "" {
+		return fmt.Errorf("no path given")
+	}
+
+	job.EnvFiles = append(job.EnvFiles, value)
+	return nil
+}
+
+var secretNameMatcher = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseSecretDirective parses a secret, e.g. `DB_PASS=file:/run/secrets/db`
+// or `DB_PASS=vault:kv/data/app#password`. It may be repeated.
+func parseSecretDirective(job *Job, value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("expected NAME=source: %s", value)
+	}
+
+	name, source := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+
+	if !secretNameMatcher.MatchString(name) {
+		return fmt.Errorf("not a valid variable name: %s", name)
+	}
+
+	if err := validateSecretSource(source); err != nil {
+		return err
+	}
+
+	job.Secrets = append(job.Secrets, Secret{Name: name, Source: source})
+	return nil
+}
+
+func validateSecretSource(source string) error {
+	parts := strings.SplitN(source, ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("expected file:PATH or vault:PATH#KEY: %s", source)
+	}
+
+	switch parts[0] {
+	case "file":
+		if parts[1] == "" {
+			return fmt.Errorf("no path given: %s", source)
+		}
+	case "vault":
+		ref := strings.SplitN(parts[1], "#", 2)
+		if len(ref) != 2 || ref[0] == "" || ref[1] == "" {
+			return fmt.Errorf("expected vault:PATH#KEY: %s", source)
+		}
+	default:
+		return fmt.Errorf("unknown secrets provider: %q (expected file or vault)", parts[0])
+	}
+
+	return nil
+}
+
+func parseExecDirective(job *Job, value string) error {
+	mode, err := ParseExecMode(value)
+	if err != nil {
+		return err
+	}
+
+	if mode == ExecDirect {
+		if _, err := SplitCommand(job.Command); err != nil {
+			return err
+		}
+	}
+
+	job.Exec = mode
+	return nil
+}
+
+var sentryMonitorSlugMatcher = regexp.MustCompile(`^[a-z0-9_-]{1,50}$`)
+
+func parseRunAtStartupDirective(job *Job, value string) error {
+	runAtStartup, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("expected true or false: %s", value)
+	}
+
+	job.RunAtStartup = &runAtStartup
+	return nil
+}
+
+func parseSkipIfDoneDirective(job *Job, value string) error {
+	skipIfDone, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("expected true or false: %s", value)
+	}
+
+	job.SkipIfDone = skipIfDone
+	return nil
+}
+
+func parseSentryMonitorDirective(job *Job, value string) error {
+	if !sentryMonitorSlugMatcher.MatchString(value) {
+		return fmt.Errorf("not a valid monitor slug (up to 50 lowercase letters, digits, - or _): %s", value)
+	}
+
+	job.SentryMonitor = value
+	return nil
+}
+
+func parseSentryDSNDirective(job *Job, value string) error {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil || u.Host == "" {
+		return fmt.Errorf("not a valid Sentry DSN: %s", value)
+	}
+
+	job.SentryDSN = value
+	return nil
+}
+
+func parseSentryEnvDirective(job *Job, value string) error {
+	if value == "" {
+		return fmt.Errorf("no environment given")
+	}
+
+	job.SentryEnvironment = value
+	return nil
+}
+
+var metricLabelMatcher = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parsePushgatewayLabelsDirective parses space-separated labels, e.g.
+// `team=billing tier=critical`.
+func parsePushgatewayLabelsDirective(job *Job, value string) error {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return fmt.Errorf("no labels given")
+	}
+
+	labels := make(map[string]string, len(fields))
+
+	for _, field := range fields {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("expected name=value: %s", field)
+		}
+
+		if !metricLabelMatcher.MatchString(kv[0]) || strings.HasPrefix(kv[0], "__") {
+			return fmt.Errorf("not a valid label name: %s", kv[0])
+		}
+
+		if kv[0] == "job" || kv[0] == "cron_job" {
+			return fmt.Errorf("label %s is reserved", kv[0])
+		}
+
+		labels[kv[0]] = kv[1]
+	}
+
+	job.PushgatewayLabels = labels
+	return nil
+}
+
+var byteSizeUnits = map[string]uint64{
+	"":  1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+var byteSizeMatcher = regexp.MustCompile(`^(\d+)([KMGT]?)i?B?$`)
+
+// parseByteSize parses sizes such as 512M, 1G, or 1073741824.
+func parseByteSize(value string) (uint64, error) {
+	r := byteSizeMatcher.FindStringSubmatch(strings.ToUpper(value))
+	if r == nil {
+		return 0, fmt.Errorf("invalid size: %s", value)
+	}
+
+	n, err := strconv.ParseUint(r[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return n * byteSizeUnits[r[2]], nil
+}
+
+// parseLimitsDirective parses space-separated limits, e.g.
+// `mem=512M cpu=0.5 nofile=1024`.
+func parseLimitsDirective(job *Job, value string) error {
+	limits := &Limits{}
+
+	for _, field := range strings.Fields(value) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("expected key=value: %s", field)
+		}
+
+		var err error
+
+		switch kv[0] {
+		case "mem":
+			limits.Memory, err = parseByteSize(kv[1])
+			if err == nil && limits.Memory == 0 {
+				err = fmt.Errorf("mem must be positive")
+			}
+		case "cpu":
+			limits.CPU, err = strconv.ParseFloat(kv[1], 64)
+			if err == nil && limits.CPU <= 0 {
+				err = fmt.Errorf("cpu must be positive")
+			}
+		case "nofile":
+			limits.NoFile, err = strconv.ParseUint(kv[1], 10, 64)
+			if err == nil && limits.NoFile == 0 {
+				err = fmt.Errorf("nofile must be positive")
+			}
+		default:
+			err = fmt.Errorf("unknown limit: %s", kv[0])
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if *limits == (Limits{}) {
+		return fmt.Errorf("no limits given")
+	}
+
+	job.Limits = limits
+	return nil
+}
+
+// parseContainerDirective parses a space-separated container, e.g.
+// `image=alpine:3.19 network=backend mount=/data:/data:ro`, or `exec=app`.
+// mount may be repeated.
+func parseContainerDirective(job *Job, value string) error {
+	container := &Container{}
+
+	for _, field := range strings.Fields(value) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return fmt.Errorf("expected key=value: %s", field)
+		}
+
+		switch kv[0] {
+		case "image":
+			container.Image = kv[1]
+		case "exec":
+			container.Exec = kv[1]
+		case "user":
+			container.User = kv[1]
+		case "network":
+			container.Network = kv[1]
+		case "mount":
+			container.Mounts = append(container.Mounts, kv[1])
+		default:
+			return fmt.Errorf("unknown container setting: %s", kv[0])
+		}
+	}
+
+	if (container.Image == "") == (container.Exec == "") {
+		return fmt.Errorf("expected either image or exec")
+	}
+
+	if container.Exec != "" && (container.Network != "" || len(container.Mounts) > 0) {
+		return fmt.Errorf("network and mount only apply to new containers (i.e. with image)")
+	}
+
+	job.Container = container
+	return nil
+}
+
+// parseKubernetesJobDirective parses a space-separated Kubernetes Job, e.g.
+// `template=/etc/supercronic/report.yaml namespace=batch container=report`.
+func parseKubernetesJobDirective(job *Job, value string) error {
+	kubernetesJob := &KubernetesJob{}
+
+	for _, field := range strings.Fields(value) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return fmt.Errorf("expected key=value: %s", field)
+		}
+
+		switch kv[0] {
+		case "template":
+			kubernetesJob.Template = kv[1]
+		case "namespace":
+			kubernetesJob.Namespace = kv[1]
+		case "container":
+			kubernetesJob.Container = kv[1]
+		default:
+			return fmt.Errorf("unknown kubernetes_job setting: %s", kv[0])
+		}
+	}
+
+	if kubernetesJob.Template == "" {
+		return fmt.Errorf("template is required")
+	}
+
+	job.KubernetesJob = kubernetesJob
+	return nil
+}
+
+// checkContainer reports settings that don't apply to jobs run in containers
+// or as Kubernetes Jobs. Limits are applied to new containers, but running
+// containers have theirs, and Kubernetes Jobs get theirs from their template.
+func checkContainer(job *Job) error {
+	if job.KubernetesJob != nil {
+		switch {
+		case job.Container != nil:
+			return fmt.Errorf("jobs cannot both run in a container and as a Kubernetes Job")
+		case job.Limits != nil:
+			return fmt.Errorf("limits are not supported for Kubernetes Jobs (set resources in the template instead)")
+		case job.Priority != nil:
+			return fmt.Errorf("priority is not supported for Kubernetes Jobs")
+		case job.Stdin != nil:
+			return fmt.Errorf("stdin is not supported for Kubernetes Jobs")
+		case job.Umask != nil:
+			return fmt.Errorf("umask is not supported for Kubernetes Jobs")
+		}
+		return nil
+	}
+
+	if job.Container == nil {
+		return nil
+	}
+
+	if job.Priority != nil {
+		return fmt.Errorf("priority is not supported for jobs run in containers")
+	}
+
+	if job.Umask != nil {
+		return fmt.Errorf("umask is not supported for jobs run in containers")
+	}
+
+	if job.Limits != nil && job.Container.Exec != "" {
+		return fmt.Errorf("limits are not supported for jobs run in running containers")
+	}
+
+	return nil
+}
+
+// parseUmaskDirective parses an octal umask, e.g. `027`, as with umask(1).
+func parseUmaskDirective(job *Job, value string) error {
+	umask, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || umask > 0777 {
+		return fmt.Errorf("expected an octal mask between 000 and 777: %s", value)
+	}
+
+	mode := os.FileMode(umask)
+	job.Umask = &mode
+	return nil
+}
+
+// parsePriorityDirective parses a space-separated priority, e.g.
+// `nice=10 ioclass=best-effort iolevel=7`. Setting iolevel alone implies the
+// best-effort class, as with ionice(1).
+func parsePriorityDirective(job *Job, value string) error {
+	priority := &Priority{}
+	hasLevel := false
+
+	for _, field := range strings.Fields(value) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("expected key=value: %s", field)
+		}
+
+		var err error
+
+		switch kv[0] {
+		case "nice":
+			priority.Nice, err = strconv.Atoi(kv[1])
+			if err == nil && (priority.Nice < -20 || priority.Nice > 19) {
+				err = fmt.Errorf("nice must be between -20 and 19")
+			}
+		case "ioclass":
+			priority.IOClass, err = ParseIOClass(kv[1])
+		case "iolevel":
+			priority.IOLevel, err = strconv.Atoi(kv[1])
+			if err == nil && (priority.IOLevel < 0 || priority.IOLevel > 7) {
+				err = fmt.Errorf("iolevel must be between 0 and 7")
+			}
+			hasLevel = true
+		default:
+			err = fmt.Errorf("unknown priority: %s", kv[0])
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if hasLevel {
+		if priority.IOClass == IOIdle {
+			return fmt.Errorf("iolevel does not apply to the idle class")
+		}
+		if priority.IOClass == "" {
+			priority.IOClass = IOBestEffort
+		}
+	}
+
+	if *priority == (Priority{}) {
+		return fmt.Errorf("no priority given")
+	}
+
+	job.Priority = priority
+	return nil
+}
+
+// DEFAULT_LOG_FILE_KEEP is how many rotated log files are kept unless a
+// logfile directive says otherwise.
+var DEFAULT_LOG_FILE_KEEP = 5
+
+func parseLogFileDirective(job *Job, value string) error {
+	logFile, err := parseLogFile(value)
+	if err != nil {
+		return err
+	}
+
+	job.LogFile = logFile
+	return nil
+}
+
+func parseStdoutFileDirective(job *Job, value string) error {
+	logFile, err := parseLogFile(value)
+	if err != nil {
+		return err
+	}
+
+	job.StdoutFile = logFile
+	return nil
+}
+
+func parseStderrFileDirective(job *Job, value string) error {
+	logFile, err := parseLogFile(value)
+	if err != nil {
+		return err
+	}
+
+	job.StderrFile = logFile
+	return nil
+}
+
+// parseLogFile parses a path, optionally followed by space-separated rotation
+// settings, e.g. `/var/log/backup.log size=10M age=24h keep=3`.
+func parseLogFile(value string) (*LogFile, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no path given")
+	}
+
+	logFile := &LogFile{Path: fields[0], Keep: DEFAULT_LOG_FILE_KEEP}
+
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("expected key=value: %s", field)
+		}
+
+		var err error
+
+		switch kv[0] {
+		case "size":
+			logFile.MaxSize, err = parseByteSize(kv[1])
+			if err == nil && logFile.MaxSize == 0 {
+				err = fmt.Errorf("size must be positive")
+			}
+		case "age":
+			logFile.MaxAge, err = parsePositiveDuration(kv[1])
+		case "keep":
+			logFile.Keep, err = strconv.Atoi(kv[1])
+			if err == nil && logFile.Keep < 0 {
+				err = fmt.Errorf("keep must not be negative")
+			}
+		default:
+			err = fmt.Errorf("unknown setting: %s", kv[0])
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return logFile, nil
+}
+
+// parseThrottleDirective parses space-separated limits, e.g.
+// `lines=100 bytes=10M`.
+func parseThrottleDirective(job *Job, value string) error {
+	throttle := &Throttle{}
+
+	for _, field := range strings.Fields(value) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("expected key=value: %s", field)
+		}
+
+		var err error
+
+		switch kv[0] {
+		case "lines":
+			throttle.LinesPerSecond, err = strconv.Atoi(kv[1])
+			if err == nil && throttle.LinesPerSecond <= 0 {
+				err = fmt.Errorf("lines must be positive")
+			}
+		case "bytes":
+			throttle.MaxBytes, err = parseByteSize(kv[1])
+			if err == nil && throttle.MaxBytes == 0 {
+				err = fmt.Errorf("bytes must be positive")
+			}
+		default:
+			err = fmt.Errorf("unknown limit: %s", kv[0])
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if *throttle == (Throttle{}) {
+		return fmt.Errorf("no limits given")
+	}
+
+	job.Throttle = throttle
+	return nil
+}
@@ -0,0 +1,93 @@
+package crontab
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var envFileLineMatcher = regexp.MustCompile(`^(?:export\s+)?([A-Za-z_][A-Za-z0-9_.]*)\s*=\s*(.*)$`)
+
+var envFileUnescaper = strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`, `\$`, `$`)
+
+// ReadEnvFile reads variables from the dotenv-format file at path.
+func ReadEnvFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseEnvFile(file)
+}
+
+// ParseEnvFile parses variables in dotenv format: blank lines and lines that
+// start with # are ignored, and other lines are KEY=VALUE, optionally
+// prefixed with `export`. Values may be single-quoted (taken literally), or
+// double-quoted (in which case \n, \t, \", \\ and \$ are unescaped).
+// Unquoted values end at the first ` #`.
+func ParseEnvFile(reader io.Reader) (map[string]string, error) {
+	env := make(map[string]string)
+
+	scanner := bufio.NewScanner(reader)
+
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		r := envFileLineMatcher.FindStringSubmatch(line)
+		if r == nil {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE: %s", lineno, line)
+		}
+
+		value, err := parseEnvFileValue(r[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineno, err)
+		}
+
+		env[r[1]] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+func parseEnvFileValue(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	switch quote := value[0]; quote {
+	case '\'':
+		end := strings.IndexByte(value[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quoted value: %s", value)
+		}
+		return value[1 : end+1], nil
+	case '"':
+		for i := 1; i < len(value); i++ {
+			switch value[i] {
+			case '\\':
+				i++
+			case '"':
+				return envFileUnescaper.Replace(value[1:i]), nil
+			}
+		}
+		return "", fmt.Errorf("unterminated quoted value: %s", value)
+	}
+
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = value[:i]
+	}
+
+	return strings.TrimSpace(value), nil
+}
@@ -0,0 +1,43 @@
+package crontab
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var parseEnvFileTestCases = []struct {
+	file     string
+	expected map[string]string
+}{
+	{"", map[string]string{}},
+	{"# comment\n\nFOO=bar\n", map[string]string{"FOO": "bar"}},
+	{"FOO = bar baz # comment\n", map[string]string{"FOO": "bar baz"}},
+	{"export FOO=bar\n", map[string]string{"FOO": "bar"}},
+	{"FOO=\n", map[string]string{"FOO": ""}},
+	{"FOO=a=b\n", map[string]string{"FOO": "a=b"}},
+	{"FOO='bar # $baz\\n'\n", map[string]string{"FOO": "bar # $baz\\n"}},
+	{"FOO=\"bar\\n\\\"baz\\\"\" # comment\n", map[string]string{"FOO": "bar\n\"baz\""}},
+	{"FOO=1\nFOO=2\n", map[string]string{"FOO": "2"}},
+
+	{"FOO\n", nil},
+	{"FOO BAR=baz\n", nil},
+	{"FOO='bar\n", nil},
+	{"FOO=\"bar\\\"\n", nil},
+}
+
+func TestParseEnvFile(t *testing.T) {
+	for _, tt := range parseEnvFileTestCases {
+		label := fmt.Sprintf("ParseEnvFile(%q)", tt.file)
+
+		env, err := ParseEnvFile(bytes.NewBufferString(tt.file))
+
+		if tt.expected == nil {
+			assert.NotNil(t, err, label)
+		} else if assert.Nil(t, err, label) {
+			assert.Equal(t, tt.expected, env, label)
+		}
+	}
+}
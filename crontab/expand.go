@@ -0,0 +1,36 @@
+package crontab
+
+import (
+	"os"
+	"regexp"
+)
+
+var variableMatcher = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// expandVariables replaces $VAR and ${VAR} in s with the value of VAR in
+// environ or, failing that, in the process environment. Variables that are
+// not set anywhere are left as they are, so that the shell can still expand
+// them when the job runs. $$ stands for a literal $.
+func expandVariables(s string, environ map[string]string) string {
+	return variableMatcher.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$$" {
+			return "$"
+		}
+
+		r := variableMatcher.FindStringSubmatch(match)
+		name := r[1]
+		if name == "" {
+			name = r[2]
+		}
+
+		if value, ok := environ[name]; ok {
+			return value
+		}
+
+		if value, ok := os.LookupEnv(name); ok {
+			return value
+		}
+
+		return match
+	})
+}
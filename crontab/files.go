@@ -0,0 +1,202 @@
+package crontab
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ExpandPath resolves the CRONTAB argument into a list of crontab files. The
+// argument may be a file, a directory (all the regular files it contains are
+// used, except hidden and backup files), or a glob.
+func ExpandPath(path string) ([]string, error) {
+	if strings.ContainsAny(path, "*?[") {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, err
+		}
+
+		files := make([]string, 0, len(matches))
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+
+			if info.Mode().IsRegular() && !isIgnoredFile(match) {
+				files = append(files, match)
+			}
+		}
+
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no crontab matches %s", path)
+		}
+
+		sort.Strings(files)
+		return files, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		file := filepath.Join(path, entry.Name())
+
+		if isIgnoredFile(file) {
+			continue
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+
+		if info.Mode().IsRegular() {
+			files = append(files, file)
+		}
+	}
+
+	return files, nil
+}
+
+func isIgnoredFile(path string) bool {
+	name := filepath.Base(path)
+	return strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~")
+}
+
+// ReadCrontab parses the crontab (or YAML jobs) file at path. Its jobs are
+// tagged with path as their source, or with the path of the file they were
+// included from.
+func ReadCrontab(path string, options ParseOptions) (*Crontab, error) {
+	var reader io.Reader
+	if options.Template {
+		rendered, err := RenderFile(path, options)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		reader = bytes.NewReader(rendered)
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	var err error
+	var tab *Crontab
+	if formatForPath(path, options) == FormatYAML {
+		tab, err = ParseYAMLJobs(reader, options)
+	} else {
+		tab, err = parseCrontab(reader, path, options)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	// Jobs from included files are already tagged with theirs.
+	for _, job := range tab.Jobs {
+		if job.Source == "" {
+			job.Source = path
+		}
+	}
+
+	tab.Jobs = options.Tags.apply(tab.Jobs)
+
+	return tab, nil
+}
+
+// includedFile is a file read by parseCrontab. Included files are opened
+// once they are read.
+type includedFile struct {
+	path string
+	// abs is path, made absolute to detect cycles. It is empty if the
+	// path isn't known.
+	abs string
+	// parent is the file that included this one, if any.
+	parent  *includedFile
+	file    *os.File
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (f *includedFile) open() error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+
+	f.file = file
+	f.scanner = bufio.NewScanner(file)
+	return nil
+}
+
+func (f *includedFile) close() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
+
+// resolveIncludes returns the files an #include line in parent refers to:
+// pattern may be a file, a directory, or a glob (see ExpandPath), relative to
+// parent. Including a file that is (directly or not) including parent is an
+// error.
+func resolveIncludes(pattern string, parent *includedFile) ([]*includedFile, error) {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(parent.path), pattern)
+	}
+
+	paths, err := ExpandPath(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	included := make([]*includedFile, 0, len(paths))
+
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for f := parent; f != nil; f = f.parent {
+			if f.abs != abs {
+				continue
+			}
+
+			chain := []string{path}
+			for f := parent; f != nil; f = f.parent {
+				chain = append([]string{f.path}, chain...)
+				if f.abs == abs {
+					break
+				}
+			}
+
+			return nil, fmt.Errorf("include cycle: %s", strings.Join(chain, " -> "))
+		}
+
+		included = append(included, &includedFile{path: path, abs: abs, parent: parent})
+	}
+
+	return included, nil
+}
@@ -0,0 +1,168 @@
+package crontab
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupCrontabDir(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "supercronic-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestExpandPath(t *testing.T) {
+	dir := setupCrontabDir(t, map[string]string{
+		"b":           "* * * * * b",
+		"a":           "* * * * * a",
+		"a.cron":      "* * * * * a.cron",
+		".hidden":     "* * * * * hidden",
+		"backup~":     "* * * * * backup",
+		"sub/nested":  "* * * * * nested",
+		"sub/x.cron":  "* * * * * x.cron",
+		"other/.keep": "",
+	})
+	defer os.RemoveAll(dir)
+
+	files, err := ExpandPath(filepath.Join(dir, "a"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{filepath.Join(dir, "a")}, files)
+	}
+
+	files, err = ExpandPath(dir)
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{
+			filepath.Join(dir, "a"),
+			filepath.Join(dir, "a.cron"),
+			filepath.Join(dir, "b"),
+		}, files)
+	}
+
+	files, err = ExpandPath(filepath.Join(dir, "*.cron"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{filepath.Join(dir, "a.cron")}, files)
+	}
+
+	files, err = ExpandPath(filepath.Join(dir, "*", "*.cron"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{filepath.Join(dir, "sub", "x.cron")}, files)
+	}
+
+	files, err = ExpandPath(filepath.Join(dir, "other"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{}, files)
+	}
+
+	_, err = ExpandPath(filepath.Join(dir, "*.nope"))
+	assert.NotNil(t, err)
+
+	_, err = ExpandPath(filepath.Join(dir, "nope"))
+	assert.NotNil(t, err)
+}
+
+func TestReadCrontab(t *testing.T) {
+	dir := setupCrontabDir(t, map[string]string{
+		"good": "FOO=bar\n* * * * * foo\n@daily bar",
+		"bad":  "oops",
+	})
+	defer os.RemoveAll(dir)
+
+	good := filepath.Join(dir, "good")
+
+	tab, err := ReadCrontab(good, ParseOptions{})
+	if assert.Nil(t, err) && assert.Equal(t, 2, len(tab.Jobs)) {
+		assert.Equal(t, "bar", tab.Context.Environ["FOO"])
+		assert.Equal(t, good, tab.Jobs[0].Source)
+		assert.Equal(t, good, tab.Jobs[1].Source)
+	}
+
+	_, err = ReadCrontab(filepath.Join(dir, "bad"), ParseOptions{})
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), filepath.Join(dir, "bad"))
+	}
+}
+
+func TestReadCrontabIncludes(t *testing.T) {
+	dir := setupCrontabDir(t, map[string]string{
+		"main":             "FOO=bar\n@hourly main-1\n#include fragments/*.cron\n\n@hourly main-2\n",
+		"fragments/a.cron": "# name: a\n@daily a\n#include ../shared\n",
+		"fragments/b.cron": "BAZ=qux\n@daily b\n",
+		"shared":           "\n@weekly shared\n",
+	})
+	defer os.RemoveAll(dir)
+
+	main := filepath.Join(dir, "main")
+
+	tab, err := ReadCrontab(main, ParseOptions{})
+	if !assert.Nil(t, err) || !assert.Equal(t, 5, len(tab.Jobs)) {
+		return
+	}
+
+	expected := []struct {
+		command string
+		source  string
+		line    int
+	}{
+		{"main-1", main, 2},
+		{"a", filepath.Join(dir, "fragments/a.cron"), 2},
+		{"shared", filepath.Join(dir, "fragments/../shared"), 2},
+		{"b", filepath.Join(dir, "fragments/b.cron"), 2},
+		{"main-2", main, 5},
+	}
+
+	for i, e := range expected {
+		job := tab.Jobs[i]
+		assert.Equal(t, e.command, job.Command)
+		assert.Equal(t, i, job.Position)
+		assert.Equal(t, filepath.Clean(e.source), job.Source)
+		assert.Equal(t, e.line, job.Line)
+	}
+
+	assert.Equal(t, "a", tab.Jobs[1].Name)
+	assert.Equal(t, map[string]string{"FOO": "bar", "BAZ": "qux"}, tab.Context.Environ)
+}
+
+func TestReadCrontabIncludeErrors(t *testing.T) {
+	dir := setupCrontabDir(t, map[string]string{
+		"self":      "#include self\n",
+		"a":         "#include b\n",
+		"b":         "@hourly b\n#include a\n",
+		"missing":   "#include nowhere/*\n",
+		"directive": "# timeout: 1m\n#include b\n@hourly foo\n",
+		"bad":       "#include fragment\n",
+		"fragment":  "\nnot a job\n",
+	})
+	defer os.RemoveAll(dir)
+
+	for name, message := range map[string]string{
+		"self":      "include cycle: " + filepath.Join(dir, "self") + " -> " + filepath.Join(dir, "self"),
+		"a":         "include cycle: " + filepath.Join(dir, "a") + " -> " + filepath.Join(dir, "b") + " -> " + filepath.Join(dir, "a"),
+		"missing":   "no crontab matches",
+		"directive": "directives must be followed by a job",
+		"bad":       filepath.Join(dir, "fragment") + ": line 2: bad crontab line",
+	} {
+		_, err := ReadCrontab(filepath.Join(dir, name), ParseOptions{})
+		if assert.NotNil(t, err, name) {
+			assert.Contains(t, err.Error(), message, name)
+		}
+	}
+}
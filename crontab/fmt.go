@@ -0,0 +1,124 @@
+package crontab
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// FormatFile formats the crontab at path with Format. YAML files (per
+// options.Format, like ReadCrontab) can't be formatted.
+func FormatFile(path string, options ParseOptions) ([]byte, error) {
+	if formatForPath(path, options) == FormatYAML {
+		return nil, fmt.Errorf("%s: YAML files can't be formatted", path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	formatted, err := Format(file, options)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return formatted, nil
+}
+
+// Format returns the crontab read from reader in a canonical layout, without
+// changing what it means:
+//
+//   - Indentation and runs of blank lines are removed.
+//   - Directives are written as "# key: value", and variables as KEY=value.
+//   - The fields of schedules are separated by a single space, and so are
+//     schedules and commands.
+//
+// Comments, includes, and commands are left alone. Lines that can't be
+// parsed are reported as errors.
+func Format(reader io.Reader, options ParseOptions) ([]byte, error) {
+	var buf bytes.Buffer
+
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	blank := false
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimLeft(scanner.Text(), " \t")
+
+		if line == "" {
+			// Blank lines are kept (once) between other lines only.
+			blank = buf.Len() > 0
+			continue
+		}
+
+		if blank {
+			buf.WriteByte('\n')
+			blank = false
+		}
+
+		formatted, err := formatLine(line, options)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+
+		buf.WriteString(formatted)
+		buf.WriteByte('\n')
+
+		// The contents of stdin blocks are copied verbatim.
+		if d, ok := parseDirectiveLine(line); ok {
+			if delimiter, ok := d.blockDelimiter(); ok {
+				lines, ok := readBlock(scanner, delimiter)
+				if err := scanner.Err(); err != nil {
+					return nil, err
+				}
+				if !ok {
+					return nil, fmt.Errorf("line %d: unterminated stdin block (expected %s)", lineNumber, delimiter)
+				}
+				lineNumber += len(lines) + 1
+
+				for _, l := range lines {
+					buf.WriteString(l)
+					buf.WriteByte('\n')
+				}
+				buf.WriteString(delimiter)
+				buf.WriteByte('\n')
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func formatLine(line string, options ParseOptions) (string, error) {
+	if line[0] == '#' {
+		if includeMatcher.MatchString(line) {
+			return line, nil
+		}
+		if d, ok := parseDirectiveLine(line); ok {
+			return fmt.Sprintf("# %s: %s", d.key, d.value), nil
+		}
+		return strings.TrimRight(line, " \t"), nil
+	}
+
+	// Values may end with meaningful spaces.
+	if r := envLineMatcher.FindStringSubmatch(line); r != nil {
+		return r[1] + "=" + r[2], nil
+	}
+
+	jobLine, err := parseJobLine(line, "", options)
+	if err != nil {
+		return "", err
+	}
+
+	schedule := line[:len(line)-len(jobLine.Command)]
+	return strings.Join(strings.Fields(schedule), " ") + " " + jobLine.Command, nil
+}
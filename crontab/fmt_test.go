@@ -0,0 +1,79 @@
+package crontab
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var formatTestCases = []struct {
+	crontab  string
+	options  ParseOptions
+	expected string
+}{
+	{"", ParseOptions{}, ""},
+	{"*/5  *   * * *\t\techo  hello  world\n", ParseOptions{}, "*/5 * * * * echo  hello  world\n"},
+	{"  @hourly   foo\n", ParseOptions{}, "@hourly foo\n"},
+	{"@every  5m   foo\n", ParseOptions{}, "@every 5m foo\n"},
+	{"*/5 * * * * *  foo\n", ParseOptions{Seconds: true}, "*/5 * * * * * foo\n"},
+	{"FOO =  bar baz \n", ParseOptions{}, "FOO=bar baz \n"},
+	{"\n\n# comment  \n\n\n  #name:backup\t\n0 0 * * * backup\n\n", ParseOptions{}, "# comment\n\n# name: backup\n0 0 * * * backup\n"},
+	{"# not: a directive\n#include   conf.d/*  \n", ParseOptions{}, "# not: a directive\n#include   conf.d/*  \n"},
+	{"  # stdin:  <<EOF\n  SELECT  1;\n\n\n  EOF  \n@hourly  psql\n", ParseOptions{}, "# stdin: <<EOF\n  SELECT  1;\n\n\nEOF\n@hourly psql\n"},
+
+	{"* * * foo\n", ParseOptions{}, ""},
+	{"*/5 * * * *\n", ParseOptions{}, ""},
+	{"# stdin: <<EOF\nSELECT 1;\n", ParseOptions{}, ""},
+}
+
+func TestFormat(t *testing.T) {
+	for _, tt := range formatTestCases {
+		label := fmt.Sprintf("Format(%q)", tt.crontab)
+
+		formatted, err := Format(bytes.NewBufferString(tt.crontab), tt.options)
+
+		if tt.expected == "" && tt.crontab != "" {
+			assert.NotNil(t, err, label)
+		} else if assert.Nil(t, err, label) {
+			assert.Equal(t, tt.expected, string(formatted), label)
+		}
+	}
+}
+
+func TestFormatIsStable(t *testing.T) {
+	for _, tt := range formatTestCases {
+		formatted, err := Format(bytes.NewBufferString(tt.crontab), tt.options)
+		if err != nil {
+			continue
+		}
+
+		again, err := Format(bytes.NewBuffer(formatted), tt.options)
+		if assert.Nil(t, err, tt.crontab) {
+			assert.Equal(t, string(formatted), string(again), tt.crontab)
+		}
+	}
+}
+
+func TestFormatFile(t *testing.T) {
+	dir := setupCrontabDir(t, map[string]string{
+		"crontab":   "* *  * * *   foo\n",
+		"bad":       "foo\nbar\n",
+		"jobs.yaml": "jobs: []\n",
+	})
+
+	formatted, err := FormatFile(filepath.Join(dir, "crontab"), ParseOptions{})
+	if assert.Nil(t, err) {
+		assert.Equal(t, "* * * * * foo\n", string(formatted))
+	}
+
+	_, err = FormatFile(filepath.Join(dir, "bad"), ParseOptions{})
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "bad: line 1: bad crontab line: foo")
+	}
+
+	_, err = FormatFile(filepath.Join(dir, "jobs.yaml"), ParseOptions{})
+	assert.NotNil(t, err)
+}
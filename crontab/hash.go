@@ -0,0 +1,121 @@
+package crontab
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// H fields (as in Jenkins) stand for a value picked by hashing the job's name,
+// or its command if it has no name. Jobs that use them are spread across the
+// field's range, but each job keeps the same schedule from one run of
+// supercronic to the next.
+//
+// H picks a value in the field's range, H(a-b) one in a-b, and H/n (or
+// H(a-b)/n) an offset for a step of n.
+
+var hashFieldMatcher = regexp.MustCompile(`^H(?:\((\d+)-(\d+)\))?(?:/(\d+))?$`)
+
+type hashFieldRange struct {
+	name string
+	min  int
+	max  int
+}
+
+var (
+	hashSeconds = hashFieldRange{"second", 0, 59}
+	hashMinutes = hashFieldRange{"minute", 0, 59}
+	hashHours   = hashFieldRange{"hour", 0, 23}
+	// Days of the month stop at 28, so that they exist in every month.
+	hashDaysOfMonth = hashFieldRange{"day of month", 1, 28}
+	hashMonths      = hashFieldRange{"month", 1, 12}
+	hashDaysOfWeek  = hashFieldRange{"day of week", 0, 6}
+)
+
+// hashFieldRanges returns the ranges of the fields of a schedule with count
+// fields. Years can't be hashed, so they have no range.
+func hashFieldRanges(count int, options ParseOptions) []hashFieldRange {
+	posix := []hashFieldRange{hashMinutes, hashHours, hashDaysOfMonth, hashMonths, hashDaysOfWeek}
+
+	if count == 7 || count == 6 && options.Seconds {
+		return append([]hashFieldRange{hashSeconds}, posix...)
+	}
+
+	if count == 6 || count == 5 {
+		return posix
+	}
+
+	return nil
+}
+
+func hasHashFields(schedule string) bool {
+	for _, field := range strings.Fields(schedule) {
+		if strings.HasPrefix(field, "H") {
+			return true
+		}
+	}
+	return false
+}
+
+// expandHashFields replaces the H fields of schedule with the values they
+// stand for, for the job identified by key.
+func expandHashFields(schedule string, key string, ranges []hashFieldRange) (string, error) {
+	fields := strings.Fields(schedule)
+
+	for i, field := range fields {
+		if !strings.HasPrefix(field, "H") {
+			continue
+		}
+
+		if i >= len(ranges) {
+			return "", fmt.Errorf("H is not supported in field %d", i+1)
+		}
+
+		expanded, err := expandHashField(field, key, ranges[i])
+		if err != nil {
+			return "", err
+		}
+		fields[i] = expanded
+	}
+
+	return strings.Join(fields, " "), nil
+}
+
+func expandHashField(field string, key string, r hashFieldRange) (string, error) {
+	m := hashFieldMatcher.FindStringSubmatch(field)
+	if m == nil {
+		return "", fmt.Errorf("bad %s: %s", r.name, field)
+	}
+
+	min, max := r.min, r.max
+	if m[1] != "" {
+		min, _ = strconv.Atoi(m[1])
+		max, _ = strconv.Atoi(m[2])
+
+		if min < r.min || max > r.max || min > max {
+			return "", fmt.Errorf("bad %s: %s: range must be within %d-%d", r.name, field, r.min, r.max)
+		}
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key + "\x00" + r.name))
+	sum := int(h.Sum32() & 0x7fffffff)
+
+	if m[3] == "" {
+		return strconv.Itoa(min + sum%(max-min+1)), nil
+	}
+
+	step, _ := strconv.Atoi(m[3])
+	if step == 0 {
+		return "", fmt.Errorf("bad %s: %s: step must be positive", r.name, field)
+	}
+
+	span := step
+	if max-min+1 < span {
+		span = max - min + 1
+	}
+
+	return fmt.Sprintf("%d-%d/%d", min+sum%span, max, step), nil
+}
@@ -0,0 +1,113 @@
+package crontab
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandHashField(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("job-%d", i)
+
+		value, err := expandHashField("H", key, hashMinutes)
+		if assert.Nil(t, err) {
+			minute, _ := strconv.Atoi(value)
+			assert.True(t, minute >= 0 && minute <= 59, value)
+		}
+
+		value, err = expandHashField("H(1-5)", key, hashDaysOfWeek)
+		if assert.Nil(t, err) {
+			day, _ := strconv.Atoi(value)
+			assert.True(t, day >= 1 && day <= 5, value)
+		}
+
+		value, err = expandHashField("H/15", key, hashMinutes)
+		if assert.Nil(t, err) {
+			var start, end, step int
+			fmt.Sscanf(value, "%d-%d/%d", &start, &end, &step)
+			assert.True(t, start >= 0 && start < 15, value)
+			assert.Equal(t, fmt.Sprintf("%d-59/15", start), value)
+		}
+	}
+}
+
+func TestExpandHashFieldIsStable(t *testing.T) {
+	first, _ := expandHashField("H", "backup", hashHours)
+	second, _ := expandHashField("H", "backup", hashHours)
+	assert.Equal(t, first, second)
+
+	values := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		value, _ := expandHashField("H", fmt.Sprintf("job-%d", i), hashMinutes)
+		values[value] = true
+	}
+	assert.True(t, len(values) > 1, "all jobs hashed to the same minute")
+}
+
+func TestExpandHashFieldErrors(t *testing.T) {
+	for _, field := range []string{"Hx", "H(5)", "H(0-60)", "H(10-5)", "H/0"} {
+		_, err := expandHashField(field, "backup", hashMinutes)
+		assert.NotNil(t, err, field)
+	}
+}
+
+func TestParseCrontabHashFields(t *testing.T) {
+	tab := strings.Join([]string{
+		"# name: backup",
+		"H H * * * /usr/local/bin/backup --full",
+		"# name: backup-again",
+		"H H * * * /usr/local/bin/backup --full",
+		"H(0-29)/10 H(2-5) * * 1-5 /usr/local/bin/report",
+	}, "\n")
+
+	crontab, err := ParseCrontab(bytes.NewBufferString(tab))
+	if !assert.Nil(t, err) || !assert.Equal(t, 3, len(crontab.Jobs)) {
+		return
+	}
+
+	minute, _ := expandHashField("H", "backup", hashMinutes)
+	hour, _ := expandHashField("H", "backup", hashHours)
+	assert.Equal(t, minute+" "+hour+" * * *", crontab.Jobs[0].Schedule)
+	assert.Equal(t, "/usr/local/bin/backup --full", crontab.Jobs[0].Command)
+
+	minute, _ = expandHashField("H(0-29)/10", "/usr/local/bin/report", hashMinutes)
+	hour, _ = expandHashField("H(2-5)", "/usr/local/bin/report", hashHours)
+	assert.Equal(t, minute+" "+hour+" * * 1-5", crontab.Jobs[2].Schedule)
+}
+
+func TestParseCrontabHashFieldsIgnoreCommandOfNamedJobs(t *testing.T) {
+	first, err := ParseCrontab(bytes.NewBufferString("# name: backup\nH H * * * backup.sh\n"))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	second, err := ParseCrontab(bytes.NewBufferString("# name: backup\nH H * * * backup.sh --verbose\n"))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Equal(t, first.Jobs[0].Schedule, second.Jobs[0].Schedule)
+}
+
+func TestParseCrontabHashFieldsWithSeconds(t *testing.T) {
+	crontab, err := ParseCrontabWithOptions(bytes.NewBufferString("H H * * * * foo\n"), ParseOptions{Seconds: true})
+	if !assert.Nil(t, err) || !assert.Equal(t, 1, len(crontab.Jobs)) {
+		return
+	}
+
+	second, _ := expandHashField("H", "foo", hashSeconds)
+	minute, _ := expandHashField("H", "foo", hashMinutes)
+	assert.Equal(t, second+" "+minute+" * * * *", crontab.Jobs[0].Schedule)
+}
+
+func TestParseCrontabHashFieldErrors(t *testing.T) {
+	_, err := ParseCrontab(bytes.NewBufferString("H(0-99) * * * * foo\n"))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "range must be within 0-59")
+	}
+}
@@ -0,0 +1,380 @@
+package crontab
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Severity is how likely a Diagnostic is to point at an actual mistake.
+type Severity int
+
+const (
+	// SeverityInfo is for constructs that are only worth a look.
+	SeverityInfo Severity = iota
+	// SeverityWarning is for constructs that may cause trouble, depending
+	// on where the crontab runs.
+	SeverityWarning
+	// SeverityError is for constructs that are most likely mistakes.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	}
+	return "error"
+}
+
+func ParseSeverity(value string) (Severity, error) {
+	for _, s := range []Severity{SeverityInfo, SeverityWarning, SeverityError} {
+		if s.String() == value {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown severity: %q (expected error, warning, or info)", value)
+}
+
+// Diagnostic is a problem found by Lint.
+type Diagnostic struct {
+	Severity Severity
+	Source   string
+	// Line is 0 if the problem isn't about a given line.
+	Line    int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	if d.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", d.Source, d.Line, d.Message)
+	}
+	return fmt.Sprintf("%s: %s", d.Source, d.Message)
+}
+
+// LintOptions controls which problems Lint looks for.
+type LintOptions struct {
+	// Exec is the global exec mode, which jobs may override.
+	Exec ExecMode
+	// Now is when schedules are checked from.
+	Now time.Time
+	// ExpandEnv is whether the crontabs were parsed with ExpandEnv, in
+	// which case their variables can't be checked for use anymore.
+	ExpandEnv bool
+	// MaxJobsPerMinute is how many jobs may start in the same minute
+	// before they're reported. It defaults to MAX_JOBS_PER_MINUTE.
+	MaxJobsPerMinute int
+}
+
+// MAX_JOBS_PER_MINUTE is how many jobs may start in the same minute, unless
+// LintOptions say otherwise. Jobs that run more often than hourly don't
+// count: they're presumably light.
+var MAX_JOBS_PER_MINUTE = 4
+
+// shellVariables are set by the shell itself, so commands may use them
+// without defining them.
+var shellVariables = map[string]bool{
+	"HOME": true, "HOSTNAME": true, "IFS": true, "LINENO": true,
+	"OLDPWD": true, "OPTARG": true, "OPTIND": true, "PPID": true,
+	"PWD": true, "RANDOM": true, "SECONDS": true, "UID": true, "EUID": true,
+}
+
+// Lint looks for constructs that parse fine, but that are most likely
+// mistakes (errors):
+//
+//   - commands that reference variables that are not defined anywhere
+//   - jobs that have the same schedule and command as another
+//   - schedules that never fire (e.g. on February 30)
+//   - shells (or, for jobs run without a shell, commands) that cannot be
+//     executed
+//
+// or that may cause trouble (warnings), or are worth a look (infos):
+//
+//   - commands that reference files (by absolute path) that don't exist
+//   - more than MaxJobsPerMinute jobs that start in the same minute
+//   - variables that are defined, but that nothing references
+func Lint(tabs []*Crontab, options LintOptions) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0)
+	seen := make(map[string]*Job)
+
+	for _, tab := range tabs {
+		checkedShell := false
+
+		for _, job := range tab.Jobs {
+			report := func(severity Severity, format string, args ...interface{}) {
+				diagnostics = append(diagnostics, Diagnostic{
+					Severity: severity,
+					Source:   job.Source,
+					Line:     job.Line,
+					Message:  fmt.Sprintf(format, args...),
+				})
+			}
+
+			mode := options.Exec
+			if job.Exec != "" {
+				mode = job.Exec
+			}
+
+			// Commands that can't be executed are reported once.
+			var executable string
+
+			if mode == ExecDirect {
+				if words, err := SplitCommand(job.Command); err != nil {
+					report(SeverityError, "%v", err)
+				} else if _, err := exec.LookPath(words[0]); err != nil {
+					executable = words[0]
+					report(SeverityError, "command cannot be executed: %v", err)
+				}
+			} else {
+				if !checkedShell {
+					// The shell is reported once per crontab, at the
+					// first job that needs it.
+					checkedShell = true
+					if _, err := exec.LookPath(tab.Context.Shell); err != nil {
+						report(SeverityError, "shell cannot be executed: %v", err)
+					}
+				}
+
+				for _, name := range undefinedVariables(tab.Context, job) {
+					report(SeverityError, "command references undefined variable: %s", name)
+				}
+			}
+
+			for _, path := range missingFiles(job.Command) {
+				if path != executable {
+					report(SeverityWarning, "command references missing file: %s", path)
+				}
+			}
+
+			if previous, ok := seen[job.Key()]; ok {
+				report(SeverityError, "job has the same schedule and command as the one at %s", jobLocation(previous))
+			} else {
+				seen[job.Key()] = job
+			}
+
+			if job.Expression.Next(options.Now).IsZero() && !IsDaemon(job.Expression) {
+				report(SeverityError, "schedule never fires: %s", job.Schedule)
+			}
+		}
+
+		if !options.ExpandEnv && len(tab.Jobs) > 0 {
+			for _, name := range unusedVariables(tab) {
+				diagnostics = append(diagnostics, Diagnostic{
+					Severity: SeverityInfo,
+					Source:   tab.Jobs[0].Source,
+					Message:  fmt.Sprintf("variable is never used: %s", name),
+				})
+			}
+		}
+	}
+
+	return append(diagnostics, scheduleCollisions(tabs, options)...)
+}
+
+// fileMatcher matches absolute paths in commands, except in variables and
+// globs (the path ends where they start).
+var fileMatcher = regexp.MustCompile(`(^|[\s;&|(='"])(/[^\s;&|<>()'"$*?\[\]{}:]+)`)
+
+// missingFiles returns the files command references (by absolute path)
+// that don't exist. Files that output is redirected to are not reported, as
+// the command creates them.
+func missingFiles(command string) []string {
+	missing := make([]string, 0)
+	reported := make(map[string]bool)
+
+	for _, m := range fileMatcher.FindAllStringSubmatchIndex(command, -1) {
+		path := command[m[4]:m[5]]
+
+		if strings.HasSuffix(strings.TrimRight(command[:m[2]], " \t"), ">") || reported[path] {
+			continue
+		}
+
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			reported[path] = true
+			missing = append(missing, path)
+		}
+	}
+
+	return missing
+}
+
+// scheduleCollisions reports the sets of more than MaxJobsPerMinute jobs
+// that start in the same minute, within a day of options.Now.
+func scheduleCollisions(tabs []*Crontab, options LintOptions) []Diagnostic {
+	max := options.MaxJobsPerMinute
+	if max <= 0 {
+		max = MAX_JOBS_PER_MINUTE
+	}
+
+	end := options.Now.Add(24 * time.Hour)
+	starts := make(map[int64][]*Job)
+
+	for _, tab := range tabs {
+		for _, job := range tab.Jobs {
+			runs := make([]time.Time, 0)
+			for t := job.Expression.Next(options.Now); !t.IsZero() && t.Before(end) && len(runs) <= 24; t = job.Expression.Next(t) {
+				runs = append(runs, t)
+			}
+
+			if len(runs) > 24 {
+				continue
+			}
+
+			for _, t := range runs {
+				minute := t.Unix() / 60
+				starts[minute] = append(starts[minute], job)
+			}
+		}
+	}
+
+	minutes := make([]int64, 0, len(starts))
+	for minute := range starts {
+		minutes = append(minutes, minute)
+	}
+	sort.Slice(minutes, func(i, j int) bool { return minutes[i] < minutes[j] })
+
+	diagnostics := make([]Diagnostic, 0)
+	reported := make(map[string]bool)
+
+	for _, minute := range minutes {
+		jobs := starts[minute]
+		if len(jobs) <= max {
+			continue
+		}
+
+		others := make([]string, 0, len(jobs)-1)
+		for _, job := range jobs[1:] {
+			others = append(others, jobLocation(job))
+		}
+
+		// The same jobs usually collide every day (or hour).
+		key := jobLocation(jobs[0]) + " " + strings.Join(others, " ")
+		if reported[key] {
+			continue
+		}
+		reported[key] = true
+
+		at := time.Unix(minute*60, 0).In(options.Now.Location())
+		diagnostics = append(diagnostics, Diagnostic{
+			Severity: SeverityWarning,
+			Source:   jobs[0].Source,
+			Line:     jobs[0].Line,
+			Message:  fmt.Sprintf("%d jobs start at %s: this one, and the ones at %s", len(jobs), at.Format("15:04"), strings.Join(others, ", ")),
+		})
+	}
+
+	return diagnostics
+}
+
+// consumedVariables are used by supercronic, or by most programs, so
+// crontabs may define them without referencing them.
+var consumedVariables = map[string]bool{
+	"SHELL": true, "PATH": true, "HOME": true, "USER": true, "LOGNAME": true,
+	"MAILTO": true, "CRON_TZ": true, "TZ": true, "RANDOM_DELAY": true,
+	"LANG": true, "LANGUAGE": true, "TERM": true,
+}
+
+// unusedVariables returns the variables tab defines that none of its
+// commands and variables reference.
+func unusedVariables(tab *Crontab) []string {
+	var texts []string
+	for _, value := range tab.Context.Environ {
+		texts = append(texts, value)
+	}
+	for _, job := range tab.Jobs {
+		texts = append(texts, job.Command)
+		for _, value := range job.Env {
+			texts = append(texts, value)
+		}
+	}
+
+	referenced := make(map[string]bool)
+	for _, r := range variableMatcher.FindAllStringSubmatch(strings.Join(texts, "\n"), -1) {
+		referenced[r[1]] = true
+		referenced[r[2]] = true
+	}
+
+	unused := make([]string, 0)
+	for name := range tab.Context.Environ {
+		if !referenced[name] && !consumedVariables[name] && !strings.HasPrefix(name, "LC_") {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+
+	return unused
+}
+
+// undefinedVariables returns the variables job's command references that
+// are not defined in its environment, the process environment, or the
+// command itself.
+func undefinedVariables(context *Context, job *Job) []string {
+	defined := make(map[string]bool)
+
+	for _, path := range job.EnvFiles {
+		fileEnv, err := ReadEnvFile(path)
+		if err != nil {
+			// The variables could be anything, so don't guess.
+			return nil
+		}
+
+		for key := range fileEnv {
+			defined[key] = true
+		}
+	}
+
+	undefined := make([]string, 0)
+	reported := make(map[string]bool)
+
+	for _, r := range variableMatcher.FindAllStringSubmatch(job.Command, -1) {
+		name := r[1]
+		if name == "" {
+			name = r[2]
+		}
+
+		if name == "" || reported[name] || defined[name] || shellVariables[name] {
+			continue
+		}
+
+		if _, ok := context.Environ[name]; ok {
+			continue
+		}
+
+		if _, ok := job.Env[name]; ok {
+			continue
+		}
+
+		if _, ok := os.LookupEnv(name); ok {
+			continue
+		}
+
+		if isAssignedIn(job.Command, name) {
+			continue
+		}
+
+		reported[name] = true
+		undefined = append(undefined, name)
+	}
+
+	return undefined
+}
+
+// isAssignedIn is whether command (probably) sets the variable name itself,
+// e.g. with NAME=value or for NAME in.
+func isAssignedIn(command string, name string) bool {
+	assignment := regexp.MustCompile(`(^|[^A-Za-z0-9_$])` + name + `=|\b(for|read|export|local)\s+(-\w+\s+)*` + name + `\b`)
+	return assignment.MatchString(command)
+}
+
+func jobLocation(job *Job) string {
+	if job.Line > 0 {
+		return fmt.Sprintf("%s:%d", job.Source, job.Line)
+	}
+	return fmt.Sprintf("%s (job #%d)", job.Source, job.Position+1)
+}
@@ -0,0 +1,166 @@
+package crontab
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func lintCrontab(t *testing.T, content string, options LintOptions) []string {
+	tab, err := ParseCrontab(bytes.NewBufferString(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, job := range tab.Jobs {
+		job.Source = "crontab"
+	}
+
+	if options.Now.IsZero() {
+		options.Now = time.Now()
+	}
+
+	messages := make([]string, 0)
+	for _, d := range Lint([]*Crontab{tab}, options) {
+		messages = append(messages, d.String())
+	}
+	return messages
+}
+
+func TestLintAcceptsCleanCrontab(t *testing.T) {
+	content := strings.Join([]string{
+		"GREETING=hello",
+		"* * * * * echo $GREETING ${PWD}",
+		"*/5 * * * * for f in *; do echo $f; done",
+		"0 * * * * N=1; echo $N $$",
+		"",
+	}, "\n")
+
+	assert.Equal(t, []string{}, lintCrontab(t, content, LintOptions{}))
+}
+
+func TestLintReportsUndefinedVariables(t *testing.T) {
+	content := "# a comment\n* * * * * echo $SUPERCRONIC_TEST_UNDEFINED ${SUPERCRONIC_TEST_UNDEFINED}\n"
+
+	assert.Equal(t, []string{
+		"crontab:2: command references undefined variable: SUPERCRONIC_TEST_UNDEFINED",
+	}, lintCrontab(t, content, LintOptions{}))
+}
+
+func TestLintReportsDuplicateJobs(t *testing.T) {
+	content := "@hourly foo\n@daily foo\n\n@hourly foo\n"
+
+	assert.Equal(t, []string{
+		"crontab:4: job has the same schedule and command as the one at crontab:1",
+	}, lintCrontab(t, content, LintOptions{}))
+}
+
+func TestLintReportsSchedulesThatNeverFire(t *testing.T) {
+	assert.Equal(t, []string{
+		"crontab:1: schedule never fires: 0 0 30 2 *",
+	}, lintCrontab(t, "0 0 30 2 * foo\n", LintOptions{}))
+}
+
+func TestLintAcceptsDaemons(t *testing.T) {
+	assert.Equal(t, []string{}, lintCrontab(t, "@always foo\n", LintOptions{}))
+}
+
+func TestLintReportsMissingShell(t *testing.T) {
+	content := "SHELL=/nonexistent/sh\n* * * * * foo\n* * * * * bar\n"
+
+	messages := lintCrontab(t, content, LintOptions{})
+	if assert.Equal(t, 1, len(messages)) {
+		assert.Contains(t, messages[0], "crontab:2: shell cannot be executed")
+	}
+}
+
+func TestLintReportsMissingCommands(t *testing.T) {
+	content := "* * * * * /nonexistent/command arg\n* * * * * echo $FOO\n"
+
+	messages := lintCrontab(t, content, LintOptions{Exec: ExecDirect})
+	if assert.Equal(t, 2, len(messages)) {
+		assert.Contains(t, messages[0], "crontab:1: command cannot be executed")
+		assert.Contains(t, messages[1], "crontab:2: ")
+	}
+}
+
+func TestParseCrontabReportsLineNumbers(t *testing.T) {
+	tab, err := ParseCrontab(bytes.NewBufferString("FOO=bar\n\n* * * * * foo\n# name: bar\n@hourly bar\n"))
+	if assert.Nil(t, err) && assert.Equal(t, 2, len(tab.Jobs)) {
+		assert.Equal(t, 3, tab.Jobs[0].Line)
+		assert.Equal(t, 5, tab.Jobs[1].Line)
+	}
+
+	_, err = ParseCrontab(bytes.NewBufferString("* * * * * foo\n\nnot a job\n"))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "line 3: ")
+	}
+
+	_, err = ParseCrontab(bytes.NewBufferString("# timeout: never\n* * * * * foo\n"))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "line 1: ")
+	}
+}
+
+func TestLintReportsMissingFiles(t *testing.T) {
+	content := "* * * * * /bin/sh /nonexistent/script.sh --config=/nonexistent/config > /nonexistent/log 2>/nonexistent/err\n"
+
+	assert.Equal(t, []string{
+		"crontab:1: command references missing file: /nonexistent/script.sh",
+		"crontab:1: command references missing file: /nonexistent/config",
+	}, lintCrontab(t, content, LintOptions{}))
+}
+
+func TestLintReportsScheduleCollisions(t *testing.T) {
+	content := strings.Join([]string{
+		"0 3 * * * a",
+		"0 3 * * * b",
+		"0 3,4 * * * c",
+		"0 */2 * * * d",
+		"* * * * * e",
+		"",
+	}, "\n")
+
+	now := time.Date(2018, 1, 1, 0, 30, 0, 0, time.UTC)
+
+	assert.Equal(t, []string{}, lintCrontab(t, content, LintOptions{Now: now}))
+
+	assert.Equal(t, []string{
+		"crontab:1: 3 jobs start at 03:00: this one, and the ones at crontab:2, crontab:3",
+	}, lintCrontab(t, content, LintOptions{Now: now, MaxJobsPerMinute: 2}))
+}
+
+func TestLintReportsUnusedVariables(t *testing.T) {
+	content := "PATH=/bin\nUSED=1\nALSO_USED=$USED\nUNUSED=1\n* * * * * echo $ALSO_USED\n"
+
+	assert.Equal(t, []string{
+		"crontab: variable is never used: UNUSED",
+	}, lintCrontab(t, content, LintOptions{}))
+
+	assert.Equal(t, []string{}, lintCrontab(t, content, LintOptions{ExpandEnv: true}))
+}
+
+func TestLintSeverities(t *testing.T) {
+	tab, err := ParseCrontab(bytes.NewBufferString("FOO=1\n0 0 30 2 * /nonexistent/command\n"))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	severities := make([]Severity, 0)
+	for _, d := range Lint([]*Crontab{tab}, LintOptions{Now: time.Now()}) {
+		severities = append(severities, d.Severity)
+	}
+	assert.Equal(t, []Severity{SeverityWarning, SeverityError, SeverityInfo}, severities)
+
+	for _, s := range severities {
+		parsed, err := ParseSeverity(s.String())
+		assert.Nil(t, err)
+		assert.Equal(t, s, parsed)
+	}
+
+	_, err = ParseSeverity("fatal")
+	assert.NotNil(t, err)
+}
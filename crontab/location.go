@@ -0,0 +1,167 @@
+package crontab
+
+import (
+	"sort"
+	"time"
+)
+
+// locationExpression evaluates an expression in a given timezone, regardless
+// of the timezone of the times it is given (unless location is nil).
+//
+// The expression is evaluated against wall clock times, so that daylight
+// saving time transitions are handled per the DST policies rather than by
+// the expression: runs scheduled at times that are skipped or repeated when
+// clocks change are run, skipped, or run twice as requested.
+type locationExpression struct {
+	expression Expression
+	location   *time.Location
+	skipped    DSTSkippedPolicy
+	repeated   DSTRepeatedPolicy
+}
+
+func newLocationExpression(expression Expression, location *time.Location, options ParseOptions) *locationExpression {
+	return &locationExpression{
+		expression: expression,
+		location:   location,
+		skipped:    options.DSTSkipped,
+		repeated:   options.DSTRepeated,
+	}
+}
+
+func (e *locationExpression) Next(fromTime time.Time) time.Time {
+	location := e.location
+	if location == nil {
+		location = fromTime.Location()
+	}
+
+	from := fromTime.In(location)
+	next := e.next(from, location)
+
+	// Runs in the second pass through the times clocks show twice are due
+	// before the ones that follow from's wall clock time, if from is in the
+	// first pass.
+	if e.repeated == DSTRepeatedTwice {
+		if repeat := e.nextRepeat(from, location); !repeat.IsZero() && (next.IsZero() || repeat.Before(next)) {
+			return repeat
+		}
+	}
+
+	return next
+}
+
+func (e *locationExpression) next(from time.Time, location *time.Location) time.Time {
+	wall := wallClock(from)
+
+	for {
+		wall = e.expression.Next(wall)
+		if wall.IsZero() {
+			return wall
+		}
+
+		instants := wallClockInstants(wall, location)
+
+		switch len(instants) {
+		case 0:
+			// Clocks jumped past wall: run once they have, unless the run
+			// is to be skipped.
+			if e.skipped != DSTSkippedSkip {
+				if t := transitionAround(wall, location); t.After(from) {
+					return t
+				}
+			}
+		case 1:
+			if instants[0].After(from) {
+				return instants[0]
+			}
+		default:
+			if instants[0].After(from) {
+				return instants[0]
+			}
+
+			if e.repeated == DSTRepeatedTwice && instants[1].After(from) {
+				return instants[1]
+			}
+		}
+	}
+}
+
+// nextRepeat returns the first run in the second pass through the times
+// clocks show twice, if from is in the first pass, or zero otherwise.
+func (e *locationExpression) nextRepeat(from time.Time, location *time.Location) time.Time {
+	instants := wallClockInstants(wallClock(from), location)
+	if len(instants) != 2 || !from.Equal(instants[0]) {
+		return time.Time{}
+	}
+
+	// The second pass starts when clocks are set back.
+	wall := wallClock(transitionAround(wallClock(from), location)).Add(-time.Nanosecond)
+
+	for {
+		wall = e.expression.Next(wall)
+		if wall.IsZero() {
+			return wall
+		}
+
+		instants := wallClockInstants(wall, location)
+		if len(instants) != 2 {
+			return time.Time{}
+		}
+
+		if instants[1].After(from) {
+			return instants[1]
+		}
+	}
+}
+
+// wallClock returns the time clocks show at t, as a UTC time, which has no
+// daylight saving time.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// wallClockInstants returns the times at which clocks in location show wall
+// (as returned by wallClock), in order: none if clocks skip it, and two if
+// clocks show it twice, e.g. when daylight saving time ends.
+func wallClockInstants(wall time.Time, location *time.Location) []time.Time {
+	// Offsets are at most 14 hours: the offsets in effect a day before and
+	// after wall are the ones that may apply to it.
+	offsets := []int{offsetAt(wall.Add(-24*time.Hour), location), offsetAt(wall.Add(24*time.Hour), location)}
+	if offsets[0] == offsets[1] {
+		offsets = offsets[:1]
+	}
+
+	instants := make([]time.Time, 0, len(offsets))
+	for _, offset := range offsets {
+		t := wall.Add(-time.Duration(offset) * time.Second).In(location)
+		if wallClock(t).Equal(wall) {
+			instants = append(instants, t)
+		}
+	}
+
+	sort.Slice(instants, func(i, j int) bool { return instants[i].Before(instants[j]) })
+	return instants
+}
+
+func offsetAt(t time.Time, location *time.Location) int {
+	_, offset := t.In(location).Zone()
+	return offset
+}
+
+// transitionAround returns when clocks in location changed in the days
+// around wall.
+func transitionAround(wall time.Time, location *time.Location) time.Time {
+	lo := wall.Add(-24 * time.Hour).Unix()
+	hi := wall.Add(24 * time.Hour).Unix()
+	offset := offsetAt(time.Unix(lo, 0), location)
+
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		if offsetAt(time.Unix(mid, 0), location) == offset {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return time.Unix(hi, 0).In(location)
+}
@@ -0,0 +1,106 @@
+package crontab
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var dstTestCases = []struct {
+	schedule string
+	options  ParseOptions
+	from     time.Time
+	expected []time.Time
+}{
+	// Clocks jump from 2:00 to 3:00 on March 25 2018 in Paris.
+	{
+		"30 2 * * *",
+		ParseOptions{},
+		time.Date(2018, 3, 24, 23, 0, 0, 0, time.UTC),
+		[]time.Time{time.Date(2018, 3, 25, 1, 0, 0, 0, time.UTC), time.Date(2018, 3, 26, 0, 30, 0, 0, time.UTC)},
+	},
+	{
+		"30 2 * * *",
+		ParseOptions{DSTSkipped: DSTSkippedSkip},
+		time.Date(2018, 3, 24, 23, 0, 0, 0, time.UTC),
+		[]time.Time{time.Date(2018, 3, 26, 0, 30, 0, 0, time.UTC)},
+	},
+	{
+		"*/30 * * * *",
+		ParseOptions{},
+		time.Date(2018, 3, 25, 0, 45, 0, 0, time.UTC),
+		[]time.Time{time.Date(2018, 3, 25, 1, 0, 0, 0, time.UTC), time.Date(2018, 3, 25, 1, 30, 0, 0, time.UTC)},
+	},
+	// Clocks go back from 3:00 to 2:00 on October 28 2018 in Paris.
+	{
+		"30 2 * * *",
+		ParseOptions{},
+		time.Date(2018, 10, 27, 22, 0, 0, 0, time.UTC),
+		[]time.Time{time.Date(2018, 10, 28, 0, 30, 0, 0, time.UTC), time.Date(2018, 10, 29, 1, 30, 0, 0, time.UTC)},
+	},
+	{
+		"30 2 * * *",
+		ParseOptions{DSTRepeated: DSTRepeatedTwice},
+		time.Date(2018, 10, 27, 22, 0, 0, 0, time.UTC),
+		[]time.Time{time.Date(2018, 10, 28, 0, 30, 0, 0, time.UTC), time.Date(2018, 10, 28, 1, 30, 0, 0, time.UTC)},
+	},
+	{
+		"0,30 2 * * *",
+		ParseOptions{DSTRepeated: DSTRepeatedTwice},
+		time.Date(2018, 10, 27, 22, 0, 0, 0, time.UTC),
+		[]time.Time{
+			time.Date(2018, 10, 28, 0, 0, 0, 0, time.UTC),
+			time.Date(2018, 10, 28, 0, 30, 0, 0, time.UTC),
+			time.Date(2018, 10, 28, 1, 0, 0, 0, time.UTC),
+			time.Date(2018, 10, 28, 1, 30, 0, 0, time.UTC),
+			time.Date(2018, 10, 29, 1, 0, 0, 0, time.UTC),
+		},
+	},
+	{
+		"0 * * * *",
+		ParseOptions{},
+		time.Date(2018, 10, 27, 23, 30, 0, 0, time.UTC),
+		[]time.Time{time.Date(2018, 10, 28, 0, 0, 0, 0, time.UTC), time.Date(2018, 10, 28, 2, 0, 0, 0, time.UTC)},
+	},
+}
+
+func TestLocationExpressionDST(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	for _, tt := range dstTestCases {
+		options := tt.options
+		options.Location = paris
+
+		tab, err := ParseCrontabWithOptions(bytes.NewBufferString(tt.schedule+" foo\n"), options)
+		if !assert.Nil(t, err, tt.schedule) {
+			continue
+		}
+
+		next := tt.from
+		for _, expected := range tt.expected {
+			next = tab.Jobs[0].Expression.Next(next)
+			assert.True(t, expected.Equal(next), "%s (%+v): expected %v, got %v", tt.schedule, tt.options, expected, next.UTC())
+		}
+	}
+}
+
+func TestLocationExpressionWithoutDST(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	tab, err := ParseCrontabWithOptions(bytes.NewBufferString("0 9 * * * foo\n"), ParseOptions{Location: tokyo})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	next := tab.Jobs[0].Expression.Next(time.Date(2018, 1, 1, 0, 30, 0, 0, time.UTC))
+	assert.True(t, time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC).Equal(next), "%v", next)
+	assert.Equal(t, tokyo, next.Location())
+}
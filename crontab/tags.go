@@ -0,0 +1,88 @@
+package crontab
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TagFilter selects jobs by their tags (per their tags directive), so that
+// the same crontab can run a different subset of its jobs in each
+// environment.
+type TagFilter struct {
+	// Only, if not empty, selects the jobs that have at least one of these
+	// tags. Jobs without tags are left out.
+	Only []string
+	// Skip leaves out the jobs that have any of these tags.
+	Skip []string
+}
+
+// ParseTags parses a comma (or space) separated list of tags, e.g.
+// "nightly, eu-only". Tags are named like jobs.
+func ParseTags(value string) ([]string, error) {
+	tags := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+
+	for _, tag := range tags {
+		if !jobNameMatcher.MatchString(tag) {
+			return nil, fmt.Errorf("not a valid tag (letters, digits, _, . or -): %s", tag)
+		}
+	}
+
+	return tags, nil
+}
+
+// IsEmpty reports whether f selects all jobs.
+func (f TagFilter) IsEmpty() bool {
+	return len(f.Only) == 0 && len(f.Skip) == 0
+}
+
+// Matches reports whether f selects job.
+func (f TagFilter) Matches(job *Job) bool {
+	if len(f.Only) > 0 && !hasAnyTag(job, f.Only) {
+		return false
+	}
+	return !hasAnyTag(job, f.Skip)
+}
+
+func hasAnyTag(job *Job, tags []string) bool {
+	for _, tag := range tags {
+		for _, t := range job.Tags {
+			if t == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// apply returns the jobs f selects. Jobs that run after a job that was left
+// out are kept, but can't run, so they're reported.
+func (f TagFilter) apply(jobs []*Job) []*Job {
+	if f.IsEmpty() {
+		return jobs
+	}
+
+	selected := make([]*Job, 0, len(jobs))
+	excluded := make(map[string]bool)
+
+	for _, job := range jobs {
+		if f.Matches(job) {
+			selected = append(selected, job)
+		} else if job.Name != "" {
+			excluded[job.Name] = true
+		}
+	}
+
+	for _, job := range selected {
+		for _, name := range job.After {
+			if excluded[name] {
+				logrus.Warnf("job at %s runs after %s, which is left out per its tags: its runs will be skipped", jobLocation(job), name)
+			}
+		}
+	}
+
+	return selected
+}
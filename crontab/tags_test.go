@@ -0,0 +1,74 @@
+package crontab
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTags(t *testing.T) {
+	tags, err := ParseTags("nightly, eu-only\tbatch")
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{"nightly", "eu-only", "batch"}, tags)
+	}
+
+	tags, err = ParseTags("")
+	if assert.Nil(t, err) {
+		assert.Equal(t, 0, len(tags))
+	}
+
+	_, err = ParseTags("nightly,-bad")
+	assert.NotNil(t, err)
+}
+
+func TestTagFilter(t *testing.T) {
+	untagged := &Job{}
+	nightly := &Job{Tags: []string{"nightly"}}
+	nightlyEU := &Job{Tags: []string{"nightly", "eu-only"}}
+
+	for _, tt := range []struct {
+		filter   TagFilter
+		expected []bool
+	}{
+		{TagFilter{}, []bool{true, true, true}},
+		{TagFilter{Only: []string{"nightly"}}, []bool{false, true, true}},
+		{TagFilter{Only: []string{"eu-only", "other"}}, []bool{false, false, true}},
+		{TagFilter{Skip: []string{"eu-only"}}, []bool{true, true, false}},
+		{TagFilter{Only: []string{"nightly"}, Skip: []string{"eu-only"}}, []bool{false, true, false}},
+	} {
+		matches := []bool{tt.filter.Matches(untagged), tt.filter.Matches(nightly), tt.filter.Matches(nightlyEU)}
+		assert.Equal(t, tt.expected, matches, "%+v", tt.filter)
+	}
+}
+
+func TestReadCrontabFiltersByTags(t *testing.T) {
+	dir := setupCrontabDir(t, map[string]string{
+		"crontab":   "# tags: nightly\n0 0 * * * nightly\n# tags: eu-only, nightly\n0 1 * * * eu\n* * * * * untagged\n",
+		"jobs.yaml": "jobs:\n  - schedule: '@daily'\n    command: nightly\n    tags: [nightly]\n  - schedule: '@daily'\n    command: untagged\n",
+	})
+
+	commands := func(tab *Crontab) []string {
+		c := make([]string, 0)
+		for _, job := range tab.Jobs {
+			c = append(c, job.Command)
+		}
+		return c
+	}
+
+	tab, err := ReadCrontab(filepath.Join(dir, "crontab"), ParseOptions{})
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{"nightly", "eu", "untagged"}, commands(tab))
+		assert.Equal(t, []string{"eu-only", "nightly"}, tab.Jobs[1].Tags)
+	}
+
+	tab, err = ReadCrontab(filepath.Join(dir, "crontab"), ParseOptions{Tags: TagFilter{Only: []string{"nightly"}, Skip: []string{"eu-only"}}})
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{"nightly"}, commands(tab))
+	}
+
+	tab, err = ReadCrontab(filepath.Join(dir, "jobs.yaml"), ParseOptions{Tags: TagFilter{Skip: []string{"nightly"}}})
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{"untagged"}, commands(tab))
+	}
+}
@@ -0,0 +1,102 @@
+package crontab
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+)
+
+// templateData is what crontab templates are executed with: .Env holds the
+// environment supercronic runs in, and .Values the values file, if any.
+type templateData struct {
+	Env    map[string]string
+	Values map[interface{}]interface{}
+}
+
+var templateFuncs = template.FuncMap{
+	// env returns the variable name, or an empty string if it isn't set
+	// (unlike .Env.NAME, which fails).
+	"env": os.Getenv,
+	// default returns value, or def if value is empty.
+	"default": func(def interface{}, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return def
+		}
+		return value
+	},
+	"lower":    strings.ToLower,
+	"upper":    strings.ToUpper,
+	"trim":     strings.TrimSpace,
+	"split":    strings.Split,
+	"join":     join,
+	"contains": strings.Contains,
+}
+
+// join joins the elements of values (a list, e.g. from the values file) with
+// sep.
+func join(sep string, values interface{}) (string, error) {
+	v := reflect.ValueOf(values)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", fmt.Errorf("join expects a list, not %T", values)
+	}
+
+	elements := make([]string, v.Len())
+	for i := range elements {
+		elements[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+
+	return strings.Join(elements, sep), nil
+}
+
+// RenderFile executes the crontab at path as a text/template (with
+// templateData), and returns the result. Values are read from the YAML file
+// at options.Values, if set.
+func RenderFile(path string, options ParseOptions) ([]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data := templateData{
+		Env:    make(map[string]string),
+		Values: make(map[interface{}]interface{}),
+	}
+
+	for _, kv := range os.Environ() {
+		if i := strings.Index(kv, "="); i > 0 {
+			data.Env[kv[:i]] = kv[i+1:]
+		}
+	}
+
+	if options.Values != "" {
+		values, err := ioutil.ReadFile(options.Values)
+		if err != nil {
+			return nil, fmt.Errorf("could not read values: %v", err)
+		}
+
+		if err := yaml.Unmarshal(values, &data.Values); err != nil {
+			return nil, fmt.Errorf("bad values in %s: %v", options.Values, err)
+		}
+	}
+
+	// Typos in names of variables and values fail, rather than silently
+	// render as nothing.
+	tmpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("bad template: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("could not render template: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,57 @@
+package crontab
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderFile(t *testing.T) {
+	dir := setupCrontabDir(t, map[string]string{
+		"crontab": `{{if eq .Env.SUPERCRONIC_TEST_ENV "prod"}}0 {{.Values.hour}} * * * backup {{join "," .Values.dbs}}
+{{end}}*/{{default 5 (env "SUPERCRONIC_TEST_UNDEFINED")}} * * * * {{upper "poll"}}
+`,
+		"values.yaml": "hour: 3\ndbs: [a, b]\n",
+		"typo":        "{{.Env.SUPERCRONIC_TEST_UNDEFINED}}\n",
+		"bad":         "{{if}}\n",
+	})
+
+	defer os.Setenv("SUPERCRONIC_TEST_ENV", os.Getenv("SUPERCRONIC_TEST_ENV"))
+	os.Setenv("SUPERCRONIC_TEST_ENV", "prod")
+
+	options := ParseOptions{Template: true, Values: filepath.Join(dir, "values.yaml")}
+
+	rendered, err := RenderFile(filepath.Join(dir, "crontab"), options)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "0 3 * * * backup a,b\n*/5 * * * * POLL\n", string(rendered))
+	}
+
+	tab, err := ReadCrontab(filepath.Join(dir, "crontab"), options)
+	if assert.Nil(t, err) && assert.Equal(t, 2, len(tab.Jobs)) {
+		assert.Equal(t, "backup a,b", tab.Jobs[0].Command)
+	}
+
+	os.Setenv("SUPERCRONIC_TEST_ENV", "staging")
+
+	tab, err = ReadCrontab(filepath.Join(dir, "crontab"), options)
+	if assert.Nil(t, err) {
+		assert.Equal(t, 1, len(tab.Jobs))
+	}
+
+	// Without Template, crontabs are read as is.
+	_, err = ReadCrontab(filepath.Join(dir, "crontab"), ParseOptions{})
+	assert.NotNil(t, err)
+
+	_, err = RenderFile(filepath.Join(dir, "typo"), options)
+	assert.NotNil(t, err)
+
+	_, err = RenderFile(filepath.Join(dir, "bad"), options)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "bad template")
+	}
+
+	_, err = RenderFile(filepath.Join(dir, "crontab"), ParseOptions{Template: true, Values: filepath.Join(dir, "missing.yaml")})
+	assert.NotNil(t, err)
+}
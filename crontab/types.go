@@ -1,6 +1,9 @@
 package crontab
 
 import (
+	"fmt"
+	"os"
+	"regexp"
 	"time"
 )
 
@@ -8,15 +11,486 @@ type Expression interface {
 	Next(fromTime time.Time) time.Time
 }
 
+// IntervalExpression is the expression for @every schedules, which run the
+// job at a fixed interval rather than at set times.
+type IntervalExpression struct {
+	Interval time.Duration
+	// FromEnd measures the interval from the end of the previous run,
+	// instead of its start.
+	FromEnd bool
+}
+
+func (e *IntervalExpression) Next(fromTime time.Time) time.Time {
+	return fromTime.Add(e.Interval)
+}
+
+// IsFromEnd reports whether expression is an interval measured from the end
+// of the previous run.
+func IsFromEnd(expression Expression) bool {
+	e, ok := expression.(*IntervalExpression)
+	return ok && e.FromEnd
+}
+
+// DaemonExpression is the expression for @always (or @daemon) jobs, which
+// supercronic keeps running rather than schedules: it never fires.
+type DaemonExpression struct{}
+
+func (e *DaemonExpression) Next(fromTime time.Time) time.Time {
+	return time.Time{}
+}
+
+// IsDaemon reports whether expression is that of an @always job.
+func IsDaemon(expression Expression) bool {
+	_, ok := expression.(*DaemonExpression)
+	return ok
+}
+
 type CrontabLine struct {
 	Expression Expression
 	Schedule   string
 	Command    string
 }
 
+// CatchUpPolicy determines what happens to runs of a job that were missed
+// while supercronic wasn't running.
+type CatchUpPolicy string
+
+const (
+	// CatchUpSkip ignores missed runs.
+	CatchUpSkip CatchUpPolicy = "skip"
+	// CatchUpRunOnce runs the job once if any run was missed.
+	CatchUpRunOnce CatchUpPolicy = "run-once"
+	// CatchUpRunAll runs the job once for every missed run.
+	CatchUpRunAll CatchUpPolicy = "run-all"
+)
+
+func ParseCatchUpPolicy(value string) (CatchUpPolicy, error) {
+	switch policy := CatchUpPolicy(value); policy {
+	case CatchUpSkip, CatchUpRunOnce, CatchUpRunAll:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown catch-up policy: %q (expected skip, run-once, or run-all)", value)
+}
+
+// OverlapPolicy determines what to do when a job is due while a previous
+// instance of it is still running.
+type OverlapPolicy string
+
+const (
+	// OverlapSkip skips the run.
+	OverlapSkip OverlapPolicy = "skip"
+	// OverlapAllow starts the run anyway, alongside the previous instance.
+	OverlapAllow OverlapPolicy = "allow"
+	// OverlapQueue starts the run as soon as the previous instance
+	// finishes. At most one run is queued.
+	OverlapQueue OverlapPolicy = "queue"
+	// OverlapReplace terminates the previous instance, and starts the run
+	// once it has exited.
+	OverlapReplace OverlapPolicy = "replace"
+)
+
+func ParseOverlapPolicy(value string) (OverlapPolicy, error) {
+	switch policy := OverlapPolicy(value); policy {
+	case OverlapSkip, OverlapAllow, OverlapQueue, OverlapReplace:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown overlap policy: %q (expected skip, allow, queue, or replace)", value)
+}
+
+// RestartPolicy determines when @always jobs are restarted after they exit.
+type RestartPolicy string
+
+const (
+	// RestartAlways restarts the job whenever it exits.
+	RestartAlways RestartPolicy = "always"
+	// RestartOnFailure only restarts the job if it failed.
+	RestartOnFailure RestartPolicy = "on-failure"
+	// RestartNever leaves the job alone once it exited. It can still be
+	// triggered manually.
+	RestartNever RestartPolicy = "never"
+)
+
+func ParseRestartPolicy(value string) (RestartPolicy, error) {
+	switch policy := RestartPolicy(value); policy {
+	case RestartAlways, RestartOnFailure, RestartNever:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown restart policy: %q (expected always, on-failure, or never)", value)
+}
+
+// DSTSkippedPolicy determines what happens to runs scheduled at a time that
+// does not exist, because clocks skip it when daylight saving time starts.
+type DSTSkippedPolicy string
+
+const (
+	// DSTSkippedRun runs the job right after clocks jump forward (once,
+	// however many of its runs were skipped).
+	DSTSkippedRun DSTSkippedPolicy = "run"
+	// DSTSkippedSkip skips the runs.
+	DSTSkippedSkip DSTSkippedPolicy = "skip"
+)
+
+func ParseDSTSkippedPolicy(value string) (DSTSkippedPolicy, error) {
+	switch policy := DSTSkippedPolicy(value); policy {
+	case DSTSkippedRun, DSTSkippedSkip:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown DST skipped policy: %q (expected run or skip)", value)
+}
+
+// DSTRepeatedPolicy determines what happens to runs scheduled at a time that
+// happens twice, because clocks are set back when daylight saving time ends.
+type DSTRepeatedPolicy string
+
+const (
+	// DSTRepeatedOnce runs the job the first time only.
+	DSTRepeatedOnce DSTRepeatedPolicy = "once"
+	// DSTRepeatedTwice runs the job both times.
+	DSTRepeatedTwice DSTRepeatedPolicy = "twice"
+)
+
+func ParseDSTRepeatedPolicy(value string) (DSTRepeatedPolicy, error) {
+	switch policy := DSTRepeatedPolicy(value); policy {
+	case DSTRepeatedOnce, DSTRepeatedTwice:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown DST repeated policy: %q (expected once or twice)", value)
+}
+
+// OutputFormat is the format a job writes its output in.
+type OutputFormat string
+
+const (
+	// OutputText logs each line of output as a message.
+	OutputText OutputFormat = "text"
+	// OutputJSON merges the fields of lines that are JSON objects into the
+	// log entry.
+	OutputJSON OutputFormat = "json"
+	// OutputRaw copies output to supercronic's own stdout and stderr as is,
+	// without logging it.
+	OutputRaw OutputFormat = "raw"
+)
+
+func ParseOutputFormat(value string) (OutputFormat, error) {
+	switch format := OutputFormat(value); format {
+	case OutputText, OutputJSON, OutputRaw:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown output format: %q (expected text, json, or raw)", value)
+}
+
+// OutputLevel is the level lines of a job's output are logged at.
+type OutputLevel string
+
+const (
+	OutputLevelInfo    OutputLevel = "info"
+	OutputLevelWarning OutputLevel = "warning"
+	OutputLevelError   OutputLevel = "error"
+)
+
+func ParseOutputLevel(value string) (OutputLevel, error) {
+	switch level := OutputLevel(value); level {
+	case OutputLevelInfo, OutputLevelWarning, OutputLevelError:
+		return level, nil
+	}
+	return "", fmt.Errorf("unknown output level: %q (expected info, warning, or error)", value)
+}
+
+// ParseOutputPattern parses a regular expression that lines of output are
+// matched against. Since an empty one would match every line, it is refused.
+func ParseOutputPattern(value string) (*regexp.Regexp, error) {
+	if value == "" {
+		return nil, fmt.Errorf("no pattern given")
+	}
+	return regexp.Compile(value)
+}
+
+// ExitCodeClass determines how a run that exits with a given (non-zero) code
+// is treated. Codes that aren't classified are failures.
+type ExitCodeClass string
+
+const (
+	// ExitCodeSuccess treats the run as if it succeeded.
+	ExitCodeSuccess ExitCodeClass = "success"
+	// ExitCodeSkipped treats the run as one that had nothing to do: it
+	// doesn't count as a failure, but is logged as skipped.
+	ExitCodeSkipped ExitCodeClass = "skipped"
+	// ExitCodeRetryable treats the run as a failure that may be retried.
+	// Once a job classifies some codes as retryable, other failures aren't
+	// retried.
+	ExitCodeRetryable ExitCodeClass = "retryable"
+)
+
+func ParseExitCodeClass(value string) (ExitCodeClass, error) {
+	switch class := ExitCodeClass(value); class {
+	case ExitCodeSuccess, ExitCodeSkipped, ExitCodeRetryable:
+		return class, nil
+	}
+	return "", fmt.Errorf("unknown exit code class: %q (expected success, skipped, or retryable)", value)
+}
+
+// ExecMode determines how a job's command is run.
+type ExecMode string
+
+const (
+	// ExecShell runs the command with $SHELL -c.
+	ExecShell ExecMode = "shell"
+	// ExecDirect splits the command into arguments (see SplitCommand), and
+	// runs it without a shell.
+	ExecDirect ExecMode = "direct"
+)
+
+func ParseExecMode(value string) (ExecMode, error) {
+	switch mode := ExecMode(value); mode {
+	case ExecShell, ExecDirect:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown exec mode: %q (expected shell or direct)", value)
+}
+
+// Limits restricts the resources a job may use. Zero values mean no limit.
+type Limits struct {
+	// Memory is in bytes.
+	Memory uint64
+	// CPU is a number of CPUs, e.g. 0.5. It requires cgroups.
+	CPU    float64
+	NoFile uint64
+}
+
+// Container runs a job in a Docker container rather than as a child of
+// supercronic. Either Image is set, to run the job in a new container (removed
+// once the job exits), or Exec is, to run it in a running container.
+type Container struct {
+	Image string
+	// Exec is the name (or ID) of the container.
+	Exec string
+	User string
+
+	// Network and Mounts (as given to docker run -v) only apply to new
+	// containers.
+	Network string
+	Mounts  []string
+}
+
+// KubernetesJob runs a job as a Kubernetes Job rather than as a child of
+// supercronic.
+type KubernetesJob struct {
+	// Template is the path of a file holding the pod template (a
+	// PodTemplateSpec, in YAML or JSON) of the Jobs.
+	Template string
+	// Namespace defaults to the namespace of the pod supercronic runs in.
+	Namespace string
+	// Container is the container of the template that runs the job's
+	// command. It defaults to the first one.
+	Container string
+}
+
+// IOClass is an I/O scheduling class, as set by ionice(1).
+type IOClass string
+
+const (
+	IORealtime   IOClass = "realtime"
+	IOBestEffort IOClass = "best-effort"
+	// IOIdle only gets disk time when no other process needs it.
+	IOIdle IOClass = "idle"
+)
+
+func ParseIOClass(value string) (IOClass, error) {
+	switch class := IOClass(value); class {
+	case IORealtime, IOBestEffort, IOIdle:
+		return class, nil
+	}
+	return "", fmt.Errorf("unknown I/O class: %q (expected realtime, best-effort or idle)", value)
+}
+
+// Priority sets the scheduling priority of a job's processes. Zero values
+// leave the priority supercronic runs with unchanged.
+type Priority struct {
+	// Nice is the niceness, from -20 (highest priority) to 19 (lowest).
+	Nice int
+	// IOClass and IOLevel set the I/O priority. IOLevel goes from 0
+	// (highest) to 7 (lowest), and doesn't apply to IOIdle.
+	IOClass IOClass
+	IOLevel int
+}
+
+// Secret is a variable whose value comes from a secrets provider, per its
+// Source: file:PATH (the contents of a file) or vault:PATH#KEY (a key of a
+// secret in Vault).
+type Secret struct {
+	Name   string
+	Source string
+}
+
+// LogFile is a file a job's output is copied to.
+type LogFile struct {
+	Path string
+	// MaxSize (in bytes) and MaxAge determine when the file is rotated. Zero
+	// values mean no limit.
+	MaxSize uint64
+	MaxAge  time.Duration
+	// Keep is how many rotated files are kept around.
+	Keep int
+}
+
+// Throttle limits how much of a job's output is logged. Zero values mean no
+// limit.
+type Throttle struct {
+	LinesPerSecond int
+	// MaxBytes applies to each run.
+	MaxBytes uint64
+}
+
 type Job struct {
 	CrontabLine
-	Position int
+	// Name is empty unless set via a directive. Other jobs refer to the job
+	// by name.
+	Name        string
+	Position    int
+	Source      string
+	Timeout     time.Duration
+	Healthcheck string
+
+	// Line is the line of Source the job is on, or 0 if unknown (e.g. for
+	// YAML jobs).
+	Line int
+
+	// ExpectedDuration is how long runs of the job should take at most.
+	// Unlike Timeout, runs that take longer are only reported.
+	ExpectedDuration time.Duration
+
+	// Jitter is the maximum random delay to add to scheduled runs.
+	Jitter time.Duration
+
+	// CatchUp is empty unless set via a directive, in which case it
+	// overrides the global policy.
+	CatchUp CatchUpPolicy
+
+	// Overlap is empty unless set via a directive, in which case it
+	// overrides the global policy.
+	Overlap OverlapPolicy
+
+	// Restart is empty unless set via a directive, in which case it
+	// overrides RestartAlways. It only applies to @always jobs.
+	Restart RestartPolicy
+
+	Limits    *Limits
+	Priority  *Priority
+	Container *Container
+	// Umask is set via a umask directive. Jobs inherit supercronic's
+	// otherwise.
+	Umask *os.FileMode
+	// KubernetesJob is set via a kubernetes_job directive.
+	KubernetesJob *KubernetesJob
+	LogFile       *LogFile
+	Throttle      *Throttle
+
+	// StdoutFile and StderrFile get the raw output of the job, one stream
+	// each, unlike LogFile (which gets both).
+	StdoutFile *LogFile
+	StderrFile *LogFile
+
+	// Output is empty unless set via a directive, which means text.
+	Output OutputFormat
+
+	// StderrLevel is empty unless set via a directive, in which case it
+	// overrides the global level of lines written to stderr.
+	StderrLevel OutputLevel
+
+	// ErrorPattern and WarningPattern, if set, override the global ones:
+	// lines of output they match are logged as errors or warnings,
+	// whichever stream they were written to.
+	ErrorPattern   *regexp.Regexp
+	WarningPattern *regexp.Regexp
+
+	// Exec is empty unless set via a directive, in which case it overrides
+	// the global mode.
+	Exec ExecMode
+
+	// Tags are set via a tags directive, to select the job with a
+	// TagFilter.
+	Tags []string
+
+	// Group is the name of the group the job is in, if any (see
+	// crontabGroup).
+	Group string
+
+	// After lists the names of jobs that must complete successfully (in
+	// the window since the job's previous run was due) before it runs.
+	After []string
+
+	// Stdin is what the job reads on stdin, per its stdin directive. Jobs
+	// read nothing by default.
+	Stdin *Stdin
+
+	// Env holds variables set for this job only, on top of the crontab's.
+	Env map[string]string
+
+	// Dir is the directory the job runs in, per its workdir directive. It
+	// defaults to supercronic's.
+	Dir string
+
+	// Retries is how many times a failed run is retried, waiting RetryDelay
+	// before each retry.
+	Retries    int
+	RetryDelay time.Duration
+
+	// MaxConsecutiveFailures, if set, is how many runs in a row may fail
+	// before the job stops being scheduled (i.e. its circuit breaker trips).
+	MaxConsecutiveFailures int
+
+	// ExitCodes classifies the non-zero exit codes that don't mean the job
+	// failed, or that mean it may be retried.
+	ExitCodes map[int]ExitCodeClass
+
+	// EnvFiles are dotenv files whose variables are added to the job's
+	// environment. They are read every time the job runs.
+	EnvFiles []string
+
+	// Secrets are added to the job's environment after its env files. They
+	// are resolved every time the job runs.
+	Secrets []Secret
+
+	// OnFailure is a command to run (in the job's shell) when the job fails.
+	OnFailure string
+
+	// SentryMonitor is the slug of the Sentry cron monitor to check in to.
+	SentryMonitor string
+
+	// SentryDSN and SentryEnvironment override the Sentry project and
+	// environment the job reports to.
+	SentryDSN         string
+	SentryEnvironment string
+
+	// RunAtStartup, when set, overrides whether the job runs when
+	// supercronic starts (per -run-at-startup).
+	RunAtStartup *bool
+
+	// StartupDelay, if set, overrides how long after supercronic starts the
+	// job starts being scheduled (per -startup-delay).
+	StartupDelay time.Duration
+
+	// SkipIfDone skips runs that are due in the same window of the schedule
+	// as a run that succeeded before supercronic restarted (per its history).
+	SkipIfDone bool
+
+	// PushgatewayLabels are added to the grouping key of the metrics
+	// pushed for the job.
+	PushgatewayLabels map[string]string
+}
+
+// Stdin is the input of a job: the file at Path (opened every time the job
+// runs), or Data, from a block in the crontab.
+type Stdin struct {
+	Path string
+	Data string
+}
+
+// Key identifies a job across restarts and replicas. Jobs are identified by
+// their schedule and command, since their position may change when the
+// crontab is edited.
+func (j *Job) Key() string {
+	return j.Schedule + " " + j.Command
 }
 
 type Context struct {
@@ -0,0 +1,83 @@
+package crontab
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// shellOperators are the characters that mean something to a shell outside
+// of quotes, besides quotes, backslashes and whitespace. # and ~ only do at
+// the start of a word.
+const shellOperators = "|&;<>()$`*?["
+
+// SplitCommand splits command into arguments the way a shell would split a
+// simple command: arguments are separated by whitespace, single quotes
+// preserve everything they enclose, and double quotes preserve everything
+// except backslash escapes. Commands that use other shell features (e.g.
+// pipes, redirections, or variables) are rejected, since running them
+// requires a shell.
+func SplitCommand(command string) ([]string, error) {
+	var words []string
+	var word bytes.Buffer
+	inWord := false
+
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+
+		switch {
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+			continue
+		case c == '\'':
+			end := strings.IndexByte(command[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote in command: %s", command)
+			}
+			word.WriteString(command[i+1 : i+1+end])
+			i += end + 1
+		case c == '"':
+			closed := false
+			for i++; i < len(command); i++ {
+				if command[i] == '"' {
+					closed = true
+					break
+				}
+				if command[i] == '\\' && i+1 < len(command) && strings.IndexByte("\\\"$`", command[i+1]) >= 0 {
+					i++
+				} else if command[i] == '$' || command[i] == '`' {
+					return nil, fmt.Errorf("command requires a shell (%c): %s", command[i], command)
+				}
+				word.WriteByte(command[i])
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated quote in command: %s", command)
+			}
+		case c == '\\':
+			if i+1 < len(command) {
+				i++
+				word.WriteByte(command[i])
+			}
+		case strings.IndexByte(shellOperators, c) >= 0 || (!inWord && (c == '#' || c == '~')):
+			return nil, fmt.Errorf("command requires a shell (%c): %s", c, command)
+		default:
+			word.WriteByte(c)
+		}
+
+		inWord = true
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+
+	return words, nil
+}
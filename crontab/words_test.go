@@ -0,0 +1,49 @@
+package crontab
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var splitCommandTestCases = []struct {
+	command  string
+	expected []string
+}{
+	{"foo", []string{"foo"}},
+	{"  foo   bar\tbaz ", []string{"foo", "bar", "baz"}},
+	{"echo 'hello world' \"a \\\"b\\\" c\"", []string{"echo", "hello world", `a "b" c`}},
+	{"echo 'it''s'", []string{"echo", "its"}},
+	{"echo '$HOME | x' \"\\$HOME\"", []string{"echo", "$HOME | x", "$HOME"}},
+	{"echo a\\ b \\|", []string{"echo", "a b", "|"}},
+	{"echo '' \"\"", []string{"echo", "", ""}},
+	{"curl http://example.com/#anchor user=~me", []string{"curl", "http://example.com/#anchor", "user=~me"}},
+
+	{"", nil},
+	{"echo 'foo", nil},
+	{"echo \"foo", nil},
+	{"echo foo | grep foo", nil},
+	{"echo foo > /dev/null", nil},
+	{"echo foo; echo bar", nil},
+	{"echo $HOME", nil},
+	{"echo \"$HOME\"", nil},
+	{"echo `date`", nil},
+	{"ls *.log", nil},
+	{"ls ~/foo", nil},
+	{"echo foo # comment", nil},
+}
+
+func TestSplitCommand(t *testing.T) {
+	for _, tt := range splitCommandTestCases {
+		label := fmt.Sprintf("SplitCommand(%q)", tt.command)
+
+		words, err := SplitCommand(tt.command)
+
+		if tt.expected == nil {
+			assert.NotNil(t, err, label)
+		} else if assert.Nil(t, err, label) {
+			assert.Equal(t, tt.expected, words, label)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package crontab
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	FormatCrontab = "crontab"
+	FormatYAML    = "yaml"
+)
+
+// ParseFormat validates a format name, for ParseOptions.Format.
+func ParseFormat(value string) (string, error) {
+	switch value {
+	case "", FormatCrontab, FormatYAML:
+		return value, nil
+	}
+	return "", fmt.Errorf("format must be one of %s or %s: %s", FormatCrontab, FormatYAML, value)
+}
+
+// formatForPath returns the format of the file at path, per options or,
+// failing that, its extension.
+func formatForPath(path string, options ParseOptions) string {
+	if options.Format != "" {
+		return options.Format
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	}
+
+	return FormatCrontab
+}
+
+// yamlJobs is the structure of YAML jobs files. Variables in env work like
+// variables in a crontab. Most job settings take the same values as the
+// directive of the same name.
+type yamlJobs struct {
+	Env  map[string]string `yaml:"env"`
+	Jobs []yamlJob         `yaml:"jobs"`
+}
+
+type yamlJob struct {
+	Name     string            `yaml:"name"`
+	Schedule string            `yaml:"schedule"`
+	Command  string            `yaml:"command"`
+	Env      map[string]string `yaml:"env"`
+	EnvFiles []string          `yaml:"env_files"`
+	Workdir  string            `yaml:"workdir"`
+	Stdin    string            `yaml:"stdin"`
+	Retries  int               `yaml:"retries"`
+
+	MaxConsecutiveFailures int `yaml:"max_consecutive_failures"`
+
+	RetryDelay       string   `yaml:"retry_delay"`
+	Timeout          string   `yaml:"timeout"`
+	ExpectedDuration string   `yaml:"expected_duration"`
+	StartupDelay     string   `yaml:"startup_delay"`
+	Overlap          string   `yaml:"overlap"`
+	CatchUp          string   `yaml:"catchup"`
+	Jitter           string   `yaml:"jitter"`
+	Healthcheck      string   `yaml:"healthcheck"`
+	After            []string `yaml:"after"`
+	Tags             []string `yaml:"tags"`
+	Output           string   `yaml:"output"`
+	StderrLevel      string   `yaml:"stderr_level"`
+	ErrorPattern     string   `yaml:"error_pattern"`
+	WarningPattern   string   `yaml:"warning_pattern"`
+	Exec             string   `yaml:"exec"`
+	ExitCodes        string   `yaml:"exit_codes"`
+	Throttle         string   `yaml:"throttle"`
+	Limits           string   `yaml:"limits"`
+	Priority         string   `yaml:"priority"`
+	Umask            string   `yaml:"umask"`
+	Container        string   `yaml:"container"`
+	LogFile          string   `yaml:"logfile"`
+	EveryFrom        string   `yaml:"every_from"`
+	Restart          string   `yaml:"restart"`
+	OnFailure        string   `yaml:"on_failure"`
+	StdoutFile       string   `yaml:"stdout_file"`
+	StderrFile       string   `yaml:"stderr_file"`
+	SentryMonitor    string   `yaml:"sentry_monitor"`
+	SentryDSN        string   `yaml:"sentry_dsn"`
+	SentryEnv        string   `yaml:"sentry_env"`
+	KubernetesJob    string   `yaml:"kubernetes_job"`
+
+	PushgatewayLabels map[string]string `yaml:"pushgateway_labels"`
+	Secrets           map[string]string `yaml:"secrets"`
+	RunAtStartup      *bool             `yaml:"run_at_startup"`
+	SkipIfDone        bool              `yaml:"skip_if_done"`
+
+	// StdinData is the job's stdin, inline (in place of a file in stdin).
+	StdinData *string `yaml:"stdin_data"`
+}
+
+// ParseYAMLJobs parses jobs defined in YAML, as an alternative to a crontab:
+//
+//	env:
+//	  SHELL: /bin/bash
+//	jobs:
+//	  - name: db-backup
+//	    schedule: "0 2 * * *"
+//	    command: /usr/local/bin/backup-db
+//	    timeout: 1h
+//	    retries: 2
+func ParseYAMLJobs(reader io.Reader, options ParseOptions) (*Crontab, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed yamlJobs
+	if err := yaml.UnmarshalStrict(data, &parsed); err != nil {
+		return nil, err
+	}
+
+	environ := make(map[string]string)
+	shell := "/bin/sh"
+
+	var location *time.Location
+	var randomDelay time.Duration
+
+	// Variables are applied in a stable order (for expansion), with the
+	// ones that configure supercronic first.
+	keys := make([]string, 0, len(parsed.Env))
+	for _, key := range []string{"SHELL", "TZ", "CRON_TZ"} {
+		if _, ok := parsed.Env[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range sortedKeys(parsed.Env) {
+		if key != "SHELL" && key != "TZ" && key != "CRON_TZ" {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range keys {
+		value := parsed.Env[key]
+		if options.ExpandEnv {
+			value = expandVariables(value, environ)
+		}
+
+		switch key {
+		case "SHELL":
+			shell = value
+		case "TZ", "CRON_TZ":
+			loc, err := loadLocation(value)
+			if err != nil && key == "CRON_TZ" {
+				return nil, fmt.Errorf("bad %s: %v", key, err)
+			}
+			// Jobs still get a TZ only libc understands (see parseCrontab).
+			if err != nil {
+				logrus.Warnf("jobs will be scheduled in the default timezone, not TZ=%s: %v", value, err)
+			}
+			// CRON_TZ comes last, so it takes precedence.
+			location = loc
+		case "RANDOM_DELAY":
+			d, err := parseRandomDelay(value)
+			if err != nil {
+				return nil, err
+			}
+			randomDelay = d
+		}
+
+		environ[key] = value
+	}
+
+	jobs := make([]*Job, 0, len(parsed.Jobs))
+	names := make(map[string]bool)
+
+	for position, j := range parsed.Jobs {
+		job, err := j.toJob(position, location, randomDelay, environ, options)
+		if err != nil {
+			label := j.Name
+			if label == "" {
+				label = fmt.Sprintf("#%d", position+1)
+			}
+			return nil, fmt.Errorf("job %s: %v", label, err)
+		}
+
+		if job.Name != "" {
+			if names[job.Name] {
+				return nil, fmt.Errorf("duplicate job name: %s", job.Name)
+			}
+			names[job.Name] = true
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return &Crontab{
+		Jobs: jobs,
+		Context: &Context{
+			Shell:   shell,
+			Environ: environ,
+		},
+	}, nil
+}
+
+func (j *yamlJob) toJob(position int, location *time.Location, randomDelay time.Duration, environ map[string]string, options ParseOptions) (*Job, error) {
+	schedule := strings.TrimSpace(j.Schedule)
+	if schedule == "" {
+		return nil, fmt.Errorf("missing schedule")
+	}
+
+	if strings.TrimSpace(j.Command) == "" {
+		return nil, fmt.Errorf("missing command")
+	}
+
+	// Parse the schedule as a crontab line would be, making sure all
+	// of it is used.
+	hashKey := j.Name
+	if hashKey == "" {
+		hashKey = j.Command
+	}
+
+	line, err := parseJobLine(schedule+" command", hashKey, options)
+	if err != nil || line.Command != "command" {
+		return nil, fmt.Errorf("bad schedule: %s", j.Schedule)
+	}
+
+	if location == nil {
+		location = options.Location
+	}
+
+	if _, isInterval := line.Expression.(*IntervalExpression); !isInterval && !IsDaemon(line.Expression) {
+		line.Expression = newLocationExpression(line.Expression, location, options)
+	}
+
+	line.Command = j.Command
+	if options.ExpandEnv {
+		line.Command = expandVariables(line.Command, environ)
+	}
+
+	job := &Job{
+		CrontabLine: *line,
+		Position:    position,
+		Env:         j.Env,
+		EnvFiles:    j.EnvFiles,
+	}
+
+	if options.ExpandEnv {
+		for key, value := range job.Env {
+			job.Env[key] = expandVariables(value, environ)
+		}
+	}
+
+	if j.Retries < 0 {
+		return nil, fmt.Errorf("retries must not be negative")
+	}
+	job.Retries = j.Retries
+
+	if j.MaxConsecutiveFailures < 0 {
+		return nil, fmt.Errorf("max_consecutive_failures must not be negative")
+	}
+	job.MaxConsecutiveFailures = j.MaxConsecutiveFailures
+
+	if len(j.PushgatewayLabels) > 0 {
+		fields := make([]string, 0, len(j.PushgatewayLabels))
+		for _, key := range sortedKeys(j.PushgatewayLabels) {
+			fields = append(fields, key+"="+j.PushgatewayLabels[key])
+		}
+
+		if err := parsePushgatewayLabelsDirective(job, strings.Join(fields, " ")); err != nil {
+			return nil, fmt.Errorf("bad pushgateway_labels: %v", err)
+		}
+	}
+
+	for _, name := range sortedKeys(j.Secrets) {
+		if err := parseSecretDirective(job, name+"="+j.Secrets[name]); err != nil {
+			return nil, fmt.Errorf("bad secrets: %v", err)
+		}
+	}
+
+	if j.RunAtStartup != nil {
+		runAtStartup := *j.RunAtStartup
+		job.RunAtStartup = &runAtStartup
+	}
+
+	job.SkipIfDone = j.SkipIfDone
+
+	if j.StdinData != nil {
+		if j.Stdin != "" {
+			return nil, fmt.Errorf("jobs cannot have both stdin and stdin_data")
+		}
+		job.Stdin = &Stdin{Data: *j.StdinData}
+	}
+
+	if j.RetryDelay != "" {
+		if job.RetryDelay, err = parsePositiveDuration(j.RetryDelay); err != nil {
+			return nil, fmt.Errorf("bad retry_delay: %v", err)
+		}
+	}
+
+	settings := []struct {
+		key   string
+		value string
+	}{
+		{"name", j.Name},
+		{"workdir", j.Workdir},
+		{"stdin", j.Stdin},
+		{"timeout", j.Timeout},
+		{"expected_duration", j.ExpectedDuration},
+		{"startup_delay", j.StartupDelay},
+		{"overlap", j.Overlap},
+		{"catchup", j.CatchUp},
+		{"jitter", j.Jitter},
+		{"healthcheck", j.Healthcheck},
+		{"after", strings.Join(j.After, ",")},
+		{"tags", strings.Join(j.Tags, ",")},
+		{"output", j.Output},
+		{"stderr_level", j.StderrLevel},
+		{"error_pattern", j.ErrorPattern},
+		{"warning_pattern", j.WarningPattern},
+		{"exec", j.Exec},
+		{"exit_codes", j.ExitCodes},
+		{"throttle", j.Throttle},
+		{"limits", j.Limits},
+		{"priority", j.Priority},
+		{"umask", j.Umask},
+		{"container", j.Container},
+		{"logfile", j.LogFile},
+		{"every_from", j.EveryFrom},
+		{"restart", j.Restart},
+		{"on_failure", j.OnFailure},
+		{"stdout_file", j.StdoutFile},
+		{"stderr_file", j.StderrFile},
+		{"sentry_monitor", j.SentryMonitor},
+		{"sentry_dsn", j.SentryDSN},
+		{"sentry_env", j.SentryEnv},
+		{"kubernetes_job", j.KubernetesJob},
+	}
+
+	for _, s := range settings {
+		if s.value == "" {
+			continue
+		}
+
+		if err := directiveParsers[s.key](job, s.value); err != nil {
+			return nil, fmt.Errorf("bad %s: %v", s.key, err)
+		}
+	}
+
+	for _, name := range job.After {
+		if name == job.Name {
+			return nil, fmt.Errorf("job %s cannot run after itself", name)
+		}
+	}
+
+	if err := checkContainer(job); err != nil {
+		return nil, err
+	}
+
+	if job.Jitter == 0 {
+		job.Jitter = randomDelay
+	}
+
+	return job, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
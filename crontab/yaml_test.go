@@ -0,0 +1,188 @@
+package crontab
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testYAMLJobs = `
+env:
+  SHELL: /bin/bash
+  CRON_TZ: Europe/Paris
+  BACKUP_DIR: /backups
+jobs:
+  - name: db-backup
+    schedule: "0 2 * * *"
+    command: backup-db --to "$BACKUP_DIR"
+    env:
+      PGHOST: db
+    env_files: [/run/secrets/db.env]
+    secrets:
+      PGPASSWORD: file:/run/secrets/pgpass
+    workdir: /srv
+    timeout: 1h
+    retries: 2
+    retry_delay: 30s
+    max_consecutive_failures: 3
+    startup_delay: 1m
+    overlap: queue
+    run_at_startup: true
+    skip_if_done: true
+    stderr_level: warning
+    error_pattern: "^ERROR"
+  - schedule: "@every 90s"
+    command: drain-queue
+    every_from: end
+    container: exec=worker
+    after: [db-backup]
+    stdin_data: |
+      SELECT 1;
+`
+
+func TestParseYAMLJobs(t *testing.T) {
+	tab, err := ParseYAMLJobs(bytes.NewBufferString(testYAMLJobs), ParseOptions{})
+	if !assert.Nil(t, err) || !assert.Equal(t, 2, len(tab.Jobs)) {
+		return
+	}
+
+	assert.Equal(t, "/bin/bash", tab.Context.Shell)
+	assert.Equal(t, map[string]string{"SHELL": "/bin/bash", "CRON_TZ": "Europe/Paris", "BACKUP_DIR": "/backups"}, tab.Context.Environ)
+
+	backup := tab.Jobs[0]
+	assert.Equal(t, "db-backup", backup.Name)
+	assert.Equal(t, "0 2 * * *", backup.Schedule)
+	assert.Equal(t, `backup-db --to "$BACKUP_DIR"`, backup.Command)
+	assert.Equal(t, 0, backup.Position)
+	assert.Equal(t, map[string]string{"PGHOST": "db"}, backup.Env)
+	assert.Equal(t, []string{"/run/secrets/db.env"}, backup.EnvFiles)
+	assert.Equal(t, []Secret{{Name: "PGPASSWORD", Source: "file:/run/secrets/pgpass"}}, backup.Secrets)
+	assert.Equal(t, "/srv", backup.Dir)
+	assert.Nil(t, backup.Stdin)
+	assert.Equal(t, time.Hour, backup.Timeout)
+	assert.Equal(t, 2, backup.Retries)
+	assert.Equal(t, 30*time.Second, backup.RetryDelay)
+	assert.Equal(t, 3, backup.MaxConsecutiveFailures)
+	assert.Equal(t, time.Minute, backup.StartupDelay)
+	assert.Equal(t, OverlapQueue, backup.Overlap)
+	if assert.NotNil(t, backup.RunAtStartup) {
+		assert.True(t, *backup.RunAtStartup)
+	}
+	assert.True(t, backup.SkipIfDone)
+	assert.Equal(t, OutputLevelWarning, backup.StderrLevel)
+	if assert.NotNil(t, backup.ErrorPattern) {
+		assert.Equal(t, "^ERROR", backup.ErrorPattern.String())
+	}
+	assert.Nil(t, backup.WarningPattern)
+	assert.Equal(t, "Europe/Paris", backup.Location().String())
+
+	drain := tab.Jobs[1]
+	assert.Equal(t, "@every 90s", drain.Schedule)
+	assert.Equal(t, 1, drain.Position)
+	assert.True(t, IsFromEnd(drain.Expression))
+	assert.Equal(t, []string{"db-backup"}, drain.After)
+	assert.Nil(t, drain.RunAtStartup)
+	assert.False(t, drain.SkipIfDone)
+	assert.Equal(t, &Container{Exec: "worker"}, drain.Container)
+	assert.Equal(t, &Stdin{Data: "SELECT 1;\n"}, drain.Stdin)
+}
+
+func TestParseYAMLJobsExpandEnv(t *testing.T) {
+	tab, err := ParseYAMLJobs(bytes.NewBufferString(testYAMLJobs), ParseOptions{ExpandEnv: true})
+	if assert.Nil(t, err) {
+		assert.Equal(t, `backup-db --to "/backups"`, tab.Jobs[0].Command)
+	}
+}
+
+func TestParseYAMLJobsWithLocation(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	tab, err := ParseYAMLJobs(bytes.NewBufferString("jobs: [{schedule: '0 9 * * *', command: foo}]"), ParseOptions{Location: tokyo})
+	if assert.Nil(t, err) && assert.Equal(t, 1, len(tab.Jobs)) {
+		assert.Equal(t, "Asia/Tokyo", tab.Jobs[0].Location().String())
+	}
+
+	// CRON_TZ takes precedence.
+	tab, err = ParseYAMLJobs(bytes.NewBufferString(testYAMLJobs), ParseOptions{Location: tokyo})
+	if assert.Nil(t, err) {
+		assert.Equal(t, "Europe/Paris", tab.Jobs[0].Location().String())
+	}
+
+	// Jobs still get a TZ that isn't a timezone name.
+	tab, err = ParseYAMLJobs(bytes.NewBufferString("env: {TZ: UTC0}\njobs: [{schedule: '0 9 * * *', command: foo}]"), ParseOptions{Location: tokyo})
+	if assert.Nil(t, err) && assert.Equal(t, 1, len(tab.Jobs)) {
+		assert.Equal(t, "UTC0", tab.Context.Environ["TZ"])
+		assert.Equal(t, "Asia/Tokyo", tab.Jobs[0].Location().String())
+	}
+}
+
+func TestParseYAMLJobsWithHashFields(t *testing.T) {
+	tab, err := ParseYAMLJobs(bytes.NewBufferString("jobs: [{name: backup, schedule: 'H 3 * * *', command: foo}]"), ParseOptions{})
+	if assert.Nil(t, err) && assert.Equal(t, 1, len(tab.Jobs)) {
+		minute, _ := expandHashField("H", "backup", hashMinutes)
+		assert.Equal(t, minute+" 3 * * *", tab.Jobs[0].Schedule)
+		assert.Equal(t, "foo", tab.Jobs[0].Command)
+	}
+}
+
+func TestParseYAMLJobsErrors(t *testing.T) {
+	for _, bad := range []string{
+		"jobs: [{schedule: '* * * * *'}]",
+		"jobs: [{command: foo}]",
+		"jobs: [{schedule: 'every day', command: foo}]",
+		"jobs: [{schedule: '* * * * * foo', command: foo}]",
+		"jobs: [{schedule: '* * * * *', command: foo, timeout: forever}]",
+		"jobs: [{schedule: '* * * * *', command: foo, retries: -1}]",
+		"jobs: [{schedule: '* * * * *', command: foo, color: blue}]",
+		"jobs: [{schedule: '* * * * *', command: foo, run_at_startup: sometimes}]",
+		"jobs: [{schedule: '* * * * *', command: foo, secrets: {DB_PASS: 'env:DB_PASS'}}]",
+		"jobs: [{schedule: '* * * * *', command: foo, container: 'exec=app', priority: 'nice=10'}]",
+		"jobs: [{name: a, schedule: '* * * * *', command: foo}, {name: a, schedule: '* * * * *', command: bar}]",
+		"jobs: [{name: a, schedule: '* * * * *', command: foo, after: [a]}]",
+		"jobs: [{schedule: '* * * * *', command: foo, stdin: query.sql, stdin_data: 'SELECT 1;'}]",
+		"env: {CRON_TZ: Nowhere/Special}\njobs: []",
+		"env: {RANDOM_DELAY: soon}\njobs: []",
+	} {
+		_, err := ParseYAMLJobs(bytes.NewBufferString(bad), ParseOptions{})
+		assert.NotNil(t, err, bad)
+	}
+}
+
+func TestReadCrontabDetectsFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	yamlPath := filepath.Join(dir, "jobs.yml")
+	if err := ioutil.WriteFile(yamlPath, []byte("jobs: [{schedule: '@hourly', command: foo}]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tab, err := ReadCrontab(yamlPath, ParseOptions{})
+	if assert.Nil(t, err) && assert.Equal(t, 1, len(tab.Jobs)) {
+		assert.Equal(t, "foo", tab.Jobs[0].Command)
+		assert.Equal(t, yamlPath, tab.Jobs[0].Source)
+	}
+
+	// The format can be forced.
+	_, err = ReadCrontab(yamlPath, ParseOptions{Format: FormatCrontab})
+	assert.NotNil(t, err)
+
+	crontabPath := filepath.Join(dir, "jobs")
+	if err := ioutil.WriteFile(crontabPath, []byte("jobs: [{schedule: '@hourly', command: foo}]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ReadCrontab(crontabPath, ParseOptions{Format: FormatYAML})
+	assert.Nil(t, err)
+}
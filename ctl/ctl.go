@@ -0,0 +1,240 @@
+// Package ctl implements supercronicctl, which controls the supercronic
+// running in the same container through its control socket (see
+// -control-socket): supercronic runs it when it is invoked as supercronicctl
+// (e.g. through a symlink), or as `supercronic ctl`.
+package ctl
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"supercronic/admin"
+	"supercronic/cron"
+)
+
+// Name is the name supercronic runs as supercronicctl under.
+const Name = "supercronicctl"
+
+// DEFAULT_SOCKET is where the control socket is looked for, unless
+// SUPERCRONIC_CONTROL_SOCKET (which also configures supercronic's
+// -control-socket) or -socket say otherwise.
+var DEFAULT_SOCKET = "/tmp/supercronic.sock"
+
+const usage = `Usage: %s [OPTIONS] COMMAND [ARGS]
+
+Control the supercronic whose control socket is at -socket.
+
+Commands:
+  status          list jobs, when they run next, and how their last run went
+  trigger JOB     run JOB (a job name or ID) now, and show its output
+  pause JOB       stop scheduling JOB
+  resume JOB      resume scheduling JOB
+  reset JOB       reset JOB's circuit breaker
+  reload          reload the crontab
+  tail [-f] JOB   show the output of JOB's latest run (-f: and of later runs)
+
+Available options:
+`
+
+// Main runs supercronicctl, invoked as program with args, and returns its
+// exit status.
+func Main(program string, args []string, stdout io.Writer, stderr io.Writer) int {
+	socket := os.Getenv("SUPERCRONIC_CONTROL_SOCKET")
+	if socket == "" {
+		socket = DEFAULT_SOCKET
+	}
+
+	flags := flag.NewFlagSet(program, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&socket, "socket", socket, "path of the control socket (defaults to $SUPERCRONIC_CONTROL_SOCKET)")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, usage, program)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	c := &command{addr: "unix:" + socket, stdout: stdout, stderr: stderr}
+
+	name, args := flags.Arg(0), flags.Args()[1:]
+
+	var run func([]string) error
+	switch name {
+	case "status":
+		run = c.status
+	case "trigger":
+		return c.trigger(args)
+	case "pause", "resume", "reset":
+		run = func(args []string) error { return c.control(name, args) }
+	case "reload":
+		run = c.reload
+	case "tail":
+		run = c.tail
+	default:
+		fmt.Fprintf(stderr, "unknown command: %s\n", name)
+		flags.Usage()
+		return 2
+	}
+
+	if err := run(args); err != nil {
+		fmt.Fprintf(stderr, "%s %s: %v\n", program, name, err)
+		return 1
+	}
+
+	return 0
+}
+
+type command struct {
+	addr   string
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func job(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("expected a job name or ID")
+	}
+	return args[0], nil
+}
+
+func (c *command) status(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+
+	jobs, err := admin.Jobs(c.addr)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	w := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSCHEDULE\tNEXT RUN\tLAST RUN\tSTATE\tCOMMAND")
+	for _, job := range jobs {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", job.ID, orDash(job.Name), job.Schedule, nextRun(job, now), lastRun(job), state(job), job.Command)
+	}
+	return w.Flush()
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func nextRun(job cron.JobStatus, now time.Time) string {
+	if job.NextRun == nil {
+		return "-"
+	}
+	return job.NextRun.Local().Format("2006-01-02 15:04:05") + " (in " + job.NextRun.Sub(now).Truncate(time.Second).String() + ")"
+}
+
+func lastRun(job cron.JobStatus) string {
+	if job.LastRun == nil {
+		return "-"
+	}
+
+	result := "ok"
+	if !job.LastRun.Succeeded {
+		result = "failed (" + strconv.Itoa(job.LastRun.ExitCode) + ")"
+	}
+	return result + " at " + job.LastRun.FinishedAt.Local().Format("2006-01-02 15:04:05")
+}
+
+func state(job cron.JobStatus) string {
+	switch {
+	case job.Running > 0:
+		return "running"
+	case job.Tripped:
+		return "tripped"
+	case job.Paused:
+		return "paused"
+	case job.Waiting > 0:
+		return "waiting"
+	}
+	return "idle"
+}
+
+// trigger returns the job's exit status, like `supercronic trigger`.
+func (c *command) trigger(args []string) int {
+	name, err := job(args)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "trigger: %v\n", err)
+		return 2
+	}
+
+	result, err := admin.Trigger(c.addr, "", name, c.stdout, c.stderr)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "could not trigger job: %v\n", err)
+		return 1
+	}
+
+	if result.Error == "" {
+		return 0
+	}
+
+	fmt.Fprintf(c.stderr, "job failed: %s\n", result.Error)
+
+	if result.ExitCode > 0 {
+		return result.ExitCode
+	}
+	return 1
+}
+
+func (c *command) control(action string, args []string) error {
+	name, err := job(args)
+	if err != nil {
+		return err
+	}
+
+	status, err := admin.Control(c.addr, "", name, action)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stdout, "job %d (%s): %s\n", status.ID, orDash(status.Name), state(*status))
+	return nil
+}
+
+func (c *command) reload(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+
+	if err := admin.Reload(c.addr, ""); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(c.stdout, "reloading crontab")
+	return nil
+}
+
+func (c *command) tail(args []string) error {
+	flags := flag.NewFlagSet("tail", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	follow := flags.Bool("f", false, "keep showing the output of later runs")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	name, err := job(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	return admin.Tail(c.addr, name, *follow, c.stdout, c.stderr)
+}
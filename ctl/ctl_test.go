@@ -0,0 +1,124 @@
+package ctl
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"supercronic/admin"
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+type hourlyExpression struct{}
+
+func (e hourlyExpression) Next(t time.Time) time.Time {
+	return t.Add(time.Hour)
+}
+
+func TestCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-ctl-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "supercronic.sock")
+
+	logger := logrus.NewEntry(logrus.New())
+	logger.Logger.Out = ioutil.Discard
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	defer wg.Wait()
+	defer cancel()
+
+	job := &crontab.Job{
+		CrontabLine: crontab.CrontabLine{
+			Expression: hourlyExpression{},
+			Schedule:   "@hourly",
+			Command:    "echo hello; echo oops >&2; exit 3",
+		},
+		Name: "backup",
+	}
+
+	cronCtx := &crontab.Context{Shell: "/bin/sh", Environ: map[string]string{}}
+
+	registry := cron.NewRegistry()
+	registry.Add(cron.StartJob(&wg, cronCtx, job, ctx, logger, cron.Options{}))
+
+	reloads := make(chan struct{}, 1)
+
+	server := admin.NewServer(registry, nil, logger)
+	// The control socket doesn't need the token.
+	server.SetToken("secret")
+	server.SetReloader(func() { reloads <- struct{}{} })
+
+	listener, err := server.ListenAndServeUnix(socket)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer listener.Close()
+
+	info, err := os.Stat(socket)
+	if assert.Nil(t, err) {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	_, err = server.ListenAndServeUnix(socket)
+	assert.NotNil(t, err)
+
+	ctlMain := func(args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		status := Main(Name, append([]string{"-socket", socket}, args...), &stdout, &stderr)
+		return status, stdout.String(), stderr.String()
+	}
+
+	status, stdout, stderr := ctlMain("trigger", "backup")
+	assert.Equal(t, 3, status)
+	assert.Equal(t, "hello\n", stdout)
+	assert.Contains(t, stderr, "oops\n")
+	assert.Contains(t, stderr, "job failed: ")
+
+	status, stdout, _ = ctlMain("tail", "backup")
+	assert.Equal(t, 0, status)
+	assert.Equal(t, "hello\n", stdout)
+
+	status, stdout, _ = ctlMain("pause", "backup")
+	assert.Equal(t, 0, status)
+	assert.Equal(t, "job 0 (backup): paused\n", stdout)
+	assert.True(t, registry.Job(0).IsPaused())
+
+	status, stdout, _ = ctlMain("status")
+	assert.Equal(t, 0, status)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.Regexp(t, `^ID +NAME +SCHEDULE +NEXT RUN +LAST RUN +STATE +COMMAND$`, lines[0])
+		assert.Regexp(t, `^0 +backup +@hourly +.+ +failed \(3\) at .+ +paused +echo hello`, lines[1])
+	}
+
+	status, stdout, _ = ctlMain("reload")
+	assert.Equal(t, 0, status)
+	assert.Equal(t, "reloading crontab\n", stdout)
+	select {
+	case <-reloads:
+	default:
+		t.Errorf("crontab wasn't reloaded")
+	}
+
+	status, _, stderr = ctlMain("pause", "nope")
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr, "no such job: nope")
+
+	status, _, stderr = ctlMain("explode")
+	assert.Equal(t, 2, status)
+	assert.Contains(t, stderr, "unknown command: explode")
+}
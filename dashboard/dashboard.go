@@ -0,0 +1,398 @@
+// Package dashboard implements `supercronic top`: an interactive view of the
+// jobs of a running supercronic, per its admin API, that shows when they run
+// next, how their last run went, and the output of the selected job.
+package dashboard
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+
+	"supercronic/admin"
+	"supercronic/cron"
+	"supercronic/platform"
+)
+
+// Terminal escape sequences.
+const (
+	enterScreen = "\x1b[?1049h\x1b[?25l"
+	leaveScreen = "\x1b[?25h\x1b[?1049l"
+	clearScreen = "\x1b[H\x1b[2J"
+	reverse     = "\x1b[7m"
+	red         = "\x1b[31m"
+	reset       = "\x1b[0m"
+)
+
+// Size of the terminal, if it can't be determined.
+const (
+	defaultWidth  = 80
+	defaultHeight = 24
+)
+
+// dashboard is what is shown: the jobs, and the output of the selected one.
+type dashboard struct {
+	jobs []cron.JobStatus
+	// selected is the ID of the selected job.
+	selected int
+	output   *admin.OutputResponse
+	// err is why the dashboard couldn't be refreshed, if it couldn't.
+	err error
+}
+
+// Run shows the dashboard of the supercronic whose admin API is at addr on
+// terminal, refreshed every interval, until the user quits (or the first
+// refresh fails).
+func Run(addr string, interval time.Duration, terminal *os.File) error {
+	d := &dashboard{selected: -1}
+
+	if err := d.refresh(addr, defaultHeight); err != nil {
+		return err
+	}
+
+	// Without raw mode (e.g. on other platforms), keys only reach us once
+	// Enter is pressed, which is good enough.
+	if restore, err := platform.MakeTerminalRaw(terminal.Fd()); err == nil {
+		defer restore()
+	}
+
+	terminal.WriteString(enterScreen)
+	defer terminal.WriteString(leaveScreen)
+
+	keys := make(chan string)
+	go readKeys(terminal, keys)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGWINCH)
+	defer signal.Stop(signals)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		width, height, err := platform.TerminalSize(terminal.Fd())
+		if err != nil || width <= 0 || height <= 0 {
+			width, height = defaultWidth, defaultHeight
+		}
+
+		terminal.Write(d.render(time.Now(), width, height))
+
+		select {
+		case key, ok := <-keys:
+			if !ok || key == "q" {
+				return nil
+			}
+			d.handleKey(key)
+			d.refresh(addr, height)
+		case sig := <-signals:
+			if sig != syscall.SIGWINCH {
+				return nil
+			}
+		case <-ticker.C:
+			d.refresh(addr, height)
+		}
+	}
+}
+
+// readKeys sends the keys read from terminal to keys, until it can't be read
+// anymore.
+func readKeys(terminal *os.File, keys chan<- string) {
+	defer close(keys)
+
+	buf := make([]byte, 64)
+	for {
+		n, err := terminal.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, key := range parseKeys(buf[:n]) {
+			keys <- key
+		}
+	}
+}
+
+// parseKeys splits input into keys: arrows are named up and down, and other
+// keys are returned as is.
+func parseKeys(input []byte) []string {
+	keys := make([]string, 0)
+
+	for len(input) > 0 {
+		if bytes.HasPrefix(input, []byte("\x1b[A")) || bytes.HasPrefix(input, []byte("\x1bOA")) {
+			keys = append(keys, "up")
+			input = input[3:]
+			continue
+		}
+		if bytes.HasPrefix(input, []byte("\x1b[B")) || bytes.HasPrefix(input, []byte("\x1bOB")) {
+			keys = append(keys, "down")
+			input = input[3:]
+			continue
+		}
+
+		keys = append(keys, string(input[:1]))
+		input = input[1:]
+	}
+
+	return keys
+}
+
+func (d *dashboard) handleKey(key string) {
+	i := d.selectedIndex()
+	if i < 0 {
+		return
+	}
+
+	switch key {
+	case "up", "k":
+		if i > 0 {
+			i--
+		}
+	case "down", "j":
+		if i < len(d.jobs)-1 {
+			i++
+		}
+	}
+
+	if d.selected != d.jobs[i].ID {
+		d.selected = d.jobs[i].ID
+		d.output = nil
+	}
+}
+
+// selectedIndex returns the index of the selected job among d.jobs, or -1 if
+// there are no jobs.
+func (d *dashboard) selectedIndex() int {
+	for i, job := range d.jobs {
+		if job.ID == d.selected {
+			return i
+		}
+	}
+
+	// The selected job may be gone, e.g. after the crontab was reloaded.
+	if len(d.jobs) > 0 {
+		d.selected = d.jobs[0].ID
+		return 0
+	}
+
+	return -1
+}
+
+// refresh fetches the jobs, and as many lines of output of the selected one
+// as may fit in a terminal that's height lines high.
+func (d *dashboard) refresh(addr string, height int) error {
+	jobs, err := admin.Jobs(addr)
+	if err != nil {
+		d.err = err
+		return err
+	}
+	d.jobs = jobs
+
+	if i := d.selectedIndex(); i >= 0 {
+		output, err := admin.JobOutput(addr, strconv.Itoa(d.selected), height)
+		if err != nil {
+			d.err = err
+			return err
+		}
+		d.output = output
+	}
+
+	d.err = nil
+	return nil
+}
+
+// render returns the escape sequences that draw the dashboard, as of now,
+// on a terminal of the given size.
+func (d *dashboard) render(now time.Time, width int, height int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(clearScreen)
+
+	lines := 0
+	line := func(prefix string, text string) {
+		if lines < height {
+			if lines > 0 {
+				buf.WriteString("\r\n")
+			}
+			buf.WriteString(prefix)
+			buf.WriteString(truncate(sanitize(text), width))
+			if prefix != "" {
+				buf.WriteString(reset)
+			}
+			lines++
+		}
+	}
+
+	status := fmt.Sprintf("supercronic: %d job(s), %s", len(d.jobs), now.Format("15:04:05"))
+	if d.err != nil {
+		status += fmt.Sprintf(" (refresh failed: %v)", d.err)
+	}
+	line(reverse, pad(status+"  [up/down] select  [q] quit", width))
+
+	rows := [][]string{{"ID", "SCHEDULE", "NEXT RUN", "LAST RUN", "DURATION", "STATE", "JOB"}}
+	for _, job := range d.jobs {
+		rows = append(rows, jobRow(job, now))
+	}
+
+	selected := d.selectedIndex()
+	for i, row := range formatTable(rows) {
+		if i == selected+1 {
+			line(reverse, pad(row, width))
+		} else {
+			line("", row)
+		}
+	}
+
+	if selected < 0 {
+		return buf.Bytes()
+	}
+
+	title := "output of " + jobLabel(d.jobs[selected])
+	if d.output != nil && d.output.StartedAt != nil {
+		verb := "last run, started"
+		if d.output.Running {
+			verb = "running since"
+		}
+		title += fmt.Sprintf(" (%s %s)", verb, d.output.StartedAt.Local().Format("15:04:05"))
+	}
+	line("", "")
+	line(reverse, pad(title, width))
+
+	if d.output == nil {
+		return buf.Bytes()
+	}
+
+	// Show the end of the output, i.e. as much as fits after what's above.
+	output := d.output.Lines
+	if room := height - lines; len(output) > room {
+		output = output[len(output)-room:]
+	}
+
+	for _, event := range output {
+		if event.Channel == "stderr" {
+			line(red, event.Text)
+		} else {
+			line("", event.Text)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// jobLabel identifies job by name if it has one, and by command otherwise.
+func jobLabel(job cron.JobStatus) string {
+	if job.Name != "" {
+		return job.Name
+	}
+	return job.Command
+}
+
+func jobRow(job cron.JobStatus, now time.Time) []string {
+	next := "-"
+	if job.NextRun != nil {
+		next = "in " + formatDuration(job.NextRun.Sub(now))
+	}
+
+	last, duration := "-", "-"
+	if job.LastRun != nil {
+		switch {
+		case job.LastRun.Succeeded:
+			last = "ok"
+		case strings.HasPrefix(job.LastRun.Error, "skipped:"):
+			last = "skipped"
+		case job.LastRun.ExitCode > 0:
+			last = fmt.Sprintf("failed (%d)", job.LastRun.ExitCode)
+		default:
+			last = "failed"
+		}
+		last += " " + formatDuration(now.Sub(job.LastRun.FinishedAt)) + " ago"
+		duration = formatDuration(job.LastRun.FinishedAt.Sub(job.LastRun.StartedAt))
+	}
+
+	state := "idle"
+	switch {
+	case job.RunningSince != nil:
+		state = "running " + formatDuration(now.Sub(*job.RunningSince))
+	case job.Tripped:
+		state = "tripped"
+	case job.Paused:
+		state = "paused"
+	case job.Waiting > 0:
+		state = "waiting"
+	}
+
+	label := jobLabel(job)
+	if job.Name != "" {
+		label += ": " + job.Command
+	}
+
+	return []string{strconv.Itoa(job.ID), job.Schedule, next, last, duration, state, label}
+}
+
+// formatDuration formats d to the second, e.g. 1m5s.
+func formatDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	return d.Truncate(time.Second).String()
+}
+
+// formatTable aligns the columns of rows. The last column isn't padded.
+func formatTable(rows [][]string) []string {
+	widths := make([]int, 0)
+	for _, row := range rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := len([]rune(cell)); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			if i < len(row)-1 {
+				cell = pad(cell, widths[i])
+			}
+			cells[i] = cell
+		}
+		lines = append(lines, strings.Join(cells, "  "))
+	}
+
+	return lines
+}
+
+// sanitize drops control characters from text (e.g. from job output), which
+// would mess up the dashboard. Tabs become spaces.
+func sanitize(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return ' '
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+func truncate(text string, width int) string {
+	runes := []rune(text)
+	if len(runes) > width {
+		runes = runes[:width]
+	}
+	return string(runes)
+}
+
+func pad(text string, width int) string {
+	if n := len([]rune(text)); n < width {
+		return text + strings.Repeat(" ", width-n)
+	}
+	return truncate(text, width)
+}
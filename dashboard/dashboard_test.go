@@ -0,0 +1,85 @@
+package dashboard
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"supercronic/admin"
+	"supercronic/cron"
+)
+
+func TestParseKeys(t *testing.T) {
+	assert.Equal(t, []string{"up", "down", "j", "q"}, parseKeys([]byte("\x1b[A\x1bOBjq")))
+	assert.Equal(t, []string{}, parseKeys([]byte{}))
+}
+
+func TestJobRow(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+	next := now.Add(65 * time.Second)
+	since := now.Add(-3 * time.Second)
+
+	assert.Equal(t, []string{"0", "@hourly", "in 1m5s", "-", "-", "idle", "true"}, jobRow(cron.JobStatus{
+		ID:       0,
+		Schedule: "@hourly",
+		Command:  "true",
+		NextRun:  &next,
+	}, now))
+
+	assert.Equal(t, []string{"1", "* * * * *", "-", "failed (3) 10s ago", "2s", "running 3s", "backup: backup.sh"}, jobRow(cron.JobStatus{
+		ID:           1,
+		Name:         "backup",
+		Schedule:     "* * * * *",
+		Command:      "backup.sh",
+		RunningSince: &since,
+		LastRun: &cron.RunStatus{
+			StartedAt:  now.Add(-12 * time.Second),
+			FinishedAt: now.Add(-10 * time.Second),
+			ExitCode:   3,
+			Error:      "exit status 3",
+		},
+	}, now))
+}
+
+func TestRender(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.Local)
+
+	d := &dashboard{
+		jobs: []cron.JobStatus{
+			{ID: 0, Schedule: "@hourly", Command: "true"},
+			{ID: 1, Schedule: "@daily", Command: "backup.sh", Name: "backup"},
+		},
+		selected: 1,
+		output: &admin.OutputResponse{
+			StartedAt: &now,
+			Running:   true,
+			Lines: []admin.RunEvent{
+				{Channel: "stdout", Text: "one"},
+				{Channel: "stderr", Text: "two\tthree\x07"},
+				{Channel: "stdout", Text: "four"},
+			},
+		},
+	}
+
+	screen := string(d.render(now, 40, 8))
+	lines := strings.Split(strings.TrimPrefix(screen, clearScreen), "\r\n")
+
+	assert.Equal(t, []string{
+		reverse + "supercronic: 2 job(s), 12:00:00  [up/dow" + reset,
+		"ID  SCHEDULE  NEXT RUN  LAST RUN  DURATI",
+		"0   @hourly   -         -         -     ",
+		reverse + "1   @daily    -         -         -     " + reset,
+		"",
+		reverse + "output of backup (running since 12:00:00" + reset,
+		red + "two three" + reset,
+		"four",
+	}, lines)
+
+	d.handleKey("up")
+	assert.Equal(t, 0, d.selected)
+	assert.Nil(t, d.output)
+
+	d.handleKey("up")
+	assert.Equal(t, 0, d.selected)
+}
@@ -0,0 +1,101 @@
+// Package docker runs jobs in Docker containers (see crontab.Container) using
+// the docker CLI, so that one supercronic can schedule jobs for the containers
+// of several services.
+package docker
+
+import (
+	"fmt"
+	"strings"
+
+	"supercronic/crontab"
+)
+
+// The docker CLI, looked up in $PATH unless it is a path.
+var DOCKER_COMMAND = "docker"
+
+// Command returns the command that runs argv in container, in dir (unless it
+// is empty), with limits (which may be nil) applied to new containers. If
+// stdin is set, the command's stdin is passed on to argv.
+//
+// The container gets the variables in env (given as KEY=VALUE) and no others.
+// Only their names are passed to the docker CLI as arguments, so the CLI must
+// run with env: that way, its command line doesn't show their values.
+func Command(container *crontab.Container, argv []string, env []string, dir string, limits *crontab.Limits, stdin bool) []string {
+	args := []string{DOCKER_COMMAND}
+
+	if container.Exec != "" {
+		args = append(args, "exec")
+	} else {
+		args = append(args, "run", "--rm")
+
+		if container.Network != "" {
+			args = append(args, "--network", container.Network)
+		}
+
+		for _, mount := range container.Mounts {
+			args = append(args, "--volume", mount)
+		}
+
+		if limits != nil {
+			args = append(args, limitArgs(limits)...)
+		}
+	}
+
+	if stdin {
+		args = append(args, "--interactive")
+	}
+
+	if container.User != "" {
+		args = append(args, "--user", container.User)
+	}
+
+	if dir != "" {
+		args = append(args, "--workdir", dir)
+	}
+
+	for _, name := range envNames(env) {
+		args = append(args, "--env", name)
+	}
+
+	if container.Exec != "" {
+		args = append(args, container.Exec)
+	} else {
+		args = append(args, container.Image)
+	}
+
+	return append(args, argv...)
+}
+
+func limitArgs(limits *crontab.Limits) []string {
+	var args []string
+
+	if limits.Memory > 0 {
+		args = append(args, "--memory", fmt.Sprintf("%d", limits.Memory))
+	}
+
+	if limits.CPU > 0 {
+		args = append(args, "--cpus", fmt.Sprintf("%g", limits.CPU))
+	}
+
+	if limits.NoFile > 0 {
+		args = append(args, "--ulimit", fmt.Sprintf("nofile=%d:%d", limits.NoFile, limits.NoFile))
+	}
+
+	return args
+}
+
+// envNames returns the names of the variables in env, once each.
+func envNames(env []string) []string {
+	seen := make(map[string]bool)
+	names := make([]string, 0, len(env))
+
+	for _, kv := range env {
+		name := strings.SplitN(kv, "=", 2)[0]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,55 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"supercronic/crontab"
+)
+
+func TestCommandRun(t *testing.T) {
+	container := &crontab.Container{
+		Image:   "alpine:3.19",
+		Network: "backend",
+		Mounts:  []string{"/data:/data:ro", "cache:/cache"},
+	}
+
+	limits := &crontab.Limits{Memory: 512 * 1024 * 1024, CPU: 0.5, NoFile: 1024}
+	env := []string{"SHELL=/bin/sh", "DB_PASS=hunter2", "DB_PASS=swordfish"}
+
+	assert.Equal(t, []string{
+		"docker", "run", "--rm",
+		"--network", "backend",
+		"--volume", "/data:/data:ro",
+		"--volume", "cache:/cache",
+		"--memory", "536870912",
+		"--cpus", "0.5",
+		"--ulimit", "nofile=1024:1024",
+		"--workdir", "/srv",
+		"--env", "SHELL",
+		"--env", "DB_PASS",
+		"alpine:3.19", "/bin/sh", "-c", "backup.sh",
+	}, Command(container, []string{"/bin/sh", "-c", "backup.sh"}, env, "/srv", limits, false))
+}
+
+func TestCommandExec(t *testing.T) {
+	container := &crontab.Container{Exec: "app", User: "www-data"}
+
+	assert.Equal(t, []string{
+		"docker", "exec",
+		"--user", "www-data",
+		"--env", "APP_ENV",
+		"app", "php", "artisan", "schedule:run",
+	}, Command(container, []string{"php", "artisan", "schedule:run"}, []string{"APP_ENV=production"}, "", nil, false))
+}
+
+func TestCommandWithStdin(t *testing.T) {
+	container := &crontab.Container{Exec: "db"}
+
+	assert.Equal(t, []string{
+		"docker", "exec",
+		"--interactive",
+		"db", "psql",
+	}, Command(container, []string{"psql"}, nil, "", nil, true))
+}
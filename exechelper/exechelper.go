@@ -0,0 +1,141 @@
+// Package exechelper runs jobs through a re-execution of supercronic itself,
+// which applies settings that os/exec can't (e.g. resource limits, priorities,
+// or the umask) to its own process before exec'ing the job.
+package exechelper
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+
+	"supercronic/crontab"
+	"supercronic/platform"
+)
+
+// helperArg is passed as the first argument when supercronic runs as a helper.
+const helperArg = "__supercronic_exec_helper"
+
+type spec struct {
+	Limits   crontab.Limits
+	Priority crontab.Priority
+	Umask    *os.FileMode
+	Cgroup   string
+	Argv     []string
+}
+
+var cgroupCounter uint64
+
+// IsHelper reports whether the current process was started as a helper, in
+// which case main should call Main right away.
+func IsHelper() bool {
+	return len(os.Args) > 2 && os.Args[1] == helperArg
+}
+
+// Main applies the settings it was passed and execs the job. It only returns
+// if that fails, in which case it exits with status 127, like a shell does
+// when a command can't be run.
+func Main() {
+	err := run(os.Args[2])
+	fmt.Fprintf(os.Stderr, "supercronic: %v\n", err)
+	os.Exit(127)
+}
+
+func run(encoded string) error {
+	s := &spec{}
+	if err := json.Unmarshal([]byte(encoded), s); err != nil {
+		return fmt.Errorf("invalid helper arguments: %v", err)
+	}
+
+	// On Linux, priorities are per thread: they must be set on the thread
+	// that execs the job.
+	runtime.LockOSThread()
+
+	if s.Cgroup != "" {
+		if err := platform.JoinCgroup(s.Cgroup); err != nil {
+			return fmt.Errorf("could not join cgroup %s: %v", s.Cgroup, err)
+		}
+	}
+
+	if s.Limits.NoFile > 0 {
+		if err := platform.SetOpenFilesLimit(s.Limits.NoFile); err != nil {
+			return fmt.Errorf("could not set nofile limit: %v", err)
+		}
+	}
+
+	// When running in a cgroup, its memory limit is much more accurate than
+	// limiting the address space.
+	if s.Limits.Memory > 0 && s.Cgroup == "" {
+		if err := platform.SetMemoryLimit(s.Limits.Memory); err != nil {
+			return fmt.Errorf("could not set mem limit: %v", err)
+		}
+	}
+
+	if s.Priority.Nice != 0 {
+		if err := platform.SetNice(s.Priority.Nice); err != nil {
+			return fmt.Errorf("could not set nice: %v", err)
+		}
+	}
+
+	if s.Priority.IOClass != "" {
+		if err := platform.SetIOPriority(string(s.Priority.IOClass), s.Priority.IOLevel); err != nil {
+			return fmt.Errorf("could not set I/O priority: %v", err)
+		}
+	}
+
+	if s.Umask != nil {
+		syscall.Umask(int(*s.Umask))
+	}
+
+	path, err := exec.LookPath(s.Argv[0])
+	if err != nil {
+		return err
+	}
+
+	return syscall.Exec(path, s.Argv, os.Environ())
+}
+
+// Command returns a Cmd that runs argv with limits, priority, and umask (any
+// of which may be nil) applied. If cgroupParent is set, the job runs in a
+// dedicated cgroup under it, which enforces the memory and CPU limits.
+// Otherwise, the CPU limit is ignored.
+//
+// cleanup must be called once the command has exited.
+func Command(argv []string, limits *crontab.Limits, priority *crontab.Priority, umask *os.FileMode, cgroupParent string) (cmd *exec.Cmd, cleanup func() error, err error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not locate supercronic executable: %v", err)
+	}
+
+	s := &spec{Argv: argv, Umask: umask}
+	if limits != nil {
+		s.Limits = *limits
+	}
+	if priority != nil {
+		s.Priority = *priority
+	}
+	cleanup = func() error { return nil }
+
+	if cgroupParent != "" && (s.Limits.Memory > 0 || s.Limits.CPU > 0) {
+		name := fmt.Sprintf("supercronic-%d-%d", os.Getpid(), atomic.AddUint64(&cgroupCounter, 1))
+
+		path, err := platform.CreateCgroup(cgroupParent, name, s.Limits.Memory, s.Limits.CPU)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not create cgroup: %v", err)
+		}
+
+		s.Cgroup = path
+		cleanup = func() error { return platform.RemoveCgroup(path) }
+	}
+
+	encoded, err := json.Marshal(s)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	return exec.Command(self, helperArg, string(encoded)), cleanup, nil
+}
@@ -0,0 +1,162 @@
+package exechelper
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"supercronic/crontab"
+)
+
+// Command re-executes the current binary, i.e. the test binary here.
+func TestMain(m *testing.M) {
+	if IsHelper() {
+		Main()
+	}
+	os.Exit(m.Run())
+}
+
+func runWithLimits(t *testing.T, command string, limits *crontab.Limits, cgroupParent string) (string, error) {
+	cmd, cleanup, err := Command([]string{"/bin/sh", "-c", command}, limits, nil, nil, cgroupParent)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	out, err := cmd.CombinedOutput()
+	return strings.TrimSpace(string(out)), err
+}
+
+func TestCommandSetsOpenFilesLimit(t *testing.T) {
+	out, err := runWithLimits(t, "ulimit -n", &crontab.Limits{NoFile: 64}, "")
+	assert.Nil(t, err, out)
+	assert.Equal(t, "64", out)
+}
+
+func TestCommandSetsMemoryLimit(t *testing.T) {
+	if runtime.GOOS == "openbsd" {
+		t.Skip("memory limits use RLIMIT_DATA on OpenBSD")
+	}
+
+	out, err := runWithLimits(t, "ulimit -v", &crontab.Limits{Memory: 512 << 20}, "")
+	assert.Nil(t, err, out)
+	assert.Equal(t, "524288", out)
+}
+
+func runWithPriority(t *testing.T, command string, priority *crontab.Priority) (string, error) {
+	cmd, cleanup, err := Command([]string{"/bin/sh", "-c", command}, nil, priority, nil, "")
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	out, err := cmd.CombinedOutput()
+	return strings.TrimSpace(string(out)), err
+}
+
+func TestCommandSetsNice(t *testing.T) {
+	out, err := runWithPriority(t, "nice", &crontab.Priority{Nice: 5})
+	assert.Nil(t, err, out)
+	assert.Equal(t, "5", out)
+}
+
+func TestCommandSetsIOPriority(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("I/O priorities are only supported on Linux")
+	}
+
+	if _, err := exec.LookPath("ionice"); err != nil {
+		t.Skip("ionice is not installed")
+	}
+
+	out, err := runWithPriority(t, "ionice", &crontab.Priority{IOClass: crontab.IOBestEffort, IOLevel: 7})
+	assert.Nil(t, err, out)
+	assert.Equal(t, "best-effort: prio 7", out)
+
+	out, err = runWithPriority(t, "ionice", &crontab.Priority{IOClass: crontab.IOIdle})
+	assert.Nil(t, err, out)
+	assert.Equal(t, "idle", out)
+}
+
+func TestCommandSetsUmask(t *testing.T) {
+	umask := os.FileMode(027)
+
+	cmd, cleanup, err := Command([]string{"/bin/sh", "-c", "umask"}, nil, nil, &umask, "")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer cleanup()
+
+	out, err := cmd.CombinedOutput()
+	assert.Nil(t, err, string(out))
+	assert.Equal(t, "0027", strings.TrimSpace(string(out)))
+}
+
+func TestCommandPassesArgumentsAndEnvironment(t *testing.T) {
+	os.Setenv("EXECHELPER_TEST", "it's \"quoted\"")
+	defer os.Unsetenv("EXECHELPER_TEST")
+
+	out, err := runWithLimits(t, "echo \"$EXECHELPER_TEST\"; exit 3", &crontab.Limits{NoFile: 64}, "")
+	assert.NotNil(t, err)
+	assert.Equal(t, "it's \"quoted\"", out)
+}
+
+func TestCommandReportsHelperErrors(t *testing.T) {
+	cmd, cleanup, err := Command([]string{"/does/not/exist"}, &crontab.Limits{NoFile: 64}, nil, nil, "")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer cleanup()
+
+	out, err := cmd.CombinedOutput()
+	assert.NotNil(t, err)
+	assert.Contains(t, string(out), "supercronic: ")
+}
+
+func TestCommandUsesCgroup(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("cgroups are only supported on Linux")
+	}
+
+	// Fake a cgroup hierarchy: this exercises the plumbing, but not the
+	// kernel's enforcement of limits.
+	parent, err := ioutil.TempDir("", "supercronic-cgroup")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(parent)
+
+	cmd, cleanup, err := Command([]string{"/bin/true"}, &crontab.Limits{Memory: 1 << 30, CPU: 0.5}, nil, nil, parent)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(parent, "supercronic-*"))
+	if assert.Len(t, matches, 1) {
+		memory, _ := ioutil.ReadFile(filepath.Join(matches[0], "memory.max"))
+		assert.Equal(t, "1073741824", string(memory))
+
+		cpu, _ := ioutil.ReadFile(filepath.Join(matches[0], "cpu.max"))
+		assert.Equal(t, "50000 100000", string(cpu))
+	}
+
+	out, err := cmd.CombinedOutput()
+	assert.Nil(t, err, string(out))
+
+	if len(matches) == 1 {
+		procs, _ := ioutil.ReadFile(filepath.Join(matches[0], "cgroup.procs"))
+		assert.NotEmpty(t, string(procs))
+		os.Remove(filepath.Join(matches[0], "cgroup.procs"))
+		os.Remove(filepath.Join(matches[0], "memory.max"))
+		os.Remove(filepath.Join(matches[0], "cpu.max"))
+	}
+
+	assert.Nil(t, cleanup())
+	matches, _ = filepath.Glob(filepath.Join(parent, "supercronic-*"))
+	assert.Empty(t, matches)
+}
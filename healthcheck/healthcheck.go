@@ -0,0 +1,81 @@
+package healthcheck
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"supercronic/cron"
+)
+
+// Timeout for each ping. Pings are sent inline with the job, so this bounds
+// how much they can delay it.
+var PING_TIMEOUT = 10 * time.Second
+
+// Maximum size of the request body sent along with pings. The tail of the
+// job's output is kept.
+var MAX_PING_BODY_SIZE = 10 * 1024
+
+// Hook pings the URL set via the `healthcheck` directive when a job starts,
+// succeeds or fails, following the healthchecks.io protocol: URL/start, URL,
+// and URL/fail, respectively. This lets the monitoring service alert when a
+// job fails, but also when it does not run at all.
+type Hook struct {
+	client *http.Client
+}
+
+func NewHook() *Hook {
+	return &Hook{client: &http.Client{Timeout: PING_TIMEOUT}}
+}
+
+func (h *Hook) JobStarted(e *cron.Execution) {
+	if e.Job.Healthcheck == "" {
+		return
+	}
+
+	h.ping(e, pingURL(e.Job.Healthcheck, "start"), "")
+}
+
+func (h *Hook) JobFinished(e *cron.Execution) {
+	if e.Job.Healthcheck == "" {
+		return
+	}
+
+	if e.Err == nil {
+		body := fmt.Sprintf("job succeeded in %v\n", e.Duration())
+		h.ping(e, e.Job.Healthcheck, body)
+		return
+	}
+
+	body := fmt.Sprintf("%s\njob failed after %v: %v\n", e.Output.String(), e.Duration(), e.Err)
+	h.ping(e, pingURL(e.Job.Healthcheck, "fail"), body)
+}
+
+func (h *Hook) ping(e *cron.Execution, url string, body string) {
+	if len(body) > MAX_PING_BODY_SIZE {
+		body = body[len(body)-MAX_PING_BODY_SIZE:]
+	}
+
+	resp, err := h.client.Post(url, "text/plain; charset=utf-8", strings.NewReader(body))
+	if err != nil {
+		e.Logger.Warnf("failed to ping healthcheck: %v", err)
+		return
+	}
+
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		e.Logger.Warnf("failed to ping healthcheck: %s returned %s", url, resp.Status)
+		return
+	}
+
+	e.Logger.Debugf("pinged healthcheck: %s", url)
+}
+
+func pingURL(base string, suffix string) string {
+	return strings.TrimRight(base, "/") + "/" + suffix
+}
@@ -0,0 +1,130 @@
+package healthcheck
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+type ping struct {
+	path string
+	body string
+}
+
+func startTestServer(t *testing.T) (*httptest.Server, chan ping) {
+	pings := make(chan ping, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, "POST", r.Method)
+		pings <- ping{path: r.URL.Path, body: string(body)}
+	}))
+
+	return server, pings
+}
+
+func newTestExecution(healthcheck string, err error, lines ...string) *cron.Execution {
+	output := &cron.Output{}
+	for _, line := range lines {
+		output.Append("stdout", line)
+	}
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	startedAt := time.Now()
+
+	return &cron.Execution{
+		Job: &crontab.Job{
+			CrontabLine: crontab.CrontabLine{Schedule: "* * * * *", Command: "echo hello"},
+			Healthcheck: healthcheck,
+		},
+		Context:    &crontab.Context{Shell: "/bin/sh", Environ: map[string]string{}},
+		Logger:     logrus.NewEntry(logger),
+		StartedAt:  startedAt,
+		FinishedAt: startedAt.Add(3 * time.Second),
+		Err:        err,
+		Output:     output,
+	}
+}
+
+func expectPing(t *testing.T, pings chan ping) ping {
+	select {
+	case p := <-pings:
+		return p
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for ping")
+		return ping{}
+	}
+}
+
+func TestHookPingsStartAndSuccess(t *testing.T) {
+	server, pings := startTestServer(t)
+	defer server.Close()
+
+	hook := NewHook()
+	e := newTestExecution(server.URL+"/1234", nil, "hello")
+
+	hook.JobStarted(e)
+	p := expectPing(t, pings)
+	assert.Equal(t, "/1234/start", p.path)
+
+	hook.JobFinished(e)
+	p = expectPing(t, pings)
+	assert.Equal(t, "/1234", p.path)
+	assert.Equal(t, "job succeeded in 3s\n", p.body)
+}
+
+func TestHookPingsFailureWithOutput(t *testing.T) {
+	server, pings := startTestServer(t)
+	defer server.Close()
+
+	hook := NewHook()
+	hook.JobFinished(newTestExecution(server.URL+"/1234/", errors.New("exit status 1"), "oops"))
+
+	p := expectPing(t, pings)
+	assert.Equal(t, "/1234/fail", p.path)
+	assert.Contains(t, p.body, "oops\n")
+	assert.Contains(t, p.body, "job failed after 3s: exit status 1")
+}
+
+func TestHookTruncatesBody(t *testing.T) {
+	defer func(size int) { MAX_PING_BODY_SIZE = size }(MAX_PING_BODY_SIZE)
+	MAX_PING_BODY_SIZE = 20
+
+	server, pings := startTestServer(t)
+	defer server.Close()
+
+	hook := NewHook()
+	hook.JobFinished(newTestExecution(server.URL, errors.New("boom"), strings.Repeat("a", 100)))
+
+	p := expectPing(t, pings)
+	assert.Equal(t, 20, len(p.body))
+	assert.True(t, strings.HasSuffix(p.body, "boom\n"))
+}
+
+func TestHookIgnoresJobsWithoutHealthcheck(t *testing.T) {
+	server, pings := startTestServer(t)
+	defer server.Close()
+
+	hook := NewHook()
+	e := newTestExecution("", errors.New("boom"))
+	hook.JobStarted(e)
+	hook.JobFinished(e)
+
+	select {
+	case <-pings:
+		t.Errorf("unexpected ping")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
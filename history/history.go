@@ -0,0 +1,196 @@
+// Package history persists a record of every job execution in an embedded
+// bbolt database, so that it survives restarts.
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+// Maximum number of records kept for each job. Older records are pruned.
+var MAX_RECORDS_PER_JOB = 100
+
+var jobsBucket = []byte("jobs")
+
+// Record describes a past execution of a job.
+type Record struct {
+	ScheduledAt time.Time `json:"scheduled_at"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	Duration    float64   `json:"duration_seconds"`
+	ExitCode    int       `json:"exit_code"`
+	Succeeded   bool      `json:"succeeded"`
+	Error       string    `json:"error,omitempty"`
+}
+
+type Store struct {
+	db *bolt.DB
+}
+
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(jobsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) Add(job *crontab.Job, record *Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(jobsBucket).CreateBucketIfNotExists([]byte(job.Key()))
+		if err != nil {
+			return err
+		}
+
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		if err := bucket.Put(sequenceKey(seq), data); err != nil {
+			return err
+		}
+
+		// Records are keyed by sequence, so the oldest come first.
+		keys := make([][]byte, 0)
+		cursor := bucket.Cursor()
+		for k, _ := cursor.First(); k != nil; k, _ = cursor.Next() {
+			keys = append(keys, k)
+		}
+
+		for i := 0; i < len(keys)-MAX_RECORDS_PER_JOB; i++ {
+			if err := bucket.Delete(keys[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// History returns up to limit records for job, most recent first. A limit of
+// 0 means no limit.
+func (s *Store) History(job *crontab.Job, limit int) ([]*Record, error) {
+	records := make([]*Record, 0)
+
+	err := s.scan(job, func(record *Record) bool {
+		records = append(records, record)
+		return limit <= 0 || len(records) < limit
+	})
+
+	return records, err
+}
+
+// LastRun returns the most recent record for job, or nil if there is none.
+func (s *Store) LastRun(job *crontab.Job) (*Record, error) {
+	var last *Record
+
+	err := s.scan(job, func(record *Record) bool {
+		last = record
+		return false
+	})
+
+	return last, err
+}
+
+// LastSuccess returns the most recent successful record for job, or nil if
+// there is none.
+func (s *Store) LastSuccess(job *crontab.Job) (*Record, error) {
+	var last *Record
+
+	err := s.scan(job, func(record *Record) bool {
+		if record.Succeeded {
+			last = record
+			return false
+		}
+		return true
+	})
+
+	return last, err
+}
+
+// scan calls fn with each record for job, most recent first, until fn
+// returns false.
+func (s *Store) scan(job *crontab.Job, fn func(*Record) bool) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(jobsBucket).Bucket([]byte(job.Key()))
+		if bucket == nil {
+			return nil
+		}
+
+		cursor := bucket.Cursor()
+		for k, v := cursor.Last(); k != nil; k, v = cursor.Prev() {
+			record := &Record{}
+			if err := json.Unmarshal(v, record); err != nil {
+				return err
+			}
+
+			if !fn(record) {
+				break
+			}
+		}
+
+		return nil
+	})
+}
+
+func sequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// Hook records every execution in a Store.
+type Hook struct {
+	store *Store
+}
+
+func NewHook(store *Store) *Hook {
+	return &Hook{store: store}
+}
+
+func (h *Hook) JobStarted(e *cron.Execution) {}
+
+func (h *Hook) JobFinished(e *cron.Execution) {
+	record := &Record{
+		ScheduledAt: e.ScheduledAt,
+		StartedAt:   e.StartedAt,
+		FinishedAt:  e.FinishedAt,
+		Duration:    e.Duration().Seconds(),
+		ExitCode:    e.ExitCode,
+		Succeeded:   e.Err == nil,
+	}
+
+	if e.Err != nil {
+		record.Error = e.Err.Error()
+	}
+
+	if err := h.store.Add(e.Job, record); err != nil {
+		e.Logger.Errorf("failed to record job history: %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package history
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+func openTestStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "supercronic-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := Open(filepath.Join(dir, "history.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return store, func() {
+		store.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func newTestJob(command string) *crontab.Job {
+	return &crontab.Job{
+		CrontabLine: crontab.CrontabLine{Schedule: "* * * * *", Command: command},
+	}
+}
+
+func TestStoreHistory(t *testing.T) {
+	store, cleanup := openTestStore(t)
+	defer cleanup()
+
+	job := newTestJob("foo")
+	other := newTestJob("bar")
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, store.Add(job, &Record{ExitCode: i, Succeeded: i == 0}))
+	}
+
+	records, err := store.History(job, 0)
+	if assert.Nil(t, err) && assert.Len(t, records, 3) {
+		assert.Equal(t, 2, records[0].ExitCode)
+		assert.Equal(t, 0, records[2].ExitCode)
+	}
+
+	records, err = store.History(job, 2)
+	if assert.Nil(t, err) {
+		assert.Len(t, records, 2)
+	}
+
+	last, err := store.LastRun(job)
+	if assert.Nil(t, err) && assert.NotNil(t, last) {
+		assert.Equal(t, 2, last.ExitCode)
+	}
+
+	success, err := store.LastSuccess(job)
+	if assert.Nil(t, err) && assert.NotNil(t, success) {
+		assert.Equal(t, 0, success.ExitCode)
+	}
+
+	records, err = store.History(other, 0)
+	if assert.Nil(t, err) {
+		assert.Empty(t, records)
+	}
+
+	last, err = store.LastRun(other)
+	assert.Nil(t, err)
+	assert.Nil(t, last)
+}
+
+func TestStorePrunesOldRecords(t *testing.T) {
+	defer func(n int) { MAX_RECORDS_PER_JOB = n }(MAX_RECORDS_PER_JOB)
+	MAX_RECORDS_PER_JOB = 5
+
+	store, cleanup := openTestStore(t)
+	defer cleanup()
+
+	job := newTestJob("foo")
+
+	for i := 0; i < 12; i++ {
+		assert.Nil(t, store.Add(job, &Record{ExitCode: i}))
+	}
+
+	records, err := store.History(job, 0)
+	if assert.Nil(t, err) && assert.Len(t, records, 5) {
+		assert.Equal(t, 11, records[0].ExitCode)
+		assert.Equal(t, 7, records[4].ExitCode)
+	}
+}
+
+func TestStorePersists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-history")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "history.db")
+	job := newTestJob("foo")
+
+	store, err := Open(path)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Nil(t, store.Add(job, &Record{ExitCode: 42}))
+	assert.Nil(t, store.Close())
+
+	store, err = Open(path)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer store.Close()
+
+	last, err := store.LastRun(job)
+	if assert.Nil(t, err) && assert.NotNil(t, last) {
+		assert.Equal(t, 42, last.ExitCode)
+	}
+}
+
+func TestHookRecordsExecutions(t *testing.T) {
+	store, cleanup := openTestStore(t)
+	defer cleanup()
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	startedAt := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	e := &cron.Execution{
+		Job:         newTestJob("foo"),
+		Context:     &crontab.Context{Shell: "/bin/sh", Environ: map[string]string{}},
+		Logger:      logrus.NewEntry(logger),
+		ScheduledAt: startedAt,
+		StartedAt:   startedAt,
+		FinishedAt:  startedAt.Add(2 * time.Second),
+		Err:         errors.New("boom"),
+		ExitCode:    1,
+	}
+
+	NewHook(store).JobFinished(e)
+
+	last, err := store.LastRun(e.Job)
+	if assert.Nil(t, err) && assert.NotNil(t, last) {
+		assert.True(t, last.StartedAt.Equal(startedAt))
+		assert.Equal(t, 2.0, last.Duration)
+		assert.Equal(t, 1, last.ExitCode)
+		assert.False(t, last.Succeeded)
+		assert.Equal(t, "boom", last.Error)
+	}
+}
@@ -42,3 +42,18 @@ grep_test_file() {
   kill -s TERM "$PID"
   wait
 }
+
+@test "it reloads when the crontab changes with -watch" {
+  echo '* * * * * * * echo a > "$TEST_FILE"' > "$CRONTAB_FILE"
+
+  "${BATS_TEST_DIRNAME}/../supercronic" -watch "$CRONTAB_FILE" 3>&- &
+  PID="$!"
+
+  wait_for grep_test_file a
+
+  echo '* * * * * * * echo b > "$TEST_FILE"' > "$CRONTAB_FILE"
+  wait_for grep_test_file b
+
+  kill -s TERM "$PID"
+  wait
+}
@@ -97,3 +97,12 @@ wait_for() {
 @test "it errors on an invalid crontab" {
   ! run_supercronic -test "${BATS_TEST_DIRNAME}/invalid.crontab"
 }
+
+@test "it runs crontabs from a directory" {
+  echo '* * * * * * * echo "hello from a"' > "${WORK_DIR}/a"
+  echo '* * * * * * * echo "hello from b"' > "${WORK_DIR}/b"
+
+  out="$(run_supercronic "$WORK_DIR" 2s)"
+  echo "$out" | grep -iE "hello from a.*channel=stdout.*job.source=${WORK_DIR}/a"
+  echo "$out" | grep -iE "hello from b.*channel=stdout.*job.source=${WORK_DIR}/b"
+}
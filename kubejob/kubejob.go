@@ -0,0 +1,435 @@
+// Package kubejob runs jobs as Kubernetes Jobs (see crontab.KubernetesJob).
+//
+// Like exechelper, it does so from a re-execution of supercronic, which
+// creates the Job, copies the logs of its pod to its standard output, and
+// exits with the pod's exit code: to supercronic, it is a job like any other.
+// For example, it is stopped with SIGTERM when it times out, upon which it
+// deletes the Job.
+package kubejob
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"supercronic/crontab"
+	"supercronic/kube"
+)
+
+// helperArg is passed as the first argument when supercronic runs as a helper.
+const helperArg = "__supercronic_kubernetes_job_helper"
+
+// How often the Job's pod is checked on, until it starts and until it
+// completes.
+var POLL_INTERVAL = 2 * time.Second
+
+type spec struct {
+	Job  crontab.KubernetesJob
+	Name string
+	Argv []string
+	// Env holds the names of the variables to pass on to the pod. The
+	// helper gets their values in its environment.
+	Env     []string
+	Dir     string
+	Timeout time.Duration
+}
+
+type objectMeta struct {
+	Name string `json:"name"`
+}
+
+type containerStatus struct {
+	Name  string `json:"name"`
+	State struct {
+		Terminated *struct {
+			ExitCode int    `json:"exitCode"`
+			Reason   string `json:"reason"`
+		} `json:"terminated"`
+		Waiting *struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"waiting"`
+	} `json:"state"`
+}
+
+// condition is a condition of a pod or a Job.
+type condition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+type pod struct {
+	Metadata objectMeta `json:"metadata"`
+	Status   struct {
+		Phase             string            `json:"phase"`
+		Conditions        []condition       `json:"conditions"`
+		ContainerStatuses []containerStatus `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+type job struct {
+	Status struct {
+		Conditions []condition `json:"conditions"`
+	} `json:"status"`
+}
+
+type podList struct {
+	Items []pod `json:"items"`
+}
+
+// IsHelper reports whether the current process was started as a helper, in
+// which case main should call Main right away.
+func IsHelper() bool {
+	return len(os.Args) > 2 && os.Args[1] == helperArg
+}
+
+// Main runs the Job it was passed, and exits with the exit code of the
+// command. If the Job can't be run, it exits with status 127, like a shell
+// does when a command can't be run.
+func Main() {
+	code, err := run(os.Args[2])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "supercronic: %v\n", err)
+	}
+	os.Exit(code)
+}
+
+func run(encoded string) (int, error) {
+	s := &spec{}
+	if err := json.Unmarshal([]byte(encoded), s); err != nil {
+		return 127, fmt.Errorf("invalid helper arguments: %v", err)
+	}
+
+	client, err := kube.NewInClusterClient()
+	if err != nil {
+		return 127, err
+	}
+
+	if s.Job.Namespace == "" {
+		namespace, err := kube.InClusterNamespace()
+		if err != nil {
+			return 127, fmt.Errorf("could not determine namespace: %v", err)
+		}
+		s.Job.Namespace = namespace
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+
+	return runJob(client, s, os.Stdout, os.Stderr, stop)
+}
+
+// runJob creates the Job, and waits for it to complete (in which case it
+// returns the exit code of the command), or for stop (in which case it
+// deletes the Job). The pod's logs go to out, and why it hasn't started yet
+// to errOut.
+func runJob(client *kube.Client, s *spec, out io.Writer, errOut io.Writer, stop <-chan os.Signal) (int, error) {
+	template, err := loadTemplate(s.Job.Template)
+	if err != nil {
+		return 127, fmt.Errorf("could not load pod template %s: %v", s.Job.Template, err)
+	}
+
+	manifest, container, err := buildJob(s, template)
+	if err != nil {
+		return 127, fmt.Errorf("bad pod template %s: %v", s.Job.Template, err)
+	}
+
+	created := struct {
+		Metadata objectMeta `json:"metadata"`
+	}{}
+
+	if err := client.Do("POST", jobsPath(s.Job.Namespace), manifest, &created); err != nil {
+		return 127, fmt.Errorf("could not create Job: %v", err)
+	}
+
+	name := created.Metadata.Name
+	defer deleteJob(client, s.Job.Namespace, name)
+
+	type result struct {
+		code int
+		err  error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		code, err := follow(client, s.Job.Namespace, name, container, out, errOut)
+		done <- result{code, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.code, r.err
+	case sig := <-stop:
+		return 128 + int(sig.(syscall.Signal)), fmt.Errorf("received %s, deleting Job %s", sig, name)
+	}
+}
+
+// follow copies the logs of the Job's pod to out once it has started, and
+// returns the exit code of container once it has completed. Until the pod
+// starts, why it's pending is reported to errOut, and the Job is checked on:
+// its pod may never start (e.g. if it can't be scheduled), or be gone once
+// the Job failed (e.g. past its activeDeadlineSeconds).
+func follow(client *kube.Client, namespace string, name string, container string, out io.Writer, errOut io.Writer) (int, error) {
+	var p *pod
+	var pending string
+
+	for {
+		pods := &podList{}
+		selector := url.QueryEscape("job-name=" + name)
+		if err := client.Do("GET", podsPath(namespace)+"?labelSelector="+selector, nil, pods); err != nil {
+			return 1, fmt.Errorf("could not find pod of Job %s: %v", name, err)
+		}
+
+		if len(pods.Items) > 0 && pods.Items[0].Status.Phase != "Pending" {
+			p = &pods.Items[0]
+			break
+		}
+
+		j := &job{}
+		if err := client.Do("GET", jobsPath(namespace)+"/"+name, nil, j); err != nil {
+			return 1, fmt.Errorf("could not get Job %s: %v", name, err)
+		}
+
+		for _, c := range j.Status.Conditions {
+			if (c.Type == "Failed" || c.Type == "Complete") && c.Status == "True" {
+				return 1, fmt.Errorf("could not follow pod of Job %s, which %s: %s", name, strings.ToLower(c.Type), describeCondition(c))
+			}
+		}
+
+		if len(pods.Items) > 0 {
+			if reason := pendingReason(&pods.Items[0]); reason != "" && reason != pending {
+				fmt.Fprintf(errOut, "supercronic: pod %s is pending: %s\n", pods.Items[0].Metadata.Name, reason)
+				pending = reason
+			}
+		}
+
+		time.Sleep(POLL_INTERVAL)
+	}
+
+	logs, err := client.Stream(podsPath(namespace) + "/" + p.Metadata.Name + "/log?follow=true&container=" + url.QueryEscape(container))
+	if err != nil {
+		return 1, fmt.Errorf("could not get logs of pod %s: %v", p.Metadata.Name, err)
+	}
+	io.Copy(out, logs)
+	logs.Close()
+
+	for {
+		if err := client.Do("GET", podsPath(namespace)+"/"+p.Metadata.Name, nil, p); err != nil {
+			return 1, fmt.Errorf("could not get pod %s: %v", p.Metadata.Name, err)
+		}
+
+		if phase := p.Status.Phase; phase == "Succeeded" || phase == "Failed" {
+			for _, status := range p.Status.ContainerStatuses {
+				if status.Name == container && status.State.Terminated != nil {
+					return status.State.Terminated.ExitCode, nil
+				}
+			}
+			return 1, fmt.Errorf("pod %s %s, but container %s didn't run", p.Metadata.Name, strings.ToLower(phase), container)
+		}
+
+		time.Sleep(POLL_INTERVAL)
+	}
+}
+
+// pendingReason returns why p hasn't started yet, if known.
+func pendingReason(p *pod) string {
+	for _, status := range p.Status.ContainerStatuses {
+		if waiting := status.State.Waiting; waiting != nil && waiting.Reason != "" {
+			return describeCondition(condition{Reason: "container " + status.Name + " is " + waiting.Reason, Message: waiting.Message})
+		}
+	}
+
+	for _, c := range p.Status.Conditions {
+		if c.Type == "PodScheduled" && c.Status == "False" {
+			return describeCondition(c)
+		}
+	}
+
+	return ""
+}
+
+func describeCondition(c condition) string {
+	if c.Message == "" {
+		return c.Reason
+	}
+	return c.Reason + ": " + c.Message
+}
+
+func deleteJob(client *kube.Client, namespace string, name string) {
+	// Without a propagation policy, the Job's pods would be left behind.
+	options := map[string]string{"propagationPolicy": "Background"}
+
+	if err := client.Do("DELETE", jobsPath(namespace)+"/"+name, options, nil); err != nil && err != kube.ErrNotFound {
+		fmt.Fprintf(os.Stderr, "supercronic: could not delete Job %s: %v\n", name, err)
+	}
+}
+
+func jobsPath(namespace string) string {
+	return fmt.Sprintf("/apis/batch/v1/namespaces/%s/jobs", namespace)
+}
+
+func podsPath(namespace string) string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/pods", namespace)
+}
+
+func loadTemplate(path string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is YAML too.
+	var template interface{}
+	if err := yaml.Unmarshal(data, &template); err != nil {
+		return nil, err
+	}
+
+	m, ok := jsonValue(template).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a PodTemplateSpec")
+	}
+	return m, nil
+}
+
+// jsonValue converts the maps yaml.v2 returns, which JSON can't encode.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return m
+	case []interface{}:
+		for i, value := range v {
+			v[i] = jsonValue(value)
+		}
+	}
+	return v
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// buildJob returns a Job running s with the pod template, and the name of
+// the container that runs the command.
+func buildJob(s *spec, template map[string]interface{}) (map[string]interface{}, string, error) {
+	podSpec, ok := template["spec"].(map[string]interface{})
+	if !ok {
+		return nil, "", fmt.Errorf("no spec")
+	}
+
+	containers, _ := podSpec["containers"].([]interface{})
+
+	var container map[string]interface{}
+	for _, c := range containers {
+		c, ok := c.(map[string]interface{})
+		if ok && (s.Job.Container == "" || c["name"] == s.Job.Container) {
+			container = c
+			break
+		}
+	}
+
+	if container == nil {
+		if s.Job.Container != "" {
+			return nil, "", fmt.Errorf("no container named %s", s.Job.Container)
+		}
+		return nil, "", fmt.Errorf("no containers")
+	}
+
+	delete(container, "args")
+	container["command"] = s.Argv
+
+	if s.Dir != "" {
+		container["workingDir"] = s.Dir
+	}
+
+	env, _ := container["env"].([]interface{})
+	for _, name := range s.Env {
+		env = append(env, map[string]interface{}{"name": name, "value": os.Getenv(name)})
+	}
+	if len(env) > 0 {
+		container["env"] = env
+	}
+
+	// Failed runs are retried by supercronic (per the job's retries), not by
+	// Kubernetes.
+	if _, ok := podSpec["restartPolicy"]; !ok {
+		podSpec["restartPolicy"] = "Never"
+	}
+
+	jobSpec := map[string]interface{}{
+		"backoffLimit": 0,
+		"template":     template,
+	}
+
+	if s.Timeout > 0 {
+		jobSpec["activeDeadlineSeconds"] = int64((s.Timeout + time.Second - 1) / time.Second)
+	}
+
+	prefix := strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(s.Name), "-"), "-")
+	if len(prefix) > 50 {
+		prefix = strings.TrimRight(prefix[:50], "-")
+	}
+	if prefix == "" {
+		prefix = "supercronic"
+	}
+
+	job := map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata": map[string]interface{}{
+			"generateName": prefix + "-",
+			"namespace":    s.Job.Namespace,
+			"labels":       map[string]interface{}{"app.kubernetes.io/managed-by": "supercronic"},
+		},
+		"spec": jobSpec,
+	}
+
+	name, _ := container["name"].(string)
+	return job, name, nil
+}
+
+// Command returns a Cmd that runs argv as a Kubernetes Job per job, in dir
+// (unless it is empty), with the variables in env (given as KEY=VALUE). name
+// (the job's name, if any) prefixes the names of the Jobs, and timeout (if
+// set) is their deadline.
+//
+// Like docker.Command, only the names of the variables are passed as
+// arguments: the Cmd must run with env.
+func Command(job *crontab.KubernetesJob, name string, argv []string, env []string, dir string, timeout time.Duration) (*exec.Cmd, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("could not locate supercronic executable: %v", err)
+	}
+
+	s := &spec{Job: *job, Name: name, Argv: argv, Dir: dir, Timeout: timeout}
+
+	seen := make(map[string]bool)
+	for _, kv := range env {
+		key := strings.SplitN(kv, "=", 2)[0]
+		if !seen[key] {
+			seen[key] = true
+			s.Env = append(s.Env, key)
+		}
+	}
+
+	encoded, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return exec.Command(self, helperArg, string(encoded)), nil
+}
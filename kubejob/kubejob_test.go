@@ -0,0 +1,313 @@
+package kubejob
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"supercronic/crontab"
+	"supercronic/kube"
+)
+
+const testTemplate = `
+metadata:
+  labels:
+    app: report
+spec:
+  serviceAccountName: report
+  containers:
+    - name: sidecar
+      image: envoy
+    - name: report
+      image: myapp:latest
+      args: [serve]
+      env:
+        - name: APP_ENV
+          value: production
+`
+
+func writeTemplate(t *testing.T, template string) (string, func()) {
+	dir, err := ioutil.TempDir("", "supercronic-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "pod.yaml")
+	if err := ioutil.WriteFile(path, []byte(template), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestBuildJob(t *testing.T) {
+	path, cleanup := writeTemplate(t, testTemplate)
+	defer cleanup()
+
+	template, err := loadTemplate(path)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	os.Setenv("SUPERCRONIC_TEST_DB_PASS", "hunter2")
+	defer os.Unsetenv("SUPERCRONIC_TEST_DB_PASS")
+
+	s := &spec{
+		Job:     crontab.KubernetesJob{Template: path, Namespace: "batch", Container: "report"},
+		Name:    "Nightly Report",
+		Argv:    []string{"/bin/sh", "-c", "report.sh"},
+		Env:     []string{"SUPERCRONIC_TEST_DB_PASS"},
+		Dir:     "/srv",
+		Timeout: 90*time.Second + time.Millisecond,
+	}
+
+	job, container, err := buildJob(s, template)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Equal(t, "report", container)
+
+	// Compare the JSON the API server gets.
+	encoded, _ := json.Marshal(job)
+	var decoded map[string]interface{}
+	json.Unmarshal(encoded, &decoded)
+
+	expected := map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata": map[string]interface{}{
+			"generateName": "nightly-report-",
+			"namespace":    "batch",
+			"labels":       map[string]interface{}{"app.kubernetes.io/managed-by": "supercronic"},
+		},
+		"spec": map[string]interface{}{
+			"backoffLimit":          float64(0),
+			"activeDeadlineSeconds": float64(91),
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "report"}},
+				"spec": map[string]interface{}{
+					"serviceAccountName": "report",
+					"restartPolicy":      "Never",
+					"containers": []interface{}{
+						map[string]interface{}{"name": "sidecar", "image": "envoy"},
+						map[string]interface{}{
+							"name":       "report",
+							"image":      "myapp:latest",
+							"command":    []interface{}{"/bin/sh", "-c", "report.sh"},
+							"workingDir": "/srv",
+							"env": []interface{}{
+								map[string]interface{}{"name": "APP_ENV", "value": "production"},
+								map[string]interface{}{"name": "SUPERCRONIC_TEST_DB_PASS", "value": "hunter2"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, expected, decoded)
+}
+
+func TestBuildJobErrors(t *testing.T) {
+	for _, tt := range []struct {
+		template  string
+		container string
+	}{
+		{"metadata: {}", ""},
+		{"spec: {containers: []}", ""},
+		{"spec: {containers: [{name: app}]}", "report"},
+	} {
+		path, cleanup := writeTemplate(t, tt.template)
+
+		template, err := loadTemplate(path)
+		if assert.Nil(t, err, tt.template) {
+			_, _, err = buildJob(&spec{Job: crontab.KubernetesJob{Container: tt.container}}, template)
+			assert.NotNil(t, err, tt.template)
+		}
+
+		cleanup()
+	}
+}
+
+// testAPIServer serves a Job whose pod starts on the second check, and
+// completes on the second check after its logs were read.
+type testAPIServer struct {
+	mu      sync.Mutex
+	checks  int
+	created map[string]interface{}
+	deleted []string
+}
+
+func (s *testAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/apis/batch/v1/namespaces/batch/jobs":
+		json.NewDecoder(r.Body).Decode(&s.created)
+		w.Write([]byte(`{"metadata":{"name":"report-x7k2p"}}`))
+	case r.Method == "GET" && r.URL.Path == "/apis/batch/v1/namespaces/batch/jobs/report-x7k2p":
+		w.Write([]byte(`{"status":{"active":1}}`))
+	case r.Method == "DELETE" && r.URL.Path == "/apis/batch/v1/namespaces/batch/jobs/report-x7k2p":
+		var options map[string]string
+		json.NewDecoder(r.Body).Decode(&options)
+		s.deleted = append(s.deleted, options["propagationPolicy"])
+		w.Write([]byte(`{}`))
+	case r.URL.Path == "/api/v1/namespaces/batch/pods" && r.URL.Query().Get("labelSelector") == "job-name=report-x7k2p":
+		s.checks++
+		phase := "Pending"
+		if s.checks > 1 {
+			phase = "Running"
+		}
+		w.Write([]byte(`{"items":[{"metadata":{"name":"report-x7k2p-abcde"},"status":{"phase":"` + phase + `"}}]}`))
+	case r.URL.Path == "/api/v1/namespaces/batch/pods/report-x7k2p-abcde/log":
+		if r.URL.Query().Get("follow") == "true" && r.URL.Query().Get("container") == "report" {
+			w.Write([]byte("hello\nworld\n"))
+		}
+	case r.URL.Path == "/api/v1/namespaces/batch/pods/report-x7k2p-abcde":
+		s.checks++
+		if s.checks < 4 {
+			w.Write([]byte(`{"metadata":{"name":"report-x7k2p-abcde"},"status":{"phase":"Running"}}`))
+			return
+		}
+		w.Write([]byte(`{"metadata":{"name":"report-x7k2p-abcde"},"status":{"phase":"Failed","containerStatuses":[` +
+			`{"name":"sidecar","state":{"terminated":{"exitCode":0}}},` +
+			`{"name":"report","state":{"terminated":{"exitCode":3,"reason":"Error"}}}]}}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestRunJob(t *testing.T) {
+	defer func(interval time.Duration) { POLL_INTERVAL = interval }(POLL_INTERVAL)
+	POLL_INTERVAL = time.Millisecond
+
+	path, cleanup := writeTemplate(t, testTemplate)
+	defer cleanup()
+
+	api := &testAPIServer{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	client := kube.NewClient(server.URL, "", server.Client())
+	s := &spec{
+		Job:  crontab.KubernetesJob{Template: path, Namespace: "batch", Container: "report"},
+		Name: "report",
+		Argv: []string{"/bin/sh", "-c", "report.sh"},
+	}
+
+	var out bytes.Buffer
+	code, err := runJob(client, s, &out, ioutil.Discard, make(chan os.Signal))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, code)
+	assert.Equal(t, "hello\nworld\n", out.String())
+	assert.Equal(t, "Job", api.created["kind"])
+	assert.Equal(t, []string{"Background"}, api.deleted)
+}
+
+// testFailingAPIServer serves a Job whose pod can't pull its image, and
+// fails on the third check.
+type testFailingAPIServer struct {
+	mu     sync.Mutex
+	checks int
+}
+
+func (s *testFailingAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/apis/batch/v1/namespaces/batch/jobs":
+		w.Write([]byte(`{"metadata":{"name":"report-x7k2p"}}`))
+	case r.Method == "DELETE":
+		w.Write([]byte(`{}`))
+	case r.URL.Path == "/api/v1/namespaces/batch/pods":
+		w.Write([]byte(`{"items":[{"metadata":{"name":"report-x7k2p-abcde"},"status":{"phase":"Pending","containerStatuses":[` +
+			`{"name":"report","state":{"waiting":{"reason":"ImagePullBackOff","message":"Back-off pulling image \"myapp:latest\""}}}]}}]}`))
+	case r.URL.Path == "/apis/batch/v1/namespaces/batch/jobs/report-x7k2p":
+		s.checks++
+		if s.checks < 3 {
+			w.Write([]byte(`{"status":{"active":1}}`))
+			return
+		}
+		w.Write([]byte(`{"status":{"conditions":[{"type":"Failed","status":"True","reason":"DeadlineExceeded","message":"Job was active longer than specified deadline"}]}}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestRunJobFailsWhenPodNeverStarts(t *testing.T) {
+	defer func(interval time.Duration) { POLL_INTERVAL = interval }(POLL_INTERVAL)
+	POLL_INTERVAL = time.Millisecond
+
+	path, cleanup := writeTemplate(t, testTemplate)
+	defer cleanup()
+
+	server := httptest.NewServer(&testFailingAPIServer{})
+	defer server.Close()
+
+	client := kube.NewClient(server.URL, "", server.Client())
+	s := &spec{Job: crontab.KubernetesJob{Template: path, Namespace: "batch", Container: "report"}, Argv: []string{"true"}}
+
+	var errOut bytes.Buffer
+	code, err := runJob(client, s, ioutil.Discard, &errOut, make(chan os.Signal))
+
+	assert.Equal(t, 1, code)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "could not follow pod of Job report-x7k2p, which failed: DeadlineExceeded: Job was active longer than specified deadline", err.Error())
+	}
+
+	// Reasons are only reported when they change.
+	assert.Equal(t, "supercronic: pod report-x7k2p-abcde is pending: container report is ImagePullBackOff: Back-off pulling image \"myapp:latest\"\n", errOut.String())
+}
+
+func TestRunJobDeletesJobWhenStopped(t *testing.T) {
+	defer func(interval time.Duration) { POLL_INTERVAL = interval }(POLL_INTERVAL)
+	POLL_INTERVAL = time.Hour
+
+	path, cleanup := writeTemplate(t, testTemplate)
+	defer cleanup()
+
+	api := &testAPIServer{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	client := kube.NewClient(server.URL, "", server.Client())
+	s := &spec{Job: crontab.KubernetesJob{Template: path, Namespace: "batch"}, Argv: []string{"true"}}
+
+	stop := make(chan os.Signal, 1)
+	stop <- syscall.SIGTERM
+
+	code, err := runJob(client, s, ioutil.Discard, ioutil.Discard, stop)
+	assert.NotNil(t, err)
+	assert.Equal(t, 143, code)
+	assert.Equal(t, []string{"Background"}, api.deleted)
+}
+
+func TestCommandPassesVariableNamesOnly(t *testing.T) {
+	cmd, err := Command(&crontab.KubernetesJob{Template: "pod.yaml"}, "report", []string{"true"}, []string{"DB_PASS=hunter2", "DB_PASS=swordfish"}, "", 0)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Equal(t, helperArg, cmd.Args[1])
+
+	s := &spec{}
+	if assert.Nil(t, json.Unmarshal([]byte(cmd.Args[2]), s)) {
+		assert.Equal(t, []string{"DB_PASS"}, s.Env)
+		assert.NotContains(t, cmd.Args[2], "hunter2")
+	}
+}
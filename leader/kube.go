@@ -0,0 +1,70 @@
+package leader
+
+import (
+	"fmt"
+
+	"supercronic/kube"
+)
+
+const microTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+type objectMeta struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions"`
+}
+
+// lease is a coordination.k8s.io/v1 Lease.
+type lease struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   objectMeta `json:"metadata"`
+	Spec       leaseSpec  `json:"spec"`
+}
+
+// kubeClient manages Leases.
+type kubeClient struct {
+	*kube.Client
+}
+
+func leasePath(namespace string, name string) string {
+	path := fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", namespace)
+	if name != "" {
+		path += "/" + name
+	}
+	return path
+}
+
+func (c *kubeClient) getLease(namespace string, name string) (*lease, error) {
+	l := &lease{}
+	if err := c.Do("GET", leasePath(namespace, name), nil, l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (c *kubeClient) createLease(l *lease) (*lease, error) {
+	created := &lease{}
+	if err := c.Do("POST", leasePath(l.Metadata.Namespace, ""), l, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// updateLease replaces l. This fails with kube.ErrConflict if the lease was
+// modified since it was read.
+func (c *kubeClient) updateLease(l *lease) (*lease, error) {
+	updated := &lease{}
+	if err := c.Do("PUT", leasePath(l.Metadata.Namespace, l.Metadata.Name), l, updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
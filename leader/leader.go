@@ -0,0 +1,270 @@
+// Package leader implements leader election using a Kubernetes Lease, so that
+// only one of several supercronic replicas schedules jobs at a time.
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"supercronic/kube"
+)
+
+const defaultLeaseDuration = 15 * time.Second
+
+var errHeld = errors.New("lease is held by another replica")
+
+type Config struct {
+	// Lease is the name of the Lease object replicas compete for.
+	Lease string `yaml:"lease"`
+
+	// Namespace defaults to the namespace of the pod supercronic runs in.
+	Namespace string `yaml:"namespace"`
+
+	// Identity defaults to the hostname, i.e. the pod name.
+	Identity string `yaml:"identity"`
+
+	// LeaseDuration is how long followers wait after the leader stops
+	// renewing the lease before taking over. Defaults to 15s.
+	LeaseDuration time.Duration `yaml:"lease_duration"`
+}
+
+// Elector campaigns for leadership in the background. Changed receives a
+// value whenever this replica gains or loses leadership.
+type Elector struct {
+	Changed <-chan struct{}
+
+	client        *kubeClient
+	namespace     string
+	name          string
+	identity      string
+	leaseDuration time.Duration
+	retryPeriod   time.Duration
+	renewDeadline time.Duration
+	logger        *logrus.Entry
+
+	changed chan struct{}
+
+	mu        sync.Mutex
+	leading   bool
+	lastRenew time.Time
+
+	// The last lease we observed, and when (using our own clock, to not
+	// depend on clocks being in sync across replicas).
+	observedVersion string
+	observedAt      time.Time
+}
+
+// New configures an Elector using the in-cluster Kubernetes configuration.
+func New(config Config, logger *logrus.Entry) (*Elector, error) {
+	client, err := kube.NewInClusterClient()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Namespace == "" {
+		namespace, err := kube.InClusterNamespace()
+		if err != nil {
+			return nil, fmt.Errorf("could not determine namespace: %v", err)
+		}
+		config.Namespace = namespace
+	}
+
+	return newElector(config, &kubeClient{client}, logger)
+}
+
+func newElector(config Config, client *kubeClient, logger *logrus.Entry) (*Elector, error) {
+	if config.Lease == "" {
+		return nil, fmt.Errorf("leader election requires a lease name")
+	}
+
+	if config.Identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("could not determine identity: %v", err)
+		}
+		config.Identity = hostname
+	}
+
+	if config.LeaseDuration == 0 {
+		config.LeaseDuration = defaultLeaseDuration
+	}
+
+	if config.LeaseDuration < time.Second {
+		return nil, fmt.Errorf("lease duration must be at least 1s: %v", config.LeaseDuration)
+	}
+
+	changed := make(chan struct{}, 1)
+
+	return &Elector{
+		Changed:       changed,
+		client:        client,
+		namespace:     config.Namespace,
+		name:          config.Lease,
+		identity:      config.Identity,
+		leaseDuration: config.LeaseDuration,
+		retryPeriod:   config.LeaseDuration / 5,
+		renewDeadline: config.LeaseDuration * 2 / 3,
+		logger: logger.WithFields(logrus.Fields{
+			"lease":    config.Namespace + "/" + config.Lease,
+			"identity": config.Identity,
+		}),
+		changed: changed,
+	}, nil
+}
+
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leading
+}
+
+// Run campaigns for leadership until ctx is cancelled. The lease is then
+// released if we hold it, so that another replica can take over right away.
+func (e *Elector) Run(ctx context.Context) {
+	for {
+		e.tryAcquireOrRenew()
+
+		select {
+		case <-ctx.Done():
+			e.release()
+			return
+		case <-time.After(e.retryPeriod):
+		}
+	}
+}
+
+func (e *Elector) setLeading(leading bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if leading == e.leading {
+		return
+	}
+
+	e.leading = leading
+
+	if leading {
+		e.logger.Info("elected leader")
+	} else {
+		e.logger.Warn("lost leadership")
+	}
+
+	select {
+	case e.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (e *Elector) tryAcquireOrRenew() {
+	now := time.Now()
+
+	err := e.acquireOrRenew(now)
+	if err == nil {
+		e.mu.Lock()
+		e.lastRenew = now
+		e.mu.Unlock()
+		e.setLeading(true)
+		return
+	}
+
+	if err != errHeld {
+		e.logger.Warnf("failed to acquire or renew lease: %v", err)
+
+		// A leader that can't reach the API server keeps leading until
+		// its renew deadline, in case this is a transient failure.
+		e.mu.Lock()
+		keep := e.leading && now.Sub(e.lastRenew) < e.renewDeadline
+		e.mu.Unlock()
+
+		if keep {
+			return
+		}
+	}
+
+	e.setLeading(false)
+}
+
+func (e *Elector) acquireOrRenew(now time.Time) error {
+	l, err := e.client.getLease(e.namespace, e.name)
+
+	if err == kube.ErrNotFound {
+		_, err := e.client.createLease(&lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   objectMeta{Name: e.name, Namespace: e.namespace},
+			Spec: leaseSpec{
+				HolderIdentity:       e.identity,
+				LeaseDurationSeconds: int(e.leaseDuration / time.Second),
+				AcquireTime:          now.UTC().Format(microTimeFormat),
+				RenewTime:            now.UTC().Format(microTimeFormat),
+			},
+		})
+		if err == kube.ErrConflict {
+			// Another replica created the lease first.
+			return errHeld
+		}
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if l.Metadata.ResourceVersion != e.observedVersion {
+		e.observedVersion = l.Metadata.ResourceVersion
+		e.observedAt = now
+	}
+
+	holder := l.Spec.HolderIdentity
+	duration := time.Duration(l.Spec.LeaseDurationSeconds) * time.Second
+
+	if holder != "" && holder != e.identity && now.Before(e.observedAt.Add(duration)) {
+		return errHeld
+	}
+
+	if holder != e.identity {
+		l.Spec.AcquireTime = now.UTC().Format(microTimeFormat)
+		l.Spec.LeaseTransitions++
+	}
+
+	l.Spec.HolderIdentity = e.identity
+	l.Spec.LeaseDurationSeconds = int(e.leaseDuration / time.Second)
+	l.Spec.RenewTime = now.UTC().Format(microTimeFormat)
+
+	if _, err := e.client.updateLease(l); err != nil {
+		if err == kube.ErrConflict {
+			// Someone else updated the lease since we read it.
+			return errHeld
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (e *Elector) release() {
+	if !e.IsLeader() {
+		return
+	}
+
+	l, err := e.client.getLease(e.namespace, e.name)
+	if err == nil && l.Spec.HolderIdentity == e.identity {
+		l.Spec.HolderIdentity = ""
+		l.Spec.LeaseDurationSeconds = 1
+		l.Spec.RenewTime = time.Now().UTC().Format(microTimeFormat)
+		_, err = e.client.updateLease(l)
+	}
+
+	if err != nil {
+		e.logger.Warnf("failed to release lease: %v", err)
+	} else {
+		e.logger.Info("released lease")
+	}
+
+	e.setLeading(false)
+}
@@ -0,0 +1,225 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"supercronic/kube"
+)
+
+const testLeasePath = "/apis/coordination.k8s.io/v1/namespaces/jobs/leases"
+
+// fakeAPIServer stores leases, and enforces optimistic concurrency like the
+// Kubernetes API server does.
+type fakeAPIServer struct {
+	mu      sync.Mutex
+	leases  map[string]*lease
+	version int
+}
+
+func (f *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, testLeasePath), "/")
+
+	switch r.Method {
+	case "GET":
+		l, ok := f.leases[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(l)
+	case "POST", "PUT":
+		l := &lease{}
+		if err := json.NewDecoder(r.Body).Decode(l); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		existing, ok := f.leases[l.Metadata.Name]
+		if r.Method == "POST" && ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if r.Method == "PUT" && (!ok || existing.Metadata.ResourceVersion != l.Metadata.ResourceVersion) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		f.version++
+		l.Metadata.ResourceVersion = strconv.Itoa(f.version)
+		f.leases[l.Metadata.Name] = l
+		json.NewEncoder(w).Encode(l)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeAPIServer) holder(name string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if l, ok := f.leases[name]; ok {
+		return l.Spec.HolderIdentity
+	}
+	return ""
+}
+
+func newTestElector(t *testing.T, server *httptest.Server, identity string) *Elector {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	client := &kubeClient{kube.NewClient(server.URL, "", server.Client())}
+
+	e, err := newElector(Config{
+		Lease:         "supercronic",
+		Namespace:     "jobs",
+		Identity:      identity,
+		LeaseDuration: time.Second,
+	}, client, logrus.NewEntry(logger))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return e
+}
+
+func TestElectorTakesOverExpiredLease(t *testing.T) {
+	api := &fakeAPIServer{leases: make(map[string]*lease)}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	a := newTestElector(t, server, "a")
+	b := newTestElector(t, server, "b")
+
+	a.tryAcquireOrRenew()
+	assert.True(t, a.IsLeader())
+	assert.Equal(t, "a", api.holder("supercronic"))
+
+	select {
+	case <-a.Changed:
+	default:
+		t.Errorf("expected a leadership change")
+	}
+
+	b.tryAcquireOrRenew()
+	assert.False(t, b.IsLeader())
+
+	// a renews, and stays leader
+	a.tryAcquireOrRenew()
+	assert.True(t, a.IsLeader())
+
+	b.tryAcquireOrRenew()
+	assert.False(t, b.IsLeader())
+
+	// a stops renewing, so b takes over once the lease expires
+	time.Sleep(1100 * time.Millisecond)
+	b.tryAcquireOrRenew()
+	assert.True(t, b.IsLeader())
+	assert.Equal(t, "b", api.holder("supercronic"))
+
+	a.tryAcquireOrRenew()
+	assert.False(t, a.IsLeader())
+
+	select {
+	case <-a.Changed:
+	default:
+		t.Errorf("expected a leadership change")
+	}
+}
+
+func TestElectorReleasesLeaseOnExit(t *testing.T) {
+	api := &fakeAPIServer{leases: make(map[string]*lease)}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	a := newTestElector(t, server, "a")
+	b := newTestElector(t, server, "b")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		a.Run(ctx)
+		close(done)
+	}()
+
+	<-a.Changed
+	assert.True(t, a.IsLeader())
+
+	b.tryAcquireOrRenew()
+	assert.False(t, b.IsLeader())
+
+	cancel()
+	<-done
+
+	assert.False(t, a.IsLeader())
+	assert.Equal(t, "", api.holder("supercronic"))
+
+	b.tryAcquireOrRenew()
+	assert.True(t, b.IsLeader())
+}
+
+func TestElectorKeepsLeadingThroughTransientErrors(t *testing.T) {
+	api := &fakeAPIServer{leases: make(map[string]*lease)}
+
+	var broken bool
+	var mu sync.Mutex
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if broken {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		api.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	a := newTestElector(t, server, "a")
+
+	a.tryAcquireOrRenew()
+	assert.True(t, a.IsLeader())
+
+	mu.Lock()
+	broken = true
+	mu.Unlock()
+
+	a.tryAcquireOrRenew()
+	assert.True(t, a.IsLeader())
+
+	// Past the renew deadline, we give up
+	time.Sleep(700 * time.Millisecond)
+	a.tryAcquireOrRenew()
+	assert.False(t, a.IsLeader())
+}
+
+func TestNewElectorValidatesConfig(t *testing.T) {
+	logger := logrus.NewEntry(logrus.New())
+	client := &kubeClient{}
+
+	_, err := newElector(Config{}, client, logger)
+	assert.NotNil(t, err)
+
+	_, err = newElector(Config{Lease: "foo", LeaseDuration: time.Millisecond}, client, logger)
+	assert.NotNil(t, err)
+
+	e, err := newElector(Config{Lease: "foo", Identity: "me"}, client, logger)
+	if assert.Nil(t, err) {
+		assert.Equal(t, defaultLeaseDuration, e.leaseDuration)
+	}
+}
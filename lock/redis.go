@@ -0,0 +1,150 @@
+// Package lock provides distributed locks, which let multiple supercronic
+// replicas share a crontab while each run happens only once.
+package lock
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+// LOCK_TTL is how long a lock outlives the replica holding it if that
+// replica dies. Locks are refreshed every LOCK_TTL / 3 while their job runs.
+var LOCK_TTL = 30 * time.Second
+
+const keyPrefix = "supercronic:lock:"
+
+// Extends the lock at KEYS[1] to ARGV[2] milliseconds, if ARGV[1] holds it.
+const extendScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+
+// RedisLocker takes a lock in Redis for every run of a job. Locks are keyed on
+// the job and its scheduled time, so the replica that gets the lock runs the
+// job and the others skip that run.
+type RedisLocker struct {
+	client *redisClient
+	logger *logrus.Entry
+}
+
+func NewRedisLocker(url string, logger *logrus.Entry) (*RedisLocker, error) {
+	client, err := newRedisClient(url)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RedisLocker{client: client, logger: logger}, nil
+}
+
+// Ping checks that Redis is reachable.
+func (l *RedisLocker) Ping() error {
+	_, err := l.client.Do("PING")
+	return err
+}
+
+func (l *RedisLocker) Close() {
+	l.client.Close()
+}
+
+func (l *RedisLocker) Acquire(job *crontab.Job, scheduledAt time.Time) (cron.Lock, error) {
+	key := fmt.Sprintf("%s%s:%d", keyPrefix, job.Key(), scheduledAt.Unix())
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := strconv.FormatInt(int64(LOCK_TTL/time.Millisecond), 10)
+
+	reply, err := l.client.Do("SET", key, token, "NX", "PX", ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	if reply == nil {
+		return nil, nil
+	}
+
+	lock := &redisLock{
+		locker: l,
+		key:    key,
+		token:  token,
+		done:   make(chan struct{}),
+	}
+
+	lock.wg.Add(1)
+	go lock.heartbeat()
+
+	return lock, nil
+}
+
+func (l *RedisLocker) extend(key string, token string) (bool, error) {
+	ttl := strconv.FormatInt(int64(LOCK_TTL/time.Millisecond), 10)
+
+	reply, err := l.client.Do("EVAL", extendScript, "1", key, token, ttl)
+	if err != nil {
+		return false, err
+	}
+
+	return reply == int64(1), nil
+}
+
+type redisLock struct {
+	locker *RedisLocker
+	key    string
+	token  string
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func (l *redisLock) heartbeat() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(LOCK_TTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+		}
+
+		ok, err := l.locker.extend(l.key, l.token)
+		if err != nil {
+			l.locker.logger.Warnf("failed to refresh job lock %s: %v", l.key, err)
+			continue
+		}
+
+		if !ok {
+			l.locker.logger.Warnf("lost job lock %s: another replica may run this job", l.key)
+			return
+		}
+	}
+}
+
+// Release stops refreshing the lock. The key isn't deleted, but left to
+// expire after LOCK_TTL: this way, replicas that are running late don't run
+// the job again for the same scheduled time.
+func (l *redisLock) Release() {
+	close(l.done)
+	l.wg.Wait()
+
+	if _, err := l.locker.extend(l.key, l.token); err != nil {
+		l.locker.logger.Warnf("failed to release job lock %s: %v", l.key, err)
+	}
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,250 @@
+package lock
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"supercronic/crontab"
+)
+
+type fakeEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// fakeRedis implements just enough of Redis for RedisLocker.
+type fakeRedis struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	data     map[string]*fakeEntry
+	commands []string
+}
+
+func startFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeRedis{listener: listener, data: make(map[string]*fakeEntry)}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+
+	return f
+}
+
+func (f *fakeRedis) URL() string {
+	return "redis://" + f.listener.Addr().String()
+}
+
+func (f *fakeRedis) Close() {
+	f.listener.Close()
+}
+
+func (f *fakeRedis) get(key string) *fakeEntry {
+	entry, ok := f.data[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil
+	}
+	return entry
+}
+
+func (f *fakeRedis) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := make([]string, 0)
+	for key := range f.data {
+		if f.get(key) != nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+
+		items := reply.([]interface{})
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i] = item.(string)
+		}
+
+		conn.Write([]byte(f.handle(args)))
+	}
+}
+
+func (f *fakeRedis) handle(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.commands = append(f.commands, strings.ToUpper(args[0]))
+
+	switch strings.ToUpper(args[0]) {
+	case "PING", "AUTH", "SELECT":
+		return "+OK\r\n"
+	case "SET":
+		// SET key value NX PX ttl
+		if f.get(args[1]) != nil {
+			return "$-1\r\n"
+		}
+		ttl, _ := strconv.Atoi(args[5])
+		f.data[args[1]] = &fakeEntry{value: args[2], expiresAt: time.Now().Add(time.Duration(ttl) * time.Millisecond)}
+		return "+OK\r\n"
+	case "EVAL":
+		// EVAL extendScript 1 key token ttl
+		if args[1] != extendScript {
+			return "-ERR unknown script\r\n"
+		}
+		entry := f.get(args[3])
+		if entry == nil || entry.value != args[4] {
+			return ":0\r\n"
+		}
+		ttl, _ := strconv.Atoi(args[5])
+		entry.expiresAt = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+		return ":1\r\n"
+	}
+
+	return "-ERR unknown command\r\n"
+}
+
+func newTestLocker(t *testing.T, url string) *RedisLocker {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	locker, err := NewRedisLocker(url, logrus.NewEntry(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return locker
+}
+
+var testJob = &crontab.Job{CrontabLine: crontab.CrontabLine{Schedule: "* * * * *", Command: "foo"}}
+
+func TestRedisLockerExclusive(t *testing.T) {
+	server := startFakeRedis(t)
+	defer server.Close()
+
+	a := newTestLocker(t, server.URL())
+	defer a.Close()
+	b := newTestLocker(t, server.URL())
+	defer b.Close()
+
+	scheduledAt := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	lockA, err := a.Acquire(testJob, scheduledAt)
+	assert.Nil(t, err)
+	assert.NotNil(t, lockA)
+
+	lockB, err := b.Acquire(testJob, scheduledAt)
+	assert.Nil(t, err)
+	assert.Nil(t, lockB)
+
+	// Other runs of the job are not locked
+	lockB, err = b.Acquire(testJob, scheduledAt.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.NotNil(t, lockB)
+	lockB.Release()
+
+	// Once released, the lock is kept so late replicas skip the run
+	lockA.Release()
+
+	lockB, err = b.Acquire(testJob, scheduledAt)
+	assert.Nil(t, err)
+	assert.Nil(t, lockB)
+}
+
+func TestRedisLockerHeartbeat(t *testing.T) {
+	defer func(ttl time.Duration) { LOCK_TTL = ttl }(LOCK_TTL)
+	LOCK_TTL = 150 * time.Millisecond
+
+	server := startFakeRedis(t)
+	defer server.Close()
+
+	locker := newTestLocker(t, server.URL())
+	defer locker.Close()
+
+	lock, err := locker.Acquire(testJob, time.Now())
+	if !assert.Nil(t, err) || !assert.NotNil(t, lock) {
+		return
+	}
+
+	time.Sleep(3 * LOCK_TTL)
+	assert.Len(t, server.keys(), 1)
+
+	lock.Release()
+
+	time.Sleep(2 * LOCK_TTL)
+	assert.Empty(t, server.keys())
+}
+
+func TestRedisLockerAuthAndSelect(t *testing.T) {
+	server := startFakeRedis(t)
+	defer server.Close()
+
+	url := strings.Replace(server.URL(), "redis://", "redis://:secret@", 1) + "/2"
+
+	locker := newTestLocker(t, url)
+	defer locker.Close()
+
+	assert.Nil(t, locker.Ping())
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Equal(t, []string{"AUTH", "SELECT", "PING"}, server.commands)
+}
+
+func TestRedisLockerReportsErrors(t *testing.T) {
+	server := startFakeRedis(t)
+	server.Close()
+
+	locker := newTestLocker(t, server.URL())
+	defer locker.Close()
+
+	_, err := locker.Acquire(testJob, time.Now())
+	assert.NotNil(t, err)
+}
+
+func TestNewRedisLockerRejectsBadURLs(t *testing.T) {
+	for _, url := range []string{"http://localhost", "redis://localhost/foo"} {
+		_, err := NewRedisLocker(url, nil)
+		assert.NotNil(t, err, url)
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("*3\r\n$3\r\nfoo\r\n:42\r\n$-1\r\n-ERR nope\r\n"))
+
+	reply, err := readReply(r)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"foo", int64(42), nil}, reply)
+
+	_, err = readReply(r)
+	assert.Equal(t, redisError("ERR nope"), err)
+}
@@ -0,0 +1,27 @@
+package hook
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// Clone returns a new logger that writes like logger, and has the same hooks
+// except those that skip returns true for. Hooks added to either logger
+// afterwards aren't shared.
+func Clone(logger *logrus.Logger, skip func(logrus.Hook) bool) *logrus.Logger {
+	clone := logrus.New()
+	clone.Out = logger.Out
+	clone.Formatter = logger.Formatter
+	clone.ReportCaller = logger.ReportCaller
+	clone.ExitFunc = logger.ExitFunc
+	clone.SetLevel(logger.GetLevel())
+
+	for level, hooks := range logger.Hooks {
+		for _, h := range hooks {
+			if !skip(h) {
+				clone.Hooks[level] = append(clone.Hooks[level], h)
+			}
+		}
+	}
+
+	return clone
+}
@@ -0,0 +1,36 @@
+package hook
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+	kept := &recordingHook{}
+	skipped := &recordingHook{}
+	added := &recordingHook{}
+
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	log.SetLevel(logrus.WarnLevel)
+	log.AddHook(kept)
+	log.AddHook(skipped)
+
+	clone := Clone(log, func(h logrus.Hook) bool {
+		return h == skipped
+	})
+	clone.AddHook(added)
+
+	assert.Equal(t, ioutil.Discard, clone.Out)
+	assert.Equal(t, logrus.WarnLevel, clone.GetLevel())
+
+	clone.Info("filtered")
+	clone.Warn("from clone")
+	log.Warn("from original")
+
+	assert.Equal(t, []string{"from clone", "from original"}, kept.messages)
+	assert.Equal(t, []string{"from original"}, skipped.messages)
+	assert.Equal(t, []string{"from clone"}, added.messages)
+}
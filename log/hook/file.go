@@ -0,0 +1,17 @@
+package hook
+
+import (
+	"github.com/sirupsen/logrus"
+	"io"
+)
+
+// RegisterFileLogger copies all of logger's output to writer (typically a
+// logfile.Writer), in addition to wherever it already goes. If formatter is
+// nil, the logger's own formatter is used.
+func RegisterFileLogger(logger *logrus.Logger, writer io.Writer, formatter logrus.Formatter) {
+	logger.AddHook(&writerHook{
+		writer:    writer,
+		levels:    logrus.AllLevels,
+		formatter: formatter,
+	})
+}
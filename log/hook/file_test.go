@@ -0,0 +1,31 @@
+package hook
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestFileLoggerHook_Fire(t *testing.T) {
+	fileWriter := testWriter{c: make(chan []byte, 2)}
+
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	log.SetLevel(logrus.DebugLevel)
+
+	RegisterFileLogger(log, fileWriter, &logrus.JSONFormatter{})
+
+	log.Debug("debug")
+	log.Error("error")
+
+	for _, expected := range []string{`"msg":"debug"`, `"msg":"error"`} {
+		select {
+		case log := <-fileWriter.c:
+			assert.Contains(t, string(log), expected)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for file log")
+		}
+	}
+}
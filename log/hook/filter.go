@@ -0,0 +1,23 @@
+package hook
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+type filterHook struct {
+	logrus.Hook
+	skip func(*logrus.Entry) bool
+}
+
+// Filter wraps h so that it doesn't fire for entries that skip returns true
+// for.
+func Filter(h logrus.Hook, skip func(*logrus.Entry) bool) logrus.Hook {
+	return &filterHook{Hook: h, skip: skip}
+}
+
+func (h *filterHook) Fire(entry *logrus.Entry) error {
+	if h.skip(entry) {
+		return nil
+	}
+	return h.Hook.Fire(entry)
+}
@@ -0,0 +1,37 @@
+package hook
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+)
+
+type recordingHook struct {
+	messages []string
+}
+
+func (h *recordingHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *recordingHook) Fire(entry *logrus.Entry) error {
+	h.messages = append(h.messages, entry.Message)
+	return nil
+}
+
+func TestFilter(t *testing.T) {
+	recorder := &recordingHook{}
+
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	log.AddHook(Filter(recorder, func(entry *logrus.Entry) bool {
+		_, ok := entry.Data["skip"]
+		return ok
+	}))
+
+	log.Info("kept")
+	log.WithField("skip", true).Info("skipped")
+
+	assert.Equal(t, []string{"kept"}, recorder.messages)
+}
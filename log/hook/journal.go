@@ -0,0 +1,202 @@
+package hook
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+// JOURNAL_SOCKET is where journald listens for entries sent via its native
+// protocol.
+var JOURNAL_SOCKET = "/run/systemd/journal/socket"
+
+// journalPriorities maps levels to syslog priorities.
+var journalPriorities = map[logrus.Level]int{
+	logrus.PanicLevel: 0, // emerg
+	logrus.FatalLevel: 2, // crit
+	logrus.ErrorLevel: 3, // err
+	logrus.WarnLevel:  4, // warning
+	logrus.InfoLevel:  6, // info
+	logrus.DebugLevel: 7, // debug
+}
+
+type journalHook struct {
+	// conn isn't connected to the journal's socket, since file descriptors
+	// can't be sent over connected sockets.
+	conn       *net.UnixConn
+	socket     *net.UnixAddr
+	identifier string
+}
+
+// RegisterJournalLogger sends all of logger's output to the systemd journal
+// instead of wherever it goes. Fields are sent as journal fields (e.g.
+// job.name as JOB_NAME) and the level as PRIORITY, so that journalctl can
+// show and filter on them. Entries are tagged with identifier (as
+// SYSLOG_IDENTIFIER), unless they have a prefix field.
+func RegisterJournalLogger(logger *logrus.Logger, identifier string) error {
+	if _, err := os.Stat(JOURNAL_SOCKET); err != nil {
+		return err
+	}
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+
+	logger.SetOutput(ioutil.Discard)
+	logger.AddHook(&journalHook{
+		conn:       conn,
+		socket:     &net.UnixAddr{Name: JOURNAL_SOCKET, Net: "unixgram"},
+		identifier: identifier,
+	})
+
+	return nil
+}
+
+func (h *journalHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *journalHook) Fire(entry *logrus.Entry) error {
+	data := journalEntry(entry, h.identifier)
+
+	_, err := h.conn.WriteToUnix(data, h.socket)
+	if err == nil || !isMessageTooLarge(err) {
+		return err
+	}
+
+	return h.sendViaFile(data)
+}
+
+// sendViaFile sends entries that don't fit in a datagram as journald expects
+// them: in a file whose descriptor is sent instead.
+func (h *journalHook) sendViaFile(data []byte) error {
+	dir := "/dev/shm"
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		dir = ""
+	}
+
+	file, err := ioutil.TempFile(dir, "supercronic-journal")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := os.Remove(file.Name()); err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+
+	_, _, err = h.conn.WriteMsgUnix(nil, syscall.UnixRights(int(file.Fd())), h.socket)
+	return err
+}
+
+func isMessageTooLarge(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if sysErr, ok := err.(*os.SyscallError); ok {
+		err = sysErr.Err
+	}
+	return err == syscall.EMSGSIZE || err == syscall.ENOBUFS
+}
+
+// journalEntry serializes entry per journald's native protocol.
+func journalEntry(entry *logrus.Entry, identifier string) []byte {
+	var buf bytes.Buffer
+
+	priority, ok := journalPriorities[entry.Level]
+	if !ok {
+		priority = 7
+	}
+
+	if prefix, ok := entry.Data["prefix"].(string); ok && prefix != "" {
+		identifier = prefix
+	}
+
+	writeJournalField(&buf, "MESSAGE", entry.Message)
+	writeJournalField(&buf, "PRIORITY", fmt.Sprint(priority))
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", identifier)
+
+	keys := make([]string, 0, len(entry.Data))
+	for key := range entry.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key == "prefix" {
+			continue
+		}
+
+		name := journalFieldName(key)
+		if name == "" {
+			continue
+		}
+
+		value := entry.Data[key]
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+
+		writeJournalField(&buf, name, fmt.Sprint(value))
+	}
+
+	return buf.Bytes()
+}
+
+// journalFieldName turns a field name into a journal field name, which may
+// only hold uppercase letters, digits, and underscores, and may not start
+// with an underscore (those are set by journald itself) or a digit. It returns
+// an empty string for fields that can't be named so.
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return '_'
+	}, key)
+
+	name = strings.TrimLeft(name, "_0123456789")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+
+	switch name {
+	case "MESSAGE", "PRIORITY", "SYSLOG_IDENTIFIER":
+		return "FIELD_" + name
+	}
+
+	return name
+}
+
+func writeJournalField(buf *bytes.Buffer, name string, value string) {
+	buf.WriteString(name)
+
+	// Values that span several lines are sent with their length instead.
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
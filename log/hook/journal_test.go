@@ -0,0 +1,160 @@
+package hook
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newJournalSocket(t *testing.T) (*net.UnixConn, func()) {
+	dir, err := ioutil.TempDir("", "supercronic-journal-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(dir, "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	oldSocket := JOURNAL_SOCKET
+	JOURNAL_SOCKET = socket
+
+	return conn, func() {
+		JOURNAL_SOCKET = oldSocket
+		conn.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// readJournalEntry reads an entry sent to conn, either directly or via a file
+// descriptor, and decodes its fields.
+func readJournalEntry(t *testing.T, conn *net.UnixConn) map[string]string {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	buf := make([]byte, 1<<20)
+	oob := make([]byte, syscall.CmsgSpace(4))
+
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf[:n]
+
+	if oobn > 0 {
+		messages, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			t.Fatal(err)
+		}
+		fds, err := syscall.ParseUnixRights(&messages[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		file := os.NewFile(uintptr(fds[0]), "journal")
+		defer file.Close()
+
+		file.Seek(0, 0)
+		if data, err = ioutil.ReadAll(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fields := make(map[string]string)
+	for len(data) > 0 {
+		i := bytes.IndexAny(data, "=\n")
+		if i < 0 {
+			t.Fatalf("malformed entry: %q", data)
+		}
+
+		name := string(data[:i])
+		if data[i] == '=' {
+			end := bytes.IndexByte(data, '\n')
+			fields[name] = string(data[i+1 : end])
+			data = data[end+1:]
+			continue
+		}
+
+		size := binary.LittleEndian.Uint64(data[i+1 : i+9])
+		fields[name] = string(data[i+9 : i+9+int(size)])
+		data = data[i+9+int(size)+1:]
+	}
+
+	return fields
+}
+
+func TestJournalHookSendsFields(t *testing.T) {
+	conn, cleanup := newJournalSocket(t)
+	defer cleanup()
+
+	logger := logrus.New()
+	var stdout bytes.Buffer
+	logger.SetOutput(&stdout)
+
+	if !assert.Nil(t, RegisterJournalLogger(logger, "supercronic")) {
+		return
+	}
+
+	logger.WithFields(logrus.Fields{
+		"job.name":    "backup",
+		"job.command": "backup.sh",
+		"iteration":   3,
+	}).Warn("multi\nline")
+
+	fields := readJournalEntry(t, conn)
+	assert.Equal(t, map[string]string{
+		"MESSAGE":           "multi\nline",
+		"PRIORITY":          "4",
+		"SYSLOG_IDENTIFIER": "supercronic",
+		"JOB_NAME":          "backup",
+		"JOB_COMMAND":       "backup.sh",
+		"ITERATION":         "3",
+	}, fields)
+
+	logger.WithField("prefix", "custom").Error("failed")
+
+	fields = readJournalEntry(t, conn)
+	assert.Equal(t, "3", fields["PRIORITY"])
+	assert.Equal(t, "custom", fields["SYSLOG_IDENTIFIER"])
+	assert.Equal(t, "failed", fields["MESSAGE"])
+
+	assert.Equal(t, "", stdout.String())
+}
+
+func TestJournalHookSendsLargeEntriesViaFile(t *testing.T) {
+	conn, cleanup := newJournalSocket(t)
+	defer cleanup()
+
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+
+	if !assert.Nil(t, RegisterJournalLogger(logger, "supercronic")) {
+		return
+	}
+
+	message := strings.Repeat("a", 512*1024)
+	logger.Info(message)
+
+	fields := readJournalEntry(t, conn)
+	assert.Equal(t, message, fields["MESSAGE"])
+	assert.Equal(t, "6", fields["PRIORITY"])
+}
+
+func TestJournalFieldName(t *testing.T) {
+	assert.Equal(t, "JOB_NAME", journalFieldName("job.name"))
+	assert.Equal(t, "ST", journalFieldName("_1st"))
+	assert.Equal(t, "FIELD_MESSAGE", journalFieldName("message"))
+	assert.Equal(t, "", journalFieldName("_"))
+}
@@ -0,0 +1,344 @@
+package hook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// LOKI_QUEUE_SIZE is how many entries may wait to be pushed to Loki.
+	// Entries logged while the queue is full are dropped, so that logging
+	// never blocks on Loki.
+	LOKI_QUEUE_SIZE = 10000
+
+	// LOKI_RETRY_DELAY is how long to wait before retrying a failed push.
+	// It doubles with every retry.
+	LOKI_RETRY_DELAY = time.Second
+
+	// LOKI_TIMEOUT bounds every push.
+	LOKI_TIMEOUT = 10 * time.Second
+)
+
+const (
+	defaultLokiBatchSize = 500
+	defaultLokiBatchWait = time.Second
+	defaultLokiRetries   = 5
+)
+
+// LokiConfig configures pushing logs to Grafana Loki.
+type LokiConfig struct {
+	// URL is Loki's push endpoint, e.g.
+	// http://loki:3100/loki/api/v1/push.
+	URL string `yaml:"url"`
+	// Tenant is sent as X-Scope-OrgID, for multi-tenant Loki deployments.
+	Tenant   string `yaml:"tenant"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	// Labels are added to every stream.
+	Labels map[string]string `yaml:"labels"`
+	// LabelFields are entry fields (e.g. job.name) that are turned into
+	// labels (e.g. job_name), in addition to the level.
+	LabelFields []string `yaml:"label_fields"`
+
+	// BatchSize is how many entries are pushed at once at most (500 by
+	// default), and BatchWait how long entries wait for a batch to fill up
+	// (1s by default).
+	BatchSize int           `yaml:"batch_size"`
+	BatchWait time.Duration `yaml:"batch_wait"`
+	// Retries is how many times failed pushes are retried (5 by default).
+	// Set it to -1 to not retry.
+	Retries int `yaml:"retries"`
+}
+
+var lokiLabelInvalid = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// lokiLabelName turns a field name into a valid label name.
+func lokiLabelName(field string) string {
+	name := lokiLabelInvalid.ReplaceAllString(field, "_")
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+type lokiEntry struct {
+	labels map[string]string
+	time   time.Time
+	line   string
+}
+
+// LokiHook pushes entries to Loki, in batches, from a goroutine of its own.
+// Use Close to push the entries that are still queued.
+type LokiHook struct {
+	config    LokiConfig
+	formatter logrus.Formatter
+	client    *http.Client
+
+	entries chan *lokiEntry
+	done    chan struct{}
+
+	// errors is where failures to push are reported, since they can't be
+	// logged.
+	errors io.Writer
+
+	mu      sync.Mutex
+	closed  bool
+	dropped int
+}
+
+// RegisterLokiLogger copies all of logger's output to Loki. If formatter is
+// nil, the logger's own formatter is used.
+func RegisterLokiLogger(logger *logrus.Logger, config LokiConfig, formatter logrus.Formatter) (*LokiHook, error) {
+	h, err := NewLokiHook(config, formatter)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.AddHook(h)
+	return h, nil
+}
+
+func NewLokiHook(config LokiConfig, formatter logrus.Formatter) (*LokiHook, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("loki: url is required")
+	}
+
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultLokiBatchSize
+	}
+
+	if config.BatchWait <= 0 {
+		config.BatchWait = defaultLokiBatchWait
+	}
+
+	if config.Retries == 0 {
+		config.Retries = defaultLokiRetries
+	}
+
+	for name := range config.Labels {
+		if lokiLabelName(name) != name {
+			return nil, fmt.Errorf("loki: invalid label name: %q", name)
+		}
+	}
+
+	h := &LokiHook{
+		config:    config,
+		formatter: formatter,
+		client:    &http.Client{Timeout: LOKI_TIMEOUT},
+		entries:   make(chan *lokiEntry, LOKI_QUEUE_SIZE),
+		done:      make(chan struct{}),
+		errors:    os.Stderr,
+	}
+
+	go h.run()
+
+	return h, nil
+}
+
+func (h *LokiHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *LokiHook) Fire(entry *logrus.Entry) error {
+	formatter := h.formatter
+	if formatter == nil {
+		formatter = entry.Logger.Formatter
+	}
+
+	serialized, err := formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+
+	labels := make(map[string]string, len(h.config.Labels)+len(h.config.LabelFields)+1)
+	for name, value := range h.config.Labels {
+		labels[name] = value
+	}
+	for _, field := range h.config.LabelFields {
+		if value, ok := entry.Data[field]; ok {
+			labels[lokiLabelName(field)] = fmt.Sprint(value)
+		}
+	}
+	labels["level"] = entry.Level.String()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil
+	}
+
+	select {
+	case h.entries <- &lokiEntry{labels: labels, time: entry.Time, line: strings.TrimSuffix(string(serialized), "\n")}:
+	default:
+		h.dropped++
+	}
+
+	return nil
+}
+
+// Close pushes the entries that are still queued. Entries logged afterwards
+// are dropped.
+func (h *LokiHook) Close() {
+	h.mu.Lock()
+	if !h.closed {
+		h.closed = true
+		close(h.entries)
+	}
+	h.mu.Unlock()
+
+	<-h.done
+}
+
+func (h *LokiHook) run() {
+	defer close(h.done)
+
+	batch := make([]*lokiEntry, 0, h.config.BatchSize)
+	var wait <-chan time.Time
+
+	flush := func() {
+		if len(batch) > 0 {
+			h.push(batch)
+			batch = batch[:0]
+		}
+		wait = nil
+	}
+
+	for {
+		select {
+		case entry, ok := <-h.entries:
+			if !ok {
+				flush()
+				return
+			}
+
+			batch = append(batch, entry)
+			if len(batch) >= h.config.BatchSize {
+				flush()
+			} else if wait == nil {
+				wait = time.After(h.config.BatchWait)
+			}
+		case <-wait:
+			flush()
+		}
+	}
+}
+
+func (h *LokiHook) push(batch []*lokiEntry) {
+	h.mu.Lock()
+	dropped := h.dropped
+	h.dropped = 0
+	h.mu.Unlock()
+
+	if dropped > 0 {
+		fmt.Fprintf(h.errors, "supercronic: dropped %d log entries, Loki is not keeping up\n", dropped)
+	}
+
+	body, err := json.Marshal(lokiPushRequest(batch))
+	if err != nil {
+		fmt.Fprintf(h.errors, "supercronic: failed to encode logs for Loki: %v\n", err)
+		return
+	}
+
+	delay := LOKI_RETRY_DELAY
+
+	for attempt := 0; ; attempt++ {
+		retry, err := h.post(body)
+		if err == nil {
+			return
+		}
+
+		if !retry || attempt >= h.config.Retries {
+			fmt.Fprintf(h.errors, "supercronic: failed to push %d log entries to Loki: %v\n", len(batch), err)
+			return
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (h *LokiHook) post(body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", h.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if h.config.Tenant != "" {
+		req.Header.Set("X-Scope-OrgID", h.config.Tenant)
+	}
+	if h.config.Username != "" || h.config.Password != "" {
+		req.SetBasicAuth(h.config.Username, h.config.Password)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("%s returned %s", h.config.URL, resp.Status)
+	}
+
+	return false, nil
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// lokiPushRequest groups batch into streams, per their labels, as Loki's push
+// API expects them. Entries are kept in order within each stream.
+func lokiPushRequest(batch []*lokiEntry) map[string][]*lokiStream {
+	streams := make([]*lokiStream, 0)
+	byKey := make(map[string]*lokiStream)
+
+	for _, entry := range batch {
+		key := lokiStreamKey(entry.labels)
+
+		stream, ok := byKey[key]
+		if !ok {
+			stream = &lokiStream{Stream: entry.labels}
+			byKey[key] = stream
+			streams = append(streams, stream)
+		}
+
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(entry.time.UnixNano(), 10), entry.line})
+	}
+
+	return map[string][]*lokiStream{"streams": streams}
+}
+
+func lokiStreamKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var key bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&key, "%s=%q,", name, labels[name])
+	}
+	return key.String()
+}
@@ -0,0 +1,160 @@
+package hook
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type lokiServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []map[string][]*lokiStream
+	tenants  []string
+	// failures is how many pushes fail before one succeeds.
+	failures int
+}
+
+func newLokiServer() *lokiServer {
+	s := &lokiServer{}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.failures > 0 {
+			s.failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var body map[string][]*lokiStream
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		s.requests = append(s.requests, body)
+		s.tenants = append(s.tenants, r.Header.Get("X-Scope-OrgID"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	return s
+}
+
+func newLokiLogger(t *testing.T, config LokiConfig) (*logrus.Logger, *LokiHook) {
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+
+	h, err := RegisterLokiLogger(log, config, &logrus.JSONFormatter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return log, h
+}
+
+func TestLokiHookPushesStreams(t *testing.T) {
+	server := newLokiServer()
+	defer server.Close()
+
+	log, h := newLokiLogger(t, LokiConfig{
+		URL:         server.URL,
+		Tenant:      "team-a",
+		Labels:      map[string]string{"app": "cron"},
+		LabelFields: []string{"job.name"},
+	})
+
+	log.WithField("job.name", "backup").Info("first")
+	log.WithField("job.name", "backup").Info("second")
+	log.WithField("job.name", "report").Warn("third")
+	log.Info("general")
+	h.Close()
+
+	if !assert.Equal(t, 1, len(server.requests)) {
+		return
+	}
+	assert.Equal(t, []string{"team-a"}, server.tenants)
+
+	streams := server.requests[0]["streams"]
+	if !assert.Equal(t, 3, len(streams)) {
+		return
+	}
+
+	assert.Equal(t, map[string]string{"app": "cron", "job_name": "backup", "level": "info"}, streams[0].Stream)
+	assert.Equal(t, map[string]string{"app": "cron", "job_name": "report", "level": "warning"}, streams[1].Stream)
+	assert.Equal(t, map[string]string{"app": "cron", "level": "info"}, streams[2].Stream)
+
+	if assert.Equal(t, 2, len(streams[0].Values)) {
+		assert.Contains(t, streams[0].Values[0][1], `"msg":"first"`)
+		assert.Contains(t, streams[0].Values[1][1], `"msg":"second"`)
+		assert.True(t, streams[0].Values[0][0] <= streams[0].Values[1][0])
+	}
+}
+
+func TestLokiHookBatches(t *testing.T) {
+	server := newLokiServer()
+	defer server.Close()
+
+	log, h := newLokiLogger(t, LokiConfig{URL: server.URL, BatchSize: 2, BatchWait: time.Hour})
+
+	for i := 0; i < 5; i++ {
+		log.Info("entry")
+	}
+	h.Close()
+
+	assert.Equal(t, 3, len(server.requests))
+}
+
+func TestLokiHookRetries(t *testing.T) {
+	delay := LOKI_RETRY_DELAY
+	LOKI_RETRY_DELAY = 10 * time.Millisecond
+	defer func() { LOKI_RETRY_DELAY = delay }()
+
+	server := newLokiServer()
+	defer server.Close()
+	server.failures = 2
+
+	log, h := newLokiLogger(t, LokiConfig{URL: server.URL, BatchWait: 10 * time.Millisecond})
+
+	var errors bytes.Buffer
+	h.errors = &errors
+
+	log.Info("entry")
+	h.Close()
+
+	assert.Equal(t, 1, len(server.requests))
+	assert.Equal(t, "", errors.String())
+
+	server.failures = 2
+	log, h = newLokiLogger(t, LokiConfig{URL: server.URL, Retries: -1})
+	h.errors = &errors
+
+	log.Info("entry")
+	h.Close()
+
+	assert.Equal(t, 1, len(server.requests))
+	assert.Contains(t, errors.String(), "failed to push 1 log entries to Loki")
+}
+
+func TestLokiConfigErrors(t *testing.T) {
+	_, err := NewLokiHook(LokiConfig{}, nil)
+	assert.NotNil(t, err)
+
+	_, err = NewLokiHook(LokiConfig{URL: "http://loki", Labels: map[string]string{"job.name": "x"}}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestLokiLabelName(t *testing.T) {
+	assert.Equal(t, "job_name", lokiLabelName("job.name"))
+	assert.Equal(t, "_1st", lokiLabelName("1st"))
+}
@@ -9,6 +9,8 @@ import (
 type writerHook struct {
 	writer io.Writer
 	levels []logrus.Level
+	// formatter overrides the logger's formatter, if set.
+	formatter logrus.Formatter
 }
 
 func (h *writerHook) Levels() []logrus.Level {
@@ -16,7 +18,12 @@ func (h *writerHook) Levels() []logrus.Level {
 }
 
 func (h *writerHook) Fire(entry *logrus.Entry) error {
-	serialized, err := entry.Logger.Formatter.Format(entry)
+	formatter := h.formatter
+	if formatter == nil {
+		formatter = entry.Logger.Formatter
+	}
+
+	serialized, err := formatter.Format(entry)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,158 @@
+// Package logfile writes logs to files that are rotated once they grow too
+// large or too old.
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type Options struct {
+	// MaxSize is in bytes. Zero means no limit.
+	MaxSize uint64
+	// MaxAge is how long a file is written to before being rotated. Zero
+	// means no limit.
+	MaxAge time.Duration
+	// Keep is how many rotated files are kept around.
+	Keep int
+}
+
+// Writer appends to the file at path. Rotated files are renamed to path.1,
+// path.2, and so on, path.1 being the most recent.
+//
+// The file is opened on the first write, and may be closed at any time
+// (e.g. when a job finishes) to stop holding on to it: the next write will
+// re-open it.
+type Writer struct {
+	path    string
+	options Options
+
+	mu   sync.Mutex
+	file *os.File
+	size uint64
+	// born is when we started writing to the current file. Since we can't
+	// tell when a file that already existed was created, its age is counted
+	// from the first time we open it.
+	born time.Time
+}
+
+func New(path string, options Options) *Writer {
+	return &Writer{path: path, options: options}
+}
+
+func (w *Writer) Path() string {
+	return w.path
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.shouldRotate(len(p)) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += uint64(n)
+	return n, err
+}
+
+// Close closes the file, if it is open.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *Writer) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	w.file = file
+	w.size = uint64(info.Size())
+
+	if w.born.IsZero() {
+		w.born = time.Now()
+	}
+
+	return nil
+}
+
+func (w *Writer) shouldRotate(n int) bool {
+	// Never rotate an empty file, even if a single write exceeds MaxSize.
+	if w.size == 0 {
+		return false
+	}
+
+	if w.options.MaxSize > 0 && w.size+uint64(n) > w.options.MaxSize {
+		return true
+	}
+
+	if w.options.MaxAge > 0 && time.Since(w.born) >= w.options.MaxAge {
+		return true
+	}
+
+	return false
+}
+
+func (w *Writer) backupPath(i int) string {
+	return fmt.Sprintf("%s.%d", w.path, i)
+}
+
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+
+	for i := w.options.Keep - 1; i >= 1; i-- {
+		err := os.Rename(w.backupPath(i), w.backupPath(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	var err error
+	if w.options.Keep > 0 {
+		err = os.Rename(w.path, w.backupPath(1))
+	} else {
+		err = os.Remove(w.path)
+	}
+
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	w.born = time.Now()
+	return w.open()
+}
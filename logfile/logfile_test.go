@@ -0,0 +1,91 @@
+package logfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestWriterRotatesBySize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-logfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "jobs", "job.log")
+	w := New(path, Options{MaxSize: 10, Keep: 2})
+
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "gggg\n"} {
+		_, err := w.Write([]byte(line))
+		assert.Nil(t, err)
+	}
+
+	assert.Nil(t, w.Close())
+
+	assert.Equal(t, "gggg\n", readFile(t, path))
+	assert.Equal(t, "eeee\nffff\n", readFile(t, path+".1"))
+	assert.Equal(t, "cccc\ndddd\n", readFile(t, path+".2"))
+
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestWriterRotatesByAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-logfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "job.log")
+	w := New(path, Options{MaxAge: 50 * time.Millisecond, Keep: 1})
+
+	_, err = w.Write([]byte("old\n"))
+	assert.Nil(t, err)
+
+	// The file is re-opened, but keeps its age.
+	assert.Nil(t, w.Close())
+	time.Sleep(100 * time.Millisecond)
+
+	_, err = w.Write([]byte("new\n"))
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+
+	assert.Equal(t, "new\n", readFile(t, path))
+	assert.Equal(t, "old\n", readFile(t, path+".1"))
+}
+
+func TestWriterAppends(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-logfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "job.log")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("before\n"), 0644))
+
+	w := New(path, Options{MaxSize: 10})
+
+	_, err = w.Write([]byte("after\n"))
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+
+	// With nothing to keep, the old file is discarded.
+	assert.Equal(t, "after\n", readFile(t, path))
+	_, err = os.Stat(path + ".1")
+	assert.True(t, os.IsNotExist(err))
+}
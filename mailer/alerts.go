@@ -0,0 +1,138 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"supercronic/cron"
+)
+
+type AlertConfig struct {
+	To []string `yaml:"to"`
+	// From overrides the sender address of the smtp settings.
+	From string `yaml:"from"`
+
+	// Failures is how many times in a row a job must fail for an alert to
+	// be sent (1 by default).
+	Failures int `yaml:"failures"`
+}
+
+// AlertHook emails a summary of a job's run, with its output attached, when
+// the job has failed Failures times in a row, or has been running for longer
+// than its expected duration. Failures are only reported once per streak.
+type AlertHook struct {
+	mailer   *Mailer
+	config   AlertConfig
+	hostname string
+
+	mu sync.Mutex
+	// failures counts the consecutive failures of each job, by key.
+	failures map[string]int
+}
+
+func NewAlertHook(mailer *Mailer, config AlertConfig) (*AlertHook, error) {
+	if len(config.To) == 0 {
+		return nil, fmt.Errorf("email alerts have no recipients")
+	}
+
+	if config.Failures < 0 {
+		return nil, fmt.Errorf("email alerts failures must not be negative")
+	}
+
+	if config.Failures == 0 {
+		config.Failures = 1
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	return &AlertHook{
+		mailer:   mailer,
+		config:   config,
+		hostname: hostname,
+		failures: make(map[string]int),
+	}, nil
+}
+
+func (h *AlertHook) JobStarted(e *cron.Execution) {}
+
+func (h *AlertHook) JobFinished(e *cron.Execution) {
+	key := e.Job.Source + " " + e.Job.Key()
+
+	h.mu.Lock()
+	if e.Err == nil {
+		delete(h.failures, key)
+		h.mu.Unlock()
+		return
+	}
+	h.failures[key]++
+	failures := h.failures[key]
+	h.mu.Unlock()
+
+	if failures != h.config.Failures {
+		return
+	}
+
+	what := "failed"
+	if failures > 1 {
+		what = fmt.Sprintf("failed %d times in a row", failures)
+	}
+
+	h.send(e, what)
+}
+
+func (h *AlertHook) JobOverran(e *cron.Execution) {
+	h.send(e, fmt.Sprintf("has been running for longer than expected (%v)", e.Job.ExpectedDuration))
+}
+
+func (h *AlertHook) send(e *cron.Execution, what string) {
+	label := e.Job.Name
+	if label == "" {
+		label = e.Job.Command
+	}
+
+	subject := fmt.Sprintf("Cron <%s> %s %s", h.hostname, label, what)
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "Job %s on %s.\n\n", what, h.hostname)
+	if e.Job.Name != "" {
+		fmt.Fprintf(&body, "Name:       %s\n", e.Job.Name)
+	}
+	fmt.Fprintf(&body, "Command:    %s\n", e.Job.Command)
+	fmt.Fprintf(&body, "Schedule:   %s\n", e.Job.Schedule)
+	if e.Job.Source != "" {
+		fmt.Fprintf(&body, "Source:     %s\n", e.Job.Source)
+	}
+	fmt.Fprintf(&body, "Started at: %s\n", e.StartedAt.Format(time.RFC3339))
+	fmt.Fprintf(&body, "Duration:   %v\n", e.Duration().Round(time.Millisecond))
+	if !e.FinishedAt.IsZero() {
+		fmt.Fprintf(&body, "Exit code:  %d\n", e.ExitCode)
+	}
+	if e.Err != nil {
+		fmt.Fprintf(&body, "Error:      %v\n", e.Err)
+	}
+
+	output := e.Output.String()
+	if e.Output.Truncated() {
+		output = "(earlier output truncated)\n" + output
+	}
+
+	attachments := []Attachment{}
+	if e.Output.Len() > 0 {
+		attachments = append(attachments, Attachment{Name: "output.txt", Content: []byte(output)})
+	} else {
+		body.WriteString("\nThe job did not write any output.\n")
+	}
+
+	if err := h.mailer.Send(h.config.From, h.config.To, subject, body.String(), attachments...); err != nil {
+		e.Logger.Errorf("failed to send email alert: %v", err)
+		return
+	}
+
+	e.Logger.Debugf("sent email alert to %v", h.config.To)
+}
@@ -0,0 +1,94 @@
+package mailer
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func expectMessage(t *testing.T, messages chan *testMessage) *testMessage {
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for message")
+		return nil
+	}
+}
+
+func expectNoMessage(t *testing.T, messages chan *testMessage) {
+	select {
+	case <-messages:
+		t.Errorf("unexpected message")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNewAlertHookValidatesConfig(t *testing.T) {
+	_, err := NewAlertHook(New(Config{}), AlertConfig{})
+	assert.NotNil(t, err)
+
+	_, err = NewAlertHook(New(Config{}), AlertConfig{To: []string{"ops@example.com"}, Failures: -1})
+	assert.NotNil(t, err)
+}
+
+func TestAlertHookReportsConsecutiveFailures(t *testing.T) {
+	config, messages, stop := startTestServer(t)
+	defer stop()
+
+	hook, err := NewAlertHook(New(config), AlertConfig{To: []string{"ops@example.com"}, Failures: 2})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	failure := errors.New("exit status 1")
+
+	hook.JobFinished(newTestExecution(nil, failure, "hello"))
+	expectNoMessage(t, messages)
+
+	hook.JobFinished(newTestExecution(nil, failure, "hello"))
+	msg := expectMessage(t, messages)
+	assert.Equal(t, []string{"ops@example.com"}, msg.to)
+	assert.Contains(t, msg.data, "echo hello failed 2 times in a row")
+	assert.Contains(t, msg.data, "Error:      exit status 1\n")
+	assert.Contains(t, msg.data, "Content-Disposition: attachment; filename=output.txt\n")
+	assert.Contains(t, msg.data, base64.StdEncoding.EncodeToString([]byte("hello\n")))
+
+	// Failures are reported once per streak.
+	hook.JobFinished(newTestExecution(nil, failure))
+	expectNoMessage(t, messages)
+
+	hook.JobFinished(newTestExecution(nil, nil))
+	hook.JobFinished(newTestExecution(nil, failure))
+	expectNoMessage(t, messages)
+
+	hook.JobFinished(newTestExecution(nil, failure))
+	msg = expectMessage(t, messages)
+	assert.Contains(t, msg.data, "The job did not write any output.")
+	assert.NotContains(t, msg.data, "attachment")
+}
+
+func TestAlertHookReportsOverruns(t *testing.T) {
+	config, messages, stop := startTestServer(t)
+	defer stop()
+
+	hook, err := NewAlertHook(New(config), AlertConfig{To: []string{"ops@example.com"}, From: "alerts@example.com"})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	e := newTestExecution(nil, nil, "still going")
+	e.Job.Name = "backup"
+	e.Job.ExpectedDuration = time.Minute
+	e.StartedAt = time.Now().Add(-2 * time.Minute)
+
+	hook.JobOverran(e)
+
+	msg := expectMessage(t, messages)
+	assert.Equal(t, "alerts@example.com", msg.from)
+	assert.Contains(t, msg.data, "backup has been running for longer than expected (1m0s)")
+	assert.NotContains(t, msg.data, "Exit code:")
+}
@@ -0,0 +1,204 @@
+// Package mailer sends email through an SMTP relay.
+package mailer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	DIAL_TIMEOUT = 30 * time.Second
+	SEND_TIMEOUT = 2 * time.Minute
+)
+
+type Config struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+
+	// TLS makes the connection use TLS from the start (typically on port
+	// 465). Otherwise, STARTTLS is used if the server supports it.
+	TLS bool `yaml:"tls"`
+}
+
+type Mailer struct {
+	config Config
+}
+
+func New(config Config) *Mailer {
+	if config.Port == 0 {
+		config.Port = 25
+	}
+
+	if config.From == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "localhost"
+		}
+		config.From = fmt.Sprintf("supercronic@%s", hostname)
+	}
+
+	return &Mailer{config: config}
+}
+
+// Attachment is a file attached to an email.
+type Attachment struct {
+	Name    string
+	Content []byte
+}
+
+// Send emails body (and attachments, if any) to the to addresses. If from is
+// empty, the address from the configuration is used.
+func (m *Mailer) Send(from string, to []string, subject string, body string, attachments ...Attachment) error {
+	if from == "" {
+		from = m.config.From
+	}
+
+	if len(to) == 0 {
+		return fmt.Errorf("no recipients")
+	}
+
+	return m.send(from, to, buildMessage(from, to, subject, body, attachments))
+}
+
+func buildMessage(from string, to []string, subject string, body string, attachments []Attachment) []byte {
+	var msg bytes.Buffer
+
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+
+	if len(attachments) == 0 {
+		msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		msg.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+		msg.WriteString("\r\n")
+		msg.WriteString(body)
+
+		return msg.Bytes()
+	}
+
+	parts := multipart.NewWriter(&msg)
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n", parts.Boundary())
+	msg.WriteString("\r\n")
+
+	// Writing to a bytes.Buffer doesn't fail.
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	header.Set("Content-Transfer-Encoding", "8bit")
+
+	part, _ := parts.CreatePart(header)
+	io.WriteString(part, body)
+
+	for _, a := range attachments {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		header.Set("Content-Transfer-Encoding", "base64")
+		header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Name}))
+
+		part, _ := parts.CreatePart(header)
+		writeBase64(part, a.Content)
+	}
+
+	parts.Close()
+	return msg.Bytes()
+}
+
+// writeBase64 writes content in base64, wrapped at 76 characters per line
+// as RFC 2045 requires.
+func writeBase64(w io.Writer, content []byte) {
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 76 {
+		io.WriteString(w, encoded[:76]+"\r\n")
+		encoded = encoded[76:]
+	}
+	io.WriteString(w, encoded+"\r\n")
+}
+
+func (m *Mailer) send(from string, to []string, msg []byte) error {
+	host := m.config.Host
+	addr := net.JoinHostPort(host, strconv.Itoa(m.config.Port))
+	tlsConfig := &tls.Config{ServerName: host}
+
+	dialer := &net.Dialer{Timeout: DIAL_TIMEOUT}
+
+	var conn net.Conn
+	var err error
+
+	if m.config.TLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(SEND_TIMEOUT)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if !m.config.TLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		}
+	}
+
+	if m.config.Username != "" {
+		auth := smtp.PlainAuth("", m.config.Username, m.config.Password, host)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+
+	for _, addr := range to {
+		if err := client.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
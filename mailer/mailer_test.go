@@ -0,0 +1,199 @@
+package mailer
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+type testMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// startTestServer runs a minimal SMTP server that accepts every message and
+// sends it to the returned channel.
+func startTestServer(t *testing.T) (Config, chan *testMessage, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := make(chan *testMessage, 10)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestConn(conn, messages)
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	config := Config{Host: "127.0.0.1", Port: addr.Port, From: "cron@example.com"}
+
+	return config, messages, func() { listener.Close() }
+}
+
+func serveTestConn(conn net.Conn, messages chan *testMessage) {
+	defer conn.Close()
+
+	tp := textproto.NewConn(conn)
+	msg := &testMessage{}
+
+	tp.PrintfLine("220 localhost ESMTP")
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch verb {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 localhost")
+		case "MAIL":
+			msg.from = strings.Trim(strings.TrimPrefix(line, "MAIL FROM:"), "<>")
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			msg.to = append(msg.to, strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>"))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := ioutil.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			messages <- msg
+			msg = &testMessage{}
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	config, messages, stop := startTestServer(t)
+	defer stop()
+
+	err := New(config).Send("", []string{"ops@example.com"}, "hello", "some\nbody\n")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	select {
+	case msg := <-messages:
+		assert.Equal(t, "cron@example.com", msg.from)
+		assert.Equal(t, []string{"ops@example.com"}, msg.to)
+		assert.Contains(t, msg.data, "Subject: hello\n")
+		assert.Contains(t, msg.data, "\nsome\nbody\n")
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for message")
+	}
+}
+
+func TestSendConnectionRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	err = New(Config{Host: "127.0.0.1", Port: port}).Send("", []string{"ops@example.com"}, "hello", "body")
+	assert.NotNil(t, err)
+}
+
+func newTestExecution(environ map[string]string, err error, lines ...string) *cron.Execution {
+	output := &cron.Output{}
+	for _, line := range lines {
+		output.Append("stdout", line)
+	}
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	return &cron.Execution{
+		Job: &crontab.Job{
+			CrontabLine: crontab.CrontabLine{Schedule: "* * * * *", Command: "echo hello"},
+		},
+		Context: &crontab.Context{Shell: "/bin/sh", Environ: environ},
+		Logger:  logrus.NewEntry(logger),
+		Err:     err,
+		Output:  output,
+	}
+}
+
+var mailtoTestCases = []struct {
+	environ  map[string]string
+	err      error
+	lines    []string
+	to       []string
+	contains []string
+}{
+	{map[string]string{}, errors.New("boom"), []string{"hello"}, nil, nil},
+	{map[string]string{"MAILTO": ""}, errors.New("boom"), []string{"hello"}, nil, nil},
+	{map[string]string{"MAILTO": "ops@example.com"}, nil, []string{}, nil, nil},
+	{
+		map[string]string{"MAILTO": "ops@example.com"}, nil, []string{"hello"},
+		[]string{"ops@example.com"}, []string{"\nhello\n"},
+	},
+	{
+		map[string]string{"MAILTO": "ops@example.com, dev@example.com"}, errors.New("exit status 1"), []string{},
+		[]string{"ops@example.com", "dev@example.com"}, []string{"exit status 1"},
+	},
+}
+
+func TestMailtoHook(t *testing.T) {
+	config, messages, stop := startTestServer(t)
+	defer stop()
+
+	hook := NewMailtoHook(New(config))
+
+	for i, tt := range mailtoTestCases {
+		label := strconv.Itoa(i)
+
+		hook.JobFinished(newTestExecution(tt.environ, tt.err, tt.lines...))
+
+		if tt.to == nil {
+			select {
+			case <-messages:
+				t.Errorf("unexpected message (%s)", label)
+			case <-time.After(100 * time.Millisecond):
+			}
+			continue
+		}
+
+		select {
+		case msg := <-messages:
+			assert.Equal(t, tt.to, msg.to, label)
+			assert.Contains(t, msg.data, "Subject: Cron <", label)
+			for _, s := range tt.contains {
+				assert.Contains(t, msg.data, s, label)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("timed out waiting for message (%s)", label)
+		}
+	}
+}
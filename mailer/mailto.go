@@ -0,0 +1,64 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"supercronic/cron"
+)
+
+// MailtoHook emails the output of jobs to the addresses listed in the
+// crontab's MAILTO variable, like Vixie cron does: mail is sent when a job
+// fails or produces output. MAILFROM overrides the sender address.
+type MailtoHook struct {
+	mailer   *Mailer
+	hostname string
+}
+
+func NewMailtoHook(mailer *Mailer) *MailtoHook {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	return &MailtoHook{mailer: mailer, hostname: hostname}
+}
+
+func (h *MailtoHook) JobStarted(e *cron.Execution) {}
+
+func (h *MailtoHook) JobFinished(e *cron.Execution) {
+	mailto := e.Context.Environ["MAILTO"]
+
+	to := make([]string, 0)
+	for _, addr := range strings.Split(mailto, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			to = append(to, addr)
+		}
+	}
+
+	if len(to) == 0 {
+		return
+	}
+
+	if e.Err == nil && e.Output.Len() == 0 {
+		return
+	}
+
+	subject := fmt.Sprintf("Cron <%s> %s", h.hostname, e.Job.Command)
+
+	body := e.Output.String()
+	if e.Output.Truncated() {
+		body = "(earlier output truncated)\n" + body
+	}
+	if e.Err != nil {
+		body = fmt.Sprintf("%s\n%v\n", body, e.Err)
+	}
+
+	if err := h.mailer.Send(e.Context.Environ["MAILFROM"], to, subject, body); err != nil {
+		e.Logger.Errorf("failed to mail job output to %s: %v", mailto, err)
+		return
+	}
+
+	e.Logger.Debugf("mailed job output to %s", mailto)
+}
@@ -4,37 +4,273 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"github.com/evalphobia/logrus_sentry"
 	"github.com/sirupsen/logrus"
 	prefixed "github.com/x-cray/logrus-prefixed-formatter"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"supercronic/admin"
+	"supercronic/archive"
+	"supercronic/audit"
+	"supercronic/callback"
+	"supercronic/config"
 	"supercronic/cron"
 	"supercronic/crontab"
+	"supercronic/ctl"
+	"supercronic/dashboard"
+	"supercronic/exechelper"
+	"supercronic/healthcheck"
+	"supercronic/history"
+	"supercronic/kubejob"
+	"supercronic/leader"
+	"supercronic/lock"
 	"supercronic/log/hook"
-	"sync"
+	"supercronic/logfile"
+	"supercronic/mailer"
+	"supercronic/notify"
+	"supercronic/platform"
+	"supercronic/pushgateway"
+	"supercronic/reaper"
+	"supercronic/remote"
+	"supercronic/results"
+	"supercronic/runner"
+	"supercronic/sdnotify"
+	"supercronic/secrets"
+	sentryhook "supercronic/sentry"
+	"supercronic/statsd"
+	"supercronic/textfile"
+	"supercronic/tracing"
+	"supercronic/watch"
 	"syscall"
 	"time"
 )
 
 var Usage = func() {
-	fmt.Fprintf(os.Stderr, "Usage: %s [OPTIONS] CRONTAB\n\nAvailable options:\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %[1]s [run] [OPTIONS] CRONTAB...\n       %[1]s test [OPTIONS] CRONTAB...\n       %[1]s lint [OPTIONS] CRONTAB...\n       %[1]s next [OPTIONS] SCHEDULE|CRONTAB...\n       %[1]s fmt [OPTIONS] [FILE...]\n       %[1]s trigger [OPTIONS] JOB\n       %[1]s top [OPTIONS]\n       %[1]s ctl [OPTIONS] COMMAND [ARGS]\n\nEach CRONTAB may be a file, a directory, a glob, or a URL (or be set via SUPERCRONIC_CRONTAB).\nRun `%[1]s COMMAND -h` for the options of each command; those below are run's.\n\nOptions not passed may be set via SUPERCRONIC_* variables (e.g. SUPERCRONIC_LOG_FILE for -log-file),\nor in the flags section of the configuration file.\n\nAvailable options:\n", os.Args[0])
 	flag.PrintDefaults()
 }
 
+// trigger runs a job in a running supercronic through its admin API, and
+// returns the status to exit with.
+func trigger(args []string) int {
+	flags := flag.NewFlagSet("trigger", flag.ExitOnError)
+	adminAddr := flags.String("admin-addr", "127.0.0.1:9746", "address of the admin API of the running supercronic (per its -admin-listen)")
+	adminToken := flags.String("admin-token", os.Getenv("SUPERCRONIC_ADMIN_TOKEN"), "token the admin API requires, if any (per its -admin-token; defaults to $SUPERCRONIC_ADMIN_TOKEN)")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s trigger [OPTIONS] JOB\n\nRun JOB (a job name or ID) now, and show its output.\n\nAvailable options:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	result, err := admin.Trigger(*adminAddr, *adminToken, flags.Arg(0), os.Stdout, os.Stderr)
+	if err != nil {
+		logrus.Errorf("could not trigger job: %v", err)
+		return 1
+	}
+
+	if result.Error == "" {
+		return 0
+	}
+
+	logrus.Errorf("job failed: %s", result.Error)
+
+	// Jobs that didn't exit normally still need to be reported as a failure.
+	if result.ExitCode > 0 {
+		return result.ExitCode
+	}
+	return 1
+}
+
+func top(args []string) int {
+	flags := flag.NewFlagSet("top", flag.ExitOnError)
+	adminAddr := flags.String("admin-addr", "127.0.0.1:9746", "address of the admin API of the running supercronic (per its -admin-listen)")
+	interval := flags.Duration("interval", time.Second, "refresh the dashboard this often")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s top [OPTIONS]\n\nShow the jobs of a running supercronic, and the output of the selected one.\n\nAvailable options:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 0 || *interval <= 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if err := dashboard.Run(*adminAddr, *interval, os.Stdin); err != nil {
+		logrus.Errorf("could not show dashboard: %v", err)
+		return 1
+	}
+
+	return 0
+}
+
+// isHandledSignal reports whether supercronic acts on sig itself, in which
+// case it can't be forwarded to jobs.
+func isHandledSignal(sig os.Signal) bool {
+	handled := append([]os.Signal{platform.ReloadSignal, platform.DumpSignal}, platform.ShutdownSignals...)
+	for _, s := range handled {
+		if s == sig {
+			return true
+		}
+	}
+	return false
+}
+
+// schedulingStatus describes what supercronic does once tabs are scheduled,
+// for systemctl status.
+func schedulingStatus(tabs []*crontab.Crontab) string {
+	if tabs == nil {
+		return "waiting to be elected leader"
+	}
+
+	jobs := 0
+	for _, tab := range tabs {
+		jobs += len(tab.Jobs)
+	}
+	return fmt.Sprintf("scheduling %d job(s)", jobs)
+}
+
 func main() {
+	if exechelper.IsHelper() {
+		exechelper.Main()
+	}
+
+	if kubejob.IsHelper() {
+		kubejob.Main()
+	}
+
+	if filepath.Base(os.Args[0]) == ctl.Name {
+		os.Exit(ctl.Main(ctl.Name, os.Args[1:], os.Stdout, os.Stderr))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		os.Exit(ctl.Main(os.Args[0]+" ctl", os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "trigger" {
+		os.Exit(trigger(os.Args[2:]))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "top" {
+		os.Exit(top(os.Args[2:]))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "test" {
+		os.Exit(testCrontabs(os.Args[2:]))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "next" {
+		os.Exit(nextRuns(os.Args[2:]))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		os.Exit(lintCrontabs(os.Args[2:]))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		os.Exit(formatCrontabs(os.Args[2:]))
+	}
+
+	// `supercronic run` is the bare invocation, spelled out.
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
+	// Startup delays count from here, not from when the crontab is read.
+	startedAt := time.Now()
+
 	debug := flag.Bool("debug", false, "enable debug logging")
 	json := flag.Bool("json", false, "enable JSON logging")
 	test := flag.Bool("test", false, "test crontab (does not run jobs)")
+	runAtStartup := flag.Bool("run-at-startup", false, "run every job when supercronic starts, then on its schedule (jobs can override this with a run_at_startup directive)")
+	startupDelay := flag.Duration("startup-delay", 0, "wait this long after supercronic starts before scheduling jobs, e.g. for sidecars to be ready (jobs can override this with a startup_delay directive)")
+	runOnce := flag.Bool("run-once", false, "run every job once, right away, wait for them to finish, and exit (with a non-zero status if any of them did not succeed)")
+	strict := flag.Bool("strict", false, "test crontab, and also fail on suspicious constructs, e.g. undefined variables or schedules that never fire (does not run jobs)")
+	dryRun := flag.Int("dry-run", 0, "test crontab, and show when each job would run next, this many times (does not run jobs)")
 	splitLogs := flag.Bool("split-logs", false, "split log output into stdout/stderr")
+	journald := flag.Bool("journald", false, "log to the systemd journal, with structured fields (e.g. JOB_NAME), instead of stdout")
+	noShell := flag.Bool("no-shell", false, "run commands directly, without a shell (jobs can override this with an exec directive)")
+	quietSuccess := flag.Bool("quiet-success", false, "only log the output of jobs that fail (once they fail), and a summary for jobs that succeed")
+	readBufferSize := flag.Int("read-buffer-size", cron.READ_BUFFER_SIZE, "read job output in chunks of this many bytes; longer lines are handled per -long-lines")
+	longLines := flag.String("long-lines", "split", "how to log lines of output longer than -read-buffer-size: split (into chunks), truncate, or accumulate (up to -max-line-size)")
+	maxLineSize := flag.Int("max-line-size", cron.DEFAULT_MAX_LINE_SIZE, "with -long-lines accumulate, truncate lines of output longer than this many bytes")
+	jobOutput := flag.String("output", "text", "format of job output: text, json (merge the fields of JSON lines into log entries), or raw (copy it to stdout and stderr as is, without logging it); jobs can override this with an output directive")
+	stderrLevel := flag.String("stderr-level", "info", "log lines jobs write to stderr at this level: info, warning, or error (jobs can override this with a stderr_level directive)")
+	errorPattern := flag.String("error-pattern", "", "log lines of job output that match this regular expression as errors (jobs can override this with an error_pattern directive)")
+	warningPattern := flag.String("warning-pattern", "", "log lines of job output that match this regular expression as warnings (jobs can override this with a warning_pattern directive)")
+	logFile := flag.String("log-file", "", "also write logs to this file")
+	logFileMaxSize := flag.Int("log-file-max-size", 100, "rotate the log file once it exceeds this many megabytes (0: no limit)")
+	logFileMaxAge := flag.Duration("log-file-max-age", 0, "rotate the log file once it has been written to for this long (default: no limit)")
+	logFileMaxBackups := flag.Int("log-file-max-backups", 5, "number of rotated log files to keep")
+	auditLog := flag.String("audit-log", "", "append a JSON record of every job execution to this file")
+	auditLogMaxSize := flag.Int("audit-log-max-size", 100, "rotate the audit log once it exceeds this many megabytes (0: no limit)")
+	auditLogMaxAge := flag.Duration("audit-log-max-age", 0, "rotate the audit log once it has been written to for this long (default: no limit)")
+	auditLogMaxBackups := flag.Int("audit-log-max-backups", 5, "number of rotated audit logs to keep")
 	sentry := flag.String("sentry-dsn", "", "enable Sentry error logging, using provided DSN")
 	sentryAlias := flag.String("sentryDsn", "", "alias for sentry-dsn")
 	sentryEnv := flag.String("sentryEnv", "", "environment tag for sentry-dsn")
+	sentryMonitors := flag.Bool("sentry-monitors", false, "check in to a Sentry cron monitor for every job (by default, only jobs with a sentry_monitor directive check in)")
 	logPrefix := flag.String("prefix", "supercronic", "prefix for the logs(stored in the field 'prefix' if json is enabled)")
+	statsdAddr := flag.String("statsd-addr", "", "send job metrics to the StatsD server at this address (e.g. 127.0.0.1:8125)")
+	statsdPrefix := flag.String("statsd-prefix", "supercronic", "prefix for StatsD metric names")
+	dogstatsd := flag.Bool("dogstatsd", false, "tag StatsD metrics using the DogStatsD format (instead of including tags in metric names)")
+	textfilePath := flag.String("textfile", "", "write job metrics to this file after every run, for node_exporter's textfile collector (e.g. /var/lib/node_exporter/textfile_collector/supercronic.prom)")
+	flag.String("config", "", "path to a YAML configuration file")
+	timezone := flag.String("timezone", "", "schedule jobs in this timezone (e.g. Europe/Berlin) instead of the local one, unless they follow a CRON_TZ or TZ variable")
+	dstSkipped := flag.String("dst-skipped", "run", "what to do about runs scheduled at times clocks skip when daylight saving time starts: run (right after clocks jump forward) or skip")
+	dstRepeated := flag.String("dst-repeated", "once", "what to do about runs scheduled at times clocks show twice when daylight saving time ends: once or twice")
+	seconds := flag.Bool("seconds", false, "parse 6-field expressions as seconds + POSIX (instead of POSIX + years)")
+	format := flag.String("format", "", "read crontabs in this format: crontab or yaml (default: yaml for files ending with .yaml or .yml, crontab otherwise)")
+	cleanEnv := flag.Bool("clean-env", false, "run jobs with the variables set in the crontab, but only a few of supercronic's own (e.g. PATH and HOME), instead of all of them")
+	template := flag.Bool("template", false, templateUsage)
+	templateValues := flag.String("values", "", valuesUsage)
+	onlyTags := flag.String("only-tags", "", onlyTagsUsage)
+	skipTags := flag.String("skip-tags", "", skipTagsUsage)
+	expandEnv := flag.Bool("expand-env", false, "expand $VAR and ${VAR} in crontab commands and variables, using crontab variables and the environment")
+	watchCrontab := flag.Bool("watch", false, "reload the crontab automatically when it changes on disk")
+	remotePollInterval := flag.Duration("remote-poll-interval", time.Minute, "fetch CRONTAB arguments that are URLs (http://, https://, or s3://BUCKET/KEY) again this often, and reload the crontab when they change (0: only fetch them at startup)")
+	adminListen := flag.String("admin-listen", "", "serve the admin HTTP API (and web dashboard) on this address (e.g. 127.0.0.1:9746)")
+	controlSocket := flag.String("control-socket", "", "serve the admin API on a Unix socket at this path (only accessible to the current user), for supercronicctl (e.g. "+ctl.DEFAULT_SOCKET+")")
+	adminToken := flag.String("admin-token", "", "require this bearer token for admin API requests that control jobs, and enable the controls of the web dashboard")
+	adminDebug := flag.Bool("admin-debug", false, "also serve pprof profiles (under /debug/pprof/) and expvar variables (at /debug/vars) on the admin API")
+	debugListen := flag.String("debug-listen", "", "serve pprof profiles (under /debug/pprof/) and expvar variables (at /debug/vars) on this address, without authentication (e.g. 127.0.0.1:6060)")
+	historyDb := flag.String("history-db", "", "record job history in this database file")
+	lockRedisUrl := flag.String("lock-redis-url", "", "coordinate jobs across replicas using locks in Redis at this URL (e.g. redis://localhost:6379/0)")
+	cgroupParent := flag.String("cgroup-parent", "", "run jobs with limits in a cgroup (v2) under this one, e.g. /sys/fs/cgroup/supercronic")
+	catchUp := flag.String("catchup", "skip", "what to do about runs missed while supercronic was down: skip, run-once, or run-all (requires -history-db)")
+	jitter := flag.Duration("jitter", 0, "delay each scheduled run by a random amount up to this long")
+	maxConcurrentJobs := flag.Int("max-concurrent-jobs", 0, "run at most this many jobs at once; others wait for a slot (default: no limit)")
+	maxWorkers := flag.Int("max-workers", cron.MAX_WORKERS, "start at most this many runs of scheduled jobs at once; runs due while all workers are busy wait for one")
+
+	killOnExit := flag.Bool("kill-on-exit", false, "on shutdown, terminate running jobs instead of waiting for them")
+	graceTime := flag.Duration("grace-time", 0, "on shutdown or loss of leadership, terminate jobs that are still running after this long (default: wait for them on shutdown, terminate them right away on loss of leadership)")
+	passthroughExitCode := flag.Bool("passthrough-exit-code", false, "on shutdown, exit with the exit code of the first job that failed, if any")
+	failFast := flag.Bool("fail-fast", false, "shut down as soon as a job fails, terminating running jobs (implies -passthrough-exit-code)")
 
-	overlapping := flag.Bool("overlapping", false, "enable tasks overlapping")
+	overlap := flag.String("overlap", "skip", "what to do when a job is due while it is still running: skip, allow, queue, or replace")
+	overlapping := flag.Bool("overlapping", false, "enable tasks overlapping (alias for -overlap allow)")
+	forwardSignalNames := flag.String("forward-signals", "", "forward these signals (comma-separated, e.g. SIGHUP,SIGQUIT) to running jobs, instead of handling them")
+	initMode := flag.Bool("init", false, "when running as PID 1 (e.g. in a container without an init like tini), reap orphaned processes so that they don't linger as zombies")
 	flag.Parse()
 
+	// Flags that weren't passed may be set via the environment, or the
+	// configuration file.
+	cfg, err := config.Resolve(flag.CommandLine, os.Getenv)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	if *dryRun > 0 || *strict {
+		*test = true
+	}
+
 	var sentryDsn string
 
 	if *sentryAlias != "" {
@@ -55,6 +291,39 @@ func main() {
 		logrus.SetFormatter(&prefixed.TextFormatter{FullTimestamp: true})
 	}
 
+	var forwardSignals []os.Signal
+	if *forwardSignalNames != "" {
+		for _, name := range strings.Split(*forwardSignalNames, ",") {
+			name = strings.TrimSpace(name)
+
+			sig, err := platform.ParseSignal(name)
+			if err != nil {
+				logrus.Fatalf("bad -forward-signals: %v", err)
+			}
+
+			if isHandledSignal(sig) {
+				logrus.Fatalf("bad -forward-signals: supercronic handles %s itself", name)
+			}
+
+			forwardSignals = append(forwardSignals, sig)
+		}
+	}
+
+	// The reaper runs supercronic again as its child, which does the rest.
+	if *initMode {
+		reaper.Init(logrus.WithField("prefix", *logPrefix), forwardSignals)
+	}
+
+	if *journald && *splitLogs {
+		logrus.Fatalf("-journald and -split-logs can't be used together")
+	}
+
+	if *journald {
+		if err := hook.RegisterJournalLogger(logrus.StandardLogger(), *logPrefix); err != nil {
+			logrus.Fatalf("could not log to the journal: %s", err)
+		}
+	}
+
 	if *splitLogs {
 		hook.RegisterSplitLogger(
 			logrus.StandardLogger(),
@@ -63,94 +332,743 @@ func main() {
 		)
 	}
 
-	if flag.NArg() != 1 {
+	if *logFile != "" {
+		w := logfile.New(*logFile, logfile.Options{
+			MaxSize: uint64(*logFileMaxSize) << 20,
+			MaxAge:  *logFileMaxAge,
+			Keep:    *logFileMaxBackups,
+		})
+		defer w.Close()
+
+		var formatter logrus.Formatter = &logrus.JSONFormatter{}
+		if !*json {
+			formatter = &prefixed.TextFormatter{FullTimestamp: true, DisableColors: true}
+		}
+
+		hook.RegisterFileLogger(logrus.StandardLogger(), w, formatter)
+	}
+
+	if cfg.Loki != nil && !*test {
+		var formatter logrus.Formatter = &logrus.JSONFormatter{}
+		if !*json {
+			formatter = &prefixed.TextFormatter{FullTimestamp: true, DisableColors: true}
+		}
+
+		lokiHook, err := hook.RegisterLokiLogger(logrus.StandardLogger(), *cfg.Loki, formatter)
+		if err != nil {
+			logrus.Fatalf("could not configure Loki: %s", err)
+		}
+		defer lokiHook.Close()
+	}
+
+	crontabPaths := flag.Args()
+	if len(crontabPaths) == 0 && os.Getenv(config.EnvPrefix+"CRONTAB") != "" {
+		crontabPaths = []string{os.Getenv(config.EnvPrefix + "CRONTAB")}
+	}
+
+	if len(crontabPaths) == 0 {
 		Usage()
 		os.Exit(2)
 		return
 	}
 	generalLogger := logrus.WithField("prefix", *logPrefix)
-	crontabFileName := flag.Args()[0]
 
-	var sentryHook *logrus_sentry.SentryHook
+	sentryClients := sentryhook.NewClients(sentryDsn, *sentryEnv)
+
+	var sentryLogHook logrus.Hook
 	if sentryDsn != "" {
-		sentryLevels := []logrus.Level{
-			logrus.PanicLevel,
-			logrus.FatalLevel,
-			logrus.ErrorLevel,
+		client, err := sentryClients.Get(sentryhook.Target{DSN: sentryDsn, Environment: *sentryEnv})
+		if err != nil {
+			generalLogger.Fatalf("Could not init sentry logger: %s", err)
 		}
-		sh, err := logrus_sentry.NewSentryHook(sentryDsn, sentryLevels)
+		sentryLogHook, err = sentryhook.NewLogHook(client)
 		if err != nil {
 			generalLogger.Fatalf("Could not init sentry logger: %s", err)
-		} else {
-			if *sentryEnv != "" {
-				sh.SetEnvironment(*sentryEnv)
-			}
-			sh.Timeout = 5 * time.Second
-			sentryHook = sh
 		}
+		logrus.StandardLogger().AddHook(sentryLogHook)
+	}
+
+	catchUpPolicy, err := crontab.ParseCatchUpPolicy(*catchUp)
+	if err != nil {
+		generalLogger.Fatal(err)
+	}
+
+	longLinePolicy, err := cron.ParseLongLinePolicy(*longLines)
+	if err != nil {
+		generalLogger.Fatal(err)
+	}
 
-		if sentryHook != nil {
-			logrus.StandardLogger().AddHook(sentryHook)
+	if *readBufferSize <= 0 || *maxLineSize <= 0 {
+		generalLogger.Fatal("-read-buffer-size and -max-line-size must be positive")
+	}
+	cron.READ_BUFFER_SIZE = *readBufferSize
+
+	if *maxWorkers <= 0 {
+		generalLogger.Fatal("-max-workers must be positive")
+	}
+	cron.MAX_WORKERS = *maxWorkers
+
+	if *startupDelay < 0 {
+		generalLogger.Fatal("-startup-delay must not be negative")
+	}
+
+	jobOutputFormat, err := crontab.ParseOutputFormat(*jobOutput)
+	if err != nil {
+		generalLogger.Fatal(err)
+	}
+
+	stderrOutputLevel, err := crontab.ParseOutputLevel(*stderrLevel)
+	if err != nil {
+		generalLogger.Fatal(err)
+	}
+
+	var errorOutputPattern, warningOutputPattern *regexp.Regexp
+	if *errorPattern != "" {
+		if errorOutputPattern, err = crontab.ParseOutputPattern(*errorPattern); err != nil {
+			generalLogger.Fatalf("bad -error-pattern: %v", err)
+		}
+	}
+	if *warningPattern != "" {
+		if warningOutputPattern, err = crontab.ParseOutputPattern(*warningPattern); err != nil {
+			generalLogger.Fatalf("bad -warning-pattern: %v", err)
 		}
 	}
 
-	for true {
-		generalLogger.Infof("read crontab: %s", crontabFileName)
-		tab, err := readCrontabAtPath(crontabFileName)
+	execMode := crontab.ExecShell
+	if *noShell {
+		execMode = crontab.ExecDirect
+	}
+
+	crontabFormat, err := crontab.ParseFormat(*format)
+	if err != nil {
+		generalLogger.Fatal(err)
+	}
+
+	dstSkippedPolicy, err := crontab.ParseDSTSkippedPolicy(*dstSkipped)
+	if err != nil {
+		generalLogger.Fatal(err)
+	}
+
+	dstRepeatedPolicy, err := crontab.ParseDSTRepeatedPolicy(*dstRepeated)
+	if err != nil {
+		generalLogger.Fatal(err)
+	}
+
+	tagFilter, err := parseTagFilter(*onlyTags, *skipTags)
+	if err != nil {
+		generalLogger.Fatal(err)
+	}
+
+	var location *time.Location
+	if *timezone != "" {
+		location, err = time.LoadLocation(*timezone)
+		if err != nil {
+			generalLogger.Fatalf("bad timezone: %s", err)
+		}
+		generalLogger.Debugf("scheduling jobs in timezone %s", location)
+	}
+
+	overlapPolicy, err := crontab.ParseOverlapPolicy(*overlap)
+	if err != nil {
+		generalLogger.Fatal(err)
+	}
+
+	if *overlapping {
+		overlapPolicy = crontab.OverlapAllow
+	}
+
+	hooks := []cron.Hook{healthcheck.NewHook(), callback.NewHook(cfg.Callbacks, *cleanEnv)}
+
+	// Deferred first so that it runs last, once everything else has been
+	// cleaned up.
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
+	var failures *cron.FailureTracker
+	var jobFailed <-chan struct{}
+	if *passthroughExitCode || *failFast || *runOnce {
+		failures = cron.NewFailureTracker()
+		hooks = append(hooks, failures)
+		if *failFast {
+			jobFailed = failures.Failed
+		}
+	}
+
+	if cfg.SMTP != nil {
+		hooks = append(hooks, mailer.NewMailtoHook(mailer.New(*cfg.SMTP)))
+	}
+
+	if cfg.EmailAlerts != nil {
+		if cfg.SMTP == nil {
+			generalLogger.Fatal("could not configure email alerts: no smtp settings")
+		}
+
+		alertHook, err := mailer.NewAlertHook(mailer.New(*cfg.SMTP), *cfg.EmailAlerts)
+		if err != nil {
+			generalLogger.Fatalf("could not configure email alerts: %s", err)
+		}
+		hooks = append(hooks, alertHook)
+	}
+
+	if cfg.Notify != nil {
+		notifyHook, err := notify.NewHook(*cfg.Notify)
+		if err != nil {
+			generalLogger.Fatalf("could not configure notifications: %s", err)
+		}
+		hooks = append(hooks, notifyHook)
+	}
+
+	if cfg.Tracing != nil {
+		tracingHook, err := tracing.NewHook(*cfg.Tracing)
+		if err != nil {
+			generalLogger.Fatalf("could not configure tracing: %s", err)
+		}
+		hooks = append(hooks, tracingHook)
+	}
+
+	if cfg.Pushgateway != nil {
+		pushgatewayHook, err := pushgateway.NewHook(*cfg.Pushgateway)
+		if err != nil {
+			generalLogger.Fatalf("could not configure pushgateway: %s", err)
+		}
+		hooks = append(hooks, pushgatewayHook)
+	}
+
+	if cfg.ResultWebhook != nil {
+		resultsHook, err := results.NewHook(*cfg.ResultWebhook)
+		if err != nil {
+			generalLogger.Fatalf("could not configure result webhook: %s", err)
+		}
+		defer resultsHook.Close()
+		hooks = append(hooks, resultsHook)
+	}
+
+	// Jobs may report to Sentry using a sentry_dsn directive, even if there
+	// is no default DSN.
+	hooks = append(hooks, sentryhook.NewHook(sentryClients))
 
+	monitorHook, err := sentryhook.NewMonitorHook(sentryDsn, *sentryEnv, *sentryMonitors)
+	if err != nil {
+		generalLogger.Fatalf("could not configure Sentry cron monitors: %s", err)
+	}
+	hooks = append(hooks, monitorHook)
+
+	if *statsdAddr != "" && !*test {
+		client, err := statsd.New(*statsdAddr, *statsdPrefix, *dogstatsd)
+		if err != nil {
+			generalLogger.Fatalf("could not configure StatsD: %s", err)
+		}
+		defer client.Close()
+		hooks = append(hooks, statsd.NewHook(client))
+	}
+
+	if *textfilePath != "" && !*test {
+		hooks = append(hooks, textfile.NewHook(*textfilePath))
+	}
+
+	if *auditLog != "" && !*test {
+		w := logfile.New(*auditLog, logfile.Options{
+			MaxSize: uint64(*auditLogMaxSize) << 20,
+			MaxAge:  *auditLogMaxAge,
+			Keep:    *auditLogMaxBackups,
+		})
+		defer w.Close()
+		hooks = append(hooks, audit.NewHook(w))
+	}
+
+	// Remote crontabs are read from local copies, which the fetcher keeps up
+	// to date.
+	var remoteChanged <-chan struct{}
+	if remote.HasURL(crontabPaths) {
+		interval := *remotePollInterval
+		if *test || *runOnce {
+			interval = 0
+		}
+
+		fetcher, err := remote.New(generalLogger, crontabPaths, interval)
 		if err != nil {
 			generalLogger.Fatal(err)
-			break
 		}
+		defer fetcher.Close()
 
-		if *test {
-			generalLogger.Info("crontab is valid")
-			os.Exit(0)
-			break
+		crontabPaths = fetcher.Paths()
+		remoteChanged = fetcher.C
+	}
+
+	var crontabChanged <-chan struct{}
+	if *watchCrontab && !*test && !*runOnce {
+		watcher, err := watch.New(generalLogger, crontabPaths...)
+		if err != nil {
+			generalLogger.Fatalf("could not watch crontab: %s", err)
+		}
+		defer watcher.Close()
+		crontabChanged = watcher.C
+	}
+
+	// Under systemd (with Type=notify), supercronic reports when it is ready,
+	// and pings the watchdog from the main loop below, so that systemd
+	// restarts it if the loop hangs.
+	var notifier *sdnotify.Notifier
+	var watchdog <-chan time.Time
+	if !*test {
+		n, err := sdnotify.New(generalLogger)
+		if err != nil {
+			generalLogger.Warnf("could not notify systemd: %s", err)
+		}
+		notifier = n
+		defer notifier.Close()
+
+		if interval := notifier.WatchdogInterval(); interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			watchdog = ticker.C
+		}
+	}
+
+	var store *history.Store
+	if *historyDb != "" && !*test {
+		s, err := history.Open(*historyDb)
+		if err != nil {
+			generalLogger.Fatalf("could not open history database: %s", err)
+		}
+		defer s.Close()
+		store = s
+		hooks = append(hooks, history.NewHook(store))
+	}
+
+	// The admin API streams events for every run.
+	var events *admin.Events
+	if (*adminListen != "" || *controlSocket != "") && !*test {
+		events = admin.NewEvents()
+		hooks = append(hooks, events)
+	}
+
+	var locker cron.Locker
+	if *lockRedisUrl != "" && !*test {
+		redisLocker, err := lock.NewRedisLocker(*lockRedisUrl, generalLogger)
+		if err != nil {
+			generalLogger.Fatalf("could not configure job locks: %s", err)
+		}
+		defer redisLocker.Close()
+
+		if err := redisLocker.Ping(); err != nil {
+			generalLogger.Warnf("could not reach Redis, jobs will not run until it is reachable: %s", err)
 		}
 
-		var wg sync.WaitGroup
-		exitCtx, notifyExit := context.WithCancel(context.Background())
+		locker = redisLocker
+	}
+
+	secretsResolver, err := secrets.NewResolver(cfg.Vault)
+	if err != nil {
+		generalLogger.Fatalf("could not configure secrets: %s", err)
+	}
+
+	var archiver cron.Archiver
+	if cfg.Archive != nil {
+		a, err := archive.New(*cfg.Archive)
+		if err != nil {
+			generalLogger.Fatalf("could not configure output archive: %s", err)
+		}
+		archiver = a
+	}
 
-		for _, job := range tab.Jobs {
-			cronLogger := generalLogger.WithFields(logrus.Fields{
-				"job.schedule": job.Schedule,
-				"job.command":  job.Command,
-				"job.position": job.Position,
+	var elector *leader.Elector
+	var leadershipChanged <-chan struct{}
+	if cfg.LeaderElection != nil && !*test && !*runOnce {
+		e, err := leader.New(*cfg.LeaderElection, generalLogger)
+		if err != nil {
+			generalLogger.Fatalf("could not configure leader election: %s", err)
+		}
+
+		electionCtx, stopElection := context.WithCancel(context.Background())
+		electionDone := make(chan struct{})
+
+		go func() {
+			e.Run(electionCtx)
+			close(electionDone)
+		}()
+
+		// Release the lease once our jobs are done, so another replica
+		// can take over right away.
+		defer func() {
+			stopElection()
+			<-electionDone
+		}()
+
+		elector = e
+		leadershipChanged = e.Changed
+	}
+
+	var limiter *cron.Limiter
+	if *maxConcurrentJobs > 0 {
+		limiter = cron.NewLimiter(*maxConcurrentJobs)
+	}
+
+	// With several crontab arguments, all jobs are tagged with their source.
+	var crontabSources []string
+	if len(crontabPaths) > 1 {
+		crontabSources = crontabPaths
+	}
+
+	r := runner.New(generalLogger, runner.Options{
+		Job: cron.Options{
+			Overlap:        overlapPolicy,
+			Exec:           execMode,
+			Jitter:         *jitter,
+			QuietSuccess:   *quietSuccess,
+			Output:         jobOutputFormat,
+			CleanEnv:       *cleanEnv,
+			LongLines:      longLinePolicy,
+			MaxLineSize:    *maxLineSize,
+			StderrLevel:    stderrOutputLevel,
+			ErrorPattern:   errorOutputPattern,
+			WarningPattern: warningOutputPattern,
+			Hooks:          hooks,
+			Archiver:       archiver,
+			CatchUp:        catchUpPolicy,
+			Locker:         locker,
+			Secrets:        secretsResolver,
+			Limiter:        limiter,
+			CgroupParent:   *cgroupParent,
+			RunOnce:        *runOnce,
+			RunAtStartup:   *runAtStartup,
+			StartupDelay:   *startupDelay,
+			StartedAt:      startedAt,
+		},
+		History: store,
+		Path:    crontabPaths[0],
+		Paths:   crontabSources,
+		Logger:  sentryClients.JobLoggers(logrus.StandardLogger(), sentryLogHook, logrus.Fields{"prefix": *logPrefix}),
+	})
+
+	// Reloads requested through the admin API.
+	reloadRequested := make(chan struct{}, 1)
+
+	var health *admin.Health
+	if (*adminListen != "" || *controlSocket != "") && !*test {
+		server := admin.NewServer(r.Registry(), store, generalLogger)
+		server.SetToken(*adminToken)
+		server.SetEvents(events)
+		if *adminDebug {
+			server.EnableDebug()
+		}
+		if !*runOnce {
+			server.SetReloader(func() {
+				select {
+				case reloadRequested <- struct{}{}:
+				default:
+				}
 			})
+		}
+		health = server.Health()
+
+		if *adminListen != "" {
+			listener, err := server.ListenAndServe(*adminListen)
+			if err != nil {
+				generalLogger.Fatalf("could not start admin API: %s", err)
+			}
+			defer listener.Close()
+		}
+
+		if *controlSocket != "" {
+			listener, err := server.ListenAndServeUnix(*controlSocket)
+			if err != nil {
+				generalLogger.Fatalf("could not create control socket: %s", err)
+			}
+			defer listener.Close()
+		}
+	}
 
-			cron.StartJob(&wg, tab.Context, job, exitCtx, cronLogger, *overlapping)
+	if *adminDebug && *adminListen == "" && *controlSocket == "" {
+		generalLogger.Warn("-admin-debug has no effect without -admin-listen or -control-socket")
+	}
+
+	if *debugListen != "" && !*test {
+		listener, err := admin.ListenAndServeDebug(*debugListen, generalLogger)
+		if err != nil {
+			generalLogger.Fatalf("could not start debug endpoints: %s", err)
 		}
+		defer listener.Close()
+	}
+
+	// There is nothing to reload when running every job once.
+	termSignals := platform.ShutdownSignals
+	if !*runOnce {
+		termSignals = append(termSignals, platform.ReloadSignal)
+	}
+
+	termChan := make(chan os.Signal, 1)
+	signal.Notify(termChan, termSignals...)
+
+	if !*test {
+		dumpChan := make(chan os.Signal, 1)
+		signal.Notify(dumpChan, platform.DumpSignal)
 
-		termChan := make(chan os.Signal, 1)
-		signal.Notify(termChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR2)
+		go func() {
+			for sig := range dumpChan {
+				generalLogger.Infof("received %s, dumping job state", sig)
+				r.LogState()
+			}
+		}()
 
-		termSig := <-termChan
+		if len(forwardSignals) > 0 {
+			forwardChan := make(chan os.Signal, 1)
+			signal.Notify(forwardChan, forwardSignals...)
 
-		if termSig == syscall.SIGUSR2 {
-			generalLogger.Infof("received %s, reloading crontab", termSig)
-		} else {
-			generalLogger.Infof("received %s, shutting down", termSig)
+			go func() {
+				for sig := range forwardChan {
+					signaled := r.Signal(sig.(syscall.Signal))
+					generalLogger.Infof("received %s, forwarded it to %d running job(s)", sig, signaled)
+				}
+			}()
 		}
-		notifyExit()
+	}
 
-		generalLogger.Info("waiting for jobs to finish")
-		wg.Wait()
+	parseOptions := crontab.ParseOptions{
+		Seconds:     *seconds,
+		ExpandEnv:   *expandEnv,
+		Format:      crontabFormat,
+		Location:    location,
+		DSTSkipped:  dstSkippedPolicy,
+		DSTRepeated: dstRepeatedPolicy,
+		Tags:        tagFilter,
+		Template:    *template || *templateValues != "",
+		Values:      *templateValues,
+	}
 
-		if termSig != syscall.SIGUSR2 {
-			generalLogger.Info("exiting")
-			break
+	readCrontabs := func() ([]*crontab.Crontab, error) {
+		tabs, err := runner.ReadAllCrontabs(generalLogger, crontabPaths, parseOptions)
+		if err != nil {
+			return nil, err
 		}
+
+		for _, tab := range tabs {
+			if tab.Context.Environ["MAILTO"] != "" && cfg.SMTP == nil {
+				generalLogger.Warn("MAILTO is set but no SMTP relay is configured: job output will NOT be mailed")
+			}
+		}
+
+		return tabs, nil
 	}
-}
 
-func readCrontabAtPath(path string) (*crontab.Crontab, error) {
-	file, err := os.Open(path)
+	tabs, err := readCrontabs()
 	if err != nil {
-		return nil, err
+		generalLogger.Fatal(err)
+	}
+
+	// reloadCrontabs reads the crontabs again, and reports whether they
+	// should replace the current ones. Reloads are often automatic (e.g. when
+	// the crontab changes on disk), and may catch it half-written: errors
+	// don't stop the jobs that are scheduled.
+	reloadCrontabs := func() bool {
+		reloaded, err := readCrontabs()
+		if err != nil {
+			generalLogger.Errorf("could not reload crontab, keeping the current one: %v", err)
+			return false
+		}
+
+		tabs = reloaded
+		return true
+	}
+
+	// terminateJobs waits for the running jobs to finish. If abort is set they
+	// are terminated right away, and otherwise once -grace-time has elapsed (if
+	// set). It reports whether a termination signal was received meanwhile,
+	// which terminates them too (e.g. CTRL+C twice).
+	terminateJobs := func(abort bool) bool {
+		var graceTimer *time.Timer
+		if abort {
+			generalLogger.Info("terminating running jobs")
+			r.Abort()
+		} else if *graceTime > 0 {
+			graceTimer = time.AfterFunc(*graceTime, func() {
+				generalLogger.Warnf("jobs did not finish within %v, terminating them", *graceTime)
+				r.Abort()
+			})
+		}
+
+		generalLogger.Info("waiting for jobs to finish")
+
+		jobsDone := make(chan struct{})
+		go func() {
+			r.Wait()
+			close(jobsDone)
+		}()
+
+		interrupted := false
+
+	wait:
+		for {
+			select {
+			case <-watchdog:
+				notifier.Watchdog()
+			case <-jobsDone:
+				break wait
+			case termSig := <-termChan:
+				if termSig == platform.ReloadSignal {
+					continue
+				}
+
+				generalLogger.Infof("received %s while waiting for jobs, terminating them", termSig)
+				r.Abort()
+				interrupted = true
+			}
+		}
+
+		if graceTimer != nil {
+			graceTimer.Stop()
+		}
+
+		return interrupted
 	}
 
-	defer file.Close()
+	for true {
+		if *test {
+			// Rendered crontabs are shown, so that they can be checked.
+			if parseOptions.Template {
+				if err := printRendered(crontabPaths, parseOptions); err != nil {
+					generalLogger.Fatal(err)
+				}
+			}
+
+			if *strict {
+				diagnostics := crontab.Lint(tabs, crontab.LintOptions{Exec: execMode, Now: time.Now(), ExpandEnv: *expandEnv})
+				if errors := logDiagnostics(generalLogger, diagnostics); errors > 0 {
+					generalLogger.Fatalf("crontab has %d problem(s)", errors)
+				}
+			}
+
+			for _, tab := range tabs {
+				for _, job := range tab.Jobs {
+					for _, t := range cron.NextRuns(job.Expression, time.Now(), *dryRun) {
+						r.JobLogger(job).Infof("would run at %v", t)
+					}
+				}
+			}
+
+			generalLogger.Info("crontab is valid")
+			os.Exit(0)
+			break
+		}
+
+		// Followers parse the crontab (so errors are reported early) but
+		// only schedule jobs once elected.
+		scheduled := tabs
+		if elector != nil && !elector.IsLeader() {
+			generalLogger.Info("not the leader: waiting to be elected before scheduling jobs")
+			scheduled = nil
+		}
+
+		r.SetCrontabs(scheduled)
+		if err := r.Start(context.Background()); err != nil {
+			generalLogger.Fatal(err)
+		}
+		health.SetReady()
+		notifier.Ready(schedulingStatus(scheduled))
+
+		reload := false
+		abort := *killOnExit
+		lostLeadership := false
 
-	return crontab.ParseCrontab(file)
+		var ranOnce chan struct{}
+		if *runOnce {
+			generalLogger.Info("running every job once")
+
+			ranOnce = make(chan struct{})
+			go func() {
+				r.Wait()
+				close(ranOnce)
+			}()
+		}
+
+	events:
+		for {
+			select {
+			case <-watchdog:
+				notifier.Watchdog()
+				continue
+			case termSig := <-termChan:
+				if termSig == platform.ReloadSignal {
+					generalLogger.Infof("received %s, reloading crontab", termSig)
+					if !reloadCrontabs() {
+						continue
+					}
+					reload = true
+				} else {
+					generalLogger.Infof("received %s, shutting down", termSig)
+				}
+			case <-crontabChanged:
+				generalLogger.Info("crontab changed, reloading crontab")
+				if !reloadCrontabs() {
+					continue
+				}
+				reload = true
+			case <-remoteChanged:
+				generalLogger.Info("remote crontab changed, reloading crontab")
+				if !reloadCrontabs() {
+					continue
+				}
+				reload = true
+			case <-reloadRequested:
+				generalLogger.Info("reload requested through the admin API, reloading crontab")
+				if !reloadCrontabs() {
+					continue
+				}
+				reload = true
+			case <-jobFailed:
+				generalLogger.Info("a job failed, shutting down")
+				abort = true
+			case <-leadershipChanged:
+				if elector.IsLeader() {
+					generalLogger.Info("elected leader, scheduling jobs")
+				} else {
+					generalLogger.Info("lost leadership, terminating running jobs")
+					lostLeadership = true
+				}
+				reload = true
+			case <-ranOnce:
+				generalLogger.Info("all jobs ran once")
+			}
+			break events
+		}
+		r.Stop()
+
+		// Another replica takes over once the lease expires: jobs must not
+		// be running here anymore by then.
+		if lostLeadership && terminateJobs(*graceTime == 0) {
+			reload = false
+		}
+
+		if reload {
+			notifier.Reloading()
+
+			// Don't wait for running jobs: schedule the new crontab right
+			// away, and let them finish in the background.
+			if running := r.Running(); running > 0 {
+				generalLogger.Infof("letting %d running job(s) finish in the background", running)
+			}
+			continue
+		}
+
+		health.SetNotReady("shutting down")
+		notifier.Stopping()
+
+		terminateJobs(abort)
+
+		if failures != nil {
+			exitCode = failures.ExitCode()
+		}
+
+		// Jobs that were skipped or never ran fail the batch too.
+		if *runOnce && r.Summarize() > 0 && exitCode == 0 {
+			exitCode = 1
+		}
+
+		generalLogger.Info("exiting")
+		break
+	}
 }
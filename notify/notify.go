@@ -0,0 +1,187 @@
+// Package notify sends notifications to external services (Slack, PagerDuty,
+// generic webhooks) when jobs fail.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"supercronic/cron"
+)
+
+// Timeout for delivering each notification.
+var SEND_TIMEOUT = 10 * time.Second
+
+const defaultStderrLines = 20
+
+type Config struct {
+	// StderrLines is how many of the last lines of stderr to include in
+	// notifications.
+	StderrLines int               `yaml:"stderr_lines"`
+	Slack       []SlackConfig     `yaml:"slack"`
+	PagerDuty   []PagerDutyConfig `yaml:"pagerduty"`
+	Webhooks    []WebhookConfig   `yaml:"webhooks"`
+}
+
+// Notification describes a failed job execution.
+type Notification struct {
+	Hostname   string    `json:"hostname"`
+	Name       string    `json:"name,omitempty"`
+	Schedule   string    `json:"schedule"`
+	Command    string    `json:"command"`
+	Position   int       `json:"position"`
+	Source     string    `json:"source,omitempty"`
+	ExitCode   int       `json:"exit_code"`
+	Error      string    `json:"error"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Duration   float64   `json:"duration_seconds"`
+	Stderr     []string  `json:"stderr"`
+}
+
+type Notifier interface {
+	Notify(n *Notification) error
+}
+
+// Resolver is implemented by notifiers that want to know when a job that
+// failed succeeds again, e.g. to close the incident they opened.
+type Resolver interface {
+	Resolve(n *Notification) error
+}
+
+// Hook sends a Notification to every configured notifier when a job fails.
+type Hook struct {
+	notifiers   []Notifier
+	stderrLines int
+	hostname    string
+}
+
+func NewHook(config Config) (*Hook, error) {
+	client := &http.Client{Timeout: SEND_TIMEOUT}
+	notifiers := make([]Notifier, 0, len(config.Slack)+len(config.PagerDuty)+len(config.Webhooks))
+
+	for _, c := range config.Slack {
+		if c.URL == "" {
+			return nil, fmt.Errorf("slack notifier is missing url")
+		}
+		notifiers = append(notifiers, &slackNotifier{config: c, client: client})
+	}
+
+	for _, c := range config.PagerDuty {
+		notifier, err := newPagerDutyNotifier(c, client)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, notifier)
+	}
+
+	for _, c := range config.Webhooks {
+		if c.URL == "" {
+			return nil, fmt.Errorf("webhook notifier is missing url")
+		}
+		notifiers = append(notifiers, &webhookNotifier{config: c, client: client})
+	}
+
+	stderrLines := config.StderrLines
+	if stderrLines <= 0 {
+		stderrLines = defaultStderrLines
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	return &Hook{notifiers: notifiers, stderrLines: stderrLines, hostname: hostname}, nil
+}
+
+func (h *Hook) JobStarted(e *cron.Execution) {}
+
+func (h *Hook) JobFinished(e *cron.Execution) {
+	if e.Err == nil {
+		h.resolve(e)
+		return
+	}
+
+	n := &Notification{
+		Hostname:   h.hostname,
+		Name:       e.Job.Name,
+		Schedule:   e.Job.Schedule,
+		Command:    e.Job.Command,
+		Position:   e.Job.Position,
+		Source:     e.Job.Source,
+		ExitCode:   e.ExitCode,
+		Error:      e.Err.Error(),
+		StartedAt:  e.StartedAt,
+		FinishedAt: e.FinishedAt,
+		Duration:   e.Duration().Seconds(),
+		Stderr:     e.Output.Tail("stderr", h.stderrLines),
+	}
+
+	for _, notifier := range h.notifiers {
+		if err := notifier.Notify(n); err != nil {
+			e.Logger.Errorf("failed to send failure notification: %v", err)
+		}
+	}
+}
+
+// resolve tells the notifiers that care that e succeeded.
+func (h *Hook) resolve(e *cron.Execution) {
+	n := &Notification{
+		Hostname:   h.hostname,
+		Name:       e.Job.Name,
+		Schedule:   e.Job.Schedule,
+		Command:    e.Job.Command,
+		Position:   e.Job.Position,
+		Source:     e.Job.Source,
+		ExitCode:   e.ExitCode,
+		StartedAt:  e.StartedAt,
+		FinishedAt: e.FinishedAt,
+		Duration:   e.Duration().Seconds(),
+	}
+
+	for _, notifier := range h.notifiers {
+		if r, ok := notifier.(Resolver); ok {
+			if err := r.Resolve(n); err != nil {
+				e.Logger.Errorf("failed to send resolution notification: %v", err)
+			}
+		}
+	}
+}
+
+func postJSON(client *http.Client, url string, headers map[string]string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,221 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+func startTestServer(t *testing.T) (*httptest.Server, chan request) {
+	requests := make(chan request, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, "POST", r.Method)
+		requests <- request{header: r.Header, body: body}
+	}))
+
+	return server, requests
+}
+
+func newTestExecution(err error) *cron.Execution {
+	output := &cron.Output{}
+	output.Append("stdout", "working")
+	output.Append("stderr", "warning")
+	output.Append("stderr", "fatal error")
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	startedAt := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	return &cron.Execution{
+		Job: &crontab.Job{
+			CrontabLine: crontab.CrontabLine{Schedule: "@daily", Command: "backup.sh"},
+			Position:    3,
+		},
+		Context:    &crontab.Context{Shell: "/bin/sh", Environ: map[string]string{}},
+		Logger:     logrus.NewEntry(logger),
+		StartedAt:  startedAt,
+		FinishedAt: startedAt.Add(1500 * time.Millisecond),
+		Err:        err,
+		ExitCode:   2,
+		Output:     output,
+	}
+}
+
+func expectRequest(t *testing.T, requests chan request) request {
+	select {
+	case r := <-requests:
+		return r
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for notification")
+		return request{}
+	}
+}
+
+func TestWebhookNotification(t *testing.T) {
+	server, requests := startTestServer(t)
+	defer server.Close()
+
+	hook, err := NewHook(Config{
+		StderrLines: 1,
+		Webhooks:    []WebhookConfig{{URL: server.URL, Headers: map[string]string{"X-Token": "secret"}}},
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	hook.JobFinished(newTestExecution(errors.New("error running command: exit status 2")))
+
+	r := expectRequest(t, requests)
+	assert.Equal(t, "secret", r.header.Get("X-Token"))
+	assert.Equal(t, "application/json", r.header.Get("Content-Type"))
+
+	var n Notification
+	if assert.Nil(t, json.Unmarshal(r.body, &n)) {
+		assert.Equal(t, "backup.sh", n.Command)
+		assert.Equal(t, "@daily", n.Schedule)
+		assert.Equal(t, 3, n.Position)
+		assert.Equal(t, 2, n.ExitCode)
+		assert.Equal(t, "error running command: exit status 2", n.Error)
+		assert.Equal(t, 1.5, n.Duration)
+		assert.Equal(t, []string{"fatal error"}, n.Stderr)
+	}
+}
+
+func TestSlackNotification(t *testing.T) {
+	server, requests := startTestServer(t)
+	defer server.Close()
+
+	hook, err := NewHook(Config{Slack: []SlackConfig{{URL: server.URL, Channel: "#ops"}}})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	hook.JobFinished(newTestExecution(errors.New("boom")))
+
+	r := expectRequest(t, requests)
+
+	var message slackMessage
+	if assert.Nil(t, json.Unmarshal(r.body, &message)) {
+		assert.Equal(t, "#ops", message.Channel)
+		assert.Contains(t, message.Text, "`backup.sh` (@daily)")
+		assert.Contains(t, message.Text, "Exit code: 2, duration: 1.5s")
+		assert.Contains(t, message.Text, "```\nwarning\nfatal error\n```")
+	}
+}
+
+func TestSlackTextIncludesName(t *testing.T) {
+	text := formatSlackText(&Notification{Hostname: "box", Name: "nightly-backup", Command: "backup.sh", Schedule: "@daily"})
+	assert.Contains(t, text, "Job nightly-backup failed on box: `backup.sh` (@daily)")
+}
+
+func TestPagerDutyNotification(t *testing.T) {
+	server, requests := startTestServer(t)
+	defer server.Close()
+
+	defer func(url string) { PAGERDUTY_EVENTS_URL = url }(PAGERDUTY_EVENTS_URL)
+	PAGERDUTY_EVENTS_URL = server.URL
+
+	hook, err := NewHook(Config{PagerDuty: []PagerDutyConfig{{RoutingKey: "key", Severity: "critical"}}})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// Nothing to resolve yet.
+	hook.JobFinished(newTestExecution(nil))
+
+	hook.JobFinished(newTestExecution(errors.New("boom")))
+
+	r := expectRequest(t, requests)
+
+	var trigger pagerDutyEvent
+	if assert.Nil(t, json.Unmarshal(r.body, &trigger)) {
+		assert.Equal(t, "key", trigger.RoutingKey)
+		assert.Equal(t, "trigger", trigger.EventAction)
+		assert.NotEmpty(t, trigger.DedupKey)
+		if assert.NotNil(t, trigger.Payload) {
+			assert.Equal(t, "critical", trigger.Payload.Severity)
+			assert.Contains(t, trigger.Payload.Summary, "backup.sh: boom")
+			assert.Equal(t, []string{"warning", "fatal error"}, trigger.Payload.CustomDetails.Stderr)
+		}
+	}
+
+	hook.JobFinished(newTestExecution(nil))
+
+	r = expectRequest(t, requests)
+
+	var resolve pagerDutyEvent
+	if assert.Nil(t, json.Unmarshal(r.body, &resolve)) {
+		assert.Equal(t, "resolve", resolve.EventAction)
+		assert.Equal(t, trigger.DedupKey, resolve.DedupKey)
+		assert.Nil(t, resolve.Payload)
+	}
+
+	// The incident was resolved already.
+	hook.JobFinished(newTestExecution(nil))
+
+	select {
+	case <-requests:
+		t.Errorf("unexpected notification")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestPagerDutyDedupKey(t *testing.T) {
+	unnamed := &Notification{Schedule: "@daily", Command: "backup.sh"}
+	other := &Notification{Schedule: "@daily", Command: "restore.sh"}
+	named := &Notification{Name: "backup", Source: "/etc/crontab", Schedule: "@daily", Command: "backup.sh"}
+
+	assert.Equal(t, pagerDutyDedupKey(unnamed), pagerDutyDedupKey(&Notification{Schedule: "@daily", Command: "backup.sh"}))
+	assert.NotEqual(t, pagerDutyDedupKey(unnamed), pagerDutyDedupKey(other))
+	assert.Equal(t, "supercronic//etc/crontab/backup", pagerDutyDedupKey(named))
+}
+
+func TestNoNotificationOnSuccess(t *testing.T) {
+	server, requests := startTestServer(t)
+	defer server.Close()
+
+	hook, err := NewHook(Config{Webhooks: []WebhookConfig{{URL: server.URL}}})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	hook.JobFinished(newTestExecution(nil))
+
+	select {
+	case <-requests:
+		t.Errorf("unexpected notification")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNewHookRequiresURL(t *testing.T) {
+	_, err := NewHook(Config{Slack: []SlackConfig{{Channel: "#ops"}}})
+	assert.NotNil(t, err)
+
+	_, err = NewHook(Config{Webhooks: []WebhookConfig{{}}})
+	assert.NotNil(t, err)
+
+	_, err = NewHook(Config{PagerDuty: []PagerDutyConfig{{}}})
+	assert.NotNil(t, err)
+
+	_, err = NewHook(Config{PagerDuty: []PagerDutyConfig{{RoutingKey: "key", Severity: "dire"}}})
+	assert.NotNil(t, err)
+}
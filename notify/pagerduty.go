@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// PAGERDUTY_EVENTS_URL is the endpoint of the PagerDuty Events API (v2).
+var PAGERDUTY_EVENTS_URL = "https://events.pagerduty.com/v2/enqueue"
+
+type PagerDutyConfig struct {
+	// RoutingKey is the integration key of a PagerDuty service.
+	RoutingKey string `yaml:"routing_key"`
+	// Severity is critical, error (the default), warning, or info.
+	Severity string `yaml:"severity"`
+}
+
+// pagerDutyNotifier triggers an incident when a job fails, and resolves it
+// when the job next succeeds. Incidents are deduplicated per job, so that
+// repeated failures don't page again.
+type pagerDutyNotifier struct {
+	config PagerDutyConfig
+	client *http.Client
+	url    string
+
+	mu sync.Mutex
+	// triggered holds the dedup keys of the incidents this notifier
+	// triggered and hasn't resolved yet.
+	triggered map[string]bool
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string        `json:"summary"`
+	Source        string        `json:"source"`
+	Severity      string        `json:"severity"`
+	Component     string        `json:"component,omitempty"`
+	CustomDetails *Notification `json:"custom_details"`
+}
+
+func newPagerDutyNotifier(config PagerDutyConfig, client *http.Client) (*pagerDutyNotifier, error) {
+	if config.RoutingKey == "" {
+		return nil, fmt.Errorf("pagerduty notifier is missing routing_key")
+	}
+
+	switch config.Severity {
+	case "":
+		config.Severity = "error"
+	case "critical", "error", "warning", "info":
+	default:
+		return nil, fmt.Errorf("pagerduty severity must be critical, error, warning, or info: %s", config.Severity)
+	}
+
+	return &pagerDutyNotifier{
+		config:    config,
+		client:    client,
+		url:       PAGERDUTY_EVENTS_URL,
+		triggered: make(map[string]bool),
+	}, nil
+}
+
+// pagerDutyDedupKey identifies the job n is about. Named jobs are identified
+// by name, so that their incident survives changes to their command.
+func pagerDutyDedupKey(n *Notification) string {
+	if n.Name != "" {
+		return "supercronic/" + n.Source + "/" + n.Name
+	}
+
+	sum := sha1.Sum([]byte(n.Source + "\n" + n.Schedule + "\n" + n.Command))
+	return "supercronic/" + hex.EncodeToString(sum[:])
+}
+
+func (p *pagerDutyNotifier) Notify(n *Notification) error {
+	key := pagerDutyDedupKey(n)
+
+	label := n.Name
+	if label == "" {
+		label = n.Command
+	}
+
+	event := &pagerDutyEvent{
+		RoutingKey:  p.config.RoutingKey,
+		EventAction: "trigger",
+		DedupKey:    key,
+		Payload: &pagerDutyPayload{
+			Summary:       fmt.Sprintf("Job failed on %s: %s: %s", n.Hostname, label, n.Error),
+			Source:        n.Hostname,
+			Severity:      p.config.Severity,
+			Component:     n.Name,
+			CustomDetails: n,
+		},
+	}
+
+	if err := postJSON(p.client, p.url, nil, event); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.triggered[key] = true
+
+	return nil
+}
+
+func (p *pagerDutyNotifier) Resolve(n *Notification) error {
+	key := pagerDutyDedupKey(n)
+
+	p.mu.Lock()
+	triggered := p.triggered[key]
+	p.mu.Unlock()
+
+	if !triggered {
+		return nil
+	}
+
+	event := &pagerDutyEvent{
+		RoutingKey:  p.config.RoutingKey,
+		EventAction: "resolve",
+		DedupKey:    key,
+	}
+
+	if err := postJSON(p.client, p.url, nil, event); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.triggered, key)
+
+	return nil
+}
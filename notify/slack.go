@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type SlackConfig struct {
+	// URL is a Slack incoming webhook URL.
+	URL      string `yaml:"url"`
+	Channel  string `yaml:"channel"`
+	Username string `yaml:"username"`
+}
+
+type slackNotifier struct {
+	config SlackConfig
+	client *http.Client
+}
+
+type slackMessage struct {
+	Text     string `json:"text"`
+	Channel  string `json:"channel,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+func (s *slackNotifier) Notify(n *Notification) error {
+	message := slackMessage{
+		Text:     formatSlackText(n),
+		Channel:  s.config.Channel,
+		Username: s.config.Username,
+	}
+
+	return postJSON(s.client, s.config.URL, nil, message)
+}
+
+func formatSlackText(n *Notification) string {
+	var text bytes.Buffer
+
+	if n.Name != "" {
+		fmt.Fprintf(&text, "Job %s failed on %s: `%s` (%s)\n", n.Name, n.Hostname, n.Command, n.Schedule)
+	} else {
+		fmt.Fprintf(&text, "Job failed on %s: `%s` (%s)\n", n.Hostname, n.Command, n.Schedule)
+	}
+
+	duration := time.Duration(n.Duration * float64(time.Second)).Round(time.Millisecond)
+	fmt.Fprintf(&text, "Exit code: %d, duration: %v\n", n.ExitCode, duration)
+
+	if len(n.Stderr) > 0 {
+		fmt.Fprintf(&text, "```\n%s\n```\n", strings.Join(n.Stderr, "\n"))
+	}
+
+	return text.String()
+}
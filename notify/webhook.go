@@ -0,0 +1,20 @@
+package notify
+
+import (
+	"net/http"
+)
+
+type WebhookConfig struct {
+	// URL receives the Notification, JSON-encoded, in a POST request.
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+type webhookNotifier struct {
+	config WebhookConfig
+	client *http.Client
+}
+
+func (w *webhookNotifier) Notify(n *Notification) error {
+	return postJSON(w.client, w.config.URL, w.config.Headers, n)
+}
@@ -0,0 +1,57 @@
+package platform
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// cgroup v2 measures CPU quotas over this period, in microseconds.
+const cpuPeriod = 100000
+
+// CreateCgroup creates a cgroup v2 named name under parent, limited to memory
+// bytes (if non-zero) and cpu CPUs (if non-zero), and returns its path. The
+// parent must have the memory and cpu controllers enabled in
+// cgroup.subtree_control.
+func CreateCgroup(parent string, name string, memory uint64, cpu float64) (string, error) {
+	path := filepath.Join(parent, name)
+
+	if err := os.Mkdir(path, 0755); err != nil {
+		return "", err
+	}
+
+	if memory > 0 {
+		if err := writeCgroupFile(path, "memory.max", strconv.FormatUint(memory, 10)); err != nil {
+			os.Remove(path)
+			return "", err
+		}
+	}
+
+	if cpu > 0 {
+		quota := fmt.Sprintf("%d %d", int64(cpu*cpuPeriod), cpuPeriod)
+		if err := writeCgroupFile(path, "cpu.max", quota); err != nil {
+			os.Remove(path)
+			return "", err
+		}
+	}
+
+	return path, nil
+}
+
+// JoinCgroup moves the current process into the cgroup at path. Processes
+// it executes or forks will be part of the cgroup too.
+func JoinCgroup(path string) error {
+	return writeCgroupFile(path, "cgroup.procs", strconv.Itoa(os.Getpid()))
+}
+
+// RemoveCgroup removes a cgroup created with CreateCgroup. This fails if
+// processes are still part of the cgroup.
+func RemoveCgroup(path string) error {
+	return os.Remove(path)
+}
+
+func writeCgroupFile(path string, file string, value string) error {
+	return ioutil.WriteFile(filepath.Join(path, file), []byte(value), 0644)
+}
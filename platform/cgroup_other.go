@@ -0,0 +1,15 @@
+// +build darwin dragonfly freebsd netbsd openbsd solaris
+
+package platform
+
+func CreateCgroup(parent string, name string, memory uint64, cpu float64) (string, error) {
+	return "", ErrUnsupported
+}
+
+func JoinCgroup(path string) error {
+	return ErrUnsupported
+}
+
+func RemoveCgroup(path string) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,34 @@
+package platform
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// I/O priorities are a class and a level, as described in ioprio_set(2).
+const (
+	ioprioClassShift = 13
+	ioprioWhoProcess = 1
+)
+
+var ioprioClasses = map[string]int{
+	"realtime":    1,
+	"best-effort": 2,
+	"idle":        3,
+}
+
+// SetIOPriority sets the I/O scheduling class (realtime, best-effort or idle)
+// and level (0 to 7) of the current thread, which the processes it executes
+// inherit.
+func SetIOPriority(class string, level int) error {
+	c, ok := ioprioClasses[class]
+	if !ok {
+		return fmt.Errorf("unknown I/O class: %s", class)
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, 0, uintptr(c<<ioprioClassShift|level))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
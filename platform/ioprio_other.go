@@ -0,0 +1,7 @@
+// +build darwin dragonfly freebsd netbsd openbsd solaris
+
+package platform
+
+func SetIOPriority(class string, level int) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,27 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+// Package platform isolates the OS-specific process handling supercronic
+// relies on, so that the scheduler builds and behaves the same way on Linux,
+// the BSDs, and illumos / Solaris.
+package platform
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+var (
+	// ErrUnsupported is returned by features that are not available on the
+	// current platform.
+	ErrUnsupported = errors.New("not supported on this platform")
+
+	// ReloadSignal requests a reload of the crontab.
+	ReloadSignal os.Signal = syscall.SIGUSR2
+
+	// DumpSignal requests a dump of the state of all jobs.
+	DumpSignal os.Signal = syscall.SIGUSR1
+
+	// ShutdownSignals request a graceful shutdown.
+	ShutdownSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+)
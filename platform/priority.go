@@ -0,0 +1,13 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package platform
+
+import (
+	"syscall"
+)
+
+// SetNice sets the niceness of the current process (on Linux, of the current
+// thread), which the processes it executes inherit.
+func SetNice(nice int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, 0, nice)
+}
@@ -0,0 +1,41 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package platform
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// SetProcessGroup configures cmd to run in a new process group, whose ID will
+// be the PID of the process once started. In interactive usage, this ensures
+// CTRL+C stops supercronic, not the children.
+func SetProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// SignalProcessGroup delivers sig to every process in the process group pgid.
+func SignalProcessGroup(pgid int, sig syscall.Signal) error {
+	return syscall.Kill(-pgid, sig)
+}
+
+// ProcessGroupExists reports whether any process is still a member of the
+// process group pgid. Processes that exited but weren't waited for yet
+// (zombies) are members too.
+func ProcessGroupExists(pgid int) bool {
+	err := syscall.Kill(-pgid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// ExitCode returns the exit code of a process that has exited, or -1 if it
+// hasn't exited (e.g. it was killed by a signal) or state is nil.
+func ExitCode(state *os.ProcessState) int {
+	if state == nil {
+		return -1
+	}
+	return state.Sys().(syscall.WaitStatus).ExitStatus()
+}
@@ -0,0 +1,47 @@
+package platform
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ProcessGroupRunning reports whether any process in the process group pgid
+// is still running. Unlike ProcessGroupExists, it ignores zombies, which
+// linger when e.g. processes started by a job are orphaned in a container
+// whose init doesn't wait for them.
+func ProcessGroupRunning(pgid int) bool {
+	if !ProcessGroupExists(pgid) {
+		return false
+	}
+
+	stats, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil || len(stats) == 0 {
+		// Without /proc, assume members are running.
+		return true
+	}
+
+	for _, path := range stats {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			// The process exited since /proc was listed.
+			continue
+		}
+
+		// The command (in parentheses) may contain spaces: fields are
+		// counted from the closing parenthesis, after which come the state
+		// and the parent's PID before the process group.
+		stat := string(data)
+		fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+		if len(fields) < 3 {
+			continue
+		}
+
+		if pgrp, _ := strconv.Atoi(fields[2]); pgrp == pgid && fields[0] != "Z" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,10 @@
+// +build darwin dragonfly freebsd netbsd openbsd solaris
+
+package platform
+
+// ProcessGroupRunning reports whether any process in the process group pgid
+// is still running. Zombies can't be told apart from running processes on
+// this platform, so it is equivalent to ProcessGroupExists.
+func ProcessGroupRunning(pgid int) bool {
+	return ProcessGroupExists(pgid)
+}
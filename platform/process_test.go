@@ -0,0 +1,54 @@
+package platform
+
+import (
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignalProcessGroup(t *testing.T) {
+	cmd := exec.Command("/bin/sh", "-c", "sleep 10 & sleep 10; wait")
+	SetProcessGroup(cmd)
+
+	if !assert.Nil(t, cmd.Start()) {
+		return
+	}
+
+	pgid := cmd.Process.Pid
+	assert.True(t, ProcessGroupExists(pgid))
+
+	assert.Nil(t, SignalProcessGroup(pgid, syscall.SIGKILL))
+	cmd.Wait()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for ProcessGroupExists(pgid) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.False(t, ProcessGroupExists(pgid))
+}
+
+func TestProcessGroupRunning(t *testing.T) {
+	cmd := exec.Command("/bin/sh", "-c", "sleep 10 & wait")
+	SetProcessGroup(cmd)
+
+	if !assert.Nil(t, cmd.Start()) {
+		return
+	}
+
+	pgid := cmd.Process.Pid
+	assert.True(t, ProcessGroupRunning(pgid))
+
+	assert.Nil(t, SignalProcessGroup(pgid, syscall.SIGKILL))
+	cmd.Wait()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for ProcessGroupRunning(pgid) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.False(t, ProcessGroupRunning(pgid))
+}
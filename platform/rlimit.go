@@ -0,0 +1,19 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package platform
+
+import (
+	"syscall"
+)
+
+// SetMemoryLimit caps the memory the current process (and the processes it
+// executes) may use, in bytes.
+func SetMemoryLimit(bytes uint64) error {
+	return setrlimit(rlimitMemory, bytes)
+}
+
+// SetOpenFilesLimit caps the number of file descriptors the current process
+// (and the processes it executes) may open.
+func SetOpenFilesLimit(n uint64) error {
+	return setrlimit(syscall.RLIMIT_NOFILE, n)
+}
@@ -0,0 +1,9 @@
+// +build darwin dragonfly freebsd linux netbsd solaris
+
+package platform
+
+import (
+	"syscall"
+)
+
+const rlimitMemory = syscall.RLIMIT_AS
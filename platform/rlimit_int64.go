@@ -0,0 +1,19 @@
+// +build dragonfly freebsd
+
+package platform
+
+import (
+	"fmt"
+	"math"
+	"syscall"
+)
+
+// setrlimit sets both the soft and the hard limit, so that the limit can't be
+// raised again by the job. Limits are signed here.
+func setrlimit(resource int, value uint64) error {
+	if value > math.MaxInt64 {
+		return fmt.Errorf("limit %d is too large", value)
+	}
+
+	return syscall.Setrlimit(resource, &syscall.Rlimit{Cur: int64(value), Max: int64(value)})
+}
@@ -0,0 +1,8 @@
+package platform
+
+import (
+	"syscall"
+)
+
+// OpenBSD has no RLIMIT_AS, so limit the data segment instead.
+const rlimitMemory = syscall.RLIMIT_DATA
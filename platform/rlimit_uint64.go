@@ -0,0 +1,13 @@
+// +build darwin linux netbsd openbsd solaris
+
+package platform
+
+import (
+	"syscall"
+)
+
+// setrlimit sets both the soft and the hard limit, so that the limit can't be
+// raised again by the job.
+func setrlimit(resource int, value uint64) error {
+	return syscall.Setrlimit(resource, &syscall.Rlimit{Cur: value, Max: value})
+}
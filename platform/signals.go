@@ -0,0 +1,37 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package platform
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// signalNames are the signals that can be caught, by name.
+var signalNames = map[string]syscall.Signal{
+	"HUP":   syscall.SIGHUP,
+	"INT":   syscall.SIGINT,
+	"QUIT":  syscall.SIGQUIT,
+	"ABRT":  syscall.SIGABRT,
+	"USR1":  syscall.SIGUSR1,
+	"USR2":  syscall.SIGUSR2,
+	"PIPE":  syscall.SIGPIPE,
+	"ALRM":  syscall.SIGALRM,
+	"TERM":  syscall.SIGTERM,
+	"CONT":  syscall.SIGCONT,
+	"TSTP":  syscall.SIGTSTP,
+	"TTIN":  syscall.SIGTTIN,
+	"TTOU":  syscall.SIGTTOU,
+	"WINCH": syscall.SIGWINCH,
+}
+
+// ParseSignal parses the name of a signal that can be caught, with or without
+// the SIG prefix (e.g. SIGHUP or HUP).
+func ParseSignal(name string) (syscall.Signal, error) {
+	sig, ok := signalNames[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return 0, fmt.Errorf("unknown signal (or one that can't be caught): %s", name)
+	}
+	return sig, nil
+}
@@ -0,0 +1,22 @@
+package platform
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSignal(t *testing.T) {
+	for _, name := range []string{"SIGHUP", "HUP", "hup"} {
+		sig, err := ParseSignal(name)
+		if assert.Nil(t, err, name) {
+			assert.Equal(t, syscall.SIGHUP, sig)
+		}
+	}
+
+	for _, name := range []string{"SIGKILL", "STOP", "SIGNOPE", ""} {
+		_, err := ParseSignal(name)
+		assert.NotNil(t, err, name)
+	}
+}
@@ -0,0 +1,11 @@
+// +build darwin dragonfly freebsd netbsd openbsd solaris
+
+package platform
+
+func MakeTerminalRaw(fd uintptr) (func() error, error) {
+	return nil, ErrUnsupported
+}
+
+func TerminalSize(fd uintptr) (int, int, error) {
+	return 0, 0, ErrUnsupported
+}
@@ -0,0 +1,195 @@
+// Package pushgateway pushes metrics about job executions to a Prometheus
+// Pushgateway, for deployments that can't be scraped.
+package pushgateway
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"supercronic/cron"
+)
+
+// Timeout for each push.
+var PUSH_TIMEOUT = 10 * time.Second
+
+const defaultJob = "supercronic"
+
+type Config struct {
+	// URL is the Pushgateway's base URL (e.g. http://pushgateway:9091).
+	URL string `yaml:"url"`
+	// Job is the job label of the grouping key ("supercronic" by default).
+	Job string `yaml:"job"`
+	// Labels are added to the grouping key of every job's metrics.
+	Labels  map[string]string `yaml:"labels"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+// Hook pushes metrics when a job finishes. Each job gets a group of its own,
+// identified by its name (or position) in the cron_job label, on top of the
+// configured labels, and of the job's pushgateway_labels.
+type Hook struct {
+	config Config
+	client *http.Client
+}
+
+func NewHook(config Config) (*Hook, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("pushgateway is missing url")
+	}
+
+	if config.Job == "" {
+		config.Job = defaultJob
+	}
+
+	for name := range config.Labels {
+		if name == "job" || name == "cron_job" {
+			return nil, fmt.Errorf("pushgateway labels cannot include %s", name)
+		}
+	}
+
+	return &Hook{
+		config: config,
+		client: &http.Client{Timeout: PUSH_TIMEOUT},
+	}, nil
+}
+
+func (h *Hook) JobStarted(e *cron.Execution) {}
+
+func (h *Hook) JobFinished(e *cron.Execution) {
+	if err := h.push(groupingKey(h.config, e), formatMetrics(e)); err != nil {
+		e.Logger.Errorf("failed to push metrics: %v", err)
+	}
+}
+
+func groupingKey(config Config, e *cron.Execution) map[string]string {
+	labels := make(map[string]string)
+
+	for k, v := range config.Labels {
+		labels[k] = v
+	}
+
+	for k, v := range e.Job.PushgatewayLabels {
+		labels[k] = v
+	}
+
+	if e.Job.Name != "" {
+		labels["cron_job"] = e.Job.Name
+	} else {
+		labels["cron_job"] = strconv.Itoa(e.Job.Position)
+	}
+
+	return labels
+}
+
+// formatMetrics returns the metrics describing e, in the Prometheus text
+// format. The last success timestamp is only included for successful runs:
+// since metrics are pushed with POST, the Pushgateway keeps the previous
+// value otherwise.
+func formatMetrics(e *cron.Execution) []byte {
+	var buf bytes.Buffer
+
+	gauge := func(name string, help string, value float64) {
+		fmt.Fprintf(&buf, "# HELP supercronic_job_%s %s\n", name, help)
+		fmt.Fprintf(&buf, "# TYPE supercronic_job_%s gauge\n", name)
+		fmt.Fprintf(&buf, "supercronic_job_%s %s\n", name, strconv.FormatFloat(value, 'f', -1, 64))
+	}
+
+	succeeded := 0.0
+	if e.Err == nil {
+		succeeded = 1
+	}
+
+	tripped := 0.0
+	if e.Tripped {
+		tripped = 1
+	}
+
+	gauge("duration_seconds", "How long the last run took.", e.Duration().Seconds())
+	gauge("exit_code", "The exit code of the last run (-1 if it did not exit normally).", float64(e.ExitCode))
+	gauge("succeeded", "Whether the last run succeeded.", succeeded)
+	gauge("circuit_breaker_tripped", "Whether the job's circuit breaker was tripped as of the last run, so that it is no longer scheduled.", tripped)
+	gauge("last_run_timestamp_seconds", "When the last run finished.", unixSeconds(e.FinishedAt))
+
+	if e.Err == nil {
+		gauge("last_success_timestamp_seconds", "When the last successful run finished.", unixSeconds(e.FinishedAt))
+	}
+
+	return buf.Bytes()
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// groupURL returns the URL of the group identified by labels, per the
+// Pushgateway's API: /metrics/job/<job>{/<label>/<value>}.
+func groupURL(base string, job string, labels map[string]string) string {
+	var path bytes.Buffer
+	path.WriteString(strings.TrimSuffix(base, "/"))
+	path.WriteString("/metrics")
+	writeLabel(&path, "job", job)
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		writeLabel(&path, name, labels[name])
+	}
+
+	return path.String()
+}
+
+// writeLabel appends a label to a group's path. Values that can't appear in
+// a path segment as they are use the base64 form.
+func writeLabel(path *bytes.Buffer, name string, value string) {
+	if value == "" || strings.Contains(value, "/") {
+		encoded := base64.URLEncoding.EncodeToString([]byte(value))
+		if encoded == "" {
+			encoded = "="
+		}
+		fmt.Fprintf(path, "/%s@base64/%s", name, encoded)
+		return
+	}
+
+	fmt.Fprintf(path, "/%s/%s", name, url.PathEscape(value))
+}
+
+func (h *Hook) push(labels map[string]string, metrics []byte) error {
+	target := groupURL(h.config.URL, h.config.Job, labels)
+
+	req, err := http.NewRequest("POST", target, bytes.NewReader(metrics))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	for k, v := range h.config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", target, resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package pushgateway
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+type request struct {
+	path   string
+	header http.Header
+	body   string
+}
+
+func newTestExecution(err error) *cron.Execution {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	startedAt := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	return &cron.Execution{
+		Job: &crontab.Job{
+			CrontabLine: crontab.CrontabLine{Schedule: "@daily", Command: "backup.sh"},
+			Position:    3,
+		},
+		Logger:     logrus.NewEntry(logger),
+		StartedAt:  startedAt,
+		FinishedAt: startedAt.Add(1500 * time.Millisecond),
+		Err:        err,
+	}
+}
+
+func startTestServer(t *testing.T, status int) (*httptest.Server, chan request) {
+	requests := make(chan request, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, "POST", r.Method)
+		requests <- request{path: r.URL.EscapedPath(), header: r.Header, body: string(body)}
+		w.WriteHeader(status)
+	}))
+
+	return server, requests
+}
+
+func TestNewHookValidatesConfig(t *testing.T) {
+	_, err := NewHook(Config{})
+	assert.NotNil(t, err)
+
+	_, err = NewHook(Config{URL: "http://localhost:9091", Labels: map[string]string{"cron_job": "x"}})
+	assert.NotNil(t, err)
+}
+
+func TestHookPushesMetrics(t *testing.T) {
+	server, requests := startTestServer(t, http.StatusOK)
+	defer server.Close()
+
+	hook, err := NewHook(Config{
+		URL:     server.URL + "/",
+		Labels:  map[string]string{"instance": "worker-1"},
+		Headers: map[string]string{"Authorization": "Bearer token"},
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	e := newTestExecution(nil)
+	e.Job.PushgatewayLabels = map[string]string{"team": "billing"}
+	hook.JobFinished(e)
+
+	req := <-requests
+	assert.Equal(t, "/metrics/job/supercronic/cron_job/3/instance/worker-1/team/billing", req.path)
+	assert.Equal(t, "Bearer token", req.header.Get("Authorization"))
+	assert.Equal(t, "text/plain; version=0.0.4", req.header.Get("Content-Type"))
+	assert.Contains(t, req.body, "# TYPE supercronic_job_duration_seconds gauge\nsupercronic_job_duration_seconds 1.5\n")
+	assert.Contains(t, req.body, "supercronic_job_exit_code 0\n")
+	assert.Contains(t, req.body, "supercronic_job_succeeded 1\n")
+	assert.Contains(t, req.body, "supercronic_job_last_run_timestamp_seconds 1546300801.5\n")
+	assert.Contains(t, req.body, "supercronic_job_last_success_timestamp_seconds 1546300801.5\n")
+}
+
+func TestHookPushesFailures(t *testing.T) {
+	server, requests := startTestServer(t, http.StatusOK)
+	defer server.Close()
+
+	hook, err := NewHook(Config{URL: server.URL, Job: "batch"})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	e := newTestExecution(errors.New("exit status 2"))
+	e.Job.Name = "backup"
+	e.ExitCode = 2
+	hook.JobFinished(e)
+
+	req := <-requests
+	assert.Equal(t, "/metrics/job/batch/cron_job/backup", req.path)
+	assert.Contains(t, req.body, "supercronic_job_exit_code 2\n")
+	assert.Contains(t, req.body, "supercronic_job_succeeded 0\n")
+	assert.Contains(t, req.body, "supercronic_job_circuit_breaker_tripped 0\n")
+	assert.NotContains(t, req.body, "last_success_timestamp_seconds")
+}
+
+func TestGroupURLEncodesValues(t *testing.T) {
+	url := groupURL("http://pushgateway:9091", "supercronic", map[string]string{
+		"path":  "/var/backups",
+		"empty": "",
+		"space": "a b",
+	})
+
+	assert.Equal(t, "http://pushgateway:9091/metrics/job/supercronic/empty@base64/=/path@base64/L3Zhci9iYWNrdXBz/space/a%20b", url)
+}
+
+func TestHookReportsErrors(t *testing.T) {
+	server, requests := startTestServer(t, http.StatusBadRequest)
+	defer server.Close()
+
+	hook, err := NewHook(Config{URL: server.URL})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	err = hook.push(groupingKey(hook.config, newTestExecution(nil)), []byte{})
+	<-requests
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "400 Bad Request")
+	}
+}
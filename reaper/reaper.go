@@ -0,0 +1,129 @@
+// Package reaper lets supercronic run as PID 1 (i.e. as the init process of a
+// container). Processes whose parent exits before them (e.g. jobs that
+// double-fork) become children of PID 1, which must wait for them once they
+// exit, or they linger as zombies.
+//
+// Waiting for any child would race with os/exec waiting for jobs, so the init
+// process does nothing but that: it runs supercronic again as its child to do
+// the actual work, and forwards signals to it.
+package reaper
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"supercronic/platform"
+)
+
+// childEnv is set for the child, so that it doesn't start a reaper of its own.
+const childEnv = "SUPERCRONIC_INIT_CHILD"
+
+// forwardedSignals are the signals supercronic acts on, plus the ones that
+// usually ask processes to exit.
+var forwardedSignals = append([]os.Signal{
+	platform.ReloadSignal,
+	platform.DumpSignal,
+	syscall.SIGHUP,
+	syscall.SIGQUIT,
+}, platform.ShutdownSignals...)
+
+// Init runs supercronic under a reaper if the current process is PID 1. It
+// returns right away if it isn't (or if it is the reaper's child), and exits
+// with the child's exit code otherwise. The reaper forwards extraSignals to the
+// child too.
+func Init(logger *logrus.Entry, extraSignals []os.Signal) {
+	if os.Getenv(childEnv) != "" {
+		os.Unsetenv(childEnv)
+		return
+	}
+
+	if os.Getpid() != 1 {
+		logger.Warn("not running as PID 1, not reaping processes")
+		return
+	}
+
+	os.Exit(run(logger, append(forwardedSignals, extraSignals...)))
+}
+
+func run(logger *logrus.Entry, forwarded []os.Signal) int {
+	self, err := os.Executable()
+	if err != nil {
+		logger.Errorf("could not locate supercronic executable: %v", err)
+		return 1
+	}
+
+	// Catch signals before the child starts, so that none are missed.
+	signals := make(chan os.Signal, 16)
+	signal.Notify(signals, append([]os.Signal{syscall.SIGCHLD}, forwarded...)...)
+
+	cmd := exec.Command(self, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), childEnv+"=1")
+
+	// In its own process group, the child doesn't get signals sent by the
+	// terminal (e.g. CTRL+C) in addition to the ones forwarded to it.
+	platform.SetProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		logger.Errorf("failed to start supercronic: %v", err)
+		return 1
+	}
+
+	child := cmd.Process.Pid
+	logger.Debugf("running as PID 1, reaping processes (supercronic is PID %d)", child)
+
+	for sig := range signals {
+		if sig != syscall.SIGCHLD {
+			if err := cmd.Process.Signal(sig); err != nil {
+				logger.Debugf("failed to forward %s: %v", sig, err)
+			}
+			continue
+		}
+
+		if status, exited := reap(logger, child); exited {
+			return exitCode(status)
+		}
+	}
+
+	return 1
+}
+
+// reap waits for all children that have exited. It reports whether the child
+// was one of them, and if so, its status.
+func reap(logger *logrus.Entry, child int) (syscall.WaitStatus, bool) {
+	var childStatus syscall.WaitStatus
+	childExited := false
+
+	for {
+		var status syscall.WaitStatus
+
+		pid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || pid <= 0 {
+			return childStatus, childExited
+		}
+
+		if pid == child {
+			childStatus = status
+			childExited = true
+		} else {
+			logger.Debugf("reaped process %d", pid)
+		}
+	}
+}
+
+// exitCode returns the exit code of a process that exited with status, using
+// the shell's convention for processes killed by a signal.
+func exitCode(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
@@ -0,0 +1,47 @@
+package reaper
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLogger() *logrus.Entry {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logrus.NewEntry(logger)
+}
+
+func TestReapWaitsForExitedChildren(t *testing.T) {
+	other := exec.Command("/bin/sh", "-c", "exit 0")
+	child := exec.Command("/bin/sh", "-c", "sleep 0.1; exit 3")
+
+	if !assert.Nil(t, other.Start()) || !assert.Nil(t, child.Start()) {
+		return
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if status, exited := reap(newTestLogger(), child.Process.Pid); exited {
+			assert.Equal(t, 3, exitCode(status))
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Both were reaped, so there is nothing left to wait for.
+	_, err := syscall.Wait4(-1, nil, syscall.WNOHANG, nil)
+	assert.Equal(t, syscall.ECHILD, err)
+}
+
+func TestExitCodeOfSignaledProcess(t *testing.T) {
+	cmd := exec.Command("/bin/sh", "-c", "kill -TERM $$")
+	cmd.Run()
+
+	assert.Equal(t, 143, exitCode(cmd.ProcessState.Sys().(syscall.WaitStatus)))
+}
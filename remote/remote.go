@@ -0,0 +1,303 @@
+// Package remote fetches crontabs from URLs (http://, https://, or
+// s3://BUCKET/KEY) into local files, which supercronic reads like any other,
+// and polls them for changes.
+package remote
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"supercronic/archive"
+)
+
+var (
+	// DIR is where the local copies of remote crontabs are kept. They are
+	// named after their URL, so that jobs keep the same source across
+	// restarts.
+	DIR = filepath.Join(os.TempDir(), "supercronic-remote")
+
+	// FETCH_TIMEOUT is how long each fetch may take.
+	FETCH_TIMEOUT = 30 * time.Second
+
+	// MAX_SIZE is how large a remote crontab may be, in bytes.
+	MAX_SIZE int64 = 10 << 20
+)
+
+// IsURL reports whether the CRONTAB argument path is a URL to fetch.
+func IsURL(path string) bool {
+	for _, scheme := range []string{"http://", "https://", "s3://"} {
+		if strings.HasPrefix(path, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasURL reports whether any of the CRONTAB arguments paths is a URL.
+func HasURL(paths []string) bool {
+	for _, path := range paths {
+		if IsURL(path) {
+			return true
+		}
+	}
+	return false
+}
+
+type crontab struct {
+	url  string
+	path string
+
+	// The validators of the copy, for conditional requests.
+	etag         string
+	lastModified string
+	sum          [sha256.Size]byte
+}
+
+// Fetcher keeps local copies of remote crontabs, and sends on C when any of
+// them changes.
+type Fetcher struct {
+	C <-chan struct{}
+
+	paths    []string
+	crontabs []*crontab
+	logger   *logrus.Entry
+	client   *http.Client
+	done     chan struct{}
+}
+
+// New fetches the crontabs at the URLs among paths (the CRONTAB arguments),
+// and fails if any can't be fetched. If interval isn't 0, it then fetches
+// them again every interval, in the background.
+func New(logger *logrus.Entry, paths []string, interval time.Duration) (*Fetcher, error) {
+	if err := os.MkdirAll(DIR, 0700); err != nil {
+		return nil, err
+	}
+
+	c := make(chan struct{}, 1)
+
+	f := &Fetcher{
+		C:      c,
+		logger: logger,
+		client: &http.Client{Timeout: FETCH_TIMEOUT},
+		done:   make(chan struct{}),
+	}
+
+	for _, p := range paths {
+		if !IsURL(p) {
+			f.paths = append(f.paths, p)
+			continue
+		}
+
+		tab := &crontab{url: p, path: localPath(p)}
+
+		if _, err := f.fetch(tab); err != nil {
+			return nil, fmt.Errorf("could not fetch crontab %s: %v", p, err)
+		}
+
+		logger.Infof("fetched crontab: %s", p)
+
+		f.crontabs = append(f.crontabs, tab)
+		f.paths = append(f.paths, tab.path)
+	}
+
+	if interval > 0 {
+		go f.poll(interval, c)
+	}
+
+	return f, nil
+}
+
+// Paths returns the CRONTAB arguments New was given, with URLs replaced by
+// the paths of their local copies.
+func (f *Fetcher) Paths() []string {
+	return f.paths
+}
+
+// Close stops polling.
+func (f *Fetcher) Close() error {
+	close(f.done)
+	return nil
+}
+
+// localPath returns the path of the local copy of the crontab at u. It keeps
+// the name of the remote file, so that e.g. YAML files are still recognized
+// as such.
+func localPath(u string) string {
+	sum := sha256.Sum256([]byte(u))
+	name := "crontab"
+
+	if parsed, err := url.Parse(u); err == nil {
+		if base := path.Base(parsed.Path); base != "/" && base != "." {
+			name = base
+		}
+	}
+
+	return filepath.Join(DIR, hex.EncodeToString(sum[:8])+"-"+name)
+}
+
+func (f *Fetcher) poll(interval time.Duration, c chan<- struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+		}
+
+		changed := false
+
+		for _, tab := range f.crontabs {
+			updated, err := f.fetch(tab)
+			if err != nil {
+				// The copy we have stays in use until the next fetch.
+				f.logger.Warnf("could not fetch crontab %s: %v", tab.url, err)
+				continue
+			}
+
+			if updated {
+				f.logger.Infof("crontab changed: %s", tab.url)
+				changed = true
+			}
+		}
+
+		if changed {
+			select {
+			case c <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// fetch updates the copy of tab, if it changed, and returns whether it did.
+func (f *Fetcher) fetch(tab *crontab) (bool, error) {
+	header := make(http.Header)
+	if tab.etag != "" {
+		header.Set("If-None-Match", tab.etag)
+	}
+	if tab.lastModified != "" {
+		header.Set("If-Modified-Since", tab.lastModified)
+	}
+
+	req, err := newRequest(tab.url, header)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return false, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, MAX_SIZE+1))
+	if err != nil {
+		return false, err
+	}
+
+	if int64(len(body)) > MAX_SIZE {
+		return false, fmt.Errorf("crontab is larger than %d bytes", MAX_SIZE)
+	}
+
+	tab.etag = resp.Header.Get("ETag")
+	tab.lastModified = resp.Header.Get("Last-Modified")
+
+	// Servers that don't support conditional requests send the crontab
+	// every time.
+	sum := sha256.Sum256(body)
+	if sum == tab.sum {
+		return false, nil
+	}
+
+	if err := writeFile(tab.path, body); err != nil {
+		return false, err
+	}
+	tab.sum = sum
+
+	return true, nil
+}
+
+// writeFile replaces the file at path with one holding data, so that it is
+// never read half-written.
+func writeFile(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(tmp, bytes.NewReader(data)); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// newRequest returns the request that fetches the crontab at u. Objects in
+// S3 are fetched from the region in AWS_REGION (or AWS_DEFAULT_REGION), with
+// the credentials in AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, if set.
+// AWS_ENDPOINT_URL points at other services with an S3-compatible API (e.g.
+// MinIO).
+func newRequest(u string, header http.Header) (*http.Request, error) {
+	if !strings.HasPrefix(u, "s3://") {
+		req, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		return req, nil
+	}
+
+	location := strings.TrimPrefix(u, "s3://")
+	slash := strings.Index(location, "/")
+	if slash <= 0 || slash == len(location)-1 {
+		return nil, fmt.Errorf("bad S3 URL (expected s3://BUCKET/KEY): %s", u)
+	}
+
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+
+	endpoint := os.Getenv("AWS_ENDPOINT_URL")
+
+	return archive.NewGetRequest(archive.Config{
+		Bucket:    location[:slash],
+		Region:    region,
+		Endpoint:  endpoint,
+		PathStyle: endpoint != "",
+	}, location[slash+1:], header)
+}
@@ -0,0 +1,202 @@
+package remote
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type crontabServer struct {
+	mu       sync.Mutex
+	content  string
+	etag     string
+	requests []*http.Request
+}
+
+func (s *crontabServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, r)
+
+	if r.URL.Path == "/missing" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if s.etag != "" && r.Header.Get("If-None-Match") == s.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("ETag", s.etag)
+	w.Write([]byte(s.content))
+}
+
+func (s *crontabServer) set(content string, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.content, s.etag = content, etag
+}
+
+func setupDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "supercronic-remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := DIR
+	DIR = dir
+
+	return func() {
+		DIR = previous
+		os.RemoveAll(dir)
+	}
+}
+
+func TestIsURL(t *testing.T) {
+	assert.True(t, IsURL("https://example.com/crontab"))
+	assert.True(t, IsURL("s3://bucket/crontab"))
+	assert.False(t, IsURL("/etc/crontab"))
+	assert.False(t, IsURL("crontab"))
+
+	assert.True(t, HasURL([]string{"/etc/crontab", "http://example.com/crontab"}))
+	assert.False(t, HasURL([]string{"/etc/crontab"}))
+}
+
+func TestFetcher(t *testing.T) {
+	defer setupDir(t)()
+
+	server := &crontabServer{content: "* * * * * foo\n", etag: `"1"`}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	f, err := New(logrus.NewEntry(logrus.New()), []string{"/etc/crontab", ts.URL + "/jobs.yaml"}, 20*time.Millisecond)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer f.Close()
+
+	paths := f.Paths()
+	if !assert.Equal(t, 2, len(paths)) {
+		return
+	}
+	assert.Equal(t, "/etc/crontab", paths[0])
+	assert.Regexp(t, `-jobs\.yaml$`, paths[1])
+
+	content, err := ioutil.ReadFile(paths[1])
+	if assert.Nil(t, err) {
+		assert.Equal(t, "* * * * * foo\n", string(content))
+	}
+
+	// Unchanged crontabs don't trigger reloads.
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-f.C:
+		t.Fatal("unexpected change")
+	default:
+	}
+
+	server.mu.Lock()
+	assert.True(t, len(server.requests) > 1)
+	assert.Equal(t, `"1"`, server.requests[len(server.requests)-1].Header.Get("If-None-Match"))
+	server.mu.Unlock()
+
+	server.set("* * * * * bar\n", `"2"`)
+
+	select {
+	case <-f.C:
+	case <-time.After(time.Second):
+		t.Fatal("change not detected")
+	}
+
+	content, err = ioutil.ReadFile(paths[1])
+	if assert.Nil(t, err) {
+		assert.Equal(t, "* * * * * bar\n", string(content))
+	}
+}
+
+func TestFetcherWithoutETag(t *testing.T) {
+	defer setupDir(t)()
+
+	server := &crontabServer{content: "* * * * * foo\n"}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	f, err := New(logrus.NewEntry(logrus.New()), []string{ts.URL}, 20*time.Millisecond)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer f.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-f.C:
+		t.Fatal("unexpected change")
+	default:
+	}
+
+	server.set("* * * * * bar\n", "")
+
+	select {
+	case <-f.C:
+	case <-time.After(time.Second):
+		t.Fatal("change not detected")
+	}
+}
+
+func TestFetcherFailsOnMissingCrontab(t *testing.T) {
+	defer setupDir(t)()
+
+	ts := httptest.NewServer(&crontabServer{})
+	defer ts.Close()
+
+	_, err := New(logrus.NewEntry(logrus.New()), []string{ts.URL + "/missing"}, 0)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "404")
+	}
+}
+
+func TestS3Request(t *testing.T) {
+	defer setupDir(t)()
+
+	server := &crontabServer{content: "* * * * * foo\n"}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	for name, value := range map[string]string{
+		"AWS_ENDPOINT_URL":      ts.URL,
+		"AWS_REGION":            "eu-west-1",
+		"AWS_ACCESS_KEY_ID":     "AKID",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+	} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, value)
+	}
+
+	f, err := New(logrus.NewEntry(logrus.New()), []string{"s3://bucket/dir/crontab"}, 0)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer f.Close()
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if assert.Equal(t, 1, len(server.requests)) {
+		r := server.requests[0]
+		assert.Equal(t, "/bucket/dir/crontab", r.URL.Path)
+		assert.Contains(t, r.Header.Get("Authorization"), "Credential=AKID/")
+		assert.Contains(t, r.Header.Get("Authorization"), "/eu-west-1/s3/aws4_request")
+	}
+
+	_, err = New(logrus.NewEntry(logrus.New()), []string{"s3://bucket"}, 0)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,227 @@
+// Package results posts the result of every job run to a webhook, e.g. to
+// feed an internal dashboard.
+package results
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"supercronic/cron"
+)
+
+var (
+	// Timeout for each delivery attempt.
+	SEND_TIMEOUT = 10 * time.Second
+
+	// Delay before the first retry of a failed delivery. It doubles with
+	// every retry.
+	RETRY_DELAY = time.Second
+)
+
+const (
+	defaultOutputBytes = 4096
+	defaultRetries     = 3
+)
+
+// SignatureHeader holds the HMAC-SHA256 of the body, keyed with the
+// configured secret, as sha256=<hex>.
+const SignatureHeader = "X-Supercronic-Signature"
+
+type Config struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	// Secret, if set, is used to sign deliveries (see SignatureHeader).
+	Secret string `yaml:"secret"`
+	// OutputBytes is how much of the end of the output to include (4096
+	// bytes by default).
+	OutputBytes int `yaml:"output_bytes"`
+	// Retries is how many times failed deliveries are retried (3 by
+	// default). Set it to -1 to not retry.
+	Retries int `yaml:"retries"`
+}
+
+// Result describes a finished job run.
+type Result struct {
+	Hostname    string    `json:"hostname"`
+	Name        string    `json:"name,omitempty"`
+	Schedule    string    `json:"schedule"`
+	Command     string    `json:"command"`
+	Position    int       `json:"position"`
+	Source      string    `json:"source,omitempty"`
+	Iteration   uint64    `json:"iteration"`
+	Succeeded   bool      `json:"succeeded"`
+	ExitCode    int       `json:"exit_code"`
+	Error       string    `json:"error,omitempty"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	Duration    float64   `json:"duration_seconds"`
+	// Output is the end of the job's output, stdout and stderr combined.
+	Output          string `json:"output"`
+	OutputTruncated bool   `json:"output_truncated"`
+	OutputURL       string `json:"output_url,omitempty"`
+}
+
+// Hook posts a Result when a job finishes. Deliveries happen in the
+// background, so that retries don't hold up the job.
+type Hook struct {
+	config   Config
+	client   *http.Client
+	hostname string
+	pending  sync.WaitGroup
+}
+
+func NewHook(config Config) (*Hook, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("result webhook is missing url")
+	}
+
+	if config.OutputBytes <= 0 {
+		config.OutputBytes = defaultOutputBytes
+	}
+
+	if config.Retries == 0 {
+		config.Retries = defaultRetries
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	return &Hook{config: config, client: &http.Client{Timeout: SEND_TIMEOUT}, hostname: hostname}, nil
+}
+
+func (h *Hook) JobStarted(e *cron.Execution) {}
+
+func (h *Hook) JobFinished(e *cron.Execution) {
+	body, err := json.Marshal(h.result(e))
+	if err != nil {
+		e.Logger.Errorf("failed to encode run result: %v", err)
+		return
+	}
+
+	h.pending.Add(1)
+	go func() {
+		defer h.pending.Done()
+
+		if err := h.deliver(body); err != nil {
+			e.Logger.Errorf("failed to post run result: %v", err)
+		}
+	}()
+}
+
+// Close waits for deliveries in progress.
+func (h *Hook) Close() {
+	h.pending.Wait()
+}
+
+func (h *Hook) result(e *cron.Execution) *Result {
+	r := &Result{
+		Hostname:    h.hostname,
+		Name:        e.Job.Name,
+		Schedule:    e.Job.Schedule,
+		Command:     e.Job.Command,
+		Position:    e.Job.Position,
+		Source:      e.Job.Source,
+		Iteration:   e.Iteration,
+		Succeeded:   e.Err == nil,
+		ExitCode:    e.ExitCode,
+		ScheduledAt: e.ScheduledAt,
+		StartedAt:   e.StartedAt,
+		FinishedAt:  e.FinishedAt,
+		Duration:    e.Duration().Seconds(),
+		OutputURL:   e.OutputURL,
+	}
+
+	if e.Err != nil {
+		r.Error = e.Err.Error()
+	}
+
+	lines := e.Output.Lines()
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.Text
+	}
+
+	r.Output = strings.Join(texts, "\n")
+	r.OutputTruncated = e.Output.Truncated()
+
+	if len(r.Output) > h.config.OutputBytes {
+		start := len(r.Output) - h.config.OutputBytes
+		for start < len(r.Output) && !utf8.RuneStart(r.Output[start]) {
+			start++
+		}
+
+		r.Output = r.Output[start:]
+		r.OutputTruncated = true
+	}
+
+	return r
+}
+
+// deliver posts body, retrying on network errors, server errors, and rate
+// limiting.
+func (h *Hook) deliver(body []byte) error {
+	delay := RETRY_DELAY
+
+	for attempt := 0; ; attempt++ {
+		retry, err := h.post(body)
+		if err == nil || !retry || attempt >= h.config.Retries {
+			return err
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (h *Hook) post(body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", h.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if h.config.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(h.config.Secret, body))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("%s returned %s", h.config.URL, resp.Status)
+	}
+
+	return false, nil
+}
+
+// Sign returns the value of SignatureHeader for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,165 @@
+package results
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+func newTestExecution(err error, lines ...string) *cron.Execution {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	output := &cron.Output{}
+	for i, line := range lines {
+		channel := "stdout"
+		if i%2 == 1 {
+			channel = "stderr"
+		}
+		output.Append(channel, line)
+	}
+	output.Close()
+
+	scheduledAt := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+	exitCode := 0
+	if err != nil {
+		exitCode = 2
+	}
+
+	return &cron.Execution{
+		Job: &crontab.Job{
+			CrontabLine: crontab.CrontabLine{Schedule: "0 3 * * *", Command: "backup.sh"},
+			Name:        "db-backup",
+			Position:    1,
+		},
+		Logger:      logrus.NewEntry(logger),
+		Iteration:   4,
+		ScheduledAt: scheduledAt,
+		StartedAt:   scheduledAt.Add(time.Second),
+		FinishedAt:  scheduledAt.Add(3 * time.Second),
+		Err:         err,
+		ExitCode:    exitCode,
+		Output:      output,
+		OutputURL:   "https://logs.example.com/db-backup.log.gz",
+	}
+}
+
+type testServer struct {
+	mu        sync.Mutex
+	failures  int
+	requests  int
+	body      []byte
+	signature string
+	header    string
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	if s.requests <= s.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	s.body, _ = ioutil.ReadAll(r.Body)
+	s.signature = r.Header.Get(SignatureHeader)
+	s.header = r.Header.Get("X-Team")
+}
+
+func TestHookPostsResults(t *testing.T) {
+	api := &testServer{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	hook, err := NewHook(Config{URL: server.URL, Secret: "s3cret", Headers: map[string]string{"X-Team": "data"}})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	hook.JobFinished(newTestExecution(errors.New("error running command: exit status 2"), "dumping", "disk full"))
+	hook.Close()
+
+	assert.Equal(t, Sign("s3cret", api.body), api.signature)
+	assert.Equal(t, "data", api.header)
+
+	result := &Result{}
+	if assert.Nil(t, json.Unmarshal(api.body, result)) {
+		assert.Equal(t, "db-backup", result.Name)
+		assert.Equal(t, "0 3 * * *", result.Schedule)
+		assert.Equal(t, uint64(4), result.Iteration)
+		assert.False(t, result.Succeeded)
+		assert.Equal(t, 2, result.ExitCode)
+		assert.Equal(t, "error running command: exit status 2", result.Error)
+		assert.Equal(t, 2.0, result.Duration)
+		assert.True(t, result.ScheduledAt.Equal(time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)))
+		assert.Equal(t, "dumping\ndisk full", result.Output)
+		assert.False(t, result.OutputTruncated)
+		assert.Equal(t, "https://logs.example.com/db-backup.log.gz", result.OutputURL)
+	}
+}
+
+func TestHookTruncatesOutput(t *testing.T) {
+	hook, _ := NewHook(Config{URL: "http://127.0.0.1", OutputBytes: 10})
+
+	result := hook.result(newTestExecution(nil, "first line", strings.Repeat("é", 10)))
+	assert.True(t, result.Succeeded)
+	assert.Equal(t, strings.Repeat("é", 5), result.Output)
+	assert.True(t, result.OutputTruncated)
+}
+
+func TestHookRetries(t *testing.T) {
+	defer func(delay time.Duration) { RETRY_DELAY = delay }(RETRY_DELAY)
+	RETRY_DELAY = time.Millisecond
+
+	api := &testServer{failures: 2}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	hook, _ := NewHook(Config{URL: server.URL})
+	hook.JobFinished(newTestExecution(nil))
+	hook.Close()
+
+	assert.Equal(t, 3, api.requests)
+	assert.NotEmpty(t, api.body)
+
+	// Without retries, the first failure is final.
+	api = &testServer{failures: 1}
+	server = httptest.NewServer(api)
+	defer server.Close()
+
+	hook, _ = NewHook(Config{URL: server.URL, Retries: -1})
+	hook.JobFinished(newTestExecution(nil))
+	hook.Close()
+
+	assert.Equal(t, 1, api.requests)
+	assert.Empty(t, api.body)
+}
+
+func TestHookDoesNotRetryClientErrors(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	hook, _ := NewHook(Config{URL: server.URL})
+
+	err := hook.deliver([]byte("{}"))
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, requests)
+}
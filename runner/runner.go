@@ -0,0 +1,520 @@
+// Package runner schedules and runs the jobs from one or more crontabs. It is
+// what the supercronic command is built on, and can be used to embed
+// supercronic in other programs.
+package runner
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"supercronic/cron"
+	"supercronic/crontab"
+	"supercronic/history"
+)
+
+type Options struct {
+	// Job holds the options every job is started with. Jobs may override
+	// the overlap and catch-up policies using directives.
+	Job cron.Options
+
+	// History, when set, is used to find the last run of jobs that catch up
+	// on missed runs, and the last success of jobs that skip runs done
+	// already. Record runs by adding history.NewHook to Job.Hooks.
+	History *history.Store
+
+	// Path is the path the crontabs were read from. Jobs that come from
+	// another file (i.e. when Path is a directory or a glob) are logged with
+	// their source.
+	Path string
+
+	// Paths, instead of Path, are the paths the crontabs were read from when
+	// there are several, in which case all jobs are logged with their source.
+	Paths []string
+
+	// Logger, when set, returns the logger job logs to, before the fields
+	// that identify it are added. When it returns nil, the job logs to the
+	// runner's logger.
+	Logger func(job *crontab.Job) *logrus.Entry
+}
+
+type entry struct {
+	context *crontab.Context
+	job     *crontab.Job
+}
+
+// generation is the set of jobs scheduled by one call to Start.
+type generation struct {
+	stop   context.CancelFunc
+	wg     *sync.WaitGroup
+	done   chan struct{}
+	states []*cron.JobState
+}
+
+func (g *generation) isDone() bool {
+	select {
+	case <-g.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Runner schedules its jobs from the time it is started, until it is
+// stopped. It can be started again (e.g. with a different set of jobs) right
+// away: jobs from the previous start that are still running finish in the
+// background.
+type Runner struct {
+	logger   *logrus.Entry
+	options  Options
+	registry *cron.Registry
+
+	mu      sync.Mutex
+	entries []entry
+	ctx     context.Context
+	current *generation
+	// stopped holds the generations whose jobs may still be running.
+	stopped []*generation
+	// started is set once the runner has been started, so that jobs only
+	// run at startup the first time.
+	started bool
+}
+
+func New(logger *logrus.Entry, options Options) *Runner {
+	return &Runner{
+		logger:   logger,
+		options:  options,
+		registry: cron.NewRegistry(),
+	}
+}
+
+// Registry holds the state of the jobs scheduled by the runner. It is the
+// same across restarts, but only holds the jobs from the latest start.
+func (r *Runner) Registry() *cron.Registry {
+	return r.registry
+}
+
+// AddJob adds a job that runs in cronCtx. It is scheduled the next time the
+// runner starts.
+func (r *Runner) AddJob(cronCtx *crontab.Context, job *crontab.Job) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries = append(r.entries, entry{context: cronCtx, job: job})
+}
+
+// AddCrontab adds all the jobs in tab.
+func (r *Runner) AddCrontab(tab *crontab.Crontab) {
+	for _, job := range tab.Jobs {
+		r.AddJob(tab.Context, job)
+	}
+}
+
+// SetCrontabs replaces the runner's jobs with the jobs in tabs.
+func (r *Runner) SetCrontabs(tabs []*crontab.Crontab) {
+	r.mu.Lock()
+	r.entries = nil
+	r.mu.Unlock()
+
+	for _, tab := range tabs {
+		r.AddCrontab(tab)
+	}
+}
+
+// Start schedules the runner's jobs, until Stop is called or ctx is done.
+func (r *Runner) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current != nil {
+		return fmt.Errorf("runner is already started")
+	}
+
+	// Jobs that are still running from a previous start are what new runs
+	// of the same job overlap with.
+	previous := make(map[string]*cron.JobState)
+	for _, g := range r.stopped {
+		if g.isDone() {
+			continue
+		}
+		for _, state := range g.states {
+			if state.Status().Running > 0 {
+				previous[state.Job.Key()] = state
+			}
+		}
+	}
+
+	// Jobs that were paused stay paused across restarts.
+	paused := make(map[string]bool)
+	for _, state := range r.registry.Jobs() {
+		if state.IsPaused() {
+			paused[state.Job.Key()] = true
+		}
+	}
+
+	r.ctx = ctx
+	exitCtx, stop := context.WithCancel(ctx)
+	g := &generation{stop: stop, wg: &sync.WaitGroup{}, done: make(chan struct{})}
+
+	r.registry.Reset()
+
+	for _, e := range r.entries {
+		jobLogger := r.JobLogger(e.job)
+
+		// Jobs that are kept running never finish, so they would never
+		// let the others be done.
+		if r.options.Job.RunOnce && crontab.IsDaemon(e.job.Expression) {
+			jobLogger.Info("not starting job that is kept running: every job only runs once")
+			continue
+		}
+
+		options := r.jobOptions(e.job, jobLogger)
+		options.Previous = previous[e.job.Key()]
+		if r.started {
+			options.RunAtStartup = false
+		}
+
+		state := cron.StartJob(g.wg, e.context, e.job, exitCtx, jobLogger, options)
+		if paused[e.job.Key()] {
+			jobLogger.Info("job is still paused")
+			state.Pause()
+		}
+
+		r.registry.Add(state)
+		g.states = append(g.states, state)
+	}
+
+	// Jobs that run once start as soon as they can all find the jobs they
+	// run after.
+	if r.options.Job.RunOnce {
+		for _, state := range g.states {
+			state.Trigger()
+		}
+	}
+
+	go func() {
+		g.wg.Wait()
+		close(g.done)
+	}()
+
+	r.current = g
+	r.started = true
+	return nil
+}
+
+func (r *Runner) jobOptions(job *crontab.Job, jobLogger *logrus.Entry) cron.Options {
+	options := r.options.Job
+	options.Registry = r.registry
+
+	if job.Limits != nil && job.Limits.CPU > 0 && options.CgroupParent == "" {
+		jobLogger.Warn("cpu limit has no effect without -cgroup-parent")
+	}
+
+	if job.Overlap != "" {
+		options.Overlap = job.Overlap
+	}
+
+	// Jobs that are kept running are restarted once the instance from
+	// before a reload has stopped.
+	if crontab.IsDaemon(job.Expression) {
+		options.Overlap = crontab.OverlapQueue
+	}
+
+	if job.CatchUp != "" {
+		options.CatchUp = job.CatchUp
+	}
+
+	if job.RunAtStartup != nil {
+		options.RunAtStartup = *job.RunAtStartup
+	}
+
+	if job.SkipIfDone {
+		if r.options.History == nil {
+			jobLogger.Warn("skip_if_done has no effect without -history-db")
+		} else if record, err := r.options.History.LastSuccess(job); err != nil {
+			jobLogger.Errorf("could not read job history: %v", err)
+		} else if record != nil {
+			options.LastSuccess = record.ScheduledAt
+		}
+	}
+
+	if options.CatchUp != "" && options.CatchUp != crontab.CatchUpSkip {
+		if r.options.History == nil {
+			jobLogger.Warnf("catch-up policy %s has no effect without -history-db", options.CatchUp)
+		} else if record, err := r.options.History.LastRun(job); err != nil {
+			jobLogger.Errorf("could not read job history: %v", err)
+		} else if record != nil {
+			options.LastRun = record.ScheduledAt
+		}
+	}
+
+	return options
+}
+
+// Stop stops scheduling jobs. Jobs that are running are left to finish: use
+// Wait to wait for them, or Abort to terminate them.
+func (r *Runner) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stopCurrent()
+}
+
+func (r *Runner) stopCurrent() {
+	if r.current == nil {
+		return
+	}
+
+	r.current.stop()
+
+	stopped := []*generation{r.current}
+	for _, g := range r.stopped {
+		if !g.isDone() {
+			stopped = append(stopped, g)
+		}
+	}
+
+	r.stopped = stopped
+	r.current = nil
+}
+
+// Abort terminates all running jobs, including those from previous starts.
+func (r *Runner) Abort() {
+	r.mu.Lock()
+	generations := r.generations()
+	r.mu.Unlock()
+
+	for _, g := range generations {
+		for _, state := range g.states {
+			state.Abort()
+		}
+	}
+}
+
+// Signal sends sig to all running jobs (i.e. to their process groups),
+// including those from previous starts, and returns how many there were.
+func (r *Runner) Signal(sig syscall.Signal) int {
+	r.mu.Lock()
+	generations := r.generations()
+	r.mu.Unlock()
+
+	signaled := 0
+	for _, g := range generations {
+		for _, state := range g.states {
+			signaled += state.Signal(sig)
+		}
+	}
+
+	return signaled
+}
+
+// Running returns how many runs are in progress, including those from
+// previous starts.
+func (r *Runner) Running() int {
+	r.mu.Lock()
+	generations := r.generations()
+	r.mu.Unlock()
+
+	running := 0
+	for _, g := range generations {
+		for _, state := range g.states {
+			running += state.Status().Running
+		}
+	}
+
+	return running
+}
+
+func (r *Runner) generations() []*generation {
+	generations := make([]*generation, 0, len(r.stopped)+1)
+	if r.current != nil {
+		generations = append(generations, r.current)
+	}
+	return append(generations, r.stopped...)
+}
+
+// Wait waits for the runner to be stopped (or its context to be done), and
+// for all its jobs to finish. The runner can then be started again.
+func (r *Runner) Wait() {
+	r.mu.Lock()
+	generations := r.generations()
+	r.mu.Unlock()
+
+	for _, g := range generations {
+		<-g.done
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Don't reset a runner that was started again in the meantime.
+	if r.current != nil && r.current.isDone() {
+		r.stopCurrent()
+	}
+}
+
+// Reload starts scheduling the jobs in tabs instead of the runner's jobs
+// (using the context it was last started with). Jobs that are running are
+// left to finish in the background.
+func (r *Runner) Reload(tabs []*crontab.Crontab) error {
+	r.mu.Lock()
+	ctx := r.ctx
+	r.mu.Unlock()
+
+	if ctx == nil {
+		return fmt.Errorf("runner was never started")
+	}
+
+	r.Stop()
+	r.SetCrontabs(tabs)
+
+	if running := r.Running(); running > 0 {
+		r.logger.Infof("letting %d running job(s) finish in the background", running)
+	}
+
+	return r.Start(ctx)
+}
+
+// JobLogger returns the logger used for job.
+func (r *Runner) JobLogger(job *crontab.Job) *logrus.Entry {
+	fields := logrus.Fields{
+		"job.schedule": job.Schedule,
+		"job.command":  job.Command,
+		"job.position": job.Position,
+	}
+
+	if job.Name != "" {
+		fields["job.name"] = job.Name
+	}
+
+	if job.Group != "" {
+		fields["job.group"] = job.Group
+	}
+
+	// Only tag jobs with their source when the crontab was loaded from a
+	// directory or a glob (or several paths), or when they were included
+	// from another file.
+	if len(r.options.Paths) > 0 || job.Source != r.options.Path {
+		fields["job.source"] = job.Source
+	}
+
+	logger := r.logger
+	if r.options.Logger != nil {
+		if l := r.options.Logger(job); l != nil {
+			logger = l
+		}
+	}
+
+	return logger.WithFields(fields)
+}
+
+// LogState logs a snapshot of the state of every job: when it runs next,
+// whether it is running (and since when), and how its last run went.
+func (r *Runner) LogState() {
+	jobs := r.registry.Jobs()
+	r.logger.Infof("state of %d job(s)", len(jobs))
+
+	for _, state := range jobs {
+		status := state.Status()
+
+		fields := logrus.Fields{
+			"job.id":  status.ID,
+			"running": status.Running,
+			"paused":  status.Paused,
+		}
+
+		if status.Waiting > 0 {
+			fields["waiting"] = status.Waiting
+		}
+
+		if status.Tripped {
+			fields["tripped"] = true
+		}
+
+		if status.NextRun != nil {
+			fields["next_run"] = *status.NextRun
+		}
+
+		if status.RunningSince != nil {
+			fields["running_since"] = *status.RunningSince
+		}
+
+		if status.LastRun != nil {
+			fields["last_run.finished_at"] = status.LastRun.FinishedAt
+			fields["last_run.succeeded"] = status.LastRun.Succeeded
+			fields["last_run.exit_code"] = status.LastRun.ExitCode
+		}
+
+		r.JobLogger(state.Job).WithFields(fields).Info("job state")
+	}
+}
+
+// Summarize logs how the last run of every job went, and returns how many
+// jobs did not succeed (including those that never ran).
+func (r *Runner) Summarize() int {
+	jobs := r.registry.Jobs()
+	failed := 0
+
+	for _, state := range jobs {
+		status := state.Status()
+		jobLogger := r.JobLogger(state.Job)
+
+		switch {
+		case status.LastRun == nil:
+			jobLogger.Warn("job did not run")
+			failed++
+		case !status.LastRun.Succeeded:
+			jobLogger.WithField("exit_code", status.LastRun.ExitCode).Warnf("job did not succeed: %s", status.LastRun.Error)
+			failed++
+		}
+	}
+
+	r.logger.Infof("%d of %d job(s) succeeded", len(jobs)-failed, len(jobs))
+	return failed
+}
+
+// ReadCrontabs reads the crontabs at path, which may be a file, a directory,
+// or a glob.
+func ReadCrontabs(logger *logrus.Entry, path string, options crontab.ParseOptions) ([]*crontab.Crontab, error) {
+	return ReadAllCrontabs(logger, []string{path}, options)
+}
+
+// ReadAllCrontabs reads the crontabs at paths, in order, as ReadCrontabs
+// would. Files that several paths designate are only read once.
+func ReadAllCrontabs(logger *logrus.Entry, paths []string, options crontab.ParseOptions) ([]*crontab.Crontab, error) {
+	tabs := make([]*crontab.Crontab, 0, len(paths))
+	read := make(map[string]bool)
+
+	for _, path := range paths {
+		files, err := crontab.ExpandPath(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(files) == 0 {
+			logger.Warnf("no crontab found in %s", path)
+		}
+
+		for _, file := range files {
+			if read[filepath.Clean(file)] {
+				continue
+			}
+			read[filepath.Clean(file)] = true
+
+			logger.Infof("read crontab: %s", file)
+
+			tab, err := crontab.ReadCrontab(file, options)
+			if err != nil {
+				return nil, err
+			}
+
+			tabs = append(tabs, tab)
+		}
+	}
+
+	return tabs, nil
+}
@@ -0,0 +1,394 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+type recordingHook struct {
+	finished chan *cron.Execution
+}
+
+func (h *recordingHook) JobStarted(e *cron.Execution) {}
+
+func (h *recordingHook) JobFinished(e *cron.Execution) {
+	h.finished <- e
+}
+
+func newTestRunner(t *testing.T, tab string) (*Runner, *recordingHook, *crontab.Crontab) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	hook := &recordingHook{finished: make(chan *cron.Execution, 10)}
+
+	r := New(logrus.NewEntry(logger), Options{Job: cron.Options{Hooks: []cron.Hook{hook}}})
+
+	parsed, err := crontab.ParseCrontab(bytes.NewBufferString(tab))
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	return r, hook, parsed
+}
+
+func waitForRun(t *testing.T, hook *recordingHook) *cron.Execution {
+	select {
+	case e := <-hook.finished:
+		return e
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timed out waiting for run")
+		return nil
+	}
+}
+
+func TestRunnerRunsJobs(t *testing.T) {
+	r, hook, tab := newTestRunner(t, "@yearly true\n")
+	r.AddCrontab(tab)
+
+	if !assert.Nil(t, r.Start(context.Background())) {
+		return
+	}
+	assert.NotNil(t, r.Start(context.Background()))
+
+	jobs := r.Registry().Jobs()
+	if !assert.Len(t, jobs, 1) {
+		return
+	}
+
+	jobs[0].Trigger()
+	e := waitForRun(t, hook)
+	assert.Equal(t, "true", e.Job.Command)
+	assert.Nil(t, e.Err)
+
+	r.Stop()
+	r.Wait()
+
+	// Once stopped, the runner can be started again.
+	assert.Nil(t, r.Start(context.Background()))
+	r.Stop()
+	r.Wait()
+}
+
+func TestRunnerReload(t *testing.T) {
+	r, hook, tab := newTestRunner(t, "@yearly true\n")
+
+	assert.NotNil(t, r.Reload(nil))
+
+	r.AddCrontab(tab)
+	if !assert.Nil(t, r.Start(context.Background())) {
+		return
+	}
+
+	_, _, reloaded := newTestRunner(t, "@yearly false\n@yearly true\n")
+	if !assert.Nil(t, r.Reload([]*crontab.Crontab{reloaded})) {
+		return
+	}
+
+	jobs := r.Registry().Jobs()
+	if !assert.Len(t, jobs, 2) {
+		return
+	}
+
+	jobs[0].Trigger()
+	e := waitForRun(t, hook)
+	assert.Equal(t, "false", e.Job.Command)
+	assert.NotNil(t, e.Err)
+
+	r.Stop()
+	r.Wait()
+}
+
+func TestRunnerRunsJobsAtStartup(t *testing.T) {
+	r, hook, tab := newTestRunner(t, "@yearly true\n# run_at_startup: false\n@yearly false\n")
+	r.options.Job.RunAtStartup = true
+	r.AddCrontab(tab)
+
+	if !assert.Nil(t, r.Start(context.Background())) {
+		return
+	}
+
+	e := waitForRun(t, hook)
+	assert.Equal(t, "true", e.Job.Command)
+
+	// Jobs only run at startup the first time the runner starts.
+	if !assert.Nil(t, r.Reload([]*crontab.Crontab{tab})) {
+		return
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, hook.finished, 0)
+
+	r.Stop()
+	r.Wait()
+}
+
+func TestRunnerKeepsJobsPausedAcrossReloads(t *testing.T) {
+	r, _, tab := newTestRunner(t, "@yearly true\n@yearly false\n")
+	r.AddCrontab(tab)
+
+	if !assert.Nil(t, r.Start(context.Background())) {
+		return
+	}
+
+	r.Registry().Jobs()[0].Pause()
+
+	_, _, reloaded := newTestRunner(t, "@yearly false\n@yearly true\n")
+	if !assert.Nil(t, r.Reload([]*crontab.Crontab{reloaded})) {
+		return
+	}
+
+	jobs := r.Registry().Jobs()
+	if assert.Len(t, jobs, 2) {
+		assert.False(t, jobs[0].IsPaused())
+		assert.True(t, jobs[1].IsPaused())
+	}
+
+	r.Stop()
+	r.Wait()
+}
+
+func waitForRunning(t *testing.T, r *Runner, running int) {
+	deadline := time.Now().Add(3 * time.Second)
+	for r.Running() != running {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d running jobs", running)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRunnerReloadDoesNotWait(t *testing.T) {
+	r, hook, tab := newTestRunner(t, "@yearly sleep 10\n")
+	r.AddCrontab(tab)
+
+	if !assert.Nil(t, r.Start(context.Background())) {
+		return
+	}
+
+	r.Registry().Jobs()[0].Trigger()
+	waitForRunning(t, r, 1)
+
+	_, _, reloaded := newTestRunner(t, "@yearly true\n@yearly sleep 10\n")
+
+	done := make(chan error)
+	go func() {
+		done <- r.Reload([]*crontab.Crontab{reloaded})
+	}()
+
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatalf("reload waited for running jobs")
+	}
+
+	jobs := r.Registry().Jobs()
+	if !assert.Len(t, jobs, 2) {
+		return
+	}
+
+	// New jobs run while the old run is still going.
+	jobs[0].Trigger()
+	e := waitForRun(t, hook)
+	assert.Equal(t, "true", e.Job.Command)
+	assert.Equal(t, 1, r.Running())
+
+	// The same job is skipped while its previous run is still going.
+	jobs[1].Trigger()
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, 1, r.Running())
+
+	// Abort and Wait still cover the old run.
+	r.Stop()
+	r.Abort()
+
+	e = waitForRun(t, hook)
+	assert.Equal(t, "sleep 10", e.Job.Command)
+	assert.NotNil(t, e.Err)
+
+	r.Wait()
+	assert.Equal(t, 0, r.Running())
+}
+
+func TestRunnerStopsWithContext(t *testing.T) {
+	r, _, tab := newTestRunner(t, "@yearly true\n")
+	r.AddCrontab(tab)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if !assert.Nil(t, r.Start(ctx)) {
+		return
+	}
+
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		r.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("runner did not stop with its context")
+	}
+}
+
+func TestRunnerRunsJobsOnce(t *testing.T) {
+	r, hook, tab := newTestRunner(t, "# name: b\n# after: a\n@yearly true\n# name: a\n@yearly false\n@yearly true\n")
+	r.options.Job.RunOnce = true
+	r.AddCrontab(tab)
+
+	if !assert.Nil(t, r.Start(context.Background())) {
+		return
+	}
+
+	// Runs don't wait for the runner to be stopped.
+	done := make(chan struct{})
+	go func() {
+		r.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timed out waiting for jobs")
+	}
+
+	// b is skipped, since a failed.
+	assert.Len(t, hook.finished, 2)
+	assert.Equal(t, 2, r.Summarize())
+
+	for _, state := range r.Registry().Jobs() {
+		if state.Job.Name == "b" {
+			assert.Equal(t, "skipped: a failed", state.Status().LastRun.Error)
+		}
+	}
+}
+
+func TestJobLogger(t *testing.T) {
+	logger := logrus.New()
+	r := New(logrus.NewEntry(logger), Options{Path: "/etc/cron.d"})
+
+	job := &crontab.Job{CrontabLine: crontab.CrontabLine{Schedule: "@daily", Command: "foo"}, Position: 2}
+	job.Source = "/etc/cron.d"
+	assert.Equal(t, logrus.Fields{"job.schedule": "@daily", "job.command": "foo", "job.position": 2}, r.JobLogger(job).Data)
+
+	job.Source = "/etc/cron.d/backups"
+	assert.Equal(t, "/etc/cron.d/backups", r.JobLogger(job).Data["job.source"])
+
+	job.Name = "nightly-backup"
+	assert.Equal(t, "nightly-backup", r.JobLogger(job).Data["job.name"])
+
+	r = New(logrus.NewEntry(logger), Options{Path: "/etc/crontab", Paths: []string{"/etc/crontab", "/etc/cron.d"}})
+	job.Source = "/etc/crontab"
+	assert.Equal(t, "/etc/crontab", r.JobLogger(job).Data["job.source"])
+}
+
+func TestReadAllCrontabs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	first := write("first", "FOO=1\n@daily echo $FOO\n")
+	second := write("second", "@hourly echo $FOO\n")
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	tabs, err := ReadAllCrontabs(logrus.NewEntry(logger), []string{second, first, filepath.Join(dir, "*")}, crontab.ParseOptions{})
+	if !assert.Nil(t, err) || !assert.Equal(t, 2, len(tabs)) {
+		return
+	}
+
+	// Each file keeps its own variables.
+	assert.Equal(t, second, tabs[0].Jobs[0].Source)
+	assert.Equal(t, "", tabs[0].Context.Environ["FOO"])
+	assert.Equal(t, first, tabs[1].Jobs[0].Source)
+	assert.Equal(t, "1", tabs[1].Context.Environ["FOO"])
+
+	bad := write("bad", "not a crontab line\n")
+	_, err = ReadAllCrontabs(logrus.NewEntry(logger), []string{first, bad}, crontab.ParseOptions{})
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), bad)
+	}
+}
+
+func TestJobLoggerOption(t *testing.T) {
+	logger := logrus.New()
+	other := logrus.New()
+
+	r := New(logrus.NewEntry(logger), Options{Logger: func(job *crontab.Job) *logrus.Entry {
+		if job.Name == "other" {
+			return logrus.NewEntry(other).WithField("prefix", "other")
+		}
+		return nil
+	}})
+
+	job := &crontab.Job{CrontabLine: crontab.CrontabLine{Schedule: "@daily", Command: "foo"}}
+	assert.True(t, r.JobLogger(job).Logger == logger)
+
+	job.Name = "other"
+	assert.True(t, r.JobLogger(job).Logger == other)
+	assert.Equal(t, "other", r.JobLogger(job).Data["prefix"])
+	assert.Equal(t, "foo", r.JobLogger(job).Data["job.command"])
+}
+
+func TestLogState(t *testing.T) {
+	r, hook, tab := newTestRunner(t, "@yearly false\n")
+	r.AddCrontab(tab)
+
+	var output bytes.Buffer
+	r.logger.Logger.Out = &output
+	r.logger.Logger.Formatter = &logrus.JSONFormatter{}
+
+	if !assert.Nil(t, r.Start(context.Background())) {
+		return
+	}
+	defer func() {
+		r.Stop()
+		r.Wait()
+	}()
+
+	r.Registry().Jobs()[0].Trigger()
+	waitForRun(t, hook)
+
+	output.Reset()
+	r.LogState()
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if !assert.Len(t, lines, 2) {
+		return
+	}
+
+	assert.Contains(t, lines[0], `"msg":"state of 1 job(s)"`)
+	assert.Contains(t, lines[1], `"msg":"job state"`)
+	assert.Contains(t, lines[1], `"job.command":"false"`)
+	assert.Contains(t, lines[1], `"last_run.exit_code":1`)
+	assert.Contains(t, lines[1], `"last_run.succeeded":false`)
+	assert.Contains(t, lines[1], `"next_run":`)
+}
@@ -0,0 +1,122 @@
+// Package sdnotify tells systemd about the state of supercronic, per the
+// sd_notify(3) protocol, when it runs as a service with Type=notify.
+package sdnotify
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Notifier sends notifications to systemd. A nil Notifier (as returned when
+// supercronic doesn't run under systemd) ignores them.
+type Notifier struct {
+	conn     *net.UnixConn
+	logger   *logrus.Entry
+	watchdog time.Duration
+}
+
+// New returns a Notifier that sends notifications to the socket in
+// NOTIFY_SOCKET, or nil if it isn't set. The variables systemd sets for the
+// service are unset, so that jobs don't notify systemd on supercronic's
+// behalf.
+func New(logger *logrus.Entry) (*Notifier, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	watchdog, err := watchdogInterval()
+
+	os.Unsetenv("NOTIFY_SOCKET")
+	os.Unsetenv("WATCHDOG_USEC")
+	os.Unsetenv("WATCHDOG_PID")
+
+	if socket == "" {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Names starting with @ are abstract sockets, as with systemd.
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Notifier{conn: conn, logger: logger, watchdog: watchdog}, nil
+}
+
+// watchdogInterval returns how often systemd expects watchdog pings, or 0 if
+// it doesn't (or expects them from another process).
+func watchdogInterval() (time.Duration, error) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec == "" {
+		return 0, nil
+	}
+
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("bad WATCHDOG_USEC: %s", usec)
+	}
+
+	return time.Duration(n) * time.Microsecond, nil
+}
+
+// WatchdogInterval returns how often Watchdog should be called: half the
+// watchdog timeout, as recommended by sd_watchdog_enabled(3). It is 0 if the
+// service has no watchdog.
+func (n *Notifier) WatchdogInterval() time.Duration {
+	if n == nil {
+		return 0
+	}
+	return n.watchdog / 2
+}
+
+// Ready tells systemd that supercronic is done starting up or reloading, and
+// is scheduling jobs. status is shown by systemctl status.
+func (n *Notifier) Ready(status string) {
+	n.notify("READY=1", "STATUS="+status)
+}
+
+// Reloading tells systemd that supercronic is reloading its crontab.
+func (n *Notifier) Reloading() {
+	n.notify("RELOADING=1", "STATUS=reloading crontab")
+}
+
+// Stopping tells systemd that supercronic is shutting down, e.g. waiting for
+// jobs to finish.
+func (n *Notifier) Stopping() {
+	n.notify("STOPPING=1", "STATUS=shutting down")
+}
+
+// Watchdog tells systemd that supercronic is alive. If the service has a
+// watchdog (WatchdogSec=), systemd restarts it when pings stop.
+func (n *Notifier) Watchdog() {
+	n.notify("WATCHDOG=1")
+}
+
+// Close closes the connection to systemd.
+func (n *Notifier) Close() error {
+	if n == nil {
+		return nil
+	}
+	return n.conn.Close()
+}
+
+func (n *Notifier) notify(states ...string) {
+	if n == nil {
+		return
+	}
+
+	if _, err := n.conn.Write([]byte(strings.Join(states, "\n"))); err != nil {
+		n.logger.Warnf("could not notify systemd: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package sdnotify
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func listen(t *testing.T) (*net.UnixConn, string, func()) {
+	dir, err := ioutil.TempDir("", "supercronic-sdnotify")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return conn, path, func() {
+		conn.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func receive(t *testing.T, conn *net.UnixConn) string {
+	buf := make([]byte, 1024)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+func TestNew(t *testing.T) {
+	conn, path, cleanup := listen(t)
+	defer cleanup()
+
+	os.Setenv("NOTIFY_SOCKET", path)
+	os.Setenv("WATCHDOG_USEC", "30000000")
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+
+	n, err := New(logrus.NewEntry(logrus.New()))
+	if !assert.Nil(t, err) || !assert.NotNil(t, n) {
+		return
+	}
+	defer n.Close()
+
+	// Jobs don't get the variables.
+	assert.Equal(t, "", os.Getenv("NOTIFY_SOCKET"))
+	assert.Equal(t, "", os.Getenv("WATCHDOG_USEC"))
+	assert.Equal(t, "", os.Getenv("WATCHDOG_PID"))
+
+	assert.Equal(t, 15*time.Second, n.WatchdogInterval())
+
+	n.Ready("scheduling 3 job(s)")
+	assert.Equal(t, "READY=1\nSTATUS=scheduling 3 job(s)", receive(t, conn))
+
+	n.Reloading()
+	assert.Equal(t, "RELOADING=1\nSTATUS=reloading crontab", receive(t, conn))
+
+	n.Watchdog()
+	assert.Equal(t, "WATCHDOG=1", receive(t, conn))
+
+	n.Stopping()
+	assert.Equal(t, "STOPPING=1\nSTATUS=shutting down", receive(t, conn))
+}
+
+func TestNewWithoutSystemd(t *testing.T) {
+	os.Unsetenv("NOTIFY_SOCKET")
+
+	n, err := New(logrus.NewEntry(logrus.New()))
+	assert.Nil(t, err)
+	assert.Nil(t, n)
+
+	// Notifications are ignored.
+	n.Ready("ready")
+	n.Watchdog()
+	assert.Equal(t, time.Duration(0), n.WatchdogInterval())
+	assert.Nil(t, n.Close())
+}
+
+func TestWatchdogForAnotherProcess(t *testing.T) {
+	_, path, cleanup := listen(t)
+	defer cleanup()
+
+	os.Setenv("NOTIFY_SOCKET", path)
+	os.Setenv("WATCHDOG_USEC", "30000000")
+	os.Setenv("WATCHDOG_PID", "1")
+
+	n, err := New(logrus.NewEntry(logrus.New()))
+	if assert.Nil(t, err) && assert.NotNil(t, n) {
+		assert.Equal(t, time.Duration(0), n.WatchdogInterval())
+		n.Close()
+	}
+}
+
+func TestBadWatchdog(t *testing.T) {
+	_, path, cleanup := listen(t)
+	defer cleanup()
+
+	os.Setenv("NOTIFY_SOCKET", path)
+	os.Setenv("WATCHDOG_USEC", "soon")
+	os.Unsetenv("WATCHDOG_PID")
+
+	_, err := New(logrus.NewEntry(logrus.New()))
+	assert.NotNil(t, err)
+}
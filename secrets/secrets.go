@@ -0,0 +1,74 @@
+// Package secrets resolves the secrets jobs get in their environment (see
+// crontab.Secret) from files or Vault, so that they don't need to be passed
+// to supercronic, or fetched by wrapper scripts.
+package secrets
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"supercronic/crontab"
+)
+
+// Resolver resolves secrets using the provider their source names.
+type Resolver struct {
+	vault *vaultClient
+}
+
+// NewResolver returns a Resolver that reads secrets from Vault per vault. If
+// vault is nil, the standard VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE
+// variables are used, if set.
+func NewResolver(vault *VaultConfig) (*Resolver, error) {
+	if vault == nil {
+		vault = vaultConfigFromEnv()
+	}
+
+	r := &Resolver{}
+
+	if vault != nil {
+		client, err := newVaultClient(*vault)
+		if err != nil {
+			return nil, err
+		}
+		r.vault = client
+	}
+
+	return r, nil
+}
+
+func (r *Resolver) Resolve(secret crontab.Secret) (string, error) {
+	parts := strings.SplitN(secret.Source, ":", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("bad source: %s", secret.Source)
+	}
+
+	switch parts[0] {
+	case "file":
+		return readSecretFile(parts[1])
+	case "vault":
+		if r.vault == nil {
+			return "", fmt.Errorf("Vault is not configured (set VAULT_ADDR and VAULT_TOKEN)")
+		}
+
+		ref := strings.SplitN(parts[1], "#", 2)
+		if len(ref) != 2 {
+			return "", fmt.Errorf("bad source: %s", secret.Source)
+		}
+		return r.vault.read(ref[0], ref[1])
+	}
+
+	return "", fmt.Errorf("unknown secrets provider: %s", parts[0])
+}
+
+// readSecretFile returns the contents of the file at path, without the
+// trailing newline most tools write.
+func readSecretFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	value := strings.TrimSuffix(string(data), "\n")
+	return strings.TrimSuffix(value, "\r"), nil
+}
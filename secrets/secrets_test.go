@@ -0,0 +1,66 @@
+package secrets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"supercronic/crontab"
+)
+
+func TestResolveFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewResolver(nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	for contents, expected := range map[string]string{
+		"hunter2\n":        "hunter2",
+		"hunter2\r\n":      "hunter2",
+		"hunter2":          "hunter2",
+		"line 1\nline 2\n": "line 1\nline 2",
+	} {
+		path := filepath.Join(dir, "secret")
+		if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		value, err := r.Resolve(crontab.Secret{Name: "DB_PASS", Source: "file:" + path})
+		if assert.Nil(t, err) {
+			assert.Equal(t, expected, value)
+		}
+	}
+
+	_, err = r.Resolve(crontab.Secret{Name: "DB_PASS", Source: "file:" + filepath.Join(dir, "missing")})
+	assert.NotNil(t, err)
+}
+
+func TestResolveVaultNotConfigured(t *testing.T) {
+	os.Unsetenv("VAULT_ADDR")
+
+	r, err := NewResolver(nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	_, err = r.Resolve(crontab.Secret{Name: "DB_PASS", Source: "vault:kv/data/app#password"})
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "Vault is not configured")
+	}
+}
+
+func TestResolveUnknownProvider(t *testing.T) {
+	r, _ := NewResolver(&VaultConfig{Address: "http://127.0.0.1:8200", Token: "token"})
+
+	_, err := r.Resolve(crontab.Secret{Name: "DB_PASS", Source: "env:DB_PASS"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,142 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Timeout for each request to Vault.
+var VAULT_TIMEOUT = 10 * time.Second
+
+// VaultConfig is where Vault is, and how to authenticate to it.
+type VaultConfig struct {
+	// Address is e.g. https://vault.example.com:8200.
+	Address string `yaml:"address"`
+	// Token, or the path of a file holding it (e.g. written by Vault Agent),
+	// which is read on every request so that renewed tokens are picked up.
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"token_file"`
+	Namespace string `yaml:"namespace"`
+}
+
+func vaultConfigFromEnv() *VaultConfig {
+	address, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if address == "" || token == "" {
+		return nil
+	}
+
+	return &VaultConfig{
+		Address:   address,
+		Token:     token,
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+	}
+}
+
+type vaultClient struct {
+	config VaultConfig
+	client *http.Client
+}
+
+func newVaultClient(config VaultConfig) (*vaultClient, error) {
+	if config.Address == "" {
+		return nil, fmt.Errorf("vault: address is required")
+	}
+
+	if config.Token == "" && config.TokenFile == "" {
+		return nil, fmt.Errorf("vault: token or token_file is required")
+	}
+
+	return &vaultClient{config: config, client: &http.Client{Timeout: VAULT_TIMEOUT}}, nil
+}
+
+func (c *vaultClient) token() (string, error) {
+	if c.config.TokenFile == "" {
+		return c.config.Token, nil
+	}
+
+	token, err := readSecretFile(c.config.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("could not read Vault token: %v", err)
+	}
+	return strings.TrimSpace(token), nil
+}
+
+// read returns key from the secret at path. Secrets from version 2 of the KV
+// secrets engine, whose path includes /data/, hold their keys in a nested
+// data object.
+func (c *vaultClient) read(path string, key string) (string, error) {
+	token, err := c.token()
+	if err != nil {
+		return "", err
+	}
+
+	url := strings.TrimSuffix(c.config.Address, "/") + "/v1/" + strings.TrimPrefix(path, "/")
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("X-Vault-Token", token)
+	if c.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.config.Namespace)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Errors []string `json:"errors"`
+		}
+
+		if json.Unmarshal(body, &failure) == nil && len(failure.Errors) > 0 {
+			return "", fmt.Errorf("Vault returned %s for %s: %s", resp.Status, path, strings.Join(failure.Errors, ", "))
+		}
+		return "", fmt.Errorf("Vault returned %s for %s", resp.Status, path)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", fmt.Errorf("invalid response from Vault for %s: %v", path, err)
+	}
+
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %s", path, key)
+	}
+
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+
+	// Other values (e.g. numbers) are passed on as JSON.
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
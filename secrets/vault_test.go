@@ -0,0 +1,132 @@
+package secrets
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"supercronic/crontab"
+)
+
+func newTestVault(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/kv/data/app":
+			w.Write([]byte(`{"data":{"data":{"password":"hunter2","port":5432},"metadata":{"version":3}}}`))
+		case "/v1/secret/app":
+			w.Write([]byte(`{"data":{"password":"swordfish"}}`))
+		case "/v1/team/kv/data/app":
+			if r.Header.Get("X-Vault-Namespace") != "team" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(`{"data":{"data":{"password":"correcthorse"},"metadata":{}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+}
+
+func resolveVault(t *testing.T, config VaultConfig, source string) (string, error) {
+	r, err := NewResolver(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.Resolve(crontab.Secret{Name: "SECRET", Source: source})
+}
+
+func TestResolveVault(t *testing.T) {
+	server := newTestVault(t)
+	defer server.Close()
+
+	config := VaultConfig{Address: server.URL + "/", Token: "s.token"}
+
+	for source, expected := range map[string]string{
+		"vault:kv/data/app#password": "hunter2",
+		"vault:kv/data/app#port":     "5432",
+		"vault:secret/app#password":  "swordfish",
+	} {
+		value, err := resolveVault(t, config, source)
+		if assert.Nil(t, err, source) {
+			assert.Equal(t, expected, value, source)
+		}
+	}
+
+	config.Namespace = "team"
+	value, err := resolveVault(t, config, "vault:team/kv/data/app#password")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "correcthorse", value)
+	}
+}
+
+func TestResolveVaultErrors(t *testing.T) {
+	server := newTestVault(t)
+	defer server.Close()
+
+	config := VaultConfig{Address: server.URL, Token: "s.token"}
+
+	_, err := resolveVault(t, config, "vault:kv/data/app#username")
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "has no key username")
+	}
+
+	_, err = resolveVault(t, config, "vault:kv/data/other#password")
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "404")
+	}
+
+	config.Token = "s.expired"
+	_, err = resolveVault(t, config, "vault:kv/data/app#password")
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "permission denied")
+	}
+}
+
+func TestResolveVaultReadsTokenFile(t *testing.T) {
+	server := newTestVault(t)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "supercronic-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "token")
+	r, err := NewResolver(&VaultConfig{Address: server.URL, TokenFile: path})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	secret := crontab.Secret{Name: "DB_PASS", Source: "vault:kv/data/app#password"}
+
+	// The token is read on every request, so renewed tokens are picked up.
+	for token, ok := range map[string]bool{"s.expired\n": false, "s.token\n": true} {
+		if err := ioutil.WriteFile(path, []byte(token), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := r.Resolve(secret)
+		assert.Equal(t, ok, err == nil, token)
+	}
+}
+
+func TestNewResolverRequiresVaultToken(t *testing.T) {
+	_, err := NewResolver(&VaultConfig{Address: "http://127.0.0.1:8200"})
+	assert.NotNil(t, err)
+
+	_, err = NewResolver(&VaultConfig{Token: "s.token"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,150 @@
+package sentry
+
+import (
+	"sync"
+	"time"
+
+	"github.com/evalphobia/logrus_sentry"
+	"github.com/getsentry/raven-go"
+	"github.com/sirupsen/logrus"
+
+	"supercronic/cron"
+	"supercronic/crontab"
+	"supercronic/log/hook"
+)
+
+// Target is the Sentry project (by DSN) and environment a job reports to.
+type Target struct {
+	DSN         string
+	Environment string
+}
+
+// targetFor returns the target of job: the one set by its sentry_dsn and
+// sentry_env directives, or the default.
+func targetFor(job *crontab.Job, defaultTarget Target) Target {
+	target := defaultTarget
+
+	if job.SentryDSN != "" {
+		target.DSN = job.SentryDSN
+	}
+
+	if job.SentryEnvironment != "" {
+		target.Environment = job.SentryEnvironment
+	}
+
+	return target
+}
+
+// Clients hands out one Sentry client per target, creating them as jobs that
+// need them are scheduled.
+type Clients struct {
+	defaultTarget Target
+
+	mu      sync.Mutex
+	clients map[Target]*raven.Client
+}
+
+func NewClients(dsn string, environment string) *Clients {
+	return &Clients{
+		defaultTarget: Target{DSN: dsn, Environment: environment},
+		clients:       make(map[Target]*raven.Client),
+	}
+}
+
+// Target returns the target of job.
+func (c *Clients) Target(job *crontab.Job) Target {
+	return targetFor(job, c.defaultTarget)
+}
+
+// IsDefault is whether job reports to the default target.
+func (c *Clients) IsDefault(job *crontab.Job) bool {
+	return c.Target(job) == c.defaultTarget
+}
+
+// Get returns the client for target, or nil if target has no DSN.
+func (c *Clients) Get(target Target) (*raven.Client, error) {
+	if target.DSN == "" {
+		return nil, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if client, ok := c.clients[target]; ok {
+		return client, nil
+	}
+
+	client, err := raven.New(target.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	if target.Environment != "" {
+		client.SetEnvironment(target.Environment)
+	}
+
+	c.clients[target] = client
+	return client, nil
+}
+
+// JobLoggers returns a function for runner.Options.Logger. Jobs that report
+// to another target than the default get a logger of their own: a clone of
+// base (with fields) that reports its errors to that target rather than
+// using defaultHook, which is base's Sentry hook (if any).
+func (c *Clients) JobLoggers(base *logrus.Logger, defaultHook logrus.Hook, fields logrus.Fields) func(job *crontab.Job) *logrus.Entry {
+	var mu sync.Mutex
+	loggers := make(map[Target]*logrus.Entry)
+
+	return func(job *crontab.Job) *logrus.Entry {
+		if c.IsDefault(job) {
+			return nil
+		}
+
+		target := c.Target(job)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if logger, ok := loggers[target]; ok {
+			return logger
+		}
+
+		logger := hook.Clone(base, func(h logrus.Hook) bool {
+			return h == defaultHook
+		})
+
+		if client, err := c.Get(target); err != nil {
+			logrus.NewEntry(base).WithFields(fields).Errorf("could not init sentry logger for %s: %v", target.DSN, err)
+		} else if client != nil {
+			logHook, err := NewLogHook(client)
+			if err != nil {
+				logrus.NewEntry(base).WithFields(fields).Errorf("could not init sentry logger for %s: %v", target.DSN, err)
+			} else {
+				logger.AddHook(logHook)
+			}
+		}
+
+		entry := logger.WithFields(fields)
+		loggers[target] = entry
+		return entry
+	}
+}
+
+// NewLogHook returns a logrus hook that reports errors to Sentry using
+// client. Job failures are left out: Hook reports them with more context.
+func NewLogHook(client *raven.Client) (logrus.Hook, error) {
+	levels := []logrus.Level{
+		logrus.PanicLevel,
+		logrus.FatalLevel,
+		logrus.ErrorLevel,
+	}
+
+	sh, err := logrus_sentry.NewWithClientSentryHook(client, levels)
+	if err != nil {
+		return nil, err
+	}
+
+	sh.Timeout = 5 * time.Second
+
+	return hook.Filter(sh, cron.IsJobFailure), nil
+}
@@ -0,0 +1,294 @@
+package sentry
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+const (
+	checkInInProgress = "in_progress"
+	checkInOk         = "ok"
+	checkInError      = "error"
+
+	maxSlugLength = 50
+)
+
+// Sentry accepts standard 5-field crontab schedules, so we translate the
+// descriptors we can.
+var scheduleDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// MonitorHook checks in to Sentry Cron Monitors around job executions, so
+// that Sentry can alert when a job fails, runs for too long, or doesn't run
+// at all. Monitors are created (or updated) by the check-ins themselves.
+//
+// Jobs check in to the project and environment set by their sentry_dsn and
+// sentry_env directives, if any.
+type MonitorHook struct {
+	defaultTarget Target
+	// all is whether jobs without a sentry_monitor directive get a monitor
+	// too, with a slug derived from their command.
+	all    bool
+	client *http.Client
+
+	mu       sync.Mutex
+	checkIns map[*cron.Execution]*pendingCheckIn
+}
+
+type pendingCheckIn struct {
+	id     string
+	target Target
+}
+
+// NewMonitorHook returns a MonitorHook that checks in to dsn by default. dsn
+// may be empty, in which case only jobs with a sentry_dsn directive check in.
+func NewMonitorHook(dsn string, environment string, all bool) (*MonitorHook, error) {
+	if dsn != "" {
+		if _, _, err := parseDSN(dsn); err != nil {
+			return nil, err
+		}
+	}
+
+	return &MonitorHook{
+		defaultTarget: Target{DSN: dsn, Environment: environment},
+		all:           all,
+		client:        &http.Client{Timeout: SEND_TIMEOUT},
+		checkIns:      make(map[*cron.Execution]*pendingCheckIn),
+	}, nil
+}
+
+// parseDSN returns the envelope endpoint and auth header for a DSN of the
+// form scheme://key@host/path/project.
+func parseDSN(dsn string) (string, string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", "", err
+	}
+
+	if u.User == nil || u.User.Username() == "" || u.Host == "" {
+		return "", "", fmt.Errorf("invalid Sentry DSN: %s", dsn)
+	}
+
+	path := strings.TrimSuffix(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	if i < 0 || path[i+1:] == "" {
+		return "", "", fmt.Errorf("invalid Sentry DSN (missing project): %s", dsn)
+	}
+
+	endpoint := fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, path[:i], path[i+1:])
+	auth := fmt.Sprintf("Sentry sentry_version=7, sentry_client=supercronic, sentry_key=%s", u.User.Username())
+
+	return endpoint, auth, nil
+}
+
+var slugReplacer = regexp.MustCompile(`[^a-z0-9]+`)
+
+// MonitorSlug returns the slug of the monitor job checks in to, or an empty
+// string if it shouldn't check in.
+func (h *MonitorHook) MonitorSlug(job *crontab.Job) string {
+	if job.SentryMonitor != "" {
+		return job.SentryMonitor
+	}
+
+	if !h.all {
+		return ""
+	}
+
+	// Named jobs keep their monitor when their command changes.
+	source := job.Command
+	if job.Name != "" {
+		source = job.Name
+	}
+
+	slug := strings.Trim(slugReplacer.ReplaceAllString(strings.ToLower(source), "-"), "-")
+	if len(slug) > maxSlugLength {
+		slug = strings.TrimRight(slug[:maxSlugLength], "-")
+	}
+
+	return slug
+}
+
+func (h *MonitorHook) JobStarted(e *cron.Execution) {
+	slug := h.MonitorSlug(e.Job)
+	if slug == "" {
+		return
+	}
+
+	target := targetFor(e.Job, h.defaultTarget)
+	if target.DSN == "" {
+		return
+	}
+
+	id, err := randomCheckInID()
+	if err != nil {
+		e.Logger.Errorf("failed to check in to Sentry monitor %s: %v", slug, err)
+		return
+	}
+
+	h.mu.Lock()
+	h.checkIns[e] = &pendingCheckIn{id: id, target: target}
+	h.mu.Unlock()
+
+	checkIn := &checkIn{
+		CheckInID:     id,
+		MonitorSlug:   slug,
+		Status:        checkInInProgress,
+		Environment:   target.Environment,
+		MonitorConfig: newMonitorConfig(e.Job),
+	}
+
+	if err := h.send(target.DSN, checkIn); err != nil {
+		e.Logger.Errorf("failed to check in to Sentry monitor %s: %v", slug, err)
+	}
+}
+
+func (h *MonitorHook) JobFinished(e *cron.Execution) {
+	h.mu.Lock()
+	pending, ok := h.checkIns[e]
+	delete(h.checkIns, e)
+	h.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	slug := h.MonitorSlug(e.Job)
+
+	status := checkInOk
+	if e.Err != nil {
+		status = checkInError
+	}
+
+	checkIn := &checkIn{
+		CheckInID:     pending.id,
+		MonitorSlug:   slug,
+		Status:        status,
+		Duration:      e.Duration().Seconds(),
+		Environment:   pending.target.Environment,
+		MonitorConfig: newMonitorConfig(e.Job),
+	}
+
+	if err := h.send(pending.target.DSN, checkIn); err != nil {
+		e.Logger.Errorf("failed to check in to Sentry monitor %s: %v", slug, err)
+	}
+}
+
+func newMonitorConfig(job *crontab.Job) *monitorConfig {
+	schedule := job.Schedule
+	if s, ok := scheduleDescriptors[schedule]; ok {
+		schedule = s
+	}
+
+	// Schedules with seconds or years, and @every, have no equivalent in
+	// Sentry; those monitors have to be configured in Sentry directly.
+	if len(strings.Fields(schedule)) != 5 {
+		return nil
+	}
+
+	config := &monitorConfig{
+		Schedule: monitorSchedule{Type: "crontab", Value: schedule},
+	}
+
+	if loc := job.Location(); loc != nil {
+		config.Timezone = loc.String()
+	}
+
+	if job.Timeout > 0 {
+		config.MaxRuntime = int(math.Ceil(job.Timeout.Minutes()))
+	}
+
+	return config
+}
+
+// check_in envelope items, as described in
+// https://develop.sentry.dev/sdk/check-ins/
+type checkIn struct {
+	CheckInID     string         `json:"check_in_id"`
+	MonitorSlug   string         `json:"monitor_slug"`
+	Status        string         `json:"status"`
+	Duration      float64        `json:"duration,omitempty"`
+	Environment   string         `json:"environment,omitempty"`
+	MonitorConfig *monitorConfig `json:"monitor_config,omitempty"`
+}
+
+type monitorConfig struct {
+	Schedule monitorSchedule `json:"schedule"`
+	Timezone string          `json:"timezone,omitempty"`
+	// MaxRuntime is in minutes.
+	MaxRuntime int `json:"max_runtime,omitempty"`
+}
+
+type monitorSchedule struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+func (h *MonitorHook) send(dsn string, c *checkIn) error {
+	endpoint, auth, err := parseDSN(dsn)
+	if err != nil {
+		return err
+	}
+
+	item, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "{\"sent_at\":%q}\n", time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(&body, "{\"type\":\"check_in\",\"length\":%d}\n", len(item))
+	body.Write(item)
+	body.WriteString("\n")
+
+	req, err := http.NewRequest("POST", endpoint, &body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", auth)
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", endpoint, resp.Status)
+	}
+
+	return nil
+}
+
+func randomCheckInID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
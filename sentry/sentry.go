@@ -0,0 +1,159 @@
+// Package sentry reports job executions to Sentry: failures as events that
+// carry the context needed to debug them, and runs as Cron Monitor check-ins.
+package sentry
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getsentry/raven-go"
+
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+var (
+	// STDERR_LINES is how many of the last lines of stderr are attached to
+	// events.
+	STDERR_LINES = 100
+
+	// SEND_TIMEOUT bounds how long we wait for Sentry to accept an event.
+	SEND_TIMEOUT = 5 * time.Second
+)
+
+// Client is the part of raven.Client we use.
+type Client interface {
+	Capture(packet *raven.Packet, captureTags map[string]string) (string, chan error)
+}
+
+// Hook sends an event to Sentry when a job fails. Events are fingerprinted by
+// command, so that failures of the same job are grouped together regardless
+// of their error message.
+type Hook struct {
+	clientFor func(job *crontab.Job) (Client, Target, error)
+	hostname  string
+}
+
+// NewHook returns a Hook that reports each job's failures to its target,
+// using clients.
+func NewHook(clients *Clients) *Hook {
+	return newHook(func(job *crontab.Job) (Client, Target, error) {
+		target := clients.Target(job)
+
+		client, err := clients.Get(target)
+		if client == nil {
+			return nil, target, err
+		}
+
+		return client, target, nil
+	})
+}
+
+func newHook(clientFor func(job *crontab.Job) (Client, Target, error)) *Hook {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	return &Hook{clientFor: clientFor, hostname: hostname}
+}
+
+func (h *Hook) JobStarted(e *cron.Execution) {}
+
+func (h *Hook) JobFinished(e *cron.Execution) {
+	if e.Err == nil {
+		return
+	}
+
+	client, target, err := h.clientFor(e.Job)
+	if err != nil {
+		e.Logger.Warnf("failed to send failure to Sentry: %v", err)
+		return
+	}
+
+	if client == nil {
+		return
+	}
+
+	packet := h.newPacket(e, target, fmt.Sprintf("%s: %v", e.Job.Command, e.Err))
+	packet.Level = raven.ERROR
+	packet.Fingerprint = []string{"supercronic", e.Job.Command}
+	packet.Tags = append(packet.Tags, raven.Tag{Key: "exit_code", Value: strconv.Itoa(e.ExitCode)})
+
+	packet.Extra["error"] = e.Err.Error()
+	packet.Extra["exit_code"] = e.ExitCode
+	packet.Extra["stderr"] = strings.Join(e.Output.Tail("stderr", STDERR_LINES), "\n")
+
+	capture(e, client, packet, "failure")
+}
+
+// JobOverran sends a warning to Sentry when a job runs for longer than its
+// expected duration. These are grouped apart from the job's failures.
+func (h *Hook) JobOverran(e *cron.Execution) {
+	client, target, err := h.clientFor(e.Job)
+	if err != nil {
+		e.Logger.Warnf("failed to send overrun to Sentry: %v", err)
+		return
+	}
+
+	if client == nil {
+		return
+	}
+
+	packet := h.newPacket(e, target, fmt.Sprintf("%s: running for longer than expected (%v)", e.Job.Command, e.Job.ExpectedDuration))
+	packet.Level = raven.WARNING
+	packet.Fingerprint = []string{"supercronic", "overrun", e.Job.Command}
+	packet.Extra["expected_duration_seconds"] = e.Job.ExpectedDuration.Seconds()
+
+	capture(e, client, packet, "overrun")
+}
+
+func (h *Hook) newPacket(e *cron.Execution, target Target, message string) *raven.Packet {
+	packet := raven.NewPacket(message)
+	packet.Logger = "supercronic"
+	packet.ServerName = h.hostname
+	packet.Culprit = e.Job.Command
+	packet.Environment = target.Environment
+
+	packet.Tags = raven.Tags{
+		{Key: "job.schedule", Value: e.Job.Schedule},
+		{Key: "job.position", Value: strconv.Itoa(e.Job.Position)},
+	}
+
+	if e.Job.Name != "" {
+		packet.Tags = append(packet.Tags, raven.Tag{Key: "job.name", Value: e.Job.Name})
+	}
+
+	if e.Job.Source != "" {
+		packet.Tags = append(packet.Tags, raven.Tag{Key: "job.source", Value: e.Job.Source})
+	}
+
+	packet.Extra["job.command"] = e.Job.Command
+	packet.Extra["duration_seconds"] = e.Duration().Seconds()
+	packet.Extra["started_at"] = e.StartedAt
+	packet.Extra["iteration"] = e.Iteration
+
+	if !e.ScheduledAt.IsZero() {
+		packet.Extra["scheduled_at"] = e.ScheduledAt
+	}
+
+	return packet
+}
+
+// capture sends packet, and waits (up to SEND_TIMEOUT) for Sentry to accept
+// it.
+func capture(e *cron.Execution, client Client, packet *raven.Packet, what string) {
+	_, errChan := client.Capture(packet, nil)
+
+	select {
+	case err := <-errChan:
+		if err != nil {
+			e.Logger.Warnf("failed to send %s to Sentry: %v", what, err)
+		}
+	case <-time.After(SEND_TIMEOUT):
+		e.Logger.Warnf("failed to send %s to Sentry: timed out after %v", what, SEND_TIMEOUT)
+	}
+}
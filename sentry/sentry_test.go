@@ -0,0 +1,158 @@
+package sentry
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/getsentry/raven-go"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+type testClient struct {
+	packets []*raven.Packet
+}
+
+func (c *testClient) Capture(packet *raven.Packet, captureTags map[string]string) (string, chan error) {
+	c.packets = append(c.packets, packet)
+
+	ch := make(chan error, 1)
+	ch <- nil
+	return "", ch
+}
+
+func newTestHook(client Client, target Target) *Hook {
+	return newHook(func(job *crontab.Job) (Client, Target, error) {
+		return client, target, nil
+	})
+}
+
+func newTestExecution(err error) *cron.Execution {
+	output := &cron.Output{}
+	output.Append("stdout", "working")
+	output.Append("stderr", "warning")
+	output.Append("stderr", "fatal error")
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	startedAt := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	return &cron.Execution{
+		Job: &crontab.Job{
+			CrontabLine: crontab.CrontabLine{Schedule: "@daily", Command: "backup.sh"},
+			Position:    3,
+		},
+		Logger:     logrus.NewEntry(logger),
+		StartedAt:  startedAt,
+		FinishedAt: startedAt.Add(1500 * time.Millisecond),
+		Err:        err,
+		ExitCode:   2,
+		Output:     output,
+	}
+}
+
+func TestHookReportsFailures(t *testing.T) {
+	client := &testClient{}
+	hook := newTestHook(client, Target{})
+
+	hook.JobFinished(newTestExecution(errors.New("error running command: exit status 2")))
+
+	if !assert.Len(t, client.packets, 1) {
+		return
+	}
+
+	packet := client.packets[0]
+	assert.Equal(t, "backup.sh: error running command: exit status 2", packet.Message)
+	assert.Equal(t, raven.ERROR, packet.Level)
+	assert.Equal(t, []string{"supercronic", "backup.sh"}, packet.Fingerprint)
+	assert.Contains(t, packet.Tags, raven.Tag{Key: "job.schedule", Value: "@daily"})
+	assert.Contains(t, packet.Tags, raven.Tag{Key: "exit_code", Value: "2"})
+	assert.Equal(t, 2, packet.Extra["exit_code"])
+	assert.Equal(t, 1.5, packet.Extra["duration_seconds"])
+	assert.Equal(t, "warning\nfatal error", packet.Extra["stderr"])
+}
+
+func TestHookIgnoresSuccesses(t *testing.T) {
+	client := &testClient{}
+	hook := newTestHook(client, Target{})
+
+	hook.JobFinished(newTestExecution(nil))
+
+	assert.Empty(t, client.packets)
+}
+
+func TestHookSetsEnvironment(t *testing.T) {
+	client := &testClient{}
+	hook := newTestHook(client, Target{DSN: "https://key@sentry.example.com/2", Environment: "staging"})
+
+	hook.JobFinished(newTestExecution(errors.New("error running command: exit status 2")))
+
+	if assert.Len(t, client.packets, 1) {
+		assert.Equal(t, "staging", client.packets[0].Environment)
+	}
+}
+
+func TestClientsTarget(t *testing.T) {
+	clients := NewClients("https://key@sentry.example.com/1", "production")
+
+	job := &crontab.Job{}
+	assert.Equal(t, Target{DSN: "https://key@sentry.example.com/1", Environment: "production"}, clients.Target(job))
+	assert.True(t, clients.IsDefault(job))
+
+	job = &crontab.Job{SentryDSN: "https://other@sentry.example.com/2"}
+	assert.Equal(t, Target{DSN: "https://other@sentry.example.com/2", Environment: "production"}, clients.Target(job))
+	assert.False(t, clients.IsDefault(job))
+
+	job = &crontab.Job{SentryEnvironment: "staging"}
+	assert.Equal(t, Target{DSN: "https://key@sentry.example.com/1", Environment: "staging"}, clients.Target(job))
+	assert.False(t, clients.IsDefault(job))
+}
+
+func TestClientsGet(t *testing.T) {
+	clients := NewClients("", "")
+
+	client, err := clients.Get(Target{})
+	assert.Nil(t, err)
+	assert.Nil(t, client)
+
+	a, err := clients.Get(Target{DSN: "https://key@sentry.example.com/1"})
+	assert.Nil(t, err)
+	assert.NotNil(t, a)
+
+	b, err := clients.Get(Target{DSN: "https://key@sentry.example.com/1"})
+	assert.Nil(t, err)
+	assert.True(t, a == b)
+
+	c, err := clients.Get(Target{DSN: "https://key@sentry.example.com/1", Environment: "staging"})
+	assert.Nil(t, err)
+	assert.False(t, a == c)
+}
+
+func TestNewHookSkipsJobsWithoutDSN(t *testing.T) {
+	hook := NewHook(NewClients("", ""))
+
+	// The job has no DSN to report to, so this must not try to capture.
+	hook.JobFinished(newTestExecution(errors.New("error running command: exit status 2")))
+}
+
+func TestHookReportsOverruns(t *testing.T) {
+	client := &testClient{}
+	hook := newTestHook(client, Target{})
+
+	e := newTestExecution(nil)
+	e.Job.ExpectedDuration = time.Minute
+	hook.JobOverran(e)
+
+	if assert.Len(t, client.packets, 1) {
+		packet := client.packets[0]
+		assert.Equal(t, "backup.sh: running for longer than expected (1m0s)", packet.Message)
+		assert.Equal(t, raven.WARNING, packet.Level)
+		assert.Equal(t, []string{"supercronic", "overrun", "backup.sh"}, packet.Fingerprint)
+		assert.Equal(t, 60.0, packet.Extra["expected_duration_seconds"])
+	}
+}
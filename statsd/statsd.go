@@ -0,0 +1,139 @@
+// Package statsd emits metrics about job executions to a StatsD (or
+// DogStatsD) server.
+package statsd
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"supercronic/cron"
+)
+
+// Client sends metrics over UDP. Delivery is best-effort: a missing server
+// doesn't slow jobs down.
+type Client struct {
+	conn   net.Conn
+	prefix string
+	// dogstatsd enables DogStatsD tags. Without them, tags are folded into
+	// metric names instead.
+	dogstatsd bool
+}
+
+func New(addr string, prefix string, dogstatsd bool) (*Client, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+
+	return &Client{conn: conn, prefix: prefix, dogstatsd: dogstatsd}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+type Tag struct {
+	Key   string
+	Value string
+}
+
+func (c *Client) Count(name string, value int64, tags ...Tag) error {
+	return c.send(name, strconv.FormatInt(value, 10), "c", tags)
+}
+
+func (c *Client) Timing(name string, d time.Duration, tags ...Tag) error {
+	ms := float64(d) / float64(time.Millisecond)
+	return c.send(name, strconv.FormatFloat(ms, 'f', -1, 64), "ms", tags)
+}
+
+var (
+	unsafeTagChars  = regexp.MustCompile(`[^A-Za-z0-9_\-./:]`)
+	unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9_\-]`)
+)
+
+func (c *Client) send(name string, value string, kind string, tags []Tag) error {
+	metric := c.prefix + name
+
+	var suffix string
+	if c.dogstatsd {
+		if len(tags) > 0 {
+			parts := make([]string, 0, len(tags))
+			for _, t := range tags {
+				parts = append(parts, unsafeTagChars.ReplaceAllString(t.Key, "_")+":"+unsafeTagChars.ReplaceAllString(t.Value, "_"))
+			}
+			suffix = "|#" + strings.Join(parts, ",")
+		}
+	} else {
+		// e.g. supercronic.job.started -> supercronic.job.position_3.started
+		dot := strings.LastIndex(metric, ".")
+		for _, t := range tags {
+			metric = metric[:dot] + "." + unsafeNameChars.ReplaceAllString(t.Key+"_"+t.Value, "_") + metric[dot:]
+			dot = strings.LastIndex(metric, ".")
+		}
+	}
+
+	_, err := fmt.Fprintf(c.conn, "%s:%s|%s%s", metric, value, kind, suffix)
+	return err
+}
+
+// Hook counts job starts, successes, and failures, and times job runs.
+type Hook struct {
+	client *Client
+}
+
+func NewHook(client *Client) *Hook {
+	return &Hook{client: client}
+}
+
+// jobTags identifies the job of e by name if it has one, and by position
+// otherwise, since names don't change when the crontab is edited.
+func jobTags(e *cron.Execution) []Tag {
+	tags := []Tag{{"position", strconv.Itoa(e.Job.Position)}}
+	if e.Job.Name != "" {
+		tags = []Tag{{"name", e.Job.Name}}
+	}
+
+	if e.Job.Source != "" {
+		tags = append(tags, Tag{"source", e.Job.Source})
+	}
+
+	return tags
+}
+
+func (h *Hook) JobStarted(e *cron.Execution) {
+	if err := h.client.Count("job.started", 1, jobTags(e)...); err != nil {
+		e.Logger.Debugf("failed to send metrics: %v", err)
+	}
+}
+
+func (h *Hook) JobFinished(e *cron.Execution) {
+	tags := jobTags(e)
+
+	outcome := "job.succeeded"
+	if e.Err != nil {
+		outcome = "job.failed"
+	}
+
+	err := h.client.Count(outcome, 1, tags...)
+	if err == nil {
+		err = h.client.Timing("job.duration", e.Duration(), tags...)
+	}
+
+	if err != nil {
+		e.Logger.Debugf("failed to send metrics: %v", err)
+	}
+}
+
+func (h *Hook) JobOverran(e *cron.Execution) {
+	if err := h.client.Count("job.overran", 1, jobTags(e)...); err != nil {
+		e.Logger.Debugf("failed to send metrics: %v", err)
+	}
+}
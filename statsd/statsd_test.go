@@ -0,0 +1,124 @@
+package statsd
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+func startTestServer(t *testing.T) (*net.UDPConn, chan string) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packets := make(chan string, 10)
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			packets <- string(buf[:n])
+		}
+	}()
+
+	return conn, packets
+}
+
+func receive(t *testing.T, packets chan string) string {
+	select {
+	case p := <-packets:
+		return p
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for metric")
+		return ""
+	}
+}
+
+func newTestExecution(err error) *cron.Execution {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	startedAt := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	return &cron.Execution{
+		Job: &crontab.Job{
+			CrontabLine: crontab.CrontabLine{Schedule: "@daily", Command: "backup.sh"},
+			Position:    3,
+			Source:      "/etc/crontabs/backup",
+		},
+		Logger:     logrus.NewEntry(logger),
+		StartedAt:  startedAt,
+		FinishedAt: startedAt.Add(1500 * time.Millisecond),
+		Err:        err,
+	}
+}
+
+func TestHookDogStatsD(t *testing.T) {
+	server, packets := startTestServer(t)
+	defer server.Close()
+
+	client, err := New(server.LocalAddr().String(), "supercronic", true)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer client.Close()
+
+	hook := NewHook(client)
+
+	hook.JobStarted(newTestExecution(nil))
+	assert.Equal(t, "supercronic.job.started:1|c|#position:3,source:/etc/crontabs/backup", receive(t, packets))
+
+	hook.JobFinished(newTestExecution(errors.New("exit status 1")))
+	assert.Equal(t, "supercronic.job.failed:1|c|#position:3,source:/etc/crontabs/backup", receive(t, packets))
+	assert.Equal(t, "supercronic.job.duration:1500|ms|#position:3,source:/etc/crontabs/backup", receive(t, packets))
+
+	hook.JobOverran(newTestExecution(nil))
+	assert.Equal(t, "supercronic.job.overran:1|c|#position:3,source:/etc/crontabs/backup", receive(t, packets))
+}
+
+func TestHookStatsD(t *testing.T) {
+	server, packets := startTestServer(t)
+	defer server.Close()
+
+	client, err := New(server.LocalAddr().String(), "cron.", false)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer client.Close()
+
+	hook := NewHook(client)
+
+	hook.JobFinished(newTestExecution(nil))
+	assert.Equal(t, "cron.job.position_3.source__etc_crontabs_backup.succeeded:1|c", receive(t, packets))
+	assert.Equal(t, "cron.job.position_3.source__etc_crontabs_backup.duration:1500|ms", receive(t, packets))
+}
+
+func TestHookTagsJobsByName(t *testing.T) {
+	server, packets := startTestServer(t)
+	defer server.Close()
+
+	client, err := New(server.LocalAddr().String(), "supercronic", true)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer client.Close()
+
+	hook := NewHook(client)
+
+	e := newTestExecution(nil)
+	e.Job.Name = "nightly-backup"
+
+	hook.JobStarted(e)
+	assert.Equal(t, "supercronic.job.started:1|c|#name:nightly-backup,source:/etc/crontabs/backup", receive(t, packets))
+}
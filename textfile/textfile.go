@@ -0,0 +1,183 @@
+// Package textfile writes metrics about job executions to a file in the
+// Prometheus text format, for node_exporter's textfile collector.
+package textfile
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"supercronic/cron"
+)
+
+// result is what the file holds about a job: its last run, and its last
+// successful run.
+type result struct {
+	labels      string
+	finishedAt  time.Time
+	duration    time.Duration
+	exitCode    int
+	succeeded   bool
+	succeededAt time.Time
+	tripped     bool
+}
+
+// Hook rewrites the file after every job run. The file is written to a
+// temporary file first and renamed into place, so that node_exporter never
+// reads a partial file.
+type Hook struct {
+	path string
+
+	mu sync.Mutex
+	// results holds the last result of each job, by labels.
+	results map[string]*result
+}
+
+func NewHook(path string) *Hook {
+	return &Hook{path: path, results: make(map[string]*result)}
+}
+
+func (h *Hook) JobStarted(e *cron.Execution) {}
+
+func (h *Hook) JobFinished(e *cron.Execution) {
+	labels := jobLabels(e)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, ok := h.results[labels]
+	if !ok {
+		r = &result{labels: labels}
+		h.results[labels] = r
+	}
+
+	r.finishedAt = e.FinishedAt
+	r.duration = e.Duration()
+	r.exitCode = e.ExitCode
+	r.succeeded = e.Err == nil
+	if r.succeeded {
+		r.succeededAt = e.FinishedAt
+	}
+
+	r.tripped = e.Tripped
+
+	if err := h.write(); err != nil {
+		e.Logger.Errorf("failed to write metrics to %s: %v", h.path, err)
+	}
+}
+
+// jobLabels identifies the job of e by name if it has one, and by position
+// otherwise, like metrics pushed to a Pushgateway.
+func jobLabels(e *cron.Execution) string {
+	job := e.Job.Name
+	if job == "" {
+		job = strconv.Itoa(e.Job.Position)
+	}
+
+	labels := fmt.Sprintf("cron_job=\"%s\"", escapeLabel(job))
+	if e.Job.Source != "" {
+		labels += fmt.Sprintf(",source=\"%s\"", escapeLabel(e.Job.Source))
+	}
+
+	return labels
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+// format returns the metrics for all jobs. Callers must hold h.mu.
+func (h *Hook) format() []byte {
+	results := make([]*result, 0, len(h.results))
+	for _, r := range h.results {
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].labels < results[j].labels })
+
+	var buf bytes.Buffer
+
+	gauge := func(name string, help string, value func(r *result) (float64, bool)) {
+		fmt.Fprintf(&buf, "# HELP supercronic_job_%s %s\n", name, help)
+		fmt.Fprintf(&buf, "# TYPE supercronic_job_%s gauge\n", name)
+		for _, r := range results {
+			if v, ok := value(r); ok {
+				fmt.Fprintf(&buf, "supercronic_job_%s{%s} %s\n", name, r.labels, strconv.FormatFloat(v, 'f', -1, 64))
+			}
+		}
+	}
+
+	gauge("duration_seconds", "How long the last run took.", func(r *result) (float64, bool) {
+		return r.duration.Seconds(), true
+	})
+	gauge("exit_code", "The exit code of the last run (-1 if it did not exit normally).", func(r *result) (float64, bool) {
+		return float64(r.exitCode), true
+	})
+	gauge("succeeded", "Whether the last run succeeded.", func(r *result) (float64, bool) {
+		if r.succeeded {
+			return 1, true
+		}
+		return 0, true
+	})
+	gauge("circuit_breaker_tripped", "Whether the job's circuit breaker was tripped as of the last run, so that it is no longer scheduled.", func(r *result) (float64, bool) {
+		if r.tripped {
+			return 1, true
+		}
+		return 0, true
+	})
+	gauge("last_run_timestamp_seconds", "When the last run finished.", func(r *result) (float64, bool) {
+		return unixSeconds(r.finishedAt), true
+	})
+	gauge("last_success_timestamp_seconds", "When the last successful run finished.", func(r *result) (float64, bool) {
+		return unixSeconds(r.succeededAt), !r.succeededAt.IsZero()
+	})
+
+	return buf.Bytes()
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// write replaces the file with the current metrics. Callers must hold h.mu.
+func (h *Hook) write() error {
+	// node_exporter only reads files ending with .prom, so the temporary
+	// file is ignored until it's renamed.
+	tmp, err := ioutil.TempFile(filepath.Dir(h.path), "."+filepath.Base(h.path)+".")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(h.format()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	// TempFile creates files only readable by their owner, but node_exporter
+	// often runs as another user.
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), h.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return nil
+}
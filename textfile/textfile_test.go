@@ -0,0 +1,110 @@
+package textfile
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+func newTestExecution(position int, err error) *cron.Execution {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	startedAt := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	return &cron.Execution{
+		Job: &crontab.Job{
+			CrontabLine: crontab.CrontabLine{Schedule: "@daily", Command: "backup.sh"},
+			Position:    position,
+		},
+		Logger:     logrus.NewEntry(logger),
+		StartedAt:  startedAt,
+		FinishedAt: startedAt.Add(1500 * time.Millisecond),
+		Err:        err,
+	}
+}
+
+func TestHookWritesMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "textfile")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "supercronic.prom")
+	hook := NewHook(path)
+
+	hook.JobFinished(newTestExecution(0, nil))
+
+	named := newTestExecution(1, errors.New("exit status 2"))
+	named.Job.Name = "backup"
+	named.Job.Source = "/etc/crontab"
+	named.ExitCode = 2
+	named.Tripped = true
+	hook.JobFinished(named)
+
+	metrics, err := ioutil.ReadFile(path)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Contains(t, string(metrics), "# TYPE supercronic_job_duration_seconds gauge\n"+
+		"supercronic_job_duration_seconds{cron_job=\"0\"} 1.5\n"+
+		"supercronic_job_duration_seconds{cron_job=\"backup\",source=\"/etc/crontab\"} 1.5\n")
+	assert.Contains(t, string(metrics), "supercronic_job_exit_code{cron_job=\"backup\",source=\"/etc/crontab\"} 2\n")
+	assert.Contains(t, string(metrics), "supercronic_job_succeeded{cron_job=\"0\"} 1\n")
+	assert.Contains(t, string(metrics), "supercronic_job_succeeded{cron_job=\"backup\",source=\"/etc/crontab\"} 0\n")
+	assert.Contains(t, string(metrics), "supercronic_job_circuit_breaker_tripped{cron_job=\"0\"} 0\n")
+	assert.Contains(t, string(metrics), "supercronic_job_circuit_breaker_tripped{cron_job=\"backup\",source=\"/etc/crontab\"} 1\n")
+	assert.Contains(t, string(metrics), "supercronic_job_last_success_timestamp_seconds{cron_job=\"0\"} 1546300801.5\n")
+	assert.NotContains(t, string(metrics), "supercronic_job_last_success_timestamp_seconds{cron_job=\"backup\"")
+
+	info, err := os.Stat(path)
+	if assert.Nil(t, err) {
+		assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if assert.Nil(t, err) {
+		assert.Equal(t, 1, len(files))
+	}
+}
+
+func TestHookKeepsLastSuccess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "textfile")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "supercronic.prom")
+	hook := NewHook(path)
+
+	hook.JobFinished(newTestExecution(0, nil))
+
+	failed := newTestExecution(0, errors.New("exit status 1"))
+	failed.FinishedAt = failed.FinishedAt.Add(time.Hour)
+	failed.ExitCode = 1
+	hook.JobFinished(failed)
+
+	metrics, err := ioutil.ReadFile(path)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Contains(t, string(metrics), "supercronic_job_succeeded{cron_job=\"0\"} 0\n")
+	assert.Contains(t, string(metrics), "supercronic_job_last_run_timestamp_seconds{cron_job=\"0\"} 1546304401.5\n")
+	assert.Contains(t, string(metrics), "supercronic_job_last_success_timestamp_seconds{cron_job=\"0\"} 1546300801.5\n")
+}
+
+func TestEscapeLabel(t *testing.T) {
+	assert.Equal(t, `a\"b\\c\nd`, escapeLabel("a\"b\\c\nd"))
+}
@@ -0,0 +1,185 @@
+// Package tracing exports a span for every job execution to an
+// OpenTelemetry collector, using OTLP over HTTP (with JSON encoding).
+package tracing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"supercronic/cron"
+)
+
+// Timeout for exporting each span.
+var EXPORT_TIMEOUT = 5 * time.Second
+
+const defaultServiceName = "supercronic"
+
+type Config struct {
+	// Endpoint is the collector's base URL (e.g. http://localhost:4318).
+	// Spans are sent to its /v1/traces path.
+	Endpoint    string            `yaml:"endpoint"`
+	Headers     map[string]string `yaml:"headers"`
+	ServiceName string            `yaml:"service_name"`
+	// ResourceAttributes are added to the resource describing supercronic,
+	// e.g. deployment.environment.
+	ResourceAttributes map[string]string `yaml:"resource_attributes"`
+}
+
+// Hook exports a span when a job finishes.
+type Hook struct {
+	url      string
+	headers  map[string]string
+	resource resource
+	client   *http.Client
+}
+
+func NewHook(config Config) (*Hook, error) {
+	if config.Endpoint == "" {
+		return nil, fmt.Errorf("tracing is missing endpoint")
+	}
+
+	serviceName := config.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+
+	attributes := []attribute{stringAttribute("service.name", serviceName)}
+	for k, v := range config.ResourceAttributes {
+		attributes = append(attributes, stringAttribute(k, v))
+	}
+
+	return &Hook{
+		url:      strings.TrimSuffix(config.Endpoint, "/") + "/v1/traces",
+		headers:  config.Headers,
+		resource: resource{Attributes: attributes},
+		client:   &http.Client{Timeout: EXPORT_TIMEOUT},
+	}, nil
+}
+
+func (h *Hook) JobStarted(e *cron.Execution) {}
+
+func (h *Hook) JobFinished(e *cron.Execution) {
+	s, err := newSpan(e)
+	if err != nil {
+		e.Logger.Errorf("failed to create span: %v", err)
+		return
+	}
+
+	if err := h.export(s); err != nil {
+		e.Logger.Errorf("failed to export span: %v", err)
+	}
+}
+
+func newSpan(e *cron.Execution) (*span, error) {
+	traceID, err := randomID(16)
+	if err != nil {
+		return nil, err
+	}
+
+	spanID, err := randomID(8)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := []attribute{
+		stringAttribute("job.schedule", e.Job.Schedule),
+		stringAttribute("job.command", e.Job.Command),
+		intAttribute("job.position", int64(e.Job.Position)),
+		intAttribute("job.iteration", int64(e.Iteration)),
+		intAttribute("job.exit_code", int64(e.ExitCode)),
+		doubleAttribute("job.duration_seconds", e.Duration().Seconds()),
+	}
+
+	if e.Job.Name != "" {
+		attributes = append(attributes, stringAttribute("job.name", e.Job.Name))
+	}
+
+	if e.Job.Source != "" {
+		attributes = append(attributes, stringAttribute("job.source", e.Job.Source))
+	}
+
+	if !e.ScheduledAt.IsZero() {
+		attributes = append(attributes, stringAttribute("job.scheduled_at", e.ScheduledAt.Format(time.RFC3339)))
+	}
+
+	status := spanStatus{Code: statusOk}
+	if e.Err != nil {
+		status = spanStatus{Code: statusError, Message: e.Err.Error()}
+	}
+
+	return &span{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		Name:       e.Job.Command,
+		Kind:       spanKindInternal,
+		Start:      unixNano(e.StartedAt),
+		End:        unixNano(e.FinishedAt),
+		Attributes: attributes,
+		Status:     status,
+	}, nil
+}
+
+func (h *Hook) export(s *span) error {
+	body, err := json.Marshal(&exportRequest{
+		ResourceSpans: []resourceSpans{
+			{
+				Resource: h.resource,
+				ScopeSpans: []scopeSpans{
+					{
+						Scope: scope{Name: "supercronic"},
+						Spans: []*span{s},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", h.url, resp.Status)
+	}
+
+	return nil
+}
+
+func randomID(size int) (string, error) {
+	id := make([]byte, size)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// OTLP's JSON encoding represents 64-bit integers as strings.
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"supercronic/cron"
+	"supercronic/crontab"
+)
+
+type request struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+func newTestExecution(err error) *cron.Execution {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	startedAt := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	return &cron.Execution{
+		Job: &crontab.Job{
+			CrontabLine: crontab.CrontabLine{Schedule: "@daily", Command: "backup.sh"},
+			Position:    3,
+		},
+		Logger:     logrus.NewEntry(logger),
+		StartedAt:  startedAt,
+		FinishedAt: startedAt.Add(1500 * time.Millisecond),
+		Err:        err,
+		ExitCode:   2,
+	}
+}
+
+func TestHookExportsSpans(t *testing.T) {
+	requests := make(chan request, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, "POST", r.Method)
+		requests <- request{path: r.URL.Path, header: r.Header, body: body}
+	}))
+	defer server.Close()
+
+	hook, err := NewHook(Config{
+		Endpoint:           server.URL + "/",
+		Headers:            map[string]string{"Authorization": "Bearer token"},
+		ResourceAttributes: map[string]string{"deployment.environment": "test"},
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	hook.JobFinished(newTestExecution(errors.New("exit status 2")))
+
+	r := <-requests
+	assert.Equal(t, "/v1/traces", r.path)
+	assert.Equal(t, "application/json", r.header.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", r.header.Get("Authorization"))
+
+	var body exportRequest
+	if !assert.Nil(t, json.Unmarshal(r.body, &body)) {
+		return
+	}
+
+	if !assert.Len(t, body.ResourceSpans, 1) {
+		return
+	}
+
+	rs := body.ResourceSpans[0]
+	assert.Contains(t, rs.Resource.Attributes, stringAttribute("service.name", "supercronic"))
+	assert.Contains(t, rs.Resource.Attributes, stringAttribute("deployment.environment", "test"))
+
+	if !assert.Len(t, rs.ScopeSpans, 1) || !assert.Len(t, rs.ScopeSpans[0].Spans, 1) {
+		return
+	}
+
+	s := rs.ScopeSpans[0].Spans[0]
+	assert.Len(t, s.TraceID, 32)
+	assert.Len(t, s.SpanID, 16)
+	assert.Equal(t, "backup.sh", s.Name)
+	assert.Equal(t, "1546300800000000000", s.Start)
+	assert.Equal(t, "1546300801500000000", s.End)
+	assert.Equal(t, spanStatus{Code: statusError, Message: "exit status 2"}, s.Status)
+	assert.Contains(t, s.Attributes, stringAttribute("job.schedule", "@daily"))
+	assert.Contains(t, s.Attributes, intAttribute("job.position", 3))
+	assert.Contains(t, s.Attributes, intAttribute("job.exit_code", 2))
+	assert.Contains(t, s.Attributes, doubleAttribute("job.duration_seconds", 1.5))
+}
+
+func TestNewHookRequiresEndpoint(t *testing.T) {
+	_, err := NewHook(Config{})
+	assert.NotNil(t, err)
+}
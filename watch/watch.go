@@ -0,0 +1,221 @@
+// Package watch detects changes to crontab files on disk.
+package watch
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+
+	"supercronic/crontab"
+)
+
+var (
+	// DEBOUNCE_DELAY is how long we wait for filesystem events to settle
+	// before looking at the crontab files again.
+	DEBOUNCE_DELAY = 500 * time.Millisecond
+)
+
+type snapshot map[string][sha256.Size]byte
+
+// Watcher sends on C when the contents of the crontab files designated by
+// CRONTAB arguments (files, directories, or globs) change.
+type Watcher struct {
+	C <-chan struct{}
+
+	paths    []string
+	logger   *logrus.Entry
+	fsw      *fsnotify.Watcher
+	dirs     map[string]bool
+	snapshot snapshot
+	done     chan struct{}
+}
+
+func New(logger *logrus.Entry, paths ...string) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	c := make(chan struct{}, 1)
+
+	w := &Watcher{
+		C:      c,
+		paths:  paths,
+		logger: logger,
+		fsw:    fsw,
+		dirs:   make(map[string]bool),
+		done:   make(chan struct{}),
+	}
+
+	w.snapshot, err = w.takeSnapshot()
+	if err != nil {
+		fsw.Close()
+		return nil, err
+	}
+
+	if err := w.watchDirectories(); err != nil {
+		fsw.Close()
+		return nil, err
+	}
+
+	go w.run(c)
+
+	return w, nil
+}
+
+func (w *Watcher) Close() error {
+	close(w.done)
+	return w.fsw.Close()
+}
+
+// directories returns the directories we need to watch. We watch the
+// directories holding the crontabs rather than the files themselves, since
+// editors and Kubernetes ConfigMap updates replace files (or symlinks to
+// them) instead of modifying them in place.
+func (w *Watcher) directories() ([]string, error) {
+	dirs := make([]string, 0)
+
+	for _, path := range w.paths {
+		if strings.ContainsAny(path, "*?[") {
+			if dir := filepath.Dir(path); !strings.ContainsAny(dir, "*?[") {
+				dirs = append(dirs, dir)
+			}
+		} else if info, err := os.Stat(path); err == nil && info.IsDir() {
+			dirs = append(dirs, path)
+		}
+	}
+
+	files, err := w.files()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		dirs = append(dirs, filepath.Dir(file))
+	}
+
+	return dirs, nil
+}
+
+func (w *Watcher) files() ([]string, error) {
+	var files []string
+
+	for _, path := range w.paths {
+		expanded, err := crontab.ExpandPath(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, expanded...)
+	}
+
+	return files, nil
+}
+
+func (w *Watcher) watchDirectories() error {
+	dirs, err := w.directories()
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		if w.dirs[dir] {
+			continue
+		}
+
+		w.logger.Debugf("watching directory: %s", dir)
+
+		if err := w.fsw.Add(dir); err != nil {
+			return err
+		}
+		w.dirs[dir] = true
+	}
+
+	return nil
+}
+
+func (w *Watcher) takeSnapshot() (snapshot, error) {
+	files, err := w.files()
+	if err != nil {
+		return nil, err
+	}
+
+	s := make(snapshot, len(files))
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		s[file] = sha256.Sum256(data)
+	}
+
+	return s, nil
+}
+
+func (s snapshot) equal(other snapshot) bool {
+	if len(s) != len(other) {
+		return false
+	}
+
+	for file, sum := range s {
+		if otherSum, ok := other[file]; !ok || otherSum != sum {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (w *Watcher) run(c chan struct{}) {
+	var settled <-chan time.Time
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			w.logger.Debugf("filesystem event: %s", event)
+			settled = time.After(DEBOUNCE_DELAY)
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Warnf("error watching crontab: %v", err)
+		case <-settled:
+			settled = nil
+
+			s, err := w.takeSnapshot()
+			if err != nil {
+				// The files might be in the middle of being
+				// replaced. We'll look again on the next event.
+				w.logger.Debugf("could not read crontab: %v", err)
+				continue
+			}
+
+			if err := w.watchDirectories(); err != nil {
+				w.logger.Warnf("error watching crontab: %v", err)
+			}
+
+			if s.equal(w.snapshot) {
+				continue
+			}
+
+			w.snapshot = s
+
+			select {
+			case c <- struct{}{}:
+			default:
+				// A change notification is already pending.
+			}
+		}
+	}
+}
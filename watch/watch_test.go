@@ -0,0 +1,129 @@
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	DEBOUNCE_DELAY = 50 * time.Millisecond
+}
+
+func newTestLogger() *logrus.Entry {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logrus.NewEntry(logger)
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectChange(t *testing.T, w *Watcher, label string) {
+	select {
+	case <-w.C:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for change: %s", label)
+	}
+}
+
+func expectNoChange(t *testing.T, w *Watcher, label string) {
+	select {
+	case <-w.C:
+		t.Fatalf("unexpected change: %s", label)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "crontab")
+	writeFile(t, path, "* * * * * a")
+	writeFile(t, filepath.Join(dir, "unrelated"), "")
+
+	w, err := New(newTestLogger(), path)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer w.Close()
+
+	writeFile(t, path, "* * * * * b")
+	expectChange(t, w, "write")
+
+	writeFile(t, path, "* * * * * b")
+	expectNoChange(t, w, "same content")
+
+	writeFile(t, filepath.Join(dir, "unrelated"), "foo")
+	expectNoChange(t, w, "unrelated file")
+
+	tmp := filepath.Join(dir, ".crontab.tmp")
+	writeFile(t, tmp, "* * * * * c")
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	expectChange(t, w, "rename")
+}
+
+func TestWatchDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile(t, filepath.Join(dir, "a"), "* * * * * a")
+
+	w, err := New(newTestLogger(), dir)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer w.Close()
+
+	writeFile(t, filepath.Join(dir, "b"), "* * * * * b")
+	expectChange(t, w, "new file")
+
+	if err := os.Remove(filepath.Join(dir, "a")); err != nil {
+		t.Fatal(err)
+	}
+	expectChange(t, w, "removed file")
+}
+
+func TestWatchMultiplePaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supercronic-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.Mkdir(filepath.Join(dir, "cron.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "crontab")
+	writeFile(t, path, "* * * * * a")
+
+	w, err := New(newTestLogger(), path, filepath.Join(dir, "cron.d"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer w.Close()
+
+	writeFile(t, path, "* * * * * b")
+	expectChange(t, w, "first path")
+
+	writeFile(t, filepath.Join(dir, "cron.d", "c"), "* * * * * c")
+	expectChange(t, w, "second path")
+}